@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// adoptiveActions returns actions without the calls that would create or
+// delete the infrastructure resourceType adopts, when its entry is adoptive.
+// aws_default_vpc, for one, takes over the region's default VPC: it modifies
+// and tags it but never calls ec2:CreateVpc or ec2:DeleteVpc. Deleting
+// adopted infrastructure on destroy, where the provider supports it, is a
+// companion that applies only when the resource asks for it (force_destroy).
+func adoptiveActions(resourceType string, actions []string) []string {
+	adopted := permissionsDB[resourceType].Adopts
+	if adopted == "" {
+		return actions
+	}
+	lifecycle := lifecycleActions(permissionsDB[adopted].Actions)
+	kept := make([]string, 0, len(actions))
+	for _, action := range actions {
+		if !lifecycle[strings.ToLower(action)] {
+			kept = append(kept, action)
+		}
+	}
+	return kept
+}
+
+// lifecycleActions returns, lowercased, the Create* and Delete* actions of
+// actions other than tagging calls: the calls that bring the infrastructure
+// of an entry into and out of existence.
+func lifecycleActions(actions []string) map[string]bool {
+	lifecycle := make(map[string]bool)
+	for _, action := range actions {
+		_, name, _ := strings.Cut(action, ":")
+		if (strings.HasPrefix(name, "Create") || strings.HasPrefix(name, "Delete")) && !strings.HasSuffix(name, "Tags") {
+			lifecycle[strings.ToLower(action)] = true
+		}
+	}
+	return lifecycle
+}
+
+// adoptedResources returns the addresses of the resources in result whose
+// types are adoptive.
+func adoptedResources(result *ParseResult) []string {
+	var adopted []string
+	for _, resource := range result.Resources {
+		if permissionsDB[resource.Type].Adopts != "" {
+			adopted = append(adopted, resourceAddress(resource))
+		}
+	}
+	return adopted
+}
+
+// printAdoptedResources lists the adoptive resources in the run summary, so
+// the missing create and delete actions are not mistaken for a gap.
+func printAdoptedResources(result *ParseResult) {
+	if adopted := adoptedResources(result); len(adopted) > 0 {
+		fmt.Fprintf(os.Stderr, "  Adopted default resources (no create/delete): %s\n", strings.Join(adopted, ", "))
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAdoptiveResourceActions(t *testing.T) {
+	if err := loadPermissionsDB(); err != nil {
+		t.Fatalf("Error loading permissions DB: %v", err)
+	}
+	source := `resource "aws_default_vpc" "default" {}
+
+resource "aws_default_subnet" "a" {
+  availability_zone = "us-east-1a"
+  force_destroy     = true
+}
+`
+	result, err := parseTerraformSource([]byte(source), "main.tf")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	vpc := resourceActions(result.Resources[0])
+	for _, action := range []string{"ec2:CreateVpc", "ec2:DeleteVpc"} {
+		if containsString(vpc, action) {
+			t.Errorf("The default VPC is adopted, not created or deleted; got %s", action)
+		}
+	}
+	for _, action := range []string{"ec2:ModifyVpcAttribute", "ec2:CreateTags", "ec2:CreateDefaultVpc"} {
+		if !containsString(vpc, action) {
+			t.Errorf("Expected %s, got %v", action, vpc)
+		}
+	}
+
+	subnet := resourceActions(result.Resources[1])
+	if containsString(subnet, "ec2:CreateSubnet") || !containsString(subnet, "ec2:DeleteSubnet") {
+		t.Errorf("Expected DeleteSubnet only through force_destroy, got %v", subnet)
+	}
+
+	if got := adoptedResources(result); strings.Join(got, ",") != "aws_default_vpc.default,aws_default_subnet.a" {
+		t.Errorf("Unexpected adopted resources %v", got)
+	}
+}
+
+func TestAdoptiveActionsFilterOnlyLifecycle(t *testing.T) {
+	defer func(saved PermissionMap) { permissionsDB = saved }(permissionsDB)
+	permissionsDB = PermissionMap{
+		"aws_vpc":         {Actions: []string{"ec2:CreateVpc", "ec2:DeleteVpc", "ec2:CreateTags", "ec2:ModifyVpcAttribute"}},
+		"aws_default_vpc": {Adopts: "aws_vpc"},
+	}
+	got := adoptiveActions("aws_default_vpc", []string{"ec2:createvpc", "ec2:CreateTags", "ec2:ModifyVpcAttribute", "ec2:CreateDefaultVpc"})
+	if strings.Join(got, ",") != "ec2:CreateTags,ec2:ModifyVpcAttribute,ec2:CreateDefaultVpc" {
+		t.Errorf("Unexpected actions %v", got)
+	}
+	if got := adoptiveActions("aws_vpc", []string{"ec2:CreateVpc"}); len(got) != 1 {
+		t.Errorf("Entries that adopt nothing are left alone, got %v", got)
+	}
+}
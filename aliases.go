@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// permissionsDBAliasesKey holds the alias table in permissions.json: old
+// names of resources and data sources that the AWS provider renamed, mapped
+// to their current names. It is removed from permissionsDB on load.
+const permissionsDBAliasesKey = "_aliases"
+
+// permissionAliases maps deprecated type names, with the "data." prefix for
+// data sources, to the names whose entries they use.
+var permissionAliases map[string]string
+
+// resolvePermissionAliases gives every alias the entry of its current name,
+// so lookups by the deprecated name find the current permission set. It runs
+// after the embedded database and again after drop-in mappings are loaded,
+// so an alias follows an overridden entry.
+func resolvePermissionAliases() {
+	for alias, target := range permissionAliases {
+		if entry, ok := permissionsDB[target]; ok {
+			permissionsDB[alias] = entry
+		}
+	}
+}
+
+// deprecatedTypeUsages lists the deprecated resource and data source types in
+// result with their current names and how often each is used, e.g.
+// "aws_alb (now aws_lb): 2", sorted.
+func deprecatedTypeUsages(result *ParseResult) []string {
+	counts := make(map[string]int)
+	for _, resource := range result.Resources {
+		if _, ok := permissionAliases[resource.Type]; ok {
+			counts[resource.Type]++
+		}
+	}
+	for _, dataSource := range result.DataSources {
+		if _, ok := permissionAliases[dataSource.permissionsKey()]; ok {
+			counts[dataSource.permissionsKey()]++
+		}
+	}
+
+	usages := make([]string, 0, len(counts))
+	for name, count := range counts {
+		usages = append(usages, fmt.Sprintf("%s (now %s): %d", name, permissionAliases[name], count))
+	}
+	sort.Strings(usages)
+	return usages
+}
+
+// permissionEntryCount is the number of entries in permissionsDB, not
+// counting aliases.
+func permissionEntryCount() int {
+	count := 0
+	for key := range permissionsDB {
+		if _, ok := permissionAliases[key]; !ok {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPermissionAliases(t *testing.T) {
+	if err := loadPermissionsDB(); err != nil {
+		t.Fatalf("Error loading permissions DB: %v", err)
+	}
+	t.Cleanup(func() { _ = loadPermissionsDB() })
+
+	if permissionAliases["aws_alb"] != "aws_lb" {
+		t.Fatalf("Expected aws_alb to be an alias of aws_lb, got %v", permissionAliases)
+	}
+	alb, lb := permissionsDB["aws_alb"], permissionsDB["aws_lb"]
+	if len(alb.Actions) == 0 || strings.Join(alb.Actions, ",") != strings.Join(lb.Actions, ",") {
+		t.Errorf("aws_alb should use the aws_lb entry, got %v", alb.Actions)
+	}
+	if _, ok := permissionsDB["data.aws_s3_bucket_object"]; !ok {
+		t.Error("Expected the deprecated data source name to resolve")
+	}
+	if permissionEntryCount() != len(permissionsDB)-len(permissionAliases) {
+		t.Errorf("Aliases should not count as entries: %d of %d", permissionEntryCount(), len(permissionsDB))
+	}
+
+	// A drop-in mapping overriding the current name carries over to its aliases
+	permissionsDB["aws_lb"] = ResourcePermissions{Actions: []string{"elasticloadbalancing:DescribeLoadBalancers"}, ResourceTypes: []string{"loadbalancer"}}
+	resolvePermissionAliases()
+	if actions := permissionsDB["aws_alb"].Actions; len(actions) != 1 {
+		t.Errorf("Expected the alias to follow the overridden entry, got %v", actions)
+	}
+}
+
+func TestDeprecatedTypeUsages(t *testing.T) {
+	if err := loadPermissionsDB(); err != nil {
+		t.Fatalf("Error loading permissions DB: %v", err)
+	}
+
+	result := &ParseResult{
+		Resources: []Resource{
+			{Type: "aws_alb", Name: "a"},
+			{Type: "aws_alb", Name: "b"},
+			{Type: "aws_lb", Name: "c"},
+		},
+		DataSources: []Resource{{Kind: KindData, Type: "aws_s3_bucket_object", Name: "config"}},
+	}
+	usages := deprecatedTypeUsages(result)
+	want := "aws_alb (now aws_lb): 2,data.aws_s3_bucket_object (now data.aws_s3_object): 1"
+	if strings.Join(usages, ",") != want {
+		t.Errorf("Expected %s, got %v", want, usages)
+	}
+}
+
+func TestValidatePermissionAliases(t *testing.T) {
+	if err := loadActionCatalog(); err != nil {
+		t.Fatal(err)
+	}
+	db := PermissionMap{"aws_lb": {Actions: []string{"elasticloadbalancing:CreateLoadBalancer"}, ResourceTypes: []string{"loadbalancer"}}}
+	aliases := map[string]string{"aws_alb": "aws_lb", "aws_elb_v1": "aws_elb", "aws_alb_old": "aws_alb"}
+
+	messages := make(map[string]string)
+	for _, finding := range validatePermissionsDB(db, aliases) {
+		messages[finding.Entry] = finding.Message
+	}
+	if _, ok := messages["aws_alb"]; ok {
+		t.Errorf("Unexpected finding for a valid alias: %s", messages["aws_alb"])
+	}
+	if !strings.Contains(messages["aws_elb_v1"], "has no entry") {
+		t.Errorf("Expected a missing target finding, got %v", messages)
+	}
+	if !strings.Contains(messages["aws_alb_old"], "itself an alias") {
+		t.Errorf("Expected a chained alias finding, got %v", messages)
+	}
+}
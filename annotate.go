@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+var annotateFlag bool
+
+// annotationsSuffix replaces the extension of a JSON --output file to name
+// its annotations sidecar.
+const annotationsSuffix = ".annotations.json"
+
+// statementAnnotation lists what required one statement of the policy.
+type statementAnnotation struct {
+	Statement  int      `json:"statement"`
+	Sid        string   `json:"sid,omitempty"`
+	RequiredBy []string `json:"required_by"`
+}
+
+// policyAnnotations is the sidecar written next to an annotated JSON policy,
+// which has no room for comments.
+type policyAnnotations struct {
+	Policy     string                `json:"policy"`
+	Statements []statementAnnotation `json:"statements"`
+}
+
+// validateAnnotateFlags checks that --annotate is used with a format it can
+// annotate.
+func validateAnnotateFlags(format OutputFormat) error {
+	if !annotateFlag {
+		return nil
+	}
+	switch format {
+	case FormatJSON, FormatYAML, FormatTerraform:
+		return nil
+	}
+	return fmt.Errorf("--annotate supports the json, yaml and terraform formats, not %s", format)
+}
+
+// annotateStatements returns, for each statement of policy, the resource and
+// data source addresses (with their file:line) whose actions it grants, plus
+// the state backend and the AWS provider for the actions they need. A
+// statement only granting actions of the --merge baseline has none.
+func annotateStatements(policy IAMPolicy, result *ParseResult) []statementAnnotation {
+	contributions := collectContributions(result)
+	backendActions := make(map[*BackendConfig]map[string]bool)
+	if includeStateBackendFlag {
+		for _, backend := range stateBackends(result) {
+			backendActions[backend] = make(map[string]bool)
+			addBackendPermissions(backendActions[backend], backend)
+		}
+	}
+
+	annotations := make([]statementAnnotation, len(policy.Statement))
+	for i, statement := range policy.Statement {
+		annotations[i] = statementAnnotation{Statement: i, Sid: statement.Sid, RequiredBy: []string{}}
+		if statement.Effect != "Allow" {
+			continue
+		}
+		patterns := toStringSlice(statement.Action)
+		grants := func(actions []string) bool {
+			for _, action := range actions {
+				for _, pattern := range patterns {
+					if iamWildcardMatch(pattern, action, true) {
+						return true
+					}
+				}
+			}
+			return false
+		}
+
+		for _, contribution := range contributions {
+			if !grants(contribution.Actions) {
+				continue
+			}
+			source := contribution.Address
+			if contribution.Location != "" {
+				source += " (" + contribution.Location + ")"
+			}
+			annotations[i].RequiredBy = append(annotations[i].RequiredBy, source)
+		}
+		if includeStateBackendFlag {
+			for _, backend := range stateBackends(result) {
+				if grants(sortedSet(backendActions[backend])) {
+					annotations[i].RequiredBy = append(annotations[i].RequiredBy, backendSource(backend))
+				}
+			}
+		}
+		if len(contributions) > 0 && grants([]string{"sts:GetCallerIdentity"}) {
+			annotations[i].RequiredBy = append(annotations[i].RequiredBy, "AWS provider initialization")
+		}
+	}
+	return annotations
+}
+
+// backendSource names the state backend in annotations. Without a backend
+// block the S3 backend is assumed, as addBackendPermissions does.
+func backendSource(backend *BackendConfig) string {
+	if backend == nil {
+		return "Terraform state backend (s3, assumed)"
+	}
+	return fmt.Sprintf("Terraform state backend (%s)", describeBackend(backend))
+}
+
+// annotationComment renders an annotation as comment lines.
+func annotationComment(annotation statementAnnotation) []string {
+	if len(annotation.RequiredBy) == 0 {
+		return []string{"Not required by any scanned resource"}
+	}
+	lines := []string{"Required by:"}
+	for _, source := range annotation.RequiredBy {
+		lines = append(lines, "  "+source)
+	}
+	return lines
+}
+
+// formatAnnotatedPolicy renders policy like formatPolicy with a comment above
+// each statement. JSON is rendered without comments; its annotations go to
+// the sidecar written by writeAnnotations.
+func formatAnnotatedPolicy(policy IAMPolicy, result *ParseResult, format OutputFormat, annotations []statementAnnotation) (string, error) {
+	comments := make([][]string, len(annotations))
+	for i, annotation := range annotations {
+		comments[i] = annotationComment(annotation)
+	}
+
+	switch format {
+	case FormatTerraform:
+		return terraformOutput(policy, comments)
+	case FormatYAML:
+		var doc yaml.Node
+		if err := doc.Encode(&policy); err != nil {
+			return "", fmt.Errorf("error marshaling policy to YAML: %w", err)
+		}
+		for i := 0; i+1 < len(doc.Content); i += 2 {
+			if doc.Content[i].Value != "Statement" {
+				continue
+			}
+			for j, item := range doc.Content[i+1].Content {
+				if j < len(comments) {
+					item.HeadComment = "# " + strings.Join(comments[j], "\n# ")
+				}
+			}
+		}
+		yamlBytes, err := yaml.Marshal(&doc)
+		if err != nil {
+			return "", fmt.Errorf("error marshaling policy to YAML: %w", err)
+		}
+		return string(yamlBytes), nil
+	}
+	return formatPolicy(policy, result, format)
+}
+
+// annotationsFile returns the sidecar path of a JSON policy file.
+func annotationsFile(output string) string {
+	return strings.TrimSuffix(output, filepath.Ext(output)) + annotationsSuffix
+}
+
+// writeAnnotations writes the annotations sidecar of the JSON policy written
+// to output. A policy printed to stdout gets none.
+func writeAnnotations(output string, annotations []statementAnnotation) {
+	if output == "" {
+		fmt.Fprintf(os.Stderr, "Warning: --annotate writes the annotations of a JSON policy next to its --output file; none written for stdout\n")
+		return
+	}
+	data, err := json.MarshalIndent(policyAnnotations{Policy: filepath.Base(output), Statements: annotations}, "", "  ")
+	path := annotationsFile(output)
+	if err != nil {
+		exitWithError(&OutputError{Path: path, Err: fmt.Errorf("error marshaling annotations: %w", err)})
+	}
+	if err := writeOutputFile(path, append(data, '\n'), outputMode, forceFlag); err != nil {
+		exitWithError(&OutputError{Path: path, Err: err})
+	}
+	statusf("Annotations written to: %s\n", path)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAnnotateStatements(t *testing.T) {
+	if err := loadPermissionsDB(); err != nil {
+		t.Fatalf("Error loading permissions DB: %v", err)
+	}
+	source := `resource "aws_sqs_queue" "jobs" {
+  name = "jobs"
+}
+
+resource "aws_s3_bucket" "data" {
+  bucket = "data"
+}
+`
+	result, err := parseTerraformSource([]byte(source), "main.tf")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	includeStateBackendFlag = true
+	policy := IAMPolicy{Version: "2012-10-17", Statement: []IAMStatement{
+		{Sid: "Queues", Effect: "Allow", Action: []string{"sqs:*"}, Resource: "*"},
+		{Effect: "Allow", Action: []string{"s3:CreateBucket", "s3:GetObject", "sts:GetCallerIdentity"}, Resource: "*"},
+		{Sid: "Baseline", Effect: "Allow", Action: []string{"logs:PutLogEvents"}, Resource: "*"},
+	}}
+
+	annotations := annotateStatements(policy, result)
+	if len(annotations) != 3 {
+		t.Fatalf("Expected 3 annotations, got %+v", annotations)
+	}
+	if got := annotations[0].RequiredBy; len(got) != 1 || got[0] != "aws_sqs_queue.jobs (main.tf:1)" || annotations[0].Sid != "Queues" {
+		t.Errorf("Wildcard actions should be matched to the queue, got %+v", annotations[0])
+	}
+	want := []string{"aws_s3_bucket.data (main.tf:5)", "Terraform state backend (s3, assumed)", "AWS provider initialization"}
+	if got := annotations[1].RequiredBy; strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+	if len(annotations[2].RequiredBy) != 0 {
+		t.Errorf("A baseline statement should have no sources, got %v", annotations[2].RequiredBy)
+	}
+
+	hcl, err := formatAnnotatedPolicy(policy, result, FormatTerraform, annotations)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.Contains(hcl, "  # Required by:\n  #   aws_sqs_queue.jobs (main.tf:1)\n  statement {\n    sid    = \"Queues\"") {
+		t.Errorf("Expected a comment above the first statement, got:\n%s", hcl)
+	}
+	if !strings.Contains(hcl, "  # Not required by any scanned resource\n  statement {") {
+		t.Errorf("Expected the baseline statement to be marked, got:\n%s", hcl)
+	}
+
+	yamlOut, err := formatAnnotatedPolicy(policy, result, FormatYAML, annotations)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.Contains(yamlOut, "# Required by:\n    #   aws_sqs_queue.jobs (main.tf:1)\n    - Sid: Queues") {
+		t.Errorf("Expected a comment above the first YAML statement, got:\n%s", yamlOut)
+	}
+}
+
+func TestAnnotationsFile(t *testing.T) {
+	if got := annotationsFile("out/policy.json"); got != "out/policy.annotations.json" {
+		t.Errorf("Unexpected sidecar path %q", got)
+	}
+}
+
+func TestValidateAnnotateFlags(t *testing.T) {
+	annotateFlag = true
+	defer func() { annotateFlag = false }()
+	if err := validateAnnotateFlags(FormatYAML); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if err := validateAnnotateFlags(FormatCSV); err == nil {
+		t.Errorf("Expected an error for csv")
+	}
+}
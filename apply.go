@@ -0,0 +1,319 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamtypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/spf13/cobra"
+)
+
+// maxPolicyVersions is the number of versions IAM keeps for a managed policy.
+const maxPolicyVersions = 5
+
+var (
+	applyPolicyARNFlag string
+	applyDryRunFlag    bool
+)
+
+var applyCmd = &cobra.Command{
+	Use:   "apply --policy-arn ARN policy.json",
+	Short: "Publish a generated policy as a new version of a managed IAM policy",
+	Long: `Create a new default version of a customer managed IAM policy from a
+generated policy document, read from a file or from stdin ("-").
+
+The new document is compared with the policy's current default version first;
+nothing is changed when they grant the same access. IAM keeps at most five
+versions of a policy, so when the limit is reached the oldest non-default
+version is deleted. Documents with lint errors or over the managed policy
+size limit are refused before anything is changed. With --dry-run only the
+difference is printed.
+
+Credentials and region are loaded the way the AWS CLI does, or from
+--profile, --region and --assume-role-arn. The caller needs
+iam:GetPolicy, iam:GetPolicyVersion, iam:ListPolicyVersions,
+iam:CreatePolicyVersion and iam:DeletePolicyVersion on the policy.
+
+Example:
+  tf-iam-scanner --path ./terraform --least-privilege | \
+    tf-iam-scanner apply --policy-arn arn:aws:iam::123456789012:policy/terraform-ci -`,
+	Args: cobra.ExactArgs(1),
+	Run:  runApply,
+}
+
+func init() {
+	applyCmd.Flags().StringVar(&applyPolicyARNFlag, "policy-arn", "", "ARN of the customer managed policy to update")
+	applyCmd.Flags().BoolVar(&applyDryRunFlag, "dry-run", false, "Print the difference with the current default version without changing anything")
+	addAWSFlags(applyCmd.Flags())
+	_ = applyCmd.MarkFlagRequired("policy-arn")
+	rootCmd.AddCommand(applyCmd)
+}
+
+// policyDocumentAPI is the part of the IAM client reading a managed
+// policy's default version.
+type policyDocumentAPI interface {
+	GetPolicy(ctx context.Context, params *iam.GetPolicyInput, optFns ...func(*iam.Options)) (*iam.GetPolicyOutput, error)
+	GetPolicyVersion(ctx context.Context, params *iam.GetPolicyVersionInput, optFns ...func(*iam.Options)) (*iam.GetPolicyVersionOutput, error)
+}
+
+// policyVersionsAPI is the part of the IAM client used by apply.
+type policyVersionsAPI interface {
+	policyDocumentAPI
+	ListPolicyVersions(ctx context.Context, params *iam.ListPolicyVersionsInput, optFns ...func(*iam.Options)) (*iam.ListPolicyVersionsOutput, error)
+	CreatePolicyVersion(ctx context.Context, params *iam.CreatePolicyVersionInput, optFns ...func(*iam.Options)) (*iam.CreatePolicyVersionOutput, error)
+	DeletePolicyVersion(ctx context.Context, params *iam.DeletePolicyVersionInput, optFns ...func(*iam.Options)) (*iam.DeletePolicyVersionOutput, error)
+}
+
+func runApply(cmd *cobra.Command, args []string) {
+	var data []byte
+	var err error
+	if args[0] == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(args[0])
+	}
+	if err != nil {
+		exitWithError(&ParseError{Source: args[0], Err: err})
+	}
+
+	if err := loadActionCatalog(); err != nil {
+		exitWithError(&DBError{Source: "the action catalog", Err: err})
+	}
+	policy, findings, err := lintPolicy(data)
+	if err != nil {
+		exitWithError(&ParseError{Source: args[0], Err: err})
+	}
+	for _, finding := range findings {
+		if finding.Severity == SeverityError {
+			exitWithError(validationErrorf("%s: %s: %s (run lint for details)", args[0], findingLocation(finding), finding.Message))
+		}
+	}
+	if err := checkManagedPolicySize(policy); err != nil {
+		exitWithError(fmt.Errorf("%s: %w", args[0], err))
+	}
+
+	ctx := cmd.Context()
+	cfg, err := loadAWSConfig(ctx)
+	if err != nil {
+		exitWithError(err)
+	}
+
+	result, err := applyPolicyVersion(ctx, iam.NewFromConfig(cfg), applyPolicyARNFlag, policy, applyDryRunFlag)
+	if err != nil {
+		exitWithError(err)
+	}
+	printApplyResult(result)
+}
+
+// checkManagedPolicySize returns a ValidationError when policy is over the
+// size limit of a managed policy, which CreatePolicyVersion would reject
+// only after apply made room for the new version.
+func checkManagedPolicySize(policy IAMPolicy) error {
+	if size := policySize(policy); size > managedPolicySizeLimit {
+		return validationErrorf("policy is %d characters, exceeding the %d character managed policy limit", size, managedPolicySizeLimit)
+	}
+	return nil
+}
+
+// ApplyResult describes what apply found and did.
+type ApplyResult struct {
+	PolicyARN      string
+	CurrentVersion string
+	Added          []string
+	Removed        []string
+	PrunedVersion  string // deleted to stay within the version limit
+	CreatedVersion string // empty when nothing was created
+	DryRun         bool
+}
+
+// applyPolicyVersion compares policy with the default version of the managed
+// policy at policyARN and, unless dryRun is set or they grant the same
+// access, creates a new default version from it, deleting the oldest
+// non-default version first when the version limit is reached.
+func applyPolicyVersion(ctx context.Context, client policyVersionsAPI, policyARN string, policy IAMPolicy, dryRun bool) (ApplyResult, error) {
+	result := ApplyResult{PolicyARN: policyARN, DryRun: dryRun}
+
+	currentPolicy, currentVersion, err := readDefaultPolicyVersion(ctx, client, policyARN)
+	result.CurrentVersion = currentVersion
+	if err != nil {
+		return result, err
+	}
+
+	result.Added, result.Removed = diffPolicyGrants(currentPolicy, policy)
+	if dryRun || (len(result.Added) == 0 && len(result.Removed) == 0) {
+		return result, nil
+	}
+
+	versions, err := client.ListPolicyVersions(ctx, &iam.ListPolicyVersionsInput{PolicyArn: aws.String(policyARN)})
+	if err != nil {
+		return result, fmt.Errorf("error listing versions of %s: %w", policyARN, err)
+	}
+	if len(versions.Versions) >= maxPolicyVersions {
+		oldest := oldestNonDefaultVersion(versions.Versions)
+		if oldest == "" {
+			return result, fmt.Errorf("policy %s has %d versions and none can be deleted", policyARN, len(versions.Versions))
+		}
+		if _, err := client.DeletePolicyVersion(ctx, &iam.DeletePolicyVersionInput{
+			PolicyArn: aws.String(policyARN),
+			VersionId: aws.String(oldest),
+		}); err != nil {
+			return result, fmt.Errorf("error deleting version %s of %s: %w", oldest, policyARN, err)
+		}
+		result.PrunedVersion = oldest
+	}
+
+	document, err := json.Marshal(policy)
+	if err != nil {
+		return result, fmt.Errorf("error marshaling policy: %w", err)
+	}
+	created, err := client.CreatePolicyVersion(ctx, &iam.CreatePolicyVersionInput{
+		PolicyArn:      aws.String(policyARN),
+		PolicyDocument: aws.String(string(document)),
+		SetAsDefault:   true,
+	})
+	if err != nil && result.PrunedVersion != "" {
+		return result, fmt.Errorf("error creating a version of %s after deleting version %s: %w", policyARN, result.PrunedVersion, err)
+	}
+	if err != nil {
+		return result, fmt.Errorf("error creating a version of %s: %w", policyARN, err)
+	}
+	result.CreatedVersion = aws.ToString(created.PolicyVersion.VersionId)
+	return result, nil
+}
+
+// readDefaultPolicyVersion returns the document and ID of the default
+// version of the managed policy at policyARN.
+func readDefaultPolicyVersion(ctx context.Context, client policyDocumentAPI, policyARN string) (IAMPolicy, string, error) {
+	current, err := client.GetPolicy(ctx, &iam.GetPolicyInput{PolicyArn: aws.String(policyARN)})
+	if err != nil {
+		return IAMPolicy{}, "", fmt.Errorf("error reading policy %s: %w", policyARN, err)
+	}
+	versionID := aws.ToString(current.Policy.DefaultVersionId)
+
+	version, err := client.GetPolicyVersion(ctx, &iam.GetPolicyVersionInput{
+		PolicyArn: aws.String(policyARN),
+		VersionId: current.Policy.DefaultVersionId,
+	})
+	if err != nil {
+		return IAMPolicy{}, versionID, fmt.Errorf("error reading version %s of %s: %w", versionID, policyARN, err)
+	}
+	policy, err := decodePolicyVersionDocument(aws.ToString(version.PolicyVersion.Document))
+	if err != nil {
+		return IAMPolicy{}, versionID, fmt.Errorf("error parsing version %s of %s: %w", versionID, policyARN, err)
+	}
+	return policy, versionID, nil
+}
+
+// decodePolicyVersionDocument parses a policy version document, which IAM
+// returns URL-encoded (RFC 3986).
+func decodePolicyVersionDocument(document string) (IAMPolicy, error) {
+	if decoded, err := url.PathUnescape(document); err == nil {
+		document = decoded
+	}
+	policy, _, err := lintPolicy([]byte(document))
+	return policy, err
+}
+
+// oldestNonDefaultVersion returns the ID of the oldest version that is not
+// the default, or "" when there is none.
+func oldestNonDefaultVersion(versions []iamtypes.PolicyVersion) string {
+	var candidates []iamtypes.PolicyVersion
+	for _, version := range versions {
+		if !version.IsDefaultVersion {
+			candidates = append(candidates, version)
+		}
+	}
+	if len(candidates) == 0 {
+		return ""
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return aws.ToTime(candidates[i].CreateDate).Before(aws.ToTime(candidates[j].CreateDate))
+	})
+	return aws.ToString(candidates[0].VersionId)
+}
+
+// diffPolicyGrants compares two policies grant by grant, so statement order,
+// grouping and letter case of actions do not count as changes. It returns
+// the grants only in after and the grants only in before, sorted.
+func diffPolicyGrants(before, after IAMPolicy) (added, removed []string) {
+	beforeGrants := policyGrants(before)
+	afterGrants := policyGrants(after)
+	for grant := range afterGrants {
+		if !beforeGrants[grant] {
+			added = append(added, grant)
+		}
+	}
+	for grant := range beforeGrants {
+		if !afterGrants[grant] {
+			removed = append(removed, grant)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	return added, removed
+}
+
+// policyGrants flattens a policy into one line per effect, action and
+// resource, e.g. "Allow s3:GetObject on arn:aws:s3:::logs/*". NotAction,
+// NotResource and Condition elements are appended as JSON.
+func policyGrants(policy IAMPolicy) map[string]bool {
+	grants := make(map[string]bool)
+	for _, statement := range policy.Statement {
+		var suffix string
+		if statement.Condition != nil {
+			condition, _ := json.Marshal(statement.Condition)
+			suffix = " when " + string(condition)
+		}
+
+		actions := toStringSlice(statement.Action)
+		if statement.NotAction != nil {
+			notActions, _ := json.Marshal(canonicalList(statement.NotAction, true))
+			actions = []string{"NotAction " + string(notActions)}
+		}
+		resources := toStringSlice(statement.Resource)
+		if statement.NotResource != nil {
+			notResources, _ := json.Marshal(canonicalList(statement.NotResource, false))
+			resources = []string{"NotResource " + string(notResources)}
+		}
+
+		for _, action := range actions {
+			if canonical, _, ok := lookupAction(action); ok {
+				action = canonical
+			}
+			for _, resource := range resources {
+				grants[fmt.Sprintf("%s %s on %s%s", statement.Effect, action, resource, suffix)] = true
+			}
+		}
+	}
+	return grants
+}
+
+func printApplyResult(result ApplyResult) {
+	for _, grant := range result.Added {
+		fmt.Printf("+ %s\n", grant)
+	}
+	for _, grant := range result.Removed {
+		fmt.Printf("- %s\n", grant)
+	}
+
+	switch {
+	case len(result.Added) == 0 && len(result.Removed) == 0:
+		fmt.Fprintf(os.Stderr, "%s is up to date (version %s)\n", result.PolicyARN, result.CurrentVersion)
+	case result.DryRun:
+		fmt.Fprintf(os.Stderr, "Dry run: %d grant(s) added, %d removed against version %s; nothing changed\n",
+			len(result.Added), len(result.Removed), result.CurrentVersion)
+	default:
+		if result.PrunedVersion != "" {
+			fmt.Fprintf(os.Stderr, "Deleted version %s to stay within the %d version limit\n", result.PrunedVersion, maxPolicyVersions)
+		}
+		fmt.Fprintf(os.Stderr, "Created version %s of %s as the default (was %s)\n",
+			result.CreatedVersion, result.PolicyARN, result.CurrentVersion)
+	}
+}
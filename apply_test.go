@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamtypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+)
+
+// fakePolicyVersions keeps the versions of a single managed policy.
+type fakePolicyVersions struct {
+	versions  []iamtypes.PolicyVersion
+	deleted   []string
+	created   []string
+	next      int
+	createErr error // returned by CreatePolicyVersion when set
+}
+
+func newFakePolicyVersions(documents ...string) *fakePolicyVersions {
+	f := &fakePolicyVersions{}
+	for i, document := range documents {
+		f.versions = append(f.versions, iamtypes.PolicyVersion{
+			VersionId:        aws.String("v" + string(rune('1'+i))),
+			Document:         aws.String(url.PathEscape(document)),
+			IsDefaultVersion: i == len(documents)-1,
+			CreateDate:       aws.Time(time.Date(2026, 1, 1+i, 0, 0, 0, 0, time.UTC)),
+		})
+	}
+	f.next = len(documents) + 1
+	return f
+}
+
+func (f *fakePolicyVersions) GetPolicy(ctx context.Context, params *iam.GetPolicyInput, optFns ...func(*iam.Options)) (*iam.GetPolicyOutput, error) {
+	for _, version := range f.versions {
+		if version.IsDefaultVersion {
+			return &iam.GetPolicyOutput{Policy: &iamtypes.Policy{Arn: params.PolicyArn, DefaultVersionId: version.VersionId}}, nil
+		}
+	}
+	return nil, errors.New("no default version")
+}
+
+func (f *fakePolicyVersions) GetPolicyVersion(ctx context.Context, params *iam.GetPolicyVersionInput, optFns ...func(*iam.Options)) (*iam.GetPolicyVersionOutput, error) {
+	for _, version := range f.versions {
+		if aws.ToString(version.VersionId) == aws.ToString(params.VersionId) {
+			v := version
+			return &iam.GetPolicyVersionOutput{PolicyVersion: &v}, nil
+		}
+	}
+	return nil, errors.New("NoSuchEntity")
+}
+
+func (f *fakePolicyVersions) ListPolicyVersions(ctx context.Context, params *iam.ListPolicyVersionsInput, optFns ...func(*iam.Options)) (*iam.ListPolicyVersionsOutput, error) {
+	return &iam.ListPolicyVersionsOutput{Versions: f.versions}, nil
+}
+
+func (f *fakePolicyVersions) CreatePolicyVersion(ctx context.Context, params *iam.CreatePolicyVersionInput, optFns ...func(*iam.Options)) (*iam.CreatePolicyVersionOutput, error) {
+	if f.createErr != nil {
+		return nil, f.createErr
+	}
+	if len(f.versions) >= maxPolicyVersions {
+		return nil, errors.New("LimitExceeded")
+	}
+	id := "v" + string(rune('0'+f.next))
+	f.next++
+	for i := range f.versions {
+		f.versions[i].IsDefaultVersion = false
+	}
+	version := iamtypes.PolicyVersion{VersionId: aws.String(id), Document: params.PolicyDocument, IsDefaultVersion: params.SetAsDefault}
+	f.versions = append(f.versions, version)
+	f.created = append(f.created, aws.ToString(params.PolicyDocument))
+	return &iam.CreatePolicyVersionOutput{PolicyVersion: &version}, nil
+}
+
+func (f *fakePolicyVersions) DeletePolicyVersion(ctx context.Context, params *iam.DeletePolicyVersionInput, optFns ...func(*iam.Options)) (*iam.DeletePolicyVersionOutput, error) {
+	for i, version := range f.versions {
+		if aws.ToString(version.VersionId) == aws.ToString(params.VersionId) {
+			f.versions = append(f.versions[:i], f.versions[i+1:]...)
+			f.deleted = append(f.deleted, aws.ToString(params.VersionId))
+			return &iam.DeletePolicyVersionOutput{}, nil
+		}
+	}
+	return nil, errors.New("NoSuchEntity")
+}
+
+const applyTestARN = "arn:aws:iam::123456789012:policy/terraform-ci"
+
+func TestApplyPolicyVersion(t *testing.T) {
+	if err := loadActionCatalog(); err != nil {
+		t.Fatalf("Error loading action catalog: %v", err)
+	}
+
+	current := `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":["s3:GetObject","sqs:SendMessage"],"Resource":"*"}]}`
+	generated := IAMPolicy{
+		Version: "2012-10-17",
+		Statement: []IAMStatement{
+			{Effect: "Allow", Action: []string{"sqs:sendmessage"}, Resource: "*"},
+			{Effect: "Allow", Action: []string{"s3:PutObject"}, Resource: "*"},
+		},
+	}
+
+	fake := newFakePolicyVersions(current)
+	result, err := applyPolicyVersion(context.Background(), fake, applyTestARN, generated, true)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if strings.Join(result.Added, ";") != "Allow s3:PutObject on *" || strings.Join(result.Removed, ";") != "Allow s3:GetObject on *" {
+		t.Errorf("Unexpected diff: +%v -%v", result.Added, result.Removed)
+	}
+	if len(fake.created) != 0 || result.CreatedVersion != "" {
+		t.Errorf("A dry run must not create a version")
+	}
+
+	result, err = applyPolicyVersion(context.Background(), fake, applyTestARN, generated, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.CreatedVersion != "v2" || result.PrunedVersion != "" || len(fake.created) != 1 {
+		t.Errorf("Expected version v2 to be created, got %+v", result)
+	}
+
+	// The new default grants the same access: nothing to do
+	result, err = applyPolicyVersion(context.Background(), fake, applyTestARN, generated, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.CreatedVersion != "" || len(fake.created) != 1 {
+		t.Errorf("Expected no new version for an unchanged policy, got %+v", result)
+	}
+}
+
+func TestApplyPolicyVersionPrunesOldest(t *testing.T) {
+	if err := loadActionCatalog(); err != nil {
+		t.Fatalf("Error loading action catalog: %v", err)
+	}
+
+	document := `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:GetObject","Resource":"*"}]}`
+	fake := newFakePolicyVersions(document, document, document, document, document)
+	// The oldest version is the default; the oldest non-default one goes.
+	fake.versions[4].IsDefaultVersion = false
+	fake.versions[0].IsDefaultVersion = true
+
+	generated := IAMPolicy{Version: "2012-10-17", Statement: []IAMStatement{{Effect: "Allow", Action: "s3:PutObject", Resource: "*"}}}
+	result, err := applyPolicyVersion(context.Background(), fake, applyTestARN, generated, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.PrunedVersion != "v2" || len(fake.deleted) != 1 {
+		t.Errorf("Expected v2 to be deleted, got %+v (deleted %v)", result, fake.deleted)
+	}
+	if result.CreatedVersion == "" || len(fake.versions) != maxPolicyVersions {
+		t.Errorf("Expected a new version within the limit, got %+v", result)
+	}
+}
+
+func TestApplyPolicyVersionCreateFailsAtLimit(t *testing.T) {
+	if err := loadActionCatalog(); err != nil {
+		t.Fatalf("Error loading action catalog: %v", err)
+	}
+
+	document := `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:GetObject","Resource":"*"}]}`
+	fake := newFakePolicyVersions(document, document, document, document, document)
+	fake.createErr = errors.New("MalformedPolicyDocument")
+
+	generated := IAMPolicy{Version: "2012-10-17", Statement: []IAMStatement{{Effect: "Allow", Action: "s3:PutObject", Resource: "*"}}}
+	result, err := applyPolicyVersion(context.Background(), fake, applyTestARN, generated, false)
+	if err == nil || !strings.Contains(err.Error(), "after deleting version v1") {
+		t.Errorf("Expected the error to name the deleted version, got %v", err)
+	}
+	if result.PrunedVersion != "v1" || result.CreatedVersion != "" {
+		t.Errorf("Expected v1 deleted and nothing created, got %+v", result)
+	}
+}
+
+func TestCheckManagedPolicySize(t *testing.T) {
+	small := IAMPolicy{Version: "2012-10-17", Statement: []IAMStatement{{Effect: "Allow", Action: "s3:GetObject", Resource: "*"}}}
+	if err := checkManagedPolicySize(small); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	actions := make([]string, 0, 300)
+	for i := 0; i < 300; i++ {
+		actions = append(actions, fmt.Sprintf("ec2:DescribeSomethingVeryLong%03d", i))
+	}
+	large := IAMPolicy{Version: "2012-10-17", Statement: []IAMStatement{{Effect: "Allow", Action: actions, Resource: "*"}}}
+	if err := checkManagedPolicySize(large); exitCode(err) != exitValidationFailed {
+		t.Errorf("Expected a validation error for a %d character policy, got %v", policySize(large), err)
+	}
+}
+
+func TestPolicyGrants(t *testing.T) {
+	if err := loadActionCatalog(); err != nil {
+		t.Fatalf("Error loading action catalog: %v", err)
+	}
+
+	policy := IAMPolicy{Statement: []IAMStatement{
+		{Effect: "Allow", Action: []string{"S3:getobject"}, Resource: []string{"arn:aws:s3:::a/*", "arn:aws:s3:::b/*"}},
+		{Effect: "Deny", NotAction: "iam:*", Resource: "*", Condition: map[string]map[string]interface{}{"Bool": {"aws:MultiFactorAuthPresent": "false"}}},
+	}}
+	grants := policyGrants(policy)
+
+	for _, want := range []string{
+		"Allow s3:GetObject on arn:aws:s3:::a/*",
+		"Allow s3:GetObject on arn:aws:s3:::b/*",
+		`Deny NotAction ["iam:*"] on * when {"Bool":{"aws:MultiFactorAuthPresent":"false"}}`,
+	} {
+		if !grants[want] {
+			t.Errorf("Expected grant %q, got %v", want, grants)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// maxUnpackedSize bounds the bytes an archive may unpack to, against archives
+// that expand without limit.
+const maxUnpackedSize = 256 << 20
+
+// extractTar extracts the directories and regular files of a tar stream;
+// links and devices are skipped.
+func extractTar(r io.Reader, dir string, budget *int64) error {
+	archive := tar.NewReader(r)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			target, err := unpackPath(dir, header.Name)
+			if err != nil {
+				return err
+			}
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := writeUnpackedFile(dir, header.Name, archive, budget); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// extractZip extracts the directories and files of a zip archive.
+func extractZip(r io.ReaderAt, size int64, dir string, budget *int64) error {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return err
+	}
+	for _, entry := range archive.File {
+		if entry.FileInfo().IsDir() {
+			target, err := unpackPath(dir, entry.Name)
+			if err != nil {
+				return err
+			}
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+		if !entry.Mode().IsRegular() {
+			continue
+		}
+		content, err := entry.Open()
+		if err != nil {
+			return err
+		}
+		err = writeUnpackedFile(dir, entry.Name, content, budget)
+		content.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeUnpackedFile writes the file name of an archive below dir.
+func writeUnpackedFile(dir, name string, content io.Reader, budget *int64) error {
+	target, err := unpackPath(dir, name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(file, io.LimitReader(content, *budget+1))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if *budget -= n; *budget < 0 {
+		return fmt.Errorf("archive unpacks to more than %d bytes", maxUnpackedSize)
+	}
+	return nil
+}
+
+// unpackPath resolves an archive entry name below dir, refusing names that
+// would escape it.
+func unpackPath(dir, name string) (string, error) {
+	clean := path.Clean(strings.ReplaceAll(name, `\`, "/"))
+	if path.IsAbs(clean) || clean == "." || clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", fmt.Errorf("archive entry %q escapes the extraction directory", name)
+	}
+	return filepath.Join(dir, filepath.FromSlash(clean)), nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExtractTarRejectsEscapingEntries(t *testing.T) {
+	for _, name := range []string{"../evil.tf", "/etc/evil.tf", "modules/../../evil.tf"} {
+		var buf bytes.Buffer
+		archive := tar.NewWriter(&buf)
+		archive.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: 1, Typeflag: tar.TypeReg})
+		archive.Write([]byte("x"))
+		archive.Close()
+
+		budget := int64(maxUnpackedSize)
+		if err := extractTar(&buf, t.TempDir(), &budget); err == nil {
+			t.Errorf("extractTar(%s): expected an error", name)
+		}
+	}
+}
+
+func TestExtractZip(t *testing.T) {
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	archive.Create("modules/")
+	w, _ := archive.Create(`modules\vpc\main.tf`)
+	w.Write([]byte(`resource "aws_vpc" "this" {}`))
+	archive.Close()
+
+	dir := t.TempDir()
+	budget := int64(maxUnpackedSize)
+	if err := extractZip(bytes.NewReader(buf.Bytes()), int64(buf.Len()), dir, &budget); err != nil {
+		t.Fatalf("extractZip: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "modules", "vpc", "main.tf")); err != nil {
+		t.Errorf("Expected modules/vpc/main.tf to be extracted: %v", err)
+	}
+
+	budget = 10
+	err := extractZip(bytes.NewReader(buf.Bytes()), int64(buf.Len()), t.TempDir(), &budget)
+	if err == nil || !strings.Contains(err.Error(), "unpacks to more than") {
+		t.Errorf("Expected the size limit to stop the extraction, got %v", err)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+var attachToRoleFlag string
+
+// inlineRolePolicySizeLimit is the size all inline policies of a role may
+// add up to, counted like policySize.
+const inlineRolePolicySizeLimit = 10240
+
+// terraformPolicyName names the policy resources of the Terraform output.
+const terraformPolicyName = "tf-iam-scanner-generated"
+
+// validateAttachToRole checks the --attach-to-role role name, which may also
+// be given as a role ARN, and that the policy is rendered as Terraform and
+// is one a role can have attached.
+func validateAttachToRole(role string, format OutputFormat) error {
+	if role == "" {
+		return nil
+	}
+	if format != FormatTerraform {
+		return fmt.Errorf("--attach-to-role needs --format terraform, not %s", format)
+	}
+	if policyTypeFlag == PolicyTypeSession {
+		return fmt.Errorf("--attach-to-role cannot be used with --policy-type %s: session policies are passed to AssumeRole, not attached", PolicyTypeSession)
+	}
+	if !roleNamePattern.MatchString(roleName(role)) {
+		return fmt.Errorf("invalid --attach-to-role %q: expected an IAM role name or ARN", role)
+	}
+	return nil
+}
+
+// roleName returns the name of role, given as a name or as a role ARN (the
+// last segment of its path).
+func roleName(role string) string {
+	if strings.HasPrefix(role, "arn:") {
+		if _, path, ok := strings.Cut(role, ":role/"); ok {
+			return path[strings.LastIndex(path, "/")+1:]
+		}
+	}
+	return role
+}
+
+// generateRoleAttachmentOutput generates Terraform HCL attaching policy to
+// an existing role: a managed policy and its aws_iam_role_policy_attachment
+// when the policy fits the managed policy size limit, otherwise an inline
+// aws_iam_role_policy, whose larger limit the role's other inline policies
+// share. A policy over both limits is an error.
+func generateRoleAttachmentOutput(policy IAMPolicy, comments [][]string, role string) (string, error) {
+	name := roleName(role)
+	size := policySize(policy)
+	if size > inlineRolePolicySizeLimit {
+		return "", fmt.Errorf("policy is %d characters, over the %d character managed and %d character inline policy limits; try --compress-actions",
+			size, managedPolicySizeLimit, inlineRolePolicySizeLimit)
+	}
+
+	var sb strings.Builder
+	sb.WriteString(terraformPolicyDocument(policy, comments))
+	if size <= managedPolicySizeLimit {
+		sb.WriteString("\nresource \"aws_iam_policy\" \"generated\" {\n")
+		fmt.Fprintf(&sb, "  name   = \"%s\"\n", terraformPolicyName)
+		sb.WriteString("  policy = data.aws_iam_policy_document.generated.json\n")
+		sb.WriteString("}\n")
+		sb.WriteString("\nresource \"aws_iam_role_policy_attachment\" \"generated\" {\n")
+		fmt.Fprintf(&sb, "  role       = \"%s\"\n", name)
+		sb.WriteString("  policy_arn = aws_iam_policy.generated.arn\n")
+		sb.WriteString("}\n")
+		return sb.String(), nil
+	}
+
+	fmt.Fprintf(&sb, "\n# %d characters: over the %d character managed policy limit, so inline.\n", size, managedPolicySizeLimit)
+	fmt.Fprintf(&sb, "# The inline policies of %s share a %d character limit.\n", name, inlineRolePolicySizeLimit)
+	sb.WriteString("resource \"aws_iam_role_policy\" \"generated\" {\n")
+	fmt.Fprintf(&sb, "  name   = \"%s\"\n", terraformPolicyName)
+	fmt.Fprintf(&sb, "  role   = \"%s\"\n", name)
+	sb.WriteString("  policy = data.aws_iam_policy_document.generated.json\n")
+	sb.WriteString("}\n")
+	return sb.String(), nil
+}
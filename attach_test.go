@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// policyOfSize returns a policy whose size is at least size characters.
+func policyOfSize(size int) IAMPolicy {
+	var actions []string
+	for i := 0; policySize(IAMPolicy{Version: defaultPolicyVersion, Statement: []IAMStatement{{Effect: "Allow", Action: actions, Resource: "*"}}}) < size; i++ {
+		actions = append(actions, fmt.Sprintf("ec2:DescribeThing%04d", i))
+	}
+	return IAMPolicy{Version: defaultPolicyVersion, Statement: []IAMStatement{{Effect: "Allow", Action: actions, Resource: "*"}}}
+}
+
+func TestGenerateRoleAttachmentOutput(t *testing.T) {
+	hcl, err := generateRoleAttachmentOutput(policyOfSize(100), nil, "deployer")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.Contains(hcl, `resource "aws_iam_role_policy_attachment" "generated"`) || !strings.Contains(hcl, `role       = "deployer"`) {
+		t.Errorf("Expected a managed policy attachment, got:\n%s", hcl)
+	}
+	if strings.Contains(hcl, "aws_iam_role_policy\" ") {
+		t.Errorf("A policy fitting the managed limit should not be inline:\n%s", hcl)
+	}
+
+	hcl, err = generateRoleAttachmentOutput(policyOfSize(managedPolicySizeLimit+1), nil, "arn:aws:iam::123456789012:role/ci/deployer")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.Contains(hcl, `resource "aws_iam_role_policy" "generated"`) || !strings.Contains(hcl, `role   = "deployer"`) {
+		t.Errorf("Expected an inline role policy, got:\n%s", hcl)
+	}
+	if strings.Contains(hcl, "aws_iam_policy\" ") {
+		t.Errorf("An inline policy needs no managed policy:\n%s", hcl)
+	}
+
+	if _, err := generateRoleAttachmentOutput(policyOfSize(inlineRolePolicySizeLimit+1), nil, "deployer"); err == nil {
+		t.Errorf("Expected an error for a policy over both limits")
+	}
+}
+
+func TestValidateAttachToRole(t *testing.T) {
+	defer func() { policyTypeFlag = PolicyTypeManaged }()
+	if err := validateAttachToRole("deployer", FormatTerraform); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if err := validateAttachToRole("deployer", FormatJSON); err == nil {
+		t.Errorf("Expected an error for a format other than terraform")
+	}
+	if err := validateAttachToRole("deploy role", FormatTerraform); err == nil {
+		t.Errorf("Expected an error for an invalid role name")
+	}
+	policyTypeFlag = PolicyTypeSession
+	if err := validateAttachToRole("deployer", FormatTerraform); err == nil {
+		t.Errorf("Expected an error for a session policy")
+	}
+}
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// Identifiers written into provenance documents.
+const (
+	inTotoStatementType   = "https://in-toto.io/Statement/v1"
+	slsaProvenanceType    = "https://slsa.dev/provenance/v1"
+	provenanceBuildType   = "https://github.com/johnsidford/tf-iam-scanner/generate/v1"
+	provenanceBuilderID   = "https://github.com/johnsidford/tf-iam-scanner"
+	signSchemeKMS         = "kms"
+	signSchemeCosign      = "cosign"
+	signatureFileSuffix   = ".sig"
+	certificateFileSuffix = ".pem"
+)
+
+var (
+	attestFlag string
+	signFlag   string
+
+	// runStartedAt and runOptions describe the invocation in provenance
+	// documents; validateOutputFlags sets them.
+	runStartedAt time.Time
+	runOptions   map[string]string
+)
+
+// provenanceStatement is an in-toto statement carrying a SLSA provenance
+// predicate for a generated policy.
+type provenanceStatement struct {
+	Type          string              `json:"_type"`
+	Subject       []provenanceSubject `json:"subject"`
+	PredicateType string              `json:"predicateType"`
+	Predicate     slsaProvenance      `json:"predicate"`
+}
+
+type provenanceSubject struct {
+	Name   string            `json:"name"`
+	Digest map[string]string `json:"digest"`
+}
+
+type slsaProvenance struct {
+	BuildDefinition slsaBuildDefinition `json:"buildDefinition"`
+	RunDetails      slsaRunDetails      `json:"runDetails"`
+}
+
+type slsaBuildDefinition struct {
+	BuildType            string                 `json:"buildType"`
+	ExternalParameters   provenanceParameters   `json:"externalParameters"`
+	InternalParameters   provenanceDBParameters `json:"internalParameters"`
+	ResolvedDependencies []provenanceDependency `json:"resolvedDependencies,omitempty"`
+}
+
+// provenanceParameters are the inputs chosen by whoever ran the scanner:
+// what was scanned and the flags set on the command line or in the
+// configuration file.
+type provenanceParameters struct {
+	Source      string            `json:"source"`
+	Options     map[string]string `json:"options,omitempty"`
+	InputDigest string            `json:"inputDigest,omitempty"` // with --stamp
+}
+
+// provenanceDBParameters identify the permissions database the policy was
+// generated from.
+type provenanceDBParameters struct {
+	PermissionsDBVersion string   `json:"permissionsDBVersion"`
+	PermissionsDBDate    string   `json:"permissionsDBDate,omitempty"`
+	DropInMappings       []string `json:"dropInMappings,omitempty"`
+}
+
+// provenanceDependency is a git checkout the scanned input came from.
+type provenanceDependency struct {
+	URI    string            `json:"uri"`
+	Digest map[string]string `json:"digest"`
+}
+
+type slsaRunDetails struct {
+	Builder  slsaBuilder  `json:"builder"`
+	Metadata slsaMetadata `json:"metadata"`
+}
+
+type slsaBuilder struct {
+	ID      string            `json:"id"`
+	Version map[string]string `json:"version"`
+}
+
+type slsaMetadata struct {
+	StartedOn  time.Time `json:"startedOn"`
+	FinishedOn time.Time `json:"finishedOn"`
+}
+
+// addAttestationFlags registers --attest and --sign on a policy-generating
+// command.
+func addAttestationFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&attestFlag, "attest", "", "Write an in-toto/SLSA provenance statement for the --output file (input, git commit, DB version, tool version, options) to this file")
+	flags.StringVar(&signFlag, "sign", "", "Sign the --output file (and --attest statement) into <file>.sig: kms:<key-id>, cosign, or cosign:<key-ref>")
+}
+
+// validateAttestationFlags checks --attest and --sign.
+func validateAttestationFlags() error {
+	if (attestFlag != "" || signFlag != "") && outputFlag == "" {
+		return fmt.Errorf("--attest and --sign need --output")
+	}
+	if signFlag == "" {
+		return nil
+	}
+	scheme, ref, _ := strings.Cut(signFlag, ":")
+	switch {
+	case scheme == signSchemeKMS && ref != "":
+		return nil
+	case scheme == signSchemeCosign:
+		return nil
+	}
+	return fmt.Errorf("invalid --sign %q: expected kms:<key-id>, cosign, or cosign:<key-ref>", signFlag)
+}
+
+// changedFlagValues returns the flags whose effective value differs from
+// the default, by name: those set on the command line and those applied from
+// the configuration file, which assigns the flag variables directly.
+func changedFlagValues(cmd *cobra.Command) map[string]string {
+	options := make(map[string]string)
+	cmd.Flags().VisitAll(func(flag *pflag.Flag) {
+		if value := flag.Value.String(); value != flag.DefValue {
+			options[flag.Name] = value
+		}
+	})
+	return options
+}
+
+// sha256File returns the hex SHA-256 digest of a file.
+func sha256File(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// gitCheckout returns the origin URL and HEAD commit of the git checkout
+// holding path, or "" for the commit outside a repository.
+func gitCheckout(path string) (remote, revision string) {
+	dir := path
+	if info, err := os.Stat(path); err == nil && !info.IsDir() {
+		dir = filepath.Dir(path)
+	}
+	out, err := exec.Command("git", "-C", dir, "rev-parse", "HEAD").Output()
+	if err != nil {
+		return "", ""
+	}
+	revision = strings.TrimSpace(string(out))
+	if out, err := exec.Command("git", "-C", dir, "config", "--get", "remote.origin.url").Output(); err == nil {
+		remote = strings.TrimSpace(string(out))
+	}
+	return remote, revision
+}
+
+// buildProvenance describes how the policy file at policyPath was generated
+// from source, which names one or more scanned inputs separated by ", ".
+func buildProvenance(policyPath, source string, started, finished time.Time, options map[string]string) (provenanceStatement, error) {
+	digest, err := sha256File(policyPath)
+	if err != nil {
+		return provenanceStatement{}, fmt.Errorf("error hashing %s: %w", policyPath, err)
+	}
+
+	definition := slsaBuildDefinition{
+		BuildType:          provenanceBuildType,
+		ExternalParameters: provenanceParameters{Source: source, Options: options, InputDigest: runInputDigest},
+		InternalParameters: provenanceDBParameters{
+			PermissionsDBVersion: valueOrUnknown(permissionsDBMeta.Version),
+			PermissionsDBDate:    permissionsDBMeta.Date,
+			DropInMappings:       permissionPluginFiles,
+		},
+	}
+	seen := make(map[string]bool)
+	for _, input := range strings.Split(source, ", ") {
+		remote, revision := gitCheckout(input)
+		if revision == "" || seen[revision] {
+			continue
+		}
+		seen[revision] = true
+		uri := "git+" + remote
+		if remote == "" {
+			uri = "git+file://" + input
+		}
+		definition.ResolvedDependencies = append(definition.ResolvedDependencies, provenanceDependency{
+			URI:    uri,
+			Digest: map[string]string{"gitCommit": revision},
+		})
+	}
+
+	info := currentBuildInfo()
+	builderVersion := map[string]string{"tf-iam-scanner": info.Version, "go": info.GoVersion}
+	if info.Commit != "" {
+		builderVersion["commit"] = info.Commit
+	}
+
+	return provenanceStatement{
+		Type: inTotoStatementType,
+		Subject: []provenanceSubject{{
+			Name:   filepath.Base(policyPath),
+			Digest: map[string]string{"sha256": digest},
+		}},
+		PredicateType: slsaProvenanceType,
+		Predicate: slsaProvenance{
+			BuildDefinition: definition,
+			RunDetails: slsaRunDetails{
+				Builder:  slsaBuilder{ID: provenanceBuilderID, Version: builderVersion},
+				Metadata: slsaMetadata{StartedOn: started.UTC(), FinishedOn: finished.UTC()},
+			},
+		},
+	}, nil
+}
+
+// writeProvenance writes the provenance statement of the policy file at
+// policyPath to attestPath.
+func writeProvenance(policyPath, attestPath, source string, perm os.FileMode, force bool) error {
+	statement, err := buildProvenance(policyPath, source, runStartedAt, time.Now(), runOptions)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(statement, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling provenance: %w", err)
+	}
+	return writeOutputFile(attestPath, append(data, '\n'), perm, force)
+}
+
+// kmsSignAPI is the part of the KMS client used to sign artifacts.
+type kmsSignAPI interface {
+	GetPublicKey(ctx context.Context, params *kms.GetPublicKeyInput, optFns ...func(*kms.Options)) (*kms.GetPublicKeyOutput, error)
+	Sign(ctx context.Context, params *kms.SignInput, optFns ...func(*kms.Options)) (*kms.SignOutput, error)
+}
+
+// newKMSSigner and runCosign are replaced in tests.
+var (
+	newKMSSigner = func(ctx context.Context) (kmsSignAPI, error) {
+		cfg, err := loadAWSConfig(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return kms.NewFromConfig(cfg), nil
+	}
+	runCosign = func(args ...string) error {
+		cmd := exec.Command("cosign", args...)
+		cmd.Stdout = os.Stderr
+		cmd.Stderr = os.Stderr
+		return cmd.Run()
+	}
+)
+
+// kmsSigningAlgorithm picks the first SHA-256 algorithm the key supports, so
+// the file's SHA-256 digest can be signed without sending the file to KMS.
+func kmsSigningAlgorithm(algorithms []types.SigningAlgorithmSpec) (types.SigningAlgorithmSpec, bool) {
+	for _, algorithm := range algorithms {
+		if strings.HasSuffix(string(algorithm), "_SHA_256") {
+			return algorithm, true
+		}
+	}
+	return "", false
+}
+
+// signWithKMS signs the SHA-256 digest of the file at path with an
+// asymmetric KMS key and writes the base64 signature to path.sig.
+func signWithKMS(ctx context.Context, client kmsSignAPI, keyID, path string, perm os.FileMode, force bool) (types.SigningAlgorithmSpec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	key, err := client.GetPublicKey(ctx, &kms.GetPublicKeyInput{KeyId: aws.String(keyID)})
+	if err != nil {
+		return "", fmt.Errorf("error reading KMS key %s: %w", keyID, err)
+	}
+	algorithm, ok := kmsSigningAlgorithm(key.SigningAlgorithms)
+	if !ok {
+		return "", fmt.Errorf("KMS key %s supports no SHA-256 signing algorithm (it must be an asymmetric SIGN_VERIFY key)", keyID)
+	}
+
+	digest := sha256.Sum256(data)
+	out, err := client.Sign(ctx, &kms.SignInput{
+		KeyId:            aws.String(keyID),
+		Message:          digest[:],
+		MessageType:      types.MessageTypeDigest,
+		SigningAlgorithm: algorithm,
+	})
+	if err != nil {
+		return "", fmt.Errorf("error signing %s with KMS: %w", path, err)
+	}
+	signature := base64.StdEncoding.EncodeToString(out.Signature) + "\n"
+	return algorithm, writeOutputFile(path+signatureFileSuffix, []byte(signature), perm, force)
+}
+
+// cosignArgs returns the cosign sign-blob arguments that sign the file at
+// path into path.sig: with the key ref, or keyless through Sigstore, which
+// also writes the signing certificate to path.pem.
+func cosignArgs(keyRef, path string) []string {
+	args := []string{"sign-blob", "--yes", "--output-signature", path + signatureFileSuffix}
+	if keyRef != "" {
+		args = append(args, "--key", keyRef)
+	} else {
+		args = append(args, "--output-certificate", path+certificateFileSuffix)
+	}
+	return append(args, path)
+}
+
+// signArtifacts signs each file in paths as requested by --sign.
+func signArtifacts(ctx context.Context, paths []string, perm os.FileMode, force bool) error {
+	scheme, ref, _ := strings.Cut(signFlag, ":")
+	var client kmsSignAPI
+	if scheme == signSchemeKMS {
+		c, err := newKMSSigner(ctx)
+		if err != nil {
+			return err
+		}
+		client = c
+	}
+
+	sort.Strings(paths)
+	for _, path := range paths {
+		switch scheme {
+		case signSchemeKMS:
+			algorithm, err := signWithKMS(ctx, client, ref, path, perm, force)
+			if err != nil {
+				return err
+			}
+			statusf("  Signed %s with KMS key %s (%s): %s%s\n", path, ref, algorithm, path, signatureFileSuffix)
+		case signSchemeCosign:
+			if !force {
+				if _, err := os.Stat(path + signatureFileSuffix); err == nil {
+					return fmt.Errorf("%s%s already exists (use --force to overwrite)", path, signatureFileSuffix)
+				}
+			}
+			if err := runCosign(cosignArgs(ref, path)...); err != nil {
+				return fmt.Errorf("error signing %s with cosign: %w", path, err)
+			}
+			statusf("  Signed %s with cosign: %s%s\n", path, path, signatureFileSuffix)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/spf13/cobra"
+)
+
+func TestBuildProvenance(t *testing.T) {
+	if err := loadPermissionsDB(); err != nil {
+		t.Fatalf("Error loading permissions DB: %v", err)
+	}
+	dir := t.TempDir()
+	policyPath := filepath.Join(dir, "policy.json")
+	data := []byte(`{"Version":"2012-10-17","Statement":[]}`)
+	if err := os.WriteFile(policyPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	started := time.Date(2026, 10, 17, 9, 0, 0, 0, time.UTC)
+	options := map[string]string{"least-privilege": "true"}
+	statement, err := buildProvenance(policyPath, dir, started, started.Add(time.Second), options)
+	if err != nil {
+		t.Fatalf("buildProvenance: %v", err)
+	}
+
+	sum := sha256.Sum256(data)
+	if statement.Type != inTotoStatementType || statement.PredicateType != slsaProvenanceType {
+		t.Errorf("Unexpected statement types: %s, %s", statement.Type, statement.PredicateType)
+	}
+	if len(statement.Subject) != 1 || statement.Subject[0].Name != "policy.json" || statement.Subject[0].Digest["sha256"] != hex.EncodeToString(sum[:]) {
+		t.Errorf("Unexpected subject: %+v", statement.Subject)
+	}
+	definition := statement.Predicate.BuildDefinition
+	if definition.ExternalParameters.Source != dir || definition.ExternalParameters.Options["least-privilege"] != "true" {
+		t.Errorf("Unexpected parameters: %+v", definition.ExternalParameters)
+	}
+	if definition.InternalParameters.PermissionsDBVersion != permissionsDBMeta.Version {
+		t.Errorf("Expected DB version %s, got %s", permissionsDBMeta.Version, definition.InternalParameters.PermissionsDBVersion)
+	}
+	if statement.Predicate.RunDetails.Builder.Version["tf-iam-scanner"] != version {
+		t.Errorf("Expected builder version %s, got %v", version, statement.Predicate.RunDetails.Builder.Version)
+	}
+}
+
+func TestValidateAttestationFlags(t *testing.T) {
+	defer func(output, attest, sign string) { outputFlag, attestFlag, signFlag = output, attest, sign }(outputFlag, attestFlag, signFlag)
+
+	tests := []struct {
+		output, attest, sign string
+		wantErr              bool
+	}{
+		{"", "", "", false},
+		{"policy.json", "policy.intoto.json", "", false},
+		{"policy.json", "", "kms:alias/policy-signing", false},
+		{"policy.json", "", "cosign", false},
+		{"policy.json", "", "cosign:cosign.key", false},
+		{"", "policy.intoto.json", "", true},
+		{"policy.json", "", "kms", true},
+		{"policy.json", "", "gpg:ABCDEF", true},
+	}
+	for _, tt := range tests {
+		outputFlag, attestFlag, signFlag = tt.output, tt.attest, tt.sign
+		if err := validateAttestationFlags(); (err != nil) != tt.wantErr {
+			t.Errorf("output=%q attest=%q sign=%q: error = %v, wantErr %v", tt.output, tt.attest, tt.sign, err, tt.wantErr)
+		}
+	}
+}
+
+func TestChangedFlagValues(t *testing.T) {
+	var leastPrivilege bool
+	var format string
+	cmd := &cobra.Command{Use: "test"}
+	cmd.Flags().BoolVar(&leastPrivilege, "least-privilege", false, "")
+	cmd.Flags().StringVar(&format, "format", "json", "")
+	cmd.Flags().StringVar(new(string), "output", "", "")
+	if err := cmd.Flags().Set("least-privilege", "true"); err != nil {
+		t.Fatal(err)
+	}
+	// Applied from a configuration file
+	format = "yaml"
+
+	got := changedFlagValues(cmd)
+	if len(got) != 2 || got["least-privilege"] != "true" || got["format"] != "yaml" {
+		t.Errorf("Unexpected options: %v", got)
+	}
+}
+
+type fakeKMSSigner struct {
+	algorithms []types.SigningAlgorithmSpec
+	signed     *kms.SignInput
+}
+
+func (f *fakeKMSSigner) GetPublicKey(ctx context.Context, params *kms.GetPublicKeyInput, optFns ...func(*kms.Options)) (*kms.GetPublicKeyOutput, error) {
+	return &kms.GetPublicKeyOutput{SigningAlgorithms: f.algorithms}, nil
+}
+
+func (f *fakeKMSSigner) Sign(ctx context.Context, params *kms.SignInput, optFns ...func(*kms.Options)) (*kms.SignOutput, error) {
+	f.signed = params
+	return &kms.SignOutput{Signature: []byte("signature"), SigningAlgorithm: params.SigningAlgorithm}, nil
+}
+
+func TestSignWithKMS(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.json")
+	data := []byte("{}\n")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	client := &fakeKMSSigner{algorithms: []types.SigningAlgorithmSpec{
+		types.SigningAlgorithmSpecEcdsaSha384, types.SigningAlgorithmSpecEcdsaSha256,
+	}}
+	algorithm, err := signWithKMS(context.Background(), client, "alias/policy-signing", path, 0644, false)
+	if err != nil {
+		t.Fatalf("signWithKMS: %v", err)
+	}
+	if algorithm != types.SigningAlgorithmSpecEcdsaSha256 {
+		t.Errorf("Expected ECDSA_SHA_256, got %s", algorithm)
+	}
+	sum := sha256.Sum256(data)
+	if client.signed.MessageType != types.MessageTypeDigest || string(client.signed.Message) != string(sum[:]) {
+		t.Errorf("Expected the file's SHA-256 digest to be signed, got %+v", client.signed)
+	}
+	signature, err := os.ReadFile(path + ".sig")
+	if err != nil {
+		t.Fatalf("Reading signature: %v", err)
+	}
+	if strings.TrimSpace(string(signature)) != base64.StdEncoding.EncodeToString([]byte("signature")) {
+		t.Errorf("Unexpected signature file: %q", signature)
+	}
+
+	if _, err := signWithKMS(context.Background(), client, "alias/policy-signing", path, 0644, false); err == nil {
+		t.Error("Expected an error when the signature file exists without --force")
+	}
+	client.algorithms = []types.SigningAlgorithmSpec{types.SigningAlgorithmSpecEcdsaSha384}
+	if _, err := signWithKMS(context.Background(), client, "alias/policy-signing", path, 0644, true); err == nil {
+		t.Error("Expected an error for a key without a SHA-256 algorithm")
+	}
+}
+
+func TestCosignArgs(t *testing.T) {
+	got := strings.Join(cosignArgs("cosign.key", "policy.json"), " ")
+	if want := "sign-blob --yes --output-signature policy.json.sig --key cosign.key policy.json"; got != want {
+		t.Errorf("cosignArgs with key = %q, want %q", got, want)
+	}
+	got = strings.Join(cosignArgs("", "policy.json"), " ")
+	if want := "sign-blob --yes --output-signature policy.json.sig --output-certificate policy.json.pem policy.json"; got != want {
+		t.Errorf("keyless cosignArgs = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/spf13/pflag"
+)
+
+// awsRoleSessionName names the sessions of roles assumed with
+// --assume-role-arn in CloudTrail.
+const awsRoleSessionName = "tf-iam-scanner"
+
+// Retry policy of every AWS client. Throttled and transient failures are
+// retried with jittered exponential backoff, and the adaptive mode slows the
+// client down on throttling instead of spending every attempt at once.
+const (
+	awsMaxAttempts = 10
+	awsMaxBackoff  = 30 * time.Second
+)
+
+// awsOptions are the credential settings shared by every command that calls
+// AWS.
+type awsOptions struct {
+	Profile       string
+	Region        string
+	AssumeRoleARN string
+	ExternalID    string
+	MaxAPICalls   int    // 0 for no limit
+	SessionPolicy string // JSON policy limiting the assumed role's session
+}
+
+var awsFlags awsOptions
+
+// addAWSFlags registers the credential flags on a command that calls AWS.
+func addAWSFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&awsFlags.Profile, "profile", "", "Named profile from the AWS config and credentials files, including SSO profiles (default: AWS_PROFILE or the default profile)")
+	flags.StringVar(&awsFlags.Region, "region", "", "AWS region to call (default: AWS_REGION or the profile's region)")
+	flags.StringVar(&awsFlags.AssumeRoleARN, "assume-role-arn", "", "Assume this IAM role with the loaded credentials before calling AWS")
+	flags.StringVar(&awsFlags.ExternalID, "external-id", "", "External ID to pass when assuming --assume-role-arn")
+	flags.IntVar(&awsFlags.MaxAPICalls, "max-api-calls", 0, "Stop after this many AWS API requests, retries included (0: no limit)")
+}
+
+// validateAWSFlags checks the combination of credential flags.
+func validateAWSFlags(options awsOptions) error {
+	if options.ExternalID != "" && options.AssumeRoleARN == "" {
+		return fmt.Errorf("--external-id needs --assume-role-arn")
+	}
+	if options.SessionPolicy != "" && options.AssumeRoleARN == "" {
+		return fmt.Errorf("a session policy needs --assume-role-arn")
+	}
+	if options.MaxAPICalls < 0 {
+		return fmt.Errorf("--max-api-calls must not be negative")
+	}
+	return nil
+}
+
+// apiCallBudget counts the requests sent by every client made from one
+// configuration and fails those beyond the limit.
+type apiCallBudget struct {
+	limit int64
+	used  atomic.Int64
+}
+
+// errAPICallBudget is returned for requests beyond --max-api-calls. It is
+// not retryable, so a client gives up on the first one.
+type errAPICallBudget struct {
+	limit int64
+}
+
+func (e errAPICallBudget) Error() string {
+	return fmt.Sprintf("AWS API call budget of %d exhausted (raise --max-api-calls)", e.limit)
+}
+
+// register adds the budget to a client's middleware stack after the retry
+// middleware, so each attempt is counted.
+func (b *apiCallBudget) register(stack *middleware.Stack) error {
+	return stack.Finalize.Add(middleware.FinalizeMiddlewareFunc("APICallBudget",
+		func(ctx context.Context, in middleware.FinalizeInput, next middleware.FinalizeHandler) (middleware.FinalizeOutput, middleware.Metadata, error) {
+			if used := b.used.Add(1); b.limit > 0 && used > b.limit {
+				return middleware.FinalizeOutput{}, middleware.Metadata{}, errAPICallBudget{limit: b.limit}
+			}
+			return next.HandleFinalize(ctx, in)
+		}), middleware.After)
+}
+
+// awsCallBudget is the budget of the last configuration loaded; role
+// assumption calls count against it too.
+var awsCallBudget *apiCallBudget
+
+// newAWSRetryer builds the retryer of every AWS client.
+func newAWSRetryer() aws.Retryer {
+	return retry.NewAdaptiveMode(func(o *retry.AdaptiveModeOptions) {
+		o.StandardOptions = append(o.StandardOptions, func(so *retry.StandardOptions) {
+			so.MaxAttempts = awsMaxAttempts
+			so.MaxBackoff = awsMaxBackoff
+		})
+	})
+}
+
+// loadAWSConfig loads credentials and region the way the AWS CLI does
+// (environment, shared config and credentials files, SSO, instance roles),
+// applying --profile and --region, and assumes --assume-role-arn on top.
+// Every command that calls AWS gets its configuration here, so all clients
+// share the retry policy and the --max-api-calls budget.
+func loadAWSConfig(ctx context.Context) (aws.Config, error) {
+	return loadAWSConfigWith(ctx, awsFlags)
+}
+
+func loadAWSConfigWith(ctx context.Context, options awsOptions) (aws.Config, error) {
+	if err := validateAWSFlags(options); err != nil {
+		return aws.Config{}, &ValidationError{Err: err}
+	}
+
+	var loadOptions []func(*config.LoadOptions) error
+	if options.Profile != "" {
+		loadOptions = append(loadOptions, config.WithSharedConfigProfile(options.Profile))
+	}
+	if options.Region != "" {
+		loadOptions = append(loadOptions, config.WithRegion(options.Region))
+	}
+	loadOptions = append(loadOptions, config.WithRetryer(newAWSRetryer))
+	cfg, err := config.LoadDefaultConfig(ctx, loadOptions...)
+	if err != nil {
+		return aws.Config{}, fmt.Errorf("error loading AWS configuration: %w", err)
+	}
+	awsCallBudget = &apiCallBudget{limit: int64(options.MaxAPICalls)}
+	cfg.APIOptions = append(cfg.APIOptions, awsCallBudget.register)
+
+	if options.AssumeRoleARN != "" {
+		provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(cfg), options.AssumeRoleARN, func(o *stscreds.AssumeRoleOptions) {
+			o.RoleSessionName = awsRoleSessionName
+			if options.ExternalID != "" {
+				o.ExternalID = aws.String(options.ExternalID)
+			}
+			if options.SessionPolicy != "" {
+				o.Policy = aws.String(options.SessionPolicy)
+			}
+		})
+		cfg.Credentials = aws.NewCredentialsCache(provider)
+	}
+	return cfg, nil
+}
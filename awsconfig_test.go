@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/spf13/cobra"
+)
+
+func TestAWSFlagsOnSigningCommands(t *testing.T) {
+	// Every command that can --sign kms:... takes the credential flags
+	for _, cmd := range []*cobra.Command{rootCmd, scanCmd, tfcCmd, batchCmd} {
+		for _, name := range []string{"profile", "region", "assume-role-arn", "external-id", "max-api-calls"} {
+			if cmd.Flags().Lookup(name) == nil {
+				t.Errorf("%s has no --%s flag", cmd.Name(), name)
+			}
+		}
+	}
+}
+
+func TestLoadAWSConfigWith(t *testing.T) {
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "config")
+	content := "[profile ci]\nregion = eu-west-1\naws_access_key_id = AKIAEXAMPLE\naws_secret_access_key = secret\n"
+	if err := os.WriteFile(configFile, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("AWS_CONFIG_FILE", configFile)
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+	t.Setenv("AWS_PROFILE", "")
+	t.Setenv("AWS_REGION", "")
+	t.Setenv("AWS_DEFAULT_REGION", "")
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+	ctx := context.Background()
+
+	cfg, err := loadAWSConfigWith(ctx, awsOptions{Profile: "ci"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if cfg.Region != "eu-west-1" {
+		t.Errorf("Expected the profile's region, got %q", cfg.Region)
+	}
+	creds, err := cfg.Credentials.Retrieve(ctx)
+	if err != nil || creds.AccessKeyID != "AKIAEXAMPLE" {
+		t.Errorf("Expected the profile's credentials, got %+v (%v)", creds, err)
+	}
+
+	cfg, err = loadAWSConfigWith(ctx, awsOptions{Profile: "ci", Region: "cn-north-1", AssumeRoleARN: "arn:aws-cn:iam::123456789012:role/ci", ExternalID: "ext"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if cfg.Region != "cn-north-1" {
+		t.Errorf("--region should override the profile's region, got %q", cfg.Region)
+	}
+	cache, ok := cfg.Credentials.(*aws.CredentialsCache)
+	if !ok || !cache.IsCredentialsProvider(&stscreds.AssumeRoleProvider{}) {
+		t.Errorf("Expected assume-role credentials, got %T", cfg.Credentials)
+	}
+
+	if _, err := loadAWSConfigWith(ctx, awsOptions{Profile: "missing"}); err == nil || exitCode(err) != exitError {
+		t.Errorf("Expected an error exiting %d for an unknown profile, got %v", exitError, err)
+	}
+	if _, err := loadAWSConfigWith(ctx, awsOptions{ExternalID: "ext"}); exitCode(err) != exitValidationFailed {
+		t.Errorf("Expected a validation error for --external-id without --assume-role-arn, got %v", err)
+	}
+}
+
+// stubHTTPClient answers every request with the same STS response and counts
+// the requests.
+type stubHTTPClient struct {
+	status   int
+	body     string
+	requests int
+}
+
+func (c *stubHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	c.requests++
+	return &http.Response{
+		StatusCode: c.status,
+		Header:     http.Header{"Content-Type": []string{"text/xml"}},
+		Body:       io.NopCloser(strings.NewReader(c.body)),
+		Request:    req,
+	}, nil
+}
+
+func TestAPICallBudget(t *testing.T) {
+	budget := &apiCallBudget{limit: 2}
+	stub := &stubHTTPClient{status: 200, body: `<GetCallerIdentityResponse><GetCallerIdentityResult><Account>123456789012</Account></GetCallerIdentityResult></GetCallerIdentityResponse>`}
+	client := sts.New(sts.Options{
+		Region:      "us-east-1",
+		Credentials: credentials.NewStaticCredentialsProvider("AKIAEXAMPLE", "secret", ""),
+		HTTPClient:  stub,
+		Retryer:     newAWSRetryer(),
+		APIOptions:  []func(*middleware.Stack) error{budget.register},
+	})
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if _, err := client.GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{}); err != nil {
+			t.Fatalf("Call %d within the budget failed: %v", i+1, err)
+		}
+	}
+	_, err := client.GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	var exhausted errAPICallBudget
+	if !errors.As(err, &exhausted) {
+		t.Fatalf("Expected the budget to be exhausted, got %v", err)
+	}
+	if stub.requests != 2 {
+		t.Errorf("Expected 2 requests sent, got %d", stub.requests)
+	}
+}
+
+func TestAPICallBudgetCountsRetries(t *testing.T) {
+	budget := &apiCallBudget{limit: 3}
+	stub := &stubHTTPClient{status: 400, body: `<ErrorResponse><Error><Type>Sender</Type><Code>Throttling</Code><Message>Rate exceeded</Message></Error></ErrorResponse>`}
+	client := sts.New(sts.Options{
+		Region:      "us-east-1",
+		Credentials: credentials.NewStaticCredentialsProvider("AKIAEXAMPLE", "secret", ""),
+		HTTPClient:  stub,
+		Retryer: retry.NewStandard(func(o *retry.StandardOptions) {
+			o.MaxAttempts = awsMaxAttempts
+			o.Backoff = retry.BackoffDelayerFunc(func(int, error) (time.Duration, error) { return 0, nil })
+		}),
+		APIOptions: []func(*middleware.Stack) error{budget.register},
+	})
+
+	_, err := client.GetCallerIdentity(context.Background(), &sts.GetCallerIdentityInput{})
+	var exhausted errAPICallBudget
+	if !errors.As(err, &exhausted) {
+		t.Fatalf("Expected throttled retries to exhaust the budget, got %v", err)
+	}
+	if stub.requests != 3 {
+		t.Errorf("Expected 3 attempts before the budget ran out, got %d", stub.requests)
+	}
+}
+
+func TestNewAWSRetryer(t *testing.T) {
+	if got := newAWSRetryer().MaxAttempts(); got != awsMaxAttempts {
+		t.Errorf("Expected %d attempts, got %d", awsMaxAttempts, got)
+	}
+	if err := validateAWSFlags(awsOptions{MaxAPICalls: -1}); err == nil {
+		t.Error("Expected an error for a negative --max-api-calls")
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+// backendConfigSuffix is the extension of partial backend configuration
+// files, passed to terraform init with -backend-config. Repositories often
+// keep one per environment, each naming its own bucket, key and lock table.
+const backendConfigSuffix = ".tfbackend"
+
+// addBackend records a backend found while scanning. Every distinct backend
+// is kept in result.Backends, in the order found, and the first one is also
+// result.Backend. A backend with no settings (from a state file or an empty
+// backend block) gives way to one of the same type that has them.
+func addBackend(result *ParseResult, backend *BackendConfig) {
+	if backend == nil {
+		return
+	}
+	if result.Backend != nil && len(result.Backends) == 0 {
+		result.Backends = []*BackendConfig{result.Backend}
+	}
+	for i, existing := range result.Backends {
+		if existing.Type != backend.Type {
+			continue
+		}
+		if len(backend.Config) == 0 || maps.Equal(existing.Config, backend.Config) {
+			return
+		}
+		if len(existing.Config) == 0 {
+			result.Backends[i] = backend
+			if result.Backend == existing {
+				result.Backend = backend
+			}
+			return
+		}
+	}
+	result.Backends = append(result.Backends, backend)
+	if result.Backend == nil {
+		result.Backend = backend
+	}
+}
+
+// replaceBackend swaps result.Backend, and its place in result.Backends, for
+// backend, as an override file's terraform block does.
+func replaceBackend(result *ParseResult, backend *BackendConfig) {
+	for i, existing := range result.Backends {
+		if existing == result.Backend {
+			result.Backends[i] = backend
+		}
+	}
+	if result.Backend == nil {
+		result.Backends = append(result.Backends, backend)
+	}
+	result.Backend = backend
+}
+
+// foundBackends returns every backend found. Results parsed from a single
+// file only set result.Backend.
+func foundBackends(result *ParseResult) []*BackendConfig {
+	if len(result.Backends) > 0 {
+		return result.Backends
+	}
+	if result.Backend != nil {
+		return []*BackendConfig{result.Backend}
+	}
+	return nil
+}
+
+// stateBackends returns the backends whose state a run needs access to. With
+// no backend found it returns a single nil, the S3 backend
+// addBackendPermissions assumes.
+func stateBackends(result *ParseResult) []*BackendConfig {
+	if backends := foundBackends(result); len(backends) > 0 {
+		return backends
+	}
+	return []*BackendConfig{nil}
+}
+
+// applyBackendConfigFiles completes the backend block of a scanned directory
+// with each partial backend configuration file in paths. The completed
+// backends take the place of the block in result.Backends.
+func applyBackendConfigFiles(result *ParseResult, paths []string) {
+	if len(paths) == 0 {
+		return
+	}
+	base := result.Backend
+	if base == nil {
+		for _, path := range paths {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("%s: no backend block for this backend configuration file", path))
+		}
+		return
+	}
+
+	var completed []*BackendConfig
+	for _, path := range paths {
+		config, err := readBackendConfigFile(path)
+		if err != nil {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("Error parsing %s: %v", path, err))
+			continue
+		}
+		merged := maps.Clone(base.Config)
+		if merged == nil {
+			merged = make(map[string]string)
+		}
+		maps.Copy(merged, config)
+		completed = append(completed, &BackendConfig{Type: base.Type, Config: merged})
+	}
+	if len(completed) == 0 {
+		return
+	}
+
+	var backends []*BackendConfig
+	for _, backend := range result.Backends {
+		if backend != base {
+			backends = append(backends, backend)
+		}
+	}
+	result.Backends, result.Backend = backends, nil
+	for _, backend := range completed {
+		addBackend(result, backend)
+	}
+}
+
+// readBackendConfigFile returns the literal settings of a partial backend
+// configuration file.
+func readBackendConfigFile(path string) (map[string]string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	file, diags := hclsyntax.ParseConfig(content, path, hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	body, ok := file.Body.(*hclsyntax.Body)
+	if !ok {
+		return nil, fmt.Errorf("unexpected body type")
+	}
+	return backendAttributes(body, ""), nil
+}
+
+// describeBackend names a backend in the summary and the run report: its
+// type, with the bucket and key of an S3 backend when they are known.
+func describeBackend(backend *BackendConfig) string {
+	bucket := backend.Config["bucket"]
+	if backend.Type != "s3" || bucket == "" {
+		return backend.Type
+	}
+	location := bucket
+	if key := backend.Config["key"]; key != "" {
+		location += "/" + key
+	}
+	return fmt.Sprintf("s3 (%s)", location)
+}
+
+// backendResourceARNs returns the ARNs the state actions of an S3 backend are
+// scoped to in least-privilege mode, by action: the bucket for s3:ListBucket,
+// the state object of every workspace and its lock file for the other S3
+// actions, and the lock table for DynamoDB. It returns nil when the bucket is
+// not set literally; actions it has no ARNs for keep the service-wide ARN.
+func backendResourceARNs(backend *BackendConfig) map[string][]string {
+	if backend == nil || backend.Type != "s3" || backend.Config["bucket"] == "" {
+		return nil
+	}
+	ctx := defaultARNContext
+	bucketARN := fmt.Sprintf("arn:%s:s3:::%s", ctx.Partition, backend.Config["bucket"])
+	objects := []string{bucketARN + "/*"}
+	if key := backend.Config["key"]; key != "" {
+		prefix := backend.Config["workspace_key_prefix"]
+		if prefix == "" {
+			prefix = "env:"
+		}
+		objects = []string{
+			bucketARN + "/" + key + "*",
+			bucketARN + "/" + strings.Trim(prefix, "/") + "/*/" + key + "*",
+		}
+	}
+
+	arns := map[string][]string{"s3:ListBucket": {bucketARN}}
+	for _, action := range []string{"s3:GetObject", "s3:PutObject", "s3:DeleteObject"} {
+		arns[action] = objects
+	}
+	if table := backend.Config["dynamodb_table"]; table != "" {
+		region := backend.Config["region"]
+		if region == "" {
+			region = ctx.Region
+		}
+		tableARN := []string{fmt.Sprintf("arn:%s:dynamodb:%s:%s:table/%s", ctx.Partition, region, ctx.Account, table)}
+		for _, action := range []string{"dynamodb:GetItem", "dynamodb:PutItem", "dynamodb:DeleteItem", "dynamodb:DescribeTable", "dynamodb:CreateTable"} {
+			arns[action] = tableARN
+		}
+	}
+	return arns
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAddBackend(t *testing.T) {
+	result := &ParseResult{}
+	addBackend(result, &BackendConfig{Type: "s3", Config: map[string]string{}})
+	dev := &BackendConfig{Type: "s3", Config: map[string]string{"bucket": "acme-dev-state"}}
+	addBackend(result, dev)
+	addBackend(result, &BackendConfig{Type: "s3", Config: map[string]string{"bucket": "acme-dev-state"}})
+	prod := &BackendConfig{Type: "s3", Config: map[string]string{"bucket": "acme-prod-state"}}
+	addBackend(result, prod)
+	addBackend(result, &BackendConfig{Type: "s3"})
+
+	if !reflect.DeepEqual(result.Backends, []*BackendConfig{dev, prod}) {
+		t.Errorf("Expected the dev and prod backends, got %+v", result.Backends)
+	}
+	if result.Backend != dev {
+		t.Errorf("Expected the configured backend to replace the empty one as Backend, got %+v", result.Backend)
+	}
+}
+
+func TestScanBackendPerEnvironment(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "main.tf"), `
+resource "aws_sqs_queue" "jobs" {
+  name = "jobs"
+}
+`)
+	for _, env := range []string{"dev", "prod"} {
+		writeTestFile(t, filepath.Join(dir, "envs", env, "backend.tf"), `
+terraform {
+  backend "s3" {
+    bucket         = "acme-`+env+`-state"
+    key            = "app/terraform.tfstate"
+    region         = "us-east-1"
+    dynamodb_table = "acme-`+env+`-locks"
+  }
+}
+`)
+	}
+
+	result, err := parseTerraformFiles(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(result.Backends) != 2 || result.Backend != result.Backends[0] {
+		t.Fatalf("Expected a backend per environment, got %+v", result.Backends)
+	}
+
+	policy := buildIAMPolicy(result, true, true)
+	var s3Resources, dynamodbResources []string
+	for _, statement := range policy.Statement {
+		actions := toStringSlice(statement.Action)
+		switch {
+		case containsString(actions, "s3:GetObject"):
+			s3Resources = toStringSlice(statement.Resource)
+		case containsString(actions, "dynamodb:GetItem"):
+			dynamodbResources = toStringSlice(statement.Resource)
+		}
+	}
+	for _, env := range []string{"dev", "prod"} {
+		if !containsString(s3Resources, "arn:aws:s3:::acme-"+env+"-state") || !containsString(s3Resources, "arn:aws:s3:::acme-"+env+"-state/app/terraform.tfstate*") {
+			t.Errorf("Expected the %s state bucket and object, got %v", env, s3Resources)
+		}
+		if !containsString(dynamodbResources, "arn:aws:dynamodb:us-east-1:*:table/acme-"+env+"-locks") {
+			t.Errorf("Expected the %s lock table, got %v", env, dynamodbResources)
+		}
+	}
+
+	resourcePolicy := buildResourcePolicy(result, true)
+	var sids []string
+	for _, statement := range resourcePolicy.Statement {
+		if strings.HasPrefix(statement.Sid, stateBackendSid) {
+			sids = append(sids, statement.Sid)
+		}
+	}
+	if len(sids) < 2 || !strings.Contains(strings.Join(sids, ","), "AcmeDevState") || !strings.Contains(strings.Join(sids, ","), "AcmeProdState") {
+		t.Errorf("Expected state backend statements per backend, got %v", sids)
+	}
+
+	report := buildRunReport(result, policy, dir)
+	want := []string{"s3 (acme-dev-state/app/terraform.tfstate)", "s3 (acme-prod-state/app/terraform.tfstate)"}
+	if !reflect.DeepEqual(report.Backends, want) {
+		t.Errorf("Expected report backends %v, got %v", want, report.Backends)
+	}
+}
+
+func TestBackendConfigFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "main.tf"), `
+terraform {
+  backend "s3" {
+    key = "app/terraform.tfstate"
+  }
+}
+`)
+	writeTestFile(t, filepath.Join(dir, "envs", "dev.s3.tfbackend"), `
+bucket = "acme-dev-state"
+`)
+	writeTestFile(t, filepath.Join(dir, "envs", "prod.s3.tfbackend"), `
+bucket = "acme-prod-state"
+key    = "prod/terraform.tfstate"
+`)
+
+	result, err := parseTerraformFiles(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var got []string
+	for _, backend := range result.Backends {
+		got = append(got, describeBackend(backend))
+	}
+	want := []string{"s3 (acme-dev-state/app/terraform.tfstate)", "s3 (acme-prod-state/prod/terraform.tfstate)"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected the backend block completed by each file %v, got %v", want, got)
+	}
+	if result.Backend != result.Backends[0] {
+		t.Errorf("Expected the first completed backend as Backend, got %+v", result.Backend)
+	}
+
+	orphan := t.TempDir()
+	writeTestFile(t, filepath.Join(orphan, "main.tf"), `resource "aws_sqs_queue" "jobs" {}`)
+	writeTestFile(t, filepath.Join(orphan, "dev.s3.tfbackend"), `bucket = "acme-dev-state"`)
+	result, err = parseTerraformFiles(orphan)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Backend != nil || len(result.Warnings) != 1 || !strings.Contains(result.Warnings[0], "no backend block") {
+		t.Errorf("Expected a warning for a backend configuration file without a backend block, got %+v %v", result.Backend, result.Warnings)
+	}
+}
+
+func TestBackendResourceARNs(t *testing.T) {
+	if arns := backendResourceARNs(&BackendConfig{Type: "s3", Config: map[string]string{"key": "app.tfstate"}}); arns != nil {
+		t.Errorf("Expected no ARNs without a bucket, got %v", arns)
+	}
+	if arns := backendResourceARNs(&BackendConfig{Type: "gcs", Config: map[string]string{"bucket": "state"}}); arns != nil {
+		t.Errorf("Expected no ARNs for a non-S3 backend, got %v", arns)
+	}
+
+	arns := backendResourceARNs(&BackendConfig{Type: "s3", Config: map[string]string{
+		"bucket":               "state",
+		"key":                  "app.tfstate",
+		"workspace_key_prefix": "workspaces",
+	}})
+	if !reflect.DeepEqual(arns["s3:ListBucket"], []string{"arn:aws:s3:::state"}) {
+		t.Errorf("Expected ListBucket on the bucket, got %v", arns["s3:ListBucket"])
+	}
+	wantObjects := []string{"arn:aws:s3:::state/app.tfstate*", "arn:aws:s3:::state/workspaces/*/app.tfstate*"}
+	if !reflect.DeepEqual(arns["s3:PutObject"], wantObjects) {
+		t.Errorf("Expected PutObject on %v, got %v", wantObjects, arns["s3:PutObject"])
+	}
+	if _, ok := arns["dynamodb:GetItem"]; ok {
+		t.Error("Expected no lock table ARNs without dynamodb_table")
+	}
+
+	arns = backendResourceARNs(&BackendConfig{Type: "s3", Config: map[string]string{"bucket": "state"}})
+	if !reflect.DeepEqual(arns["s3:GetObject"], []string{"arn:aws:s3:::state/*"}) {
+		t.Errorf("Expected every object of the bucket without a key, got %v", arns["s3:GetObject"])
+	}
+}
@@ -0,0 +1,444 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+var batchParallelFlag int
+
+var batchCmd = &cobra.Command{
+	Use:   "batch manifest.yaml",
+	Short: "Scan the stacks of many deployment roles from a manifest",
+	Long: `Scan every stack listed in a manifest in parallel and write one policy per
+deployment role (account and role name), plus a consolidated cross-account
+report. Stacks are local paths or git repositories:
+
+  output_dir: policies
+  report: policies/cross-account-report.json
+  stacks:
+    - path: ./network
+      account: "111111111111"
+      role_name: terraform-network
+    - repo: https://github.com/example/payments.git
+      ref: main
+      dir: terraform
+      account: "222222222222"
+      role_name: terraform-deploy
+
+Stacks with the same account and role name share one policy. ARNs carry the
+stack's account ID unless --template-vars is given. The policy output flags
+(--least-privilege, --format, --fail-on, ...) apply to every role. When a
+--fail-on or --strict check fails for a role, the remaining roles and the
+report are still written, and the run exits with the first failure's code.`,
+	Args: cobra.ExactArgs(1),
+	Run:  runBatch,
+}
+
+func init() {
+	addPolicyOutputFlags(batchCmd)
+	batchCmd.Flags().IntVar(&batchParallelFlag, "parallel", runtime.GOMAXPROCS(0), "Number of stacks cloned and parsed at the same time")
+	rootCmd.AddCommand(batchCmd)
+}
+
+// BatchManifest lists the stacks scanned by 'batch'. Relative paths are
+// relative to the manifest.
+type BatchManifest struct {
+	OutputDir string       `yaml:"output_dir,omitempty"`
+	Report    string       `yaml:"report,omitempty"`
+	Stacks    []BatchStack `yaml:"stacks"`
+}
+
+// BatchStack is one root module and the deployment role that applies it.
+// Exactly one of Path and Repo is set; Ref and Dir select the branch or tag
+// and the directory within a repository.
+type BatchStack struct {
+	Path     string `yaml:"path,omitempty"`
+	Repo     string `yaml:"repo,omitempty"`
+	Ref      string `yaml:"ref,omitempty"`
+	Dir      string `yaml:"dir,omitempty"`
+	Account  string `yaml:"account"`
+	RoleName string `yaml:"role_name"`
+	Output   string `yaml:"output,omitempty"`
+}
+
+// source names the stack in messages and reports.
+func (s BatchStack) source() string {
+	if s.Repo == "" {
+		return s.Path
+	}
+	source := s.Repo
+	if s.Ref != "" {
+		source += "@" + s.Ref
+	}
+	if s.Dir != "" {
+		source += "//" + s.Dir
+	}
+	return source
+}
+
+var (
+	accountIDPattern = regexp.MustCompile(`^[0-9]{12}$`)
+	roleNamePattern  = regexp.MustCompile(`^[\w+=,.@-]{1,64}$`)
+)
+
+// loadBatchManifest reads and checks a batch manifest. Unknown keys are
+// rejected, as in the configuration file.
+func loadBatchManifest(filePath string) (BatchManifest, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return BatchManifest{}, fmt.Errorf("error reading manifest: %w", err)
+	}
+	var manifest BatchManifest
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&manifest); err != nil && !errors.Is(err, io.EOF) {
+		return BatchManifest{}, fmt.Errorf("error parsing %s: %w", filePath, err)
+	}
+	if len(manifest.Stacks) == 0 {
+		return BatchManifest{}, fmt.Errorf("%s lists no stacks", filePath)
+	}
+
+	dir := filepath.Dir(filePath)
+	if manifest.OutputDir != "" {
+		manifest.OutputDir = relativeToConfig(dir, manifest.OutputDir)
+	}
+	if manifest.Report != "" {
+		manifest.Report = relativeToConfig(dir, manifest.Report)
+	}
+	for i := range manifest.Stacks {
+		stack := &manifest.Stacks[i]
+		fail := func(format string, args ...interface{}) error {
+			return fmt.Errorf("error parsing %s: stack %d: %s", filePath, i+1, fmt.Sprintf(format, args...))
+		}
+		switch {
+		case (stack.Path == "") == (stack.Repo == ""):
+			return BatchManifest{}, fail("set exactly one of path and repo")
+		case stack.Path != "" && (stack.Ref != "" || stack.Dir != ""):
+			return BatchManifest{}, fail("ref and dir only apply to repo")
+		case !accountIDPattern.MatchString(stack.Account):
+			return BatchManifest{}, fail("account %q is not a 12-digit AWS account ID (quote it in YAML)", stack.Account)
+		case !roleNamePattern.MatchString(stack.RoleName):
+			return BatchManifest{}, fail("role_name %q is not a valid IAM role name", stack.RoleName)
+		}
+		if stack.Path != "" {
+			stack.Path = relativeToConfig(dir, stack.Path)
+		}
+		if stack.Output != "" {
+			stack.Output = relativeToConfig(dir, stack.Output)
+		}
+	}
+	return manifest, nil
+}
+
+// batchRole is a deployment role and the stacks whose union it is granted.
+type batchRole struct {
+	Account  string
+	RoleName string
+	Output   string
+	Stacks   []int // indexes into the manifest's stacks
+}
+
+// formatExtensions are the file extensions of the output formats.
+var formatExtensions = map[OutputFormat]string{
+	FormatJSON:      ".json",
+	FormatYAML:      ".yaml",
+	FormatTerraform: ".tf",
+	FormatPulumiTS:  ".ts",
+	FormatPulumiPy:  ".py",
+	FormatHTML:      ".html",
+	FormatCSV:       ".csv",
+	FormatXLSX:      ".xlsx",
+	FormatSpacelift: ".rego",
+	FormatEnv0:      ".rego",
+	FormatOPA:       ".json",
+}
+
+// batchRoles groups the manifest's stacks by account and role name, in the
+// order the roles first appear. A role without an output in the manifest is
+// written to <output_dir>/<account>-<role_name><ext>, or the file
+// --output-template names below output_dir, output_dir defaulting to the
+// manifest's directory.
+func batchRoles(manifest BatchManifest, manifestDir string, format OutputFormat) ([]*batchRole, error) {
+	outputDir := manifest.OutputDir
+	if outputDir == "" {
+		outputDir = manifestDir
+	}
+	var roles []*batchRole
+	byKey := make(map[string]*batchRole)
+	for i, stack := range manifest.Stacks {
+		key := stack.Account + "/" + stack.RoleName
+		role, ok := byKey[key]
+		if !ok {
+			role = &batchRole{Account: stack.Account, RoleName: stack.RoleName}
+			byKey[key] = role
+			roles = append(roles, role)
+		}
+		if stack.Output != "" {
+			if role.Output != "" && role.Output != stack.Output {
+				return nil, fmt.Errorf("stacks of role %s in account %s name different outputs: %s and %s", stack.RoleName, stack.Account, role.Output, stack.Output)
+			}
+			role.Output = stack.Output
+		}
+		role.Stacks = append(role.Stacks, i)
+	}
+
+	written := make(map[string]string)
+	for _, role := range roles {
+		if role.Output == "" && outputTemplate != nil {
+			files, err := templateOutputs([]artifactFields{{Account: role.Account, Role: role.RoleName}}, format)
+			if err != nil {
+				return nil, err
+			}
+			role.Output = files[0]
+			if !filepath.IsAbs(role.Output) {
+				role.Output = filepath.Join(outputDir, role.Output)
+			}
+		}
+		if role.Output == "" {
+			role.Output = filepath.Join(outputDir, role.Account+"-"+role.RoleName+formatExtension(format))
+		}
+		if previous, ok := written[role.Output]; ok {
+			return nil, fmt.Errorf("roles %s and %s/%s would both write %s", previous, role.Account, role.RoleName, role.Output)
+		}
+		written[role.Output] = role.Account + "/" + role.RoleName
+	}
+	return roles, nil
+}
+
+// cloneStack makes a shallow clone of a repo stack into a directory below
+// workDir and returns the directory to scan.
+func cloneStack(ctx context.Context, stack BatchStack, workDir string) (string, error) {
+	dir, err := os.MkdirTemp(workDir, "stack-")
+	if err != nil {
+		return "", err
+	}
+	args := []string{"clone", "--quiet", "--depth", "1"}
+	if stack.Ref != "" {
+		args = append(args, "--branch", stack.Ref)
+	}
+	args = append(args, stack.Repo, dir)
+	if out, err := exec.CommandContext(ctx, "git", args...).CombinedOutput(); err != nil {
+		return "", fmt.Errorf("git clone %s: %s", stack.Repo, strings.TrimSpace(string(out)))
+	}
+	return filepath.Join(dir, stack.Dir), nil
+}
+
+// parseBatchStacks clones and parses the stacks, at most parallel at a time,
+// and returns the results in manifest order.
+func parseBatchStacks(ctx context.Context, stacks []BatchStack, workDir string, parallel int) ([]*ParseResult, error) {
+	if parallel < 1 {
+		parallel = 1
+	}
+	results := make([]*ParseResult, len(stacks))
+	errs := make([]error, len(stacks))
+	slots := make(chan struct{}, parallel)
+
+	var wg sync.WaitGroup
+	for i, stack := range stacks {
+		wg.Add(1)
+		go func(i int, stack BatchStack) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			dir := stack.Path
+			if stack.Repo != "" {
+				if dir, errs[i] = cloneStack(ctx, stack, workDir); errs[i] != nil {
+					return
+				}
+			}
+			results[i], errs[i] = parseTerraformFilesContext(ctx, dir)
+		}(i, stack)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", stacks[i].source(), err)
+		}
+	}
+	return results, nil
+}
+
+// BatchReport is the consolidated cross-account report of a batch run.
+type BatchReport struct {
+	Manifest      string              `json:"manifest"`
+	PermissionsDB PermissionsDBMeta   `json:"permissions_db"`
+	Accounts      []string            `json:"accounts"`
+	Roles         []BatchRoleReport   `json:"roles"`
+	Services      map[string][]string `json:"services"` // service prefix -> role ARNs granted it
+	Unmapped      []string            `json:"unmapped"`
+}
+
+// BatchRoleReport summarizes the policy of one deployment role.
+type BatchRoleReport struct {
+	Account    string   `json:"account"`
+	RoleName   string   `json:"role_name"`
+	RoleARN    string   `json:"role_arn"`
+	Stacks     []string `json:"stacks"`
+	Output     string   `json:"output"`
+	Statements int      `json:"statements"`
+	Actions    int      `json:"actions"`
+	Services   []string `json:"services"`
+	RiskScore  int      `json:"risk_score"`
+	RiskLevel  string   `json:"risk_level"`
+	Unmapped   []string `json:"unmapped"`
+	Degraded   bool     `json:"degraded"`
+}
+
+// buildBatchReport combines the run reports of the roles.
+func buildBatchReport(manifestPath string, roles []*batchRole, stacks []BatchStack, reports []RunReport) BatchReport {
+	report := BatchReport{
+		Manifest:      manifestPath,
+		PermissionsDB: permissionsDBMeta,
+		Accounts:      []string{},
+		Roles:         []BatchRoleReport{},
+		Services:      make(map[string][]string),
+		Unmapped:      []string{},
+	}
+	accounts := make(map[string]bool)
+	unmapped := make(map[string]bool)
+	for i, role := range roles {
+		run := reports[i]
+		roleARN := fmt.Sprintf("arn:%s:iam::%s:role/%s", defaultARNContext.Partition, role.Account, role.RoleName)
+		entry := BatchRoleReport{
+			Account:    role.Account,
+			RoleName:   role.RoleName,
+			RoleARN:    roleARN,
+			Stacks:     []string{},
+			Output:     role.Output,
+			Statements: run.Statements,
+			Actions:    run.Actions,
+			Services:   run.Services,
+			RiskScore:  run.Stats.RiskScore,
+			RiskLevel:  run.Stats.RiskLevel,
+			Unmapped:   run.Unmapped,
+			Degraded:   run.Degraded,
+		}
+		for _, index := range role.Stacks {
+			entry.Stacks = append(entry.Stacks, stacks[index].source())
+		}
+		if entry.Unmapped == nil {
+			entry.Unmapped = []string{}
+		}
+		report.Roles = append(report.Roles, entry)
+
+		accounts[role.Account] = true
+		for _, service := range run.Services {
+			report.Services[service] = append(report.Services[service], roleARN)
+		}
+		for _, t := range run.Unmapped {
+			unmapped[t] = true
+		}
+	}
+	report.Accounts = append(report.Accounts, sortedSet(accounts)...)
+	report.Unmapped = append(report.Unmapped, sortedSet(unmapped)...)
+	return report
+}
+
+func runBatch(cmd *cobra.Command, args []string) {
+	for _, name := range []string{"output", "attest"} {
+		if cmd.Flags().Changed(name) {
+			exitWithError(validationErrorf("--%s does not apply to batch; the manifest names the outputs", name))
+		}
+	}
+	// --report names the consolidated report; the per-role run reports are
+	// only used to build it
+	reportPath := reportFlag
+	reportFlag = ""
+	format, err := validateOutputFlags(cmd)
+	if err != nil {
+		exitWithError(err)
+	}
+
+	manifestPath := args[0]
+	manifest, err := loadBatchManifest(manifestPath)
+	if err != nil {
+		exitWithError(&ValidationError{Err: err})
+	}
+	if reportPath == "" {
+		reportPath = manifest.Report
+	}
+	roles, err := batchRoles(manifest, filepath.Dir(manifestPath), format)
+	if err != nil {
+		exitWithError(&ValidationError{Err: err})
+	}
+	if permissionsDB == nil {
+		if err := loadPermissionsDB(); err != nil {
+			exitWithError(&DBError{Source: "the permissions DB", Err: err})
+		}
+	}
+
+	workDir, err := os.MkdirTemp("", "tf-iam-scanner-batch-")
+	if err != nil {
+		exitWithError(err)
+	}
+	statusf("Scanning %d stack(s) for %d role(s)\n", len(manifest.Stacks), len(roles))
+	results, err := parseBatchStacks(cmd.Context(), manifest.Stacks, workDir, batchParallelFlag)
+	// The clones are no longer needed once parsed
+	os.RemoveAll(workDir)
+	exitIfCancelled(cmd.Context(), nil, manifestPath)
+	if err != nil {
+		exitWithError(&ParseError{Source: manifestPath, Err: err})
+	}
+
+	// A failed check does not stop the batch: every role's policy and the
+	// report are still written, then the run exits with the first failed
+	// check's code
+	reports := make([]RunReport, len(roles))
+	failed := 0
+	templatedAccount := templateVarsFlag != ""
+	for i, role := range roles {
+		statusf("\n==> %s/%s\n", role.Account, role.RoleName)
+		var roleResults []*ParseResult
+		var sources []string
+		for _, index := range role.Stacks {
+			roleResults = append(roleResults, results[index])
+			sources = append(sources, manifest.Stacks[index].source())
+		}
+		result := mergeParseResults(roleResults, sources)
+
+		outputFlag = role.Output
+		if err := os.MkdirAll(filepath.Dir(outputFlag), 0755); err != nil {
+			exitWithError(&OutputError{Path: outputFlag, Err: err})
+		}
+		if !templatedAccount {
+			defaultARNContext.Account = role.Account
+		}
+		var code int
+		_, reports[i], code = generatePolicy(cmd.Context(), result, format, strings.Join(sources, ", "))
+		if failed == 0 {
+			failed = code
+		}
+	}
+
+	if reportPath != "" {
+		report := buildBatchReport(manifestPath, roles, manifest.Stacks, reports)
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			exitWithError(&OutputError{Path: reportPath, Err: fmt.Errorf("error marshaling report: %w", err)})
+		}
+		if err := writeOutputFile(reportPath, append(data, '\n'), outputMode, forceFlag); err != nil {
+			exitWithError(&OutputError{Path: reportPath, Err: err})
+		}
+		statusf("\nCross-account report written to: %s\n", reportPath)
+	}
+	if failed != 0 {
+		exitRun(failed)
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadBatchManifest(t *testing.T) {
+	dir := t.TempDir()
+	manifestPath := filepath.Join(dir, "manifest.yaml")
+	writeTestFile(t, manifestPath, `
+output_dir: policies
+report: policies/report.json
+stacks:
+  - path: network
+    account: "111111111111"
+    role_name: terraform-network
+  - repo: https://example.com/app.git
+    ref: v1.2.0
+    dir: terraform
+    account: "222222222222"
+    role_name: terraform-deploy
+    output: /tmp/app.json
+`)
+	manifest, err := loadBatchManifest(manifestPath)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if manifest.OutputDir != filepath.Join(dir, "policies") || manifest.Report != filepath.Join(dir, "policies/report.json") {
+		t.Errorf("Paths not relative to the manifest: %+v", manifest)
+	}
+	if manifest.Stacks[0].Path != filepath.Join(dir, "network") || manifest.Stacks[1].Output != "/tmp/app.json" {
+		t.Errorf("Unexpected stacks: %+v", manifest.Stacks)
+	}
+	if got := manifest.Stacks[1].source(); got != "https://example.com/app.git@v1.2.0//terraform" {
+		t.Errorf("source() = %q", got)
+	}
+
+	invalid := map[string]string{
+		"no stacks":     "output_dir: out\n",
+		"unknown key":   "stacks:\n  - path: a\n    account: \"111111111111\"\n    role_name: r\n    region: us-east-1\n",
+		"path and repo": "stacks:\n  - path: a\n    repo: b\n    account: \"111111111111\"\n    role_name: r\n",
+		"neither":       "stacks:\n  - account: \"111111111111\"\n    role_name: r\n",
+		"ref on path":   "stacks:\n  - path: a\n    ref: main\n    account: \"111111111111\"\n    role_name: r\n",
+		"short account": "stacks:\n  - path: a\n    account: \"1234\"\n    role_name: r\n",
+		"no role name":  "stacks:\n  - path: a\n    account: \"111111111111\"\n",
+		"bad role name": "stacks:\n  - path: a\n    account: \"111111111111\"\n    role_name: \"deploy role\"\n",
+	}
+	for name, content := range invalid {
+		writeTestFile(t, manifestPath, content)
+		if _, err := loadBatchManifest(manifestPath); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestBatchRoles(t *testing.T) {
+	manifest := BatchManifest{
+		OutputDir: "out",
+		Stacks: []BatchStack{
+			{Path: "network", Account: "111111111111", RoleName: "deploy"},
+			{Path: "app", Account: "222222222222", RoleName: "deploy"},
+			{Path: "dns", Account: "111111111111", RoleName: "deploy"},
+			{Path: "data", Account: "222222222222", RoleName: "data", Output: "data.tf"},
+		},
+	}
+	roles, err := batchRoles(manifest, ".", FormatTerraform)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(roles) != 3 {
+		t.Fatalf("Expected 3 roles, got %d", len(roles))
+	}
+	if roles[0].Output != filepath.Join("out", "111111111111-deploy.tf") || len(roles[0].Stacks) != 2 || roles[0].Stacks[1] != 2 {
+		t.Errorf("Unexpected first role: %+v", roles[0])
+	}
+	if roles[2].Output != "data.tf" {
+		t.Errorf("Manifest output not kept: %+v", roles[2])
+	}
+
+	manifest.Stacks[2].Output = "other.tf"
+	manifest.Stacks[0].Output = "network.tf"
+	if _, err := batchRoles(manifest, ".", FormatJSON); err == nil {
+		t.Errorf("Expected an error for stacks of one role naming different outputs")
+	}
+	manifest.Stacks[0].Output, manifest.Stacks[2].Output = "", ""
+	manifest.Stacks[1].Output = "data.tf"
+	if _, err := batchRoles(manifest, ".", FormatJSON); err == nil {
+		t.Errorf("Expected an error for roles writing the same output")
+	}
+}
+
+func TestParseBatchStacks(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	if err := loadPermissionsDB(); err != nil {
+		t.Fatalf("Error loading permissions DB: %v", err)
+	}
+
+	dir := t.TempDir()
+	local := filepath.Join(dir, "network")
+	writeTestFile(t, filepath.Join(local, "main.tf"), `
+resource "aws_vpc" "main" {
+  cidr_block = "10.0.0.0/16"
+}
+`)
+	repo := filepath.Join(dir, "repo")
+	writeTestFile(t, filepath.Join(repo, "terraform", "main.tf"), `
+resource "aws_sqs_queue" "jobs" {
+  name = "jobs"
+}
+`)
+	runGit(t, repo, "init", "--quiet", "--initial-branch", "main")
+	runGit(t, repo, "add", ".")
+	runGit(t, repo, "commit", "--quiet", "-m", "init")
+
+	stacks := []BatchStack{
+		{Path: local, Account: "111111111111", RoleName: "network"},
+		{Repo: repo, Ref: "main", Dir: "terraform", Account: "222222222222", RoleName: "app"},
+	}
+	results, err := parseBatchStacks(context.Background(), stacks, t.TempDir(), 1)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if results[0].Resources[0].Type != "aws_vpc" || results[1].Resources[0].Type != "aws_sqs_queue" {
+		t.Errorf("Results not in manifest order: %v, %v", results[0].Resources, results[1].Resources)
+	}
+
+	stacks[1].Ref = "missing"
+	if _, err := parseBatchStacks(context.Background(), stacks, t.TempDir(), 2); err == nil || !strings.Contains(err.Error(), "@missing") {
+		t.Errorf("Expected a clone error naming the stack, got %v", err)
+	}
+}
+
+func TestBatchReportMatchesSchema(t *testing.T) {
+	if err := loadPermissionsDB(); err != nil {
+		t.Fatalf("Error loading permissions DB: %v", err)
+	}
+	result, err := parseTerraformFiles("test-fixtures/simple")
+	if err != nil {
+		t.Fatalf("Error parsing fixture: %v", err)
+	}
+	run := buildRunReport(result, buildIAMPolicy(result, false, false), "simple")
+
+	stacks := []BatchStack{
+		{Path: "network", Account: "111111111111", RoleName: "deploy"},
+		{Path: "app", Account: "222222222222", RoleName: "deploy"},
+	}
+	roles := []*batchRole{
+		{Account: "111111111111", RoleName: "deploy", Output: "a.json", Stacks: []int{0}},
+		{Account: "222222222222", RoleName: "deploy", Output: "b.json", Stacks: []int{1}},
+	}
+	report := buildBatchReport("manifest.yaml", roles, stacks, []RunReport{run, run})
+	if len(report.Accounts) != 2 || report.Roles[1].RoleARN != "arn:aws:iam::222222222222:role/deploy" {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+	for service, roleARNs := range report.Services {
+		if len(roleARNs) != 2 {
+			t.Errorf("Service %s granted to %v, want both roles", service, roleARNs)
+		}
+	}
+
+	data, err := json.Marshal(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	validateOutput(t, compileOutputSchema(t, "batch"), "cross-account report", data)
+}
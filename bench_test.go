@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+// The large repository of the benchmarks: 100 files of 100 resources, two
+// thirds of them AWS resources.
+const (
+	largeRepositoryFiles     = 100
+	largeRepositoryResources = 100
+)
+
+var (
+	largeRepositoryOnce   sync.Once
+	largeRepositoryResult *ParseResult
+	largeRepositoryErr    error
+)
+
+// largeRepository parses the large repository once for the benchmarks and
+// tests that only read the result.
+func largeRepository(tb testing.TB) *ParseResult {
+	tb.Helper()
+	if err := loadPermissionsDB(); err != nil {
+		tb.Fatalf("Error loading permissions DB: %v", err)
+	}
+	largeRepositoryOnce.Do(func() {
+		dir := tb.TempDir()
+		writeBenchmarkRepository(tb, dir, largeRepositoryFiles, largeRepositoryResources)
+		largeRepositoryResult, largeRepositoryErr = parseTerraformFiles(dir)
+	})
+	if largeRepositoryErr != nil {
+		tb.Fatal(largeRepositoryErr)
+	}
+	return largeRepositoryResult
+}
+
+func BenchmarkParseLargeRepository(b *testing.B) {
+	if err := loadPermissionsDB(); err != nil {
+		b.Fatalf("Error loading permissions DB: %v", err)
+	}
+	dir := b.TempDir()
+	writeBenchmarkRepository(b, dir, largeRepositoryFiles, largeRepositoryResources)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := parseTerraformFiles(dir); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkBuildIAMPolicy(b *testing.B) {
+	result := largeRepository(b)
+	for _, leastPrivilege := range []bool{false, true} {
+		b.Run(fmt.Sprintf("least-privilege=%v", leastPrivilege), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				buildIAMPolicy(result, false, leastPrivilege)
+			}
+		})
+	}
+}
+
+func BenchmarkBuildResourcePolicy(b *testing.B) {
+	result := largeRepository(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buildResourcePolicy(result, false)
+	}
+}
+
+func BenchmarkFormatPolicy(b *testing.B) {
+	result := largeRepository(b)
+	policy := buildIAMPolicy(result, false, true)
+	for _, format := range []OutputFormat{FormatJSON, FormatYAML, FormatTerraform} {
+		b.Run(string(format), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := formatPolicy(policy, result, format); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// TestLargeRepositoryBudget guards against performance regressions of an
+// order of magnitude: the budgets are well above the time and memory a scan
+// of the large repository takes, so that slow CI machines pass, and fail a
+// change that makes a phase quadratic or keeps every attribute value.
+func TestLargeRepositoryBudget(t *testing.T) {
+	if testing.Short() {
+		t.Skip("parses 10,000 resources")
+	}
+	start := time.Now()
+	result := largeRepository(t)
+	if elapsed := time.Since(start); elapsed > 30*time.Second {
+		t.Errorf("Parsing took %v, budget 30s", elapsed)
+	}
+	if want := largeRepositoryFiles * largeRepositoryResources; len(result.Resources) != want {
+		t.Fatalf("Expected %d resources, got %d", want, len(result.Resources))
+	}
+
+	var stats runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&stats)
+	if heap := stats.HeapAlloc >> 20; heap > 512 {
+		t.Errorf("The parse result holds %dMB, budget 512MB", heap)
+	}
+
+	start = time.Now()
+	policy := buildIAMPolicy(result, false, true)
+	if _, err := formatPolicy(policy, result, FormatJSON); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("Generating and formatting the policy took %v, budget 10s", elapsed)
+	}
+	runtime.KeepAlive(result)
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+//go:embed actions.json
+var embeddedActionCatalog []byte
+
+//go:generate go run cmd/generate-actions/main.go
+
+// Access levels as named in the IAM service authorization reference.
+const (
+	AccessList                  = "List"
+	AccessRead                  = "Read"
+	AccessWrite                 = "Write"
+	AccessPermissionsManagement = "Permissions management"
+	AccessTagging               = "Tagging"
+)
+
+// ActionInfo describes a single IAM action in the catalog. WildcardOnly
+// actions do not support resource-level permissions and are only authorized
+// with Resource "*".
+type ActionInfo struct {
+	Access       string `json:"access"`
+	WildcardOnly bool   `json:"wildcard_only,omitempty"`
+}
+
+// ServiceActions lists the actions of one service prefix. Partial services
+// are known to be incomplete, so a missing action is not proof that it does
+// not exist.
+type ServiceActions struct {
+	Partial bool                  `json:"partial,omitempty"`
+	Actions map[string]ActionInfo `json:"actions"`
+}
+
+// ActionCatalog maps service prefixes (e.g. "s3") to their actions.
+type ActionCatalog map[string]ServiceActions
+
+var actionCatalog ActionCatalog
+
+// actionCatalogIndex maps lowercase "service:action" names to their
+// canonical spelling; IAM action names are case-insensitive.
+var actionCatalogIndex map[string]string
+
+// loadActionCatalog loads the embedded action catalog.
+func loadActionCatalog() error {
+	var catalog ActionCatalog
+	if err := json.Unmarshal(embeddedActionCatalog, &catalog); err != nil {
+		return fmt.Errorf("error parsing actions.json: %w", err)
+	}
+	delete(catalog, "_meta")
+
+	index := make(map[string]string)
+	for service, entry := range catalog {
+		for name := range entry.Actions {
+			index[strings.ToLower(service+":"+name)] = service + ":" + name
+		}
+	}
+
+	actionCatalog = catalog
+	actionCatalogIndex = index
+	return nil
+}
+
+// lookupAction finds action in the catalog, ignoring case. It returns the
+// canonical action name and its info when found.
+func lookupAction(action string) (string, ActionInfo, bool) {
+	canonical, ok := actionCatalogIndex[strings.ToLower(action)]
+	if !ok {
+		return "", ActionInfo{}, false
+	}
+	service, name, _ := strings.Cut(canonical, ":")
+	return canonical, actionCatalog[service].Actions[name], true
+}
+
+// isWildcardOnlyAction reports whether the catalog lists action as not
+// supporting resource-level permissions.
+func isWildcardOnlyAction(action string) bool {
+	_, info, ok := lookupAction(action)
+	return ok && info.WildcardOnly
+}
+
+// wildcardOnlySid names the least-privilege statement that grants the
+// wildcard-only actions on Resource "*".
+const wildcardOnlySid = "WildcardOnlyActions"
+
+// splitWildcardOnlyActions separates the wildcard-only actions from the
+// others, keeping the order of each.
+func splitWildcardOnlyActions(actions []string) (scoped, wildcardOnly []string) {
+	for _, action := range actions {
+		if isWildcardOnlyAction(action) {
+			wildcardOnly = append(wildcardOnly, action)
+		} else {
+			scoped = append(scoped, action)
+		}
+	}
+	return scoped, wildcardOnly
+}
+
+// catalogService returns the catalog entry for a service prefix, ignoring
+// case.
+func catalogService(service string) (ServiceActions, bool) {
+	entry, ok := actionCatalog[strings.ToLower(service)]
+	return entry, ok
+}
+
+// expandActionPattern returns the catalog actions matching an IAM action
+// pattern such as "ec2:Describe*", sorted.
+func expandActionPattern(pattern string) []string {
+	service, _, ok := strings.Cut(pattern, ":")
+	if !ok {
+		return nil
+	}
+	entry, ok := catalogService(service)
+	if !ok {
+		return nil
+	}
+
+	var matches []string
+	for name := range entry.Actions {
+		action := strings.ToLower(service) + ":" + name
+		if iamWildcardMatch(pattern, action, true) {
+			matches = append(matches, action)
+		}
+	}
+	sort.Strings(matches)
+	return matches
+}
+
+// suggestAction returns the catalog action in the same service closest to a
+// misspelled action, or "" when nothing is reasonably close.
+func suggestAction(action string) string {
+	service, name, ok := strings.Cut(action, ":")
+	if !ok {
+		return ""
+	}
+	entry, ok := catalogService(service)
+	if !ok {
+		return ""
+	}
+
+	best, bestDistance := "", len(name)/3+1
+	for candidate := range entry.Actions {
+		if d := editDistance(strings.ToLower(name), strings.ToLower(candidate)); d < bestDistance {
+			best, bestDistance = candidate, d
+		}
+	}
+	if best == "" {
+		return ""
+	}
+	return strings.ToLower(service) + ":" + best
+}
+
+// likelyTypo reports whether an action missing from the catalog is within
+// two edits of a catalog action, so it is almost certainly misspelled even
+// in a service whose catalog entry is partial.
+func likelyTypo(action string) bool {
+	suggestion := suggestAction(action)
+	if suggestion == "" {
+		return false
+	}
+	_, name, _ := strings.Cut(action, ":")
+	_, known, _ := strings.Cut(suggestion, ":")
+	return editDistance(strings.ToLower(name), strings.ToLower(known)) <= 2
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
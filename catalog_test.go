@@ -0,0 +1,70 @@
+package main
+
+import "testing"
+
+func TestActionCatalogLookup(t *testing.T) {
+	if err := loadActionCatalog(); err != nil {
+		t.Fatalf("Error loading action catalog: %v", err)
+	}
+
+	canonical, info, ok := lookupAction("S3:getobject")
+	if !ok || canonical != "s3:GetObject" {
+		t.Fatalf("lookupAction(S3:getobject) = %q, %v", canonical, ok)
+	}
+	if info.Access != AccessRead {
+		t.Errorf("Expected s3:GetObject access level Read, got %q", info.Access)
+	}
+
+	if _, info, ok := lookupAction("sts:GetCallerIdentity"); !ok || !info.WildcardOnly {
+		t.Error("Expected sts:GetCallerIdentity to be wildcard-only")
+	}
+	if _, _, ok := lookupAction("s3:GetObjekt"); ok {
+		t.Error("Expected s3:GetObjekt to be unknown")
+	}
+	for _, action := range []string{"ssm:DescribeParameters", "kms:CreateKey", "secretsmanager:GetRandomPassword"} {
+		if _, info, ok := lookupAction(action); !ok || !info.WildcardOnly {
+			t.Errorf("Expected %s to be wildcard-only", action)
+		}
+	}
+	if _, info, _ := lookupAction("ec2:CreateTags"); info.Access != AccessTagging {
+		t.Errorf("Expected ec2:CreateTags access level Tagging, got %q", info.Access)
+	}
+	if _, _, ok := lookupAction("ec2:DescribeSecurityGroup"); ok {
+		t.Error("Expected ec2:DescribeSecurityGroup to be unknown")
+	}
+	if _, ok := actionCatalog["_meta"]; ok {
+		t.Error("Expected _meta to be removed from the catalog")
+	}
+}
+
+func TestExpandActionPattern(t *testing.T) {
+	if err := loadActionCatalog(); err != nil {
+		t.Fatalf("Error loading action catalog: %v", err)
+	}
+
+	matches := expandActionPattern("sqs:Delete*")
+	if len(matches) == 0 {
+		t.Fatal("Expected sqs:Delete* to match catalog actions")
+	}
+	for _, action := range matches {
+		if !iamWildcardMatch("sqs:delete*", action, true) {
+			t.Errorf("Unexpected match %s", action)
+		}
+	}
+	if got := expandActionPattern("nosuchservice:*"); len(got) != 0 {
+		t.Errorf("Expected no matches for an unknown service, got %v", got)
+	}
+}
+
+func TestSuggestAction(t *testing.T) {
+	if err := loadActionCatalog(); err != nil {
+		t.Fatalf("Error loading action catalog: %v", err)
+	}
+
+	if got := suggestAction("s3:GetObjekt"); got != "s3:GetObject" {
+		t.Errorf("suggestAction(s3:GetObjekt) = %q, want s3:GetObject", got)
+	}
+	if got := suggestAction("s3:CompletelyDifferent"); got != "" {
+		t.Errorf("Expected no suggestion, got %q", got)
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var changedSinceFlag string
+
+// changeDelta is the permission change introduced by the .tf files changed
+// since a git ref. Added and Removed are policy grants as listed by
+// diffPolicyGrants.
+type changeDelta struct {
+	Ref     string   `json:"ref"`
+	Base    string   `json:"base"`
+	Files   []string `json:"files"`
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+}
+
+// runChangeDelta is the delta of the current run, recorded in --report.
+var runChangeDelta *changeDelta
+
+func init() {
+	rootCmd.Flags().StringVar(&changedSinceFlag, "changed-since", "", "Only parse the .tf files below --path changed since the merge base with this git ref, and report the permissions the changes add and remove")
+}
+
+// git runs a git command in dir and returns its trimmed output.
+func git(dir string, args ...string) (string, error) {
+	out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+			return "", fmt.Errorf("git %s: %s", strings.Join(args, " "), strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", fmt.Errorf("git %s: %w", strings.Join(args, " "), err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// changedTerraformFiles returns the merge base of ref and HEAD in the
+// repository holding dir, and the .tf files below dir that differ from it in
+// the working tree: modified, added, deleted and untracked ones. Paths are
+// relative to the repository root.
+func changedTerraformFiles(dir, ref string) (repoRoot, base string, files []string, err error) {
+	repoRoot, err = git(dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", "", nil, fmt.Errorf("--changed-since needs --path inside a git repository: %w", err)
+	}
+	base, err = git(repoRoot, "merge-base", ref, "HEAD")
+	if err != nil {
+		return "", "", nil, fmt.Errorf("cannot compare with %s: %w", ref, err)
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", "", nil, err
+	}
+	prefix, err := filepath.Rel(realPath(repoRoot), realPath(absDir))
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	diff, err := git(repoRoot, "diff", "--name-only", "--no-renames", base, "--", prefix)
+	if err != nil {
+		return "", "", nil, err
+	}
+	untracked, err := git(repoRoot, "ls-files", "--others", "--exclude-standard", "--", prefix)
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(diff+"\n"+untracked, "\n") {
+		if !isConfigFile(name) || strings.Contains(name, ".terraform/") || seen[name] {
+			continue
+		}
+		seen[name] = true
+		files = append(files, name)
+	}
+	sort.Strings(files)
+	return repoRoot, base, files, nil
+}
+
+// parseChangedFiles parses the .tf files below dir changed since ref, as they
+// are now and as they were at the merge base. Files are parsed on their own,
+// so resources in a changed module file are addressed as in the root module.
+func parseChangedFiles(dir, ref string) (after, before *ParseResult, delta *changeDelta, err error) {
+	if permissionsDB == nil {
+		if err := loadPermissionsDB(); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	repoRoot, base, files, err := changedTerraformFiles(dir, ref)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	after = &ParseResult{Resources: []Resource{}, DataSources: []Resource{}}
+	before = &ParseResult{Resources: []Resource{}, DataSources: []Resource{}}
+	for _, name := range files {
+		path := filepath.Join(repoRoot, name)
+		if content, err := os.ReadFile(path); err == nil {
+			if err := mergeParsedSource(after, content, path); err != nil {
+				return nil, nil, nil, err
+			}
+		}
+		// Files added since the merge base have no earlier version
+		if content, err := exec.Command("git", "-C", repoRoot, "show", base+":"+name).Output(); err == nil {
+			if err := mergeParsedSource(before, content, path); err != nil {
+				return nil, nil, nil, err
+			}
+		}
+	}
+	recordSecurityFindings(after)
+	return after, before, &changeDelta{Ref: ref, Base: base, Files: files}, nil
+}
+
+// mergeParsedSource parses the content of one Terraform file into result.
+func mergeParsedSource(result *ParseResult, content []byte, path string) error {
+	fileResult, err := parseTerraformSource(content, path)
+	if err != nil {
+		return &ParseError{Source: path, Err: err}
+	}
+	result.Resources = append(result.Resources, fileResult.Resources...)
+	result.DataSources = append(result.DataSources, fileResult.DataSources...)
+	result.Modules = append(result.Modules, fileResult.Modules...)
+	result.ModuleCalls = append(result.ModuleCalls, fileResult.ModuleCalls...)
+	result.Warnings = append(result.Warnings, fileResult.Warnings...)
+	result.Diagnostics = append(result.Diagnostics, fileResult.Diagnostics...)
+	result.Findings = append(result.Findings, fileResult.Findings...)
+	result.StateEncryption = append(result.StateEncryption, fileResult.StateEncryption...)
+	addBackend(result, fileResult.Backend)
+	return nil
+}
+
+// computeChangeDelta fills delta with the grants the policy of the changed
+// files gains and loses, comparing the policies generated from them before
+// and after the change with the run's --least-privilege setting.
+func computeChangeDelta(delta *changeDelta, before, after *ParseResult) {
+	delta.Added, delta.Removed = diffPolicyGrants(
+		buildIAMPolicy(before, false, leastPrivilegeFlag),
+		buildIAMPolicy(after, false, leastPrivilegeFlag))
+	// Emit empty lists rather than null in --report
+	for _, list := range []*[]string{&delta.Files, &delta.Added, &delta.Removed} {
+		if *list == nil {
+			*list = []string{}
+		}
+	}
+}
+
+// printChangeDelta prints the delta before the run summary.
+func printChangeDelta(delta *changeDelta) {
+	statusf("Changed since %s (%.12s): %d .tf file(s)\n", delta.Ref, delta.Base, len(delta.Files))
+	for _, file := range delta.Files {
+		statusf("  %s\n", file)
+	}
+	if len(delta.Added) == 0 && len(delta.Removed) == 0 {
+		statusf("Permission delta: none\n\n")
+		return
+	}
+	statusf("Permission delta: +%d -%d\n", len(delta.Added), len(delta.Removed))
+	for _, grant := range delta.Added {
+		statusf("  + %s\n", grant)
+	}
+	for _, grant := range delta.Removed {
+		statusf("  - %s\n", grant)
+	}
+	statusf("\n")
+}
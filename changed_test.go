@@ -0,0 +1,75 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// runGit runs git in dir for a test repository.
+func runGit(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+}
+
+func TestParseChangedFiles(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	repo := t.TempDir()
+	stack := filepath.Join(repo, "stacks", "app")
+	if err := os.MkdirAll(stack, 0755); err != nil {
+		t.Fatal(err)
+	}
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(stack, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("storage.tf", `resource "aws_s3_bucket" "logs" { bucket = "logs" }`+"\n")
+	write("queue.tf", `resource "aws_sqs_queue" "jobs" { name = "jobs" }`+"\n")
+	write("unchanged.tf", `resource "aws_dynamodb_table" "state" { name = "state" }`+"\n")
+	runGit(t, repo, "init", "-q", "-b", "main")
+	runGit(t, repo, "add", "-A")
+	runGit(t, repo, "commit", "-q", "-m", "initial")
+
+	// Replace the queue with a topic and add an untracked file
+	write("queue.tf", `resource "aws_sns_topic" "jobs" { name = "jobs" }`+"\n")
+	write("lambda.tf", `resource "aws_lambda_function" "worker" { function_name = "worker" }`+"\n")
+
+	after, before, delta, err := parseChangedFiles(stack, "main")
+	if err != nil {
+		t.Fatalf("parseChangedFiles: %v", err)
+	}
+	if got := strings.Join(delta.Files, ","); got != "stacks/app/lambda.tf,stacks/app/queue.tf" {
+		t.Errorf("Unexpected changed files: %s", got)
+	}
+	var afterTypes, beforeTypes []string
+	for _, r := range after.Resources {
+		afterTypes = append(afterTypes, r.Type)
+	}
+	for _, r := range before.Resources {
+		beforeTypes = append(beforeTypes, r.Type)
+	}
+	if strings.Join(afterTypes, ",") != "aws_lambda_function,aws_sns_topic" || strings.Join(beforeTypes, ",") != "aws_sqs_queue" {
+		t.Errorf("Unexpected resources: after %v, before %v", afterTypes, beforeTypes)
+	}
+
+	computeChangeDelta(delta, before, after)
+	added, removed := strings.Join(delta.Added, "\n"), strings.Join(delta.Removed, "\n")
+	if !strings.Contains(added, "sns:CreateTopic") || !strings.Contains(added, "lambda:CreateFunction") || strings.Contains(added, "s3:CreateBucket") {
+		t.Errorf("Unexpected added grants:\n%s", added)
+	}
+	if !strings.Contains(removed, "sqs:CreateQueue") || strings.Contains(removed, "dynamodb:") {
+		t.Errorf("Unexpected removed grants:\n%s", removed)
+	}
+
+	if _, _, _, err := parseChangedFiles(stack, "no-such-ref"); err == nil {
+		t.Error("Expected an error for an unknown ref")
+	}
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/johnsidford/tf-iam-scanner/internal/cfntypes"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+	"github.com/zclconf/go-cty/cty/function/stdlib"
+	"gopkg.in/yaml.v3"
+)
+
+// fetchStackTemplatesFlag downloads the template_url of CloudFormation
+// stacks to analyze their resources (--fetch-stack-templates).
+var fetchStackTemplatesFlag bool
+
+// A CloudFormation stack creates the resources of its template with the
+// credentials of whoever creates or updates the stack, unless the stack has
+// a service role. Terraform only sees the stack, so an apply fails on the
+// first template resource the caller may not create. The scanner reads the
+// template (template_body, or template_url with --fetch-stack-templates),
+// looks up each CloudFormation type in the permissions DB, which is generated
+// from the CloudFormation handler permissions, and grants what the stack
+// creates in a statement of its own per stack, named after its address
+// (AwsCloudformationStackNetworkDownstream), on "*" since CloudFormation
+// names what it creates.
+
+// stackRoleAttributes are the attributes of the stack types naming the role
+// CloudFormation creates the template's resources with. Stack sets always
+// deploy through roles: the administration role assumes the execution role
+// in each target account.
+var stackRoleAttributes = map[string]string{
+	"aws_cloudformation_stack":     "iam_role_arn",
+	"aws_cloudformation_stack_set": "administration_role_arn",
+}
+
+// cloudFormationInternalTypes need no permissions of their own: CloudFormation
+// handles them itself. Custom:: types are invoked through their ServiceToken
+// by CloudFormation.
+var cloudFormationInternalTypes = map[string]bool{
+	"AWS::CloudFormation::CustomResource":      true,
+	"AWS::CloudFormation::WaitCondition":       true,
+	"AWS::CloudFormation::WaitConditionHandle": true,
+	"AWS::CDK::Metadata":                       true,
+}
+
+// maxStackTemplateSize is the largest template CloudFormation accepts from
+// Amazon S3.
+const maxStackTemplateSize = 1 << 20
+
+// stackTemplateClient downloads template_url templates.
+var stackTemplateClient = &http.Client{Timeout: 30 * time.Second}
+
+// fetchedStackTemplates caches downloaded templates by URL for the run.
+var fetchedStackTemplates = make(map[string]fetchedStackTemplate)
+
+type fetchedStackTemplate struct {
+	body string
+	err  error
+}
+
+// stackTemplate is what the scanner learned from the template of a stack.
+type stackTemplate struct {
+	Address string
+	// Source is the attribute the template came from, or empty when it is
+	// not known from the configuration.
+	Source string
+	// Role is the attribute naming the role the resources are created
+	// with; empty when they are created with the caller's credentials.
+	Role string
+	// Types are the CloudFormation types of the template's resources.
+	Types []string
+	// Unmapped are the types without a permissions DB entry.
+	Unmapped []string
+	// Actions are the actions the template's resources need, sorted.
+	Actions []string
+	Err     error
+}
+
+// callerCreates reports whether the stack creates its resources with the
+// caller's credentials, so they belong in the generated policy.
+func (t stackTemplate) callerCreates() bool {
+	return t.Role == "" && len(t.Actions) > 0
+}
+
+// stackTemplates analyzes the template of every CloudFormation stack and
+// stack set in result.
+func stackTemplates(result *ParseResult) []stackTemplate {
+	var templates []stackTemplate
+	for _, resource := range result.Resources {
+		if _, ok := stackRoleAttributes[resource.Type]; ok && needsAWSPermissions(resource) {
+			templates = append(templates, analyzeStackTemplate(resource))
+		}
+	}
+	return templates
+}
+
+// analyzeStackTemplate reads the template of a stack and maps its resources
+// to actions.
+func analyzeStackTemplate(resource Resource) stackTemplate {
+	template := stackTemplate{Address: resourceAddress(resource)}
+	if role := stackRoleAttributes[resource.Type]; resource.Type != "aws_cloudformation_stack" || resource.hasSetting(role) {
+		template.Role = role
+	}
+
+	var body string
+	if value, ok := knownStringAttribute(&resource, "template_body"); ok {
+		template.Source, body = "template_body", value
+	} else if url, ok := knownStringAttribute(&resource, "template_url"); ok && fetchStackTemplatesFlag {
+		template.Source = "template_url"
+		body, template.Err = fetchStackTemplate(context.Background(), url)
+	}
+	if template.Source == "" || template.Err != nil {
+		return template
+	}
+
+	template.Types, template.Err = templateResourceTypes(body)
+	actions := make(map[string]bool)
+	for _, cfnType := range template.Types {
+		if cloudFormationInternalTypes[cfnType] || strings.HasPrefix(cfnType, "Custom::") {
+			continue
+		}
+		perms := getRequiredPermissions(cfntypes.TerraformType(cfnType))
+		if len(perms) == 0 {
+			if !containsString(template.Unmapped, cfnType) {
+				template.Unmapped = append(template.Unmapped, cfnType)
+			}
+			continue
+		}
+		for _, action := range perms {
+			actions[action] = true
+		}
+	}
+	template.Actions = sortedSet(actions)
+	return template
+}
+
+// templateResourceTypes returns the Type of every resource of a JSON or YAML
+// template, in template order. YAML short forms such as !Ref and !GetAtt are
+// accepted without being evaluated.
+func templateResourceTypes(body string) ([]string, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal([]byte(body), &document); err != nil {
+		return nil, fmt.Errorf("invalid template: %w", err)
+	}
+	if len(document.Content) == 0 || document.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("invalid template: not a mapping")
+	}
+	resources := mappingValue(document.Content[0], "Resources")
+	if resources == nil || resources.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("invalid template: no Resources section")
+	}
+	var types []string
+	for i := 1; i < len(resources.Content); i += 2 {
+		if value := mappingValue(resources.Content[i], "Type"); value != nil && value.Kind == yaml.ScalarNode {
+			types = append(types, value.Value)
+		}
+	}
+	return types, nil
+}
+
+// mappingValue returns the value of key in a YAML mapping, or nil.
+func mappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	if mapping.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// prefetchStackTemplates downloads the template_url of every stack in result
+// with --fetch-stack-templates, so the downloads stop when ctx is cancelled.
+func prefetchStackTemplates(ctx context.Context, result *ParseResult) {
+	if !fetchStackTemplatesFlag {
+		return
+	}
+	for _, resource := range result.Resources {
+		if _, ok := stackRoleAttributes[resource.Type]; !ok {
+			continue
+		}
+		if _, ok := knownStringAttribute(&resource, "template_body"); ok {
+			continue
+		}
+		if url, ok := knownStringAttribute(&resource, "template_url"); ok {
+			fetchStackTemplate(ctx, url)
+		}
+	}
+}
+
+// fetchStackTemplate downloads a template_url over HTTPS. Templates in
+// private buckets need a presigned URL.
+func fetchStackTemplate(ctx context.Context, url string) (string, error) {
+	if fetched, ok := fetchedStackTemplates[url]; ok {
+		return fetched.body, fetched.err
+	}
+	body, err := downloadStackTemplate(ctx, url)
+	fetchedStackTemplates[url] = fetchedStackTemplate{body: body, err: err}
+	return body, err
+}
+
+func downloadStackTemplate(ctx context.Context, url string) (string, error) {
+	if !strings.HasPrefix(url, "https://") {
+		return "", fmt.Errorf("template_url %s is not an https:// URL", url)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", fmt.Errorf("error fetching template: %w", err)
+	}
+	resp, err := stackTemplateClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error fetching template: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("error fetching template: %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxStackTemplateSize+1))
+	if err != nil {
+		return "", fmt.Errorf("error fetching template: %w", err)
+	}
+	if len(data) > maxStackTemplateSize {
+		return "", fmt.Errorf("template is larger than %d bytes", maxStackTemplateSize)
+	}
+	return string(data), nil
+}
+
+// stackDownstreamActions returns the actions the template of resource needs
+// from the caller, for attributing them to the stack.
+func stackDownstreamActions(resource Resource) []string {
+	if _, ok := stackRoleAttributes[resource.Type]; !ok {
+		return nil
+	}
+	if template := analyzeStackTemplate(resource); template.callerCreates() {
+		return template.Actions
+	}
+	return nil
+}
+
+// stackDownstreamStatements returns a statement per stack in result that
+// creates its resources with the caller's credentials.
+func stackDownstreamStatements(result *ParseResult) []IAMStatement {
+	var statements []IAMStatement
+	for _, template := range stackTemplates(result) {
+		if !template.callerCreates() {
+			continue
+		}
+		statements = append(statements, IAMStatement{
+			Sid:      statementSid(template.Address, downstreamSidSuffix),
+			Effect:   "Allow",
+			Action:   template.Actions,
+			Resource: "*",
+		})
+	}
+	return statements
+}
+
+// printStackTemplates lists the CloudFormation stacks in the run summary:
+// what their templates add to the policy, what their roles need instead and
+// what could not be analyzed.
+func printStackTemplates(result *ParseResult) {
+	templates := stackTemplates(result)
+	if len(templates) == 0 {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "  CloudFormation stacks (template resources in *%s statements):\n", downstreamSidSuffix)
+	for _, template := range templates {
+		switch {
+		case template.Err != nil:
+			fmt.Fprintf(os.Stderr, "    %s: %s: %v\n", template.Address, template.Source, template.Err)
+			continue
+		case template.Source == "":
+			hint := "template not known from the configuration"
+			if !fetchStackTemplatesFlag {
+				hint += "; use --fetch-stack-templates for template_url"
+			}
+			fmt.Fprintf(os.Stderr, "    %s: %s\n", template.Address, hint)
+			continue
+		case template.Role != "":
+			fmt.Fprintf(os.Stderr, "    %s: %d resources created through %s, which needs %d actions (not in this policy)\n",
+				template.Address, len(template.Types), template.Role, len(template.Actions))
+		default:
+			fmt.Fprintf(os.Stderr, "    %s: %d resources, %d actions\n", template.Address, len(template.Types), len(template.Actions))
+		}
+		if len(template.Unmapped) > 0 {
+			unmapped := append([]string{}, template.Unmapped...)
+			sort.Strings(unmapped)
+			fmt.Fprintf(os.Stderr, "      not in the permissions DB: %s\n", strings.Join(unmapped, ", "))
+		}
+	}
+}
+
+// stackTemplateBody evaluates the template_body of a stack block read with
+// file(), relative to the directory of the file declaring it, as in
+// template_body = file("${path.module}/network.yaml"). It returns false when
+// the expression uses anything else that is not known from the source.
+func stackTemplateBody(block *hclsyntax.Block) (cty.Value, bool) {
+	attr, ok := block.Body.Attributes["template_body"]
+	if !ok {
+		return cty.NilVal, false
+	}
+	dir := filepath.Dir(block.DefRange().Filename)
+	ctx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"path": cty.ObjectVal(map[string]cty.Value{"module": cty.StringVal("."), "root": cty.StringVal(".")}),
+		},
+		Functions: map[string]function.Function{"jsonencode": stdlib.JSONEncodeFunc, "file": fileFunction(dir)},
+	}
+	value, diags := attr.Expr.Value(ctx)
+	if diags.HasErrors() || !value.IsWhollyKnown() || value.Type() != cty.String {
+		return cty.NilVal, false
+	}
+	return value, true
+}
+
+// fileFunction is Terraform's file() reading paths relative to dir.
+func fileFunction(dir string) function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{{Name: "path", Type: cty.String}},
+		Type:   function.StaticReturnType(cty.String),
+		Impl: func(args []cty.Value, _ cty.Type) (cty.Value, error) {
+			path := args[0].AsString()
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(dir, path)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return cty.UnknownVal(cty.String), err
+			}
+			return cty.StringVal(string(data)), nil
+		},
+	})
+}
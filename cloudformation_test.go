@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestTemplateResourceTypes(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    []string
+		wantErr string
+	}{
+		{
+			name: "yaml with short forms",
+			body: "Resources:\n  Bucket:\n    Type: AWS::S3::Bucket\n    Properties:\n      BucketName: !Sub '${AWS::StackName}-data'\n  Topic:\n    Type: AWS::SNS::Topic\n",
+			want: []string{"AWS::S3::Bucket", "AWS::SNS::Topic"},
+		},
+		{
+			name: "json",
+			body: `{"Resources": {"Queue": {"Type": "AWS::SQS::Queue"}}}`,
+			want: []string{"AWS::SQS::Queue"},
+		},
+		{name: "no resources", body: "Outputs: {}\n", wantErr: "no Resources section"},
+		{name: "not a mapping", body: "- AWS::S3::Bucket\n", wantErr: "not a mapping"},
+		{name: "malformed", body: "Resources: [", wantErr: "invalid template"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := templateResourceTypes(tt.body)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Expected an error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil || strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("templateResourceTypes() = %v, %v, want %v", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAnalyzeStackTemplate(t *testing.T) {
+	if err := loadPermissionsDB(); err != nil {
+		t.Fatalf("Error loading permissions DB: %v", err)
+	}
+
+	body := cty.StringVal(`{"Resources": {"Topic": {"Type": "AWS::SNS::Topic"}, "Hook": {"Type": "Custom::Hook"}, "Odd": {"Type": "AWS::Nope::Thing"}}}`)
+	stack := Resource{Type: "aws_cloudformation_stack", Name: "app", Provider: "aws",
+		Attributes: map[string]cty.Value{"template_body": body}}
+	template := analyzeStackTemplate(stack)
+	if template.Err != nil || !template.callerCreates() || !containsString(template.Actions, "sns:CreateTopic") {
+		t.Errorf("Expected the topic's actions for the caller, got %+v", template)
+	}
+	if strings.Join(template.Unmapped, ",") != "AWS::Nope::Thing" {
+		t.Errorf("Expected only the unknown type to be unmapped, got %v", template.Unmapped)
+	}
+
+	stack.Attributes["iam_role_arn"] = cty.StringVal("arn:aws:iam::123456789012:role/cloudformation")
+	if template := analyzeStackTemplate(stack); template.Role != "iam_role_arn" || template.callerCreates() {
+		t.Errorf("Expected a stack with a service role to leave the caller out, got %+v", template)
+	}
+
+	stackSet := Resource{Type: "aws_cloudformation_stack_set", Name: "baseline", Provider: "aws",
+		Attributes: map[string]cty.Value{"template_body": body}}
+	if template := analyzeStackTemplate(stackSet); template.Role != "administration_role_arn" || template.callerCreates() {
+		t.Errorf("Expected a stack set to deploy through its roles, got %+v", template)
+	}
+}
+
+func TestFetchStackTemplate(t *testing.T) {
+	if err := loadPermissionsDB(); err != nil {
+		t.Fatalf("Error loading permissions DB: %v", err)
+	}
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/network.yaml" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, "Resources:\n  Queue:\n    Type: AWS::SQS::Queue\n")
+	}))
+	defer server.Close()
+	client := stackTemplateClient
+	stackTemplateClient = server.Client()
+	defer func() {
+		stackTemplateClient, fetchStackTemplatesFlag = client, false
+		fetchedStackTemplates = make(map[string]fetchedStackTemplate)
+	}()
+
+	stack := Resource{Type: "aws_cloudformation_stack", Name: "queue", Provider: "aws",
+		Attributes: map[string]cty.Value{"template_url": cty.StringVal(server.URL + "/network.yaml")}}
+	if template := analyzeStackTemplate(stack); template.Source != "" {
+		t.Errorf("Expected template_url to be left alone without --fetch-stack-templates, got %+v", template)
+	}
+
+	fetchStackTemplatesFlag = true
+	if template := analyzeStackTemplate(stack); template.Err != nil || !containsString(template.Actions, "sqs:CreateQueue") {
+		t.Errorf("Expected the fetched template's actions, got %+v", template)
+	}
+	stack.Attributes["template_url"] = cty.StringVal(server.URL + "/missing.yaml")
+	if template := analyzeStackTemplate(stack); template.Err == nil || !strings.Contains(template.Err.Error(), "404") {
+		t.Errorf("Expected the download error, got %+v", template)
+	}
+	stack.Attributes["template_url"] = cty.StringVal("http://example.com/network.yaml")
+	if template := analyzeStackTemplate(stack); template.Err == nil || !strings.Contains(template.Err.Error(), "https://") {
+		t.Errorf("Expected plain HTTP to be refused, got %+v", template)
+	}
+}
+
+func TestStackDownstreamStatements(t *testing.T) {
+	if err := loadPermissionsDB(); err != nil {
+		t.Fatalf("Error loading permissions DB: %v", err)
+	}
+	result, err := parseTerraformFiles("test-fixtures/cloudformation")
+	if err != nil {
+		t.Fatalf("Error parsing fixture: %v", err)
+	}
+
+	policy := buildIAMPolicy(result, false, true)
+	var downstream []IAMStatement
+	for _, statement := range policy.Statement {
+		if strings.HasSuffix(statement.Sid, downstreamSidSuffix) {
+			downstream = append(downstream, statement)
+		}
+	}
+	if len(downstream) != 1 || downstream[0].Sid != "AwsCloudformationStackNetworkDownstream" {
+		t.Fatalf("Expected a downstream statement for the stack without a service role only, got %+v", downstream)
+	}
+	actions := toStringSlice(downstream[0].Action)
+	for _, want := range []string{"ec2:CreateVpc", "sqs:CreateQueue"} {
+		if !containsString(actions, want) {
+			t.Errorf("Expected %s from the template read with file(), got %v", want, actions)
+		}
+	}
+	if downstream[0].Resource != "*" {
+		t.Errorf("Expected the downstream statement on \"*\", got %v", downstream[0].Resource)
+	}
+}
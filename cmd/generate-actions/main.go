@@ -0,0 +1,196 @@
+// Command generate-actions builds actions.json, the catalog of IAM actions
+// used by `tf-iam-scanner lint`, from the AWS service authorization reference.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+)
+
+const (
+	serviceIndexURL = "https://servicereference.us-east-1.amazonaws.com/"
+	outputPath      = "actions.json"
+)
+
+// serviceIndexEntry is one element of the service reference index.
+type serviceIndexEntry struct {
+	Service string `json:"service"`
+	URL     string `json:"url"`
+}
+
+// serviceReference captures only the fields we need from a service document.
+type serviceReference struct {
+	Name    string `json:"Name"`
+	Actions []struct {
+		Name        string `json:"Name"`
+		Annotations struct {
+			Properties struct {
+				IsList                 bool `json:"IsList"`
+				IsPermissionManagement bool `json:"IsPermissionManagement"`
+				IsTaggingOnly          bool `json:"IsTaggingOnly"`
+				IsWrite                bool `json:"IsWrite"`
+			} `json:"Properties"`
+		} `json:"Annotations"`
+		Resources []struct {
+			Name string `json:"Name"`
+		} `json:"Resources"`
+	} `json:"Actions"`
+}
+
+// ActionEntry is the output format for a single action.
+type ActionEntry struct {
+	Access       string `json:"access"`
+	WildcardOnly bool   `json:"wildcard_only,omitempty"`
+}
+
+func main() {
+	fmt.Println("Downloading service authorization reference index...")
+	var index []serviceIndexEntry
+	if err := fetchJSON(serviceIndexURL, &index); err != nil {
+		fmt.Fprintf(os.Stderr, "Error downloading service index: %v\n", err)
+		os.Exit(1)
+	}
+
+	catalog := make(map[string]map[string]ActionEntry)
+	failed := 0
+
+	for _, entry := range index {
+		var ref serviceReference
+		if err := fetchJSON(entry.URL, &ref); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: skipping %s: %v\n", entry.Service, err)
+			failed++
+			continue
+		}
+
+		actions := make(map[string]ActionEntry, len(ref.Actions))
+		for _, action := range ref.Actions {
+			actions[action.Name] = ActionEntry{
+				Access:       accessLevel(action.Annotations.Properties.IsList, action.Annotations.Properties.IsPermissionManagement, action.Annotations.Properties.IsTaggingOnly, action.Annotations.Properties.IsWrite),
+				WildcardOnly: len(action.Resources) == 0,
+			}
+		}
+		catalog[entry.Service] = actions
+	}
+
+	if err := writeCatalog(catalog); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing output: %v\n", err)
+		os.Exit(1)
+	}
+
+	total := 0
+	for _, actions := range catalog {
+		total += len(actions)
+	}
+
+	fmt.Printf("\nSummary:\n")
+	fmt.Printf("  Services:        %d\n", len(catalog))
+	fmt.Printf("  Actions:         %d\n", total)
+	fmt.Printf("  Failed services: %d\n", failed)
+	fmt.Println()
+	fmt.Printf("Output written to: %s\n", outputPath)
+}
+
+// accessLevel maps the reference annotations to the access level names used
+// in the IAM documentation.
+func accessLevel(isList, isPermissionManagement, isTaggingOnly, isWrite bool) string {
+	switch {
+	case isPermissionManagement:
+		return "Permissions management"
+	case isTaggingOnly:
+		return "Tagging"
+	case isWrite:
+		return "Write"
+	case isList:
+		return "List"
+	}
+	return "Read"
+}
+
+func fetchJSON(url string, target interface{}) error {
+	resp, err := http.Get(url)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, target)
+}
+
+// writeCatalog writes the catalog with one action per line so the file stays
+// reviewable in diffs despite its size.
+func writeCatalog(catalog map[string]map[string]ActionEntry) error {
+	now := time.Now().UTC()
+	meta, err := json.Marshal(map[string]string{
+		"version": now.Format("2006.01.02"),
+		"date":    now.Format("2006-01-02"),
+		"source":  serviceIndexURL,
+	})
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("{\n")
+	fmt.Fprintf(&buf, "  \"_meta\": %s", spaced(meta))
+
+	services := make([]string, 0, len(catalog))
+	for service := range catalog {
+		services = append(services, service)
+	}
+	sort.Strings(services)
+
+	for _, service := range services {
+		fmt.Fprintf(&buf, ",\n  %q: {\n    \"actions\": {\n", service)
+
+		names := make([]string, 0, len(catalog[service]))
+		for name := range catalog[service] {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for i, name := range names {
+			entry, err := json.Marshal(catalog[service][name])
+			if err != nil {
+				return err
+			}
+			separator := ","
+			if i == len(names)-1 {
+				separator = ""
+			}
+			fmt.Fprintf(&buf, "      %q: %s%s\n", name, spaced(entry), separator)
+		}
+		buf.WriteString("    }\n  }")
+	}
+	buf.WriteString("\n}\n")
+
+	return os.WriteFile(outputPath, buf.Bytes(), 0644)
+}
+
+// spaced reformats compact JSON object output as {"a": 1, "b": 2}.
+func spaced(compact []byte) string {
+	var out bytes.Buffer
+	inString := false
+	for i, c := range compact {
+		out.WriteByte(c)
+		if c == '"' && (i == 0 || compact[i-1] != '\\') {
+			inString = !inString
+		}
+		if !inString && (c == ':' || c == ',') {
+			out.WriteByte(' ')
+		}
+	}
+	return out.String()
+}
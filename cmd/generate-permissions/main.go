@@ -8,10 +8,11 @@ import (
 	"io"
 	"net/http"
 	"os"
-	"regexp"
 	"sort"
 	"strings"
-	"unicode"
+	"time"
+
+	"github.com/johnsidford/tf-iam-scanner/internal/cfntypes"
 )
 
 const (
@@ -21,8 +22,8 @@ const (
 
 // Schema captures only the fields we need from each CloudFormation resource schema.
 type Schema struct {
-	TypeName          string              `json:"typeName"`
-	Handlers          map[string]struct {
+	TypeName string `json:"typeName"`
+	Handlers map[string]struct {
 		Permissions []string `json:"permissions"`
 	} `json:"handlers"`
 	PrimaryIdentifier []string `json:"primaryIdentifier"`
@@ -30,118 +31,22 @@ type Schema struct {
 
 // PermissionEntry is the output format for each Terraform resource / data source.
 type PermissionEntry struct {
-	Actions       []string `json:"actions"`
-	ResourceTypes []string `json:"resource_types"`
-}
-
-// fullTypeOverrides handles CFN types whose TF names fundamentally deviate
-// from the aws_<service>_<resource> pattern. This covers:
-//   - EC2 resources that drop the ec2_ prefix (aws_instance, aws_vpc, …)
-//   - ELB / ELBv2 resources that use the lb_ / elb_ prefix
-//   - Other known irregularities
-var fullTypeOverrides = map[string]string{
-	// EC2 — these drop the "ec2_" service prefix in Terraform
-	"AWS::EC2::Instance":             "aws_instance",
-	"AWS::EC2::VPC":                  "aws_vpc",
-	"AWS::EC2::Subnet":               "aws_subnet",
-	"AWS::EC2::SecurityGroup":        "aws_security_group",
-	"AWS::EC2::SecurityGroupEgress":  "aws_security_group_rule",
-	"AWS::EC2::SecurityGroupIngress": "aws_security_group_rule",
-	"AWS::EC2::NetworkInterface":     "aws_network_interface",
-	"AWS::EC2::EIP":                  "aws_eip",
-	"AWS::EC2::RouteTable":           "aws_route_table",
-	"AWS::EC2::InternetGateway":      "aws_internet_gateway",
-	"AWS::EC2::NatGateway":           "aws_nat_gateway",
-	"AWS::EC2::Volume":               "aws_ebs_volume",
-	"AWS::EC2::VPCEndpoint":              "aws_vpc_endpoint",
-	"AWS::EC2::VPCPeeringConnection":     "aws_vpc_peering_connection",
-	"AWS::EC2::VPNGateway":               "aws_vpn_gateway",
-	"AWS::EC2::VPNConnection":            "aws_vpn_connection",
-	"AWS::EC2::CustomerGateway":          "aws_customer_gateway",
-	"AWS::EC2::NetworkAcl":               "aws_network_acl",
-	"AWS::EC2::PlacementGroup":           "aws_placement_group",
-	"AWS::EC2::KeyPair":                  "aws_key_pair",
-	"AWS::EC2::SpotFleet":                "aws_spot_fleet_request",
-	"AWS::EC2::DHCPOptions":              "aws_vpc_dhcp_options",
-	// ELB / ELBv2 — use lb_ / elb_ prefix instead of elastic_load_balancing
-	"AWS::ElasticLoadBalancingV2::LoadBalancer": "aws_lb",
-	"AWS::ElasticLoadBalancing::LoadBalancer":    "aws_elb",
-	"AWS::ElasticLoadBalancingV2::Listener":      "aws_lb_listener",
-	"AWS::ElasticLoadBalancingV2::TargetGroup":   "aws_lb_target_group",
-	"AWS::ElasticLoadBalancingV2::ListenerRule":  "aws_lb_listener_rule",
-	// Auto Scaling
-	"AWS::AutoScaling::AutoScalingGroup":   "aws_autoscaling_group",
-	"AWS::AutoScaling::LaunchConfiguration": "aws_launch_configuration",
-	// RDS
-	"AWS::RDS::DBInstance":    "aws_db_instance",
-	"AWS::RDS::DBCluster":     "aws_rds_cluster",
-	"AWS::RDS::DBSubnetGroup": "aws_db_subnet_group",
-	// SSM
-	"AWS::SSM::Parameter": "aws_ssm_parameter",
-	// Route53
-	"AWS::Route53::RecordSet":  "aws_route53_record",
-	"AWS::Route53::HostedZone": "aws_route53_zone",
-	// CloudWatch Logs
-	"AWS::Logs::LogGroup": "aws_cloudwatch_log_group",
-	// S3 (for correctness — the algorithm also handles this)
-	"AWS::S3::Bucket": "aws_s3_bucket",
+	Actions       []string               `json:"actions"`
+	ResourceTypes []string               `json:"resource_types"`
+	ARNTemplate   string                 `json:"arn_template,omitempty"`
+	ARNTemplates  []string               `json:"arn_templates,omitempty"`
+	Companions    []CompanionPermissions `json:"companions,omitempty"`
+	Adopts        string                 `json:"adopts,omitempty"`
+	ExpandsTo     []string               `json:"expands_to,omitempty"`
+	// ReadsSecretValue marks reads of secret and parameter values
+	ReadsSecretValue bool `json:"reads_secret_value,omitempty"`
 }
 
-// serviceNameOverrides maps CFN service names to the exact Terraform provider
-// service prefix when the general camelToSnake function would produce a
-// different result. This covers acronyms that become part of the word
-// (DynamoDB→dynamodb) and other naming anomalies (ApiGatewayV2→apigatewayv2).
-var serviceNameOverrides = map[string]string{
-	"DynamoDB":          "dynamodb",
-	"OpenSearchService": "opensearch",
-	"Elasticsearch":     "elasticsearch",
-	"SecretsManager":    "secretsmanager",
-	"CertificateManager": "acm",
-	"WAFRegional":        "wafregional",
-	"WAFv2":              "wafv2",
-	"ApiGatewayV2":       "apigatewayv2",
-	"ElasticLoadBalancing": "elastic_load_balancing",
-	"AutoScaling":          "autoscaling",
-	"ElastiCache":          "elasticache",
-	"KinesisFirehose":      "kinesis_firehose",
-	"CloudFront":           "cloudfront",
-	"CloudWatch":           "cloudwatch",
-	"Redshift":             "redshift",
-	"ServiceDiscovery":     "service_discovery",
-	"StepFunctions":        "sfn",
-	"NetworkFirewall":      "networkfirewall",
-	"MediaConvert":         "media_convert",
-	"MediaStore":           "media_store",
-	"StorageGateway":       "storagegateway",
-	"CodePipeline":         "codepipeline",
-	"CodeDeploy":           "codedeploy",
-	"CodeBuild":            "codebuild",
-	"CodeCommit":           "codecommit",
-	"AppSync":              "appsync",
-	"AppMesh":              "appmesh",
-	"Pinpoint":             "pinpoint",
-	"Amplify":              "amplify",
-	"Backup":               "backup",
-	"Batch":                "batch",
-	"GuardDuty":            "guardduty",
-	"SecurityHub":          "securityhub",
-	"Inspector":            "inspector",
-	"Config":               "config",
-	"Shield":               "shield",
-	"Transfer":             "transfer",
-	"AmazonMQ":             "mq",
-	"IoT":                  "iot",
-	"Timestream":           "timestreamwrite",
-	"DocDB":                "docdb",
-	"Neptune":              "neptune",
-	"MemoryDB":             "memorydb",
-	"QLDB":                 "qldb",
-	"FSx":                  "fsx",
-	"DataSync":             "datasync",
-	"Athena":               "athena",
-	"Glue":                 "glue",
-	"Events":               "cloudwatch_event",
-	"AutoScalingPlans":     "autoscalingplans",
+// CompanionPermissions are hand-curated conditional actions; see the type of
+// the same name in the scanner.
+type CompanionPermissions struct {
+	When    string   `json:"when,omitempty"`
+	Actions []string `json:"actions"`
 }
 
 // terraformSpecifics defines Terraform-only resources / data sources that have
@@ -167,22 +72,184 @@ var terraformSpecifics = map[string]PermissionEntry{
 		Actions:       []string{},
 		ResourceTypes: []string{},
 	},
+	"ephemeral.aws_cognito_identity_openid_token_for_developer_identity": {
+		Actions:       []string{"cognito-identity:GetOpenIdTokenForDeveloperIdentity"},
+		ResourceTypes: []string{"identity_pool"},
+	},
+	"ephemeral.aws_eks_cluster_auth": {
+		Actions:       []string{},
+		ResourceTypes: []string{},
+	},
+	"ephemeral.aws_kms_secrets": {
+		Actions:       []string{"kms:Decrypt"},
+		ResourceTypes: []string{},
+	},
+	"ephemeral.aws_lambda_invocation": {
+		Actions:       []string{"lambda:InvokeFunction"},
+		ResourceTypes: []string{"function_name"},
+	},
+	"ephemeral.aws_secretsmanager_random_password": {
+		Actions:       []string{"secretsmanager:GetRandomPassword"},
+		ResourceTypes: []string{},
+	},
+	"ephemeral.aws_secretsmanager_secret_version": {
+		Actions:          []string{"secretsmanager:DescribeSecret", "secretsmanager:GetSecretValue"},
+		ResourceTypes:    []string{"secret"},
+		ReadsSecretValue: true,
+	},
+	"ephemeral.aws_ssm_parameter": {
+		Actions:          []string{"ssm:GetParameter"},
+		ResourceTypes:    []string{"parameter"},
+		ReadsSecretValue: true,
+	},
+	"data.aws_secretsmanager_secret_version": {
+		Actions:          []string{"secretsmanager:GetSecretValue"},
+		ResourceTypes:    []string{"secret"},
+		ReadsSecretValue: true,
+	},
+	"data.aws_ssm_parameters_by_path": {
+		Actions:          []string{"ssm:GetParametersByPath"},
+		ResourceTypes:    []string{"parameter"},
+		ReadsSecretValue: true,
+	},
 	"data.aws_kms_secrets": {
 		Actions:       []string{"kms:Decrypt"},
 		ResourceTypes: []string{},
 	},
-	"data.aws_subnet_ids": {
+	"data.aws_subnets": {
 		Actions:       []string{"ec2:DescribeSubnets"},
 		ResourceTypes: []string{},
 	},
-	"aws_s3_bucket_object": {
+	// Companion resources split out of aws_s3_bucket in provider v4
+	"aws_s3_bucket_acl": {
+		Actions:       []string{"s3:GetBucketAcl", "s3:PutBucketAcl"},
+		ResourceTypes: []string{"bucket"},
+	},
+	"aws_s3_bucket_cors_configuration": {
+		Actions:       []string{"s3:GetBucketCORS", "s3:PutBucketCORS"},
+		ResourceTypes: []string{"bucket"},
+	},
+	"aws_s3_bucket_lifecycle_configuration": {
+		Actions:       []string{"s3:GetLifecycleConfiguration", "s3:PutLifecycleConfiguration"},
+		ResourceTypes: []string{"bucket"},
+	},
+	"aws_s3_bucket_logging": {
+		Actions:       []string{"s3:GetBucketLogging", "s3:PutBucketLogging"},
+		ResourceTypes: []string{"bucket"},
+	},
+	"aws_s3_bucket_notification": {
+		Actions:       []string{"s3:GetBucketNotification", "s3:PutBucketNotification"},
+		ResourceTypes: []string{"bucket"},
+	},
+	"aws_s3_bucket_ownership_controls": {
+		Actions:       []string{"s3:GetBucketOwnershipControls", "s3:PutBucketOwnershipControls"},
+		ResourceTypes: []string{"bucket"},
+	},
+	"aws_s3_bucket_public_access_block": {
+		Actions:       []string{"s3:GetBucketPublicAccessBlock", "s3:PutBucketPublicAccessBlock"},
+		ResourceTypes: []string{"bucket"},
+	},
+	"aws_s3_bucket_replication_configuration": {
+		Actions:       []string{"iam:PassRole", "s3:GetReplicationConfiguration", "s3:PutReplicationConfiguration"},
+		ResourceTypes: []string{"bucket"},
+		ARNTemplate:   "arn:${partition}:s3:::${bucket}",
+	},
+	"aws_s3_bucket_server_side_encryption_configuration": {
+		Actions:       []string{"s3:GetEncryptionConfiguration", "s3:PutEncryptionConfiguration"},
+		ResourceTypes: []string{"bucket"},
+	},
+	"aws_s3_bucket_versioning": {
+		Actions:       []string{"s3:GetBucketVersioning", "s3:PutBucketVersioning"},
+		ResourceTypes: []string{"bucket"},
+	},
+	"aws_s3_bucket_website_configuration": {
+		Actions:       []string{"s3:DeleteBucketWebsite", "s3:GetBucketWebsite", "s3:PutBucketWebsite"},
+		ResourceTypes: []string{"bucket"},
+	},
+	"aws_s3_object": {
 		Actions:       []string{"s3:PutObject", "s3:GetObject", "s3:DeleteObject", "s3:ListBucket"},
-		ResourceTypes: []string{},
+		ResourceTypes: []string{"key"},
 	},
-	"data.aws_s3_bucket_object": {
+	"data.aws_s3_object": {
 		Actions:       []string{"s3:GetObject", "s3:ListBucket"},
 		ResourceTypes: []string{},
 	},
+	"aws_iam_role_policy_attachment": {
+		Actions:       []string{"iam:AttachRolePolicy", "iam:DetachRolePolicy", "iam:ListAttachedRolePolicies"},
+		ResourceTypes: []string{"role"},
+	},
+	// Global table replica managed apart from its table; the replica's own
+	// Region is the provider's
+	"aws_dynamodb_table_replica": {
+		Actions: []string{"dynamodb:CreateTableReplica", "dynamodb:DeleteTableReplica", "dynamodb:DescribeContinuousBackups",
+			"dynamodb:DescribeTable", "dynamodb:ListTagsOfResource", "dynamodb:TagResource", "dynamodb:UntagResource",
+			"dynamodb:UpdateContinuousBackups", "dynamodb:UpdateTable"},
+		ResourceTypes: []string{"global_table_arn"},
+	},
+	// Deploys a Serverless Application Repository application as a
+	// CloudFormation stack; the stack's resources are created with the
+	// caller's credentials
+	"aws_serverlessapplicationrepository_cloudformation_stack": {
+		Actions: []string{"cloudformation:DeleteStack", "cloudformation:DescribeChangeSet", "cloudformation:DescribeStacks",
+			"cloudformation:ExecuteChangeSet", "cloudformation:GetTemplate", "cloudformation:UpdateStack",
+			"serverlessrepo:CreateCloudFormationChangeSet", "serverlessrepo:CreateCloudFormationTemplate",
+			"serverlessrepo:GetApplication", "serverlessrepo:GetCloudFormationTemplate"},
+		ResourceTypes: []string{"stack"},
+		ARNTemplate:   "arn:${partition}:cloudformation:${region}:${account}:stack/serverlessrepo-${name}/*",
+		ExpandsTo: []string{"apigateway:DELETE", "apigateway:GET", "apigateway:PATCH", "apigateway:POST", "apigateway:PUT",
+			"iam:AttachRolePolicy", "iam:CreateRole", "iam:DeleteRole", "iam:DeleteRolePolicy", "iam:DetachRolePolicy",
+			"iam:GetRole", "iam:PassRole", "iam:PutRolePolicy", "iam:TagRole", "lambda:AddPermission", "lambda:CreateFunction",
+			"lambda:DeleteFunction", "lambda:GetFunction", "lambda:RemovePermission", "lambda:TagResource",
+			"lambda:UpdateFunctionCode", "lambda:UpdateFunctionConfiguration", "logs:CreateLogGroup", "logs:DeleteLogGroup"},
+	},
+	// Resources that adopt the default networking AWS creates in each region:
+	// they modify the existing resource and never create or delete the
+	// adopted type, except on destroy when force_destroy is set
+	"aws_default_vpc": {
+		Actions: []string{"ec2:CreateDefaultVpc", "ec2:CreateTags", "ec2:DeleteTags", "ec2:DescribeNetworkAcls",
+			"ec2:DescribeRouteTables", "ec2:DescribeSecurityGroups", "ec2:DescribeVpcAttribute", "ec2:DescribeVpcs", "ec2:ModifyVpcAttribute"},
+		ResourceTypes: []string{"vpc_id"},
+		Companions: []CompanionPermissions{
+			{When: "force_destroy", Actions: []string{"ec2:DeleteVpc"}},
+			{When: "assign_generated_ipv6_cidr_block", Actions: []string{"ec2:AssociateVpcCidrBlock", "ec2:DisassociateVpcCidrBlock"}},
+		},
+		Adopts: "aws_vpc",
+	},
+	"aws_default_subnet": {
+		Actions:       []string{"ec2:CreateDefaultSubnet", "ec2:CreateTags", "ec2:DeleteTags", "ec2:DescribeSubnets", "ec2:ModifySubnetAttribute"},
+		ResourceTypes: []string{"subnet_id"},
+		Companions: []CompanionPermissions{
+			{When: "force_destroy", Actions: []string{"ec2:DeleteSubnet"}},
+			{When: "ipv6_cidr_block", Actions: []string{"ec2:AssociateSubnetCidrBlock", "ec2:DisassociateSubnetCidrBlock"}},
+		},
+		Adopts: "aws_subnet",
+	},
+	"aws_default_security_group": {
+		Actions: []string{"ec2:AuthorizeSecurityGroupEgress", "ec2:AuthorizeSecurityGroupIngress", "ec2:CreateTags", "ec2:DeleteTags",
+			"ec2:DescribeSecurityGroupRules", "ec2:DescribeSecurityGroups", "ec2:RevokeSecurityGroupEgress", "ec2:RevokeSecurityGroupIngress",
+			"ec2:UpdateSecurityGroupRuleDescriptionsEgress", "ec2:UpdateSecurityGroupRuleDescriptionsIngress"},
+		ResourceTypes: []string{"security_group"},
+		Adopts:        "aws_security_group",
+	},
+	"aws_default_route_table": {
+		Actions:       []string{"ec2:CreateRoute", "ec2:CreateTags", "ec2:DeleteRoute", "ec2:DeleteTags", "ec2:DescribeRouteTables", "ec2:ReplaceRoute"},
+		ResourceTypes: []string{"route_table_id"},
+		Companions: []CompanionPermissions{
+			{When: "propagating_vgws", Actions: []string{"ec2:DisableVgwRoutePropagation", "ec2:EnableVgwRoutePropagation"}},
+		},
+		Adopts: "aws_route_table",
+	},
+	"aws_default_network_acl": {
+		Actions: []string{"ec2:CreateNetworkAclEntry", "ec2:CreateTags", "ec2:DeleteNetworkAclEntry", "ec2:DeleteTags",
+			"ec2:DescribeNetworkAcls", "ec2:ReplaceNetworkAclAssociation", "ec2:ReplaceNetworkAclEntry"},
+		ResourceTypes: []string{"network_acl"},
+		Adopts:        "aws_network_acl",
+	},
+	"aws_default_vpc_dhcp_options": {
+		Actions:       []string{"ec2:CreateTags", "ec2:DeleteTags", "ec2:DescribeDhcpOptions", "ec2:DescribeVpcs"},
+		ResourceTypes: []string{"dhcp_options_id"},
+		Adopts:        "aws_vpc_dhcp_options",
+	},
 }
 
 func main() {
@@ -241,7 +308,7 @@ func main() {
 			continue
 		}
 
-		tfType := cfnToTerraformType(schema.TypeName)
+		tfType := cfntypes.TerraformType(schema.TypeName)
 		if tfType == "" {
 			skipped++
 			continue
@@ -278,7 +345,14 @@ func main() {
 	// Add Terraform-specific entries not covered by any CFN schema.
 	addTerraformSpecifics(permissions)
 
-	if err := writeOutput(permissions); err != nil {
+	// Carry over hand-maintained ARN templates, companions and aliases from
+	// the existing file.
+	aliases, err := preserveCuratedFields(permissions, outputPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: could not preserve curated fields: %v\n", err)
+	}
+
+	if err := writeOutput(permissions, aliases); err != nil {
 		fmt.Fprintf(os.Stderr, "Error writing output: %v\n", err)
 		os.Exit(1)
 	}
@@ -320,18 +394,39 @@ func readSchemaFromZip(f *zip.File) (*Schema, error) {
 	return &schema, nil
 }
 
+// dbMeta is written under the "_meta" key so the scanner can report which
+// revision of the database is embedded. The version is the generation date.
+type dbMeta struct {
+	Version string `json:"version"`
+	Date    string `json:"date"`
+}
+
 // writeOutput encodes the permissions map as indented JSON and writes it to
-// the output path.
-func writeOutput(permissions map[string]PermissionEntry) error {
+// the output path, stamped with the generation date. aliases, the "_aliases"
+// table of renamed types, is written when not empty.
+func writeOutput(permissions map[string]PermissionEntry, aliases map[string]string) error {
 	outFile, err := os.Create(outputPath)
 	if err != nil {
 		return err
 	}
 	defer func() { _ = outFile.Close() }()
 
+	now := time.Now().UTC()
+	document := make(map[string]interface{}, len(permissions)+1)
+	for key, entry := range permissions {
+		document[key] = entry
+	}
+	document["_meta"] = dbMeta{
+		Version: now.Format("2006.01.02"),
+		Date:    now.Format("2006-01-02"),
+	}
+	if len(aliases) > 0 {
+		document["_aliases"] = aliases
+	}
+
 	encoder := json.NewEncoder(outFile)
 	encoder.SetIndent("", "  ")
-	return encoder.Encode(permissions)
+	return encoder.Encode(document)
 }
 
 // addTerraformSpecifics inserts Terraform-only entries that have no
@@ -344,125 +439,61 @@ func addTerraformSpecifics(permissions map[string]PermissionEntry) {
 	}
 }
 
-// ---------------------------------------------------------------------------
-// CFN → Terraform type conversion
-// ---------------------------------------------------------------------------
-
-// cfnToTerraformType converts a CloudFormation type name (e.g. "AWS::S3::Bucket")
-// to its Terraform AWS provider equivalent (e.g. "aws_s3_bucket").
-//
-// It first consults the fullTypeOverrides map for known deviations from the
-// general pattern, then falls back to the algorithmic conversion:
-//
-//	aws_<service>_<resource>
-//
-// The CamelCase-to-snake_case conversion handles multi-word identifiers,
-// acronyms, and version suffixes.
-func cfnToTerraformType(cfnType string) string {
-	// Check full-type overrides first (fundamental pattern deviations).
-	if tf, ok := fullTypeOverrides[cfnType]; ok {
-		return tf
+// preserveCuratedFields copies arn_template, arn_templates, companions,
+// adopts, expands_to and reads_secret_value values and "service.<prefix>"
+// default-ARN entries from the current output file at path into the
+// regenerated map, and returns its "_aliases" table. These are curated by
+// hand and have no CloudFormation source. Entries under an alias name are
+// dropped: the scanner resolves them to the current name.
+func preserveCuratedFields(permissions map[string]PermissionEntry, path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
 	}
-
-	parts := strings.Split(cfnType, "::")
-	if len(parts) != 3 {
-		return ""
+	if err != nil {
+		return nil, err
 	}
 
-	service := parts[1]
-	resource := parts[2]
-
-	svcName := convertServiceName(service)
-	resName := convertResourceName(resource)
-
-	return fmt.Sprintf("aws_%s_%s", svcName, resName)
-}
-
-// convertServiceName converts a CFN service name to the Terraform-appropriate
-// snake_case form. It checks the serviceNameOverrides map first, then falls
-// back to camelToSnake with version-suffix merging.
-func convertServiceName(s string) string {
-	if tf, ok := serviceNameOverrides[s]; ok {
-		return tf
+	var document map[string]json.RawMessage
+	if err := json.Unmarshal(data, &document); err != nil {
+		return nil, err
 	}
-
-	result := camelToSnake(s)
-
-	// Merge trailing version suffixes: _v2 → v2, _V3 → v3, etc.
-	// This handles services like ElasticLoadBalancingV2, WAFv2, etc.
-	re := regexp.MustCompile(`_v(\d+)$`)
-	if m := re.FindStringSubmatch(result); m != nil {
-		suffix := "v" + m[1]
-		result = strings.TrimSuffix(result, "_"+suffix) + suffix
+	var aliases map[string]string
+	if raw, ok := document["_aliases"]; ok {
+		if err := json.Unmarshal(raw, &aliases); err != nil {
+			return nil, err
+		}
 	}
-
-	return result
-}
-
-// convertResourceName converts a CFN resource name to its Terraform
-// snake_case form.
-func convertResourceName(s string) string {
-	return camelToSnake(s)
-}
-
-// camelToSnake converts a CamelCase identifier to snake_case.
-//
-// Examples:
-//
-//	RestApi           → rest_api
-//	DBInstance        → db_instance
-//	IAMRole           → iam_role
-//	DynamoDB          → dynamo_db  (use serviceNameOverrides for dynamodb)
-//	S3                → s3
-//	S3Bucket          → s3_bucket
-//	ApiGatewayV2      → api_gateway_v2 (caller merges _v2 suffix)
-func camelToSnake(s string) string {
-	if s == "" {
-		return ""
+	for alias := range aliases {
+		delete(permissions, alias)
 	}
 
-	var buf strings.Builder
-	runes := []rune(s)
-	i := 0
-
-	for i < len(runes) {
-		// ---- multi-character uppercase acronym, e.g. "DB" in "DBInstance" ----
-		if i+1 < len(runes) && unicode.IsUpper(runes[i]) && unicode.IsUpper(runes[i+1]) {
-			end := i + 1
-			for end < len(runes) && unicode.IsUpper(runes[end]) {
-				end++
-			}
-			// If the acronym is followed by a lowercase letter, the last
-			// uppercase belongs to the next word: "DBInstance" → DB | Instance
-			if end < len(runes) && unicode.IsLower(runes[end]) {
-				end--
-			}
-			if end > i {
-				if buf.Len() > 0 {
-					buf.WriteByte('_')
-				}
-				buf.WriteString(strings.ToLower(string(runes[i:end])))
-				i = end
-				continue
-			}
+	for key, raw := range document {
+		if key == "_meta" || key == "_aliases" {
+			continue
 		}
-
-		// ---- single uppercase letter ----
-		if unicode.IsUpper(runes[i]) {
-			if buf.Len() > 0 {
-				buf.WriteByte('_')
-			}
-			buf.WriteRune(unicode.ToLower(runes[i]))
-			i++
+		var entry PermissionEntry
+		if err := json.Unmarshal(raw, &entry); err != nil {
+			return nil, err
+		}
+		if entry.ARNTemplate == "" && len(entry.ARNTemplates) == 0 && len(entry.Companions) == 0 && entry.Adopts == "" && len(entry.ExpandsTo) == 0 && !entry.ReadsSecretValue {
 			continue
 		}
-
-		// ---- anything else (lowercase, digits) ----
-		buf.WriteRune(runes[i])
-		i++
+		if strings.HasPrefix(key, "service.") {
+			permissions[key] = entry
+			continue
+		}
+		if current, ok := permissions[key]; ok {
+			current.ARNTemplate = entry.ARNTemplate
+			current.ARNTemplates = entry.ARNTemplates
+			current.Companions = entry.Companions
+			current.Adopts = entry.Adopts
+			current.ExpandsTo = entry.ExpandsTo
+			current.ReadsSecretValue = entry.ReadsSecretValue
+			permissions[key] = current
+		}
 	}
-
-	return buf.String()
+	return aliases, nil
 }
 
 // ---------------------------------------------------------------------------
@@ -533,14 +564,14 @@ func extractResourceTypes(schema *Schema) []string {
 		// Some schemas prefix the property with "$".
 		last = strings.TrimPrefix(last, "$")
 		if last != "" && !isGenericIdentifier(last) {
-			return []string{camelToSnake(last)}
+			return []string{cfntypes.CamelToSnake(last)}
 		}
 	}
 
 	// Fallback: use the resource part of the CFN type name.
 	parts := strings.Split(schema.TypeName, "::")
 	if len(parts) == 3 && parts[2] != "" {
-		return []string{camelToSnake(parts[2])}
+		return []string{cfntypes.CamelToSnake(parts[2])}
 	}
 
 	return []string{}
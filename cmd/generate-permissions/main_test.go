@@ -0,0 +1,48 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestPreserveCuratedFields(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "permissions.json")
+	current := `{
+  "_meta": {"version": "2026.01.01"},
+  "_aliases": {"aws_old_queue": "aws_sqs_queue"},
+  "aws_sqs_queue": {"actions": ["sqs:CreateQueue"], "resource_types": ["queue"], "arn_template": "arn:${partition}:sqs:${region}:${account}:${name}"},
+  "aws_lb_listener": {"actions": ["elasticloadbalancing:CreateListener"], "resource_types": ["listener"], "arn_templates": ["arn:${partition}:elasticloadbalancing:${region}:${account}:listener/app/*"]},
+  "aws_s3_bucket": {"actions": ["s3:CreateBucket"], "resource_types": ["bucket"]}
+}`
+	if err := os.WriteFile(path, []byte(current), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The regenerated entries carry none of the curated fields
+	permissions := map[string]PermissionEntry{
+		"aws_sqs_queue":   {Actions: []string{"sqs:CreateQueue", "sqs:DeleteQueue"}, ResourceTypes: []string{"queue"}},
+		"aws_lb_listener": {Actions: []string{"elasticloadbalancing:CreateListener"}, ResourceTypes: []string{"listener"}},
+		"aws_s3_bucket":   {Actions: []string{"s3:CreateBucket"}, ResourceTypes: []string{"bucket"}},
+		"aws_old_queue":   {Actions: []string{"sqs:CreateQueue"}},
+	}
+	aliases, err := preserveCuratedFields(permissions, path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if aliases["aws_old_queue"] != "aws_sqs_queue" {
+		t.Errorf("Expected the aliases to be returned, got %v", aliases)
+	}
+	if _, ok := permissions["aws_old_queue"]; ok {
+		t.Error("Expected the entry under an alias name to be dropped")
+	}
+	if got := permissions["aws_sqs_queue"]; got.ARNTemplate == "" || len(got.Actions) != 2 {
+		t.Errorf("Expected the arn_template kept with the regenerated actions, got %+v", got)
+	}
+	want := []string{"arn:${partition}:elasticloadbalancing:${region}:${account}:listener/app/*"}
+	if got := permissions["aws_lb_listener"].ARNTemplates; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected an entry curated with only arn_templates to keep them, got %v", got)
+	}
+}
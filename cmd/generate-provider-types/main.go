@@ -0,0 +1,149 @@
+// Command generate-provider-types builds provider-types.json, the list of
+// resources and data sources of the Terraform AWS provider used by
+// `tf-iam-scanner db coverage`. The names are taken from the provider's
+// documentation pages (website/docs/r and website/docs/d) in the source
+// archive served by the Go module proxy.
+//
+// Usage: go run cmd/generate-provider-types/main.go [git ref, default main]
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	moduleProxyURL = "https://proxy.golang.org/github.com/hashicorp/terraform-provider-aws/@v/"
+	outputPath     = "provider-types.json"
+)
+
+// moduleInfo is the response of the module proxy's .info endpoint.
+type moduleInfo struct {
+	Version string `json:"Version"`
+	Origin  struct {
+		Hash string `json:"Hash"`
+	} `json:"Origin"`
+}
+
+func main() {
+	ref := "main"
+	if len(os.Args) > 1 {
+		ref = os.Args[1]
+	}
+
+	fmt.Printf("Resolving terraform-provider-aws@%s...\n", ref)
+	var info moduleInfo
+	if err := fetchJSON(moduleProxyURL+ref+".info", &info); err != nil {
+		fmt.Fprintf(os.Stderr, "Error resolving %s: %v\n", ref, err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Downloading source archive %s...\n", info.Version)
+	zipData, err := fetch(moduleProxyURL + info.Version + ".zip")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error downloading source archive: %v\n", err)
+		os.Exit(1)
+	}
+	zipReader, err := zip.NewReader(bytes.NewReader(zipData), int64(len(zipData)))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening zip archive: %v\n", err)
+		os.Exit(1)
+	}
+
+	var resources, dataSources []string
+	providerVersion := ""
+	prefix := "@" + info.Version + "/"
+	for _, f := range zipReader.File {
+		// Entries are prefixed with module@version/
+		_, name, ok := strings.Cut(f.Name, prefix)
+		if !ok {
+			continue
+		}
+		switch {
+		case name == "version/VERSION":
+			data, err := readZipFile(f)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", name, err)
+				os.Exit(1)
+			}
+			providerVersion = strings.TrimSpace(string(data))
+		case path.Dir(name) == "website/docs/r":
+			resources = append(resources, typeFromDocPage(name))
+		case path.Dir(name) == "website/docs/d":
+			dataSources = append(dataSources, typeFromDocPage(name))
+		}
+	}
+	sort.Strings(resources)
+	sort.Strings(dataSources)
+
+	output := map[string]interface{}{
+		"_meta": map[string]string{
+			"provider_version": providerVersion,
+			"commit":           info.Origin.Hash,
+			"date":             time.Now().UTC().Format("2006-01-02"),
+		},
+		"resources":    resources,
+		"data_sources": dataSources,
+	}
+	data, err := json.MarshalIndent(output, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error marshaling output: %v\n", err)
+		os.Exit(1)
+	}
+	if err := os.WriteFile(outputPath, append(data, '\n'), 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing %s: %v\n", outputPath, err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Wrote %s: provider %s, %d resources, %d data sources\n",
+		outputPath, providerVersion, len(resources), len(dataSources))
+}
+
+// typeFromDocPage turns a documentation page such as
+// website/docs/r/s3_bucket.html.markdown into the type name aws_s3_bucket.
+func typeFromDocPage(name string) string {
+	base := path.Base(name)
+	if i := strings.Index(base, "."); i >= 0 {
+		base = base[:i]
+	}
+	return "aws_" + base
+}
+
+func readZipFile(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rc.Close() }()
+	return io.ReadAll(rc)
+}
+
+func fetchJSON(url string, v interface{}) error {
+	data, err := fetch(url)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func fetch(url string) ([]byte, error) {
+	client := &http.Client{Timeout: 10 * time.Minute}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
@@ -0,0 +1,25 @@
+package main
+
+import "fmt"
+
+var (
+	compactFlag      bool
+	documentOnlyFlag bool
+)
+
+// validateShapeFlags checks that --compact and --document-only are used with
+// the format whose output they reshape.
+func validateShapeFlags(format OutputFormat) error {
+	if compactFlag && format != FormatJSON {
+		return fmt.Errorf("--compact needs --format json, not %s", format)
+	}
+	if documentOnlyFlag {
+		if format != FormatTerraform {
+			return fmt.Errorf("--document-only needs --format terraform, not %s", format)
+		}
+		if attachToRoleFlag != "" {
+			return fmt.Errorf("--document-only cannot be used with --attach-to-role, which needs the policy resources")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCompactJSON(t *testing.T) {
+	defer func() { compactFlag = false }()
+	compactFlag = true
+	policy := IAMPolicy{Version: defaultPolicyVersion, Statement: []IAMStatement{{Effect: "Allow", Action: []string{"s3:GetObject"}, Resource: "*"}}}
+	out, err := formatPolicy(policy, &ParseResult{}, FormatJSON)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":["s3:GetObject"],"Resource":"*"}]}`
+	if out != want {
+		t.Errorf("Expected %s, got %s", want, out)
+	}
+	if len(out) != policySize(policy) {
+		t.Errorf("Compact output should be exactly the policy size, got %d for %d", len(out), policySize(policy))
+	}
+}
+
+func TestDocumentOnlyTerraform(t *testing.T) {
+	defer func() { documentOnlyFlag = false }()
+	documentOnlyFlag = true
+	policy := IAMPolicy{Version: defaultPolicyVersion, Statement: []IAMStatement{{Effect: "Allow", Action: []string{"s3:GetObject"}, Resource: "*"}}}
+	out, err := formatPolicy(policy, &ParseResult{}, FormatTerraform)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(out, `data "aws_iam_policy_document" "generated"`) || strings.Contains(out, "resource ") {
+		t.Errorf("Expected only the policy document, got:\n%s", out)
+	}
+}
+
+func TestValidateShapeFlags(t *testing.T) {
+	defer func() { compactFlag, documentOnlyFlag, attachToRoleFlag = false, false, "" }()
+	compactFlag = true
+	if err := validateShapeFlags(FormatYAML); err == nil {
+		t.Errorf("Expected --compact to need the json format")
+	}
+	if err := validateShapeFlags(FormatJSON); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	compactFlag, documentOnlyFlag = false, true
+	if err := validateShapeFlags(FormatJSON); err == nil {
+		t.Errorf("Expected --document-only to need the terraform format")
+	}
+	attachToRoleFlag = "deployer"
+	if err := validateShapeFlags(FormatTerraform); err == nil {
+		t.Errorf("Expected --document-only to conflict with --attach-to-role")
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import "strings"
+
+// resourceGroup is a resource type together with the companion types the AWS
+// provider split out of it, each of which configures one aspect of a parent
+// it refers to, e.g. aws_s3_bucket_versioning of an aws_s3_bucket.
+type resourceGroup struct {
+	Parent     string
+	Companions []string
+	Reason     string
+}
+
+// resourceGroups are the groups recognized in the reference graph.
+var resourceGroups = []resourceGroup{
+	{
+		Parent: "aws_s3_bucket",
+		Companions: []string{
+			"aws_s3_bucket_acl",
+			"aws_s3_bucket_cors_configuration",
+			"aws_s3_bucket_lifecycle_configuration",
+			"aws_s3_bucket_logging",
+			"aws_s3_bucket_notification",
+			"aws_s3_bucket_ownership_controls",
+			"aws_s3_bucket_policy",
+			"aws_s3_bucket_public_access_block",
+			"aws_s3_bucket_replication_configuration",
+			"aws_s3_bucket_server_side_encryption_configuration",
+			"aws_s3_bucket_versioning",
+			"aws_s3_bucket_website_configuration",
+		},
+		Reason: "configures the bucket",
+	},
+}
+
+// companionPermission returns the permission a companion resource needs on
+// the parent it refers to: its own actions of the parent's service, scoped
+// to the parent's primary ARN. A companion's bucket attribute usually holds
+// a reference such as aws_s3_bucket.logs.id, which renders as "*" in the
+// companion's own ARN template; the parent's ARN is the one it resolves to.
+// Wildcard-only actions are left out, they are never scoped.
+func companionPermission(resource Resource, own []string, target Resource) (inferredPermission, bool) {
+	for _, group := range resourceGroups {
+		if target.Type != group.Parent || !containsString(group.Companions, resource.Type) {
+			continue
+		}
+		template := permissionsDB[group.Parent].ARNTemplate
+		if template == "" {
+			return inferredPermission{}, false
+		}
+		service := arnTemplateService(template)
+
+		var actions []string
+		for _, action := range own {
+			if strings.SplitN(action, ":", 2)[0] == service && !isWildcardOnlyAction(action) {
+				actions = append(actions, action)
+			}
+		}
+		if len(actions) == 0 {
+			return inferredPermission{}, false
+		}
+		return inferredPermission{
+			Address: resourceAddress(resource),
+			Target:  resourceAddress(target),
+			Actions: actions,
+			ARNs:    []string{renderARNTemplate(template, &target, defaultARNContext)},
+			Reason:  group.Reason,
+		}, true
+	}
+	return inferredPermission{}, false
+}
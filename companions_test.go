@@ -0,0 +1,85 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestBucketCompanionsScopedToBucket(t *testing.T) {
+	if err := loadPermissionsDB(); err != nil {
+		t.Fatalf("Error loading permissions DB: %v", err)
+	}
+
+	result := &ParseResult{
+		Resources: []Resource{
+			{Type: "aws_s3_bucket", Name: "logs", Provider: "aws",
+				Attributes: map[string]cty.Value{"bucket": cty.StringVal("app-logs")}},
+			{Type: "aws_s3_bucket_versioning", Name: "logs", Provider: "aws",
+				Attributes: map[string]cty.Value{"bucket": cty.UnknownVal(cty.String)},
+				References: []string{"aws_s3_bucket.logs"}},
+			{Type: "aws_s3_bucket_policy", Name: "logs", Provider: "aws",
+				Attributes: map[string]cty.Value{"bucket": cty.UnknownVal(cty.String)},
+				References: []string{"aws_s3_bucket.logs"}},
+			{Type: "aws_s3_bucket_public_access_block", Name: "logs", Provider: "aws",
+				Attributes: map[string]cty.Value{"bucket": cty.UnknownVal(cty.String)},
+				References: []string{"aws_s3_bucket.logs"}},
+		},
+	}
+
+	policy := buildIAMPolicy(result, false, true)
+	var found bool
+	for _, statement := range policy.Statement {
+		actions := toStringSlice(statement.Action)
+		if containsString(actions, "s3:ListAllMyBuckets") {
+			if statement.Sid != wildcardOnlySid {
+				t.Errorf("Expected s3:ListAllMyBuckets in the wildcard-only statement, got %+v", statement)
+			}
+			continue
+		}
+		if !containsString(actions, "s3:PutBucketVersioning") {
+			continue
+		}
+		found = true
+		for _, action := range []string{"s3:PutBucketPolicy", "s3:PutBucketPublicAccessBlock"} {
+			if !containsString(actions, action) {
+				t.Errorf("Expected %s in the s3 statement, got %v", action, actions)
+			}
+		}
+		for _, arn := range toStringSlice(statement.Resource) {
+			if arn != "arn:aws:s3:::app-logs" && arn != "arn:aws:s3:::app-logs/*" {
+				t.Errorf("Expected s3 scoped to the bucket, got %v", statement.Resource)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("No s3 statement in %+v", policy.Statement)
+	}
+}
+
+func TestCompanionWithoutParentKeepsOwnTemplate(t *testing.T) {
+	if err := loadPermissionsDB(); err != nil {
+		t.Fatalf("Error loading permissions DB: %v", err)
+	}
+
+	result := &ParseResult{
+		Resources: []Resource{
+			{Type: "aws_s3_bucket_versioning", Name: "existing", Provider: "aws",
+				Attributes: map[string]cty.Value{"bucket": cty.StringVal("legacy-bucket")}},
+		},
+	}
+	if inferred := inferReferencePermissions(result); len(inferred) != 0 {
+		t.Errorf("Expected no inferences without a referenced bucket, got %+v", inferred)
+	}
+
+	policy := buildIAMPolicy(result, false, true)
+	for _, statement := range policy.Statement {
+		if containsString(toStringSlice(statement.Action), "s3:PutBucketVersioning") {
+			if statement.Resource != "arn:aws:s3:::legacy-bucket" {
+				t.Errorf("Expected the companion's own bucket ARN, got %v", statement.Resource)
+			}
+			return
+		}
+	}
+	t.Errorf("No s3 statement in %+v", policy.Statement)
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"strings"
+)
+
+var compressActionsFlag bool
+
+// compressActions shrinks a policy over limit characters without granting
+// access of a new kind: statements on the same resources are merged, then,
+// service by service until the policy fits, the actions sharing a verb are
+// collapsed into the prefix wildcard safePrefixWildcards allows. Each step
+// records in Adds the actions every wildcard grants beyond those it replaced.
+// The policy may still exceed limit.
+func compressActions(policy IAMPolicy, limit int) (IAMPolicy, []policyCompression) {
+	if policySize(policy) <= limit {
+		return policy, nil
+	}
+	if actionCatalog == nil {
+		if err := loadActionCatalog(); err != nil {
+			return policy, nil
+		}
+	}
+
+	before := make(map[string][]string)
+	for _, service := range policyServices(policy) {
+		before[service] = serviceActions(policy, service)
+	}
+	compressed, steps := collapseServices(mergeStatementsByResource(policy), limit, CompressionSafePrefix, safePrefixWildcards)
+	for i, step := range steps {
+		steps[i].Adds = make(map[string][]string)
+		for _, wildcard := range wildcardsIn(step.After) {
+			if !containsString(before[step.Service], wildcard) {
+				steps[i].Adds[wildcard] = wildcardAdds(wildcard, before[step.Service])
+			}
+		}
+	}
+	return compressed, steps
+}
+
+// safePrefixWildcards collapses the actions of service sharing a verb into
+// one wildcard on their longest common prefix (ec2:DescribeInstance* for
+// DescribeInstances and DescribeInstanceStatus), when the catalog shows that
+// every other action the wildcard matches has the access level of one of the
+// actions it replaces. A wildcard that would add, say, a Permissions
+// management action to Read actions is not made. The check is only as
+// complete as the catalog: a wildcard also matches actions AWS adds later.
+func safePrefixWildcards(service string, actions []string) []string {
+	if _, ok := catalogService(service); !ok {
+		return actions
+	}
+
+	byVerb := make(map[string][]string)
+	var out []string
+	for _, action := range actions {
+		_, name, _ := strings.Cut(action, ":")
+		verb := actionVerb(name)
+		if verb == "" {
+			out = append(out, action)
+			continue
+		}
+		byVerb[verb] = append(byVerb[verb], action)
+	}
+	for _, verbActions := range byVerb {
+		if wildcard, ok := safeWildcard(service, verbActions); ok {
+			out = append(out, wildcard)
+		} else {
+			out = append(out, verbActions...)
+		}
+	}
+	return dedupeActions(out)
+}
+
+// safeWildcard returns the prefix wildcard of actions and whether it is
+// safe: it matches every one of them, and nothing outside their access
+// levels.
+func safeWildcard(service string, actions []string) (string, bool) {
+	if len(actions) < 2 {
+		return "", false
+	}
+	prefix := ""
+	levels := make(map[string]bool)
+	for i, action := range actions {
+		_, name, _ := strings.Cut(action, ":")
+		if i == 0 {
+			prefix = name
+		} else {
+			prefix = commonPrefix(prefix, name)
+		}
+		_, info, ok := lookupAction(action)
+		if !ok {
+			return "", false
+		}
+		levels[info.Access] = true
+	}
+
+	// Cut a trailing capital so the wildcard does not end inside a word:
+	// PutRolePolicy and PutRolePermissionsBoundary make PutRole*
+	if last := len(prefix) - 1; last > 0 && prefix[last] >= 'A' && prefix[last] <= 'Z' {
+		prefix = prefix[:last]
+	}
+	wildcard := service + ":" + prefix + "*"
+	matched := make(map[string]bool)
+	for _, action := range expandActionPattern(wildcard) {
+		matched[strings.ToLower(action)] = true
+		if _, info, _ := lookupAction(action); !levels[info.Access] {
+			return "", false
+		}
+	}
+	for _, action := range actions {
+		if !matched[strings.ToLower(action)] {
+			return "", false
+		}
+	}
+	return wildcard, true
+}
+
+// commonPrefix returns the longest common prefix of a and b.
+func commonPrefix(a, b string) string {
+	n := 0
+	for n < len(a) && n < len(b) && a[n] == b[n] {
+		n++
+	}
+	return a[:n]
+}
+
+// wildcardAdds returns the catalog actions wildcard matches that are not in
+// replaced, sorted.
+func wildcardAdds(wildcard string, replaced []string) []string {
+	known := make(map[string]bool, len(replaced))
+	for _, action := range replaced {
+		known[strings.ToLower(action)] = true
+	}
+	adds := []string{}
+	for _, action := range expandActionPattern(wildcard) {
+		if canonical, _, ok := lookupAction(action); ok && !known[strings.ToLower(action)] {
+			adds = append(adds, canonical)
+		}
+	}
+	return adds
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestSafeWildcard(t *testing.T) {
+	if err := loadActionCatalog(); err != nil {
+		t.Fatalf("Error loading action catalog: %v", err)
+	}
+
+	tests := []struct {
+		service string
+		actions []string
+		want    string
+	}{
+		// Both Read, and GetBucketPolicyStatus is Read too
+		{"s3", []string{"s3:GetBucketPolicy", "s3:GetBucketPolicyStatus"}, "s3:GetBucketPolicy*"},
+		// The prefix is cut back to a word boundary
+		{"iam", []string{"iam:PutRolePolicy", "iam:PutRolePermissionsBoundary"}, "iam:PutRole*"},
+		// PutObject* would add PutObjectAcl, a Permissions management action
+		{"s3", []string{"s3:PutObject", "s3:PutObjectTagging"}, ""},
+		// Unknown actions cannot be checked
+		{"s3", []string{"s3:GetWidget", "s3:GetGadget"}, ""},
+		{"s3", []string{"s3:GetObject"}, ""},
+	}
+	for _, tt := range tests {
+		got, ok := safeWildcard(tt.service, tt.actions)
+		if tt.want == "" && ok {
+			t.Errorf("safeWildcard(%v) = %s, want no wildcard", tt.actions, got)
+		}
+		if tt.want != "" && (!ok || got != tt.want) {
+			t.Errorf("safeWildcard(%v) = %q, %v, want %s", tt.actions, got, ok, tt.want)
+		}
+	}
+}
+
+func TestCompressActions(t *testing.T) {
+	if err := loadActionCatalog(); err != nil {
+		t.Fatalf("Error loading action catalog: %v", err)
+	}
+
+	describes := expandActionPattern("ec2:Describe*")
+	var statements []IAMStatement
+	for i := 0; i < 3; i++ {
+		statements = append(statements, IAMStatement{
+			Sid:      fmt.Sprintf("EC2Describe%d", i),
+			Effect:   "Allow",
+			Action:   describes,
+			Resource: fmt.Sprintf("arn:aws:ec2:us-east-1:123456789012:vpc/vpc-%d", i),
+		})
+	}
+	statements = append(statements, IAMStatement{
+		Effect:   "Allow",
+		Action:   []string{"s3:PutObject", "s3:PutObjectTagging"},
+		Resource: "arn:aws:s3:::uploads/*",
+	})
+	policy := IAMPolicy{Version: "2012-10-17", Statement: statements}
+
+	compressed, steps := compressActions(policy, managedPolicySizeLimit)
+	if size := policySize(compressed); size > managedPolicySizeLimit {
+		t.Fatalf("Policy of %d characters still over the limit", size)
+	}
+	if len(steps) != 1 || steps[0].Level != CompressionSafePrefix || steps[0].Service != "ec2" {
+		t.Fatalf("Expected one safe step for ec2, got %+v", steps)
+	}
+	if adds, ok := steps[0].Adds["ec2:Describe*"]; !ok || len(adds) != 0 {
+		t.Errorf("ec2:Describe* replaces every Describe action and should add none, got %v", adds)
+	}
+	for _, statement := range compressed.Statement {
+		actions := toStringSlice(statement.Action)
+		if containsString(actions, "s3:PutObject*") {
+			t.Errorf("s3:PutObject* is not safe: %v", actions)
+		}
+	}
+
+	if _, steps := compressActions(IAMPolicy{Version: "2012-10-17", Statement: statements[3:]}, managedPolicySizeLimit); steps != nil {
+		t.Errorf("A policy within the limit should not be compressed, got %+v", steps)
+	}
+}
+
+func TestWildcardAdds(t *testing.T) {
+	if err := loadActionCatalog(); err != nil {
+		t.Fatalf("Error loading action catalog: %v", err)
+	}
+	adds := wildcardAdds("s3:GetBucketPolicy*", []string{"s3:GetBucketPolicy"})
+	if len(adds) != 1 || adds[0] != "s3:GetBucketPolicyStatus" {
+		t.Errorf("Expected s3:GetBucketPolicyStatus, got %v", adds)
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultConfigFile is read from the working directory when --config is not
+// given.
+const defaultConfigFile = ".tf-iam-scanner.yaml"
+
+var configFlag string
+
+// Config is the scanner configuration file. Flags given on the command line
+// take precedence over its settings; list settings are extended by them.
+type Config struct {
+	LeastPrivilege      *bool    `yaml:"least_privilege,omitempty"`
+	IncludeStateBackend *bool    `yaml:"include_state_backend,omitempty"`
+	Format              string   `yaml:"format,omitempty"`
+	PolicyVersion       string   `yaml:"policy_version,omitempty"`
+	Partition           string   `yaml:"partition,omitempty"`
+	IncludeTypes        []string `yaml:"include_types,omitempty"`
+	ExcludeTypes        []string `yaml:"exclude_types,omitempty"`
+
+	// ExcludeActions are IAM action patterns that must never appear in a
+	// generated policy, e.g. "iam:Delete*".
+	ExcludeActions []string `yaml:"exclude_actions,omitempty"`
+
+	// DisableRules are the IDs or names of the rules whose findings are
+	// turned off, e.g. TFIAM003; --enable-rule turns them back on.
+	DisableRules []string `yaml:"disable_rules,omitempty"`
+
+	// WildcardThreshold is --wildcard-threshold. WildcardThresholds
+	// override it per service prefix, and services in NeverWildcard are
+	// never collapsed into service:*, e.g. iam, kms and sts.
+	WildcardThreshold  *int           `yaml:"wildcard_threshold,omitempty"`
+	WildcardThresholds map[string]int `yaml:"wildcard_thresholds,omitempty"`
+	NeverWildcard      []string       `yaml:"never_wildcard,omitempty"`
+
+	// MaxFileSize is --max-file-size, e.g. 50MB.
+	MaxFileSize string `yaml:"max_file_size,omitempty"`
+
+	// ExtraStatements are appended to every generated policy, e.g. a
+	// mandatory sts:GetCallerIdentity or an organization's Deny guardrails.
+	ExtraStatements []ExtraStatement `yaml:"extra_statements,omitempty"`
+
+	// OutputTemplate is --output-template.
+	OutputTemplate string `yaml:"output_template,omitempty"`
+
+	// Stacks are the root modules scanned by a run without --path, each
+	// written to its own output.
+	Stacks []StackConfig `yaml:"stacks,omitempty"`
+}
+
+// StackConfig is one root module listed in the configuration file. Relative
+// paths are relative to the configuration file.
+type StackConfig struct {
+	Path   string `yaml:"path"`
+	Output string `yaml:"output,omitempty"`
+
+	// name is the .Stack of output templates, from the path as written in
+	// the configuration file.
+	name string
+}
+
+// scannerConfig is the configuration loaded by validateOutputFlags.
+var scannerConfig Config
+
+// loadConfig reads the configuration file at filePath, or the default file
+// when filePath is empty. A missing default file yields an empty
+// configuration; unknown keys are rejected so typos do not go unnoticed.
+func loadConfig(filePath string) (Config, error) {
+	explicit := filePath != ""
+	if !explicit {
+		filePath = defaultConfigFile
+	}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		if !explicit && errors.Is(err, os.ErrNotExist) {
+			return Config{}, nil
+		}
+		return Config{}, fmt.Errorf("error reading config: %w", err)
+	}
+	return parseConfig(data, filePath, filepath.Dir(filePath))
+}
+
+// loadRemoteConfig fetches the configuration file at rawURL (--config-url).
+// Relative stack paths in it are relative to the working directory.
+func loadRemoteConfig(rawURL, pin string) (Config, error) {
+	file, err := fetchRemoteFile(context.Background(), rawURL, pin)
+	if err != nil {
+		return Config{}, fmt.Errorf("error reading config: %w", err)
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return Config{}, fmt.Errorf("error reading config: %w", err)
+	}
+	return parseConfig(data, rawURL, ".")
+}
+
+// parseConfig decodes the configuration file at filePath, resolving relative
+// paths against dir.
+func parseConfig(data []byte, filePath, dir string) (Config, error) {
+	var config Config
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&config); err != nil && !errors.Is(err, io.EOF) {
+		return Config{}, fmt.Errorf("error parsing %s: %w", filePath, err)
+	}
+
+	for i := range config.Stacks {
+		stack := &config.Stacks[i]
+		if stack.Path == "" {
+			return Config{}, fmt.Errorf("error parsing %s: stack %d has no path", filePath, i+1)
+		}
+		stack.name = rootArtifactName(stack.Path)
+		stack.Path = relativeToConfig(dir, stack.Path)
+		if stack.Output != "" {
+			stack.Output = relativeToConfig(dir, stack.Output)
+		}
+	}
+	return config, nil
+}
+
+func relativeToConfig(dir, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+// applyConfig sets the flags of cmd that were not given on the command line
+// from config.
+func applyConfig(cmd *cobra.Command, config Config) {
+	flags := cmd.Flags()
+	if config.LeastPrivilege != nil && !flags.Changed("least-privilege") {
+		leastPrivilegeFlag = *config.LeastPrivilege
+	}
+	if config.IncludeStateBackend != nil && !flags.Changed("include-state-backend") {
+		includeStateBackendFlag = *config.IncludeStateBackend
+	}
+	if config.Format != "" && !flags.Changed("format") {
+		formatFlag = config.Format
+	}
+	if config.PolicyVersion != "" && !flags.Changed("policy-version") {
+		policyVersionFlag = config.PolicyVersion
+	}
+	if config.Partition != "" && !flags.Changed("partition") {
+		partitionFlag = config.Partition
+	}
+	if config.MaxFileSize != "" && !flags.Changed("max-file-size") {
+		maxFileSizeFlag = config.MaxFileSize
+	}
+	if config.OutputTemplate != "" && !flags.Changed("output-template") && !flags.Changed("output") {
+		outputTemplateFlag = config.OutputTemplate
+	}
+	if config.WildcardThreshold != nil && !flags.Changed("wildcard-threshold") {
+		wildcardThresholdFlag = *config.WildcardThreshold
+	}
+	includeTypesFlag = append(append([]string{}, config.IncludeTypes...), includeTypesFlag...)
+	excludeTypesFlag = append(append([]string{}, config.ExcludeTypes...), excludeTypesFlag...)
+}
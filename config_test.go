@@ -0,0 +1,113 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.Chdir(wd) })
+
+	config, err := loadConfig("")
+	if err != nil {
+		t.Fatalf("A missing default config file should not be an error: %v", err)
+	}
+	if len(config.ExcludeActions) != 0 {
+		t.Errorf("Expected an empty config, got %+v", config)
+	}
+
+	if _, err := loadConfig(filepath.Join(dir, "missing.yaml")); err == nil {
+		t.Errorf("Expected an error for a missing --config file")
+	}
+
+	content := "exclude_actions:\n  - iam:Delete*\n  - kms:ScheduleKeyDeletion\n"
+	if err := os.WriteFile(defaultConfigFile, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config, err = loadConfig("")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(config.ExcludeActions) != 2 || config.ExcludeActions[0] != "iam:Delete*" {
+		t.Errorf("Unexpected exclude_actions: %v", config.ExcludeActions)
+	}
+
+	empty := filepath.Join(dir, "empty.yaml")
+	if err := os.WriteFile(empty, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadConfig(empty); err != nil {
+		t.Errorf("An empty config file should not be an error: %v", err)
+	}
+
+	typo := filepath.Join(dir, "typo.yaml")
+	if err := os.WriteFile(typo, []byte("exclude_action:\n  - iam:Delete*\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadConfig(typo); err == nil {
+		t.Errorf("Expected an error for an unknown config key")
+	}
+}
+
+func TestLoadConfigStacks(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "scanner.yaml")
+	content := "stacks:\n  - path: stacks/app\n    output: policies/app.json\n  - path: /abs/network\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config, err := loadConfig(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if config.Stacks[0].Path != filepath.Join(dir, "stacks", "app") || config.Stacks[0].Output != filepath.Join(dir, "policies", "app.json") {
+		t.Errorf("Stack paths should be relative to the config file: %+v", config.Stacks[0])
+	}
+	if config.Stacks[1].Path != "/abs/network" || config.Stacks[1].Output != "" {
+		t.Errorf("Unexpected stack: %+v", config.Stacks[1])
+	}
+
+	if err := os.WriteFile(path, []byte("stacks:\n  - output: app.json\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadConfig(path); err == nil {
+		t.Errorf("Expected an error for a stack without a path")
+	}
+}
+
+func TestApplyConfigPrecedence(t *testing.T) {
+	leastPrivilege, format, includeTypes := leastPrivilegeFlag, formatFlag, includeTypesFlag
+	t.Cleanup(func() {
+		leastPrivilegeFlag, formatFlag, includeTypesFlag = leastPrivilege, format, includeTypes
+	})
+
+	cmd := &cobra.Command{}
+	addPolicyOutputFlags(cmd)
+	if err := cmd.ParseFlags([]string{"--format", "hcl", "--include-types", "aws_s3_*"}); err != nil {
+		t.Fatal(err)
+	}
+
+	enabled := true
+	applyConfig(cmd, Config{LeastPrivilege: &enabled, Format: "yaml", IncludeTypes: []string{"aws_iam_*"}})
+	if !leastPrivilegeFlag {
+		t.Errorf("least_privilege should apply when the flag was not given")
+	}
+	if formatFlag != "hcl" {
+		t.Errorf("--format should take precedence over the config, got %s", formatFlag)
+	}
+	if strings.Join(includeTypesFlag, ",") != "aws_iam_*,aws_s3_*" {
+		t.Errorf("Config types should extend the flag values, got %v", includeTypesFlag)
+	}
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+//go:embed provider-types.json
+var embeddedProviderTypes []byte
+
+//go:generate go run cmd/generate-provider-types/main.go
+
+var (
+	coverageSchemaFlag   string
+	coverageUnmappedFlag bool
+	coverageTopFlag      int
+)
+
+var dbCoverageCmd = &cobra.Command{
+	Use:   "coverage",
+	Short: "Report which Terraform AWS provider types the permissions database maps",
+	Long: `Compare the permissions database against every resource and data source of
+the Terraform AWS provider and report the types it has no mapping for.
+
+The provider's type list is bundled with the binary. To compare against the
+provider version you actually use, pass the output of
+'terraform providers schema -json' with --schema.
+
+A data source without its own entry counts as mapped when the resource of
+the same type is mapped, since the scanner falls back to the resource's
+read actions.`,
+	Args: cobra.NoArgs,
+	Run:  runDBCoverage,
+}
+
+func init() {
+	dbCoverageCmd.Flags().StringVar(&coverageSchemaFlag, "schema", "", "Provider schema from 'terraform providers schema -json' (default: the bundled type list)")
+	dbCoverageCmd.Flags().BoolVar(&coverageUnmappedFlag, "unmapped", false, "Print every unmapped type, one per line")
+	dbCoverageCmd.Flags().IntVar(&coverageTopFlag, "top", 15, "Number of services to list by unmapped types")
+	dbCoverageCmd.Flags().BoolVar(&dbJSONFlag, "json", false, "Print the coverage report as JSON")
+	dbCoverageCmd.Flags().StringArrayVar(&permissionsDirFlag, "permissions-dir", nil, "Directory of extra permission mappings (.json/.yaml) to count as mapped (repeatable)")
+	dbCoverageCmd.Flags().StringVar(&permissionsOrgFlag, "permissions-org", "", "Org-level permission mappings (a .json/.yaml file or a directory of them) applied between the embedded DB and --permissions-dir (default: $TF_IAM_SCANNER_PERMISSIONS_ORG)")
+	dbCoverageCmd.Flags().StringVar(&permissionsURLFlag, "permissions-url", "", "Fetch org-level permission mappings from an https:// URL into the org layer, cached and revalidated by ETag (default: $TF_IAM_SCANNER_PERMISSIONS_URL)")
+	dbCoverageCmd.Flags().StringVar(&permissionsSHA256Flag, "permissions-sha256", "", "Expected SHA256 of the --permissions-url file; a mismatch fails the run")
+	_ = dbCoverageCmd.MarkFlagFilename("schema", "json")
+	_ = dbCoverageCmd.MarkFlagDirname("permissions-dir")
+	dbCmd.AddCommand(dbCoverageCmd)
+}
+
+// ProviderTypes lists the resource and data source types of the AWS provider.
+type ProviderTypes struct {
+	Version     string   `json:"-"`
+	Resources   []string `json:"resources"`
+	DataSources []string `json:"data_sources"`
+}
+
+// CoverageReport compares the permissions database with the provider's types.
+type CoverageReport struct {
+	ProviderVersion     string         `json:"provider_version,omitempty"`
+	Resources           TypeCoverage   `json:"resources"`
+	DataSources         TypeCoverage   `json:"data_sources"`
+	UnmappedPerService  map[string]int `json:"unmapped_per_service"`
+	UnknownToProvider   []string       `json:"unknown_to_provider"`
+	DataSourceFallbacks int            `json:"data_source_fallbacks"`
+}
+
+// TypeCoverage counts the mapped types of one kind and lists the unmapped
+// ones.
+type TypeCoverage struct {
+	Total    int      `json:"total"`
+	Mapped   int      `json:"mapped"`
+	Percent  float64  `json:"percent"`
+	Unmapped []string `json:"unmapped"`
+}
+
+func runDBCoverage(cmd *cobra.Command, args []string) {
+	if err := loadPermissionsDB(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := loadPermissionPlugins(permissionsDirFlag); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	var types ProviderTypes
+	var err error
+	if coverageSchemaFlag != "" {
+		types, err = loadProviderSchemaTypes(coverageSchemaFlag)
+	} else {
+		types, err = loadBundledProviderTypes()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	report := computeCoverage(permissionsDB, types)
+
+	switch {
+	case dbJSONFlag:
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error marshaling report: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(data))
+	case coverageUnmappedFlag:
+		for _, resourceType := range report.Resources.Unmapped {
+			fmt.Println(resourceType)
+		}
+		for _, dataSource := range report.DataSources.Unmapped {
+			fmt.Println("data." + dataSource)
+		}
+	default:
+		printCoverageReport(report, coverageTopFlag)
+	}
+}
+
+// loadBundledProviderTypes returns the embedded type list.
+func loadBundledProviderTypes() (ProviderTypes, error) {
+	var bundled struct {
+		Meta struct {
+			ProviderVersion string `json:"provider_version"`
+		} `json:"_meta"`
+		ProviderTypes
+	}
+	if err := json.Unmarshal(embeddedProviderTypes, &bundled); err != nil {
+		return ProviderTypes{}, fmt.Errorf("error parsing provider-types.json: %w", err)
+	}
+	bundled.Version = bundled.Meta.ProviderVersion
+	return bundled.ProviderTypes, nil
+}
+
+// loadProviderSchemaTypes reads the AWS provider's types from the output of
+// terraform providers schema -json.
+func loadProviderSchemaTypes(filePath string) (ProviderTypes, error) {
+	provider, err := readAWSProviderSchema(filePath)
+	if err != nil {
+		return ProviderTypes{}, err
+	}
+
+	types := ProviderTypes{}
+	for name := range provider.ResourceSchemas {
+		types.Resources = append(types.Resources, name)
+	}
+	for name := range provider.DataSourceSchemas {
+		types.DataSources = append(types.DataSources, name)
+	}
+	sort.Strings(types.Resources)
+	sort.Strings(types.DataSources)
+	return types, nil
+}
+
+// computeCoverage compares db with the provider's types.
+func computeCoverage(db PermissionMap, types ProviderTypes) CoverageReport {
+	report := CoverageReport{
+		ProviderVersion:    types.Version,
+		Resources:          TypeCoverage{Total: len(types.Resources), Unmapped: []string{}},
+		DataSources:        TypeCoverage{Total: len(types.DataSources), Unmapped: []string{}},
+		UnmappedPerService: make(map[string]int),
+		UnknownToProvider:  []string{},
+	}
+
+	known := make(map[string]bool)
+	for _, resourceType := range types.Resources {
+		known[resourceType] = true
+		if _, ok := db[resourceType]; ok {
+			report.Resources.Mapped++
+			continue
+		}
+		report.Resources.Unmapped = append(report.Resources.Unmapped, resourceType)
+		report.UnmappedPerService[providerTypeService(resourceType)]++
+	}
+	for _, dataSource := range types.DataSources {
+		known["data."+dataSource] = true
+		if _, ok := db["data."+dataSource]; ok {
+			report.DataSources.Mapped++
+			continue
+		}
+		if _, ok := db[dataSource]; ok {
+			report.DataSources.Mapped++
+			report.DataSourceFallbacks++
+			continue
+		}
+		report.DataSources.Unmapped = append(report.DataSources.Unmapped, dataSource)
+		report.UnmappedPerService[providerTypeService(dataSource)]++
+	}
+
+	for key := range db {
+		if strings.HasPrefix(key, "service.") || known[key] {
+			continue
+		}
+		// Entries of other providers come from drop-in mappings
+		if strings.HasPrefix(strings.TrimPrefix(key, "data."), "aws_") {
+			report.UnknownToProvider = append(report.UnknownToProvider, key)
+		}
+	}
+	sort.Strings(report.UnknownToProvider)
+
+	report.Resources.Percent = coveragePercent(report.Resources)
+	report.DataSources.Percent = coveragePercent(report.DataSources)
+	return report
+}
+
+func coveragePercent(coverage TypeCoverage) float64 {
+	if coverage.Total == 0 {
+		return 0
+	}
+	return float64(coverage.Mapped) * 100 / float64(coverage.Total)
+}
+
+// providerTypeService returns the service part of a type name as used in the
+// provider's naming, e.g. "s3" for aws_s3_bucket. Types without a service
+// segment such as aws_instance are grouped under their own name.
+func providerTypeService(resourceType string) string {
+	name := strings.TrimPrefix(resourceType, "aws_")
+	service, _, _ := strings.Cut(name, "_")
+	return service
+}
+
+// printCoverageReport writes the human-readable report to stdout, listing the
+// top services by unmapped types.
+func printCoverageReport(report CoverageReport, top int) {
+	if report.ProviderVersion != "" {
+		fmt.Printf("AWS provider %s\n", report.ProviderVersion)
+	}
+	fmt.Printf("Permissions DB: %s\n\n", describePermissionsDB())
+	fmt.Printf("Resources:    %4d / %4d mapped (%.1f%%)\n", report.Resources.Mapped, report.Resources.Total, report.Resources.Percent)
+	fmt.Printf("Data sources: %4d / %4d mapped (%.1f%%, %d via the resource entry)\n",
+		report.DataSources.Mapped, report.DataSources.Total, report.DataSources.Percent, report.DataSourceFallbacks)
+
+	services := make([]string, 0, len(report.UnmappedPerService))
+	for service := range report.UnmappedPerService {
+		services = append(services, service)
+	}
+	sort.Slice(services, func(i, j int) bool {
+		a, b := report.UnmappedPerService[services[i]], report.UnmappedPerService[services[j]]
+		if a != b {
+			return a > b
+		}
+		return services[i] < services[j]
+	})
+	if top > 0 && len(services) > 0 {
+		if len(services) > top {
+			services = services[:top]
+		}
+		fmt.Printf("\nMost unmapped types by service:\n")
+		for _, service := range services {
+			fmt.Printf("  %-24s %d\n", service, report.UnmappedPerService[service])
+		}
+	}
+
+	if len(report.UnknownToProvider) > 0 {
+		fmt.Printf("\nEntries for types the provider does not have (misnamed, renamed or removed): %d\n", len(report.UnknownToProvider))
+	}
+
+	fmt.Printf("\nUse --unmapped to list every unmapped type and --json for the full report.\n")
+}
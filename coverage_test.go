@@ -0,0 +1,88 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestComputeCoverage(t *testing.T) {
+	db := PermissionMap{
+		"aws_s3_bucket":      {Actions: []string{"s3:CreateBucket"}},
+		"aws_sqs_queue":      {Actions: []string{"sqs:CreateQueue"}},
+		"data.aws_region":    {Actions: []string{"ec2:DescribeRegions"}},
+		"aws_app_config_app": {Actions: []string{"appconfig:CreateApplication"}},
+		"mongodbatlas_thing": {Actions: []string{"ec2:DescribeVpcs"}},
+		"service.s3":         {ARNTemplate: "arn:${partition}:s3:::*"},
+	}
+	types := ProviderTypes{
+		Version:     "6.0.0",
+		Resources:   []string{"aws_s3_bucket", "aws_s3_object", "aws_sqs_queue", "aws_instance"},
+		DataSources: []string{"aws_region", "aws_sqs_queue", "aws_s3_objects"},
+	}
+
+	report := computeCoverage(db, types)
+
+	if report.Resources.Mapped != 2 || report.Resources.Total != 4 || report.Resources.Percent != 50 {
+		t.Errorf("Unexpected resource coverage: %+v", report.Resources)
+	}
+	if strings.Join(report.Resources.Unmapped, ",") != "aws_s3_object,aws_instance" {
+		t.Errorf("Unexpected unmapped resources: %v", report.Resources.Unmapped)
+	}
+	if report.DataSources.Mapped != 2 || report.DataSourceFallbacks != 1 {
+		t.Errorf("Expected data sources mapped directly and via the resource entry: %+v", report)
+	}
+	if report.UnmappedPerService["s3"] != 2 || report.UnmappedPerService["instance"] != 1 {
+		t.Errorf("Unexpected per-service counts: %v", report.UnmappedPerService)
+	}
+	if strings.Join(report.UnknownToProvider, ",") != "aws_app_config_app" {
+		t.Errorf("Expected only the misnamed AWS entry to be unknown, got %v", report.UnknownToProvider)
+	}
+}
+
+func TestLoadProviderSchemaTypes(t *testing.T) {
+	schema := `{
+  "format_version": "1.0",
+  "provider_schemas": {
+    "registry.terraform.io/hashicorp/random": {"resource_schemas": {"random_id": {}}},
+    "registry.terraform.io/hashicorp/aws": {
+      "resource_schemas": {"aws_sqs_queue": {}, "aws_s3_bucket": {}},
+      "data_source_schemas": {"aws_region": {}}
+    }
+  }
+}`
+	file := filepath.Join(t.TempDir(), "schema.json")
+	if err := os.WriteFile(file, []byte(schema), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	types, err := loadProviderSchemaTypes(file)
+	if err != nil {
+		t.Fatalf("Error loading schema: %v", err)
+	}
+	if strings.Join(types.Resources, ",") != "aws_s3_bucket,aws_sqs_queue" || strings.Join(types.DataSources, ",") != "aws_region" {
+		t.Errorf("Unexpected types: %+v", types)
+	}
+
+	if err := os.WriteFile(file, []byte(`{"provider_schemas": {}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadProviderSchemaTypes(file); err == nil {
+		t.Errorf("Expected an error for a schema without the AWS provider")
+	}
+}
+
+func TestBundledProviderTypes(t *testing.T) {
+	types, err := loadBundledProviderTypes()
+	if err != nil {
+		t.Fatalf("Error loading bundled provider types: %v", err)
+	}
+	if types.Version == "" || len(types.Resources) < 1000 || len(types.DataSources) < 300 {
+		t.Errorf("Bundled type list looks incomplete: version %q, %d resources, %d data sources",
+			types.Version, len(types.Resources), len(types.DataSources))
+	}
+	if !containsString(types.Resources, "aws_s3_bucket") || !containsString(types.DataSources, "aws_caller_identity") {
+		t.Errorf("Expected aws_s3_bucket and data.aws_caller_identity in the bundled list")
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+// resourceARNs renders every form of the arn_template and arn_templates of
+// resource's entry. Data sources render their data.* entry from the
+// arguments they look the resource up by, so a resource that refers to
+// data.aws_iam_role.ci is scoped to that role like one that refers to a
+// managed role; see dataSourceARNs.
+func resourceARNs(resource *Resource, ctx arnContext) []string {
+	templates := permissionsDB[resource.permissionsKey()].allARNTemplates()
+	if resource.Kind == KindData {
+		return dataSourceARNs(resource, templates, ctx)
+	}
+	arns := make([]string, 0, len(templates))
+	for _, template := range templates {
+		arns = append(arns, renderARNTemplate(template, resource, ctx))
+	}
+	return arns
+}
+
+// dataSourceARNs renders templates for a data source. Most data sources
+// also take the ARN itself, in arn or in the argument the template reads
+// (function_name, key_id); such an ARN replaces the forms of its service.
+// An alias, which only AWS resolves to the key behind it, matches any key.
+func dataSourceARNs(dataSource *Resource, templates []string, ctx arnContext) []string {
+	var arns []string
+	add := func(arn string) {
+		if !containsString(arns, arn) {
+			arns = append(arns, arn)
+		}
+	}
+	for _, template := range templates {
+		if arn, ok := dataSourceARNArgument(dataSource, template); ok {
+			add(replaceEnvironment(arn, ctx.Environment, ctx.EnvironmentToken))
+			continue
+		}
+		add(renderARNTemplate(template, withoutAliasArguments(dataSource, template), ctx))
+	}
+	return arns
+}
+
+// dataSourceARNArgument returns the ARN a data source is looked up by when
+// it is of the template's service: the arn argument, or an argument the
+// template reads. Alias ARNs do not count; they do not name the resource.
+func dataSourceARNArgument(dataSource *Resource, template string) (string, bool) {
+	names := []string{"arn"}
+	for _, match := range arnTemplateVar.FindAllStringSubmatch(template, -1) {
+		names = append(names, match[1])
+	}
+	for _, name := range names {
+		value, ok := knownStringAttribute(dataSource, name)
+		if !ok || !strings.HasPrefix(value, "arn:") || isAliasIdentifier(value) {
+			continue
+		}
+		if arnTemplateService(value) == arnTemplateService(template) {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// withoutAliasArguments returns dataSource without the arguments template
+// reads that hold an alias, so they render as "*".
+func withoutAliasArguments(dataSource *Resource, template string) *Resource {
+	var stripped *Resource
+	for _, match := range arnTemplateVar.FindAllStringSubmatch(template, -1) {
+		value, ok := knownStringAttribute(dataSource, match[1])
+		if !ok || !isAliasIdentifier(value) {
+			continue
+		}
+		if stripped == nil {
+			copied := *dataSource
+			copied.Attributes = make(map[string]cty.Value, len(dataSource.Attributes))
+			for name, attribute := range dataSource.Attributes {
+				copied.Attributes[name] = attribute
+			}
+			stripped = &copied
+		}
+		delete(stripped.Attributes, match[1])
+	}
+	if stripped == nil {
+		return dataSource
+	}
+	return stripped
+}
+
+// isAliasIdentifier reports whether value names a KMS alias, as
+// "alias/name" or as an alias ARN.
+func isAliasIdentifier(value string) bool {
+	if strings.HasPrefix(value, "alias/") {
+		return true
+	}
+	parts := strings.SplitN(value, ":", 6)
+	return len(parts) == 6 && parts[2] == "kms" && strings.HasPrefix(parts[5], "alias/")
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestResourceARNsForDataSources(t *testing.T) {
+	if err := loadPermissionsDB(); err != nil {
+		t.Fatalf("Error loading permissions DB: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		dataSource Resource
+		want       []string
+	}{
+		{
+			name:       "role by name",
+			dataSource: Resource{Kind: KindData, Type: "aws_iam_role", Attributes: map[string]cty.Value{"name": cty.StringVal("deploy")}},
+			want:       []string{"arn:aws:iam::*:role/deploy", "arn:aws:iam::*:role/*/deploy"},
+		},
+		{
+			name:       "key by id",
+			dataSource: Resource{Kind: KindData, Type: "aws_kms_key", Attributes: map[string]cty.Value{"key_id": cty.StringVal("1234abcd-12ab-34cd-56ef-1234567890ab")}},
+			want:       []string{"arn:aws:kms:*:*:key/1234abcd-12ab-34cd-56ef-1234567890ab"},
+		},
+		{
+			name:       "key by ARN",
+			dataSource: Resource{Kind: KindData, Type: "aws_kms_key", Attributes: map[string]cty.Value{"key_id": cty.StringVal("arn:aws:kms:eu-west-1:111122223333:key/1234abcd")}},
+			want:       []string{"arn:aws:kms:eu-west-1:111122223333:key/1234abcd"},
+		},
+		{
+			name:       "key by alias",
+			dataSource: Resource{Kind: KindData, Type: "aws_kms_key", Attributes: map[string]cty.Value{"key_id": cty.StringVal("alias/logs")}},
+			want:       []string{"arn:aws:kms:*:*:key/*"},
+		},
+		{
+			name:       "key by alias ARN",
+			dataSource: Resource{Kind: KindData, Type: "aws_kms_key", Attributes: map[string]cty.Value{"key_id": cty.StringVal("arn:aws:kms:eu-west-1:111122223333:alias/logs")}},
+			want:       []string{"arn:aws:kms:*:*:key/*"},
+		},
+		{
+			name:       "policy by ARN",
+			dataSource: Resource{Kind: KindData, Type: "aws_iam_policy", Attributes: map[string]cty.Value{"arn": cty.StringVal("arn:aws:iam::aws:policy/ReadOnlyAccess")}},
+			want:       []string{"arn:aws:iam::aws:policy/ReadOnlyAccess"},
+		},
+		{
+			name:       "unknown name",
+			dataSource: Resource{Kind: KindData, Type: "aws_ssm_parameter", Attributes: map[string]cty.Value{"name": cty.UnknownVal(cty.String)}},
+			want:       []string{"arn:aws:ssm:*:*:parameter/*"},
+		},
+		{
+			name:       "no arn_template",
+			dataSource: Resource{Kind: KindData, Type: "aws_ami"},
+			want:       nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := resourceARNs(&tt.dataSource, defaultARNContext)
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("resourceARNs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScopeThroughDataSourceReferences(t *testing.T) {
+	if err := loadPermissionsDB(); err != nil {
+		t.Fatalf("Error loading permissions DB: %v", err)
+	}
+
+	result := &ParseResult{
+		Resources: []Resource{
+			{Type: "aws_lambda_function", Name: "fn", Provider: "aws",
+				Attributes: map[string]cty.Value{"function_name": cty.StringVal("worker")},
+				References: []string{"data.aws_iam_role.ci", "data.aws_kms_key.logs"}},
+		},
+		DataSources: []Resource{
+			{Kind: KindData, Type: "aws_iam_role", Name: "ci", Provider: "aws",
+				Attributes: map[string]cty.Value{"name": cty.StringVal("deploy-role")}},
+			{Kind: KindData, Type: "aws_kms_key", Name: "logs", Provider: "aws",
+				Attributes: map[string]cty.Value{"key_id": cty.StringVal("1234abcd-12ab-34cd-56ef-1234567890ab")}},
+		},
+	}
+
+	resources := make(map[string]interface{})
+	for _, statement := range buildIAMPolicy(result, false, true).Statement {
+		for _, action := range toStringSlice(statement.Action) {
+			resources[action] = statement.Resource
+		}
+	}
+	role := []string{"arn:aws:iam::*:role/*/deploy-role", "arn:aws:iam::*:role/deploy-role"}
+	if got := strings.Join(toStringSlice(resources["iam:PassRole"]), ","); got != strings.Join(role, ",") {
+		t.Errorf("Expected iam:PassRole scoped to the role the data source reads, got %v", got)
+	}
+	key := "arn:aws:kms:*:*:key/1234abcd-12ab-34cd-56ef-1234567890ab"
+	for _, action := range []string{"kms:CreateGrant", "kms:Decrypt", "kms:DescribeKey"} {
+		if resources[action] != key {
+			t.Errorf("Expected %s scoped to the key the data source reads, got %v", action, resources[action])
+		}
+	}
+}
+
+func TestKMSKeyRuleSkipsKMSResources(t *testing.T) {
+	if err := loadPermissionsDB(); err != nil {
+		t.Fatalf("Error loading permissions DB: %v", err)
+	}
+
+	result := &ParseResult{
+		Resources: []Resource{
+			{Type: "aws_kms_key", Name: "main", Provider: "aws"},
+			{Type: "aws_kms_alias", Name: "main", Provider: "aws",
+				Attributes: map[string]cty.Value{"name": cty.StringVal("alias/main")},
+				References: []string{"aws_kms_key.main"}},
+		},
+	}
+	for _, permission := range inferReferencePermissions(result) {
+		if permission.Address == "aws_kms_alias.main" {
+			t.Errorf("Expected no inference for the alias of a key, got %+v", permission)
+		}
+	}
+}
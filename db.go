@@ -0,0 +1,217 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var dbJSONFlag bool
+
+var dbCmd = &cobra.Command{
+	Use:   "db",
+	Short: "Inspect the permissions database",
+}
+
+var dbValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Check every permissions database entry against the action catalog",
+	Long: `Check every entry of the embedded permissions database, plus any mapping
+layers given with --permissions-org and --permissions-dir. validate reports:
+
+  - actions, including companion actions, that are malformed or do not exist
+    in the embedded action catalog
+  - duplicate actions within an entry (IAM action names are case-insensitive)
+  - resource entries with actions but no resource_types
+  - ARN templates that do not render to a well-formed ARN
+  - aliases of renamed types whose current name has no entry
+  - mapping conflicts: an entry of the --permissions-org, drop-in or
+    --permissions-dir layers that an earlier mapping file sets differently
+
+Errors make validate exit non-zero.`,
+	Args: cobra.NoArgs,
+	Run:  runDBValidate,
+}
+
+func init() {
+	dbValidateCmd.Flags().BoolVar(&dbJSONFlag, "json", false, "Print findings as JSON")
+	dbValidateCmd.Flags().StringArrayVar(&permissionsDirFlag, "permissions-dir", nil, "Directory of extra permission mappings (.json/.yaml) to validate with the database (repeatable)")
+	dbValidateCmd.Flags().StringVar(&permissionsOrgFlag, "permissions-org", "", "Org-level permission mappings (a .json/.yaml file or a directory of them) applied between the embedded DB and --permissions-dir (default: $TF_IAM_SCANNER_PERMISSIONS_ORG)")
+	dbValidateCmd.Flags().StringVar(&permissionsURLFlag, "permissions-url", "", "Fetch org-level permission mappings from an https:// URL into the org layer, cached and revalidated by ETag (default: $TF_IAM_SCANNER_PERMISSIONS_URL)")
+	dbValidateCmd.Flags().StringVar(&permissionsSHA256Flag, "permissions-sha256", "", "Expected SHA256 of the --permissions-url file; a mismatch fails the run")
+	_ = dbValidateCmd.MarkFlagDirname("permissions-dir")
+	dbCmd.AddCommand(dbValidateCmd)
+	rootCmd.AddCommand(dbCmd)
+}
+
+// DBFinding is a single problem found in a permissions database entry.
+type DBFinding struct {
+	Entry    string `json:"entry"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+func runDBValidate(cmd *cobra.Command, args []string) {
+	if err := loadPermissionsDB(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := loadPermissionPlugins(permissionsDirFlag); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := loadActionCatalog(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	findings := validatePermissionsDB(permissionsDB, permissionAliases)
+	for _, conflict := range permissionConflicts {
+		findings = append(findings, DBFinding{Entry: conflict.Type, Severity: SeverityWarning, Message: "mapping conflict: " + conflict.String()})
+	}
+
+	errors, warnings := 0, 0
+	for _, finding := range findings {
+		if finding.Severity == SeverityError {
+			errors++
+		} else {
+			warnings++
+		}
+	}
+
+	if dbJSONFlag {
+		if findings == nil {
+			findings = []DBFinding{}
+		}
+		data, _ := json.MarshalIndent(findings, "", "  ")
+		fmt.Println(string(data))
+	} else {
+		for _, finding := range findings {
+			fmt.Printf("%s: %s: %s\n", finding.Entry, finding.Severity, finding.Message)
+		}
+		fmt.Fprintf(os.Stderr, "%d entries checked: %d error(s), %d warning(s)\n", permissionEntryCount(), errors, warnings)
+	}
+
+	if errors > 0 {
+		os.Exit(1)
+	}
+}
+
+// validatePermissionsDB checks every entry of db and the aliases of renamed
+// types, and returns the findings sorted by entry. The action catalog must be loaded.
+func validatePermissionsDB(db PermissionMap, aliases map[string]string) []DBFinding {
+	var findings []DBFinding
+	add := func(entry, severity, format string, args ...interface{}) {
+		findings = append(findings, DBFinding{Entry: entry, Severity: severity, Message: fmt.Sprintf(format, args...)})
+	}
+
+	for alias, target := range aliases {
+		if _, ok := aliases[target]; ok {
+			add(alias, SeverityError, "alias of %s, which is itself an alias", target)
+		} else if _, ok := db[target]; !ok {
+			add(alias, SeverityError, "alias of %s, which has no entry", target)
+		}
+	}
+
+	for key, perms := range db {
+		// Aliases share the entry of their target, which is checked there
+		if _, ok := aliases[key]; ok {
+			continue
+		}
+
+		// Service defaults carry only the ARN used for the service's actions
+		if strings.HasPrefix(key, "service.") {
+			if perms.ARNTemplate == "" {
+				add(key, SeverityError, "service default has no arn_template")
+			}
+		}
+
+		seen := make(map[string]string)
+		for _, action := range perms.Actions {
+			if previous, ok := seen[strings.ToLower(action)]; ok {
+				add(key, SeverityError, "duplicate action %s (already listed as %s)", action, previous)
+				continue
+			}
+			seen[strings.ToLower(action)] = action
+			if severity, message := checkAction(action); severity != "" {
+				add(key, severity, "%s", message)
+			}
+		}
+
+		for _, companion := range perms.Companions {
+			for _, action := range companion.Actions {
+				if severity, message := checkAction(action); severity != "" {
+					add(key, severity, "companion: %s", message)
+				}
+			}
+		}
+
+		for _, action := range perms.ExpandsTo {
+			if severity, message := checkAction(action); severity != "" {
+				add(key, severity, "expands_to: %s", message)
+			}
+		}
+
+		if perms.Adopts != "" {
+			if adopted, ok := db[perms.Adopts]; !ok {
+				add(key, SeverityError, "adopts %s, which has no entry", perms.Adopts)
+			} else {
+				lifecycle := lifecycleActions(adopted.Actions)
+				for _, action := range perms.Actions {
+					if lifecycle[strings.ToLower(action)] {
+						add(key, SeverityWarning, "%s creates or deletes the adopted %s and is never granted", action, perms.Adopts)
+					}
+				}
+			}
+		}
+
+		if perms.ReadsSecretValue && !strings.HasPrefix(key, KindData.addressPrefix()) && !strings.HasPrefix(key, KindEphemeral.addressPrefix()) {
+			add(key, SeverityError, "reads_secret_value is only for data sources and ephemeral resources")
+		}
+
+		if len(perms.Actions) > 0 && len(perms.ResourceTypes) == 0 {
+			// Data source lookups are mostly list and describe calls
+			// that have no resource type to name
+			if strings.HasPrefix(key, KindData.addressPrefix()) || strings.HasPrefix(key, KindEphemeral.addressPrefix()) {
+				add(key, SeverityWarning, "resource_types is empty")
+			} else {
+				add(key, SeverityError, "resource_types is empty")
+			}
+		}
+
+		for _, template := range perms.allARNTemplates() {
+			if message := checkARNTemplate(template); message != "" {
+				add(key, SeverityError, "%s", message)
+			}
+		}
+		if len(perms.ARNTemplates) > 0 && perms.ARNTemplate == "" {
+			add(key, SeverityError, "arn_templates without an arn_template")
+		}
+	}
+
+	sort.SliceStable(findings, func(a, b int) bool {
+		if findings[a].Entry != findings[b].Entry {
+			return findings[a].Entry < findings[b].Entry
+		}
+		return findings[a].Message < findings[b].Message
+	})
+	return findings
+}
+
+// checkARNTemplate renders template for a resource without attributes, so
+// every attribute placeholder becomes "*", and checks that the result is a
+// well-formed ARN.
+func checkARNTemplate(template string) string {
+	rendered := renderARNTemplate(template, &Resource{}, arnContext{Partition: "aws", Region: "us-east-1", Account: "123456789012"})
+	if strings.Contains(rendered, "${") {
+		return fmt.Sprintf("arn_template %q has a malformed placeholder", template)
+	}
+	if message := checkARN(rendered); message != "" {
+		return fmt.Sprintf("arn_template %q: %s", template, message)
+	}
+	return ""
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestPermissionsDBValid runs `db validate` over the embedded database so bad
+// edits to permissions.json fail before release. The catalog marks every
+// service partial, which makes unknown actions warnings; they still fail here
+// because the catalog is seeded from this database.
+func TestPermissionsDBValid(t *testing.T) {
+	if err := loadPermissionsDB(); err != nil {
+		t.Fatalf("Error loading permissions DB: %v", err)
+	}
+	if err := loadActionCatalog(); err != nil {
+		t.Fatalf("Error loading action catalog: %v", err)
+	}
+
+	for _, finding := range validatePermissionsDB(permissionsDB, permissionAliases) {
+		if finding.Severity == SeverityError || strings.Contains(finding.Message, "unknown") {
+			t.Errorf("%s: %s: %s", finding.Entry, finding.Severity, finding.Message)
+		}
+	}
+}
+
+func TestPermissionPluginFixturesValid(t *testing.T) {
+	usePermissionPlugins(t, "test-fixtures/plugins/permissions.d")
+	if err := loadActionCatalog(); err != nil {
+		t.Fatalf("Error loading action catalog: %v", err)
+	}
+
+	for _, finding := range validatePermissionsDB(permissionsDB, permissionAliases) {
+		if finding.Severity == SeverityError {
+			t.Errorf("%s: %s", finding.Entry, finding.Message)
+		}
+	}
+}
+
+func TestValidatePermissionsDB(t *testing.T) {
+	if err := loadActionCatalog(); err != nil {
+		t.Fatalf("Error loading action catalog: %v", err)
+	}
+
+	db := PermissionMap{
+		"aws_s3_bucket": {
+			Actions:       []string{"s3:CreateBucket", "s3:createbucket", "s3:CreateBuckett", "s3"},
+			ResourceTypes: []string{"bucket_name"},
+			ARNTemplate:   "arn:${partition}:s3:::${bucket",
+		},
+		"aws_sqs_queue": {
+			Actions:     []string{"sqs:CreateQueue"},
+			ARNTemplate: "arn:${partition}:sqs",
+			Companions:  []CompanionPermissions{{When: "kms_master_key_id", Actions: []string{"kms:Nope"}}},
+		},
+		"data.aws_region": {
+			Actions: []string{"ec2:DescribeRegions"},
+		},
+		"aws_ssm_parameter": {
+			Actions:          []string{"ssm:PutParameter"},
+			ResourceTypes:    []string{"parameter"},
+			ReadsSecretValue: true,
+		},
+		"aws_default_vpc": {
+			Actions:       []string{"ec2:CreateVpc", "ec2:ModifyVpcAttribute"},
+			ResourceTypes: []string{"vpc_id"},
+			Adopts:        "aws_vpc",
+		},
+		"aws_default_subnet": {
+			Actions:       []string{"ec2:ModifySubnetAttribute"},
+			ResourceTypes: []string{"subnet_id"},
+			Adopts:        "aws_subnet",
+		},
+		"aws_vpc": {
+			Actions:       []string{"ec2:CreateVpc", "ec2:DeleteVpc"},
+			ResourceTypes: []string{"vpc_id"},
+		},
+		"service.s3": {},
+	}
+
+	var got []string
+	for _, finding := range validatePermissionsDB(db, nil) {
+		got = append(got, finding.Entry+": "+finding.Severity+": "+finding.Message)
+	}
+
+	want := []string{
+		"aws_default_subnet: error: adopts aws_subnet, which has no entry",
+		"aws_default_vpc: warning: ec2:CreateVpc creates or deletes the adopted aws_vpc and is never granted",
+		"aws_s3_bucket: error: arn_template \"arn:${partition}:s3:::${bucket\" has a malformed placeholder",
+		"aws_s3_bucket: error: duplicate action s3:createbucket (already listed as s3:CreateBucket)",
+		"aws_s3_bucket: error: malformed action \"s3\": expected service:ActionName",
+		"aws_s3_bucket: error: unknown action s3:CreateBuckett (did you mean s3:CreateBucket?)",
+		"aws_sqs_queue: error: arn_template \"arn:${partition}:sqs\": malformed ARN \"arn:aws:sqs\": expected arn:partition:service:region:account:resource",
+		"aws_sqs_queue: warning: companion: unknown action kms:Nope",
+		"aws_sqs_queue: error: resource_types is empty",
+		"aws_ssm_parameter: error: reads_secret_value is only for data sources and ephemeral resources",
+		"data.aws_region: warning: resource_types is empty",
+		"service.s3: error: service default has no arn_template",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Unexpected findings:\n%s\n\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+var noDestroyPermissionsFlag bool
+
+// DestroyAction is a destructive action in the policy and the resources
+// whose destroy needs it.
+type DestroyAction struct {
+	Action    string   `json:"action"`
+	Resources []string `json:"resources"`
+}
+
+// isDestroyAction reports whether action only takes infrastructure away:
+// Delete* and Terminate* calls and kms:ScheduleKeyDeletion. Tag removals
+// are left out, since updates that drop a tag make them too.
+func isDestroyAction(action string) bool {
+	service, name, _ := strings.Cut(action, ":")
+	if strings.EqualFold(service, "kms") && strings.EqualFold(name, "ScheduleKeyDeletion") {
+		return true
+	}
+	lower := strings.ToLower(name)
+	if strings.HasSuffix(lower, "tags") || strings.HasSuffix(lower, "tagging") {
+		return false
+	}
+	return strings.HasPrefix(lower, "delete") || strings.HasPrefix(lower, "terminate")
+}
+
+// destroyActions returns the destructive actions the resources in result
+// need, sorted, each with the resources that need it. Data sources only read
+// and never contribute one. Actions the state backend needs are left out:
+// releasing the state lock (dynamodb:DeleteItem, s3:DeleteObject) is part
+// of every apply.
+func destroyActions(result *ParseResult, includeStateBackend bool) []DestroyAction {
+	backendActions := make(map[string]bool)
+	if includeStateBackend {
+		for _, backend := range stateBackends(result) {
+			addBackendPermissions(backendActions, backend)
+		}
+	}
+	resources := make(map[string][]string)
+	for _, contribution := range collectContributions(result) {
+		if contribution.Kind != KindResource {
+			continue
+		}
+		for _, action := range contribution.Actions {
+			if isDestroyAction(action) && !backendActions[action] && !containsString(resources[action], contribution.Address) {
+				resources[action] = append(resources[action], contribution.Address)
+			}
+		}
+	}
+	list := make([]DestroyAction, 0, len(resources))
+	for action, addresses := range resources {
+		list = append(list, DestroyAction{Action: action, Resources: addresses})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Action < list[j].Action })
+	return list
+}
+
+// omitDestroyPermissions removes the destroy actions from the Allow
+// statements of policy (--no-destroy-permissions). A generated wildcard such
+// as ec2:* that covers one is expanded into the remaining catalog actions.
+func omitDestroyPermissions(policy IAMPolicy, destroy []DestroyAction) IAMPolicy {
+	actions := make([]string, 0, len(destroy))
+	for _, action := range destroy {
+		actions = append(actions, action.Action)
+	}
+	policy, _ = excludeActions(policy, actions)
+	return policy
+}
+
+// printDestroyActions lists the destructive actions in the run summary with
+// the resources that need them, so reviewers see at a glance what the policy
+// allows to be torn down.
+func printDestroyActions(actions []DestroyAction) {
+	if len(actions) == 0 {
+		return
+	}
+	if noDestroyPermissionsFlag {
+		fmt.Fprintf(os.Stderr, "  Destroy-only actions: %d omitted (--no-destroy-permissions; terraform destroy will fail)\n", len(actions))
+	} else {
+		fmt.Fprintf(os.Stderr, "  Destroy-only actions: %d (use --no-destroy-permissions to omit them)\n", len(actions))
+	}
+	for _, action := range actions {
+		fmt.Fprintf(os.Stderr, "    - %s: %s\n", action.Action, strings.Join(action.Resources, ", "))
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestIsDestroyAction(t *testing.T) {
+	tests := map[string]bool{
+		"s3:DeleteBucket":         true,
+		"ec2:TerminateInstances":  true,
+		"kms:ScheduleKeyDeletion": true,
+		"KMS:schedulekeydeletion": true,
+		"ec2:DeleteTags":          false,
+		"s3:DeleteBucketTagging":  false,
+		"s3:CreateBucket":         false,
+		"kms:CancelKeyDeletion":   false,
+		"ec2:DescribeInstances":   false,
+	}
+	for action, want := range tests {
+		if got := isDestroyAction(action); got != want {
+			t.Errorf("isDestroyAction(%s) = %v, want %v", action, got, want)
+		}
+	}
+}
+
+func TestDestroyActions(t *testing.T) {
+	if err := loadPermissionsDB(); err != nil {
+		t.Fatalf("Error loading permissions DB: %v", err)
+	}
+	result, err := parseTerraformFiles("test-fixtures/backend")
+	if err != nil {
+		t.Fatalf("Error parsing fixture: %v", err)
+	}
+
+	destroy := destroyActions(result, true)
+	byAction := make(map[string][]string)
+	for _, action := range destroy {
+		byAction[action.Action] = action.Resources
+	}
+	if resources := byAction["dynamodb:DeleteTable"]; len(resources) != 1 || resources[0] != "aws_dynamodb_table.users" {
+		t.Errorf("Expected dynamodb:DeleteTable for aws_dynamodb_table.users, got %v", resources)
+	}
+	// The state lock is released with these on every apply
+	for _, action := range []string{"dynamodb:DeleteItem", "s3:DeleteObject"} {
+		if _, ok := byAction[action]; ok {
+			t.Errorf("Expected the backend's %s not to count as a destroy action", action)
+		}
+	}
+
+	policy := omitDestroyPermissions(buildIAMPolicy(result, true, false), destroy)
+	actions := allowedActions(policy)
+	for _, action := range destroy {
+		if containsString(actions, action.Action) {
+			t.Errorf("Expected %s to be omitted", action.Action)
+		}
+	}
+	for _, want := range []string{"dynamodb:CreateTable", "dynamodb:DeleteItem", "s3:DeleteObject"} {
+		if !containsString(actions, want) {
+			t.Errorf("Expected %s to be kept, got %v", want, actions)
+		}
+	}
+}
+
+func TestOmitDestroyPermissionsExpandsWildcards(t *testing.T) {
+	policy := IAMPolicy{Statement: []IAMStatement{{Effect: "Allow", Action: []string{"sqs:*"}, Resource: "*"}}}
+	destroy := []DestroyAction{{Action: "sqs:DeleteQueue", Resources: []string{"aws_sqs_queue.jobs"}}}
+
+	actions := allowedActions(omitDestroyPermissions(policy, destroy))
+	if containsString(actions, "sqs:*") || containsString(actions, "sqs:DeleteQueue") {
+		t.Errorf("Expected sqs:* to be expanded without sqs:DeleteQueue, got %v", actions)
+	}
+	if !containsString(actions, "sqs:CreateQueue") {
+		t.Errorf("Expected the other sqs actions to be kept, got %v", actions)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/cobra/doc"
+)
+
+var docsDirFlag string
+
+var docsCmd = &cobra.Command{
+	Use:   "docs",
+	Short: "Generate man pages and markdown CLI reference",
+	Long: `Generate documentation for every tf-iam-scanner command.
+
+  tf-iam-scanner docs man      --dir ./man        # section 1 man pages
+  tf-iam-scanner docs markdown --dir ./docs/cli   # CLI reference markdown`,
+}
+
+var docsManCmd = &cobra.Command{
+	Use:   "man",
+	Short: "Generate man pages",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := os.MkdirAll(docsDirFlag, 0755); err != nil {
+			return fmt.Errorf("error creating %s: %w", docsDirFlag, err)
+		}
+		header := &doc.GenManHeader{
+			Title:   "TF-IAM-SCANNER",
+			Section: "1",
+		}
+		if err := doc.GenManTree(rootCmd, header, docsDirFlag); err != nil {
+			return fmt.Errorf("error generating man pages: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "Man pages written to: %s\n", docsDirFlag)
+		return nil
+	},
+}
+
+var docsMarkdownCmd = &cobra.Command{
+	Use:   "markdown",
+	Short: "Generate markdown CLI reference",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := os.MkdirAll(docsDirFlag, 0755); err != nil {
+			return fmt.Errorf("error creating %s: %w", docsDirFlag, err)
+		}
+		if err := doc.GenMarkdownTree(rootCmd, docsDirFlag); err != nil {
+			return fmt.Errorf("error generating markdown: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "Markdown reference written to: %s\n", docsDirFlag)
+		return nil
+	},
+}
+
+func init() {
+	// Keep generated files stable so they can be committed and diffed
+	rootCmd.DisableAutoGenTag = true
+
+	docsCmd.PersistentFlags().StringVar(&docsDirFlag, "dir", "docs", "Directory to write generated documentation to")
+	docsCmd.AddCommand(docsManCmd, docsMarkdownCmd)
+	rootCmd.AddCommand(docsCmd)
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDocsGeneration(t *testing.T) {
+	for _, tc := range []struct {
+		cmd  string
+		file string
+	}{
+		{"man", "tf-iam-scanner.1"},
+		{"markdown", "tf-iam-scanner_scan.md"},
+	} {
+		dir := filepath.Join(t.TempDir(), "out")
+		rootCmd.SetArgs([]string{"docs", tc.cmd, "--dir", dir})
+		if err := rootCmd.Execute(); err != nil {
+			t.Fatalf("docs %s failed: %v", tc.cmd, err)
+		}
+		if _, err := os.Stat(filepath.Join(dir, tc.file)); err != nil {
+			t.Errorf("Expected docs %s to write %s: %v", tc.cmd, tc.file, err)
+		}
+	}
+	rootCmd.SetArgs(nil)
+}
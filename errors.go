@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Exit codes of failed runs, the contract CI scripts rely on besides the
+// gate, verification and cancellation codes. Any other error exits 1.
+const (
+	exitError            = 1
+	exitParseError       = 2
+	exitStrictUnmapped   = 3
+	exitValidationFailed = 4
+)
+
+// ParseError is returned when the Terraform input (a directory, plan file or
+// baseline policy) cannot be read or parsed.
+type ParseError struct {
+	Source string
+	Err    error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("parsing %s: %v", e.Source, e.Err)
+}
+
+func (e *ParseError) Unwrap() error { return e.Err }
+
+// DBError is returned when the permissions DB, a --permissions-dir mapping or
+// the provider schema cannot be loaded.
+type DBError struct {
+	Source string
+	Err    error
+}
+
+func (e *DBError) Error() string {
+	return fmt.Sprintf("loading %s: %v", e.Source, e.Err)
+}
+
+func (e *DBError) Unwrap() error { return e.Err }
+
+// OutputError is returned when the policy or one of the files written next
+// to it cannot be generated or written.
+type OutputError struct {
+	Path string // the file being written, or "" for stdout
+	Err  error  // names the file itself
+}
+
+func (e *OutputError) Error() string {
+	return fmt.Sprintf("writing output: %v", e.Err)
+}
+
+func (e *OutputError) Unwrap() error { return e.Err }
+
+// ValidationError is returned for invalid flags or configuration, and for a
+// generated policy that is not valid IAM policy grammar.
+type ValidationError struct {
+	Err error
+}
+
+func (e *ValidationError) Error() string { return e.Err.Error() }
+
+func (e *ValidationError) Unwrap() error { return e.Err }
+
+// validationErrorf formats a ValidationError.
+func validationErrorf(format string, args ...any) error {
+	return &ValidationError{Err: fmt.Errorf(format, args...)}
+}
+
+// exitCode is the exit code of a run that failed with err.
+func exitCode(err error) int {
+	var parseErr *ParseError
+	var validationErr *ValidationError
+	switch {
+	case errors.As(err, &parseErr):
+		return exitParseError
+	case errors.As(err, &validationErr):
+		return exitValidationFailed
+	default:
+		return exitError
+	}
+}
+
+// exitWithError prints err and exits with its exit code. Steps shared by
+// several commands call it where they cannot return the error.
+func exitWithError(err error) {
+	fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	exitRun(exitCode(err))
+}
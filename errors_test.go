@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestExitCode(t *testing.T) {
+	cause := errors.New("boom")
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"parse", &ParseError{Source: "plan.json", Err: cause}, exitParseError},
+		{"wrapped parse", fmt.Errorf("root a: %w", &ParseError{Source: "a/main.tf", Err: cause}), exitParseError},
+		{"validation", validationErrorf("--split-read-write needs --least-privilege"), exitValidationFailed},
+		{"db", &DBError{Source: "the permissions DB", Err: cause}, exitError},
+		{"output", &OutputError{Path: "policy.json", Err: cause}, exitError},
+		{"plain", cause, exitError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := exitCode(tt.err); got != tt.want {
+				t.Errorf("exitCode() = %d, want %d", got, tt.want)
+			}
+			if !errors.Is(tt.err, cause) && tt.name != "validation" {
+				t.Errorf("%v does not unwrap to its cause", tt.err)
+			}
+		})
+	}
+}
+
+func TestErrorMessages(t *testing.T) {
+	cause := errors.New("policy.json already exists (use --force to overwrite)")
+	if got, want := (&OutputError{Path: "policy.json", Err: cause}).Error(), "writing output: policy.json already exists (use --force to overwrite)"; got != want {
+		t.Errorf("OutputError = %q, want %q", got, want)
+	}
+	if got, want := (&ParseError{Source: "plan.json", Err: errors.New("unexpected EOF")}).Error(), "parsing plan.json: unexpected EOF"; got != want {
+		t.Errorf("ParseError = %q, want %q", got, want)
+	}
+	if got, want := validationErrorf("invalid format %s", "toml").Error(), "invalid format toml"; got != want {
+		t.Errorf("ValidationError = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+var excludeActionsFlag []string
+
+// validateExcludePatterns checks that every action exclusion is a
+// service:Action pattern. A bare "*" is refused since it would empty the
+// policy.
+func validateExcludePatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if !actionPattern.MatchString(pattern) {
+			return fmt.Errorf("invalid action exclusion %q: expected service:Action, e.g. iam:Delete*", pattern)
+		}
+	}
+	return nil
+}
+
+// excludedAction records an action removed from a policy and the exclusion
+// pattern that removed it.
+type excludedAction struct {
+	Action  string
+	Pattern string
+}
+
+// excludeActions removes the actions matching any of patterns (IAM wildcards,
+// case-insensitive) from the Allow statements of policy and drops statements
+// left without actions. A generated wildcard action that covers an excluded
+// action is replaced by the catalog actions it matches, minus the excluded
+// ones. It returns the filtered policy and the removed actions, sorted.
+func excludeActions(policy IAMPolicy, patterns []string) (IAMPolicy, []excludedAction) {
+	if len(patterns) == 0 {
+		return policy, nil
+	}
+	if actionCatalog == nil {
+		_ = loadActionCatalog()
+	}
+
+	matching := func(action string) string {
+		for _, pattern := range patterns {
+			if iamWildcardMatch(pattern, action, true) {
+				return pattern
+			}
+		}
+		return ""
+	}
+
+	removed := make(map[string]excludedAction)
+	filtered := IAMPolicy{Version: policy.Version, Id: policy.Id}
+	for _, statement := range policy.Statement {
+		if statement.Effect != "Allow" || statement.Action == nil {
+			filtered.Statement = append(filtered.Statement, statement)
+			continue
+		}
+
+		var kept []string
+		for _, action := range toStringSlice(statement.Action) {
+			if pattern := matching(action); pattern != "" {
+				removed[action] = excludedAction{Action: action, Pattern: pattern}
+				continue
+			}
+			if !strings.ContainsAny(action, "*?") {
+				kept = append(kept, action)
+				continue
+			}
+
+			expanded := expandActionPattern(action)
+			overlaps := false
+			for _, candidate := range expanded {
+				if matching(candidate) != "" {
+					overlaps = true
+					break
+				}
+			}
+			if !overlaps {
+				kept = append(kept, action)
+				continue
+			}
+			for _, candidate := range expanded {
+				if pattern := matching(candidate); pattern != "" {
+					removed[candidate] = excludedAction{Action: candidate, Pattern: pattern}
+				} else {
+					kept = append(kept, candidate)
+				}
+			}
+		}
+
+		if len(kept) == 0 {
+			continue
+		}
+		statement.Action = kept
+		filtered.Statement = append(filtered.Statement, statement)
+	}
+
+	list := make([]excludedAction, 0, len(removed))
+	for _, excluded := range removed {
+		list = append(list, excluded)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Action < list[j].Action })
+	return filtered, list
+}
+
+// printExcludedActions warns on stderr about every action removed by the
+// exclusions. The policy no longer covers everything the configuration
+// needs, so the warning is hard to miss on purpose.
+func printExcludedActions(excluded []excludedAction) {
+	if len(excluded) == 0 {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "\n========================================================================\n")
+	fmt.Fprintf(os.Stderr, "WARNING: %d action(s) excluded from the generated policy:\n", len(excluded))
+	for _, e := range excluded {
+		fmt.Fprintf(os.Stderr, "  - %s (excluded by %s)\n", e.Action, e.Pattern)
+	}
+	fmt.Fprintf(os.Stderr, "Terraform operations that need them will fail with AccessDenied.\n")
+	fmt.Fprintf(os.Stderr, "========================================================================\n")
+}
+
+// excludedActionNames returns the names of the removed actions.
+func excludedActionNames(excluded []excludedAction) []string {
+	names := make([]string, 0, len(excluded))
+	for _, e := range excluded {
+		names = append(names, e.Action)
+	}
+	return names
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestValidateExcludePatterns(t *testing.T) {
+	if err := validateExcludePatterns([]string{"iam:Delete*", "kms:ScheduleKeyDeletion", "s3:*"}); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	for _, pattern := range []string{"*", "iam", "iam:", "Delete*"} {
+		if err := validateExcludePatterns([]string{pattern}); err == nil {
+			t.Errorf("Expected an error for %q", pattern)
+		}
+	}
+}
+
+func TestExcludeActions(t *testing.T) {
+	policy := IAMPolicy{
+		Version: "2012-10-17",
+		Statement: []IAMStatement{
+			{
+				Effect:   "Allow",
+				Action:   []string{"iam:CreateRole", "iam:DeleteRole", "iam:DeleteRolePolicy"},
+				Resource: "arn:aws:iam::*:role/*",
+			},
+			{
+				Effect:   "Allow",
+				Action:   []string{"kms:ScheduleKeyDeletion"},
+				Resource: "*",
+			},
+			{
+				Effect:   "Deny",
+				Action:   []string{"iam:DeleteUser"},
+				Resource: "*",
+			},
+		},
+	}
+
+	filtered, excluded := excludeActions(policy, []string{"iam:delete*", "kms:ScheduleKeyDeletion"})
+
+	if len(filtered.Statement) != 2 {
+		t.Fatalf("Expected the emptied statement to be dropped, got %+v", filtered.Statement)
+	}
+	if actions := toStringSlice(filtered.Statement[0].Action); len(actions) != 1 || actions[0] != "iam:CreateRole" {
+		t.Errorf("Unexpected remaining actions: %v", actions)
+	}
+	if filtered.Statement[1].Effect != "Deny" {
+		t.Errorf("Deny statements must be left alone")
+	}
+
+	names := excludedActionNames(excluded)
+	want := []string{"iam:DeleteRole", "iam:DeleteRolePolicy", "kms:ScheduleKeyDeletion"}
+	if len(names) != len(want) {
+		t.Fatalf("Expected %v excluded, got %v", want, names)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Errorf("Expected %v excluded, got %v", want, names)
+		}
+	}
+	if excluded[0].Pattern != "iam:delete*" {
+		t.Errorf("Expected the matching pattern to be recorded, got %q", excluded[0].Pattern)
+	}
+
+	unchanged, none := excludeActions(policy, nil)
+	if len(unchanged.Statement) != 3 || none != nil {
+		t.Errorf("No patterns should leave the policy unchanged")
+	}
+}
+
+func TestExcludeActionsExpandsWildcards(t *testing.T) {
+	if err := loadActionCatalog(); err != nil {
+		t.Fatalf("Error loading action catalog: %v", err)
+	}
+
+	policy := IAMPolicy{
+		Version: "2012-10-17",
+		Statement: []IAMStatement{{
+			Effect:   "Allow",
+			Action:   []string{"kms:*", "s3:GetObject"},
+			Resource: "*",
+		}},
+	}
+
+	filtered, excluded := excludeActions(policy, []string{"kms:ScheduleKeyDeletion"})
+
+	if len(excluded) != 1 || excluded[0].Action != "kms:ScheduleKeyDeletion" {
+		t.Errorf("Unexpected exclusions: %+v", excluded)
+	}
+	actions := toStringSlice(filtered.Statement[0].Action)
+	if containsString(actions, "kms:*") || containsString(actions, "kms:ScheduleKeyDeletion") {
+		t.Errorf("Wildcard covering an excluded action should be expanded: %v", actions)
+	}
+	if !containsString(actions, "kms:CreateKey") || !containsString(actions, "s3:GetObject") {
+		t.Errorf("Expected the other actions to be kept: %v", actions)
+	}
+
+	_, excluded = excludeActions(policy, []string{"iam:Delete*"})
+	if len(excluded) != 0 {
+		t.Errorf("Non-overlapping exclusions should remove nothing: %+v", excluded)
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// csvHeader is the column layout shared by the CSV and XLSX exports.
+var csvHeader = []string{"service", "action", "resource_arn", "terraform_address", "location"}
+
+// actionRow is one (action, resource) pairing in the tabular exports.
+type actionRow struct {
+	Service  string
+	Action   string
+	ARN      string
+	Address  string
+	Location string
+}
+
+func (r actionRow) fields() []string {
+	return []string{r.Service, r.Action, r.ARN, r.Address, r.Location}
+}
+
+// buildActionRows pairs every policy action with the Terraform resources that
+// require it. The ARN is the resource's own rendered ARN when its template
+// targets the action's service, otherwise the Resource of the policy
+// statement granting the action. Actions not contributed by any resource
+// (state backend, provider initialization) get a row with no address.
+func buildActionRows(policy IAMPolicy, result *ParseResult) []actionRow {
+	statementARNs := make(map[string][]string)
+	for _, statement := range policy.Statement {
+		if statement.Effect != "Allow" {
+			continue
+		}
+		for _, action := range toStringSlice(statement.Action) {
+			statementARNs[action] = append(statementARNs[action], toStringSlice(statement.Resource)...)
+		}
+	}
+
+	var rows []actionRow
+	attributed := make(map[string]bool)
+
+	if result != nil {
+		for _, contribution := range collectContributions(result) {
+			for _, action := range contribution.Actions {
+				if _, granted := statementARNs[action]; !granted {
+					continue
+				}
+				service := strings.SplitN(action, ":", 2)[0]
+				arn := strings.Join(statementARNs[action], " ")
+				if contribution.ARN != "" && arnTemplateService(contribution.ARN) == service {
+					arn = contribution.ARN
+				}
+				rows = append(rows, actionRow{
+					Service:  service,
+					Action:   action,
+					ARN:      arn,
+					Address:  contribution.Address,
+					Location: contribution.Location,
+				})
+				attributed[action] = true
+			}
+		}
+	}
+
+	for action, arns := range statementARNs {
+		if attributed[action] {
+			continue
+		}
+		rows = append(rows, actionRow{
+			Service: strings.SplitN(action, ":", 2)[0],
+			Action:  action,
+			ARN:     strings.Join(arns, " "),
+		})
+	}
+
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Action != rows[j].Action {
+			return rows[i].Action < rows[j].Action
+		}
+		return rows[i].Address < rows[j].Address
+	})
+	return rows
+}
+
+// generateCSV renders the action-to-resource mapping as CSV.
+func generateCSV(policy IAMPolicy, result *ParseResult) (string, error) {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+
+	if err := writer.Write(csvHeader); err != nil {
+		return "", fmt.Errorf("error writing CSV: %w", err)
+	}
+	for _, row := range buildActionRows(policy, result) {
+		if err := writer.Write(row.fields()); err != nil {
+			return "", fmt.Errorf("error writing CSV: %w", err)
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return "", fmt.Errorf("error writing CSV: %w", err)
+	}
+
+	return buf.String(), nil
+}
+
+// generateXLSX renders the action-to-resource mapping as an Excel workbook
+// with one sheet per service. The workbook is written directly as
+// SpreadsheetML using inline strings, which every spreadsheet application
+// reads without a shared-strings table.
+func generateXLSX(policy IAMPolicy, result *ParseResult) (string, error) {
+	rowsByService := make(map[string][]actionRow)
+	for _, row := range buildActionRows(policy, result) {
+		rowsByService[row.Service] = append(rowsByService[row.Service], row)
+	}
+	services := make([]string, 0, len(rowsByService))
+	for service := range rowsByService {
+		services = append(services, service)
+	}
+	sort.Strings(services)
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+
+	files := []struct {
+		name    string
+		content string
+	}{
+		{"[Content_Types].xml", xlsxContentTypes(len(services))},
+		{"_rels/.rels", xlsxRootRels},
+		{"xl/workbook.xml", xlsxWorkbook(services)},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels(len(services))},
+	}
+	for i, service := range services {
+		files = append(files, struct {
+			name    string
+			content string
+		}{fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1), xlsxSheet(rowsByService[service])})
+	}
+
+	for _, file := range files {
+		w, err := archive.Create(file.name)
+		if err != nil {
+			return "", fmt.Errorf("error writing XLSX: %w", err)
+		}
+		if _, err := w.Write([]byte(file.content)); err != nil {
+			return "", fmt.Errorf("error writing XLSX: %w", err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return "", fmt.Errorf("error writing XLSX: %w", err)
+	}
+
+	return buf.String(), nil
+}
+
+const xlsxRootRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>
+</Relationships>`
+
+func xlsxContentTypes(sheets int) string {
+	var sb strings.Builder
+	sb.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>
+`)
+	for i := 1; i <= sheets; i++ {
+		fmt.Fprintf(&sb, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`+"\n", i)
+	}
+	sb.WriteString("</Types>")
+	return sb.String()
+}
+
+func xlsxWorkbook(services []string) string {
+	var sb strings.Builder
+	sb.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets>
+`)
+	for i, service := range services {
+		fmt.Fprintf(&sb, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`+"\n", xmlEscape(xlsxSheetName(service)), i+1, i+1)
+	}
+	sb.WriteString("</sheets>\n</workbook>")
+	return sb.String()
+}
+
+func xlsxWorkbookRels(sheets int) string {
+	var sb strings.Builder
+	sb.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+`)
+	for i := 1; i <= sheets; i++ {
+		fmt.Fprintf(&sb, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`+"\n", i, i)
+	}
+	sb.WriteString("</Relationships>")
+	return sb.String()
+}
+
+func xlsxSheet(rows []actionRow) string {
+	var sb strings.Builder
+	sb.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<sheetData>
+`)
+	writeRow := func(fields []string) {
+		sb.WriteString("<row>")
+		for _, field := range fields {
+			fmt.Fprintf(&sb, `<c t="inlineStr"><is><t>%s</t></is></c>`, xmlEscape(field))
+		}
+		sb.WriteString("</row>\n")
+	}
+	writeRow(csvHeader)
+	for _, row := range rows {
+		writeRow(row.fields())
+	}
+	sb.WriteString("</sheetData>\n</worksheet>")
+	return sb.String()
+}
+
+// xlsxSheetName trims a service name to Excel's 31 character sheet name limit
+// and replaces characters Excel does not allow in sheet names.
+func xlsxSheetName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	if len(name) > 31 {
+		name = name[:31]
+	}
+	return name
+}
+
+func xmlEscape(s string) string {
+	var buf bytes.Buffer
+	_ = xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
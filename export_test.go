@@ -0,0 +1,102 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestGenerateCSV(t *testing.T) {
+	if err := loadPermissionsDB(); err != nil {
+		t.Fatalf("Error loading permissions DB: %v", err)
+	}
+
+	result := &ParseResult{
+		Resources: []Resource{
+			{Type: "aws_s3_bucket", Name: "logs", Provider: "aws", ResourceType: "aws_s3_bucket",
+				File: "main.tf", Line: 3, Attributes: map[string]cty.Value{"bucket": cty.StringVal("my-logs")}},
+		},
+	}
+
+	out, err := generateIAMPolicy(result, false, FormatCSV, true)
+	if err != nil {
+		t.Fatalf("Error generating CSV: %v", err)
+	}
+
+	records, err := csv.NewReader(strings.NewReader(out)).ReadAll()
+	if err != nil {
+		t.Fatalf("Error reading generated CSV: %v", err)
+	}
+	if strings.Join(records[0], ",") != strings.Join(csvHeader, ",") {
+		t.Errorf("Unexpected header: %v", records[0])
+	}
+
+	found := false
+	for _, record := range records[1:] {
+		if record[1] == "s3:CreateBucket" {
+			found = true
+			if record[2] != "arn:aws:s3:::my-logs" || record[3] != "aws_s3_bucket.logs" || record[4] != "main.tf:3" {
+				t.Errorf("Unexpected row for s3:CreateBucket: %v", record)
+			}
+		}
+	}
+	if !found {
+		t.Error("Expected a row for s3:CreateBucket")
+	}
+}
+
+func TestGenerateXLSX(t *testing.T) {
+	if err := loadPermissionsDB(); err != nil {
+		t.Fatalf("Error loading permissions DB: %v", err)
+	}
+
+	result := &ParseResult{
+		Resources: []Resource{
+			{Type: "aws_s3_bucket", Name: "logs", Provider: "aws", ResourceType: "aws_s3_bucket"},
+			{Type: "aws_sqs_queue", Name: "jobs", Provider: "aws", ResourceType: "aws_sqs_queue"},
+		},
+	}
+
+	out, err := generateIAMPolicy(result, false, FormatXLSX, false)
+	if err != nil {
+		t.Fatalf("Error generating XLSX: %v", err)
+	}
+
+	reader, err := zip.NewReader(strings.NewReader(out), int64(len(out)))
+	if err != nil {
+		t.Fatalf("Generated XLSX is not a valid zip: %v", err)
+	}
+
+	var workbook string
+	for _, file := range reader.File {
+		if file.Name != "xl/workbook.xml" {
+			continue
+		}
+		rc, err := file.Open()
+		if err != nil {
+			t.Fatalf("Error opening workbook: %v", err)
+		}
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		workbook = string(data)
+	}
+
+	for _, sheet := range []string{`name="s3"`, `name="sqs"`} {
+		if !strings.Contains(workbook, sheet) {
+			t.Errorf("Expected workbook to contain sheet %s", sheet)
+		}
+	}
+}
+
+func TestXLSXSheetName(t *testing.T) {
+	if got := xlsxSheetName("a/b:c"); got != "a_b_c" {
+		t.Errorf("xlsxSheetName() = %q, want %q", got, "a_b_c")
+	}
+	if got := xlsxSheetName(strings.Repeat("x", 40)); len(got) != 31 {
+		t.Errorf("Expected sheet name trimmed to 31 characters, got %d", len(got))
+	}
+}
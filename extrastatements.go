@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+)
+
+// ExtraStatement is a statement of the extra_statements setting, appended to
+// every generated policy: an action the organization always requires, such
+// as sts:GetCallerIdentity, or a guardrail such as a Deny of unencrypted S3
+// uploads. Action, NotAction, Resource and NotResource take a string or a
+// list. Principal and NotPrincipal are only decoded to be rejected: the
+// generated policy is an identity policy.
+type ExtraStatement struct {
+	Sid          string                            `yaml:"sid,omitempty"`
+	Effect       string                            `yaml:"effect"`
+	Action       interface{}                       `yaml:"action,omitempty"`
+	NotAction    interface{}                       `yaml:"not_action,omitempty"`
+	Resource     interface{}                       `yaml:"resource,omitempty"`
+	NotResource  interface{}                       `yaml:"not_resource,omitempty"`
+	Condition    map[string]map[string]interface{} `yaml:"condition,omitempty"`
+	Principal    interface{}                       `yaml:"principal,omitempty"`
+	NotPrincipal interface{}                       `yaml:"not_principal,omitempty"`
+}
+
+// extraStatements are the validated extra_statements of the configuration.
+var extraStatements []IAMStatement
+
+// conditionOperatorPattern matches IAM condition operators, with their set
+// and IfExists qualifiers.
+var conditionOperatorPattern = regexp.MustCompile(`^((ForAllValues|ForAnyValue):)?[A-Za-z]+$`)
+
+// validateExtraStatements checks the extra_statements of the configuration
+// and returns them as policy statements, with warnings for actions the
+// catalog does not know in services it only partly covers.
+func validateExtraStatements(extras []ExtraStatement) ([]IAMStatement, []string, error) {
+	if actionCatalog == nil {
+		_ = loadActionCatalog()
+	}
+	var statements []IAMStatement
+	var warnings []string
+	sids := make(map[string]bool)
+	for i, extra := range extras {
+		name := fmt.Sprintf("extra statement %d", i+1)
+		if extra.Sid != "" {
+			name += fmt.Sprintf(" (%s)", extra.Sid)
+		}
+		fail := func(format string, args ...interface{}) ([]IAMStatement, []string, error) {
+			return nil, nil, fmt.Errorf("%s: %s", name, fmt.Sprintf(format, args...))
+		}
+
+		if extra.Principal != nil || extra.NotPrincipal != nil {
+			return fail("principal and not_principal are not allowed: the generated policy is an identity policy")
+		}
+		if extra.Effect != "Allow" && extra.Effect != "Deny" {
+			return fail("invalid effect %q: expected Allow or Deny", extra.Effect)
+		}
+		if !sidPattern.MatchString(extra.Sid) {
+			return fail("sid may only contain letters and digits")
+		}
+		if extra.Sid != "" {
+			if sids[extra.Sid] {
+				return fail("sid is used by another extra statement")
+			}
+			sids[extra.Sid] = true
+		}
+		if (extra.Action == nil) == (extra.NotAction == nil) {
+			return fail("expected exactly one of action and not_action")
+		}
+		if (extra.Resource == nil) == (extra.NotResource == nil) {
+			return fail("expected exactly one of resource and not_resource")
+		}
+
+		statement := IAMStatement{
+			Sid:         extra.Sid,
+			Effect:      extra.Effect,
+			Action:      normalizePolicyElement(extra.Action),
+			NotAction:   normalizePolicyElement(extra.NotAction),
+			Resource:    normalizePolicyElement(extra.Resource),
+			NotResource: normalizePolicyElement(extra.NotResource),
+		}
+		for _, element := range []interface{}{statement.Action, statement.NotAction, statement.Resource, statement.NotResource} {
+			if element != nil && len(toStringSlice(element)) == 0 {
+				return fail("action, not_action, resource and not_resource take a string or a non-empty list of strings")
+			}
+		}
+		for _, action := range append(toStringSlice(statement.Action), toStringSlice(statement.NotAction)...) {
+			switch severity, message := checkAction(action); severity {
+			case SeverityError:
+				return fail("%s", message)
+			case SeverityWarning:
+				warnings = append(warnings, fmt.Sprintf("%s: %s", name, message))
+			}
+		}
+		for operator, values := range extra.Condition {
+			if !conditionOperatorPattern.MatchString(operator) {
+				return fail("invalid condition operator %q", operator)
+			}
+			if len(values) == 0 {
+				return fail("condition operator %s has no keys", operator)
+			}
+			// YAML decodes false and 256 as a bool and an int; IAM
+			// compares condition values as strings either way
+			normalized := make(map[string]interface{}, len(values))
+			for key, value := range values {
+				strs := conditionValues(value)
+				if key == "" || len(strs) == 0 {
+					return fail("condition operator %s needs a key and at least one value", operator)
+				}
+				if len(strs) == 1 {
+					normalized[key] = strs[0]
+				} else {
+					normalized[key] = strs
+				}
+			}
+			if statement.Condition == nil {
+				statement.Condition = make(map[string]map[string]interface{})
+			}
+			statement.Condition[operator] = normalized
+		}
+		statements = append(statements, statement)
+	}
+	return statements, warnings, nil
+}
+
+// appendExtraStatements appends the extra statements to policy and returns
+// the names of those it left out because the generated policy already has
+// them: an identical statement, or for an unconditional Allow, statements
+// granting each of its actions on all its resources. A Sid the generated
+// policy already uses is an error.
+func appendExtraStatements(policy IAMPolicy, extras []IAMStatement) (IAMPolicy, []string, error) {
+	generated := policy
+	sids := make(map[string]bool)
+	for _, statement := range generated.Statement {
+		if statement.Sid != "" {
+			sids[statement.Sid] = true
+		}
+	}
+
+	var skipped []string
+	statements := append([]IAMStatement{}, generated.Statement...)
+	for i, extra := range extras {
+		name := extra.Sid
+		if name == "" {
+			name = fmt.Sprintf("extra statement %d", i+1)
+		}
+		if generatedHas(generated, extra) {
+			skipped = append(skipped, name)
+			continue
+		}
+		if sids[extra.Sid] {
+			return policy, nil, fmt.Errorf("extra statement %s: the generated policy already has a statement with this sid", extra.Sid)
+		}
+		statements = append(statements, extra)
+	}
+	policy.Statement = statements
+	return policy, skipped, nil
+}
+
+// generatedHas reports whether generated already has extra: an identical
+// statement, or for an unconditional Allow of actions on resources, the
+// grant of every action on every resource.
+func generatedHas(generated IAMPolicy, extra IAMStatement) bool {
+	for _, statement := range generated.Statement {
+		if reflect.DeepEqual(statement, extra) {
+			return true
+		}
+	}
+	if extra.Effect != "Allow" || len(extra.Condition) > 0 || extra.NotAction != nil || extra.NotResource != nil {
+		return false
+	}
+	resources := toStringSlice(extra.Resource)
+	for _, action := range toStringSlice(extra.Action) {
+		if !baselineGrants(generated, action, resources) {
+			return false
+		}
+	}
+	return true
+}
+
+// printExtraStatements adds the extra statements to the run summary.
+func printExtraStatements(skipped []string) {
+	if len(extraStatements) == 0 {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "  Extra statements from the config: %d appended", len(extraStatements)-len(skipped))
+	if len(skipped) > 0 {
+		fmt.Fprintf(os.Stderr, ", %d already in the generated policy", len(skipped))
+	}
+	fmt.Fprintf(os.Stderr, "\n")
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateExtraStatements(t *testing.T) {
+	tests := []struct {
+		name    string
+		extra   ExtraStatement
+		wantErr string
+	}{
+		{name: "allow", extra: ExtraStatement{Sid: "CallerIdentity", Effect: "Allow", Action: "sts:GetCallerIdentity", Resource: "*"}},
+		{name: "deny with condition", extra: ExtraStatement{Effect: "Deny", Action: []interface{}{"s3:PutObject"}, Resource: "*",
+			Condition: map[string]map[string]interface{}{"Null": {"s3:x-amz-server-side-encryption": true}}}},
+		{name: "not action", extra: ExtraStatement{Effect: "Deny", NotAction: "iam:*", NotResource: "arn:aws:iam::*:role/ci"}},
+		{name: "principal", extra: ExtraStatement{Effect: "Allow", Action: "s3:GetObject", Resource: "*", Principal: "*"}, wantErr: "principal"},
+		{name: "effect", extra: ExtraStatement{Effect: "allow", Action: "s3:GetObject", Resource: "*"}, wantErr: "invalid effect"},
+		{name: "sid", extra: ExtraStatement{Sid: "caller-identity", Effect: "Allow", Action: "s3:GetObject", Resource: "*"}, wantErr: "letters and digits"},
+		{name: "action and not action", extra: ExtraStatement{Effect: "Allow", Action: "s3:GetObject", NotAction: "s3:PutObject", Resource: "*"}, wantErr: "action and not_action"},
+		{name: "no resource", extra: ExtraStatement{Effect: "Allow", Action: "s3:GetObject"}, wantErr: "resource and not_resource"},
+		{name: "empty list", extra: ExtraStatement{Effect: "Allow", Action: []interface{}{}, Resource: "*"}, wantErr: "non-empty list"},
+		{name: "malformed action", extra: ExtraStatement{Effect: "Allow", Action: "GetObject", Resource: "*"}, wantErr: "malformed action"},
+		{name: "misspelled action", extra: ExtraStatement{Effect: "Allow", Action: "s3:GetObjekt", Resource: "*"}, wantErr: "unknown action s3:GetObjekt"},
+		{name: "operator", extra: ExtraStatement{Effect: "Deny", Action: "s3:PutObject", Resource: "*",
+			Condition: map[string]map[string]interface{}{"String Equals": {"aws:RequestedRegion": "us-east-1"}}}, wantErr: "condition operator"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := validateExtraStatements([]ExtraStatement{tt.extra})
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("Expected an error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	statements, _, err := validateExtraStatements([]ExtraStatement{{Effect: "Deny", Action: "s3:PutObject", Resource: "*",
+		Condition: map[string]map[string]interface{}{"Bool": {"aws:SecureTransport": false}}}})
+	if err != nil || statements[0].Condition["Bool"]["aws:SecureTransport"] != "false" {
+		t.Errorf("Expected condition values as strings, got %+v (%v)", statements, err)
+	}
+
+	_, warnings, err := validateExtraStatements([]ExtraStatement{{Effect: "Allow", Action: "s3:FrobnicateWidgets", Resource: "*"}})
+	if err != nil || len(warnings) != 1 || !strings.Contains(warnings[0], "unknown action s3:FrobnicateWidgets") {
+		t.Errorf("Expected a warning about the unknown action, got %v (%v)", warnings, err)
+	}
+
+	duplicate := ExtraStatement{Sid: "Guardrail", Effect: "Deny", Action: "s3:DeleteBucket", Resource: "*"}
+	if _, _, err := validateExtraStatements([]ExtraStatement{duplicate, duplicate}); err == nil || !strings.Contains(err.Error(), "another extra statement") {
+		t.Errorf("Expected duplicate Sids to be refused, got %v", err)
+	}
+}
+
+func TestAppendExtraStatements(t *testing.T) {
+	generated := IAMPolicy{Statement: []IAMStatement{
+		{Sid: "S3", Effect: "Allow", Action: []string{"s3:GetObject", "s3:PutObject"}, Resource: "arn:aws:s3:::data/*"},
+		{Sid: "STS", Effect: "Allow", Action: []string{"sts:GetCallerIdentity"}, Resource: "*"},
+	}}
+	extras := []IAMStatement{
+		{Sid: "CallerIdentity", Effect: "Allow", Action: "sts:GetCallerIdentity", Resource: "*"},
+		{Sid: "DenyUnencryptedUploads", Effect: "Deny", Action: "s3:PutObject", Resource: "*",
+			Condition: map[string]map[string]interface{}{"Null": {"s3:x-amz-server-side-encryption": "true"}}},
+		{Effect: "Allow", Action: "s3:GetObject", Resource: "arn:aws:s3:::data/*"},
+		generated.Statement[0],
+	}
+
+	policy, skipped, err := appendExtraStatements(generated, extras)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(policy.Statement) != 3 || policy.Statement[2].Sid != "DenyUnencryptedUploads" {
+		t.Errorf("Expected only the Deny statement to be appended, got %+v", policy.Statement)
+	}
+	if len(skipped) != 3 || skipped[0] != "CallerIdentity" || skipped[1] != "extra statement 3" {
+		t.Errorf("Unexpected skipped statements: %v", skipped)
+	}
+	if len(generated.Statement) != 2 {
+		t.Errorf("Expected the generated policy to be left alone, got %+v", generated.Statement)
+	}
+
+	clash := []IAMStatement{{Sid: "S3", Effect: "Deny", Action: "s3:DeleteObject", Resource: "*"}}
+	if _, _, err := appendExtraStatements(generated, clash); err == nil || !strings.Contains(err.Error(), "already has a statement") {
+		t.Errorf("Expected a clashing Sid to be refused, got %v", err)
+	}
+}
+
+func TestExtraStatementsFromConfig(t *testing.T) {
+	dir := t.TempDir()
+	config := filepath.Join(dir, "config.yaml")
+	data := `extra_statements:
+  - sid: DenyUnencryptedUploads
+    effect: Deny
+    action: s3:PutObject
+    resource: "*"
+    condition:
+      "Null":
+        s3:x-amz-server-side-encryption: "true"
+`
+	if err := os.WriteFile(config, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { configFlag, extraStatements = "", nil }()
+
+	stdout, stderr := runRootCommand(t, "--path", "test-fixtures/simple", "--config", config)
+	var policy IAMPolicy
+	if err := json.Unmarshal([]byte(stdout), &policy); err != nil {
+		t.Fatalf("Invalid policy: %v", err)
+	}
+	last := policy.Statement[len(policy.Statement)-1]
+	if last.Sid != "DenyUnencryptedUploads" || last.Effect != "Deny" || last.Condition["Null"]["s3:x-amz-server-side-encryption"] != "true" {
+		t.Errorf("Expected the extra statement last, got %+v", last)
+	}
+	if !strings.Contains(stderr, "Extra statements from the config: 1 appended") {
+		t.Errorf("Expected the extra statements in the summary, got %q", stderr)
+	}
+}
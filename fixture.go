@@ -0,0 +1,335 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	fixtureSchemaFlag string
+	fixtureDirFlag    string
+	fixtureUpdateFlag bool
+)
+
+// Test fixtures of permissions DB entries live in <fixtureRootDir>/<entry>,
+// each a configuration and the least-privilege policy it is expected to get.
+const (
+	fixtureRootDir        = "test-fixtures/db"
+	fixtureConfigFile     = "main.tf"
+	fixtureExpectedPolicy = "expected-policy.json"
+)
+
+var dbTestFixtureCmd = &cobra.Command{
+	Use:   "test-fixture <resource_type>",
+	Short: "Write a test fixture and expected policy for a permissions database entry",
+	Long: `Write a minimal configuration of a resource type, or of a data source given
+as data.<type>, and the least-privilege policy the scanner generates for it,
+to test-fixtures/db/<resource_type>. go test checks every fixture there
+against its expected policy, so a fixture turns a new or changed DB entry
+into an end-to-end test.
+
+The configuration sets the arguments the provider schema (--schema, the
+output of 'terraform providers schema -json') requires, the nested blocks it
+needs at least one of, and the arguments the entry's ARN templates read,
+with placeholder values. Review and edit it, then run test-fixture again
+with --update to rewrite expected-policy.json from it. --update also
+refreshes the expected policy after the entry changes, and needs no schema.`,
+	Args: cobra.ExactArgs(1),
+	Run:  runDBTestFixture,
+}
+
+func init() {
+	dbTestFixtureCmd.Flags().StringVar(&fixtureSchemaFlag, "schema", "", "Provider schema from 'terraform providers schema -json'")
+	dbTestFixtureCmd.Flags().StringVar(&fixtureDirFlag, "dir", "", "Directory to write the fixture to (default: test-fixtures/db/<resource_type>)")
+	dbTestFixtureCmd.Flags().BoolVar(&fixtureUpdateFlag, "update", false, "Only rewrite expected-policy.json from the fixture's main.tf")
+	dbTestFixtureCmd.Flags().BoolVar(&forceFlag, "force", false, "Overwrite an existing fixture")
+	dbTestFixtureCmd.Flags().StringArrayVar(&permissionsDirFlag, "permissions-dir", nil, "Directory of extra permission mappings (.json/.yaml) to generate the policy with (repeatable)")
+	_ = dbTestFixtureCmd.MarkFlagFilename("schema", "json")
+	_ = dbTestFixtureCmd.MarkFlagDirname("dir")
+	_ = dbTestFixtureCmd.MarkFlagDirname("permissions-dir")
+	dbCmd.AddCommand(dbTestFixtureCmd)
+}
+
+func runDBTestFixture(cmd *cobra.Command, args []string) {
+	if err := loadPermissionsDB(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := loadPermissionPlugins(permissionsDirFlag); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	entry := args[0]
+	dir := fixtureDirFlag
+	if dir == "" {
+		dir = filepath.Join(fixtureRootDir, entry)
+	}
+	configFile := filepath.Join(dir, fixtureConfigFile)
+
+	if !fixtureUpdateFlag {
+		if fixtureSchemaFlag == "" {
+			fmt.Fprintf(os.Stderr, "Error: --schema is required to write a new fixture (use --update to refresh an existing one)\n")
+			os.Exit(1)
+		}
+		provider, err := readAWSProviderSchema(fixtureSchemaFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		config, err := fixtureConfig(entry, provider)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if err := writeOutputFile(configFile, []byte(config), 0644, forceFlag); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "Fixture written to: %s\n", configFile)
+	}
+
+	policy, err := fixturePolicy(dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	// The expected policy follows the configuration it was generated from
+	if err := writeOutputFile(filepath.Join(dir, fixtureExpectedPolicy), policy, 0644, true); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Fprintf(os.Stderr, "Expected policy written to: %s\n", filepath.Join(dir, fixtureExpectedPolicy))
+	if !fixtureUpdateFlag {
+		fmt.Fprintf(os.Stderr, "Review the placeholder values of %s, run 'tf-iam-scanner db test-fixture %s --update' after editing it, and commit both files\n", configFile, entry)
+	}
+}
+
+// fixtureBlock is a block of a provider schema, with the nested blocks
+// schemaAttribute leaves out.
+type fixtureBlock struct {
+	Attributes map[string]fixtureAttribute `json:"attributes"`
+	BlockTypes map[string]struct {
+		NestingMode string       `json:"nesting_mode"`
+		MinItems    int          `json:"min_items"`
+		Block       fixtureBlock `json:"block"`
+	} `json:"block_types"`
+}
+
+// fixtureAttribute is an attribute of a provider schema block. Attributes of
+// protocol 6 providers may be nested objects rather than have a type.
+type fixtureAttribute struct {
+	Type       json.RawMessage `json:"type"`
+	NestedType *struct {
+		NestingMode string                      `json:"nesting_mode"`
+		Attributes  map[string]fixtureAttribute `json:"attributes"`
+	} `json:"nested_type"`
+	Required bool `json:"required"`
+}
+
+// fixtureConfig returns the configuration of the fixture of a permissions DB
+// entry: a resource or data source named "example" setting the arguments and
+// nested blocks its schema requires and the arguments its ARN templates
+// read.
+func fixtureConfig(entry string, provider awsProviderSchema) (string, error) {
+	kind, resourceType := KindResource, entry
+	schemas := provider.ResourceSchemas
+	if strings.HasPrefix(entry, KindData.addressPrefix()) {
+		kind, resourceType = KindData, strings.TrimPrefix(entry, KindData.addressPrefix())
+		schemas = provider.DataSourceSchemas
+	} else if strings.Contains(entry, ".") {
+		return "", fmt.Errorf("test fixtures are written for resource types and data.<type> data sources, not %s", entry)
+	}
+
+	perms, ok := permissionsDB[entry]
+	if !ok && kind == KindData {
+		perms, ok = permissionsDB[resourceType]
+	}
+	if !ok {
+		return "", fmt.Errorf("%s has no permissions DB entry; add it before writing its fixture", entry)
+	}
+	raw, ok := schemas[resourceType]
+	if !ok {
+		return "", fmt.Errorf("the provider schema has no %s", entry)
+	}
+	var schema struct {
+		Block fixtureBlock `json:"block"`
+	}
+	if err := json.Unmarshal(raw, &schema); err != nil {
+		return "", fmt.Errorf("error parsing the schema of %s: %w", entry, err)
+	}
+
+	// Set the arguments the ARN templates name the resource by, so that the
+	// expected policy shows them scoped
+	templateArguments := make(map[string]bool)
+	for _, template := range perms.allARNTemplates() {
+		for _, match := range arnTemplateVar.FindAllStringSubmatch(template, -1) {
+			if _, ok := schema.Block.Attributes[match[1]]; ok {
+				templateArguments[match[1]] = true
+			}
+		}
+	}
+
+	service := arnTemplateService(perms.ARNTemplate)
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# Test fixture of the %s permissions DB entry, written by\n", entry)
+	fmt.Fprintf(&sb, "# tf-iam-scanner db test-fixture. Values are placeholders.\n\n")
+	if kind == KindData {
+		fmt.Fprintf(&sb, "data %q \"example\" {\n", resourceType)
+	} else {
+		fmt.Fprintf(&sb, "resource %q \"example\" {\n", resourceType)
+	}
+	writeFixtureBlock(&sb, schema.Block, "  ", templateArguments, service)
+	sb.WriteString("}\n")
+	return sb.String(), nil
+}
+
+// writeFixtureBlock writes the required attributes of block, and those in
+// also, then one of each nested block it needs at least one of.
+func writeFixtureBlock(sb *strings.Builder, block fixtureBlock, indent string, also map[string]bool, service string) {
+	var names []string
+	for name, attribute := range block.Attributes {
+		if attribute.Required || also[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	// Align the equals signs as terraform fmt does
+	width := 0
+	for _, name := range names {
+		width = max(width, len(name))
+	}
+	for _, name := range names {
+		fmt.Fprintf(sb, "%s%-*s = %s\n", indent, width, name, exampleAttributeValue(name, block.Attributes[name], service))
+	}
+
+	var blocks []string
+	for name, blockType := range block.BlockTypes {
+		if blockType.MinItems > 0 {
+			blocks = append(blocks, name)
+		}
+	}
+	sort.Strings(blocks)
+	for _, name := range blocks {
+		fmt.Fprintf(sb, "\n%s%s {\n", indent, name)
+		writeFixtureBlock(sb, block.BlockTypes[name].Block, indent+"  ", nil, service)
+		fmt.Fprintf(sb, "%s}\n", indent)
+	}
+}
+
+// exampleAttributeValue returns a placeholder value of an attribute, as an
+// HCL expression.
+func exampleAttributeValue(name string, attribute fixtureAttribute, service string) string {
+	if attribute.NestedType == nil {
+		return exampleValue(name, attribute.Type, service)
+	}
+	var fields []string
+	for field, nested := range attribute.NestedType.Attributes {
+		if nested.Required {
+			fields = append(fields, field+" = "+exampleAttributeValue(field, nested, service))
+		}
+	}
+	sort.Strings(fields)
+	object := "{ " + strings.Join(fields, ", ") + " }"
+	switch attribute.NestedType.NestingMode {
+	case "list", "set":
+		return "[" + object + "]"
+	case "map":
+		return "{ example = " + object + " }"
+	}
+	return object
+}
+
+// exampleValue returns a placeholder value of a schema type, as an HCL
+// expression. Strings are "example", or an ARN for arguments named *_arn.
+func exampleValue(name string, typ json.RawMessage, service string) string {
+	var primitive string
+	if json.Unmarshal(typ, &primitive) == nil {
+		switch primitive {
+		case "string":
+			return strconv.Quote(exampleString(name, service))
+		case "number":
+			return "1"
+		case "bool":
+			return "false"
+		}
+		return `"example"`
+	}
+
+	var constructor []json.RawMessage
+	var kind string
+	if json.Unmarshal(typ, &constructor) != nil || len(constructor) != 2 || json.Unmarshal(constructor[0], &kind) != nil {
+		return "null"
+	}
+	switch kind {
+	case "list", "set":
+		return "[" + exampleValue(name, constructor[1], service) + "]"
+	case "map":
+		return "{ example = " + exampleValue(name, constructor[1], service) + " }"
+	case "object":
+		var fieldTypes map[string]json.RawMessage
+		if json.Unmarshal(constructor[1], &fieldTypes) != nil {
+			return "null"
+		}
+		var fields []string
+		for field, fieldType := range fieldTypes {
+			fields = append(fields, field+" = "+exampleValue(field, fieldType, service))
+		}
+		sort.Strings(fields)
+		return "{ " + strings.Join(fields, ", ") + " }"
+	case "tuple":
+		var elementTypes []json.RawMessage
+		if json.Unmarshal(constructor[1], &elementTypes) != nil {
+			return "null"
+		}
+		var elements []string
+		for _, elementType := range elementTypes {
+			elements = append(elements, exampleValue(name, elementType, service))
+		}
+		return "[" + strings.Join(elements, ", ") + "]"
+	}
+	return "null"
+}
+
+// exampleString returns the placeholder of a string argument: an IAM role
+// ARN for role arguments, an ARN of the service of the entry's ARN template
+// for other *_arn arguments, else "example".
+func exampleString(name, service string) string {
+	switch {
+	case name == "role" || strings.HasSuffix(name, "role_arn"):
+		return "arn:aws:iam::123456789012:role/example"
+	case strings.HasSuffix(name, "_arn") && service != "":
+		return "arn:aws:" + service + ":us-east-1:123456789012:example"
+	}
+	return "example"
+}
+
+// fixturePolicy returns the least-privilege policy of the fixture in dir, as
+// its expected-policy.json holds it.
+func fixturePolicy(dir string) ([]byte, error) {
+	result, err := parseTerraformFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, diagnostic := range result.Diagnostics {
+		if diagnostic.Severity == "error" {
+			return nil, fmt.Errorf("%s", diagnostic)
+		}
+	}
+	data, err := json.MarshalIndent(buildIAMPolicy(result, false, true), "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling policy to JSON: %w", err)
+	}
+	return append(data, '\n'), nil
+}
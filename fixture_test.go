@@ -0,0 +1,140 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestDBFixtures checks the policy of every permissions DB test fixture
+// against its expected policy.
+func TestDBFixtures(t *testing.T) {
+	if err := loadPermissionsDB(); err != nil {
+		t.Fatalf("Error loading permissions DB: %v", err)
+	}
+	dirs, err := filepath.Glob(filepath.Join(fixtureRootDir, "*", fixtureConfigFile))
+	if err != nil || len(dirs) == 0 {
+		t.Fatalf("Expected fixtures in %s, got %v", fixtureRootDir, err)
+	}
+	for _, config := range dirs {
+		dir := filepath.Dir(config)
+		entry := filepath.Base(dir)
+		t.Run(entry, func(t *testing.T) {
+			want, err := os.ReadFile(filepath.Join(dir, fixtureExpectedPolicy))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := fixturePolicy(dir)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if string(got) != string(want) {
+				t.Errorf("The policy of %s differs from %s; if the DB entry changed on purpose, run 'tf-iam-scanner db test-fixture %s --update'. Got:\n%s", config, fixtureExpectedPolicy, entry, got)
+			}
+		})
+	}
+}
+
+const testFixtureSchema = `{
+  "provider_schemas": {
+    "registry.terraform.io/hashicorp/aws": {
+      "resource_schemas": {
+        "aws_ecs_service": {"block": {
+          "attributes": {
+            "name": {"type": "string", "required": true},
+            "iam_role": {"type": "string", "optional": true},
+            "desired_count": {"type": "number", "optional": true},
+            "cluster_arn": {"type": "string", "required": true},
+            "tags": {"type": ["map", "string"], "required": true},
+            "ports": {"type": ["list", ["object", {"port": "number", "public": "bool"}]], "required": true},
+            "settings": {"nested_type": {"nesting_mode": "set", "attributes": {
+              "key": {"type": "string", "required": true},
+              "note": {"type": "string", "optional": true}
+            }}, "required": true}
+          },
+          "block_types": {
+            "network_configuration": {"nesting_mode": "list", "min_items": 1, "block": {
+              "attributes": {"subnets": {"type": ["set", "string"], "required": true}}
+            }},
+            "timeouts": {"nesting_mode": "single", "block": {
+              "attributes": {"create": {"type": "string", "optional": true}}
+            }}
+          }
+        }}
+      },
+      "data_source_schemas": {
+        "aws_sqs_queue": {"block": {"attributes": {
+          "name": {"type": "string", "required": true},
+          "url": {"type": "string", "computed": true}
+        }}}
+      }
+    }
+  }
+}`
+
+func TestFixtureConfig(t *testing.T) {
+	if err := loadPermissionsDB(); err != nil {
+		t.Fatalf("Error loading permissions DB: %v", err)
+	}
+	file := filepath.Join(t.TempDir(), "schema.json")
+	if err := os.WriteFile(file, []byte(testFixtureSchema), 0644); err != nil {
+		t.Fatal(err)
+	}
+	provider, err := readAWSProviderSchema(file)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	config, err := fixtureConfig("aws_ecs_service", provider)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, want := range []string{
+		`resource "aws_ecs_service" "example" {`,
+		`  cluster_arn = "arn:aws:ecs:us-east-1:123456789012:example"`,
+		`  name        = "example"`,
+		`  ports       = [{ port = 1, public = false }]`,
+		`  settings    = [{ key = "example" }]`,
+		`  tags        = { example = "example" }`,
+		"  network_configuration {\n    subnets = [\"example\"]\n  }",
+	} {
+		if !strings.Contains(config, want) {
+			t.Errorf("Expected %q in:\n%s", want, config)
+		}
+	}
+	for _, unwanted := range []string{"desired_count", "iam_role", "timeouts"} {
+		if strings.Contains(config, unwanted) {
+			t.Errorf("Expected no optional %s in:\n%s", unwanted, config)
+		}
+	}
+
+	// The configuration must parse and get the entry's policy
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, fixtureConfigFile), []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	policy, err := fixturePolicy(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.Contains(string(policy), "ecs:CreateService") {
+		t.Errorf("Expected the aws_ecs_service actions, got %s", policy)
+	}
+
+	// data.<type> is looked up in the data source schemas
+	config, err = fixtureConfig("data.aws_sqs_queue", provider)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.Contains(config, "data \"aws_sqs_queue\" \"example\" {\n  name = \"example\"\n}") {
+		t.Errorf("Expected the data source, got:\n%s", config)
+	}
+
+	// Types without an entry or a schema, and other kinds, fail
+	for _, entry := range []string{"aws_not_a_type", "aws_sqs_queue", "ephemeral.aws_ssm_parameter"} {
+		if _, err := fixtureConfig(entry, provider); err == nil {
+			t.Errorf("Expected an error for %s", entry)
+		}
+	}
+}
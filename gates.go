@@ -0,0 +1,290 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Policy gate names accepted by --fail-on.
+const (
+	GateWildcardAction   = "wildcard-action"
+	GateWildcardResource = "wildcard-resource"
+	GateUnmappedResource = "unmapped-resource"
+	GateSizeLimit        = "size-limit"
+	GateUnknownAction    = "unknown-action"
+)
+
+// Exit codes returned when a --fail-on gate trips. Each gate has its own code
+// so CI scripts can tell them apart.
+const (
+	exitWildcardAction   = 10
+	exitWildcardResource = 11
+	exitUnmappedResource = 12
+	exitSizeLimit        = 13
+	exitUnknownAction    = 17
+)
+
+// managedPolicySizeLimit is the maximum size of a customer managed policy
+// document, counted in characters excluding whitespace.
+const managedPolicySizeLimit = 6144
+
+var gateExitCodes = map[string]int{
+	GateWildcardAction:   exitWildcardAction,
+	GateWildcardResource: exitWildcardResource,
+	GateUnmappedResource: exitUnmappedResource,
+	GateSizeLimit:        exitSizeLimit,
+	GateUnknownAction:    exitUnknownAction,
+}
+
+// GateViolation describes a tripped --fail-on gate.
+type GateViolation struct {
+	Gate     string
+	ExitCode int
+	Message  string
+}
+
+// validateGates checks that every --fail-on value names a known gate.
+func validateGates(gates []string) error {
+	for _, gate := range gates {
+		if _, ok := gateExitCodes[gate]; !ok {
+			return fmt.Errorf("invalid --fail-on value %q. Valid values: %s, %s, %s, %s, %s",
+				gate, GateWildcardAction, GateWildcardResource, GateUnmappedResource, GateSizeLimit, GateUnknownAction)
+		}
+	}
+	return nil
+}
+
+// evaluateGates runs the requested gates against the generated policy and
+// returns the violations in the order the gates were requested.
+func evaluateGates(gates []string, policy IAMPolicy, result *ParseResult) []GateViolation {
+	var violations []GateViolation
+
+	for _, gate := range gates {
+		var message string
+		switch gate {
+		case GateWildcardAction:
+			if wildcards := wildcardActions(policy); len(wildcards) > 0 {
+				message = fmt.Sprintf("policy contains wildcard actions: %s", strings.Join(wildcards, ", "))
+			}
+		case GateWildcardResource:
+			if count := wildcardResourceStatements(policy); count > 0 {
+				message = fmt.Sprintf("%d statement(s) grant access to Resource \"*\"", count)
+			}
+		case GateUnmappedResource:
+			if unmapped := findUnmappedResources(result); len(unmapped) > 0 {
+				message = fmt.Sprintf("no permission mapping for: %s", strings.Join(unmapped, ", "))
+			}
+		case GateSizeLimit:
+			if size, limit := policySize(policy), policySizeLimit(); size > limit {
+				message = fmt.Sprintf("policy is %d characters, exceeding the %d character %s policy limit",
+					size, limit, policyTypeFlag)
+			}
+		case GateUnknownAction:
+			var unknown []string
+			for _, problem := range unknownActions(policy) {
+				if problem.Severity == SeverityError {
+					unknown = append(unknown, problem.Action)
+				}
+			}
+			if len(unknown) > 0 {
+				message = fmt.Sprintf("actions not in the AWS action catalog: %s", strings.Join(unknown, ", "))
+			}
+		}
+
+		if message != "" {
+			violations = append(violations, GateViolation{
+				Gate:     gate,
+				ExitCode: gateExitCodes[gate],
+				Message:  message,
+			})
+		}
+	}
+
+	return violations
+}
+
+// wildcardActions returns the distinct actions containing a "*".
+func wildcardActions(policy IAMPolicy) []string {
+	seen := make(map[string]bool)
+	for _, statement := range policy.Statement {
+		for _, action := range toStringSlice(statement.Action) {
+			if strings.Contains(action, "*") {
+				seen[action] = true
+			}
+		}
+	}
+
+	wildcards := make([]string, 0, len(seen))
+	for action := range seen {
+		wildcards = append(wildcards, action)
+	}
+	sort.Strings(wildcards)
+	return wildcards
+}
+
+// actionProblem is an action of a generated policy that checkAction rejects.
+type actionProblem struct {
+	Action   string
+	Severity string // SeverityWarning for misses in partial services that look like no typo
+	Message  string
+}
+
+// unknownActions checks every distinct action of the Allow statements
+// against the action catalog. IAM accepts actions that do not exist without
+// complaint, so a typo in the permissions DB, a --permissions-dir mapping or
+// extra_statements would otherwise only show up as an AccessDenied during
+// apply.
+func unknownActions(policy IAMPolicy) []actionProblem {
+	if actionCatalog == nil {
+		_ = loadActionCatalog()
+	}
+	seen := make(map[string]bool)
+	var problems []actionProblem
+	for _, statement := range policy.Statement {
+		if statement.Effect != "Allow" {
+			continue
+		}
+		for _, action := range toStringSlice(statement.Action) {
+			if seen[action] {
+				continue
+			}
+			seen[action] = true
+			severity, message := checkAction(action)
+			if message == "" {
+				continue
+			}
+			problems = append(problems, actionProblem{Action: action, Severity: severity, Message: message})
+		}
+	}
+	sort.Slice(problems, func(i, j int) bool { return problems[i].Action < problems[j].Action })
+	return problems
+}
+
+// wildcardResourceStatements counts Allow statements whose Resource is "*".
+// Statements with a Condition, such as those added by --scope-by-tag, are
+// scoped by it and not counted, and so are statements of wildcard-only
+// actions, which cannot be scoped to anything else.
+func wildcardResourceStatements(policy IAMPolicy) int {
+	count := 0
+	for _, statement := range policy.Statement {
+		if isWildcardResourceStatement(statement) {
+			count++
+		}
+	}
+	return count
+}
+
+// isWildcardResourceStatement reports whether statement is counted by
+// wildcardResourceStatements.
+func isWildcardResourceStatement(statement IAMStatement) bool {
+	if actionCatalog == nil {
+		_ = loadActionCatalog()
+	}
+	if statement.Effect != "Allow" || len(statement.Condition) > 0 {
+		return false
+	}
+	if actions := toStringSlice(statement.Action); len(actions) > 0 {
+		if _, wildcardOnly := splitWildcardOnlyActions(actions); len(wildcardOnly) == len(actions) {
+			return false
+		}
+	}
+	return containsString(toStringSlice(statement.Resource), "*")
+}
+
+// findUnmappedResources returns the AWS resource and data source types that
+// have no entry in the permissions DB, formatted as Terraform type names.
+func findUnmappedResources(result *ParseResult) []string {
+	seen := make(map[string]bool)
+	for _, resources := range [][]Resource{result.Resources, result.DataSources} {
+		for _, resource := range resources {
+			if isUnmappedResource(resource) {
+				seen[resource.permissionsKey()] = true
+			}
+		}
+	}
+
+	unmapped := make([]string, 0, len(seen))
+	for resourceType := range seen {
+		unmapped = append(unmapped, resourceType)
+	}
+	sort.Strings(unmapped)
+	return unmapped
+}
+
+// isUnmappedResource reports whether resource is of an AWS type without an
+// entry in the permissions DB.
+func isUnmappedResource(resource Resource) bool {
+	return resource.Provider == "aws" && resource.Type != "" && !isMapped(resource)
+}
+
+// policySize returns the size of the policy document the way IAM counts it:
+// characters in the JSON document, excluding whitespace.
+func policySize(policy IAMPolicy) int {
+	data, err := json.Marshal(policy)
+	if err != nil {
+		return 0
+	}
+
+	size := 0
+	for _, r := range string(data) {
+		if !unicode.IsSpace(r) {
+			size++
+		}
+	}
+	return size
+}
+
+// toStringSlice normalizes a policy Action or Resource element, which may be
+// a single string or a list, into a slice.
+func toStringSlice(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []string:
+		return v
+	case []interface{}:
+		out := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// failedCheck evaluates --strict and --fail-on against the generated policy,
+// then the smoke test and simulation results. It prints why the first failed
+// check failed and returns its exit code, or 0 when every check passed.
+// findings and active are the policy findings before and after suppression.
+func failedCheck(policy IAMPolicy, result *ParseResult, findings, active []SecurityFinding, smokeTestDenied bool, simulation *SimulationReport) int {
+	if strictFlag {
+		unmapped := suppressGates(evaluateGates([]string{GateUnmappedResource}, policy, result), findings, active)
+		if len(unmapped) > 0 {
+			fmt.Fprintf(os.Stderr, "\nStrict check failed: %s\n", unmapped[0].Message)
+			return exitStrictUnmapped
+		}
+	}
+	violations := suppressGates(evaluateGates(failOnFlag, policy, result), findings, active)
+	if len(violations) > 0 {
+		fmt.Fprintf(os.Stderr, "\n")
+		for _, v := range violations {
+			fmt.Fprintf(os.Stderr, "Policy check failed (%s): %s\n", v.Gate, v.Message)
+		}
+		return violations[0].ExitCode
+	}
+	if smokeTestDenied {
+		fmt.Fprintf(os.Stderr, "Smoke test failed: the policy denies at least one plan-phase read\n")
+		return exitSmokeTestDenied
+	}
+	if simulation != nil && (simulation.deniedCount() > 0 || len(simulation.Errors) > 0) {
+		fmt.Fprintf(os.Stderr, "Simulation failed: %s is not allowed every action of the policy\n", simulation.Principal)
+		return exitSimulationDenied
+	}
+	return 0
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEvaluateGates(t *testing.T) {
+	if err := loadPermissionsDB(); err != nil {
+		t.Fatalf("Error loading permissions DB: %v", err)
+	}
+
+	result := &ParseResult{
+		Resources: []Resource{
+			{Type: "aws_s3_bucket", Name: "test", Provider: "aws", ResourceType: "aws_s3_bucket"},
+			{Type: "aws_not_a_real_thing", Name: "x", Provider: "aws", ResourceType: "aws_not_a_real_thing"},
+		},
+	}
+	policy := IAMPolicy{
+		Version: "2012-10-17",
+		Statement: []IAMStatement{
+			{Effect: "Allow", Action: []string{"s3:*", "s3:GetObject"}, Resource: "*"},
+		},
+	}
+
+	gates := []string{GateWildcardAction, GateWildcardResource, GateUnmappedResource, GateSizeLimit}
+	violations := evaluateGates(gates, policy, result)
+
+	if len(violations) != 3 {
+		t.Fatalf("Expected 3 violations, got %d: %+v", len(violations), violations)
+	}
+	if violations[0].Gate != GateWildcardAction || violations[0].ExitCode != exitWildcardAction {
+		t.Errorf("Expected first violation to be wildcard-action, got %+v", violations[0])
+	}
+	if violations[1].ExitCode != exitWildcardResource {
+		t.Errorf("Expected wildcard-resource exit code %d, got %d", exitWildcardResource, violations[1].ExitCode)
+	}
+	if !strings.Contains(violations[2].Message, "aws_not_a_real_thing") {
+		t.Errorf("Expected unmapped resource in message, got %q", violations[2].Message)
+	}
+}
+
+func TestWildcardResourceGateSkipsWildcardOnlyActions(t *testing.T) {
+	policy := IAMPolicy{
+		Version: "2012-10-17",
+		Statement: []IAMStatement{
+			{Effect: "Allow", Action: []string{"sqs:CreateQueue"}, Resource: "arn:aws:sqs:*:*:orders"},
+			{Sid: wildcardOnlySid, Effect: "Allow", Action: []string{"sqs:ListQueues", "sts:GetCallerIdentity"}, Resource: "*"},
+		},
+	}
+	if count := wildcardResourceStatements(policy); count != 0 {
+		t.Errorf("A statement of wildcard-only actions should not count, got %d", count)
+	}
+
+	policy.Statement[1].Action = []string{"sqs:ListQueues", "sqs:DeleteQueue"}
+	if count := wildcardResourceStatements(policy); count != 1 {
+		t.Errorf("Expected 1 statement with Resource \"*\", got %d", count)
+	}
+}
+
+func TestPolicySizeLimitGate(t *testing.T) {
+	actions := make([]string, 0, 500)
+	for i := 0; i < 500; i++ {
+		actions = append(actions, "ec2:DescribeSomethingVeryLong"+strings.Repeat("x", i%10))
+	}
+	policy := IAMPolicy{
+		Version:   "2012-10-17",
+		Statement: []IAMStatement{{Effect: "Allow", Action: actions, Resource: "arn:aws:ec2:*:*:*"}},
+	}
+
+	violations := evaluateGates([]string{GateSizeLimit}, policy, &ParseResult{})
+	if len(violations) != 1 || violations[0].ExitCode != exitSizeLimit {
+		t.Errorf("Expected size-limit violation, got %+v", violations)
+	}
+}
+
+func TestValidateGates(t *testing.T) {
+	if err := validateGates([]string{GateWildcardAction, GateSizeLimit}); err != nil {
+		t.Errorf("Expected valid gates, got %v", err)
+	}
+	if err := validateGates([]string{"everything"}); err == nil {
+		t.Error("Expected error for unknown gate")
+	}
+}
+
+func TestUnknownActionGate(t *testing.T) {
+	policy := IAMPolicy{
+		Version: "2012-10-17",
+		Statement: []IAMStatement{
+			{Effect: "Allow", Action: []string{"sqs:CreateQueue", "sqs:GetQueueAtributes", "sqs:ListQueues"}, Resource: "*"},
+			{Effect: "Allow", Action: []string{"sqs:SomethingNewEntirely", "notaservice:DoThing"}, Resource: "*"},
+			{Effect: "Deny", Action: "sqs:DeleteQueu", Resource: "*"},
+		},
+	}
+
+	var got []string
+	for _, problem := range unknownActions(policy) {
+		got = append(got, problem.Action+" "+problem.Severity)
+	}
+	want := "notaservice:DoThing warning,sqs:GetQueueAtributes error,sqs:SomethingNewEntirely warning"
+	if strings.Join(got, ",") != want {
+		t.Errorf("unknownActions() = %v, want %s", got, want)
+	}
+
+	violations := evaluateGates([]string{GateUnknownAction}, policy, &ParseResult{})
+	if len(violations) != 1 || violations[0].ExitCode != exitUnknownAction || !strings.HasSuffix(violations[0].Message, ": sqs:GetQueueAtributes") {
+		t.Errorf("Expected the misspelled action to trip the gate, got %+v", violations)
+	}
+}
+
+func TestFailedCheck(t *testing.T) {
+	if err := loadPermissionsDB(); err != nil {
+		t.Fatalf("Error loading permissions DB: %v", err)
+	}
+	defer func(strict bool, failOn []string) { strictFlag, failOnFlag = strict, failOn }(strictFlag, failOnFlag)
+
+	result := &ParseResult{
+		Resources: []Resource{{Type: "aws_not_a_real_thing", Name: "x", Provider: "aws", ResourceType: "aws_not_a_real_thing"}},
+	}
+	policy := IAMPolicy{
+		Version:   "2012-10-17",
+		Statement: []IAMStatement{{Effect: "Allow", Action: "s3:*", Resource: "*"}},
+	}
+	denied := &SimulationReport{Principal: "arn:aws:iam::123456789012:role/deploy", Errors: []string{"throttled"}}
+
+	tests := []struct {
+		name       string
+		strict     bool
+		failOn     []string
+		smokeTest  bool
+		simulation *SimulationReport
+		want       int
+	}{
+		{"no checks", false, nil, false, nil, 0},
+		{"strict", true, []string{GateWildcardAction}, false, nil, exitStrictUnmapped},
+		{"first gate", false, []string{GateWildcardResource, GateWildcardAction}, true, nil, exitWildcardResource},
+		{"smoke test", false, nil, true, denied, exitSmokeTestDenied},
+		{"simulation", false, nil, false, denied, exitSimulationDenied},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			strictFlag, failOnFlag = tt.strict, tt.failOn
+			if got := failedCheck(policy, result, nil, nil, tt.smokeTest, tt.simulation); got != tt.want {
+				t.Errorf("failedCheck() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Policy language versions accepted by IAM. 2008-10-17 predates policy
+// variables, so "${...}" in such a policy is matched literally.
+const (
+	defaultPolicyVersion = "2012-10-17"
+	legacyPolicyVersion  = "2008-10-17"
+)
+
+var (
+	policyVersionFlag = defaultPolicyVersion
+	partitionFlag     = "aws"
+)
+
+// sidPattern is the character set IAM accepts in a statement Sid.
+var sidPattern = regexp.MustCompile(`^[A-Za-z0-9]*$`)
+
+// validatePolicyVersion checks the --policy-version value.
+func validatePolicyVersion(version string) error {
+	switch version {
+	case defaultPolicyVersion, legacyPolicyVersion:
+		return nil
+	}
+	return fmt.Errorf("invalid --policy-version %q. Valid values: %s, %s", version, defaultPolicyVersion, legacyPolicyVersion)
+}
+
+// validatePartition checks the --partition value.
+func validatePartition(partition string) error {
+	if knownARNPartitions[partition] {
+		return nil
+	}
+	var partitions []string
+	for p := range knownARNPartitions {
+		partitions = append(partitions, p)
+	}
+	sort.Strings(partitions)
+	return fmt.Errorf("invalid --partition %q. Valid values: %s", partition, strings.Join(partitions, ", "))
+}
+
+// policyGrammarErrors checks that a policy about to be written is valid IAM
+// policy grammar for the given partition: a known Version, an Effect, exactly
+// one of Action/NotAction and Resource/NotResource per statement, well formed
+// actions and Sids, ARNs in the partition, and no policy variables in a
+// 2008-10-17 policy. Each problem is returned as a message naming the
+// statement.
+func policyGrammarErrors(policy IAMPolicy, partition string) []string {
+	var errs []string
+	if err := validatePolicyVersion(policy.Version); err != nil {
+		errs = append(errs, fmt.Sprintf("Version %q is not a policy language version (use %s or %s)", policy.Version, defaultPolicyVersion, legacyPolicyVersion))
+	}
+
+	sids := make(map[string]bool)
+	for i, statement := range policy.Statement {
+		location := findingLocation(LintFinding{Statement: i, Sid: statement.Sid})
+		add := func(format string, args ...interface{}) {
+			errs = append(errs, location+": "+fmt.Sprintf(format, args...))
+		}
+
+		if !sidPattern.MatchString(statement.Sid) {
+			add("Sid %q may only contain letters and digits", statement.Sid)
+		}
+		if statement.Sid != "" {
+			if sids[statement.Sid] {
+				add("Sid %q is used by more than one statement", statement.Sid)
+			}
+			sids[statement.Sid] = true
+		}
+		if statement.Effect != "Allow" && statement.Effect != "Deny" {
+			add("Effect must be \"Allow\" or \"Deny\", got %q", statement.Effect)
+		}
+		if (statement.Action == nil) == (statement.NotAction == nil) {
+			add("statement must have exactly one of Action or NotAction")
+		}
+		if (statement.Resource == nil) == (statement.NotResource == nil) {
+			add("statement must have exactly one of Resource or NotResource")
+		}
+
+		for _, action := range append(toStringSlice(statement.Action), toStringSlice(statement.NotAction)...) {
+			if action != "*" && !actionPattern.MatchString(action) {
+				add("malformed action %q: expected service:ActionName", action)
+			}
+		}
+		for _, resource := range append(toStringSlice(statement.Resource), toStringSlice(statement.NotResource)...) {
+			if message := checkARN(resource); message != "" {
+				add("%s", message)
+				continue
+			}
+			if resource == "*" {
+				continue
+			}
+			if arnPartition := strings.SplitN(resource, ":", 3)[1]; arnPartition != partition && !isPolicyPattern(arnPartition) {
+				add("ARN %s is in partition %q, not %q", resource, arnPartition, partition)
+			}
+			if policy.Version == legacyPolicyVersion && strings.Contains(resource, "${") {
+				add("%s uses a policy variable, which needs Version %s", resource, defaultPolicyVersion)
+			}
+		}
+		if policy.Version == legacyPolicyVersion && conditionUsesVariables(statement.Condition) {
+			add("Condition uses a policy variable, which needs Version %s", defaultPolicyVersion)
+		}
+	}
+	return errs
+}
+
+// conditionUsesVariables reports whether any condition value contains a
+// policy variable.
+func conditionUsesVariables(condition map[string]map[string]interface{}) bool {
+	for _, operators := range condition {
+		for _, value := range operators {
+			for _, v := range toStringSlice(value) {
+				if strings.Contains(v, "${") {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
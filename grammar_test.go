@@ -0,0 +1,85 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPolicyGrammarErrors(t *testing.T) {
+	valid := IAMPolicy{
+		Version: defaultPolicyVersion,
+		Statement: []IAMStatement{
+			{Sid: "S3", Effect: "Allow", Action: []string{"s3:GetObject"}, Resource: "arn:aws-cn:s3:::logs/*"},
+			{Effect: "Allow", Action: "ec2:Describe*", Resource: "*"},
+		},
+	}
+	if errs := policyGrammarErrors(valid, "aws-cn"); len(errs) != 0 {
+		t.Errorf("Expected no errors, got %v", errs)
+	}
+
+	errs := policyGrammarErrors(valid, "aws")
+	if len(errs) != 1 || !strings.Contains(errs[0], `partition "aws-cn", not "aws"`) {
+		t.Errorf("Expected a partition error, got %v", errs)
+	}
+
+	invalid := IAMPolicy{
+		Version: legacyPolicyVersion,
+		Statement: []IAMStatement{
+			{Sid: "Read-Logs", Effect: "Allow", Action: "s3:GetObject", Resource: "arn:aws:s3:::logs/${aws:username}/*"},
+			{Sid: "Dup", Effect: "Allow", Action: "s3 GetObject", Resource: "*"},
+			{Sid: "Dup", Effect: "Permit", Action: "s3:GetObject", NotAction: "s3:PutObject"},
+		},
+	}
+	errs = policyGrammarErrors(invalid, "aws")
+	for _, want := range []string{
+		"may only contain letters and digits",
+		"uses a policy variable",
+		"malformed action",
+		"used by more than one statement",
+		"Effect must be",
+		"exactly one of Action or NotAction",
+		"exactly one of Resource or NotResource",
+	} {
+		found := false
+		for _, err := range errs {
+			if strings.Contains(err, want) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("Expected an error containing %q, got %v", want, errs)
+		}
+	}
+
+	if errs := policyGrammarErrors(IAMPolicy{Version: "2010-01-01"}, "aws"); len(errs) != 1 {
+		t.Errorf("Expected a Version error, got %v", errs)
+	}
+}
+
+func TestValidatePolicyVersionAndPartition(t *testing.T) {
+	if err := validatePolicyVersion(legacyPolicyVersion); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if err := validatePolicyVersion("2012-10-18"); err == nil {
+		t.Error("Expected an error for an unknown policy version")
+	}
+	if err := validatePartition("aws-us-gov"); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if err := validatePartition("aws-china"); err == nil || !strings.Contains(err.Error(), "aws-cn") {
+		t.Errorf("Expected an error listing the partitions, got %v", err)
+	}
+}
+
+func TestConstructARNPatternPartition(t *testing.T) {
+	partition := defaultARNContext.Partition
+	t.Cleanup(func() { defaultARNContext.Partition = partition })
+
+	defaultARNContext.Partition = "aws-cn"
+	if arn := constructARNPattern("s3", "logs"); arn != "arn:aws-cn:s3:::logs" {
+		t.Errorf("Unexpected ARN %s", arn)
+	}
+	if arn := constructARNPattern("sqs", "queue"); arn != "arn:aws-cn:sqs:*:*:queue" {
+		t.Errorf("Unexpected ARN %s", arn)
+	}
+}
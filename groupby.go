@@ -0,0 +1,278 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Least-privilege statement groupings for --group-by.
+const (
+	GroupByService  = "service"
+	GroupByResource = "resource"
+)
+
+var groupByFlag = GroupByService
+
+// Sids of the per-resource policy's statements that no resource owns.
+const (
+	stateBackendSid    = "TerraformStateBackend"
+	stateEncryptionSid = "TerraformStateEncryption"
+	providerSid        = "AWSProvider"
+)
+
+// validateGroupBy checks the --group-by value and the flags it needs.
+func validateGroupBy(groupBy string) error {
+	switch groupBy {
+	case GroupByService:
+		return nil
+	case GroupByResource:
+		if !leastPrivilegeFlag {
+			return fmt.Errorf("--group-by %s needs --least-privilege", GroupByResource)
+		}
+		if splitReadWriteFlag {
+			return fmt.Errorf("--group-by %s cannot be combined with --split-read-write", GroupByResource)
+		}
+		return nil
+	}
+	return fmt.Errorf("invalid --group-by %q. Valid values: %s, %s", groupBy, GroupByService, GroupByResource)
+}
+
+// resourceStatements collects one resource's actions by the Resource element
+// they are granted on, so that actions scoped to different ARNs do not share
+// a statement.
+type resourceStatements struct {
+	keys    []string
+	actions map[string][]string
+	arns    map[string][]string
+	scoped  map[string]bool
+}
+
+func newResourceStatements() *resourceStatements {
+	return &resourceStatements{actions: make(map[string][]string), arns: make(map[string][]string), scoped: make(map[string]bool)}
+}
+
+// add records action on arns; scoped marks ARNs rendered for the resource
+// itself rather than the service-wide or "*" fallbacks.
+func (r *resourceStatements) add(action string, arns []string, scoped bool) {
+	arns = dedupeActions(arns)
+	sort.Strings(arns)
+	key := strings.Join(arns, ",")
+	if _, ok := r.arns[key]; !ok {
+		r.keys = append(r.keys, key)
+		r.arns[key] = arns
+	}
+	r.scoped[key] = r.scoped[key] || scoped
+	if !containsString(r.actions[key], action) {
+		r.actions[key] = append(r.actions[key], action)
+	}
+}
+
+// statements returns a statement per Resource element, the resource's own
+// ARNs first and otherwise in the order the elements were first seen. The
+// first is named sid, the others sid2, sid3...
+func (r *resourceStatements) statements(sid string) []IAMStatement {
+	keys := append([]string{}, r.keys...)
+	sort.SliceStable(keys, func(i, j int) bool { return r.scoped[keys[i]] && !r.scoped[keys[j]] })
+	var statements []IAMStatement
+	for i, key := range keys {
+		actions := append([]string{}, r.actions[key]...)
+		sort.Strings(actions)
+		var resource interface{} = r.arns[key]
+		if len(r.arns[key]) == 1 {
+			resource = r.arns[key][0]
+		}
+		statement := IAMStatement{Sid: sid, Effect: "Allow", Action: actions, Resource: resource}
+		if i > 0 {
+			statement.Sid = fmt.Sprintf("%s%d", sid, i+1)
+		}
+		statements = append(statements, statement)
+	}
+	return statements
+}
+
+// buildResourcePolicy is the --group-by resource counterpart of the
+// least-privilege buildIAMPolicy: one statement per Terraform resource and
+// data source, named after its address, granting the actions of its type on
+// the ARNs its entry renders for it (the service-wide ARN when there are
+// none, "*" for wildcard-only actions). The state backend and the provider's
+// sts:GetCallerIdentity get statements of their own. Statements granting the
+// same actions on the same resources are merged; see
+// mergeIdenticalStatements.
+func buildResourcePolicy(result *ParseResult, includeStateBackend bool) IAMPolicy {
+	if actionCatalog == nil {
+		_ = loadActionCatalog()
+	}
+	inferred := inferredByAddress(inferReferencePermissions(result))
+	var statements []IAMStatement
+	owners := make(map[string]string) // Sid to the resource type it grants for
+
+	for _, resource := range result.Resources {
+		if !needsAWSPermissions(resource) {
+			continue
+		}
+		address := resourceAddress(resource)
+		permissions := inferred[address]
+		scopedElsewhere := scopedInferredActions(permissions)
+		grouped := newResourceStatements()
+		for _, action := range resourceActions(resource) {
+			if !scopedElsewhere[action] {
+				arns, scoped := resourceActionARNs(action, &resource)
+				grouped.add(action, arns, scoped)
+			}
+		}
+		for _, permission := range permissions {
+			for _, action := range permission.Actions {
+				if len(permission.ARNs) > 0 && !isWildcardOnlyAction(action) {
+					grouped.add(action, permission.ARNs, true)
+				} else {
+					arns, _ := resourceActionARNs(action, nil)
+					grouped.add(action, arns, false)
+				}
+			}
+		}
+		for _, statement := range grouped.statements(statementSid(address, "")) {
+			owners[statement.Sid] = resource.Type
+			statements = append(statements, statement)
+		}
+	}
+
+	for _, dataSource := range result.DataSources {
+		if !needsAWSPermissions(dataSource) {
+			continue
+		}
+		grouped := newResourceStatements()
+		for _, action := range dataSourceActions(dataSource) {
+			arns, scoped := resourceActionARNs(action, &dataSource)
+			grouped.add(action, arns, scoped)
+		}
+		for _, permission := range inferred[resourceAddress(dataSource)] {
+			for _, action := range permission.Actions {
+				if len(permission.ARNs) > 0 && !isWildcardOnlyAction(action) {
+					grouped.add(action, permission.ARNs, true)
+				} else {
+					arns, _ := resourceActionARNs(action, nil)
+					grouped.add(action, arns, false)
+				}
+			}
+		}
+		for _, statement := range grouped.statements(statementSid(resourceAddress(dataSource), "")) {
+			owners[statement.Sid] = dataSource.permissionsKey()
+			statements = append(statements, statement)
+		}
+	}
+
+	if includeStateBackend && len(statements) > 0 {
+		backends := stateBackends(result)
+		for _, backend := range backends {
+			backendActions := make(map[string]bool)
+			addBackendPermissions(backendActions, backend)
+			backendARNs := backendResourceARNs(backend)
+			grouped := newResourceStatements()
+			for _, action := range sortedSet(backendActions) {
+				if arns := backendARNs[action]; len(arns) > 0 {
+					grouped.add(action, arns, true)
+				} else {
+					arns, _ := resourceActionARNs(action, nil)
+					grouped.add(action, arns, false)
+				}
+			}
+			sid := stateBackendSid
+			if len(backends) > 1 {
+				sid = statementSid(stateBackendSid+" "+describeBackend(backend), "")
+			}
+			statements = append(statements, grouped.statements(sid)...)
+		}
+		if len(result.StateEncryption) > 0 {
+			keyARNs := stateEncryptionARNs(result)
+			grouped := newResourceStatements()
+			for _, action := range stateEncryptionActions {
+				if len(keyARNs) > 0 {
+					grouped.add(action, keyARNs, true)
+				} else {
+					grouped.add(action, []string{"*"}, false)
+				}
+			}
+			statements = append(statements, grouped.statements(stateEncryptionSid)...)
+		}
+	}
+	statements = append(statements, downstreamStatements(result)...)
+	if len(statements) > 0 {
+		statements = append(statements, IAMStatement{
+			Sid:      providerSid,
+			Effect:   "Allow",
+			Action:   []string{"sts:GetCallerIdentity"},
+			Resource: "*",
+		})
+	}
+
+	return IAMPolicy{
+		Version:   defaultPolicyVersion,
+		Statement: mergeIdenticalStatements(statements, owners),
+	}
+}
+
+// resourceActionARNs returns the ARNs an action of resource is granted on:
+// "*" for wildcard-only actions, the forms of the resource's arn_template and
+// arn_templates for the action's service, or the service-wide ARN. A nil
+// resource gets the service-wide ARN. It reports whether the ARNs are the
+// resource's own.
+func resourceActionARNs(action string, resource *Resource) ([]string, bool) {
+	if isWildcardOnlyAction(action) {
+		return []string{"*"}, false
+	}
+	service := strings.SplitN(action, ":", 2)[0]
+	if resource != nil {
+		var arns []string
+		for _, arn := range resourceARNs(resource, defaultARNContext) {
+			if arnTemplateService(arn) == service {
+				arns = append(arns, arn)
+			}
+		}
+		if len(arns) > 0 {
+			return arns, true
+		}
+	}
+	return getResourceARNForService(service), false
+}
+
+// mergeIdenticalStatements merges the statements granting the same actions
+// on the same resources into the first of them, which loses its address Sid:
+// it is named after the resource type when all the merged statements belong
+// to one (owners maps Sids to types), and left without a Sid otherwise.
+func mergeIdenticalStatements(statements []IAMStatement, owners map[string]string) []IAMStatement {
+	key := func(statement IAMStatement) string {
+		return strings.Join(toStringSlice(statement.Action), ",") + "|" + strings.Join(toStringSlice(statement.Resource), ",")
+	}
+
+	first := make(map[string]int)
+	types := make(map[int]map[string]bool)
+	var merged []IAMStatement
+	for _, statement := range statements {
+		k := key(statement)
+		i, seen := first[k]
+		if !seen {
+			first[k] = len(merged)
+			types[len(merged)] = map[string]bool{owners[statement.Sid]: true}
+			merged = append(merged, statement)
+			continue
+		}
+		types[i][owners[statement.Sid]] = true
+		merged[i].Sid = ""
+		if owned := sortedSet(types[i]); len(owned) == 1 && owned[0] != "" {
+			merged[i].Sid = statementSid(owned[0], "")
+		}
+	}
+
+	// A type-named Sid can collide with an address Sid
+	seen := make(map[string]int)
+	for i := range merged {
+		if sid := merged[i].Sid; sid != "" {
+			seen[sid]++
+			if seen[sid] > 1 {
+				merged[i].Sid = fmt.Sprintf("%s%d", sid, seen[sid])
+			}
+		}
+	}
+	return merged
+}
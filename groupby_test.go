@@ -0,0 +1,91 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBuildResourcePolicy(t *testing.T) {
+	if err := loadPermissionsDB(); err != nil {
+		t.Fatalf("Error loading permissions DB: %v", err)
+	}
+	source := `resource "aws_sqs_queue" "jobs" {
+  name = "jobs"
+}
+
+data "aws_vpc" "main" {
+  id = "vpc-1"
+}
+
+data "aws_vpc" "shared" {
+  id = "vpc-2"
+}
+`
+	result, err := parseTerraformSource([]byte(source), "main.tf")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	policy := buildResourcePolicy(result, false)
+	bySid := make(map[string]IAMStatement)
+	for _, statement := range policy.Statement {
+		if _, dup := bySid[statement.Sid]; dup {
+			t.Errorf("Duplicate Sid %q", statement.Sid)
+		}
+		bySid[statement.Sid] = statement
+	}
+
+	queue, ok := bySid["AwsSqsQueueJobs"]
+	if !ok {
+		t.Fatalf("Expected a statement named after the queue, got %+v", policy.Statement)
+	}
+	if resource, _ := queue.Resource.(string); !strings.HasSuffix(resource, ":jobs") {
+		t.Errorf("Expected the queue's own ARN, got %v", queue.Resource)
+	}
+	if !containsString(toStringSlice(queue.Action), "sqs:CreateQueue") {
+		t.Errorf("Expected the queue's actions, got %v", queue.Action)
+	}
+
+	if _, ok := bySid["DataAwsVpcMain"]; ok {
+		t.Errorf("The identical data source statements should be merged")
+	}
+	if _, ok := bySid["DataAwsVpc"]; !ok {
+		t.Errorf("Expected the merged statement to be named after the type, got %+v", policy.Statement)
+	}
+	if _, ok := bySid[providerSid]; !ok {
+		t.Errorf("Expected the provider statement")
+	}
+	if _, ok := bySid[stateBackendSid]; ok {
+		t.Errorf("The state backend was excluded")
+	}
+}
+
+func TestMergeIdenticalStatements(t *testing.T) {
+	statements := []IAMStatement{
+		{Sid: "A", Effect: "Allow", Action: []string{"s3:GetObject"}, Resource: "*"},
+		{Sid: "B", Effect: "Allow", Action: []string{"s3:GetObject"}, Resource: "*"},
+		{Sid: "C", Effect: "Allow", Action: []string{"s3:PutObject"}, Resource: "*"},
+	}
+	merged := mergeIdenticalStatements(statements, map[string]string{"A": "aws_s3_object", "B": "aws_s3_bucket", "C": "aws_s3_object"})
+	if len(merged) != 2 || merged[0].Sid != "" || merged[1].Sid != "C" {
+		t.Errorf("Unexpected merge: %+v", merged)
+	}
+}
+
+func TestValidateGroupBy(t *testing.T) {
+	defer func() { leastPrivilegeFlag, splitReadWriteFlag = false, false }()
+	if err := validateGroupBy("module"); err == nil {
+		t.Errorf("Expected an error for an unknown grouping")
+	}
+	if err := validateGroupBy(GroupByResource); err == nil {
+		t.Errorf("Expected --group-by resource to need --least-privilege")
+	}
+	leastPrivilegeFlag = true
+	if err := validateGroupBy(GroupByResource); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	splitReadWriteFlag = true
+	if err := validateGroupBy(GroupByResource); err == nil {
+		t.Errorf("Expected an error with --split-read-write")
+	}
+}
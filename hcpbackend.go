@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Backends that keep state in HCP Terraform or Terraform Enterprise: the
+// cloud block, recorded as the "cloud" backend, and the older remote
+// backend.
+const (
+	backendCloud  = "cloud"
+	backendRemote = "remote"
+)
+
+// defaultHCPHostname is the hostname of HCP Terraform.
+const defaultHCPHostname = "app.terraform.io"
+
+// HCPTerraformAccess is what a run needs from HCP Terraform or Terraform
+// Enterprise when state lives there, instead of AWS state permissions.
+type HCPTerraformAccess struct {
+	Hostname     string   `json:"hostname"`
+	Organization string   `json:"organization,omitempty"`
+	Workspaces   string   `json:"workspaces"`
+	Permissions  []string `json:"permissions"`
+}
+
+// isHCPTerraformBackend reports whether backend keeps state in HCP Terraform
+// or Terraform Enterprise.
+func isHCPTerraformBackend(backend *BackendConfig) bool {
+	return backend != nil && (backend.Type == backendCloud || backend.Type == backendRemote)
+}
+
+// hcpTerraformAccess describes the token and workspace permissions a cloud
+// block or remote backend needs, or returns nil for other backends.
+// Organization and workspaces left out of the block come from the
+// environment, as in the Terraform CLI.
+func hcpTerraformAccess(backend *BackendConfig) *HCPTerraformAccess {
+	if !isHCPTerraformBackend(backend) {
+		return nil
+	}
+	config := backend.Config
+	access := &HCPTerraformAccess{
+		Hostname:     config["hostname"],
+		Organization: config["organization"],
+	}
+	if access.Hostname == "" {
+		access.Hostname = defaultHCPHostname
+	}
+	if access.Organization == "" && backend.Type == backendCloud {
+		access.Organization = "from TF_CLOUD_ORGANIZATION"
+	}
+
+	switch {
+	case config["workspaces.name"] != "":
+		access.Workspaces = config["workspaces.name"]
+	case config["workspaces.tags"] != "":
+		access.Workspaces = "tagged " + config["workspaces.tags"]
+	case config["workspaces.prefix"] != "":
+		access.Workspaces = "prefixed " + config["workspaces.prefix"]
+	case backend.Type == backendCloud:
+		access.Workspaces = "from TF_WORKSPACE"
+	default:
+		access.Workspaces = "not configured"
+	}
+	if project := config["workspaces.project"]; project != "" {
+		access.Workspaces += " in project " + project
+	}
+
+	access.Permissions = []string{
+		fmt.Sprintf("API token for %s (terraform login or TF_TOKEN_%s): a user or team token; organization tokens cannot start runs",
+			access.Hostname, strings.NewReplacer(".", "_", "-", "__").Replace(access.Hostname)),
+		"terraform plan: the workspace's plan permission set (read runs, queue plans, read variables, read state versions)",
+		"terraform apply: the write permission set (adds apply runs, lock/unlock workspace, read and write state versions)",
+		"local execution mode: read and write state versions and lock/unlock workspace are enough; the AWS policy then belongs to the local credentials",
+		"remote execution mode: attach the AWS policy to the role the workspace's AWS credentials or dynamic provider credentials use",
+	}
+	return access
+}
+
+// printHCPTerraformAccess prints the HCP Terraform requirements in the run
+// summary.
+func printHCPTerraformAccess(access *HCPTerraformAccess) {
+	fmt.Fprintf(os.Stderr, "  State backend permissions: none in AWS (state is kept in %s)\n", access.Hostname)
+	organization := access.Organization
+	if organization == "" {
+		organization = "not configured"
+	}
+	fmt.Fprintf(os.Stderr, "  HCP Terraform access (organization %s, workspaces %s):\n", organization, access.Workspaces)
+	for _, permission := range access.Permissions {
+		fmt.Fprintf(os.Stderr, "    - %s\n", permission)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCloudBlockBackend(t *testing.T) {
+	if err := loadPermissionsDB(); err != nil {
+		t.Fatalf("Error loading permissions DB: %v", err)
+	}
+	result, err := parseTerraformFiles("test-fixtures/hcp-cloud")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Backend == nil || result.Backend.Type != backendCloud {
+		t.Fatalf("Expected the cloud block as backend, got %+v", result.Backend)
+	}
+	if got := result.Backend.Config["workspaces.tags"]; got != "networking,prod" {
+		t.Errorf("Expected the workspace tags, got %q", got)
+	}
+
+	policy := buildIAMPolicy(result, true, false)
+	for _, statement := range policy.Statement {
+		for _, action := range toStringSlice(statement.Action) {
+			if strings.HasPrefix(action, "s3:") || strings.HasPrefix(action, "dynamodb:") {
+				t.Errorf("State in HCP Terraform needs no AWS state permissions, got %s", action)
+			}
+		}
+	}
+
+	access := hcpTerraformAccess(result.Backend)
+	if access == nil || access.Organization != "acme" || access.Workspaces != "tagged networking,prod in project platform" {
+		t.Errorf("Unexpected access: %+v", access)
+	}
+}
+
+func TestHCPTerraformAccess(t *testing.T) {
+	access := hcpTerraformAccess(&BackendConfig{Type: backendRemote, Config: map[string]string{
+		"hostname":          "tfe.example-corp.com",
+		"organization":      "acme",
+		"workspaces.prefix": "network-",
+	}})
+	if access == nil || access.Workspaces != "prefixed network-" {
+		t.Fatalf("Unexpected access: %+v", access)
+	}
+	if !strings.Contains(access.Permissions[0], "TF_TOKEN_tfe_example__corp_com") {
+		t.Errorf("Expected the CLI token variable of the hostname, got %q", access.Permissions[0])
+	}
+
+	access = hcpTerraformAccess(&BackendConfig{Type: backendCloud, Config: map[string]string{}})
+	if access.Hostname != defaultHCPHostname || access.Workspaces != "from TF_WORKSPACE" {
+		t.Errorf("Expected the CLI defaults, got %+v", access)
+	}
+
+	if hcpTerraformAccess(&BackendConfig{Type: "s3"}) != nil || hcpTerraformAccess(nil) != nil {
+		t.Errorf("Other backends need no HCP Terraform access")
+	}
+}
+
+func TestSimpleParsingCloudBlock(t *testing.T) {
+	result, err := extractWithSimpleParsing([]byte("terraform {\ncloud {\n}\n}\n"), "main.tf")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Backend == nil || result.Backend.Type != backendCloud {
+		t.Errorf("Expected the cloud backend, got %+v", result.Backend)
+	}
+}
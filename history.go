@@ -0,0 +1,428 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/spf13/cobra"
+)
+
+// historyEntryVersion is bumped whenever the stored entry layout changes in a
+// way older readers cannot handle.
+const historyEntryVersion = 1
+
+// defaultHistoryStore is where history keeps policies unless --store says
+// otherwise.
+const defaultHistoryStore = ".tf-iam-scanner/history"
+
+var (
+	historyStoreFlag  string
+	historyCommitFlag string
+	historyFormatFlag string
+)
+
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Keep generated policies over time and render a changelog of permission changes",
+	Long: `Record each generated policy together with the git commit it was generated
+from, and render a changelog of the grants added and removed between the
+recorded policies, e.g. as compliance evidence.
+
+Policies are stored in a local directory (default ` + defaultHistoryStore + `) or,
+with --store s3://bucket/prefix, in an S3 bucket using the current AWS
+credentials (see --profile and --assume-role-arn).
+
+Example:
+  tf-iam-scanner --path ./terraform --least-privilege --output policy.json
+  tf-iam-scanner history record policy.json
+  tf-iam-scanner history changelog`,
+}
+
+var historyRecordCmd = &cobra.Command{
+	Use:   "record policy.json",
+	Short: "Store a generated policy with the current git commit",
+	Long: `Store a generated policy, read from a file or from stdin ("-"), with the
+git commit it was generated from. The policy is not stored again when it
+grants the same access as the latest recorded one.`,
+	Args: cobra.ExactArgs(1),
+	Run:  runHistoryRecord,
+}
+
+var historyChangelogCmd = &cobra.Command{
+	Use:   "changelog",
+	Short: "Print the permission additions and removals between recorded policies",
+	Args:  cobra.NoArgs,
+	Run:   runHistoryChangelog,
+}
+
+func init() {
+	historyCmd.PersistentFlags().StringVar(&historyStoreFlag, "store", defaultHistoryStore, "Directory or s3://bucket/prefix holding the recorded policies")
+	addAWSFlags(historyCmd.PersistentFlags())
+	historyRecordCmd.Flags().StringVar(&historyCommitFlag, "commit", "", "Git commit the policy was generated from (default: HEAD of the working directory's repository)")
+	historyChangelogCmd.Flags().StringVarP(&historyFormatFlag, "format", "f", "markdown", "Changelog format (markdown, json)")
+	_ = historyChangelogCmd.RegisterFlagCompletionFunc("format", cobra.FixedCompletions(
+		[]string{"markdown", "json"}, cobra.ShellCompDirectiveNoFileComp))
+	historyCmd.AddCommand(historyRecordCmd, historyChangelogCmd)
+	rootCmd.AddCommand(historyCmd)
+}
+
+// historyEntry is one recorded policy.
+type historyEntry struct {
+	Version    int       `json:"version"`
+	RecordedAt time.Time `json:"recorded_at"`
+	Commit     string    `json:"commit,omitempty"`
+	Policy     IAMPolicy `json:"policy"`
+}
+
+// historyStore keeps recorded entries by name. Names sort in the order the
+// entries were recorded.
+type historyStore interface {
+	List(ctx context.Context) ([]string, error)
+	Get(ctx context.Context, name string) ([]byte, error)
+	Put(ctx context.Context, name string, data []byte) error
+}
+
+// dirHistoryStore keeps entries as files in a local directory.
+type dirHistoryStore struct {
+	Dir string
+}
+
+func (s dirHistoryStore) List(ctx context.Context) ([]string, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading history directory: %w", err)
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".json") {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (s dirHistoryStore) Get(ctx context.Context, name string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(s.Dir, name))
+}
+
+func (s dirHistoryStore) Put(ctx context.Context, name string, data []byte) error {
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		return fmt.Errorf("error creating history directory: %w", err)
+	}
+	return writeOutputFile(filepath.Join(s.Dir, name), data, 0644, false)
+}
+
+// historyS3API is the part of the S3 client used by the history store.
+type historyS3API interface {
+	ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+}
+
+// s3HistoryStore keeps entries as objects under a prefix of an S3 bucket.
+type s3HistoryStore struct {
+	Client historyS3API
+	Bucket string
+	Prefix string
+}
+
+func (s s3HistoryStore) key(name string) string {
+	return path.Join(s.Prefix, name)
+}
+
+func (s s3HistoryStore) List(ctx context.Context) ([]string, error) {
+	prefix := s.Prefix
+	if prefix != "" {
+		prefix += "/"
+	}
+	var names []string
+	paginator := s3.NewListObjectsV2Paginator(s.Client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.Bucket),
+		Prefix: aws.String(prefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error listing s3://%s/%s: %w", s.Bucket, prefix, err)
+		}
+		for _, object := range page.Contents {
+			name := strings.TrimPrefix(aws.ToString(object.Key), prefix)
+			if !strings.Contains(name, "/") && strings.HasSuffix(name, ".json") {
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (s s3HistoryStore) Get(ctx context.Context, name string) ([]byte, error) {
+	out, err := s.Client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(s.Bucket), Key: aws.String(s.key(name))})
+	if err != nil {
+		return nil, fmt.Errorf("error reading s3://%s/%s: %w", s.Bucket, s.key(name), err)
+	}
+	defer out.Body.Close()
+	return io.ReadAll(out.Body)
+}
+
+func (s s3HistoryStore) Put(ctx context.Context, name string, data []byte) error {
+	_, err := s.Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.Bucket),
+		Key:         aws.String(s.key(name)),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String("application/json"),
+	})
+	if err != nil {
+		return fmt.Errorf("error writing s3://%s/%s: %w", s.Bucket, s.key(name), err)
+	}
+	return nil
+}
+
+// openHistoryStore returns the store named by --store: an s3://bucket/prefix
+// URL or a local directory.
+func openHistoryStore(ctx context.Context, location string) (historyStore, error) {
+	rest, ok := strings.CutPrefix(location, "s3://")
+	if !ok {
+		return dirHistoryStore{Dir: location}, nil
+	}
+	bucket, prefix, _ := strings.Cut(rest, "/")
+	if bucket == "" {
+		return nil, fmt.Errorf("invalid --store %q: expected s3://bucket/prefix", location)
+	}
+	cfg, err := loadAWSConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s3HistoryStore{Client: s3.NewFromConfig(cfg), Bucket: bucket, Prefix: strings.Trim(prefix, "/")}, nil
+}
+
+// historyEntryName names an entry after the time it was recorded and its
+// commit, so names sort chronologically.
+func historyEntryName(entry historyEntry) string {
+	name := entry.RecordedAt.UTC().Format("20060102T150405Z")
+	if entry.Commit != "" {
+		commit := entry.Commit
+		if len(commit) > 12 {
+			commit = commit[:12]
+		}
+		name += "-" + commit
+	}
+	return name + ".json"
+}
+
+// loadHistory reads every entry in the store, oldest first.
+func loadHistory(ctx context.Context, store historyStore) ([]historyEntry, error) {
+	names, err := store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]historyEntry, 0, len(names))
+	for _, name := range names {
+		data, err := store.Get(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		var entry historyEntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return nil, fmt.Errorf("error parsing history entry %s: %w", name, err)
+		}
+		if entry.Version != historyEntryVersion {
+			return nil, fmt.Errorf("history entry %s has version %d, expected %d", name, entry.Version, historyEntryVersion)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// recordHistory stores entry unless it grants the same access as the latest
+// recorded entry. It returns the name of the stored entry, or "" when the
+// policy was unchanged.
+func recordHistory(ctx context.Context, store historyStore, entry historyEntry) (string, error) {
+	entries, err := loadHistory(ctx, store)
+	if err != nil {
+		return "", err
+	}
+	if len(entries) > 0 {
+		added, removed := diffPolicyGrants(entries[len(entries)-1].Policy, entry.Policy)
+		if len(added) == 0 && len(removed) == 0 {
+			return "", nil
+		}
+	}
+
+	entry.Version = historyEntryVersion
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("error marshaling history entry: %w", err)
+	}
+	name := historyEntryName(entry)
+	return name, store.Put(ctx, name, append(data, '\n'))
+}
+
+// gitHeadCommit returns the commit checked out in the working directory, or
+// "" outside a git repository.
+func gitHeadCommit() string {
+	out, err := exec.Command("git", "rev-parse", "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// changelogEntry lists the grants added and removed by one recorded policy
+// compared with the one before it.
+type changelogEntry struct {
+	RecordedAt time.Time `json:"recorded_at"`
+	Commit     string    `json:"commit,omitempty"`
+	Added      []string  `json:"added"`
+	Removed    []string  `json:"removed"`
+}
+
+// buildChangelog compares each entry with the previous one, newest first.
+// The oldest entry lists every grant as added; entries without changes are
+// left out.
+func buildChangelog(entries []historyEntry) []changelogEntry {
+	var changelog []changelogEntry
+	var previous IAMPolicy
+	for _, entry := range entries {
+		added, removed := diffPolicyGrants(previous, entry.Policy)
+		previous = entry.Policy
+		if len(added) == 0 && len(removed) == 0 {
+			continue
+		}
+		if added == nil {
+			added = []string{}
+		}
+		if removed == nil {
+			removed = []string{}
+		}
+		changelog = append(changelog, changelogEntry{RecordedAt: entry.RecordedAt, Commit: entry.Commit, Added: added, Removed: removed})
+	}
+	for i, j := 0, len(changelog)-1; i < j; i, j = i+1, j-1 {
+		changelog[i], changelog[j] = changelog[j], changelog[i]
+	}
+	return changelog
+}
+
+// renderChangelogMarkdown renders a changelog with one section per recorded
+// policy.
+func renderChangelogMarkdown(changelog []changelogEntry) string {
+	var sb strings.Builder
+	sb.WriteString("# IAM Policy Changelog\n")
+	if len(changelog) == 0 {
+		sb.WriteString("\nNo policies recorded.\n")
+	}
+	for _, entry := range changelog {
+		fmt.Fprintf(&sb, "\n## %s", entry.RecordedAt.UTC().Format("2006-01-02 15:04 UTC"))
+		if entry.Commit != "" {
+			fmt.Fprintf(&sb, " (%s)", entry.Commit)
+		}
+		sb.WriteString("\n\n")
+		for _, grant := range entry.Added {
+			fmt.Fprintf(&sb, "- Added: `%s`\n", grant)
+		}
+		for _, grant := range entry.Removed {
+			fmt.Fprintf(&sb, "- Removed: `%s`\n", grant)
+		}
+	}
+	return sb.String()
+}
+
+func runHistoryRecord(cmd *cobra.Command, args []string) {
+	var data []byte
+	var err error
+	if args[0] == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(args[0])
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading policy: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := loadActionCatalog(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	policy, _, err := lintPolicy(data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing %s: %v\n", args[0], err)
+		os.Exit(1)
+	}
+
+	commit := historyCommitFlag
+	if commit == "" {
+		commit = gitHeadCommit()
+	}
+
+	ctx := cmd.Context()
+	store, err := openHistoryStore(ctx, historyStoreFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	name, err := recordHistory(ctx, store, historyEntry{RecordedAt: time.Now().UTC(), Commit: commit, Policy: policy})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error recording policy: %v\n", err)
+		os.Exit(1)
+	}
+	if name == "" {
+		fmt.Fprintf(os.Stderr, "Policy unchanged since the latest recorded one; nothing recorded\n")
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Policy recorded as %s in %s\n", name, historyStoreFlag)
+}
+
+func runHistoryChangelog(cmd *cobra.Command, args []string) {
+	if historyFormatFlag != "markdown" && historyFormatFlag != "json" {
+		fmt.Fprintf(os.Stderr, "Error: invalid format %s. Valid formats: markdown, json\n", historyFormatFlag)
+		os.Exit(1)
+	}
+	if err := loadActionCatalog(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	ctx := cmd.Context()
+	store, err := openHistoryStore(ctx, historyStoreFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	entries, err := loadHistory(ctx, store)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	changelog := buildChangelog(entries)
+	if historyFormatFlag == "json" {
+		if changelog == nil {
+			changelog = []changelogEntry{}
+		}
+		data, err := json.MarshalIndent(changelog, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error marshaling changelog: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(data))
+		return
+	}
+	fmt.Print(renderChangelogMarkdown(changelog))
+}
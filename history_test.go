@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+func historyPolicy(actions ...string) IAMPolicy {
+	return IAMPolicy{Version: defaultPolicyVersion, Statement: []IAMStatement{{Effect: "Allow", Action: actions, Resource: "*"}}}
+}
+
+func TestRecordHistoryAndChangelog(t *testing.T) {
+	if err := loadActionCatalog(); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	store := dirHistoryStore{Dir: t.TempDir() + "/history"}
+	start := time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC)
+
+	record := func(day int, commit string, policy IAMPolicy) string {
+		t.Helper()
+		name, err := recordHistory(ctx, store, historyEntry{RecordedAt: start.AddDate(0, 0, day), Commit: commit, Policy: policy})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return name
+	}
+
+	if name := record(0, "0123456789abcdef", historyPolicy("s3:GetObject")); name != "20261001T090000Z-0123456789ab.json" {
+		t.Errorf("Unexpected entry name %s", name)
+	}
+	if name := record(1, "aaa", historyPolicy("s3:getobject")); name != "" {
+		t.Errorf("An unchanged policy should not be recorded, got %s", name)
+	}
+	record(2, "bbb", historyPolicy("s3:PutObject"))
+
+	entries, err := loadHistory(ctx, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 entries, got %d", len(entries))
+	}
+
+	changelog := buildChangelog(entries)
+	if len(changelog) != 2 || changelog[0].Commit != "bbb" {
+		t.Fatalf("Expected the newest entry first, got %+v", changelog)
+	}
+	if strings.Join(changelog[0].Added, ",") != "Allow s3:PutObject on *" || strings.Join(changelog[0].Removed, ",") != "Allow s3:GetObject on *" {
+		t.Errorf("Unexpected changes %+v", changelog[0])
+	}
+	if len(changelog[1].Added) != 1 || len(changelog[1].Removed) != 0 {
+		t.Errorf("The first entry should list its grants as added, got %+v", changelog[1])
+	}
+
+	markdown := renderChangelogMarkdown(changelog)
+	for _, want := range []string{"## 2026-10-03 09:00 UTC (bbb)", "- Added: `Allow s3:PutObject on *`", "- Removed: `Allow s3:GetObject on *`"} {
+		if !strings.Contains(markdown, want) {
+			t.Errorf("Expected %q in the changelog:\n%s", want, markdown)
+		}
+	}
+}
+
+// fakeHistoryBucket keeps objects in memory.
+type fakeHistoryBucket struct {
+	objects map[string][]byte
+}
+
+func (f *fakeHistoryBucket) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	out := &s3.ListObjectsV2Output{}
+	for key := range f.objects {
+		if strings.HasPrefix(key, aws.ToString(params.Prefix)) {
+			out.Contents = append(out.Contents, s3types.Object{Key: aws.String(key)})
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeHistoryBucket) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(f.objects[aws.ToString(params.Key)]))}, nil
+}
+
+func (f *fakeHistoryBucket) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	data, err := io.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+	f.objects[aws.ToString(params.Key)] = data
+	return &s3.PutObjectOutput{}, nil
+}
+
+func TestS3HistoryStore(t *testing.T) {
+	ctx := context.Background()
+	bucket := &fakeHistoryBucket{objects: map[string][]byte{"ci/other/ignored.json": []byte("{}")}}
+	store := s3HistoryStore{Client: bucket, Bucket: "evidence", Prefix: "ci"}
+
+	name, err := recordHistory(ctx, store, historyEntry{RecordedAt: time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC), Policy: historyPolicy("sqs:SendMessage")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := bucket.objects["ci/"+name]; !ok {
+		t.Errorf("Expected the entry under the prefix, got %v", bucket.objects)
+	}
+
+	entries, err := loadHistory(ctx, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || toStringSlice(entries[0].Policy.Statement[0].Action)[0] != "sqs:SendMessage" {
+		t.Errorf("Unexpected entries %+v", entries)
+	}
+}
+
+func TestOpenHistoryStore(t *testing.T) {
+	store, err := openHistoryStore(context.Background(), "audit/history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dir, ok := store.(dirHistoryStore); !ok || dir.Dir != "audit/history" {
+		t.Errorf("Expected a directory store, got %#v", store)
+	}
+	if _, err := openHistoryStore(context.Background(), "s3:///prefix"); err == nil {
+		t.Error("Expected an error for an S3 URL without a bucket")
+	}
+}
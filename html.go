@@ -0,0 +1,200 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"sort"
+	"strings"
+)
+
+// htmlReportTemplate renders a self-contained report page: no external
+// stylesheets or scripts, so it can be attached to tickets as a single file.
+var htmlReportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>tf-iam-scanner report</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2rem; color: #1f2328; }
+h1 { font-size: 1.6rem; }
+h2 { font-size: 1.2rem; margin-top: 2rem; border-bottom: 1px solid #d0d7de; padding-bottom: .3rem; }
+table { border-collapse: collapse; width: 100%; margin-top: .5rem; }
+th, td { text-align: left; padding: .35rem .6rem; border-bottom: 1px solid #d0d7de; vertical-align: top; }
+th { background: #f6f8fa; }
+code, pre { font-family: SFMono-Regular, Consolas, monospace; font-size: .85rem; }
+pre { background: #f6f8fa; padding: 1rem; overflow-x: auto; }
+.summary td:first-child { font-weight: 600; width: 16rem; }
+.warnings { background: #fff8c5; border: 1px solid #d4a72c; padding: .5rem 1rem; }
+.unmapped { color: #cf222e; font-weight: 600; }
+details summary { cursor: pointer; }
+.heatmap td.num { text-align: right; }
+.heat0 { color: #8c959f; }
+.heat1 { background: #fff1e5; }
+.heat2 { background: #ffd8b5; }
+.heat3 { background: #ffb77c; }
+.heat4 { background: #fb8f44; font-weight: 600; }
+</style>
+</head>
+<body>
+<h1>tf-iam-scanner report</h1>
+
+<table class="summary">
+<tr><td>Resources</td><td>{{.ResourceCount}}</td></tr>
+<tr><td>Data sources</td><td>{{.DataSourceCount}}</td></tr>
+<tr><td>Backend</td><td>{{if .Backend}}{{.Backend}}{{else}}none detected{{end}}</td></tr>
+<tr><td>Statements</td><td>{{.StatementCount}}</td></tr>
+<tr><td>Distinct actions</td><td>{{.ActionCount}}</td></tr>
+</table>
+
+{{if .Warnings}}
+<h2>Warnings</h2>
+<div class="warnings">
+<ul>
+{{range .Warnings}}<li>{{.}}</li>
+{{end}}</ul>
+</div>
+{{end}}
+
+<h2>Services</h2>
+<table>
+<tr><th>Service</th><th>Actions</th><th>Resources</th></tr>
+{{range .Services}}<tr>
+<td><code>{{.Name}}</code></td>
+<td><details><summary>{{len .Actions}} action(s)</summary>{{range .Actions}}<code>{{.}}</code><br>{{end}}</details></td>
+<td>{{range .Resources}}<code>{{.}}</code><br>{{end}}</td>
+</tr>
+{{end}}</table>
+
+{{if .Weights}}
+<h2>Permission weight</h2>
+<table class="heatmap">
+<tr><th>Service</th><th>Weight</th><th>Write actions</th><th>Permissions management</th><th>Resources</th><th>Wildcard actions</th><th>Actions on "*"</th></tr>
+{{range .Weights}}<tr>
+<td><code>{{.Service}}</code></td>
+{{range .Cells}}<td class="num heat{{.Heat}}">{{.Value}}</td>{{end}}
+</tr>
+{{end}}</table>
+{{end}}
+
+<h2>Resource contributions</h2>
+<table>
+<tr><th>Address</th><th>Type</th><th>Actions</th></tr>
+{{range .Contributions}}<tr>
+<td><code>{{.Address}}</code></td>
+<td>{{.Kind.Description}}</td>
+<td>{{if .Mapped}}<details><summary>{{len .Actions}} action(s)</summary>{{range .Actions}}<code>{{.}}</code><br>{{end}}</details>{{else}}<span class="unmapped">unmapped</span>{{end}}</td>
+</tr>
+{{end}}</table>
+
+<h2>Policy</h2>
+<pre>{{.PolicyJSON}}</pre>
+</body>
+</html>
+`))
+
+// htmlService is one row of the per-service breakdown.
+type htmlService struct {
+	Name      string
+	Actions   []string
+	Resources []string
+}
+
+// htmlReport is the data passed to htmlReportTemplate.
+type htmlReport struct {
+	ResourceCount   int
+	DataSourceCount int
+	Backend         string
+	StatementCount  int
+	ActionCount     int
+	Warnings        []string
+	Services        []htmlService
+	Weights         []htmlWeightRow
+	Contributions   []resourceContribution
+	PolicyJSON      string
+}
+
+// generateHTMLReport renders the policy together with a per-service breakdown,
+// a heatmap of the services' permission weight and per-resource
+// contributions as a standalone HTML page.
+func generateHTMLReport(policy IAMPolicy, result *ParseResult) (string, error) {
+	policyJSON, err := json.MarshalIndent(policy, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("error marshaling policy to JSON: %w", err)
+	}
+
+	report := htmlReport{
+		StatementCount: len(policy.Statement),
+		PolicyJSON:     string(policyJSON),
+	}
+
+	if result != nil {
+		report.ResourceCount = len(result.Resources)
+		report.DataSourceCount = len(result.DataSources)
+		if result.Backend != nil {
+			report.Backend = result.Backend.Type
+		}
+		report.Warnings = append(report.Warnings, result.Warnings...)
+		for _, unmapped := range findUnmappedResources(result) {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("No permission mapping for %s", unmapped))
+		}
+		report.Contributions = collectContributions(result)
+	}
+
+	report.Services, report.ActionCount = servicesFromPolicy(policy)
+	report.Weights = heatmapRows(computeServiceWeights(policy, report.Contributions))
+
+	var sb strings.Builder
+	if err := htmlReportTemplate.Execute(&sb, report); err != nil {
+		return "", fmt.Errorf("error rendering HTML report: %w", err)
+	}
+	return sb.String(), nil
+}
+
+// servicesFromPolicy groups the policy's Allow actions and resources by
+// service, returning the groups sorted by name and the distinct action count.
+func servicesFromPolicy(policy IAMPolicy) ([]htmlService, int) {
+	actions := make(map[string]map[string]bool)
+	resources := make(map[string]map[string]bool)
+	total := make(map[string]bool)
+
+	for _, statement := range policy.Statement {
+		if statement.Effect != "Allow" {
+			continue
+		}
+		for _, action := range toStringSlice(statement.Action) {
+			service := strings.SplitN(action, ":", 2)[0]
+			if actions[service] == nil {
+				actions[service] = make(map[string]bool)
+				resources[service] = make(map[string]bool)
+			}
+			actions[service][action] = true
+			total[action] = true
+			for _, resource := range toStringSlice(statement.Resource) {
+				resources[service][resource] = true
+			}
+		}
+	}
+
+	services := make([]htmlService, 0, len(actions))
+	for name := range actions {
+		services = append(services, htmlService{
+			Name:      name,
+			Actions:   sortedSet(actions[name]),
+			Resources: sortedSet(resources[name]),
+		})
+	}
+	sort.Slice(services, func(i, j int) bool { return services[i].Name < services[j].Name })
+
+	return services, len(total)
+}
+
+// sortedSet returns the members of a string set in sorted order.
+func sortedSet(set map[string]bool) []string {
+	out := make([]string, 0, len(set))
+	for item := range set {
+		out = append(out, item)
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// permissionsBoundaryFlag is the ARN of the managed policy every role the
+// scanned configuration writes must have as its permissions boundary.
+var permissionsBoundaryFlag string
+
+var boundaryPolicyARNPattern = regexp.MustCompile(`^arn:([a-z-]+):iam::(\d{12}|aws):policy/[\w+=,.@/-]+$`)
+
+// boundaryConditionedActions create a role or change what it may do. With
+// --permissions-boundary they are only allowed on roles that have the
+// boundary, so no role the pipeline writes can grant more than it does.
+var boundaryConditionedActions = []string{
+	"iam:AttachRolePolicy", "iam:CreateRole", "iam:DeleteRolePolicy",
+	"iam:DetachRolePolicy", "iam:PutRolePermissionsBoundary", "iam:PutRolePolicy",
+}
+
+// boundaryRemovalAction would let the pipeline take the boundary off a role,
+// so --permissions-boundary leaves it out of the policy.
+const boundaryRemovalAction = "iam:DeleteRolePermissionsBoundary"
+
+// validatePermissionsBoundary checks that boundary, when given, is the ARN
+// of a managed policy in partition.
+func validatePermissionsBoundary(boundary, partition string) error {
+	if boundary == "" {
+		return nil
+	}
+	match := boundaryPolicyARNPattern.FindStringSubmatch(boundary)
+	if match == nil {
+		return fmt.Errorf("invalid --permissions-boundary %q: expected a managed policy ARN, e.g. arn:aws:iam::123456789012:policy/boundary", boundary)
+	}
+	if match[1] != partition {
+		return fmt.Errorf("--permissions-boundary %s is not in partition %s", boundary, partition)
+	}
+	return nil
+}
+
+// requirePermissionsBoundary moves the boundaryConditionedActions of every
+// unconditional Allow statement of policy into a statement on the same
+// resources that requires boundary through the iam:PermissionsBoundary
+// condition key, expanding wildcards that cover them, and removes
+// boundaryRemovalAction. It returns the policy and the removed action.
+func requirePermissionsBoundary(policy IAMPolicy, boundary string) (IAMPolicy, []excludedAction) {
+	if boundary == "" {
+		return policy, nil
+	}
+	policy, removed := excludeActions(policy, []string{boundaryRemovalAction})
+	for i := range removed {
+		removed[i].Pattern = "--permissions-boundary"
+	}
+
+	bounded := IAMPolicy{Version: policy.Version}
+	for _, statement := range policy.Statement {
+		if statement.Effect != "Allow" || statement.Action == nil || len(statement.Condition) > 0 {
+			bounded.Statement = append(bounded.Statement, statement)
+			continue
+		}
+		rest, moved := excludeActions(IAMPolicy{Statement: []IAMStatement{statement}}, boundaryConditionedActions)
+		bounded.Statement = append(bounded.Statement, rest.Statement...)
+		if len(moved) == 0 {
+			continue
+		}
+		conditioned := IAMStatement{
+			Effect:   "Allow",
+			Action:   excludedActionNames(moved),
+			Resource: statement.Resource,
+			Condition: map[string]map[string]interface{}{
+				"StringEquals": {"iam:PermissionsBoundary": boundary},
+			},
+		}
+		if statement.Sid != "" {
+			conditioned.Sid = statement.Sid + "PermissionsBoundary"
+		}
+		bounded.Statement = append(bounded.Statement, conditioned)
+	}
+	return bounded, removed
+}
+
+// roleBoundaryWarnings returns a warning for each role of result that is
+// known not to have boundary as its permissions boundary: creating it would
+// be denied. Roles whose boundary is an expression are assumed to have it.
+func roleBoundaryWarnings(result *ParseResult, boundary string) []string {
+	if boundary == "" {
+		return nil
+	}
+	var warnings []string
+	for _, resource := range result.Resources {
+		if resource.Type != "aws_iam_role" {
+			continue
+		}
+		where := resourceAddress(resource)
+		if location := resourceLocation(resource); location != "" {
+			where = location + ": " + where
+		}
+		if _, set := resource.Attributes["permissions_boundary"]; !set {
+			warnings = append(warnings, fmt.Sprintf("%s sets no permissions_boundary; --permissions-boundary only allows creating roles with %s", where, boundary))
+		} else if value, ok := literalAttribute(resource, "permissions_boundary"); ok && value != boundary {
+			warnings = append(warnings, fmt.Sprintf("%s has permissions_boundary %s; --permissions-boundary only allows %s", where, value, boundary))
+		}
+	}
+	return warnings
+}
+
+// createdIAMEntity is a role or managed policy the scanned configuration
+// creates, with what its documents say when they are literals: the
+// principals a role's trust policy lets assume it, or the number of actions
+// a policy allows.
+type createdIAMEntity struct {
+	Address   string
+	ARN       string
+	TrustedBy []string
+	Actions   int
+}
+
+// createdIAMEntities returns the roles and managed policies of result.
+func createdIAMEntities(result *ParseResult) []createdIAMEntity {
+	var entities []createdIAMEntity
+	for _, resource := range result.Resources {
+		if resource.Type != "aws_iam_role" && resource.Type != "aws_iam_policy" {
+			continue
+		}
+		entity := createdIAMEntity{
+			Address: resourceAddress(resource),
+			ARN:     renderARNTemplate(permissionsDB[resource.Type].ARNTemplate, &resource, defaultARNContext),
+		}
+		if document, ok := literalAttribute(resource, "assume_role_policy"); ok {
+			entity.TrustedBy = trustedPrincipals(document)
+		}
+		if document, ok := literalAttribute(resource, "policy"); ok {
+			entity.Actions = allowedActionCount(document)
+		}
+		entities = append(entities, entity)
+	}
+	return entities
+}
+
+// trustedPrincipals returns the principals the Allow statements of a trust
+// policy document name, sorted.
+func trustedPrincipals(document string) []string {
+	statements, _ := trustStatements(document)
+	principals := make(map[string]bool)
+	for _, statement := range statements {
+		if statement.Effect != "Allow" {
+			continue
+		}
+		switch principal := statement.Principal.(type) {
+		case string:
+			principals[principal] = true
+		case map[string]interface{}:
+			for _, values := range principal {
+				for _, value := range toStringSlice(values) {
+					principals[value] = true
+				}
+			}
+		}
+	}
+	return sortedSet(principals)
+}
+
+// allowedActionCount returns the number of distinct actions the Allow
+// statements of a policy document grant, or 0 when it is not valid JSON.
+func allowedActionCount(document string) int {
+	policy, _, err := lintPolicy([]byte(document))
+	if err != nil {
+		return 0
+	}
+	actions := make(map[string]bool)
+	for _, statement := range policy.Statement {
+		if statement.Effect == "Allow" {
+			for _, action := range toStringSlice(statement.Action) {
+				actions[action] = true
+			}
+		}
+	}
+	return len(actions)
+}
+
+// printCreatedIAMEntities lists the roles and managed policies the
+// configuration creates in the run summary.
+func printCreatedIAMEntities(result *ParseResult) {
+	entities := createdIAMEntities(result)
+	if len(entities) == 0 {
+		return
+	}
+	sort.Slice(entities, func(i, j int) bool { return entities[i].Address < entities[j].Address })
+	fmt.Fprintf(os.Stderr, "  IAM roles and policies created:\n")
+	for _, entity := range entities {
+		var details []string
+		if len(entity.TrustedBy) > 0 {
+			details = append(details, "assumed by "+strings.Join(entity.TrustedBy, ", "))
+		}
+		if entity.Actions > 0 {
+			details = append(details, fmt.Sprintf("allows %d action(s)", entity.Actions))
+		}
+		line := fmt.Sprintf("    - %s: %s", entity.Address, entity.ARN)
+		if len(details) > 0 {
+			line += " (" + strings.Join(details, "; ") + ")"
+		}
+		fmt.Fprintln(os.Stderr, line)
+	}
+}
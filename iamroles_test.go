@@ -0,0 +1,151 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRequirePermissionsBoundary(t *testing.T) {
+	if err := loadPermissionsDB(); err != nil {
+		t.Fatalf("Error loading permissions DB: %v", err)
+	}
+	boundary := "arn:aws:iam::123456789012:policy/boundary"
+	policy := IAMPolicy{Version: defaultPolicyVersion, Statement: []IAMStatement{
+		{Sid: "Iam", Effect: "Allow", Action: []string{"iam:CreateRole", "iam:DeleteRolePermissionsBoundary", "iam:GetRole"}, Resource: "arn:aws:iam::*:role/app"},
+		{Effect: "Allow", Action: []string{"iam:Put*"}, Resource: "*"},
+	}}
+
+	bounded, removed := requirePermissionsBoundary(policy, boundary)
+	if len(removed) != 1 || removed[0].Action != "iam:DeleteRolePermissionsBoundary" || removed[0].Pattern != "--permissions-boundary" {
+		t.Errorf("Expected the boundary removal action to be left out, got %+v", removed)
+	}
+	if len(bounded.Statement) != 4 {
+		t.Fatalf("Expected each statement to be split in two, got %+v", bounded.Statement)
+	}
+	if got := strings.Join(toStringSlice(bounded.Statement[0].Action), ","); got != "iam:GetRole" {
+		t.Errorf("Expected only the unconditioned action to stay, got %s", got)
+	}
+	conditioned := bounded.Statement[1]
+	if conditioned.Sid != "IamPermissionsBoundary" || conditioned.Resource != "arn:aws:iam::*:role/app" ||
+		conditioned.Condition["StringEquals"]["iam:PermissionsBoundary"] != boundary {
+		t.Errorf("Unexpected conditioned statement: %+v", conditioned)
+	}
+	if got := strings.Join(toStringSlice(conditioned.Action), ","); got != "iam:CreateRole" {
+		t.Errorf("Expected the role creation to need the boundary, got %s", got)
+	}
+
+	// The wildcard is expanded so the role writes it covers can be conditioned
+	rest := toStringSlice(bounded.Statement[2].Action)
+	if containsString(rest, "iam:Put*") || containsString(rest, "iam:PutRolePolicy") || !containsString(rest, "iam:PutUserPolicy") {
+		t.Errorf("Unexpected actions left from the wildcard: %v", rest)
+	}
+	if got := strings.Join(toStringSlice(bounded.Statement[3].Action), ","); got != "iam:PutRolePermissionsBoundary,iam:PutRolePolicy" {
+		t.Errorf("Unexpected conditioned actions from the wildcard: %s", got)
+	}
+
+	if unchanged, removed := requirePermissionsBoundary(policy, ""); len(unchanged.Statement) != 2 || removed != nil {
+		t.Errorf("Expected no change without a boundary")
+	}
+}
+
+func TestValidatePermissionsBoundary(t *testing.T) {
+	valid := []string{"", "arn:aws:iam::123456789012:policy/boundary", "arn:aws:iam::123456789012:policy/team/boundary"}
+	for _, boundary := range valid {
+		if err := validatePermissionsBoundary(boundary, "aws"); err != nil {
+			t.Errorf("Unexpected error for %q: %v", boundary, err)
+		}
+	}
+	invalid := []string{"boundary", "arn:aws:iam::123456789012:role/boundary", "arn:aws-cn:iam::123456789012:policy/boundary"}
+	for _, boundary := range invalid {
+		if err := validatePermissionsBoundary(boundary, "aws"); err == nil {
+			t.Errorf("Expected an error for %q", boundary)
+		}
+	}
+}
+
+func TestCreatedIAMEntities(t *testing.T) {
+	if err := loadPermissionsDB(); err != nil {
+		t.Fatalf("Error loading permissions DB: %v", err)
+	}
+	source := `resource "aws_iam_role" "app" {
+  name = "app"
+  path = "/service/"
+  assume_role_policy = jsonencode({
+    Statement = [{
+      Effect    = "Allow"
+      Action    = "sts:AssumeRole"
+      Principal = { Service = ["lambda.amazonaws.com", "edgelambda.amazonaws.com"] }
+    }]
+  })
+  permissions_boundary = "arn:aws:iam::123456789012:policy/other"
+}
+
+resource "aws_iam_role" "bounded" {
+  name                 = "bounded"
+  assume_role_policy   = "{}"
+  permissions_boundary = aws_iam_policy.boundary.arn
+}
+
+resource "aws_iam_policy" "boundary" {
+  name   = "boundary"
+  policy = jsonencode({
+    Statement = [{ Effect = "Allow", Action = ["s3:GetObject", "s3:PutObject"], Resource = "*" }]
+  })
+}
+`
+	result, err := parseTerraformSource([]byte(source), "main.tf")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	entities := createdIAMEntities(result)
+	if len(entities) != 3 {
+		t.Fatalf("Expected 3 entities, got %+v", entities)
+	}
+	role := entities[0]
+	if role.ARN != "arn:aws:iam::*:role/service/app" || strings.Join(role.TrustedBy, ",") != "edgelambda.amazonaws.com,lambda.amazonaws.com" {
+		t.Errorf("Unexpected role: %+v", role)
+	}
+	if policy := entities[2]; policy.ARN != "arn:aws:iam::*:policy/boundary" || policy.Actions != 2 {
+		t.Errorf("Unexpected policy: %+v", policy)
+	}
+
+	warnings := roleBoundaryWarnings(result, "arn:aws:iam::123456789012:policy/boundary")
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "aws_iam_role.app has permissions_boundary arn:aws:iam::123456789012:policy/other") {
+		t.Errorf("Expected a warning for the role with another boundary only, got %v", warnings)
+	}
+}
+
+func TestRoleWritesScopedToRole(t *testing.T) {
+	if err := loadPermissionsDB(); err != nil {
+		t.Fatalf("Error loading permissions DB: %v", err)
+	}
+	source := `resource "aws_iam_role_policy" "inline" {
+  name   = "inline"
+  role   = aws_iam_role.app.id
+  policy = "{}"
+}
+
+resource "aws_iam_role" "app" {
+  name               = "app"
+  assume_role_policy = "{}"
+}
+`
+	result, err := parseTerraformSource([]byte(source), "main.tf")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	policy := buildIAMPolicy(result, false, true)
+	found := false
+	for _, statement := range policy.Statement {
+		if containsString(toStringSlice(statement.Action), "iam:PutRolePolicy") {
+			found = true
+			if resource, _ := statement.Resource.(string); resource != "arn:aws:iam::*:role/app" {
+				t.Errorf("Expected the role writes on the role only, got %v", statement.Resource)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("Expected iam:PutRolePolicy in the policy, got %+v", policy.Statement)
+	}
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"path"
+	"strings"
+)
+
+// referenceRule infers actions a resource needs because it refers to
+// another resource, which the per-type permission lookup cannot see.
+type referenceRule struct {
+	From string // type glob of the referring resource
+	To   string // type of the referenced resource or data source
+	// RequiresAction limits the rule to referring resources whose own
+	// actions include it, e.g. types that pass a role.
+	RequiresAction string
+	// ExceptFrom is a type glob of referring resources the rule skips.
+	ExceptFrom string
+	Actions    []string
+	// OwnService adds the referring resource's own actions of this service
+	// to Actions, for resources whose actions on the target come from their
+	// own entry, like the kms actions of a function encrypted with a key.
+	OwnService string
+	// ScopeToTarget grants the actions on the referenced resource's ARN
+	// in least-privilege mode.
+	ScopeToTarget bool
+	// OtherRegion marks targets that are by definition in another Region
+	// than the referring resource, such as the primary of a replica; their
+	// ARNs match any Region.
+	OtherRegion bool
+	Reason      string
+}
+
+// referenceRules are the inferences made from the reference graph.
+var referenceRules = []referenceRule{
+	{
+		From:           "*",
+		To:             "aws_iam_role",
+		RequiresAction: "iam:PassRole",
+		Actions:        []string{"iam:PassRole"},
+		ScopeToTarget:  true,
+		Reason:         "passes the role to the service",
+	},
+	{
+		From:          "*",
+		To:            "aws_kms_key",
+		ExceptFrom:    "aws_kms_*",
+		OwnService:    "kms",
+		ScopeToTarget: true,
+		Reason:        "encrypts with the key",
+	},
+	{
+		From:          "aws_iam_role_policy",
+		To:            "aws_iam_role",
+		Actions:       []string{"iam:DeleteRolePolicy", "iam:GetRolePolicy", "iam:PutRolePolicy"},
+		ScopeToTarget: true,
+		Reason:        "writes the inline policy of the role",
+	},
+	{
+		From:          "aws_iam_role_policy_attachment",
+		To:            "aws_iam_role",
+		Actions:       []string{"iam:AttachRolePolicy", "iam:DetachRolePolicy", "iam:ListAttachedRolePolicies"},
+		ScopeToTarget: true,
+		Reason:        "attaches the policy to the role",
+	},
+	{
+		From:          "aws_s3_bucket_notification",
+		To:            "aws_lambda_function",
+		Actions:       []string{"lambda:AddPermission"},
+		ScopeToTarget: true,
+		Reason:        "lets S3 invoke the notified function",
+	},
+	{
+		From:          "aws_kms_replica_key",
+		To:            "aws_kms_key",
+		Actions:       []string{"kms:DescribeKey", "kms:ReplicateKey"},
+		ScopeToTarget: true,
+		OtherRegion:   true,
+		Reason:        "replicates the primary key from its Region",
+	},
+	{
+		From:          "aws_dynamodb_table_replica",
+		To:            "aws_dynamodb_table",
+		Actions:       []string{"dynamodb:CreateTableReplica", "dynamodb:DeleteTableReplica", "dynamodb:DescribeTable", "dynamodb:UpdateTable"},
+		ScopeToTarget: true,
+		OtherRegion:   true,
+		Reason:        "adds the replica through the global table in its Region",
+	},
+	{
+		From:    "aws_security_group*",
+		To:      "aws_security_group",
+		Actions: []string{"ec2:DescribeSecurityGroups", "ec2:DescribeSecurityGroupReferences"},
+		Reason:  "resolves the referenced security group, possibly in a peered VPC",
+	},
+	{
+		From:    "aws_vpc_security_group_*_rule",
+		To:      "aws_security_group",
+		Actions: []string{"ec2:DescribeSecurityGroups", "ec2:DescribeSecurityGroupReferences"},
+		Reason:  "resolves the referenced security group, possibly in a peered VPC",
+	},
+}
+
+// inferredPermission is a set of actions a resource needs because of a
+// resource it refers to. ARNs holds the target's rendered ARNs when the
+// rule scopes the actions to it and the target's type has an arn_template.
+type inferredPermission struct {
+	Address string
+	Target  string
+	Actions []string
+	ARNs    []string
+	Reason  string
+}
+
+// referenceGraph resolves the addresses in Resource.References to the
+// resources and data sources of a scan.
+type referenceGraph map[string]Resource
+
+func buildReferenceGraph(result *ParseResult) referenceGraph {
+	graph := make(referenceGraph, len(result.Resources)+len(result.DataSources))
+	for _, r := range result.Resources {
+		graph[resourceAddress(r)] = r
+	}
+	for _, ds := range result.DataSources {
+		graph[resourceAddress(ds)] = ds
+	}
+	return graph
+}
+
+// inferReferencePermissions applies referenceRules to every resource of
+// result and the resources it refers to, scopes the actions of companion
+// resources to the parent they configure (see resourceGroups), expands
+// multi-Region resources to their replica Regions (see replicaRules), and
+// adds the kms:Decrypt of data sources reading secret values encrypted with
+// a customer managed key (see secretValueReads).
+func inferReferencePermissions(result *ParseResult) []inferredPermission {
+	graph := buildReferenceGraph(result)
+
+	var inferred []inferredPermission
+	for _, resource := range result.Resources {
+		if !needsAWSPermissions(resource) {
+			continue
+		}
+		address := resourceAddress(resource)
+		if permission, ok := replicaPermission(resource, address); ok {
+			inferred = append(inferred, permission)
+		}
+		if len(resource.References) == 0 {
+			continue
+		}
+		own := resourceActions(resource)
+
+		for _, reference := range resource.References {
+			target, ok := graph[reference]
+			if !ok {
+				continue
+			}
+			for _, rule := range referenceRules {
+				if matched, _ := path.Match(rule.From, resource.Type); !matched || target.Type != rule.To {
+					continue
+				}
+				if excepted, _ := path.Match(rule.ExceptFrom, resource.Type); excepted {
+					continue
+				}
+				if rule.RequiresAction != "" && !containsString(own, rule.RequiresAction) {
+					continue
+				}
+				actions := rule.Actions
+				if rule.OwnService != "" {
+					actions = append([]string{}, actions...)
+					for _, action := range own {
+						if strings.HasPrefix(action, rule.OwnService+":") && !containsString(actions, action) {
+							actions = append(actions, action)
+						}
+					}
+				}
+				if len(actions) == 0 {
+					continue
+				}
+				permission := inferredPermission{
+					Address: address,
+					Target:  reference,
+					Actions: actions,
+					Reason:  rule.Reason,
+				}
+				if rule.ScopeToTarget {
+					context := defaultARNContext
+					if rule.OtherRegion {
+						context.Region = "*"
+					}
+					permission.ARNs = resourceARNs(&target, context)
+				}
+				inferred = append(inferred, permission)
+			}
+			if permission, ok := companionPermission(resource, own, target); ok {
+				inferred = append(inferred, permission)
+			}
+		}
+	}
+	return append(inferred, secretKeyPermissions(findSecretValueReads(result, graph))...)
+}
+
+// inferredByAddress groups inferred permissions by referring resource.
+func inferredByAddress(inferred []inferredPermission) map[string][]inferredPermission {
+	grouped := make(map[string][]inferredPermission)
+	for _, permission := range inferred {
+		grouped[permission.Address] = append(grouped[permission.Address], permission)
+	}
+	return grouped
+}
+
+// scopedInferredActions returns the actions of permissions that are scoped
+// to their targets' ARNs. A resource's own copy of such an action, like the
+// iam:PassRole of a Lambda function, then no longer needs the service-wide
+// ARN.
+func scopedInferredActions(permissions []inferredPermission) map[string]bool {
+	scoped := make(map[string]bool)
+	for _, permission := range permissions {
+		if len(permission.ARNs) > 0 {
+			for _, action := range permission.Actions {
+				scoped[action] = true
+			}
+		}
+	}
+	return scoped
+}
+
+// addInferredActions returns actions followed by the inferred actions they
+// do not already contain.
+func addInferredActions(actions []string, permissions []inferredPermission) []string {
+	if len(permissions) == 0 {
+		return actions
+	}
+	actions = append([]string{}, actions...)
+	for _, permission := range permissions {
+		for _, action := range permission.Actions {
+			if !containsString(actions, action) {
+				actions = append(actions, action)
+			}
+		}
+	}
+	return actions
+}
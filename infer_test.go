@@ -0,0 +1,72 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestInferReferencePermissions(t *testing.T) {
+	if err := loadPermissionsDB(); err != nil {
+		t.Fatalf("Error loading permissions DB: %v", err)
+	}
+
+	result := &ParseResult{
+		Resources: []Resource{
+			{Type: "aws_iam_role", Name: "exec", Provider: "aws",
+				Attributes: map[string]cty.Value{"name": cty.StringVal("lambda-exec")}},
+			{Type: "aws_lambda_function", Name: "fn", Provider: "aws",
+				Attributes: map[string]cty.Value{"function_name": cty.StringVal("thumbnails")},
+				References: []string{"aws_iam_role.exec"}},
+			{Type: "aws_s3_bucket", Name: "uploads", Provider: "aws",
+				Attributes: map[string]cty.Value{"bucket": cty.StringVal("uploads")}},
+			{Type: "aws_s3_bucket_notification", Name: "uploads", Provider: "aws",
+				References: []string{"aws_lambda_function.fn", "aws_s3_bucket.uploads"}},
+			{Type: "aws_iam_role_policy_attachment", Name: "exec", Provider: "aws",
+				References: []string{"aws_iam_role.exec"}},
+		},
+	}
+
+	var got []string
+	for _, permission := range inferReferencePermissions(result) {
+		got = append(got, permission.Address+" -> "+permission.Target+": "+
+			strings.Join(permission.Actions, ",")+" on "+strings.Join(permission.ARNs, ","))
+	}
+	want := []string{
+		"aws_lambda_function.fn -> aws_iam_role.exec: iam:PassRole on arn:aws:iam::*:role/lambda-exec",
+		"aws_s3_bucket_notification.uploads -> aws_lambda_function.fn: lambda:AddPermission on arn:aws:lambda:*:*:function:thumbnails",
+		"aws_s3_bucket_notification.uploads -> aws_s3_bucket.uploads: s3:GetBucketNotification,s3:PutBucketNotification on arn:aws:s3:::uploads",
+		"aws_iam_role_policy_attachment.exec -> aws_iam_role.exec: iam:AttachRolePolicy,iam:DetachRolePolicy,iam:ListAttachedRolePolicies on arn:aws:iam::*:role/lambda-exec",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Unexpected inferences:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestPassRoleScopedToReferencedRole(t *testing.T) {
+	if err := loadPermissionsDB(); err != nil {
+		t.Fatalf("Error loading permissions DB: %v", err)
+	}
+
+	result := &ParseResult{
+		Resources: []Resource{
+			{Type: "aws_lambda_function", Name: "fn", Provider: "aws",
+				Attributes: map[string]cty.Value{"function_name": cty.StringVal("thumbnails")},
+				References: []string{"aws_iam_role.exec"}},
+			{Type: "aws_iam_role", Name: "exec", Provider: "aws",
+				Attributes: map[string]cty.Value{"name": cty.StringVal("lambda-exec")}},
+		},
+	}
+
+	policy := buildIAMPolicy(result, false, true)
+	for _, statement := range policy.Statement {
+		if containsString(toStringSlice(statement.Action), "iam:PassRole") {
+			if statement.Resource != "arn:aws:iam::*:role/lambda-exec" {
+				t.Errorf("Expected iam:PassRole scoped to the referenced role, got %v", statement.Resource)
+			}
+			return
+		}
+	}
+	t.Errorf("No iam:PassRole statement in %+v", policy.Statement)
+}
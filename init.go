@@ -0,0 +1,314 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	initPathFlag      string
+	initOutputDirFlag string
+	initYesFlag       bool
+	initForceFlag     bool
+)
+
+var initCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Write a starter " + defaultConfigFile + " for a repository",
+	Long: `Inspect a repository and write a starter ` + defaultConfigFile + ` to its root.
+
+init finds the root modules (stacks) in the repository, the state backends
+and the providers they use, and proposes a configuration that scans every
+stack into its own policy file. Directories that look like examples or tests
+are listed but left out. On a terminal each choice is confirmed
+interactively; --yes accepts the proposal as is.
+
+Runs without --path then scan every stack listed in the file.`,
+	Args: cobra.NoArgs,
+	Run:  runInit,
+}
+
+func init() {
+	initCmd.Flags().StringVarP(&initPathFlag, "path", "p", ".", "Repository root to inspect and write the configuration to")
+	initCmd.Flags().StringVar(&initOutputDirFlag, "output-dir", "policies", "Directory, relative to the repository root, for the generated policies")
+	initCmd.Flags().BoolVarP(&initYesFlag, "yes", "y", false, "Accept the proposed configuration without prompting")
+	initCmd.Flags().BoolVar(&initForceFlag, "force", false, "Overwrite an existing configuration file")
+	_ = initCmd.MarkFlagDirname("path")
+	rootCmd.AddCommand(initCmd)
+}
+
+// skippedStackDirs are directory names whose root modules init leaves out,
+// since they hold examples and test fixtures rather than deployed stacks.
+var skippedStackDirs = map[string]bool{
+	"example": true, "examples": true, "test": true, "tests": true,
+	"testdata": true, "fixtures": true, "test-fixtures": true,
+}
+
+// detectedStack is a root module found by detectRepository. Path is relative
+// to the repository root.
+type detectedStack struct {
+	Path      string
+	Backend   string
+	Providers []string
+	Skipped   bool
+}
+
+// repositoryLayout is what init found in a repository.
+type repositoryLayout struct {
+	Stacks    []detectedStack
+	Backends  []string
+	Providers []string
+}
+
+func runInit(cmd *cobra.Command, args []string) {
+	target := filepath.Join(initPathFlag, defaultConfigFile)
+	if _, err := os.Stat(target); err == nil && !initForceFlag {
+		fmt.Fprintf(os.Stderr, "Error: %s already exists (use --force to overwrite)\n", target)
+		os.Exit(1)
+	}
+
+	layout, err := detectRepository(initPathFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if len(layout.Stacks) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: no Terraform files found in %s\n", initPathFlag)
+		os.Exit(1)
+	}
+
+	fmt.Fprintf(os.Stderr, "Found %d stack(s) in %s\n", len(layout.Stacks), initPathFlag)
+	if len(layout.Backends) > 0 {
+		fmt.Fprintf(os.Stderr, "  Backends: %s\n", strings.Join(layout.Backends, ", "))
+	}
+	if len(layout.Providers) > 0 {
+		fmt.Fprintf(os.Stderr, "  Providers: %s\n", strings.Join(layout.Providers, ", "))
+	}
+
+	options := initOptions{OutputDir: initOutputDirFlag, LeastPrivilege: true}
+	if !initYesFlag && isTerminal(os.Stdin) {
+		options = promptInitOptions(bufio.NewReader(os.Stdin), os.Stderr, &layout, options)
+	}
+
+	if err := writeOutputFile(target, []byte(renderInitConfig(layout, options)), 0644, initForceFlag); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing configuration: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Fprintf(os.Stderr, "Configuration written to: %s\n", target)
+	fmt.Fprintf(os.Stderr, "Run tf-iam-scanner from %s to generate a policy for every stack.\n", initPathFlag)
+}
+
+// detectRepository finds the root modules below root: directories with .tf
+// files that are not the source of a local module call. .terraform and
+// hidden directories are ignored.
+func detectRepository(root string) (repositoryLayout, error) {
+	if _, err := os.Stat(root); err != nil {
+		return repositoryLayout{}, err
+	}
+
+	type dirInfo struct {
+		backend   string
+		providers map[string]bool
+	}
+	dirs := make(map[string]*dirInfo)
+	moduleDirs := make(map[string]bool)
+
+	walkTerraformDir(root, false, func(path string, info os.FileInfo) {
+		rel, err := filepath.Rel(root, path)
+		if err != nil || !isConfigFile(path) || hiddenPath(rel) {
+			return
+		}
+		parsed, err := parseTerraformFile(path)
+		if err != nil {
+			return
+		}
+
+		dir := filepath.Dir(rel)
+		d := dirs[dir]
+		if d == nil {
+			d = &dirInfo{providers: make(map[string]bool)}
+			dirs[dir] = d
+		}
+		if parsed.Backend != nil {
+			d.backend = parsed.Backend.Type
+		}
+		for _, r := range append(parsed.Resources, parsed.DataSources...) {
+			if r.Provider != "" {
+				d.providers[r.Provider] = true
+			}
+		}
+		for _, call := range parsed.ModuleCalls {
+			if isLocalModuleSource(call.Source) {
+				moduleDirs[realPath(filepath.Join(call.Dir, call.Source))] = true
+			}
+		}
+	}, func(string) {})
+
+	var layout repositoryLayout
+	backends := make(map[string]bool)
+	providers := make(map[string]bool)
+	for dir, d := range dirs {
+		if moduleDirs[realPath(filepath.Join(root, dir))] {
+			continue
+		}
+		stack := detectedStack{
+			Path:      filepath.ToSlash(dir),
+			Backend:   d.backend,
+			Providers: sortedSet(d.providers),
+			Skipped:   skippedStackPath(dir),
+		}
+		layout.Stacks = append(layout.Stacks, stack)
+		if stack.Skipped {
+			continue
+		}
+		if d.backend != "" {
+			backends[d.backend] = true
+		}
+		for provider := range d.providers {
+			providers[provider] = true
+		}
+	}
+	sort.Slice(layout.Stacks, func(i, j int) bool { return layout.Stacks[i].Path < layout.Stacks[j].Path })
+	layout.Backends = sortedSet(backends)
+	layout.Providers = sortedSet(providers)
+	return layout, nil
+}
+
+// hiddenPath reports whether a relative path is inside a hidden directory
+// such as .terraform or .git.
+func hiddenPath(rel string) bool {
+	for _, part := range strings.Split(filepath.Dir(rel), string(filepath.Separator)) {
+		if strings.HasPrefix(part, ".") && part != "." {
+			return true
+		}
+	}
+	return false
+}
+
+func skippedStackPath(dir string) bool {
+	for _, part := range strings.Split(dir, string(filepath.Separator)) {
+		if skippedStackDirs[strings.ToLower(part)] {
+			return true
+		}
+	}
+	return false
+}
+
+// initOptions are the choices init asks about.
+type initOptions struct {
+	OutputDir      string
+	LeastPrivilege bool
+}
+
+// promptInitOptions asks whether to include each stack and for the output
+// settings, starting from the proposed defaults.
+func promptInitOptions(in *bufio.Reader, out io.Writer, layout *repositoryLayout, options initOptions) initOptions {
+	for i := range layout.Stacks {
+		stack := &layout.Stacks[i]
+		stack.Skipped = !promptYesNo(in, out, fmt.Sprintf("Scan stack %s?", stack.Path), !stack.Skipped)
+	}
+	options.LeastPrivilege = promptYesNo(in, out, "Generate least-privilege policies (one statement per service, scoped ARNs)?", options.LeastPrivilege)
+	options.OutputDir = promptString(in, out, "Directory for the generated policies", options.OutputDir)
+	return options
+}
+
+// promptYesNo asks a yes/no question; an empty answer picks def.
+func promptYesNo(in *bufio.Reader, out io.Writer, question string, def bool) bool {
+	hint := "[Y/n]"
+	if !def {
+		hint = "[y/N]"
+	}
+	for {
+		fmt.Fprintf(out, "%s %s ", question, hint)
+		answer, err := in.ReadString('\n')
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "":
+			return def
+		case "y", "yes":
+			return true
+		case "n", "no":
+			return false
+		}
+		if err != nil {
+			return def
+		}
+	}
+}
+
+// promptString asks for a value; an empty answer picks def.
+func promptString(in *bufio.Reader, out io.Writer, question, def string) string {
+	fmt.Fprintf(out, "%s [%s] ", question, def)
+	answer, _ := in.ReadString('\n')
+	if answer = strings.TrimSpace(answer); answer != "" {
+		return answer
+	}
+	return def
+}
+
+// renderInitConfig writes the configuration file proposed for layout, with
+// comments explaining each setting.
+func renderInitConfig(layout repositoryLayout, options initOptions) string {
+	var sb strings.Builder
+	sb.WriteString("# tf-iam-scanner configuration, written by tf-iam-scanner init.\n")
+	sb.WriteString("# Flags given on the command line take precedence over these settings.\n\n")
+
+	fmt.Fprintf(&sb, "# One statement per service, scoped to resource ARNs.\nleast_privilege: %t\n\n", options.LeastPrivilege)
+
+	if len(layout.Backends) > 0 {
+		fmt.Fprintf(&sb, "# Detected backends: %s. terraform init needs access to the state.\n", strings.Join(layout.Backends, ", "))
+		sb.WriteString("include_state_backend: true\n\n")
+	} else {
+		sb.WriteString("# No backend detected; state is local.\ninclude_state_backend: false\n\n")
+	}
+
+	sb.WriteString("format: json\n\n")
+
+	sb.WriteString("# Resource and data source types to include or leave out, as globs.\n")
+	sb.WriteString("# include_types: [\"aws_*\"]\n")
+	sb.WriteString("# exclude_types: [\"aws_iam_*\"]\n\n")
+
+	sb.WriteString("# Actions that must never appear in a generated policy.\n")
+	sb.WriteString("# exclude_actions:\n#   - iam:Delete*\n#   - kms:ScheduleKeyDeletion\n\n")
+
+	sb.WriteString("# Collapse a service's actions into service:* above this many, except for\n# the services listed in never_wildcard.\n")
+	sb.WriteString("# wildcard_threshold: 10\n# never_wildcard: [iam, kms, sts]\n\n")
+
+	sb.WriteString("# Skip .tf and state files larger than this (0: no limit).\n")
+	sb.WriteString("# max_file_size: 10MB\n\n")
+
+	sb.WriteString("# Statements appended to every generated policy (no principals).\n")
+	sb.WriteString("# extra_statements:\n#   - sid: CallerIdentity\n#     effect: Allow\n#     action: sts:GetCallerIdentity\n#     resource: \"*\"\n")
+	sb.WriteString("#   - sid: DenyUnencryptedUploads\n#     effect: Deny\n#     action: s3:PutObject\n#     resource: \"*\"\n")
+	sb.WriteString("#     condition:\n#       \"Null\": {\"s3:x-amz-server-side-encryption\": \"true\"}\n\n")
+
+	if len(layout.Providers) > 0 {
+		fmt.Fprintf(&sb, "# Detected providers: %s.\n", strings.Join(layout.Providers, ", "))
+	}
+	sb.WriteString("# Stacks scanned by a run without --path, each into its own policy.\n")
+	sb.WriteString("stacks:\n")
+	for _, stack := range layout.Stacks {
+		prefix := "  "
+		if stack.Skipped {
+			prefix = "  # "
+		}
+		fmt.Fprintf(&sb, "%s- path: %s\n", prefix, stack.Path)
+		fmt.Fprintf(&sb, "%s  output: %s\n", prefix, filepath.ToSlash(filepath.Join(options.OutputDir, stackPolicyName(stack.Path)+".json")))
+	}
+	return sb.String()
+}
+
+// stackPolicyName names the policy file of a stack after its path, e.g.
+// "stacks-network" for stacks/network and "root" for the repository root.
+func stackPolicyName(path string) string {
+	if path == "." {
+		return "root"
+	}
+	return strings.ReplaceAll(path, "/", "-")
+}
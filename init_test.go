@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDetectRepository(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "stacks", "network", "main.tf"), `
+terraform {
+  backend "s3" {
+    bucket = "state"
+    key    = "network.tfstate"
+  }
+}
+
+module "vpc" {
+  source = "../../modules/vpc"
+}
+`)
+	writeTestFile(t, filepath.Join(dir, "stacks", "app", "main.tf"), `
+resource "aws_s3_bucket" "assets" {
+  bucket = "assets"
+}
+`)
+	writeTestFile(t, filepath.Join(dir, "modules", "vpc", "main.tf"), `
+resource "aws_vpc" "main" {
+  cidr_block = "10.0.0.0/16"
+}
+`)
+	writeTestFile(t, filepath.Join(dir, "examples", "basic", "main.tf"), `
+resource "aws_sqs_queue" "example" {}
+`)
+	writeTestFile(t, filepath.Join(dir, "stacks", "app", ".terraform", "modules", "x", "main.tf"), `
+resource "aws_instance" "cached" {}
+`)
+
+	layout, err := detectRepository(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var paths []string
+	for _, stack := range layout.Stacks {
+		paths = append(paths, stack.Path)
+		if skipped := stack.Path == "examples/basic"; stack.Skipped != skipped {
+			t.Errorf("Stack %s: expected skipped=%t", stack.Path, skipped)
+		}
+	}
+	if got := strings.Join(paths, ","); got != "examples/basic,stacks/app,stacks/network" {
+		t.Errorf("Unexpected stacks: %s", got)
+	}
+	if strings.Join(layout.Backends, ",") != "s3" {
+		t.Errorf("Expected the s3 backend, got %v", layout.Backends)
+	}
+	if strings.Join(layout.Providers, ",") != "aws" {
+		t.Errorf("Expected the aws provider, got %v", layout.Providers)
+	}
+}
+
+func TestRenderInitConfig(t *testing.T) {
+	layout := repositoryLayout{
+		Stacks: []detectedStack{
+			{Path: "."},
+			{Path: "stacks/network", Backend: "s3"},
+			{Path: "examples/basic", Skipped: true},
+		},
+		Backends:  []string{"s3"},
+		Providers: []string{"aws"},
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, defaultConfigFile)
+	if err := os.WriteFile(path, []byte(renderInitConfig(layout, initOptions{OutputDir: "policies", LeastPrivilege: true})), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := loadConfig(path)
+	if err != nil {
+		t.Fatalf("The generated configuration should load: %v", err)
+	}
+	if config.LeastPrivilege == nil || !*config.LeastPrivilege {
+		t.Errorf("Expected least_privilege: true")
+	}
+	if config.IncludeStateBackend == nil || !*config.IncludeStateBackend {
+		t.Errorf("Expected include_state_backend: true when a backend was detected")
+	}
+	if len(config.Stacks) != 2 {
+		t.Fatalf("Expected the skipped stack to be commented out, got %+v", config.Stacks)
+	}
+	if config.Stacks[0].Path != dir || config.Stacks[0].Output != filepath.Join(dir, "policies", "root.json") {
+		t.Errorf("Unexpected root stack: %+v", config.Stacks[0])
+	}
+	if config.Stacks[1].Output != filepath.Join(dir, "policies", "stacks-network.json") {
+		t.Errorf("Unexpected output: %s", config.Stacks[1].Output)
+	}
+}
+
+func TestPromptInitOptions(t *testing.T) {
+	layout := repositoryLayout{Stacks: []detectedStack{{Path: "app"}, {Path: "examples/basic", Skipped: true}}}
+	in := bufio.NewReader(strings.NewReader("n\nyes\n\nout\n"))
+	options := promptInitOptions(in, io.Discard, &layout, initOptions{OutputDir: "policies", LeastPrivilege: true})
+
+	if !layout.Stacks[0].Skipped || layout.Stacks[1].Skipped {
+		t.Errorf("Answers should override the proposal: %+v", layout.Stacks)
+	}
+	if !options.LeastPrivilege || options.OutputDir != "out" {
+		t.Errorf("Unexpected options: %+v", options)
+	}
+
+	options = promptInitOptions(bufio.NewReader(strings.NewReader("")), io.Discard, &layout, initOptions{OutputDir: "policies"})
+	if options.OutputDir != "policies" {
+		t.Errorf("At end of input the defaults should be kept, got %+v", options)
+	}
+}
@@ -0,0 +1,245 @@
+// Package cfntypes converts CloudFormation resource type names to the
+// Terraform AWS provider types the permissions database is keyed by. The
+// generator names entries with it, and the scanner maps the resources of
+// CloudFormation templates back to those entries.
+package cfntypes
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// fullTypeOverrides handles CFN types whose TF names fundamentally deviate
+// from the aws_<service>_<resource> pattern. This covers:
+//   - EC2 resources that drop the ec2_ prefix (aws_instance, aws_vpc, …)
+//   - ELB / ELBv2 resources that use the lb_ / elb_ prefix
+//   - Other known irregularities
+var fullTypeOverrides = map[string]string{
+	// EC2 — these drop the "ec2_" service prefix in Terraform
+	"AWS::EC2::Instance":             "aws_instance",
+	"AWS::EC2::VPC":                  "aws_vpc",
+	"AWS::EC2::Subnet":               "aws_subnet",
+	"AWS::EC2::SecurityGroup":        "aws_security_group",
+	"AWS::EC2::SecurityGroupEgress":  "aws_security_group_rule",
+	"AWS::EC2::SecurityGroupIngress": "aws_security_group_rule",
+	"AWS::EC2::NetworkInterface":     "aws_network_interface",
+	"AWS::EC2::EIP":                  "aws_eip",
+	"AWS::EC2::RouteTable":           "aws_route_table",
+	"AWS::EC2::InternetGateway":      "aws_internet_gateway",
+	"AWS::EC2::NatGateway":           "aws_nat_gateway",
+	"AWS::EC2::Volume":               "aws_ebs_volume",
+	"AWS::EC2::VPCEndpoint":          "aws_vpc_endpoint",
+	"AWS::EC2::VPCPeeringConnection": "aws_vpc_peering_connection",
+	"AWS::EC2::VPNGateway":           "aws_vpn_gateway",
+	"AWS::EC2::VPNConnection":        "aws_vpn_connection",
+	"AWS::EC2::CustomerGateway":      "aws_customer_gateway",
+	"AWS::EC2::NetworkAcl":           "aws_network_acl",
+	"AWS::EC2::PlacementGroup":       "aws_placement_group",
+	"AWS::EC2::KeyPair":              "aws_key_pair",
+	"AWS::EC2::SpotFleet":            "aws_spot_fleet_request",
+	"AWS::EC2::DHCPOptions":          "aws_vpc_dhcp_options",
+	// ELB / ELBv2 — use lb_ / elb_ prefix instead of elastic_load_balancing
+	"AWS::ElasticLoadBalancingV2::LoadBalancer": "aws_lb",
+	"AWS::ElasticLoadBalancing::LoadBalancer":   "aws_elb",
+	"AWS::ElasticLoadBalancingV2::Listener":     "aws_lb_listener",
+	"AWS::ElasticLoadBalancingV2::TargetGroup":  "aws_lb_target_group",
+	"AWS::ElasticLoadBalancingV2::ListenerRule": "aws_lb_listener_rule",
+	// Auto Scaling
+	"AWS::AutoScaling::AutoScalingGroup":    "aws_autoscaling_group",
+	"AWS::AutoScaling::LaunchConfiguration": "aws_launch_configuration",
+	// RDS
+	"AWS::RDS::DBInstance":    "aws_db_instance",
+	"AWS::RDS::DBCluster":     "aws_rds_cluster",
+	"AWS::RDS::DBSubnetGroup": "aws_db_subnet_group",
+	// SSM
+	"AWS::SSM::Parameter": "aws_ssm_parameter",
+	// Route53
+	"AWS::Route53::RecordSet":  "aws_route53_record",
+	"AWS::Route53::HostedZone": "aws_route53_zone",
+	// CloudWatch Logs
+	"AWS::Logs::LogGroup": "aws_cloudwatch_log_group",
+	// S3 (for correctness — the algorithm also handles this)
+	"AWS::S3::Bucket": "aws_s3_bucket",
+	// IAM — ManagedPolicy is aws_iam_policy; the inline AWS::IAM::Policy has
+	// no single Terraform type (aws_iam_role_policy and its siblings have
+	// their own schemas) and would otherwise take the aws_iam_policy name
+	"AWS::IAM::ManagedPolicy": "aws_iam_policy",
+	"AWS::IAM::Policy":        "",
+}
+
+// serviceNameOverrides maps CFN service names to the exact Terraform provider
+// service prefix when the general CamelToSnake function would produce a
+// different result. This covers acronyms that become part of the word
+// (DynamoDB→dynamodb) and other naming anomalies (ApiGatewayV2→apigatewayv2).
+var serviceNameOverrides = map[string]string{
+	"DynamoDB":             "dynamodb",
+	"OpenSearchService":    "opensearch",
+	"Elasticsearch":        "elasticsearch",
+	"SecretsManager":       "secretsmanager",
+	"CertificateManager":   "acm",
+	"WAFRegional":          "wafregional",
+	"WAFv2":                "wafv2",
+	"ApiGatewayV2":         "apigatewayv2",
+	"ElasticLoadBalancing": "elastic_load_balancing",
+	"AutoScaling":          "autoscaling",
+	"ElastiCache":          "elasticache",
+	"KinesisFirehose":      "kinesis_firehose",
+	"CloudFront":           "cloudfront",
+	"CloudWatch":           "cloudwatch",
+	"Redshift":             "redshift",
+	"ServiceDiscovery":     "service_discovery",
+	"StepFunctions":        "sfn",
+	"NetworkFirewall":      "networkfirewall",
+	"MediaConvert":         "media_convert",
+	"MediaStore":           "media_store",
+	"StorageGateway":       "storagegateway",
+	"CodePipeline":         "codepipeline",
+	"CodeDeploy":           "codedeploy",
+	"CodeBuild":            "codebuild",
+	"CodeCommit":           "codecommit",
+	"AppSync":              "appsync",
+	"AppMesh":              "appmesh",
+	"Pinpoint":             "pinpoint",
+	"Amplify":              "amplify",
+	"Backup":               "backup",
+	"Batch":                "batch",
+	"GuardDuty":            "guardduty",
+	"SecurityHub":          "securityhub",
+	"Inspector":            "inspector",
+	"Config":               "config",
+	"Shield":               "shield",
+	"Transfer":             "transfer",
+	"AmazonMQ":             "mq",
+	"IoT":                  "iot",
+	"Timestream":           "timestreamwrite",
+	"DocDB":                "docdb",
+	"Neptune":              "neptune",
+	"MemoryDB":             "memorydb",
+	"QLDB":                 "qldb",
+	"FSx":                  "fsx",
+	"DataSync":             "datasync",
+	"Athena":               "athena",
+	"Glue":                 "glue",
+	"Events":               "cloudwatch_event",
+	"AutoScalingPlans":     "autoscalingplans",
+	"CloudFormation":       "cloudformation",
+}
+
+// TerraformType converts a CloudFormation type name (e.g. "AWS::S3::Bucket")
+// to its Terraform AWS provider equivalent (e.g. "aws_s3_bucket").
+//
+// It first consults the fullTypeOverrides map for known deviations from the
+// general pattern, then falls back to the algorithmic conversion:
+//
+//	aws_<service>_<resource>
+//
+// The CamelCase-to-snake_case conversion handles multi-word identifiers,
+// acronyms, and version suffixes.
+func TerraformType(cfnType string) string {
+	// Check full-type overrides first (fundamental pattern deviations).
+	if tf, ok := fullTypeOverrides[cfnType]; ok {
+		return tf
+	}
+
+	parts := strings.Split(cfnType, "::")
+	if len(parts) != 3 {
+		return ""
+	}
+
+	service := parts[1]
+	resource := parts[2]
+
+	svcName := convertServiceName(service)
+	resName := convertResourceName(resource)
+
+	return fmt.Sprintf("aws_%s_%s", svcName, resName)
+}
+
+// convertServiceName converts a CFN service name to the Terraform-appropriate
+// snake_case form. It checks the serviceNameOverrides map first, then falls
+// back to CamelToSnake with version-suffix merging.
+func convertServiceName(s string) string {
+	if tf, ok := serviceNameOverrides[s]; ok {
+		return tf
+	}
+
+	result := CamelToSnake(s)
+
+	// Merge trailing version suffixes: _v2 → v2, _V3 → v3, etc.
+	// This handles services like ElasticLoadBalancingV2, WAFv2, etc.
+	re := regexp.MustCompile(`_v(\d+)$`)
+	if m := re.FindStringSubmatch(result); m != nil {
+		suffix := "v" + m[1]
+		result = strings.TrimSuffix(result, "_"+suffix) + suffix
+	}
+
+	return result
+}
+
+// convertResourceName converts a CFN resource name to its Terraform
+// snake_case form.
+func convertResourceName(s string) string {
+	return CamelToSnake(s)
+}
+
+// CamelToSnake converts a CamelCase identifier to snake_case.
+//
+// Examples:
+//
+//	RestApi           → rest_api
+//	DBInstance        → db_instance
+//	IAMRole           → iam_role
+//	DynamoDB          → dynamo_db  (use serviceNameOverrides for dynamodb)
+//	S3                → s3
+//	S3Bucket          → s3_bucket
+//	ApiGatewayV2      → api_gateway_v2 (caller merges _v2 suffix)
+func CamelToSnake(s string) string {
+	if s == "" {
+		return ""
+	}
+
+	var buf strings.Builder
+	runes := []rune(s)
+	i := 0
+
+	for i < len(runes) {
+		// ---- multi-character uppercase acronym, e.g. "DB" in "DBInstance" ----
+		if i+1 < len(runes) && unicode.IsUpper(runes[i]) && unicode.IsUpper(runes[i+1]) {
+			end := i + 1
+			for end < len(runes) && unicode.IsUpper(runes[end]) {
+				end++
+			}
+			// If the acronym is followed by a lowercase letter, the last
+			// uppercase belongs to the next word: "DBInstance" → DB | Instance
+			if end < len(runes) && unicode.IsLower(runes[end]) {
+				end--
+			}
+			if end > i {
+				if buf.Len() > 0 {
+					buf.WriteByte('_')
+				}
+				buf.WriteString(strings.ToLower(string(runes[i:end])))
+				i = end
+				continue
+			}
+		}
+
+		// ---- single uppercase letter ----
+		if unicode.IsUpper(runes[i]) {
+			if buf.Len() > 0 {
+				buf.WriteByte('_')
+			}
+			buf.WriteRune(unicode.ToLower(runes[i]))
+			i++
+			continue
+		}
+
+		// ---- anything else (lowercase, digits) ----
+		buf.WriteRune(runes[i])
+		i++
+	}
+
+	return buf.String()
+}
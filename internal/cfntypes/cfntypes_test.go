@@ -0,0 +1,37 @@
+package cfntypes
+
+import "testing"
+
+func TestTerraformType(t *testing.T) {
+	tests := map[string]string{
+		"AWS::S3::Bucket":                           "aws_s3_bucket",
+		"AWS::EC2::VPC":                             "aws_vpc",
+		"AWS::SQS::Queue":                           "aws_sqs_queue",
+		"AWS::DynamoDB::Table":                      "aws_dynamodb_table",
+		"AWS::RDS::DBInstance":                      "aws_db_instance",
+		"AWS::ApiGatewayV2::Api":                    "aws_apigatewayv2_api",
+		"AWS::CloudFormation::Stack":                "aws_cloudformation_stack",
+		"AWS::ElasticLoadBalancingV2::LoadBalancer": "aws_lb",
+		"AWS::IAM::Policy":                          "",
+		"Custom::Thing":                             "",
+	}
+	for cfnType, want := range tests {
+		if got := TerraformType(cfnType); got != want {
+			t.Errorf("TerraformType(%q) = %q, want %q", cfnType, got, want)
+		}
+	}
+}
+
+func TestCamelToSnake(t *testing.T) {
+	tests := map[string]string{
+		"RestApi":    "rest_api",
+		"DBInstance": "db_instance",
+		"S3Bucket":   "s3_bucket",
+		"":           "",
+	}
+	for in, want := range tests {
+		if got := CamelToSnake(in); got != want {
+			t.Errorf("CamelToSnake(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,381 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+// JSON configuration files (.tf.json and .tofu.json) are rewritten into the
+// equivalent native syntax before parsing, so that every block is extracted
+// by the same code whichever syntax it was written in. Blocks and arguments
+// are written on the line of their JSON key where they fit, and locations
+// found in the native text are mapped back to the JSON file's lines.
+
+// jsonValue is a value of a JSON configuration file with the line of the
+// key it is the value of. Objects keep their keys in file order.
+type jsonValue struct {
+	line   int
+	object []jsonMember
+	array  []*jsonValue
+	scalar interface{} // string, json.Number, bool or nil
+	kind   byte        // '{', '[' or 0 for scalars
+}
+
+type jsonMember struct {
+	key   string
+	value *jsonValue
+}
+
+// jsonTopLevelLabels is the number of labels of each top-level block type;
+// other top-level keys are not read by the scanner and are skipped.
+var jsonTopLevelLabels = map[string]int{
+	"resource":  2,
+	"data":      2,
+	"ephemeral": 2,
+	"module":    1,
+	"provider":  1,
+	"variable":  1,
+	"output":    1,
+	"check":     1,
+	"terraform": 0,
+	"locals":    0,
+}
+
+// jsonMapAttributes are resource arguments whose values are maps, which
+// the block-or-attribute guess would otherwise take for nested blocks.
+var jsonMapAttributes = map[string]bool{
+	"tags":       true,
+	"tags_all":   true,
+	"variables":  true,
+	"triggers":   true,
+	"labels":     true,
+	"parameters": true,
+}
+
+// jsonTraversalAttributes are arguments whose strings are references, not
+// templates: provider = "aws.west", depends_on = ["aws_iam_role.app"].
+var jsonTraversalAttributes = map[string]bool{
+	"provider":             true,
+	"providers":            true,
+	"depends_on":           true,
+	"ignore_changes":       true,
+	"replace_triggered_by": true,
+}
+
+// nativeFromJSON rewrites a JSON configuration file into native syntax and
+// returns the JSON line of each native line. It returns a diagnostic instead
+// when the file is not valid JSON.
+func nativeFromJSON(content []byte, filePath string) ([]byte, jsonLineMap, *hcl.Diagnostic) {
+	lines := newLineIndex(content)
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+	root, err := decodeJSONValue(decoder, lines, 1)
+	if err == nil {
+		if _, err = decoder.Token(); err == io.EOF {
+			err = nil
+		} else if err == nil {
+			err = fmt.Errorf("unexpected content after the top-level object")
+		}
+	}
+	if err == nil && root.kind != '{' {
+		err = fmt.Errorf("the root of a JSON configuration file must be an object")
+	}
+	if err != nil {
+		line := lines.line(int(decoder.InputOffset()))
+		return nil, nil, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid JSON configuration",
+			Detail:   err.Error(),
+			Subject:  &hcl.Range{Filename: filePath, Start: hcl.Pos{Line: line, Column: 1}, End: hcl.Pos{Line: line, Column: 1}},
+		}
+	}
+
+	w := &nativeWriter{source: 1}
+	for _, member := range root.object {
+		labels, ok := jsonTopLevelLabels[member.key]
+		if !ok {
+			continue
+		}
+		w.labeledBlocks(member.key, nil, labels, member.value)
+	}
+	return w.buf.Bytes(), append(w.lines, w.source), nil
+}
+
+// decodeJSONValue reads the next value from decoder; line is the line of
+// the key it belongs to.
+func decodeJSONValue(decoder *json.Decoder, lines lineIndex, line int) (*jsonValue, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	value := &jsonValue{line: line}
+	switch token {
+	case json.Delim('{'):
+		value.kind = '{'
+		for decoder.More() {
+			key, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			keyLine := lines.line(int(decoder.InputOffset()))
+			member, err := decodeJSONValue(decoder, lines, keyLine)
+			if err != nil {
+				return nil, err
+			}
+			value.object = append(value.object, jsonMember{key: key.(string), value: member})
+		}
+		_, err = decoder.Token()
+	case json.Delim('['):
+		value.kind = '['
+		for decoder.More() {
+			item, err := decodeJSONValue(decoder, lines, lines.line(int(decoder.InputOffset())))
+			if err != nil {
+				return nil, err
+			}
+			value.array = append(value.array, item)
+		}
+		_, err = decoder.Token()
+	default:
+		value.scalar = token
+	}
+	return value, err
+}
+
+// lineIndex maps byte offsets of a file to line numbers.
+type lineIndex []int
+
+func newLineIndex(content []byte) lineIndex {
+	var newlines lineIndex
+	for i, b := range content {
+		if b == '\n' {
+			newlines = append(newlines, i)
+		}
+	}
+	return newlines
+}
+
+// line returns the line of the byte before offset, where the decoder has
+// just finished reading a token.
+func (index lineIndex) line(offset int) int {
+	return sort.SearchInts(index, offset-1) + 1
+}
+
+// nativeWriter writes native syntax, recording the JSON line each native
+// line comes from.
+type nativeWriter struct {
+	buf    bytes.Buffer
+	lines  jsonLineMap
+	source int // JSON line of what is being written
+}
+
+// at starts what is written next on the native line of the JSON key at
+// line, padding with newlines while the native text is behind; objects
+// written on one line in JSON take several native lines.
+func (w *nativeWriter) at(line int) {
+	for len(w.lines)+1 < line {
+		w.lines = append(w.lines, len(w.lines)+1)
+		w.buf.WriteByte('\n')
+	}
+	w.source = line
+}
+
+func (w *nativeWriter) write(s string) {
+	w.buf.WriteString(s)
+	for i := strings.Count(s, "\n"); i > 0; i-- {
+		w.lines = append(w.lines, w.source)
+	}
+}
+
+// jsonLineMap holds the JSON line of each line of the native text.
+type jsonLineMap []int
+
+// line returns the JSON line of a native line.
+func (m jsonLineMap) line(native int) int {
+	if native < 1 || native > len(m) {
+		return native
+	}
+	return m[native-1]
+}
+
+// remapJSONLines moves the locations of result, parsed from the native text
+// of the JSON file at filePath, to the lines of the JSON file.
+func remapJSONLines(result *ParseResult, filePath string, lines jsonLineMap) {
+	for i := range result.Resources {
+		result.Resources[i].Line = lines.line(result.Resources[i].Line)
+	}
+	for i := range result.DataSources {
+		result.DataSources[i].Line = lines.line(result.DataSources[i].Line)
+	}
+	// Diagnostics are also reported as warnings
+	remapped := make(map[string]string)
+	for i, d := range result.Diagnostics {
+		result.Diagnostics[i].Line = lines.line(d.Line)
+		remapped[d.String()] = result.Diagnostics[i].String()
+	}
+	for i, warning := range result.Warnings {
+		if moved, ok := remapped[warning]; ok {
+			result.Warnings[i] = moved
+		}
+	}
+	prefix := filepath.ToSlash(filePath) + ":"
+	for i, finding := range result.Findings {
+		if native, err := strconv.Atoi(strings.TrimPrefix(finding.Location, prefix)); err == nil && strings.HasPrefix(finding.Location, prefix) {
+			result.Findings[i].Location = prefix + strconv.Itoa(lines.line(native))
+		}
+	}
+}
+
+// labeledBlocks writes the blocks of type blockType whose remaining labels
+// are the keys of the nested objects of value, as in
+// "resource": {"aws_s3_bucket": {"logs": {...}}}. A body given as an array
+// of objects is a list of blocks with the same labels.
+func (w *nativeWriter) labeledBlocks(blockType string, labels []string, remaining int, value *jsonValue) {
+	if remaining > 0 {
+		if value.kind != '{' {
+			return
+		}
+		for _, member := range value.object {
+			w.labeledBlocks(blockType, append(labels[:len(labels):len(labels)], member.key), remaining-1, member.value)
+		}
+		return
+	}
+	bodies := []*jsonValue{value}
+	if value.kind == '[' {
+		bodies = value.array
+	}
+	for _, body := range bodies {
+		if body.kind != '{' {
+			continue
+		}
+		w.at(body.line)
+		w.write(blockType)
+		for _, label := range labels {
+			w.write(" " + strconv.Quote(label))
+		}
+		w.write(" {\n")
+		w.body(blockType, body)
+		w.write("}\n")
+	}
+}
+
+// body writes the arguments and nested blocks of a block of type blockType.
+func (w *nativeWriter) body(blockType string, body *jsonValue) {
+	for _, member := range body.object {
+		if member.key == "//" || !hclsyntax.ValidIdentifier(member.key) {
+			continue
+		}
+		if blockType == "variable" && (member.key == "type" || member.key == "validation") {
+			continue
+		}
+		if labels := jsonNestedBlockLabels(blockType, member.key); labels > 0 {
+			w.labeledBlocks(member.key, nil, labels, member.value)
+			continue
+		}
+		if jsonIsNestedBlock(blockType, member) {
+			w.labeledBlocks(member.key, nil, 0, member.value)
+			continue
+		}
+		w.at(member.value.line)
+		w.write(member.key + " = " + nativeExpression(member.key, member.value) + "\n")
+	}
+}
+
+// jsonNestedBlockLabels is the number of labels of a nested block type that
+// has any: backend "s3", provisioner "local-exec", dynamic "ingress", and the
+// key_provider and method blocks of OpenTofu state encryption.
+func jsonNestedBlockLabels(parent, key string) int {
+	switch {
+	case parent == "terraform" && key == "backend":
+		return 1
+	case parent == "encryption" && (key == "key_provider" || key == "method"):
+		return 2
+	case (parent == "resource" || parent == "data" || parent == "ephemeral") && (key == "provisioner" || key == "dynamic"):
+		return 1
+	}
+	return 0
+}
+
+// jsonIsNestedBlock guesses whether member of a block of type parent is a
+// nested block. JSON does not tell blocks from object arguments, so objects,
+// and lists of objects, whose keys are all identifiers are taken for blocks,
+// except in blocks that only have arguments and for map arguments.
+func jsonIsNestedBlock(parent string, member jsonMember) bool {
+	switch parent {
+	case "locals", "module", "variable", "output", "backend", "required_providers", "key_provider", "method":
+		return false
+	}
+	if jsonMapAttributes[member.key] {
+		return false
+	}
+	objects := []*jsonValue{member.value}
+	if member.value.kind == '[' {
+		if len(member.value.array) == 0 {
+			return false
+		}
+		objects = member.value.array
+	}
+	for _, object := range objects {
+		if object.kind != '{' {
+			return false
+		}
+		for _, field := range object.object {
+			if !hclsyntax.ValidIdentifier(field.key) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// nativeExpression is the native expression of an argument value. JSON
+// strings are templates, so "${var.name}" keeps its interpolation.
+func nativeExpression(key string, value *jsonValue) string {
+	switch value.kind {
+	case '{':
+		fields := make([]string, 0, len(value.object))
+		for _, member := range value.object {
+			fields = append(fields, nativeTemplate(member.key)+" = "+nativeExpression(member.key, member.value))
+		}
+		return "{ " + strings.Join(fields, ", ") + " }"
+	case '[':
+		items := make([]string, 0, len(value.array))
+		for _, item := range value.array {
+			items = append(items, nativeExpression(key, item))
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	}
+	switch scalar := value.scalar.(type) {
+	case string:
+		if jsonTraversalAttributes[key] && isTraversal(scalar) {
+			return scalar
+		}
+		return nativeTemplate(scalar)
+	case json.Number:
+		return scalar.String()
+	case bool:
+		return strconv.FormatBool(scalar)
+	}
+	return "null"
+}
+
+// nativeTemplate quotes s as a native template, leaving its interpolations
+// and directives in place.
+func nativeTemplate(s string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+	return `"` + replacer.Replace(s) + `"`
+}
+
+// isTraversal reports whether s is a reference such as aws_iam_role.app.
+func isTraversal(s string) bool {
+	_, diags := hclsyntax.ParseTraversalAbs([]byte(s), "", hcl.Pos{Line: 1, Column: 1})
+	return !diags.HasErrors()
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestJSONConfigFile(t *testing.T) {
+	if err := loadPermissionsDB(); err != nil {
+		t.Fatalf("Error loading permissions DB: %v", err)
+	}
+	result, err := parseTerraformFile("test-fixtures/opentofu/storage.tf.json")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(result.Diagnostics) > 0 {
+		t.Fatalf("Unexpected diagnostics: %v", result.Diagnostics)
+	}
+
+	byAddress := make(map[string]Resource)
+	for _, resource := range result.Resources {
+		byAddress[resourceAddress(resource)] = resource
+	}
+	bucket, ok := byAddress["aws_s3_bucket.logs"]
+	if !ok || bucket.Line != 5 {
+		t.Fatalf("Expected aws_s3_bucket.logs on line 5, got %+v", result.Resources)
+	}
+	if _, ok := bucket.Attributes["tags"]; !ok {
+		t.Errorf("Expected tags to stay an argument, got %v", bucket.Attributes)
+	}
+	table := byAddress["aws_dynamodb_table.users"]
+	if table.Line != 11 || !containsString(table.References, "aws_s3_bucket.logs") {
+		t.Errorf("Expected the table on line 11 depending on the bucket, got line %d and %v", table.Line, table.References)
+	}
+	if len(result.DataSources) != 1 || result.DataSources[0].Type != "aws_caller_identity" {
+		t.Errorf("Expected the data source, got %+v", result.DataSources)
+	}
+}
+
+func TestNativeFromJSON(t *testing.T) {
+	content := `{
+  "terraform": {"backend": {"s3": {"bucket": "state", "key": "app.tfstate"}}},
+  "provider": {"aws": [{"region": "eu-west-1"}, {"alias": "use1", "region": "us-east-1"}]},
+  "module": {"vpc": {"source": "./vpc", "settings": {"cidr": "10.0.0.0/16"}}},
+  "resource": {"aws_sqs_queue": {"jobs": {"name": "say \"hi\"\n", "provider": "aws.use1"}}}
+}`
+	native, lines, diag := nativeFromJSON([]byte(content), "main.tf.json")
+	if diag != nil {
+		t.Fatalf("Unexpected diagnostic: %v", diag)
+	}
+	for _, want := range []string{
+		`backend "s3" {`,
+		`provider "aws" {`,
+		`alias = "use1"`,
+		`settings = { "cidr" = "10.0.0.0/16" }`,
+		`name = "say \"hi\"\n"`,
+		`provider = aws.use1`,
+	} {
+		if !strings.Contains(string(native), want) {
+			t.Errorf("Expected %q in:\n%s", want, native)
+		}
+	}
+
+	result, err := parseTerraformSource([]byte(content), "main.tf.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Backend == nil || result.Backend.Config["bucket"] != "state" {
+		t.Errorf("Expected the s3 backend, got %+v", result.Backend)
+	}
+	if len(result.Resources) != 1 || result.Resources[0].Line != 5 {
+		t.Errorf("Expected the queue on line 5 of the JSON file, got %+v", result.Resources)
+	}
+	if last := lines.line(len(lines)); last != 5 {
+		t.Errorf("Expected the last native line to map to line 5, got %d", last)
+	}
+}
+
+func TestNativeFromJSONInvalid(t *testing.T) {
+	result, err := parseTerraformSource([]byte("{\n  \"resource\": {\n    \"aws_sqs_queue\": \n}"), "bad.tofu.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Diagnostics) != 1 || result.Diagnostics[0].Severity != "error" || result.Diagnostics[0].Line != 3 {
+		t.Errorf("Expected an error diagnostic at the key without a value, got %+v", result.Diagnostics)
+	}
+}
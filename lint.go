@@ -0,0 +1,478 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// Lint finding severities. Errors make `lint` exit non-zero; warnings only do
+// so with --strict.
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+var (
+	lintJSONFlag      bool
+	lintCanonicalFlag bool
+	lintStrictFlag    bool
+)
+
+var lintCmd = &cobra.Command{
+	Use:   "lint policy.json [policy.json ...]",
+	Short: "Validate IAM policy documents against the embedded action catalog",
+	Long: `Validate any IAM policy document, generated or hand-written. lint reports:
+
+  - actions that do not exist in the embedded action catalog
+  - malformed actions and ARNs
+  - redundant statements already covered by another statement
+  - actions without resource-level permissions paired with specific ARNs
+  - Allow statements using NotAction or NotResource
+
+Use --canonical to print the policy in canonical form: actions and resources
+deduplicated and sorted, and redundant statements removed.`,
+	Args: cobra.MinimumNArgs(1),
+	Run:  runLint,
+}
+
+func init() {
+	lintCmd.Flags().BoolVar(&lintJSONFlag, "json", false, "Print findings as JSON")
+	lintCmd.Flags().BoolVar(&lintCanonicalFlag, "canonical", false, "Print the canonicalized policy to stdout (only with a single file)")
+	lintCmd.Flags().BoolVar(&lintStrictFlag, "strict", false, "Exit non-zero on warnings as well as errors")
+	rootCmd.AddCommand(lintCmd)
+}
+
+// LintFinding is a single problem found in a policy document. Statement is
+// the zero-based statement index, or -1 for document-level findings.
+type LintFinding struct {
+	File      string `json:"file,omitempty"`
+	Statement int    `json:"statement"`
+	Sid       string `json:"sid,omitempty"`
+	Severity  string `json:"severity"`
+	Message   string `json:"message"`
+}
+
+var (
+	actionPattern      = regexp.MustCompile(`^[A-Za-z0-9-]+:[A-Za-z0-9*?]+$`)
+	accountPattern     = regexp.MustCompile(`^\d{12}$`)
+	knownARNPartitions = map[string]bool{
+		"aws": true, "aws-cn": true, "aws-us-gov": true, "aws-iso": true,
+		"aws-iso-b": true, "aws-iso-e": true, "aws-iso-f": true, "aws-eusc": true,
+	}
+)
+
+func runLint(cmd *cobra.Command, args []string) {
+	if lintCanonicalFlag && len(args) > 1 {
+		fmt.Fprintf(os.Stderr, "Error: --canonical accepts a single policy file\n")
+		os.Exit(1)
+	}
+	if err := loadActionCatalog(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	var findings []LintFinding
+	for _, file := range args {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading policy: %v\n", err)
+			os.Exit(1)
+		}
+
+		policy, fileFindings, err := lintPolicy(data)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error parsing %s: %v\n", file, err)
+			os.Exit(1)
+		}
+		for i := range fileFindings {
+			fileFindings[i].File = file
+		}
+		findings = append(findings, fileFindings...)
+
+		if lintCanonicalFlag {
+			canonical, err := json.MarshalIndent(canonicalizePolicy(policy), "", "  ")
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error marshaling policy: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Println(string(canonical))
+		}
+	}
+
+	// Findings go to stderr when stdout carries the canonical policy
+	out := os.Stdout
+	if lintCanonicalFlag {
+		out = os.Stderr
+	}
+
+	errors, warnings := 0, 0
+	for _, finding := range findings {
+		if finding.Severity == SeverityError {
+			errors++
+		} else {
+			warnings++
+		}
+	}
+
+	if lintJSONFlag {
+		if findings == nil {
+			findings = []LintFinding{}
+		}
+		data, _ := json.MarshalIndent(findings, "", "  ")
+		fmt.Fprintln(out, string(data))
+	} else {
+		for _, finding := range findings {
+			fmt.Fprintf(out, "%s: %s: %s: %s\n", finding.File, findingLocation(finding), finding.Severity, finding.Message)
+		}
+		fmt.Fprintf(os.Stderr, "%d error(s), %d warning(s)\n", errors, warnings)
+	}
+
+	if errors > 0 || (lintStrictFlag && warnings > 0) {
+		os.Exit(1)
+	}
+}
+
+func findingLocation(finding LintFinding) string {
+	if finding.Statement < 0 {
+		return "policy"
+	}
+	if finding.Sid != "" {
+		return fmt.Sprintf("statement %d (%s)", finding.Statement, finding.Sid)
+	}
+	return fmt.Sprintf("statement %d", finding.Statement)
+}
+
+// lintPolicy parses a policy document and checks it. An error is returned
+// only when the document cannot be parsed at all.
+func lintPolicy(data []byte) (IAMPolicy, []LintFinding, error) {
+	var raw struct {
+		Version   string          `json:"Version"`
+		Statement json.RawMessage `json:"Statement"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return IAMPolicy{}, nil, err
+	}
+
+	policy := IAMPolicy{Version: raw.Version}
+	statements := bytes.TrimSpace(raw.Statement)
+	switch {
+	case len(statements) == 0:
+		return IAMPolicy{}, nil, fmt.Errorf("policy has no Statement")
+	case statements[0] == '{':
+		// A single statement may be given as an object instead of a list
+		var statement IAMStatement
+		if err := json.Unmarshal(statements, &statement); err != nil {
+			return IAMPolicy{}, nil, err
+		}
+		policy.Statement = []IAMStatement{statement}
+	default:
+		if err := json.Unmarshal(statements, &policy.Statement); err != nil {
+			return IAMPolicy{}, nil, err
+		}
+	}
+
+	for i := range policy.Statement {
+		statement := &policy.Statement[i]
+		statement.Action = normalizePolicyElement(statement.Action)
+		statement.NotAction = normalizePolicyElement(statement.NotAction)
+		statement.Resource = normalizePolicyElement(statement.Resource)
+		statement.NotResource = normalizePolicyElement(statement.NotResource)
+	}
+
+	var findings []LintFinding
+	if policy.Version != defaultPolicyVersion {
+		findings = append(findings, LintFinding{
+			Statement: -1,
+			Severity:  SeverityWarning,
+			Message:   fmt.Sprintf("Version is %q; use \"2012-10-17\" so policy variables are supported", policy.Version),
+		})
+	}
+
+	for i, statement := range policy.Statement {
+		add := func(severity, format string, args ...interface{}) {
+			findings = append(findings, LintFinding{
+				Statement: i,
+				Sid:       statement.Sid,
+				Severity:  severity,
+				Message:   fmt.Sprintf(format, args...),
+			})
+		}
+
+		if statement.Effect != "Allow" && statement.Effect != "Deny" {
+			add(SeverityError, "Effect must be \"Allow\" or \"Deny\", got %q", statement.Effect)
+		}
+		if (statement.Action == nil) == (statement.NotAction == nil) {
+			add(SeverityError, "statement must have exactly one of Action or NotAction")
+		}
+		if (statement.Resource == nil) == (statement.NotResource == nil) {
+			add(SeverityError, "statement must have exactly one of Resource or NotResource")
+		}
+
+		if statement.Effect == "Allow" && statement.NotAction != nil {
+			add(SeverityWarning, "Allow with NotAction grants every action not listed, including actions AWS adds later; list the actions instead")
+		}
+		if statement.Effect == "Allow" && statement.NotResource != nil {
+			add(SeverityWarning, "Allow with NotResource grants every resource not listed; list the resources instead")
+		}
+
+		for _, action := range append(toStringSlice(statement.Action), toStringSlice(statement.NotAction)...) {
+			if severity, message := checkAction(action); message != "" {
+				add(severity, "%s", message)
+			}
+		}
+		for _, duplicate := range duplicateValues(toStringSlice(statement.Action), true) {
+			add(SeverityWarning, "action %s is listed more than once", duplicate)
+		}
+
+		for _, resource := range append(toStringSlice(statement.Resource), toStringSlice(statement.NotResource)...) {
+			if message := checkARN(resource); message != "" {
+				add(SeverityError, "%s", message)
+			}
+		}
+
+		if statement.Effect == "Allow" && statement.Resource != nil {
+			resources := toStringSlice(statement.Resource)
+			if !containsString(resources, "*") {
+				for _, action := range toStringSlice(statement.Action) {
+					canonical, info, ok := lookupAction(action)
+					if ok && info.WildcardOnly {
+						add(SeverityWarning, "%s does not support resource-level permissions and is only allowed with Resource \"*\"; it will be denied for %s",
+							canonical, strings.Join(resources, ", "))
+					}
+				}
+			}
+		}
+	}
+
+	for i, j := range redundantStatements(policy) {
+		statement := policy.Statement[i]
+		findings = append(findings, LintFinding{
+			Statement: i,
+			Sid:       statement.Sid,
+			Severity:  SeverityWarning,
+			Message:   fmt.Sprintf("statement is redundant: statement %d already covers every action and resource", j),
+		})
+	}
+
+	sort.SliceStable(findings, func(a, b int) bool {
+		return findings[a].Statement < findings[b].Statement
+	})
+	return policy, findings, nil
+}
+
+// checkAction validates a single action or action pattern against the
+// catalog, returning the severity and message of any problem.
+func checkAction(action string) (string, string) {
+	if action == "*" {
+		return "", ""
+	}
+	if !actionPattern.MatchString(action) {
+		return SeverityError, fmt.Sprintf("malformed action %q: expected service:ActionName", action)
+	}
+
+	service, _, _ := strings.Cut(action, ":")
+	entry, ok := catalogService(service)
+	if !ok {
+		return SeverityWarning, fmt.Sprintf("unknown service prefix %q in action %s", service, action)
+	}
+
+	// The catalog is incomplete for partial services, so a miss is only a hint
+	severity := SeverityError
+	if entry.Partial {
+		severity = SeverityWarning
+	}
+
+	if strings.ContainsAny(action, "*?") {
+		if len(expandActionPattern(action)) == 0 {
+			return severity, fmt.Sprintf("action pattern %s matches no known action", action)
+		}
+		return "", ""
+	}
+
+	if _, _, ok := lookupAction(action); !ok {
+		message := fmt.Sprintf("unknown action %s", action)
+		if suggestion := suggestAction(action); suggestion != "" {
+			message += fmt.Sprintf(" (did you mean %s?)", suggestion)
+		}
+		// A near miss of a known action is a typo even in a partial service
+		if likelyTypo(action) {
+			severity = SeverityError
+		}
+		return severity, message
+	}
+	return "", ""
+}
+
+// checkARN validates the structure of a Resource element, returning a
+// message describing the problem or "" when it is well formed.
+func checkARN(resource string) string {
+	if resource == "*" {
+		return ""
+	}
+	if !strings.HasPrefix(resource, "arn:") {
+		return fmt.Sprintf("malformed ARN %q: must be \"*\" or start with \"arn:\"", resource)
+	}
+
+	parts := strings.SplitN(resource, ":", 6)
+	if len(parts) < 6 {
+		return fmt.Sprintf("malformed ARN %q: expected arn:partition:service:region:account:resource", resource)
+	}
+
+	partition, service, account, resourcePart := parts[1], parts[2], parts[4], parts[5]
+	if !knownARNPartitions[partition] && !isPolicyPattern(partition) {
+		return fmt.Sprintf("malformed ARN %q: unknown partition %q", resource, partition)
+	}
+	if service == "" {
+		return fmt.Sprintf("malformed ARN %q: missing service", resource)
+	}
+	if account != "" && account != "aws" && !accountPattern.MatchString(account) && !isPolicyPattern(account) {
+		return fmt.Sprintf("malformed ARN %q: account %q is not a 12 digit account ID", resource, account)
+	}
+	if resourcePart == "" {
+		return fmt.Sprintf("malformed ARN %q: missing resource", resource)
+	}
+	return ""
+}
+
+// isPolicyPattern reports whether an ARN component uses wildcards or policy
+// variables, which cannot be validated statically.
+func isPolicyPattern(s string) bool {
+	return strings.ContainsAny(s, "*?") || strings.Contains(s, "${")
+}
+
+// redundantStatements maps the index of each redundant statement to the
+// index of a statement that covers it. A statement is redundant when an
+// unconditional statement with the same Effect matches every one of its
+// actions and resources. Of two identical statements only the later one is
+// reported.
+func redundantStatements(policy IAMPolicy) map[int]int {
+	redundant := make(map[int]int)
+
+	for i, statement := range policy.Statement {
+		if statement.NotAction != nil || statement.NotResource != nil {
+			continue
+		}
+		actions := toStringSlice(statement.Action)
+		resources := toStringSlice(statement.Resource)
+
+		for j, other := range policy.Statement {
+			if i == j || other.Effect != statement.Effect || len(other.Condition) > 0 ||
+				other.NotAction != nil || other.NotResource != nil {
+				continue
+			}
+			if _, ok := redundant[j]; ok {
+				continue
+			}
+			if !coversAll(toStringSlice(other.Action), actions, true) ||
+				!coversAll(toStringSlice(other.Resource), resources, false) {
+				continue
+			}
+
+			// Identical statements cover each other; keep the first
+			mutual := len(statement.Condition) == 0 &&
+				coversAll(actions, toStringSlice(other.Action), true) &&
+				coversAll(resources, toStringSlice(other.Resource), false)
+			if mutual && j > i {
+				continue
+			}
+			redundant[i] = j
+			break
+		}
+	}
+
+	return redundant
+}
+
+// coversAll reports whether every value matches at least one pattern.
+func coversAll(patterns, values []string, foldCase bool) bool {
+	for _, value := range values {
+		if !matchesAny(patterns, value, foldCase) {
+			return false
+		}
+	}
+	return true
+}
+
+// canonicalizePolicy returns the policy with actions and resources
+// deduplicated and sorted, action names in their catalog spelling, and
+// redundant statements removed. Statement order is otherwise preserved.
+func canonicalizePolicy(policy IAMPolicy) IAMPolicy {
+	redundant := redundantStatements(policy)
+
+	canonical := IAMPolicy{Version: policy.Version}
+	if canonical.Version == "" {
+		canonical.Version = defaultPolicyVersion
+	}
+
+	for i, statement := range policy.Statement {
+		if _, ok := redundant[i]; ok {
+			continue
+		}
+		statement.Action = canonicalList(statement.Action, true)
+		statement.NotAction = canonicalList(statement.NotAction, true)
+		statement.Resource = canonicalList(statement.Resource, false)
+		statement.NotResource = canonicalList(statement.NotResource, false)
+		canonical.Statement = append(canonical.Statement, statement)
+	}
+
+	return canonical
+}
+
+// canonicalList deduplicates and sorts a policy element. Actions are
+// compared case-insensitively and spelled as in the catalog.
+func canonicalList(value interface{}, actions bool) interface{} {
+	if value == nil {
+		return nil
+	}
+
+	seen := make(map[string]bool)
+	var out []string
+	for _, item := range toStringSlice(value) {
+		key := item
+		if actions {
+			if canonical, _, ok := lookupAction(item); ok {
+				item = canonical
+			}
+			key = strings.ToLower(item)
+		}
+		if !seen[key] {
+			seen[key] = true
+			out = append(out, item)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// duplicateValues returns the values that occur more than once.
+func duplicateValues(values []string, foldCase bool) []string {
+	counts := make(map[string]int)
+	var duplicates []string
+	for _, value := range values {
+		key := value
+		if foldCase {
+			key = strings.ToLower(value)
+		}
+		counts[key]++
+		if counts[key] == 2 {
+			duplicates = append(duplicates, value)
+		}
+	}
+	return duplicates
+}
+
+func containsString(values []string, want string) bool {
+	for _, value := range values {
+		if value == want {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLintPolicy(t *testing.T) {
+	if err := loadActionCatalog(); err != nil {
+		t.Fatalf("Error loading action catalog: %v", err)
+	}
+
+	policy := `{
+  "Version": "2012-10-17",
+  "Statement": [
+    {"Sid": "Queues", "Effect": "Allow", "Action": ["sqs:SendMessage", "sqs:ListQueues", "sqs:SendMesage"], "Resource": "arn:aws:sqs:us-east-1:123456789012:jobs"},
+    {"Effect": "Allow", "Action": "sqs:SendMessage", "Resource": "arn:aws:sqs:us-east-1:123456789012:jobs"},
+    {"Effect": "Allow", "Action": "s3 GetObject", "Resource": "my-bucket"},
+    {"Effect": "Allow", "NotAction": "iam:*", "Resource": "*"}
+  ]
+}`
+
+	_, findings, err := lintPolicy([]byte(policy))
+	if err != nil {
+		t.Fatalf("Error linting policy: %v", err)
+	}
+
+	expected := []struct {
+		statement int
+		severity  string
+		contains  string
+	}{
+		{0, SeverityError, "unknown action sqs:SendMesage (did you mean sqs:SendMessage?)"},
+		{0, SeverityWarning, "sqs:ListQueues does not support resource-level permissions"},
+		{1, SeverityWarning, "redundant: statement 0"},
+		{2, SeverityError, `malformed action "s3 GetObject"`},
+		{2, SeverityError, `malformed ARN "my-bucket"`},
+		{3, SeverityWarning, "Allow with NotAction grants every action not listed"},
+	}
+	for _, want := range expected {
+		found := false
+		for _, finding := range findings {
+			if finding.Statement == want.statement && finding.Severity == want.severity &&
+				strings.Contains(finding.Message, want.contains) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("Expected %s on statement %d containing %q, got %+v", want.severity, want.statement, want.contains, findings)
+		}
+	}
+}
+
+func TestLintPolicySingleStatement(t *testing.T) {
+	if err := loadActionCatalog(); err != nil {
+		t.Fatalf("Error loading action catalog: %v", err)
+	}
+
+	policy, findings, err := lintPolicy([]byte(`{"Version": "2012-10-17", "Statement": {"Effect": "Allow", "Action": "sts:GetCallerIdentity", "Resource": "*"}}`))
+	if err != nil {
+		t.Fatalf("Error linting policy: %v", err)
+	}
+	if len(policy.Statement) != 1 {
+		t.Fatalf("Expected 1 statement, got %d", len(policy.Statement))
+	}
+	if len(findings) != 0 {
+		t.Errorf("Expected no findings, got %+v", findings)
+	}
+}
+
+func TestCheckARN(t *testing.T) {
+	valid := []string{
+		"*",
+		"arn:aws:s3:::my-bucket/*",
+		"arn:aws:iam::aws:policy/ReadOnlyAccess",
+		"arn:${aws:Partition}:sqs:*:*:jobs",
+		"arn:aws-us-gov:dynamodb:us-gov-west-1:123456789012:table/users",
+	}
+	for _, arn := range valid {
+		if message := checkARN(arn); message != "" {
+			t.Errorf("checkARN(%q) = %q, want no problem", arn, message)
+		}
+	}
+
+	invalid := []string{
+		"my-bucket",
+		"arn:aws:s3",
+		"arn:amazon:s3:::bucket",
+		"arn:aws:sqs:us-east-1:1234:queue",
+		"arn:aws:s3:::",
+	}
+	for _, arn := range invalid {
+		if checkARN(arn) == "" {
+			t.Errorf("Expected checkARN(%q) to report a problem", arn)
+		}
+	}
+}
+
+func TestCanonicalizePolicy(t *testing.T) {
+	if err := loadActionCatalog(); err != nil {
+		t.Fatalf("Error loading action catalog: %v", err)
+	}
+
+	policy := IAMPolicy{
+		Statement: []IAMStatement{
+			{Effect: "Allow", Action: []string{"sqs:sendmessage", "sqs:DeleteMessage", "sqs:SendMessage"}, Resource: []string{"*"}},
+			{Effect: "Allow", Action: "sqs:DeleteMessage", Resource: "arn:aws:sqs:us-east-1:123456789012:jobs"},
+		},
+	}
+
+	canonical := canonicalizePolicy(policy)
+	if canonical.Version != "2012-10-17" {
+		t.Errorf("Expected default Version, got %q", canonical.Version)
+	}
+	if len(canonical.Statement) != 1 {
+		t.Fatalf("Expected redundant statement to be removed, got %d statements", len(canonical.Statement))
+	}
+	actions := toStringSlice(canonical.Statement[0].Action)
+	if strings.Join(actions, ",") != "sqs:DeleteMessage,sqs:SendMessage" {
+		t.Errorf("Unexpected canonical actions: %v", actions)
+	}
+}
@@ -0,0 +1,391 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var lspCmd = &cobra.Command{
+	Use:   "lsp",
+	Short: "Serve editor diagnostics and code lenses over the Language Server Protocol",
+	Long: `Run a language server on stdin and stdout for editors. For every open .tf
+file it publishes a diagnostic per AWS resource and data source with the IAM
+actions the block requires, warnings for types missing from the permissions
+DB, and the file's parse errors, and offers a code lens above each block with
+its permission contribution. Configure the editor to start
+'tf-iam-scanner lsp' for the terraform language.`,
+	Args: cobra.NoArgs,
+	Run:  runLSP,
+}
+
+func init() {
+	lspCmd.Flags().StringArrayVar(&permissionsDirFlag, "permissions-dir", nil, "Directory of extra permission mappings (.json/.yaml) merged into the permissions DB (repeatable)")
+	lspCmd.Flags().StringVar(&permissionsOrgFlag, "permissions-org", "", "Org-level permission mappings (a .json/.yaml file or a directory of them) applied between the embedded DB and --permissions-dir (default: $TF_IAM_SCANNER_PERMISSIONS_ORG)")
+	lspCmd.Flags().StringVar(&permissionsURLFlag, "permissions-url", "", "Fetch org-level permission mappings from an https:// URL into the org layer, cached and revalidated by ETag (default: $TF_IAM_SCANNER_PERMISSIONS_URL)")
+	lspCmd.Flags().StringVar(&permissionsSHA256Flag, "permissions-sha256", "", "Expected SHA256 of the --permissions-url file; a mismatch fails the run")
+	rootCmd.AddCommand(lspCmd)
+}
+
+// LSP diagnostic severities.
+const (
+	lspSeverityError       = 1
+	lspSeverityWarning     = 2
+	lspSeverityInformation = 3
+)
+
+// lspShowActionsCommand is the command of the code lenses; its argument is
+// the list of actions, for editors that show it.
+const lspShowActionsCommand = "tf-iam-scanner.showActions"
+
+type lspMessage struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method,omitempty"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+	Result  interface{}      `json:"result,omitempty"`
+	Error   *lspError        `json:"error,omitempty"`
+}
+
+type lspError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type lspPosition struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type lspRange struct {
+	Start lspPosition `json:"start"`
+	End   lspPosition `json:"end"`
+}
+
+type lspDiagnostic struct {
+	Range    lspRange `json:"range"`
+	Severity int      `json:"severity"`
+	Source   string   `json:"source"`
+	Message  string   `json:"message"`
+}
+
+type lspCommand struct {
+	Title     string        `json:"title"`
+	Command   string        `json:"command"`
+	Arguments []interface{} `json:"arguments,omitempty"`
+}
+
+type lspCodeLens struct {
+	Range   lspRange    `json:"range"`
+	Command *lspCommand `json:"command,omitempty"`
+}
+
+type lspTextDocument struct {
+	URI  string `json:"uri"`
+	Text string `json:"text"`
+}
+
+type lspDocumentParams struct {
+	TextDocument   lspTextDocument `json:"textDocument"`
+	ContentChanges []struct {
+		Text string `json:"text"`
+	} `json:"contentChanges"`
+}
+
+// lspServer holds the text of the open documents by URI.
+type lspServer struct {
+	out       io.Writer
+	documents map[string]string
+	shutdown  bool
+}
+
+func runLSP(cmd *cobra.Command, args []string) {
+	if err := loadPermissionsDB(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := loadPermissionPlugins(permissionsDirFlag); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	server := &lspServer{out: os.Stdout, documents: make(map[string]string)}
+	if err := server.serve(os.Stdin); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if !server.shutdown {
+		os.Exit(1)
+	}
+}
+
+// serve handles messages from in until the exit notification or the end of
+// the input.
+func (s *lspServer) serve(in io.Reader) error {
+	reader := bufio.NewReader(in)
+	for {
+		data, err := readLSPMessage(reader)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var message lspMessage
+		if err := json.Unmarshal(data, &message); err != nil {
+			return fmt.Errorf("invalid message: %w", err)
+		}
+		if message.Method == "exit" {
+			return nil
+		}
+		if err := s.handle(message); err != nil {
+			return err
+		}
+	}
+}
+
+// handle answers a request or acts on a notification. Unknown notifications
+// are ignored, as the protocol requires.
+func (s *lspServer) handle(message lspMessage) error {
+	var params lspDocumentParams
+	if len(message.Params) > 0 {
+		_ = json.Unmarshal(message.Params, &params)
+	}
+	document := params.TextDocument
+
+	switch message.Method {
+	case "initialize":
+		return s.reply(message.ID, map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync": 1, // full text on every change
+				"codeLensProvider": map[string]interface{}{},
+			},
+			"serverInfo": map[string]string{"name": "tf-iam-scanner", "version": version},
+		})
+	case "shutdown":
+		s.shutdown = true
+		return s.reply(message.ID, nil)
+	case "textDocument/didOpen":
+		s.documents[document.URI] = document.Text
+		return s.publishDiagnostics(document.URI)
+	case "textDocument/didChange":
+		if n := len(params.ContentChanges); n > 0 {
+			s.documents[document.URI] = params.ContentChanges[n-1].Text
+		}
+		return s.publishDiagnostics(document.URI)
+	case "textDocument/didSave":
+		return s.publishDiagnostics(document.URI)
+	case "textDocument/didClose":
+		delete(s.documents, document.URI)
+		return s.notify("textDocument/publishDiagnostics", map[string]interface{}{"uri": document.URI, "diagnostics": []lspDiagnostic{}})
+	case "textDocument/codeLens":
+		_, lenses := s.analyze(document.URI)
+		return s.reply(message.ID, lenses)
+	}
+	if message.ID != nil {
+		return s.send(lspMessage{JSONRPC: "2.0", ID: message.ID, Error: &lspError{Code: -32601, Message: "method not found: " + message.Method}})
+	}
+	return nil
+}
+
+func (s *lspServer) publishDiagnostics(uri string) error {
+	diagnostics, _ := s.analyze(uri)
+	return s.notify("textDocument/publishDiagnostics", map[string]interface{}{"uri": uri, "diagnostics": diagnostics})
+}
+
+// analyze scans the directory of an open .tf document, with the document's
+// current text in place of the file on disk, and returns the diagnostics and
+// code lenses of the document.
+func (s *lspServer) analyze(uri string) ([]lspDiagnostic, []lspCodeLens) {
+	diagnostics, lenses := []lspDiagnostic{}, []lspCodeLens{}
+	path, err := uriPath(uri)
+	text, open := s.documents[uri]
+	if err != nil || !open || !isConfigFile(path) {
+		return diagnostics, lenses
+	}
+
+	dirResult, err := parseTerraformFiles(filepath.Dir(path))
+	if err != nil {
+		return diagnostics, lenses
+	}
+	fileResult, err := parseTerraformSource([]byte(text), path)
+	if err != nil {
+		return diagnostics, lenses
+	}
+	result := withDocument(dirResult, fileResult, path)
+	lines := strings.Split(text, "\n")
+
+	for _, diag := range fileResult.Diagnostics {
+		severity := lspSeverityWarning
+		if diag.Severity == "error" {
+			severity = lspSeverityError
+		}
+		diagnostics = append(diagnostics, lspDiagnostic{
+			Range:    lineRange(lines, diag.Line),
+			Severity: severity,
+			Source:   "tf-iam-scanner",
+			Message:  diag.Summary,
+		})
+	}
+
+	location := filepath.ToSlash(path) + ":"
+	for _, contribution := range collectContributions(result) {
+		if !strings.HasPrefix(contribution.Location, location) {
+			continue
+		}
+		line, _ := strconv.Atoi(strings.TrimPrefix(contribution.Location, location))
+		lineRange := lineRange(lines, line)
+		diagnostics = append(diagnostics, contributionDiagnostic(contribution, lineRange))
+		if len(contribution.Actions) > 0 {
+			actions := make([]interface{}, len(contribution.Actions))
+			for i, action := range contribution.Actions {
+				actions[i] = action
+			}
+			lenses = append(lenses, lspCodeLens{Range: lineRange, Command: &lspCommand{
+				Title:     contributionTitle(contribution),
+				Command:   lspShowActionsCommand,
+				Arguments: actions,
+			}})
+		}
+	}
+	return diagnostics, lenses
+}
+
+// withDocument returns dirResult with the resources and data sources
+// declared in path replaced by those of fileResult, parsed from the editor's
+// text.
+func withDocument(dirResult, fileResult *ParseResult, path string) *ParseResult {
+	result := *dirResult
+	result.Resources, result.DataSources = nil, nil
+	for _, resource := range dirResult.Resources {
+		if resource.File != path {
+			result.Resources = append(result.Resources, resource)
+		}
+	}
+	for _, dataSource := range dirResult.DataSources {
+		if dataSource.File != path {
+			result.DataSources = append(result.DataSources, dataSource)
+		}
+	}
+	result.Resources = append(result.Resources, fileResult.Resources...)
+	result.DataSources = append(result.DataSources, fileResult.DataSources...)
+	return &result
+}
+
+// contributionDiagnostic describes the permissions of one block: the number
+// of actions it requires, or a warning when its type is not mapped.
+func contributionDiagnostic(contribution resourceContribution, lineRange lspRange) lspDiagnostic {
+	diagnostic := lspDiagnostic{Range: lineRange, Severity: lspSeverityInformation, Source: "tf-iam-scanner"}
+	switch {
+	case !contribution.Mapped:
+		diagnostic.Severity = lspSeverityWarning
+		diagnostic.Message = fmt.Sprintf("%s is not in the permissions DB; its permissions are missing from the policy", contribution.Type)
+	default:
+		diagnostic.Message = fmt.Sprintf("this %s requires %d IAM action(s)", contribution.Kind.Description(), len(contribution.Actions))
+	}
+	return diagnostic
+}
+
+// contributionTitle is the code lens text of a block: its action count and
+// first actions.
+func contributionTitle(contribution resourceContribution) string {
+	const shown = 3
+	actions := contribution.Actions
+	title := fmt.Sprintf("%d IAM action(s): %s", len(actions), strings.Join(actions[:min(shown, len(actions))], ", "))
+	if len(actions) > shown {
+		title += fmt.Sprintf(", +%d more", len(actions)-shown)
+	}
+	return title
+}
+
+// lineRange spans the text of a 1-based line.
+func lineRange(lines []string, line int) lspRange {
+	if line < 1 {
+		line = 1
+	}
+	length := 0
+	if line <= len(lines) {
+		length = len(strings.TrimRight(lines[line-1], "\r"))
+	}
+	return lspRange{Start: lspPosition{Line: line - 1}, End: lspPosition{Line: line - 1, Character: length}}
+}
+
+// uriPath converts a file:// URI into a path. The URI path of a Windows
+// file starts with its drive, as in file:///C:/infra/main.tf.
+func uriPath(uri string) (string, error) {
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		return "", err
+	}
+	if parsed.Scheme != "file" {
+		return "", fmt.Errorf("unsupported URI scheme %q", parsed.Scheme)
+	}
+	path := parsed.Path
+	if len(path) >= 3 && path[0] == '/' && path[2] == ':' {
+		path = path[1:]
+	}
+	return filepath.FromSlash(path), nil
+}
+
+func (s *lspServer) reply(id *json.RawMessage, result interface{}) error {
+	if result == nil {
+		// A null result must still be sent
+		result = json.RawMessage("null")
+	}
+	return s.send(lspMessage{JSONRPC: "2.0", ID: id, Result: result})
+}
+
+func (s *lspServer) notify(method string, params interface{}) error {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	return s.send(lspMessage{JSONRPC: "2.0", Method: method, Params: data})
+}
+
+func (s *lspServer) send(message lspMessage) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n%s", len(data), data)
+	return err
+}
+
+// readLSPMessage reads one message framed by a Content-Length header.
+func readLSPMessage(reader *bufio.Reader) ([]byte, error) {
+	length := -1
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			if err == io.EOF && line == "" && length < 0 {
+				return nil, io.EOF
+			}
+			return nil, fmt.Errorf("reading header: %w", err)
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		if name, value, ok := strings.Cut(line, ":"); ok && strings.EqualFold(name, "Content-Length") {
+			if length, err = strconv.Atoi(strings.TrimSpace(value)); err != nil {
+				return nil, fmt.Errorf("invalid Content-Length %q", value)
+			}
+		}
+	}
+	if length < 0 {
+		return nil, fmt.Errorf("message without Content-Length")
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(reader, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func lspFrame(t *testing.T, message map[string]interface{}) string {
+	t.Helper()
+	message["jsonrpc"] = "2.0"
+	data, err := json.Marshal(message)
+	if err != nil {
+		t.Fatalf("Error encoding message: %v", err)
+	}
+	return fmt.Sprintf("Content-Length: %d\r\n\r\n%s", len(data), data)
+}
+
+func TestLSPServer(t *testing.T) {
+	if err := loadPermissionsDB(); err != nil {
+		t.Fatalf("Error loading permissions DB: %v", err)
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "main.tf")
+	if err := os.WriteFile(path, []byte(`resource "aws_s3_bucket" "old" {}`), 0644); err != nil {
+		t.Fatalf("Error writing file: %v", err)
+	}
+	uri := "file://" + filepath.ToSlash(path)
+	// The editor's unsaved text replaces the file on disk
+	text := "resource \"aws_sqs_queue\" \"jobs\" {\n  name = \"jobs\"\n}\n\nresource \"aws_widget_thing\" \"x\" {}\n"
+
+	input := lspFrame(t, map[string]interface{}{"id": 1, "method": "initialize", "params": map[string]interface{}{}}) +
+		lspFrame(t, map[string]interface{}{"method": "textDocument/didOpen", "params": map[string]interface{}{
+			"textDocument": map[string]interface{}{"uri": uri, "languageId": "terraform", "version": 1, "text": text},
+		}}) +
+		lspFrame(t, map[string]interface{}{"id": 2, "method": "textDocument/codeLens", "params": map[string]interface{}{
+			"textDocument": map[string]interface{}{"uri": uri},
+		}}) +
+		lspFrame(t, map[string]interface{}{"id": 3, "method": "textDocument/hover", "params": map[string]interface{}{}}) +
+		lspFrame(t, map[string]interface{}{"id": 4, "method": "shutdown"}) +
+		lspFrame(t, map[string]interface{}{"method": "exit"})
+
+	var out bytes.Buffer
+	server := &lspServer{out: &out, documents: make(map[string]string)}
+	if err := server.serve(strings.NewReader(input)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !server.shutdown {
+		t.Errorf("Expected the server to record the shutdown request")
+	}
+
+	var messages []lspMessage
+	reader := bufio.NewReader(&out)
+	for {
+		data, err := readLSPMessage(reader)
+		if err != nil {
+			break
+		}
+		var message lspMessage
+		if err := json.Unmarshal(data, &message); err != nil {
+			t.Fatalf("Invalid response: %v", err)
+		}
+		messages = append(messages, message)
+	}
+	if len(messages) != 5 {
+		t.Fatalf("Expected 5 messages, got %d", len(messages))
+	}
+
+	var published struct {
+		URI         string          `json:"uri"`
+		Diagnostics []lspDiagnostic `json:"diagnostics"`
+	}
+	if err := json.Unmarshal(messages[1].Params, &published); err != nil || messages[1].Method != "textDocument/publishDiagnostics" {
+		t.Fatalf("Expected published diagnostics, got %+v", messages[1])
+	}
+	if len(published.Diagnostics) != 2 {
+		t.Fatalf("Expected 2 diagnostics, got %+v", published.Diagnostics)
+	}
+	queue, widget := published.Diagnostics[0], published.Diagnostics[1]
+	if queue.Range.Start.Line != 0 || queue.Severity != lspSeverityInformation || !strings.Contains(queue.Message, "requires") {
+		t.Errorf("Unexpected diagnostic for the queue: %+v", queue)
+	}
+	if widget.Range.Start.Line != 4 || widget.Severity != lspSeverityWarning || !strings.Contains(widget.Message, "aws_widget_thing") {
+		t.Errorf("Unexpected diagnostic for the unmapped type: %+v", widget)
+	}
+
+	data, _ := json.Marshal(messages[2].Result)
+	var lenses []lspCodeLens
+	if err := json.Unmarshal(data, &lenses); err != nil {
+		t.Fatalf("Invalid code lenses: %v", err)
+	}
+	if len(lenses) != 1 || lenses[0].Command == nil || !strings.Contains(lenses[0].Command.Title, "sqs:CreateQueue") {
+		t.Errorf("Expected one code lens for the queue, got %+v", lenses)
+	}
+	if messages[3].Error == nil || messages[3].Error.Code != -32601 {
+		t.Errorf("Expected method not found for hover, got %+v", messages[3])
+	}
+}
+
+func TestContributionTitle(t *testing.T) {
+	contribution := resourceContribution{Actions: []string{"a:One", "a:Two", "a:Three", "a:Four", "a:Five"}}
+	if got := contributionTitle(contribution); got != "5 IAM action(s): a:One, a:Two, a:Three, +2 more" {
+		t.Errorf("Unexpected title %q", got)
+	}
+}
+
+func TestURIPath(t *testing.T) {
+	tests := map[string]string{
+		"file:///home/dev/infra/main.tf": filepath.FromSlash("/home/dev/infra/main.tf"),
+		"file:///C:/infra/main.tf":       filepath.FromSlash("C:/infra/main.tf"),
+		"file:///c%3A/infra/main.tf":     filepath.FromSlash("c:/infra/main.tf"),
+	}
+	for uri, want := range tests {
+		if got, err := uriPath(uri); err != nil || got != want {
+			t.Errorf("uriPath(%q) = %q, %v, want %q", uri, got, err, want)
+		}
+	}
+	if _, err := uriPath("untitled:Untitled-1"); err == nil {
+		t.Errorf("Expected an error for a non-file URI")
+	}
+}
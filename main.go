@@ -1,21 +1,30 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
-	"sort"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 )
 
 var (
-	pathFlag               string
-	outputFlag             string
-	planFileFlag           string
+	pathFlag                []string
+	outputFlag              string
+	planFileFlag            string
 	includeStateBackendFlag bool
-	leastPrivilegeFlag     bool
-	formatFlag             string
+	leastPrivilegeFlag      bool
+	formatFlag              string
+	failOnFlag              []string
+	strictFlag              bool
+	mergeFlag               string
+	forceFlag               bool
+	modeFlag                string
+	reportFlag              string
+	outputMode              os.FileMode
 )
 
 var rootCmd = &cobra.Command{
@@ -28,151 +37,762 @@ Supports two input modes:
   1. --path <dir>      Scan .tf files in a directory (HCL parsing + local modules)
   2. --plan-file <json> Parse a terraform show -json output (all modules resolved)
 
-Output formats: json, yaml, terraform
+Output formats: json, yaml, terraform, pulumi-ts, pulumi-python, html, csv, xlsx, spacelift, env0, opa
+
+Scans of separate repositories can be exported with --export-scan and
+combined into one policy with 'tf-iam-scanner scan --from a.json b.json'.
 
 Example with plan file:
   terraform plan -out=tfplan
   terraform show -json tfplan > plan.json
   tf-iam-scanner --plan-file plan.json --least-privilege`,
-	Run: runScanner,
+	PersistentPreRun: applyTimeout,
+	RunE:             runScanner,
+	// main prints the error, and exits with its code
+	SilenceErrors: true,
 }
 
 func init() {
-	rootCmd.Flags().StringVarP(&pathFlag, "path", "p", ".", "Path to directory containing Terraform files")
-	rootCmd.Flags().StringVarP(&outputFlag, "output", "o", "", "Output file path for the IAM policy (default: stdout)")
+	rootCmd.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		return &ValidationError{Err: err}
+	})
+	rootCmd.PersistentFlags().DurationVar(&timeoutFlag, "timeout", 0, "Stop the run after this long (e.g. 5m), exiting 124 after writing what was scanned to --report; 0 means no limit")
+	rootCmd.Flags().StringSliceVarP(&pathFlag, "path", "p", []string{"."}, "Path to directory containing Terraform files; repeat or separate with commas to scan several roots concurrently")
+	rootCmd.Flags().BoolVar(&mergeOutputFlag, "merge-output", false, "With several --path roots, write one policy for all of them instead of one per root")
+	rootCmd.Flags().BoolVar(&followSymlinksFlag, "follow-symlinks", false, "Follow symlinked directories below --path (module sources are always followed)")
 	rootCmd.Flags().StringVar(&planFileFlag, "plan-file", "", "Path to terraform show -json plan file (alternative to --path)")
-	rootCmd.Flags().BoolVar(&includeStateBackendFlag, "include-state-backend", true, "Include permissions for Terraform state backend operations (use --include-state-backend=false to exclude)")
-	rootCmd.Flags().BoolVar(&leastPrivilegeFlag, "least-privilege", false, "Generate separate statements per service with specific resource ARNs")
-	rootCmd.Flags().StringVarP(&formatFlag, "format", "f", "json", "Output format (json, yaml, terraform)")
+
+	addPolicyOutputFlags(rootCmd)
+	_ = rootCmd.MarkFlagDirname("path")
+	_ = rootCmd.MarkFlagFilename("plan-file", "json")
 }
 
-func runScanner(cmd *cobra.Command, args []string) {
-	// Validate format
-	validFormats := map[string]bool{"json": true, "yaml": true, "terraform": true}
-	if !validFormats[formatFlag] {
-		fmt.Fprintf(os.Stderr, "Error: invalid format %s. Valid formats: json, yaml, terraform\n", formatFlag)
-		os.Exit(1)
+// addPolicyOutputFlags registers the flags that control how a generated policy
+// is written, so every policy-generating command accepts them the same way.
+func addPolicyOutputFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&outputFlag, "output", "o", "", "Output file path for the IAM policy (default: stdout)")
+	cmd.Flags().StringVar(&outputTemplateFlag, "output-template", "", "Name the policy file of each root, Stack deployment or batch role with this Go template (e.g. 'policies/{{.Stack}}-{{.Deployment}}{{.Ext}}')")
+	cmd.Flags().BoolVar(&forceFlag, "force", false, "Overwrite existing output files")
+	cmd.Flags().StringVar(&modeFlag, "mode", "0644", "File permissions (octal) for written output files")
+	cmd.Flags().BoolVar(&includeStateBackendFlag, "include-state-backend", true, "Include permissions for Terraform state backend operations (use --include-state-backend=false to exclude)")
+	cmd.Flags().BoolVar(&leastPrivilegeFlag, "least-privilege", false, "Generate separate statements per service with specific resource ARNs")
+	cmd.Flags().BoolVar(&splitReadWriteFlag, "split-read-write", false, "With --least-privilege, split each service into a read statement on the service-wide ARN and a write statement on the scoped ARNs")
+	cmd.Flags().StringVar(&groupByFlag, "group-by", GroupByService, "With --least-privilege, one statement per service, or per resource (named after its address, identical statements merged)")
+	cmd.Flags().StringVarP(&formatFlag, "format", "f", "json", "Output format (json, yaml, terraform, pulumi-ts, pulumi-python, html, csv, xlsx, spacelift, env0, opa)")
+	cmd.Flags().BoolVar(&stampFlag, "stamp", false, "Stamp the policy Id with a digest of the scanned files and the options, to verify it matches the code at a commit")
+	cmd.Flags().StringVar(&mergeFlag, "merge", "", "Baseline IAM policy JSON to union with the generated policy (baseline statements are preserved)")
+	cmd.Flags().StringVar(&workloadPoliciesFlag, "workload-policies", "", "Write the documented IAM policy of each Kubernetes controller found (Helm charts, IRSA service accounts, Pod Identity associations, EKS add-ons) to <dir>/<controller>.json")
+	cmd.Flags().StringVar(&reportFlag, "report", "", "Write a JSON run report (services, unmapped resources, parse warnings) to this file")
+	cmd.Flags().StringArrayVar(&targetFlag, "target", nil, "Only include this resource address and its dependencies, like terraform -target (repeatable)")
+	cmd.Flags().StringSliceVar(&includeTypesFlag, "include-types", nil, "Only include resources and data sources whose type matches one of these globs (e.g. 'aws_s3_*')")
+	cmd.Flags().StringSliceVar(&excludeTypesFlag, "exclude-types", nil, "Leave out resources and data sources whose type matches one of these globs (e.g. 'aws_iam_*')")
+	cmd.Flags().StringVar(&mergeNegationsFlag, "merge-negations", NegationsWarn, "How to handle NotAction/NotResource in the --merge baseline: warn, refuse, or normalize into explicit Allow statements")
+	cmd.Flags().BoolVar(&serviceWeightsFlag, "service-weights", false, "Rank services by permission weight (write actions, resources, wildcards) in the summary")
+	cmd.Flags().BoolVar(&timingFlag, "timing", false, "Report the time spent walking, parsing, looking up permissions and formatting")
+	cmd.Flags().StringVar(&profileOutFlag, "profile-out", "", "Write CPU and heap profiles of the run to this directory (cpu.pprof, heap.pprof), for go tool pprof")
+	cmd.Flags().BoolVar(&noProgressFlag, "no-progress", false, "Do not show the parse progress bar on large scans")
+	cmd.Flags().StringVar(&maxFileSizeFlag, "max-file-size", "10MB", "Skip .tf and state files larger than this (e.g. 512KB, 50MB; 0: no limit)")
+	cmd.Flags().BoolVarP(&quietFlag, "quiet", "q", false, "Print nothing but errors and warnings to stderr (no summary, progress or \"written to\" messages); stdout carries only the policy either way")
+	cmd.Flags().StringVar(&policyVersionFlag, "policy-version", defaultPolicyVersion, "Version element of the generated policy (2012-10-17, or 2008-10-17 for tooling that needs it)")
+	cmd.Flags().StringVar(&templateVarsFlag, "template-vars", "", "With --least-privilege, keep account ID, region and environment as placeholders in ARNs, in this syntax: terraform, jinja, go-template, cfn-sub")
+	cmd.Flags().StringVar(&templateEnvironmentFlag, "template-environment", "", "With --template-vars, environment name to replace with the environment placeholder where it appears in resource names")
+	cmd.Flags().StringVar(&partitionFlag, "partition", "aws", "AWS partition of the generated ARNs (aws, aws-cn, aws-us-gov, ...); every ARN in the output must belong to it")
+	cmd.Flags().StringVar(&policyTypeFlag, "policy-type", PolicyTypeManaged, "Policy type to size the output for: managed, or session to compress it into the 2048 character STS session policy limit")
+	cmd.Flags().IntVar(&wildcardThresholdFlag, "wildcard-threshold", 0, "Without --least-privilege, collapse a service's actions into service:* when the policy needs more than this many (0: never); never_wildcard and wildcard_thresholds in the config file adjust it per service")
+	cmd.Flags().BoolVar(&compressActionsFlag, "compress-actions", false, "When the policy exceeds its size limit, collapse actions into prefix wildcards that grant nothing outside the access levels of the actions they replace, and list what each wildcard adds")
+	cmd.Flags().BoolVar(&annotateFlag, "annotate", false, "Comment each statement with the resource addresses that required it (terraform and yaml output; json gets a <output>.annotations.json sidecar)")
+	cmd.Flags().StringVar(&attachToRoleFlag, "attach-to-role", "", "With --format terraform, attach the policy to this existing IAM role: a managed policy and aws_iam_role_policy_attachment when it fits the managed policy size limit, otherwise an inline aws_iam_role_policy")
+	cmd.Flags().StringVar(&oidcGitHubFlag, "oidc-github", "", "Trust GitHub Actions OIDC tokens of this owner/repo: a trust policy next to --output, or an OIDC role with --format terraform")
+	cmd.Flags().StringVar(&oidcGitLabFlag, "oidc-gitlab", "", "Trust GitLab CI OIDC tokens of this group/project: a trust policy next to --output, or an OIDC role with --format terraform")
+	cmd.Flags().StringVar(&oidcGitLabURLFlag, "oidc-gitlab-url", defaultGitLabURL, "URL of a self-managed GitLab instance issuing the --oidc-gitlab tokens")
+	cmd.Flags().StringVar(&oidcCircleCIFlag, "oidc-circleci", "", "Trust CircleCI OIDC tokens of this organization ID: a trust policy next to --output, or an OIDC role with --format terraform")
+	cmd.Flags().BoolVar(&compactFlag, "compact", false, "With --format json, write the policy minified on one line, for the console and CLI size limits")
+	cmd.Flags().BoolVar(&documentOnlyFlag, "document-only", false, "With --format terraform, write only the aws_iam_policy_document data source, without the aws_iam_policy resource")
+	cmd.Flags().StringVar(&configFlag, "config", "", "Configuration file (default: "+defaultConfigFile+" in the working directory, if present)")
+	cmd.Flags().BoolVar(&noDestroyPermissionsFlag, "no-destroy-permissions", false, "Omit destructive actions (Delete*, Terminate*, kms:ScheduleKeyDeletion) from the policy, for pipelines that never destroy")
+	cmd.Flags().StringSliceVar(&excludeActionsFlag, "exclude-actions", nil, "Remove actions matching these IAM patterns from the generated policy (e.g. 'iam:Delete*,kms:ScheduleKeyDeletion')")
+	cmd.Flags().StringVar(&permissionsBoundaryFlag, "permissions-boundary", "", "Only allow creating roles and changing their policies with this managed policy as their permissions boundary (iam:PermissionsBoundary condition); iam:DeleteRolePermissionsBoundary is left out")
+	cmd.Flags().StringArrayVar(&scopeByTagFlag, "scope-by-tag", nil, "Authorize tag-capable actions by this Key=Value tag with aws:ResourceTag/aws:RequestTag conditions instead of ARNs (repeatable)")
+	cmd.Flags().StringVar(&providerSchemaFlag, "provider-schema", "", "Provider schema from 'terraform providers schema -json', used to find the attributes that name each resource in least-privilege ARNs")
+	cmd.Flags().BoolVar(&fetchOCIModulesFlag, "fetch-oci-modules", false, "Pull oci:// module sources from their registry, with the credentials of the docker config, and scan them like local modules")
+	cmd.Flags().BoolVar(&fetchStackTemplatesFlag, "fetch-stack-templates", false, "Download the template_url of CloudFormation stacks over HTTPS to grant what their templates create")
+	cmd.Flags().StringArrayVar(&permissionsDirFlag, "permissions-dir", nil, "Directory of extra permission mappings (.json/.yaml) merged into the permissions DB (repeatable)")
+	cmd.Flags().StringVar(&configURLFlag, "config-url", "", "Fetch the configuration file from an https:// URL, cached and revalidated by ETag")
+	cmd.Flags().StringVar(&configSHA256Flag, "config-sha256", "", "Expected SHA256 of the --config-url file; a mismatch fails the run")
+	cmd.Flags().StringVar(&permissionsURLFlag, "permissions-url", "", "Fetch org-level permission mappings from an https:// URL into the org layer, cached and revalidated by ETag (default: $TF_IAM_SCANNER_PERMISSIONS_URL)")
+	cmd.Flags().StringVar(&permissionsSHA256Flag, "permissions-sha256", "", "Expected SHA256 of the --permissions-url file; a mismatch fails the run")
+	cmd.Flags().StringVar(&permissionsOrgFlag, "permissions-org", "", "Org-level permission mappings (a .json/.yaml file or a directory of them) applied between the embedded DB and --permissions-dir (default: $TF_IAM_SCANNER_PERMISSIONS_ORG)")
+	cmd.Flags().BoolVar(&redactValuesFlag, "redact-values", false, "Drop every attribute value read from the Terraform source or plan, for reports shared outside the team (ARNs fall back to wildcards)")
+	addAttestationFlags(cmd.Flags())
+	// --sign kms:... calls AWS from every policy-generating command
+	addAWSFlags(cmd.Flags())
+	cmd.Flags().StringSliceVar(&failOnFlag, "fail-on", nil, "Exit non-zero when the policy trips a gate (wildcard-action, wildcard-resource, unmapped-resource, size-limit, unknown-action)")
+	cmd.Flags().BoolVar(&strictFlag, "strict", false, "Exit 3 when a resource or data source type has no permissions mapping, before any --fail-on gate")
+	cmd.Flags().StringSliceVar(&disableRuleFlag, "disable-rule", nil, "Turn off findings of these rules, by ID or name (e.g. TFIAM003,unmapped-resource); a disabled rule no longer trips its --fail-on gate")
+	cmd.Flags().StringSliceVar(&enableRuleFlag, "enable-rule", nil, "Turn back on rules disabled by disable_rules in the config file")
+
+	// Shell completion for enumerated flag values ('completion bash|zsh|fish|powershell')
+	_ = cmd.MarkFlagDirname("permissions-dir")
+	_ = cmd.MarkFlagFilename("config", "yaml", "yml")
+	_ = cmd.MarkFlagFilename("provider-schema", "json")
+	_ = cmd.RegisterFlagCompletionFunc("format", func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+		return formatNames(), cobra.ShellCompDirectiveNoFileComp
+	})
+	_ = cmd.RegisterFlagCompletionFunc("fail-on", cobra.FixedCompletions(
+		[]string{GateWildcardAction, GateWildcardResource, GateUnmappedResource, GateSizeLimit, GateUnknownAction}, cobra.ShellCompDirectiveNoFileComp))
+	_ = cmd.RegisterFlagCompletionFunc("merge-negations", cobra.FixedCompletions(
+		[]string{NegationsWarn, NegationsRefuse, NegationsNormalize}, cobra.ShellCompDirectiveNoFileComp))
+	_ = cmd.RegisterFlagCompletionFunc("policy-type", cobra.FixedCompletions(
+		[]string{PolicyTypeManaged, PolicyTypeSession}, cobra.ShellCompDirectiveNoFileComp))
+	_ = cmd.RegisterFlagCompletionFunc("template-vars", cobra.FixedCompletions(
+		[]string{"terraform", "jinja", "go-template", "cfn-sub"}, cobra.ShellCompDirectiveNoFileComp))
+	_ = cmd.RegisterFlagCompletionFunc("policy-version", cobra.FixedCompletions(
+		[]string{defaultPolicyVersion, legacyPolicyVersion}, cobra.ShellCompDirectiveNoFileComp))
+	_ = cmd.RegisterFlagCompletionFunc("partition", func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+		return sortedSet(knownARNPartitions), cobra.ShellCompDirectiveNoFileComp
+	})
+}
+
+func runScanner(cmd *cobra.Command, args []string) error {
+	// The flags parsed; errors from here on are not usage errors
+	cmd.SilenceUsage = true
+	format, err := validateOutputFlags(cmd)
+	if err != nil {
+		return err
 	}
+	ctx := cmd.Context()
 
-	format := OutputFormat(formatFlag)
+	if len(scannerConfig.Stacks) > 0 && !cmd.Flags().Changed("path") && planFileFlag == "" {
+		return runStacks(cmd, format)
+	}
 
-	// Parse input (plan file takes precedence over path)
-	var result *ParseResult
-	var err error
+	if changedSinceFlag != "" && (planFileFlag != "" || len(pathFlag) > 1) {
+		return validationErrorf("--changed-since needs a single --path and no --plan-file")
+	}
 
+	// Parse input (plan file takes precedence over path)
 	if planFileFlag != "" {
-		result, err = parsePlanFile(planFileFlag)
+		result, err := parsePlanFile(planFileFlag)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error parsing plan file: %v\n", err)
-			os.Exit(1)
+			return &ParseError{Source: planFileFlag, Err: err}
 		}
+		exitIfDenied(scanResult(ctx, result, planFileFlag, format))
+		return nil
+	}
+
+	if len(pathFlag) == 0 {
+		return validationErrorf("either --path or --plan-file is required")
+	}
+	if len(pathFlag) > 1 {
+		return runRoots(ctx, pathFlag, format)
+	}
+
+	if isTerraformStack(pathFlag[0]) {
+		if changedSinceFlag != "" {
+			return validationErrorf("--changed-since does not support Terraform Stacks")
+		}
+		return runTerraformStack(ctx, pathFlag[0], format)
+	}
+
+	if changedSinceFlag != "" {
+		result, before, delta, err := parseChangedFiles(pathFlag[0], changedSinceFlag)
+		if err != nil {
+			return err
+		}
+		redactParseResult(result, redactValuesFlag)
+		redactParseResult(before, redactValuesFlag)
+		computeChangeDelta(delta, before, result)
+		printChangeDelta(delta)
+		runChangeDelta = delta
+		exitIfDenied(scanResult(ctx, result, pathFlag[0], format))
+		return nil
+	}
+
+	result, err := parseTerraformFilesContext(ctx, pathFlag[0])
+	if err != nil {
+		exitIfCancelled(ctx, nil, pathFlag[0])
+		return &ParseError{Source: pathFlag[0], Err: err}
+	}
+	exitIfCancelled(ctx, result, pathFlag[0])
+	exitIfDenied(scanResult(ctx, result, pathFlag[0], format))
+	return nil
+}
+
+// scanResult exports the scan, verifies data sources and writes the policy
+// of one scanned input, as requested by the flags. It reports whether a data
+// source read was denied.
+func scanResult(ctx context.Context, result *ParseResult, source string, format OutputFormat) bool {
+	redactParseResult(result, redactValuesFlag)
+	if exportScanFlag != "" {
+		if err := exportScan(result, source, exportScanFlag, outputMode, forceFlag); err != nil {
+			exitWithError(&OutputError{Path: exportScanFlag, Err: err})
+		}
+		statusf("Scan result written to: %s\n", exportScanFlag)
+	}
+
+	denied := false
+	if verifyDataSourcesFlag {
+		denied = runDataSourceVerification(ctx, result)
+		exitIfCancelled(ctx, result, source)
+	}
+
+	generateAndWrite(ctx, result, format, source)
+	return denied
+}
+
+// exitIfDenied exits with exitDataSourceDenied when a data source read was
+// denied.
+func exitIfDenied(denied bool) {
+	if denied {
+		fmt.Fprintf(os.Stderr, "\nData source verification failed: at least one read was denied\n")
+		exitRun(exitDataSourceDenied)
+	}
+}
+
+// validateOutputFlags checks the flags shared by every policy-generating
+// command and returns the selected output format, or a ValidationError or
+// DBError.
+func validateOutputFlags(cmd *cobra.Command) (OutputFormat, error) {
+	var config Config
+	var err error
+	if configURLFlag != "" {
+		if configFlag != "" {
+			return "", validationErrorf("--config and --config-url are mutually exclusive")
+		}
+		config, err = loadRemoteConfig(configURLFlag, configSHA256Flag)
 	} else {
-		if pathFlag == "" {
-			fmt.Fprintf(os.Stderr, "Error: either --path or --plan-file is required\n")
-			os.Exit(1)
+		config, err = loadConfig(configFlag)
+	}
+	if err != nil {
+		return "", &ValidationError{Err: err}
+	}
+	applyConfig(cmd, config)
+
+	// Validate format
+	if !validFormat(OutputFormat(formatFlag)) {
+		return "", validationErrorf("invalid format %s. Valid formats: %s", formatFlag, strings.Join(formatNames(), ", "))
+	}
+
+	format := OutputFormat(formatFlag)
+	if format == FormatXLSX && outputFlag == "" {
+		return "", validationErrorf("xlsx output is binary; use --output to write it to a file")
+	}
+
+	if splitReadWriteFlag && !leastPrivilegeFlag {
+		return "", validationErrorf("--split-read-write needs --least-privilege")
+	}
+
+	if err := validateGroupBy(groupByFlag); err != nil {
+		return "", &ValidationError{Err: err}
+	}
+
+	if err := validateGates(failOnFlag); err != nil {
+		return "", &ValidationError{Err: err}
+	}
+
+	if err := validateMergeNegations(mergeNegationsFlag); err != nil {
+		return "", &ValidationError{Err: err}
+	}
+
+	if err := validatePolicyType(policyTypeFlag); err != nil {
+		return "", &ValidationError{Err: err}
+	}
+
+	if err := validatePolicyVersion(policyVersionFlag); err != nil {
+		return "", &ValidationError{Err: err}
+	}
+
+	if err := validatePartition(partitionFlag); err != nil {
+		return "", &ValidationError{Err: err}
+	}
+	defaultARNContext.Partition = partitionFlag
+
+	if err := validatePermissionsBoundary(permissionsBoundaryFlag, partitionFlag); err != nil {
+		return "", &ValidationError{Err: err}
+	}
+
+	if err := validateTemplateVars(templateVarsFlag); err != nil {
+		return "", &ValidationError{Err: err}
+	}
+	if templateVarsFlag != "" && !leastPrivilegeFlag {
+		return "", validationErrorf("--template-vars needs --least-privilege")
+	}
+	if templateEnvironmentFlag != "" && templateVarsFlag == "" {
+		return "", validationErrorf("--template-environment needs --template-vars")
+	}
+	if templateVarsFlag != "" {
+		applyTemplateVars(templateVarsFlag, templateEnvironmentFlag)
+	}
+
+	if err := validateTargets(targetFlag); err != nil {
+		return "", &ValidationError{Err: err}
+	}
+
+	if err := validateTypePatterns(append(append([]string{}, includeTypesFlag...), excludeTypesFlag...)); err != nil {
+		return "", &ValidationError{Err: err}
+	}
+
+	disabled, err := resolveDisabledRules(append(append([]string{}, config.DisableRules...), disableRuleFlag...), enableRuleFlag)
+	if err != nil {
+		return "", &ValidationError{Err: err}
+	}
+	disabledRules = disabled
+
+	if outputTemplateFlag != "" {
+		if cmd.Flags().Changed("output") && cmd.Flags().Changed("output-template") {
+			return "", validationErrorf("--output and --output-template cannot be combined")
+		}
+		outputTemplate, err = parseOutputTemplate(outputTemplateFlag)
+		if err != nil {
+			return "", &ValidationError{Err: err}
 		}
-		result, err = parseTerraformFiles(pathFlag)
+	}
+
+	config.ExcludeActions = append(config.ExcludeActions, excludeActionsFlag...)
+	if err := validateExcludePatterns(config.ExcludeActions); err != nil {
+		return "", &ValidationError{Err: err}
+	}
+	size, err := parseByteSize(maxFileSizeFlag)
+	if err != nil {
+		return "", &ValidationError{Err: err}
+	}
+	maxFileSize = size
+	if err := validateWildcardConfig(wildcardThresholdFlag, config); err != nil {
+		return "", &ValidationError{Err: err}
+	}
+	extras, warnings, err := validateExtraStatements(config.ExtraStatements)
+	if err != nil {
+		return "", &ValidationError{Err: err}
+	}
+	for _, warning := range warnings {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+	}
+	extraStatements = extras
+	if cmd.Flags().Changed("wildcard-threshold") && leastPrivilegeFlag {
+		return "", validationErrorf("--wildcard-threshold cannot be used with --least-privilege, which keeps every action")
+	}
+	scannerConfig = config
+
+	scopes, err := parseTagScopes(scopeByTagFlag)
+	if err != nil {
+		return "", &ValidationError{Err: err}
+	}
+	tagScopes = scopes
+
+	if err := loadPermissionPlugins(permissionsDirFlag); err != nil {
+		return "", &DBError{Source: "the permissions DB", Err: err}
+	}
+
+	if providerSchemaFlag != "" {
+		schemas, err := loadResourceAttributeSchemas(providerSchemaFlag)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error parsing Terraform files: %v\n", err)
-			os.Exit(1)
+			return "", &DBError{Source: providerSchemaFlag, Err: err}
 		}
+		resourceAttributeSchemas = schemas
+	}
+
+	mode, err := parseFileMode(modeFlag)
+	if err != nil {
+		return "", &ValidationError{Err: err}
+	}
+	outputMode = mode
+
+	if err := validateAttestationFlags(); err != nil {
+		return "", &ValidationError{Err: err}
+	}
+	if err := validateSmokeTestFlags(); err != nil {
+		return "", &ValidationError{Err: err}
+	}
+
+	if err := validateSimulateFlags(); err != nil {
+		return "", &ValidationError{Err: err}
+	}
+	if err := validateAnnotateFlags(format); err != nil {
+		return "", &ValidationError{Err: err}
+	}
+	if err := validateAttachToRole(attachToRoleFlag, format); err != nil {
+		return "", &ValidationError{Err: err}
+	}
+	if err := validateOIDCFlags(format); err != nil {
+		return "", &ValidationError{Err: err}
+	}
+	if err := validateShapeFlags(format); err != nil {
+		return "", &ValidationError{Err: err}
+	}
+	if profileOutFlag != "" {
+		if err := startProfiling(profileOutFlag); err != nil {
+			return "", &OutputError{Path: profileOutFlag, Err: err}
+		}
+	}
+	runStartedAt = time.Now()
+	runOptions = changedFlagValues(cmd)
+
+	enableProgress()
+	return format, nil
+}
+
+// generateAndWrite narrows result with --target and the type filters, builds
+// the policy, writes it in the requested format, prints the summary and
+// applies --fail-on gates. source names the scanned input in messages. It
+// returns the formatted policy when no gate failed.
+func generateAndWrite(ctx context.Context, result *ParseResult, format OutputFormat, source string) string {
+	policy, _, code := generatePolicy(ctx, result, format, source)
+	if code != 0 {
+		exitRun(code)
+	}
+	return policy
+}
+
+// generatePolicy does the work of generateAndWrite and also returns the run
+// report, whether or not --report writes it. Rather than exiting when a
+// --strict, --fail-on, smoke test or simulation check fails, it returns the
+// exit code of the failed check, or 0 when every check passed.
+func generatePolicy(ctx context.Context, result *ParseResult, format OutputFormat, source string) (string, RunReport, int) {
+	redactParseResult(result, redactValuesFlag)
+	if len(targetFlag) > 0 {
+		total := len(result.Resources) + len(result.DataSources)
+		result = filterTargets(result, targetFlag)
+		statusf("Targeting %d of %d resources and data sources\n",
+			len(result.Resources)+len(result.DataSources), total)
+	}
+	if len(includeTypesFlag) > 0 || len(excludeTypesFlag) > 0 {
+		total := len(result.Resources) + len(result.DataSources)
+		result = filterTypes(result, includeTypesFlag, excludeTypesFlag)
+		statusf("Type filters kept %d of %d resources and data sources\n",
+			len(result.Resources)+len(result.DataSources), total)
 	}
 
 	if len(result.Resources) == 0 && len(result.DataSources) == 0 {
-		fmt.Fprintf(os.Stderr, "Warning: No AWS resources or data sources found in %s\n", pathFlag)
+		fmt.Fprintf(os.Stderr, "Warning: No AWS resources or data sources found in %s\n", source)
+	}
+	for _, warning := range roleBoundaryWarnings(result, permissionsBoundaryFlag) {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
 	}
 
+	prefetchStackTemplates(ctx, result)
+	exitIfCancelled(ctx, result, source)
+
 	// Generate IAM policy
-	policy, err := generateIAMPolicy(result, includeStateBackendFlag, format, leastPrivilegeFlag)
+	stopLookup := timings.track(PhaseLookup)
+	var iamPolicy IAMPolicy
+	if groupByFlag == GroupByResource {
+		iamPolicy = buildResourcePolicy(result, includeStateBackendFlag)
+	} else {
+		iamPolicy = buildIAMPolicy(result, includeStateBackendFlag, leastPrivilegeFlag)
+	}
+	stopLookup()
+	if splitReadWriteFlag {
+		iamPolicy = splitReadWrite(iamPolicy)
+	}
+	iamPolicy = scopePolicyByTags(iamPolicy, tagScopes)
+	destroy := destroyActions(result, includeStateBackendFlag)
+	if noDestroyPermissionsFlag {
+		iamPolicy = omitDestroyPermissions(iamPolicy, destroy)
+	}
+	iamPolicy, excluded := excludeActions(iamPolicy, scannerConfig.ExcludeActions)
+	iamPolicy, unbounded := requirePermissionsBoundary(iamPolicy, permissionsBoundaryFlag)
+	excluded = append(excluded, unbounded...)
+	iamPolicy, skippedExtras, err := appendExtraStatements(iamPolicy, extraStatements)
+	if err != nil {
+		exitWithError(&ValidationError{Err: err})
+	}
+
+	var baseline IAMPolicy
+	if mergeFlag != "" {
+		baseline, err = loadBaselinePolicy(mergeFlag)
+		if err != nil {
+			exitWithError(&ParseError{Source: mergeFlag, Err: err})
+		}
+		if mergeNegationsFlag == NegationsNormalize {
+			original := baseline
+			var kept []int
+			baseline, kept = normalizeNegations(baseline)
+			for _, i := range kept {
+				fmt.Fprintf(os.Stderr, "%s: %s: Deny and NotResource statements cannot be rewritten into explicit Allow statements\n",
+					mergeFlag, findingLocation(LintFinding{Statement: i, Sid: original.Statement[i].Sid}))
+			}
+		}
+		findings := auditMergeNegations(baseline, iamPolicy)
+		printMergeFindings(mergeFlag, findings)
+		if mergeNegationsFlag == NegationsRefuse {
+			for _, finding := range findings {
+				if finding.Severity == SeverityError {
+					exitWithError(validationErrorf("merging %s changes the meaning of its NotAction/NotResource statements (use --merge-negations normalize or edit the baseline)", mergeFlag))
+				}
+			}
+		}
+		iamPolicy = mergeWithBaseline(iamPolicy, baseline)
+	}
+	iamPolicy.Version = policyVersionFlag
+	runInputDigest = ""
+	if stampFlag {
+		if runInputDigest, err = inputDigest(result, source, runOptions); err != nil {
+			exitWithError(&ParseError{Source: source, Err: err})
+		}
+		iamPolicy.Id = stampPolicyID(runInputDigest)
+	}
+	var compression []policyCompression
+	if compressActionsFlag {
+		iamPolicy, compression = compressActions(iamPolicy, policySizeLimit())
+	}
+	if policyTypeFlag == PolicyTypeSession {
+		var steps []policyCompression
+		iamPolicy, steps = compressPolicy(iamPolicy, sessionPolicySizeLimit)
+		compression = append(compression, steps...)
+	}
+	if errs := policyGrammarErrors(renderTemplateSamples(iamPolicy, templateVarsFlag), defaultARNContext.Partition); len(errs) > 0 {
+		for _, message := range errs {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", message)
+		}
+		exitWithError(validationErrorf("the policy is not valid IAM policy grammar for partition %s", defaultARNContext.Partition))
+	}
+	stopFormat := timings.track(PhaseFormat)
+	var annotations []statementAnnotation
+	var policy string
+	if annotateFlag {
+		annotations = annotateStatements(iamPolicy, result)
+		policy, err = formatAnnotatedPolicy(iamPolicy, result, format, annotations)
+	} else {
+		policy, err = formatPolicy(iamPolicy, result, format)
+	}
+	stopFormat()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error generating IAM policy: %v\n", err)
-		os.Exit(1)
+		exitWithError(&OutputError{Path: outputFlag, Err: err})
 	}
 
 	// Output policy
 	if outputFlag != "" {
-		err := os.WriteFile(outputFlag, []byte(policy), 0644)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error writing output file: %v\n", err)
-			os.Exit(1)
+		if err := writeOutputFile(outputFlag, []byte(policy), outputMode, forceFlag); err != nil {
+			exitWithError(&OutputError{Path: outputFlag, Err: err})
 		}
-		fmt.Printf("IAM policy written to: %s\n", outputFlag)
+		statusf("IAM policy written to: %s\n", outputFlag)
 	} else {
 		fmt.Println(policy)
 	}
+	if annotateFlag && format == FormatJSON {
+		writeAnnotations(outputFlag, annotations)
+	}
+	writeTrustPolicy(outputFlag, format)
+	workloads := detectWorkloads(result)
+	if workloadPoliciesFlag != "" {
+		if err := writeWorkloadPolicies(workloads, workloadPoliciesFlag); err != nil {
+			exitWithError(&OutputError{Path: workloadPoliciesFlag, Err: err})
+		}
+	}
+
+	securityFindings, suppressed := applyRules(result.Findings, result)
+	allPolicyFindings := policyFindings(iamPolicy, result)
+	activePolicyFindings, suppressedPolicyFindings := applyRules(allPolicyFindings, result)
+	suppressed = append(suppressed, suppressedPolicyFindings...)
+
+	// Print summary; stdout carries only the policy
+	if !quietFlag {
+		fmt.Fprintf(os.Stderr, "\nSummary:\n")
+		fmt.Fprintf(os.Stderr, "  Resources found: %d\n", len(result.Resources))
+		fmt.Fprintf(os.Stderr, "  Data sources found: %d\n", countKind(result.DataSources, KindData))
+		if ephemerals := countKind(result.DataSources, KindEphemeral); ephemerals > 0 {
+			fmt.Fprintf(os.Stderr, "  Ephemeral resources found: %d\n", ephemerals)
+		}
+		if skipped := skippedProviders(result); len(skipped) > 0 {
+			fmt.Fprintf(os.Stderr, "  Skipped providers (no AWS permissions mapped): %s\n", describeSkippedProviders(skipped))
+		}
+		printAdoptedResources(result)
+		printUmbrellaResources(result)
+		printStackTemplates(result)
+		printExtraStatements(skippedExtras)
+		printCreatedIAMEntities(result)
+		printDestroyActions(destroy)
+		printSecretValueReads(secretValueReads(result))
+		printWorkloads(workloads)
+		if replicas := describeReplicaRegions(result); replicas != "" {
+			fmt.Fprintf(os.Stderr, "  Replicated to other Regions: %s\n", replicas)
+		}
+		fmt.Fprintf(os.Stderr, "  Permissions DB: %s\n", describePermissionsDB())
+		printPermissionLayers()
+		if runInputDigest != "" {
+			fmt.Fprintf(os.Stderr, "  Input digest: %s\n", runInputDigest)
+		}
+		if deprecated := deprecatedTypeUsages(result); len(deprecated) > 0 {
+			fmt.Fprintf(os.Stderr, "  Deprecated types (rename them before upgrading the AWS provider):\n")
+			for _, usage := range deprecated {
+				fmt.Fprintf(os.Stderr, "    %s\n", usage)
+			}
+		}
+
+		if backends := foundBackends(result); len(backends) > 1 {
+			fmt.Fprintf(os.Stderr, "  Backends detected: %d\n", len(backends))
+			for _, backend := range backends {
+				fmt.Fprintf(os.Stderr, "    %s\n", describeBackend(backend))
+			}
+		} else if result.Backend != nil {
+			fmt.Fprintf(os.Stderr, "  Backend detected: %s\n", result.Backend.Type)
+		}
+		if result.Backend != nil {
+			if access := hcpTerraformAccess(result.Backend); access != nil {
+				printHCPTerraformAccess(access)
+			} else if includeStateBackendFlag {
+				fmt.Fprintf(os.Stderr, "  State backend permissions: included\n")
+			} else {
+				fmt.Fprintf(os.Stderr, "  State backend permissions: excluded (use --include-state-backend to include)\n")
+			}
+		}
+		if len(result.StateEncryption) > 0 {
+			fmt.Fprintf(os.Stderr, "  State encryption: %s\n", describeStateEncryption(result.StateEncryption))
+		}
+
+		if len(tagScopes) > 0 {
+			fmt.Fprintf(os.Stderr, "  Scoped by tag: %s\n", describeTagScopes(tagScopes))
+		}
+		if permissionsBoundaryFlag != "" {
+			fmt.Fprintf(os.Stderr, "  Role writes require permissions boundary: %s\n", permissionsBoundaryFlag)
+		}
 
-	// Print summary
-	fmt.Fprintf(os.Stderr, "\nSummary:\n")
-	fmt.Fprintf(os.Stderr, "  Resources found: %d\n", len(result.Resources))
-	fmt.Fprintf(os.Stderr, "  Data sources found: %d\n", len(result.DataSources))
+		if mergeFlag != "" {
+			fmt.Fprintf(os.Stderr, "  Baseline merged: %s (%d statements)\n", mergeFlag, len(baseline.Statement))
+		}
+
+		if policyTypeFlag == PolicyTypeSession {
+			size := policySize(iamPolicy)
+			fmt.Fprintf(os.Stderr, "  Policy type: session (%d of %d characters)\n", size, sessionPolicySizeLimit)
+			printPolicyCompression(compression, size, sessionPolicySizeLimit)
+		} else if compressActionsFlag {
+			size := policySize(iamPolicy)
+			fmt.Fprintf(os.Stderr, "  Policy size: %d of %d characters\n", size, managedPolicySizeLimit)
+			printPolicyCompression(compression, size, managedPolicySizeLimit)
+		}
+
+		if len(result.Warnings) > 0 {
+			if len(result.Diagnostics) > 0 {
+				fmt.Fprintf(os.Stderr, "  Parse warnings: %d (input was only partially parsed; the policy may be incomplete)\n", len(result.Warnings))
+			} else {
+				fmt.Fprintf(os.Stderr, "  Parse warnings: %d\n", len(result.Warnings))
+			}
+			for _, warning := range result.Warnings {
+				fmt.Fprintf(os.Stderr, "    - %s\n", warning)
+			}
+		}
 
-	if result.Backend != nil {
-		fmt.Fprintf(os.Stderr, "  Backend detected: %s\n", result.Backend.Type)
-		if includeStateBackendFlag {
-			fmt.Fprintf(os.Stderr, "  State backend permissions: included\n")
-		} else {
-			fmt.Fprintf(os.Stderr, "  State backend permissions: excluded (use --include-state-backend to include)\n")
+		printSecurityFindings(securityFindings)
+		printPolicyFindings(activePolicyFindings, suppressed)
+		printPolicyStats(computePolicyStats(iamPolicy))
+		if serviceWeightsFlag {
+			printServiceWeights(os.Stderr, computeServiceWeights(iamPolicy, collectContributions(result)))
+		}
+	} else {
+		for _, warning := range result.Warnings {
+			fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
 		}
 	}
+	printExcludedActions(excluded)
+	if timingFlag {
+		timings.print(os.Stderr)
+	}
 
-	if leastPrivilegeFlag {
-		services := extractServicesFromResult(result, includeStateBackendFlag)
-		fmt.Fprintf(os.Stderr, "  Services requiring permissions: %s\n", strings.Join(services, ", "))
+	var simulation *SimulationReport
+	if simulateRoleFlag != "" {
+		simulation = runSimulation(ctx, iamPolicy)
+		exitIfCancelled(ctx, result, source)
 	}
-}
 
-// extractServicesFromResult extracts distinct AWS service names from the parsed result.
-func extractServicesFromResult(result *ParseResult, includeBackend bool) []string {
-	services := make(map[string]bool)
-
-	for _, resource := range result.Resources {
-		if resource.Provider == "aws" {
-			perms := getRequiredPermissions(resource.Type)
-			for _, action := range perms {
-				parts := strings.Split(action, ":")
-				if len(parts) == 2 {
-					services[parts[0]] = true
-				}
-			}
+	report := buildRunReport(result, iamPolicy, source)
+	report.ExcludedActions = excludedActionNames(excluded)
+	report.DestroyActions = destroy
+	report.DestroyPermissionsOmitted = noDestroyPermissionsFlag && len(destroy) > 0
+	report.ChangedSince = runChangeDelta
+	report.Compression = compression
+	report.Workloads = workloads
+	report.SecurityFindings = append([]SecurityFinding{}, securityFindings...)
+	report.PolicyFindings = activePolicyFindings
+	report.Suppressed = suppressed
+	report.Simulation = simulation
+	if reportFlag != "" {
+		if err := writeRunReport(report, reportFlag, outputMode, forceFlag); err != nil {
+			exitWithError(&OutputError{Path: reportFlag, Err: err})
 		}
+		statusf("  Report written to: %s\n", reportFlag)
 	}
 
-	for _, ds := range result.DataSources {
-		if ds.Provider == "aws" {
-			dataSourceKey := "data." + ds.Type
-			perms := getRequiredPermissions(dataSourceKey)
-			if len(perms) == 0 {
-				perms = getRequiredPermissions(ds.Type)
+	if outputFlag != "" && (attestFlag != "" || signFlag != "") {
+		artifacts := []string{outputFlag}
+		if attestFlag != "" {
+			if err := writeProvenance(outputFlag, attestFlag, source, outputMode, forceFlag); err != nil {
+				exitWithError(&OutputError{Path: attestFlag, Err: err})
 			}
-			for _, action := range perms {
-				if isReadOnlyAction(action) {
-					parts := strings.Split(action, ":")
-					if len(parts) == 2 {
-						services[parts[0]] = true
-					}
-				}
+			statusf("  Provenance written to: %s\n", attestFlag)
+			artifacts = append(artifacts, attestFlag)
+		}
+		if signFlag != "" {
+			if err := signArtifacts(ctx, artifacts, outputMode, forceFlag); err != nil {
+				exitIfCancelled(ctx, nil, source)
+				exitWithError(err)
 			}
 		}
 	}
 
-	if includeBackend {
-		services["s3"] = true
-		services["dynamodb"] = true
+	smokeTestDenied := false
+	if smokeTestFlag {
+		smokeTestDenied = runSmokeTest(ctx, iamPolicy, result)
+		exitIfCancelled(ctx, nil, source)
+	}
+
+	// Evaluate --strict and --fail-on gates last so the policy and summary are
+	// still written
+	code := failedCheck(iamPolicy, result, allPolicyFindings, activePolicyFindings, smokeTestDenied, simulation)
+	return policy, report, code
+}
+
+// runStacks generates the policy of every stack in the configuration file,
+// writing each to its configured output (output_template or stdout when it
+// has none).
+func runStacks(cmd *cobra.Command, format OutputFormat) error {
+	for _, name := range []string{"output", "export-scan", "report", "attest", "workload-policies", "changed-since", "verify-data-sources", "smoke-test"} {
+		if cmd.Flags().Changed(name) {
+			return validationErrorf("--%s needs --path when %s lists stacks", name, defaultConfigFile)
+		}
 	}
-	services["sts"] = true
 
-	serviceList := make([]string, 0, len(services))
-	for service := range services {
-		serviceList = append(serviceList, service)
+	var templated []string
+	if outputTemplate != nil {
+		splits := make([]artifactFields, len(scannerConfig.Stacks))
+		for i, stack := range scannerConfig.Stacks {
+			splits[i] = artifactFields{Stack: stack.name}
+		}
+		var err error
+		if templated, err = templateOutputs(splits, format); err != nil {
+			return &ValidationError{Err: err}
+		}
 	}
-	sort.Strings(serviceList)
 
-	return serviceList
+	for i, stack := range scannerConfig.Stacks {
+		statusf("==> %s\n", stack.Path)
+		result, err := parseTerraformFilesContext(cmd.Context(), stack.Path)
+		exitIfCancelled(cmd.Context(), nil, stack.Path)
+		if err != nil {
+			return &ParseError{Source: stack.Path, Err: err}
+		}
+
+		outputFlag = stack.Output
+		if outputFlag == "" && templated != nil {
+			outputFlag = templated[i]
+		}
+		if outputFlag != "" {
+			if err := os.MkdirAll(filepath.Dir(outputFlag), 0755); err != nil {
+				return &OutputError{Path: outputFlag, Err: err}
+			}
+		}
+		generateAndWrite(cmd.Context(), result, format, stack.Path)
+		statusf("\n")
+	}
+	return nil
 }
 
 func main() {
-	if err := rootCmd.Execute(); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+	ctx, stop := interruptContext()
+	err := rootCmd.ExecuteContext(ctx)
+	stopTimeout()
+	stop()
+	stopProfiling()
+	if err != nil {
+		exitWithError(err)
 	}
 }
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+// loadBaselinePolicy reads a hand-maintained IAM policy document used with
+// --merge. Action and Resource elements are normalized to string or []string
+// so they behave like generated statements.
+func loadBaselinePolicy(filePath string) (IAMPolicy, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return IAMPolicy{}, fmt.Errorf("error reading baseline policy: %w", err)
+	}
+
+	var policy IAMPolicy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return IAMPolicy{}, fmt.Errorf("error parsing baseline policy JSON: %w", err)
+	}
+
+	for i := range policy.Statement {
+		statement := &policy.Statement[i]
+		if statement.Effect != "Allow" && statement.Effect != "Deny" {
+			return IAMPolicy{}, fmt.Errorf("baseline statement %d has invalid Effect %q", i, statement.Effect)
+		}
+		statement.Action = normalizePolicyElement(statement.Action)
+		statement.NotAction = normalizePolicyElement(statement.NotAction)
+		statement.Resource = normalizePolicyElement(statement.Resource)
+		statement.NotResource = normalizePolicyElement(statement.NotResource)
+	}
+
+	return policy, nil
+}
+
+// normalizePolicyElement converts a decoded JSON element into a string or
+// []string, keeping single strings as strings.
+func normalizePolicyElement(value interface{}) interface{} {
+	switch value.(type) {
+	case nil:
+		return nil
+	case string:
+		return value
+	}
+	return toStringSlice(value)
+}
+
+// mergeWithBaseline unions the generated policy with a baseline policy.
+// Baseline statements are kept verbatim (including Deny statements and
+// conditions) and come first. Generated actions that an unconditional
+// baseline Allow already grants for the same resources are dropped, and
+// generated statements left without actions are removed.
+func mergeWithBaseline(generated, baseline IAMPolicy) IAMPolicy {
+	merged := IAMPolicy{
+		Version:   generated.Version,
+		Id:        generated.Id,
+		Statement: make([]IAMStatement, 0, len(baseline.Statement)+len(generated.Statement)),
+	}
+	if baseline.Version != "" {
+		merged.Version = baseline.Version
+	}
+
+	merged.Statement = append(merged.Statement, baseline.Statement...)
+
+	for _, statement := range generated.Statement {
+		resources := toStringSlice(statement.Resource)
+		var remaining []string
+		for _, action := range toStringSlice(statement.Action) {
+			if !baselineGrants(baseline, action, resources) {
+				remaining = append(remaining, action)
+			}
+		}
+		if len(remaining) == 0 {
+			continue
+		}
+		statement.Action = remaining
+		merged.Statement = append(merged.Statement, statement)
+	}
+
+	return merged
+}
+
+// baselineGrants reports whether an unconditional Allow statement in the
+// baseline grants action on every one of resources.
+func baselineGrants(baseline IAMPolicy, action string, resources []string) bool {
+	for _, statement := range baseline.Statement {
+		if statement.Effect != "Allow" || len(statement.Condition) > 0 ||
+			statement.NotAction != nil || statement.NotResource != nil {
+			continue
+		}
+		if !matchesAny(toStringSlice(statement.Action), action, true) {
+			continue
+		}
+
+		covered := true
+		for _, resource := range resources {
+			if !matchesAny(toStringSlice(statement.Resource), resource, false) {
+				covered = false
+				break
+			}
+		}
+		if covered {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesAny reports whether value matches any of the IAM wildcard patterns.
+// Action names are matched case-insensitively, as IAM does.
+func matchesAny(patterns []string, value string, foldCase bool) bool {
+	for _, pattern := range patterns {
+		if iamWildcardMatch(pattern, value, foldCase) {
+			return true
+		}
+	}
+	return false
+}
+
+// iamWildcardMatch matches value against an IAM pattern where "*" matches any
+// run of characters and "?" matches a single character.
+func iamWildcardMatch(pattern, value string, foldCase bool) bool {
+	if foldCase {
+		pattern = strings.ToLower(pattern)
+		value = strings.ToLower(value)
+	}
+	if pattern == "*" || pattern == value {
+		return true
+	}
+
+	// path.Match treats "/" as a separator, which ARNs use freely; swap it
+	// for a byte that cannot appear in either string.
+	const sep = "\x00"
+	matched, err := path.Match(
+		strings.ReplaceAll(escapeMatchMeta(pattern), "/", sep),
+		strings.ReplaceAll(value, "/", sep),
+	)
+	return err == nil && matched
+}
+
+// escapeMatchMeta escapes path.Match metacharacters other than * and ?, which
+// have no special meaning in IAM patterns.
+func escapeMatchMeta(pattern string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `[`, `\[`, `]`, `\]`)
+	return replacer.Replace(pattern)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMergeWithBaseline(t *testing.T) {
+	dir := t.TempDir()
+	baselinePath := filepath.Join(dir, "baseline.json")
+	baselineJSON := `{
+  "Version": "2012-10-17",
+  "Statement": [
+    {"Sid": "Manual", "Effect": "Allow", "Action": "s3:Get*", "Resource": "*"},
+    {"Sid": "NoUnencrypted", "Effect": "Deny", "Action": "s3:PutObject", "Resource": "*",
+     "Condition": {"Null": {"s3:x-amz-server-side-encryption": "true"}}},
+    {"Effect": "Allow", "Action": ["sqs:SendMessage"], "Resource": "*",
+     "Condition": {"StringEquals": {"aws:RequestedRegion": "us-east-1"}}}
+  ]
+}`
+	if err := os.WriteFile(baselinePath, []byte(baselineJSON), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	baseline, err := loadBaselinePolicy(baselinePath)
+	if err != nil {
+		t.Fatalf("Error loading baseline: %v", err)
+	}
+
+	generated := IAMPolicy{
+		Version: "2012-10-17",
+		Statement: []IAMStatement{
+			{Effect: "Allow", Action: []string{"s3:CreateBucket", "s3:GetBucketTagging"}, Resource: "arn:aws:s3:::data"},
+			{Effect: "Allow", Action: []string{"sqs:SendMessage"}, Resource: "*"},
+			{Effect: "Allow", Action: []string{"s3:GetObject"}, Resource: "*"},
+		},
+	}
+
+	merged := mergeWithBaseline(generated, baseline)
+
+	if len(merged.Statement) != 5 {
+		t.Fatalf("Expected 3 baseline + 2 generated statements, got %d: %+v", len(merged.Statement), merged.Statement)
+	}
+	if merged.Statement[1].Effect != "Deny" || merged.Statement[1].Condition == nil {
+		t.Error("Expected baseline Deny statement and its condition to be preserved")
+	}
+	if got := toStringSlice(merged.Statement[3].Action); !reflect.DeepEqual(got, []string{"s3:CreateBucket"}) {
+		t.Errorf("Expected s3:GetBucketTagging to be deduplicated against baseline, got %v", got)
+	}
+	// The conditional baseline grant must not swallow the unconditional generated one
+	if got := toStringSlice(merged.Statement[4].Action); !reflect.DeepEqual(got, []string{"sqs:SendMessage"}) {
+		t.Errorf("Expected sqs:SendMessage to be kept, got %v", got)
+	}
+
+	hcl := generateTerraformOutput(merged)
+	if !strings.Contains(hcl, `test     = "Null"`) || !strings.Contains(hcl, `effect = "Deny"`) {
+		t.Errorf("Expected Terraform output to carry conditions and deny effect:\n%s", hcl)
+	}
+}
+
+func TestIAMWildcardMatch(t *testing.T) {
+	tests := []struct {
+		pattern, value string
+		foldCase       bool
+		match          bool
+	}{
+		{"s3:Get*", "s3:GetObject", true, true},
+		{"S3:get*", "s3:GetObject", true, true},
+		{"s3:Get*", "s3:PutObject", true, false},
+		{"arn:aws:s3:::data/*", "arn:aws:s3:::data/logs/a.txt", false, true},
+		{"arn:aws:s3:::dat?", "arn:aws:s3:::data", false, true},
+		{"arn:aws:s3:::data", "arn:aws:s3:::DATA", false, false},
+	}
+
+	for _, tt := range tests {
+		if got := iamWildcardMatch(tt.pattern, tt.value, tt.foldCase); got != tt.match {
+			t.Errorf("iamWildcardMatch(%q, %q) = %v, want %v", tt.pattern, tt.value, got, tt.match)
+		}
+	}
+}
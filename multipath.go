@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+var mergeOutputFlag bool
+
+// parseTerraformRoots parses each root concurrently and returns the results
+// in the order of roots. The permissions DB must be loaded.
+func parseTerraformRoots(ctx context.Context, roots []string) ([]*ParseResult, error) {
+	results := make([]*ParseResult, len(roots))
+	errs := make([]error, len(roots))
+
+	var wg sync.WaitGroup
+	for i, root := range roots {
+		wg.Add(1)
+		go func(i int, root string) {
+			defer wg.Done()
+			results[i], errs[i] = parseTerraformFilesContext(ctx, root)
+		}(i, root)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return nil, &ParseError{Source: roots[i], Err: err}
+		}
+	}
+	return results, nil
+}
+
+// rootArtifactName names the artifacts of one of several --path roots after
+// the root, e.g. "stacks-app" for ./stacks/app and "root" for ".".
+func rootArtifactName(root string) string {
+	name := filepath.ToSlash(filepath.Clean(root))
+	for strings.HasPrefix(name, "../") {
+		name = strings.TrimPrefix(name, "../")
+	}
+	name = strings.Trim(name, "/")
+	if name == "" || name == ".." {
+		name = "."
+	}
+	return stackPolicyName(name)
+}
+
+// rootArtifactFile derives the file written for one root from a file named on
+// the command line: policy.json for ./stacks/app becomes
+// policy-stacks-app.json. An empty file stays empty.
+func rootArtifactFile(file, root string) string {
+	if file == "" {
+		return ""
+	}
+	ext := filepath.Ext(file)
+	return strings.TrimSuffix(file, ext) + "-" + rootArtifactName(root) + ext
+}
+
+// validateRootNames checks that no two roots would write the same artifacts.
+func validateRootNames(roots []string) error {
+	seen := make(map[string]string)
+	for _, root := range roots {
+		name := rootArtifactName(root)
+		if previous, ok := seen[name]; ok {
+			return validationErrorf("--path %s and %s would both write %s artifacts; use --merge-output or rename one", previous, root, name)
+		}
+		seen[name] = root
+	}
+	return nil
+}
+
+// runRoots scans several --path roots concurrently. With --merge-output their
+// results are unioned into one policy; otherwise every root gets its own
+// policy, report and exported scan, named after the root, or the policy by
+// --output-template.
+func runRoots(ctx context.Context, roots []string, format OutputFormat) error {
+	if !mergeOutputFlag {
+		if err := validateRootNames(roots); err != nil {
+			return err
+		}
+	}
+	if permissionsDB == nil {
+		if err := loadPermissionsDB(); err != nil {
+			return &DBError{Source: "the permissions DB", Err: err}
+		}
+	}
+
+	results, err := parseTerraformRoots(ctx, roots)
+	if err != nil {
+		return err
+	}
+	if ctx.Err() != nil {
+		exitIfCancelled(ctx, mergeParseResults(results, roots), strings.Join(roots, ", "))
+	}
+
+	if mergeOutputFlag {
+		result := mergeParseResults(results, roots)
+		statusf("Merged %d path(s)\n", len(roots))
+		exitIfDenied(scanResult(ctx, result, strings.Join(roots, ", "), format))
+		return nil
+	}
+
+	var templated []string
+	if outputTemplate != nil {
+		splits := make([]artifactFields, len(roots))
+		for i, root := range roots {
+			splits[i] = artifactFields{Stack: rootArtifactName(root)}
+		}
+		if templated, err = templateOutputs(splits, format); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+
+	denied := false
+	output, report, export, attest, workloads := outputFlag, reportFlag, exportScanFlag, attestFlag, workloadPoliciesFlag
+	for i, root := range roots {
+		statusf("==> %s\n", root)
+		outputFlag = rootArtifactFile(output, root)
+		if templated != nil {
+			outputFlag = templated[i]
+			if err := ensureOutputDir(outputFlag); err != nil {
+				return &OutputError{Path: outputFlag, Err: err}
+			}
+		}
+		reportFlag = rootArtifactFile(report, root)
+		exportScanFlag = rootArtifactFile(export, root)
+		attestFlag = rootArtifactFile(attest, root)
+		workloadPoliciesFlag = rootArtifactFile(workloads, root)
+		if scanResult(ctx, results[i], root, format) {
+			denied = true
+		}
+		statusf("\n")
+	}
+	exitIfDenied(denied)
+	return nil
+}
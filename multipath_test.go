@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func TestRootArtifactFile(t *testing.T) {
+	tests := []struct {
+		file, root, want string
+	}{
+		{"policy.json", "./stacks/app", "policy-stacks-app.json"},
+		{"out/policy.json", ".", "out/policy-root.json"},
+		{"report.json", "../network", "report-network.json"},
+		{"policy", "/srv/infra/", "policy-srv-infra"},
+		{"", "app", ""},
+	}
+	for _, tt := range tests {
+		if got := rootArtifactFile(tt.file, tt.root); got != tt.want {
+			t.Errorf("rootArtifactFile(%q, %q) = %q, want %q", tt.file, tt.root, got, tt.want)
+		}
+	}
+
+	if err := validateRootNames([]string{"./app", "app/"}); exitCode(err) != exitValidationFailed {
+		t.Errorf("Expected a validation error for roots writing the same artifacts, got %v", err)
+	}
+	if err := validateRootNames([]string{"stacks/app", "stacks/network"}); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestParseTerraformRoots(t *testing.T) {
+	if err := loadPermissionsDB(); err != nil {
+		t.Fatalf("Error loading permissions DB: %v", err)
+	}
+
+	dir := t.TempDir()
+	network := filepath.Join(dir, "network")
+	app := filepath.Join(dir, "app")
+	writeTestFile(t, filepath.Join(network, "main.tf"), `
+terraform {
+  backend "s3" {
+    bucket = "state"
+  }
+}
+
+resource "aws_vpc" "main" {
+  cidr_block = "10.0.0.0/16"
+}
+`)
+	writeTestFile(t, filepath.Join(app, "main.tf"), `
+terraform {
+  backend "gcs" {
+    bucket = "state"
+  }
+}
+
+resource "aws_sqs_queue" "jobs" {
+  name = "jobs"
+}
+`)
+
+	results, err := parseTerraformRoots(context.Background(), []string{network, app})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(results) != 2 || results[0].Resources[0].Type != "aws_vpc" || results[1].Resources[0].Type != "aws_sqs_queue" {
+		t.Fatalf("Results should follow the order of the roots: %+v", results)
+	}
+
+	merged := mergeParseResults(results, []string{network, app})
+	if len(merged.Resources) != 2 {
+		t.Errorf("Expected both roots' resources, got %d", len(merged.Resources))
+	}
+	if merged.Backend == nil || merged.Backend.Type != "s3" {
+		t.Errorf("Expected the first root's backend, got %+v", merged.Backend)
+	}
+	if len(merged.Backends) != 2 || merged.Backends[1].Type != "gcs" {
+		t.Errorf("Expected both roots' backends, got %+v", merged.Backends)
+	}
+}
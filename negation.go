@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Values accepted by --merge-negations.
+const (
+	NegationsWarn      = "warn"
+	NegationsRefuse    = "refuse"
+	NegationsNormalize = "normalize"
+)
+
+var mergeNegationsFlag = NegationsWarn
+
+// validateMergeNegations checks the --merge-negations value.
+func validateMergeNegations(value string) error {
+	switch value {
+	case NegationsWarn, NegationsRefuse, NegationsNormalize:
+		return nil
+	}
+	return fmt.Errorf("invalid --merge-negations %q. Valid values: %s, %s, %s", value, NegationsWarn, NegationsRefuse, NegationsNormalize)
+}
+
+// auditMergeNegations checks the NotAction and NotResource statements of a
+// baseline against the generated statements it is merged with. The merge is
+// a union, so a generated statement can grant exactly what an Allow with
+// NotAction or NotResource was written to exclude, and a Deny with them can
+// refuse generated actions. Such conflicts are errors; other negated Allow
+// statements are warnings, since they grant whatever is not listed.
+func auditMergeNegations(baseline, generated IAMPolicy) []LintFinding {
+	var findings []LintFinding
+	for i, statement := range baseline.Statement {
+		if statement.NotAction == nil && statement.NotResource == nil {
+			continue
+		}
+		add := func(severity, format string, args ...interface{}) {
+			findings = append(findings, LintFinding{
+				Statement: i,
+				Sid:       statement.Sid,
+				Severity:  severity,
+				Message:   fmt.Sprintf(format, args...),
+			})
+		}
+
+		conflicts := negationConflicts(statement, generated)
+		switch {
+		case len(conflicts) > 0 && statement.Effect == "Allow" && statement.NotAction != nil:
+			add(SeverityError, "Allow with NotAction excludes %s, but the generated statements grant them; the exclusion no longer holds",
+				strings.Join(conflicts, ", "))
+		case len(conflicts) > 0 && statement.Effect == "Allow":
+			add(SeverityError, "Allow with NotResource excludes resources that the generated statements grant %s on; the exclusion no longer holds",
+				strings.Join(conflicts, ", "))
+		case len(conflicts) > 0:
+			add(SeverityError, "Deny with NotAction or NotResource refuses generated actions %s; Terraform will fail with AccessDenied",
+				strings.Join(conflicts, ", "))
+		case statement.Effect == "Allow" && statement.NotAction != nil:
+			add(SeverityWarning, "Allow with NotAction grants every action not listed, including actions AWS adds later")
+		case statement.Effect == "Allow":
+			add(SeverityWarning, "Allow with NotResource grants every resource not listed")
+		}
+	}
+	return findings
+}
+
+// negationConflicts returns the generated Allow actions whose meaning is
+// changed by merging them with a negated baseline statement, sorted.
+//
+// For an Allow, these are the actions it excludes through NotAction, or the
+// actions it grants, granted by a generated statement on a resource it
+// excludes through NotResource. For a Deny, these are the actions it
+// refuses.
+func negationConflicts(statement IAMStatement, generated IAMPolicy) []string {
+	seen := make(map[string]bool)
+	for _, grant := range generated.Statement {
+		if grant.Effect != "Allow" || grant.NotAction != nil || grant.NotResource != nil {
+			continue
+		}
+		resources := toStringSlice(grant.Resource)
+		for _, action := range toStringSlice(grant.Action) {
+			matchesActions := statementMatchesAction(statement, action)
+			switch {
+			case statement.Effect == "Allow" && statement.NotAction != nil:
+				if !matchesActions && statementCoversResources(statement, resources) {
+					seen[action] = true
+				}
+			case statement.Effect == "Allow":
+				if matchesActions && resourcesOverlap(toStringSlice(statement.NotResource), resources) {
+					seen[action] = true
+				}
+			default:
+				if matchesActions && statementCoversResources(statement, resources) {
+					seen[action] = true
+				}
+			}
+		}
+	}
+	return sortedSet(seen)
+}
+
+// statementMatchesAction reports whether statement applies to action through
+// its Action or NotAction element.
+func statementMatchesAction(statement IAMStatement, action string) bool {
+	if statement.NotAction != nil {
+		return !matchesAny(toStringSlice(statement.NotAction), action, true)
+	}
+	return matchesAny(toStringSlice(statement.Action), action, true)
+}
+
+// statementCoversResources reports whether statement applies to any of
+// resources through its Resource or NotResource element.
+func statementCoversResources(statement IAMStatement, resources []string) bool {
+	if statement.NotResource != nil {
+		excluded := toStringSlice(statement.NotResource)
+		for _, resource := range resources {
+			if !matchesAny(excluded, resource, false) {
+				return true
+			}
+		}
+		return false
+	}
+	return resourcesOverlap(toStringSlice(statement.Resource), resources)
+}
+
+// resourcesOverlap reports whether any of resources matches one of patterns,
+// or is a pattern matching one of them: a generated "arn:aws:s3:::*" overlaps
+// a NotResource of "arn:aws:s3:::audit-logs".
+func resourcesOverlap(patterns, resources []string) bool {
+	for _, resource := range resources {
+		for _, pattern := range patterns {
+			if iamWildcardMatch(pattern, resource, false) || iamWildcardMatch(resource, pattern, false) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// normalizeNegations rewrites each Allow statement with NotAction and
+// Resource into an explicit Action list: the catalog actions NotAction does
+// not exclude, as a service wildcard for every service it leaves untouched.
+// Actions missing from the catalog of a partly excluded service are no
+// longer granted, which errs on the side of less access. Deny statements and
+// statements with NotResource cannot be rewritten without changing what they
+// allow or refuse and are kept; their indexes are returned.
+func normalizeNegations(policy IAMPolicy) (IAMPolicy, []int) {
+	if actionCatalog == nil {
+		_ = loadActionCatalog()
+	}
+
+	normalized := IAMPolicy{Version: policy.Version}
+	var kept []int
+	for i, statement := range policy.Statement {
+		if statement.NotAction == nil && statement.NotResource == nil {
+			normalized.Statement = append(normalized.Statement, statement)
+			continue
+		}
+		if statement.Effect != "Allow" || statement.NotResource != nil {
+			normalized.Statement = append(normalized.Statement, statement)
+			kept = append(kept, i)
+			continue
+		}
+
+		actions := complementActions(toStringSlice(statement.NotAction))
+		if len(actions) == 0 {
+			// NotAction "*" grants nothing
+			continue
+		}
+		statement.Action = actions
+		statement.NotAction = nil
+		normalized.Statement = append(normalized.Statement, statement)
+	}
+	return normalized, kept
+}
+
+// complementActions returns the catalog actions matching none of excluded,
+// sorted. A service that no pattern can match is returned as service:*.
+func complementActions(excluded []string) []string {
+	services := make([]string, 0, len(actionCatalog))
+	for service := range actionCatalog {
+		services = append(services, service)
+	}
+	sort.Strings(services)
+
+	var actions []string
+	for _, service := range services {
+		touched := false
+		for _, pattern := range excluded {
+			patternService, _, ok := strings.Cut(pattern, ":")
+			if pattern == "*" || (ok && iamWildcardMatch(patternService, service, true)) {
+				touched = true
+				break
+			}
+		}
+		if !touched {
+			actions = append(actions, service+":*")
+			continue
+		}
+		for _, action := range expandActionPattern(service + ":*") {
+			if !matchesAny(excluded, action, true) {
+				actions = append(actions, action)
+			}
+		}
+	}
+	return actions
+}
+
+// printMergeFindings prints the findings of auditMergeNegations for the
+// baseline in file, in the format of lint.
+func printMergeFindings(file string, findings []LintFinding) {
+	for _, finding := range findings {
+		fmt.Fprintf(os.Stderr, "%s: %s: %s: %s\n", file, findingLocation(finding), finding.Severity, finding.Message)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateMergeNegations(t *testing.T) {
+	for _, value := range []string{NegationsWarn, NegationsRefuse, NegationsNormalize} {
+		if err := validateMergeNegations(value); err != nil {
+			t.Errorf("Unexpected error for %s: %v", value, err)
+		}
+	}
+	if err := validateMergeNegations("ignore"); err == nil {
+		t.Errorf("Expected an error for an unknown value")
+	}
+}
+
+func TestAuditMergeNegations(t *testing.T) {
+	generated := IAMPolicy{
+		Version: "2012-10-17",
+		Statement: []IAMStatement{
+			{Effect: "Allow", Action: []string{"iam:CreateRole", "iam:PassRole"}, Resource: "arn:aws:iam::*:role/app-*"},
+			{Effect: "Allow", Action: []string{"s3:PutObject"}, Resource: "arn:aws:s3:::*/*"},
+		},
+	}
+	baseline := IAMPolicy{
+		Version: "2012-10-17",
+		Statement: []IAMStatement{
+			{Sid: "NoIAM", Effect: "Allow", NotAction: []string{"iam:*"}, Resource: "*"},
+			{Sid: "NotAudit", Effect: "Allow", Action: "s3:*", NotResource: "arn:aws:s3:::audit-logs/*"},
+			{Sid: "OnlyEC2", Effect: "Deny", NotAction: []string{"ec2:*", "s3:*"}, Resource: "*"},
+			{Sid: "NoKMS", Effect: "Allow", NotAction: []string{"kms:*"}, Resource: "*"},
+			{Sid: "Plain", Effect: "Allow", Action: "sqs:*", Resource: "*"},
+		},
+	}
+
+	findings := auditMergeNegations(baseline, generated)
+
+	expected := []struct {
+		statement int
+		severity  string
+		contains  string
+	}{
+		{0, SeverityError, "excludes iam:CreateRole, iam:PassRole"},
+		{1, SeverityError, "NotResource excludes resources that the generated statements grant s3:PutObject on"},
+		{2, SeverityError, "refuses generated actions iam:CreateRole, iam:PassRole"},
+		{3, SeverityWarning, "grants every action not listed"},
+	}
+	if len(findings) != len(expected) {
+		t.Fatalf("Expected %d findings, got %+v", len(expected), findings)
+	}
+	for i, want := range expected {
+		finding := findings[i]
+		if finding.Statement != want.statement || finding.Severity != want.severity || !strings.Contains(finding.Message, want.contains) {
+			t.Errorf("Expected %s on statement %d containing %q, got %+v", want.severity, want.statement, want.contains, finding)
+		}
+	}
+}
+
+func TestNormalizeNegations(t *testing.T) {
+	if err := loadActionCatalog(); err != nil {
+		t.Fatalf("Error loading action catalog: %v", err)
+	}
+
+	baseline := IAMPolicy{
+		Version: "2012-10-17",
+		Statement: []IAMStatement{
+			{Sid: "NoDelete", Effect: "Allow", NotAction: []string{"iam:*", "s3:Delete*"}, Resource: "*"},
+			{Sid: "OnlyEC2", Effect: "Deny", NotAction: "ec2:*", Resource: "*"},
+			{Sid: "NotAudit", Effect: "Allow", Action: "s3:*", NotResource: "arn:aws:s3:::audit-logs/*"},
+			{Sid: "Nothing", Effect: "Allow", NotAction: "*", Resource: "*"},
+		},
+	}
+
+	normalized, kept := normalizeNegations(baseline)
+
+	if len(kept) != 2 || kept[0] != 1 || kept[1] != 2 {
+		t.Errorf("Expected the Deny and NotResource statements to be kept, got %v", kept)
+	}
+	if len(normalized.Statement) != 3 {
+		t.Fatalf("Expected the NotAction \"*\" statement to be dropped, got %+v", normalized.Statement)
+	}
+
+	statement := normalized.Statement[0]
+	if statement.NotAction != nil {
+		t.Fatalf("Expected NotAction to be rewritten, got %+v", statement)
+	}
+	actions := toStringSlice(statement.Action)
+	for _, want := range []string{"ec2:*", "s3:GetObject", "s3:PutObject"} {
+		if !containsString(actions, want) {
+			t.Errorf("Expected %s in the rewritten actions", want)
+		}
+	}
+	for _, action := range actions {
+		if strings.HasPrefix(action, "iam:") || strings.HasPrefix(action, "s3:Delete") || action == "s3:*" {
+			t.Errorf("Excluded action %s is granted by the rewritten statement", action)
+		}
+	}
+
+	// The rewritten statement no longer conflicts in meaning with generated
+	// IAM actions; it simply does not grant them.
+	generated := IAMPolicy{Statement: []IAMStatement{{Effect: "Allow", Action: []string{"iam:CreateRole"}, Resource: "*"}}}
+	for _, finding := range auditMergeNegations(IAMPolicy{Statement: normalized.Statement[:1]}, generated) {
+		t.Errorf("Unexpected finding after normalization: %+v", finding)
+	}
+}
@@ -0,0 +1,633 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fetchOCIModulesFlag pulls oci:// module sources from their registry so the
+// modules are scanned like local ones.
+var fetchOCIModulesFlag bool
+
+const ociSourcePrefix = "oci://"
+
+// Media types of the manifests the scanner pulls, and the annotation ORAS
+// gives file layers.
+const (
+	ociManifestMediaType    = "application/vnd.oci.image.manifest.v1+json"
+	ociIndexMediaType       = "application/vnd.oci.image.index.v1+json"
+	dockerManifestMediaType = "application/vnd.docker.distribution.manifest.v2+json"
+	ociTitleAnnotation      = "org.opencontainers.image.title"
+)
+
+var ociDigestPattern = regexp.MustCompile(`^sha256:[a-f0-9]{64}$`)
+
+// ociHTTPClient talks to OCI registries.
+var ociHTTPClient = &http.Client{Timeout: 5 * time.Minute}
+
+// pulledOCIModules caches pulled modules by source for the run; roots are
+// scanned concurrently, so it is guarded by pulledOCIModulesMu.
+var (
+	pulledOCIModules   = make(map[string]pulledOCIModule)
+	pulledOCIModulesMu sync.Mutex
+)
+
+type pulledOCIModule struct {
+	dir string
+	err error
+}
+
+// ociReference is a parsed oci:// module source. Both the OpenTofu form,
+// oci://registry/repository?tag=v1 or ?digest=sha256:..., and the image
+// reference form, oci://registry/repository:v1 or @sha256:..., are accepted;
+// a //subdir selects a module within the artifact.
+type ociReference struct {
+	Registry   string
+	Repository string
+	Tag        string
+	Digest     string
+	Subdir     string
+}
+
+// isOCIModuleSource reports whether a module source is an oci:// artifact.
+func isOCIModuleSource(source string) bool {
+	return strings.HasPrefix(source, ociSourcePrefix)
+}
+
+// parseOCISource parses an oci:// module source. The tag defaults to latest.
+func parseOCISource(source string) (ociReference, error) {
+	var ref ociReference
+	rest, ok := strings.CutPrefix(source, ociSourcePrefix)
+	if !ok {
+		return ref, fmt.Errorf("%s is not an oci:// source", source)
+	}
+	rest, query, _ := strings.Cut(rest, "?")
+	if query != "" {
+		values, err := url.ParseQuery(query)
+		if err != nil {
+			return ref, fmt.Errorf("invalid query in %s: %w", source, err)
+		}
+		for key := range values {
+			if key != "tag" && key != "digest" {
+				return ref, fmt.Errorf("unknown argument %q in %s (expected tag or digest)", key, source)
+			}
+		}
+		ref.Tag, ref.Digest = values.Get("tag"), values.Get("digest")
+	}
+	rest, ref.Subdir, _ = strings.Cut(rest, "//")
+
+	ref.Registry, ref.Repository, _ = strings.Cut(rest, "/")
+	if ref.Registry == "" || ref.Repository == "" {
+		return ref, fmt.Errorf("%s does not name a registry and repository", source)
+	}
+	if repository, digest, ok := strings.Cut(ref.Repository, "@"); ok {
+		if ref.Digest != "" {
+			return ref, fmt.Errorf("%s gives the digest twice", source)
+		}
+		ref.Repository, ref.Digest = repository, digest
+	}
+	if slash := strings.LastIndex(ref.Repository, "/"); strings.Contains(ref.Repository[slash+1:], ":") {
+		colon := strings.LastIndex(ref.Repository, ":")
+		if ref.Tag != "" {
+			return ref, fmt.Errorf("%s gives the tag twice", source)
+		}
+		ref.Repository, ref.Tag = ref.Repository[:colon], ref.Repository[colon+1:]
+	}
+
+	if ref.Tag != "" && ref.Digest != "" {
+		return ref, fmt.Errorf("%s gives both a tag and a digest", source)
+	}
+	if ref.Digest != "" && !ociDigestPattern.MatchString(ref.Digest) {
+		return ref, fmt.Errorf("%s: digest %q is not a sha256 digest", source, ref.Digest)
+	}
+	if ref.Tag == "" && ref.Digest == "" {
+		ref.Tag = "latest"
+	}
+	return ref, nil
+}
+
+// String is the reference without the oci:// prefix and subdirectory.
+func (r ociReference) String() string {
+	if r.Digest != "" {
+		return r.Registry + "/" + r.Repository + "@" + r.Digest
+	}
+	return r.Registry + "/" + r.Repository + ":" + r.Tag
+}
+
+// baseURL is the registry's API endpoint. Docker Hub is served from
+// registry-1.docker.io; like docker, registries on the loopback interface are
+// spoken to over plain HTTP.
+func (r ociReference) baseURL() string {
+	host := r.Registry
+	if host == "docker.io" || host == "index.docker.io" {
+		host = "registry-1.docker.io"
+	}
+	hostname := host
+	if h, _, found := strings.Cut(strings.TrimPrefix(host, "["), "]"); found {
+		hostname = h
+	} else if h, _, found := strings.Cut(host, ":"); found {
+		hostname = h
+	}
+	if loopbackHost(hostname) {
+		return "http://" + host
+	}
+	return "https://" + host
+}
+
+// loopbackHost reports whether hostname is the loopback interface, where
+// plain HTTP is allowed.
+func loopbackHost(hostname string) bool {
+	return hostname == "localhost" || hostname == "127.0.0.1" || hostname == "::1"
+}
+
+// ociCredentials are the registry credentials found in the docker config.
+type ociCredentials struct {
+	Username      string
+	Password      string
+	IdentityToken string
+}
+
+// dockerConfig is the part of ~/.docker/config.json that holds credentials.
+type dockerConfig struct {
+	Auths map[string]struct {
+		Auth          string `json:"auth"`
+		IdentityToken string `json:"identitytoken"`
+	} `json:"auths"`
+	CredsStore  string            `json:"credsStore"`
+	CredHelpers map[string]string `json:"credHelpers"`
+}
+
+// dockerConfigPath is $DOCKER_CONFIG/config.json, or ~/.docker/config.json.
+func dockerConfigPath() string {
+	if dir := os.Getenv("DOCKER_CONFIG"); dir != "" {
+		return filepath.Join(dir, "config.json")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".docker", "config.json")
+}
+
+// registryCredentials looks registry up in the docker config as docker login
+// writes it: a credential helper for the registry, then the base64 auths
+// entry, then the credentials store. Without credentials the registry is
+// accessed anonymously.
+func registryCredentials(registry string) (ociCredentials, error) {
+	configPath := dockerConfigPath()
+	data, err := os.ReadFile(configPath)
+	if errors.Is(err, os.ErrNotExist) || configPath == "" {
+		return ociCredentials{}, nil
+	}
+	if err != nil {
+		return ociCredentials{}, err
+	}
+	var config dockerConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return ociCredentials{}, fmt.Errorf("error parsing %s: %w", configPath, err)
+	}
+
+	keys := []string{registry, "https://" + registry, "http://" + registry}
+	if registry == "docker.io" || registry == "index.docker.io" {
+		keys = []string{"https://index.docker.io/v1/", "index.docker.io", "docker.io"}
+	}
+	if helper := config.CredHelpers[registry]; helper != "" {
+		return credentialHelperCredentials(helper, keys[0])
+	}
+	for _, key := range keys {
+		entry, ok := config.Auths[key]
+		if !ok {
+			continue
+		}
+		if entry.IdentityToken != "" {
+			return ociCredentials{IdentityToken: entry.IdentityToken}, nil
+		}
+		if entry.Auth != "" {
+			decoded, err := base64.StdEncoding.DecodeString(entry.Auth)
+			if err != nil {
+				return ociCredentials{}, fmt.Errorf("error decoding the auth of %s in %s: %w", key, configPath, err)
+			}
+			username, password, _ := strings.Cut(string(decoded), ":")
+			return ociCredentials{Username: username, Password: password}, nil
+		}
+	}
+	if config.CredsStore != "" {
+		return credentialHelperCredentials(config.CredsStore, keys[0])
+	}
+	return ociCredentials{}, nil
+}
+
+// credentialHelperCredentials asks docker-credential-<helper> for the
+// credentials of server. A helper without them means anonymous access.
+func credentialHelperCredentials(helper, server string) (ociCredentials, error) {
+	cmd := exec.Command("docker-credential-"+helper, "get")
+	cmd.Stdin = strings.NewReader(server)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		if strings.Contains(string(output)+stderr.String(), "credentials not found") {
+			return ociCredentials{}, nil
+		}
+		return ociCredentials{}, fmt.Errorf("docker-credential-%s: %w", helper, err)
+	}
+	var credentials struct {
+		Username string
+		Secret   string
+	}
+	if err := json.Unmarshal(output, &credentials); err != nil {
+		return ociCredentials{}, fmt.Errorf("docker-credential-%s: %w", helper, err)
+	}
+	if credentials.Username == "<token>" {
+		return ociCredentials{IdentityToken: credentials.Secret}, nil
+	}
+	return ociCredentials{Username: credentials.Username, Password: credentials.Secret}, nil
+}
+
+// ociRegistry is a session with the registry of one reference. The
+// authorization a challenge asks for is obtained on the first 401 and
+// reused for the following requests.
+type ociRegistry struct {
+	ref           ociReference
+	credentials   ociCredentials
+	authorization string
+}
+
+// get fetches path of the registry API, authenticating as its challenge
+// asks.
+func (r *ociRegistry) get(ctx context.Context, path string, accept ...string) (*http.Response, error) {
+	send := func() (*http.Response, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.ref.baseURL()+path, nil)
+		if err != nil {
+			return nil, err
+		}
+		if len(accept) > 0 {
+			req.Header.Set("Accept", strings.Join(accept, ", "))
+		}
+		if r.authorization != "" {
+			req.Header.Set("Authorization", r.authorization)
+		}
+		return ociHTTPClient.Do(req)
+	}
+
+	resp, err := send()
+	if err != nil || resp.StatusCode != http.StatusUnauthorized || r.authorization != "" {
+		return resp, err
+	}
+	challenge := resp.Header.Get("WWW-Authenticate")
+	resp.Body.Close()
+	if r.authorization, err = r.authorize(ctx, challenge); err != nil {
+		return nil, err
+	}
+	return send()
+}
+
+// authorize answers a WWW-Authenticate challenge: Basic with the docker
+// credentials, or Bearer with a pull token from the challenge's realm.
+func (r *ociRegistry) authorize(ctx context.Context, challenge string) (string, error) {
+	scheme, params := parseAuthChallenge(challenge)
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if r.credentials.Username == "" {
+			return "", fmt.Errorf("%s requires credentials; log in with docker login or oras login", r.ref.Registry)
+		}
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(r.credentials.Username+":"+r.credentials.Password)), nil
+	case "bearer":
+	default:
+		return "", fmt.Errorf("%s: unsupported authentication challenge %q", r.ref.Registry, challenge)
+	}
+
+	realm := params["realm"]
+	if realm == "" {
+		return "", fmt.Errorf("%s: bearer challenge without a realm", r.ref.Registry)
+	}
+	scope := params["scope"]
+	if scope == "" {
+		scope = "repository:" + r.ref.Repository + ":pull"
+	}
+	form := url.Values{"scope": {scope}}
+	if service := params["service"]; service != "" {
+		form.Set("service", service)
+	}
+
+	var req *http.Request
+	var err error
+	if r.credentials.IdentityToken != "" {
+		form.Set("grant_type", "refresh_token")
+		form.Set("refresh_token", r.credentials.IdentityToken)
+		form.Set("client_id", "tf-iam-scanner")
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, realm, strings.NewReader(form.Encode()))
+		if err == nil {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+	} else {
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, realm+"?"+form.Encode(), nil)
+		if err == nil && r.credentials.Username != "" {
+			req.SetBasicAuth(r.credentials.Username, r.credentials.Password)
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	resp, err := ociHTTPClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error requesting a token from %s: %w", realm, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("error requesting a token from %s: %s", realm, resp.Status)
+	}
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("error reading the token from %s: %w", realm, err)
+	}
+	if token.Token == "" {
+		token.Token = token.AccessToken
+	}
+	return "Bearer " + token.Token, nil
+}
+
+// parseAuthChallenge splits a WWW-Authenticate header such as
+// Bearer realm="https://auth.example.com/token",service="registry" into its
+// scheme and parameters.
+func parseAuthChallenge(header string) (string, map[string]string) {
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(header), " ")
+	params := make(map[string]string)
+	for rest != "" {
+		var key string
+		key, rest, _ = strings.Cut(strings.TrimLeft(rest, " ,"), "=")
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				value, rest = rest[1:], ""
+			} else {
+				value, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+		}
+		if key = strings.ToLower(strings.TrimSpace(key)); key != "" {
+			params[key] = value
+		}
+	}
+	return scheme, params
+}
+
+// ociDescriptor describes a manifest layer.
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// ociManifest is an image manifest; module artifacts carry their files in
+// its layers.
+type ociManifest struct {
+	MediaType    string          `json:"mediaType"`
+	ArtifactType string          `json:"artifactType,omitempty"`
+	Layers       []ociDescriptor `json:"layers"`
+}
+
+// ociCacheDir holds pulled modules, one directory per manifest digest.
+func ociCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "tf-iam-scanner", "oci-modules")
+}
+
+// pullOCIModule returns the directory of the module at an oci:// source,
+// pulling the artifact into the cache unless a module with its manifest
+// digest is already there. Each source is pulled once per run.
+func pullOCIModule(ctx context.Context, source string) (string, error) {
+	pulledOCIModulesMu.Lock()
+	defer pulledOCIModulesMu.Unlock()
+	if pulled, ok := pulledOCIModules[source]; ok {
+		return pulled.dir, pulled.err
+	}
+	dir, err := pullOCIModuleSource(ctx, source)
+	if ctx.Err() == nil {
+		pulledOCIModules[source] = pulledOCIModule{dir: dir, err: err}
+	}
+	return dir, err
+}
+
+func pullOCIModuleSource(ctx context.Context, source string) (string, error) {
+	ref, err := parseOCISource(source)
+	if err != nil {
+		return "", err
+	}
+	credentials, err := registryCredentials(ref.Registry)
+	if err != nil {
+		return "", err
+	}
+	registry := &ociRegistry{ref: ref, credentials: credentials}
+
+	manifest, digest, err := registry.manifest(ctx)
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(ociCacheDir(), strings.TrimPrefix(digest, "sha256:"))
+	if _, err := os.Stat(dir); err != nil {
+		if err := registry.unpack(ctx, manifest, dir); err != nil {
+			return "", err
+		}
+	}
+
+	moduleDir := filepath.Join(dir, filepath.FromSlash(ref.Subdir))
+	if info, err := os.Stat(moduleDir); err != nil || !info.IsDir() {
+		return "", fmt.Errorf("%s has no directory %s", ref, ref.Subdir)
+	}
+	return moduleDir, nil
+}
+
+// manifest fetches the manifest of the reference and returns it with its
+// digest, checked against the reference's digest when it has one.
+func (r *ociRegistry) manifest(ctx context.Context) (ociManifest, string, error) {
+	var manifest ociManifest
+	reference := r.ref.Tag
+	if r.ref.Digest != "" {
+		reference = r.ref.Digest
+	}
+	resp, err := r.get(ctx, "/v2/"+r.ref.Repository+"/manifests/"+reference,
+		ociManifestMediaType, dockerManifestMediaType, ociIndexMediaType)
+	if err != nil {
+		return manifest, "", fmt.Errorf("error fetching the manifest of %s: %w", r.ref, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return manifest, "", fmt.Errorf("error fetching the manifest of %s: %s", r.ref, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return manifest, "", fmt.Errorf("error fetching the manifest of %s: %w", r.ref, err)
+	}
+
+	sum := sha256.Sum256(data)
+	digest := "sha256:" + hex.EncodeToString(sum[:])
+	if r.ref.Digest != "" && digest != r.ref.Digest {
+		return manifest, "", fmt.Errorf("the manifest of %s has digest %s", r.ref, digest)
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return manifest, "", fmt.Errorf("error parsing the manifest of %s: %w", r.ref, err)
+	}
+	if manifest.MediaType == "" {
+		manifest.MediaType = resp.Header.Get("Content-Type")
+	}
+	if manifest.MediaType == ociIndexMediaType {
+		return manifest, "", fmt.Errorf("%s is an image index, not a module artifact", r.ref)
+	}
+	if len(manifest.Layers) == 0 {
+		return manifest, "", fmt.Errorf("%s has no layers", r.ref)
+	}
+	return manifest, digest, nil
+}
+
+// unpack downloads the layers of manifest into dir. Archive layers (zip, as
+// OpenTofu packages modules, or tar and gzipped tar, as oras push packs
+// directories) are extracted; other layers are files named by their title
+// annotation. The module is assembled next to dir and renamed into place,
+// so an interrupted pull leaves nothing in the cache.
+func (r *ociRegistry) unpack(ctx context.Context, manifest ociManifest, dir string) error {
+	if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+		return err
+	}
+	staging, err := os.MkdirTemp(filepath.Dir(dir), ".pull-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(staging)
+
+	budget := int64(maxUnpackedSize)
+	for _, layer := range manifest.Layers {
+		blob, err := r.blob(ctx, layer)
+		if err != nil {
+			return err
+		}
+		err = unpackOCILayer(layer, blob, staging, &budget)
+		blob.Close()
+		os.Remove(blob.Name())
+		if err != nil {
+			return fmt.Errorf("error unpacking layer %s of %s: %w", layer.Digest, r.ref, err)
+		}
+	}
+
+	if err := os.Rename(staging, dir); err != nil {
+		// Another run pulled the same module meanwhile
+		if _, statErr := os.Stat(dir); statErr == nil {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// blob downloads a layer into a temporary file, checking its digest and
+// size.
+func (r *ociRegistry) blob(ctx context.Context, layer ociDescriptor) (*os.File, error) {
+	if !ociDigestPattern.MatchString(layer.Digest) {
+		return nil, fmt.Errorf("layer of %s has unsupported digest %q", r.ref, layer.Digest)
+	}
+	if layer.Size > maxUnpackedSize {
+		return nil, fmt.Errorf("layer %s of %s is larger than %d bytes", layer.Digest, r.ref, maxUnpackedSize)
+	}
+	resp, err := r.get(ctx, "/v2/"+r.ref.Repository+"/blobs/"+layer.Digest)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching layer %s of %s: %w", layer.Digest, r.ref, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error fetching layer %s of %s: %s", layer.Digest, r.ref, resp.Status)
+	}
+
+	file, err := os.CreateTemp("", "tf-iam-scanner-layer-")
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(file, hash), io.LimitReader(resp.Body, maxUnpackedSize+1))
+	if err == nil && n != layer.Size {
+		err = fmt.Errorf("layer %s of %s has %d bytes, not %d", layer.Digest, r.ref, n, layer.Size)
+	}
+	if err == nil && "sha256:"+hex.EncodeToString(hash.Sum(nil)) != layer.Digest {
+		err = fmt.Errorf("layer %s of %s does not match its digest", layer.Digest, r.ref)
+	}
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, err
+	}
+	return file, nil
+}
+
+// unpackOCILayer writes the content of a downloaded layer below dir,
+// charging the bytes written to budget.
+func unpackOCILayer(layer ociDescriptor, blob *os.File, dir string, budget *int64) error {
+	title := layer.Annotations[ociTitleAnnotation]
+	mediaType := strings.ToLower(layer.MediaType)
+	switch {
+	case strings.HasSuffix(mediaType, "tar+gzip") || strings.HasSuffix(mediaType, ".tar.gzip") ||
+		strings.HasSuffix(title, ".tar.gz") || strings.HasSuffix(title, ".tgz"):
+		gz, err := gzip.NewReader(blob)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		return extractTar(gz, dir, budget)
+	case strings.HasSuffix(mediaType, ".tar") || strings.HasSuffix(mediaType, "+tar") || strings.HasSuffix(title, ".tar"):
+		return extractTar(blob, dir, budget)
+	case strings.HasSuffix(mediaType, "/zip") || strings.HasSuffix(mediaType, "+zip") || strings.HasSuffix(title, ".zip"):
+		info, err := blob.Stat()
+		if err != nil {
+			return err
+		}
+		return extractZip(blob, info.Size(), dir, budget)
+	case title != "":
+		return writeUnpackedFile(dir, title, blob, budget)
+	}
+	return fmt.Errorf("layer of media type %s is not an archive and has no %s annotation", layer.MediaType, ociTitleAnnotation)
+}
+
+// scanOCIModule scans the module of an oci:// module call, pulling it with
+// --fetch-oci-modules. Failures are parse warnings, like unreadable files.
+func scanOCIModule(ctx context.Context, call ModuleCall, result *ParseResult, visited map[string]bool) {
+	if !fetchOCIModulesFlag {
+		result.Warnings = append(result.Warnings,
+			fmt.Sprintf("%s: %s is not scanned; use --fetch-oci-modules to pull it", call.Address, call.Source))
+		return
+	}
+	dir, err := pullOCIModule(ctx, call.Source)
+	if err != nil {
+		if ctx.Err() == nil {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("%s: pulling %s: %v", call.Address, call.Source, err))
+		}
+		return
+	}
+	scanDir(ctx, dir, call.Address+".", result, visited)
+}
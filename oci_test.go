@@ -0,0 +1,271 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestParseOCISource(t *testing.T) {
+	digest := "sha256:" + strings.Repeat("ab", 32)
+	tests := []struct {
+		source string
+		want   ociReference
+	}{
+		{"oci://ghcr.io/acme/modules/vpc", ociReference{Registry: "ghcr.io", Repository: "acme/modules/vpc", Tag: "latest"}},
+		{"oci://ghcr.io/acme/vpc:1.2.0", ociReference{Registry: "ghcr.io", Repository: "acme/vpc", Tag: "1.2.0"}},
+		{"oci://localhost:5000/acme/vpc?tag=v1", ociReference{Registry: "localhost:5000", Repository: "acme/vpc", Tag: "v1"}},
+		{"oci://example.com/vpc@" + digest, ociReference{Registry: "example.com", Repository: "vpc", Digest: digest}},
+		{"oci://example.com/network//modules/vpc?digest=" + digest, ociReference{Registry: "example.com", Repository: "network", Digest: digest, Subdir: "modules/vpc"}},
+	}
+	for _, tt := range tests {
+		got, err := parseOCISource(tt.source)
+		if err != nil {
+			t.Errorf("parseOCISource(%q): %v", tt.source, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseOCISource(%q) = %+v, want %+v", tt.source, got, tt.want)
+		}
+	}
+
+	for _, source := range []string{
+		"oci://ghcr.io",
+		"oci://ghcr.io/acme/vpc:v1?tag=v2",
+		"oci://ghcr.io/acme/vpc?tag=v1&digest=" + digest,
+		"oci://ghcr.io/acme/vpc@sha256:1234",
+		"oci://ghcr.io/acme/vpc?ref=v1",
+	} {
+		if _, err := parseOCISource(source); err == nil {
+			t.Errorf("parseOCISource(%q): expected an error", source)
+		}
+	}
+}
+
+func TestParseAuthChallenge(t *testing.T) {
+	scheme, params := parseAuthChallenge(`Bearer realm="https://ghcr.io/token",service="ghcr.io",scope="repository:acme/vpc:pull,push"`)
+	if scheme != "Bearer" || params["realm"] != "https://ghcr.io/token" || params["service"] != "ghcr.io" || params["scope"] != "repository:acme/vpc:pull,push" {
+		t.Errorf("parseAuthChallenge() = %s %v", scheme, params)
+	}
+}
+
+func TestRegistryCredentials(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("DOCKER_CONFIG", dir)
+	config := `{"auths": {
+		"ghcr.io": {"auth": "` + base64.StdEncoding.EncodeToString([]byte("ci:s3cr:et")) + `"},
+		"https://index.docker.io/v1/": {"identitytoken": "refresh"}
+	}}`
+	if err := os.WriteFile(filepath.Join(dir, "config.json"), []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]ociCredentials{
+		"ghcr.io":         {Username: "ci", Password: "s3cr:et"},
+		"docker.io":       {IdentityToken: "refresh"},
+		"quay.io":         {},
+		"registry.gitlab": {},
+	}
+	for registry, want := range tests {
+		got, err := registryCredentials(registry)
+		if err != nil {
+			t.Errorf("registryCredentials(%s): %v", registry, err)
+		} else if got != want {
+			t.Errorf("registryCredentials(%s) = %+v, want %+v", registry, got, want)
+		}
+	}
+}
+
+// fakeRegistry serves artifacts by repository and reference behind a bearer
+// token issued for the basic credentials ci:secret, and counts blob pulls.
+type fakeRegistry struct {
+	manifests map[string][]byte // repository:reference
+	blobs     map[string][]byte
+	mu        sync.Mutex
+	blobPulls int
+}
+
+func (f *fakeRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/token" {
+		if user, password, ok := r.BasicAuth(); !ok || user != "ci" || password != "secret" || r.URL.Query().Get("scope") != "repository:acme/store:pull" {
+			http.Error(w, "denied", http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"token": "pull-token"})
+		return
+	}
+	if r.Header.Get("Authorization") != "Bearer pull-token" {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="http://`+r.Host+`/token",service="fake"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	repository, reference, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, "/v2/"), "/manifests/")
+	if ok {
+		manifest, found := f.manifests[repository+":"+reference]
+		if !found {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", ociManifestMediaType)
+		w.Write(manifest)
+		return
+	}
+	if _, digest, ok := strings.Cut(r.URL.Path, "/blobs/"); ok {
+		f.mu.Lock()
+		f.blobPulls++
+		f.mu.Unlock()
+		w.Write(f.blobs[digest])
+		return
+	}
+	http.NotFound(w, r)
+}
+
+// push stores an artifact with the given layers under each reference and
+// returns its manifest digest.
+func (f *fakeRegistry) push(t *testing.T, repository string, layers []ociDescriptor, contents [][]byte, references ...string) string {
+	t.Helper()
+	for i := range layers {
+		sum := sha256.Sum256(contents[i])
+		layers[i].Digest = "sha256:" + hex.EncodeToString(sum[:])
+		layers[i].Size = int64(len(contents[i]))
+		f.blobs[layers[i].Digest] = contents[i]
+	}
+	manifest, err := json.Marshal(ociManifest{MediaType: ociManifestMediaType, Layers: layers})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(manifest)
+	digest := "sha256:" + hex.EncodeToString(sum[:])
+	for _, reference := range append(references, digest) {
+		f.manifests[repository+":"+reference] = manifest
+	}
+	return digest
+}
+
+func tarGz(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	archive := tar.NewWriter(gz)
+	for name, content := range files {
+		if err := archive.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		archive.Write([]byte(content))
+	}
+	archive.Close()
+	gz.Close()
+	return buf.Bytes()
+}
+
+func zipped(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := archive.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	archive.Close()
+	return buf.Bytes()
+}
+
+func TestScanOCIModules(t *testing.T) {
+	if err := loadPermissionsDB(); err != nil {
+		t.Fatalf("Error loading permissions DB: %v", err)
+	}
+	registry := &fakeRegistry{manifests: map[string][]byte{}, blobs: map[string][]byte{}}
+	server := httptest.NewServer(registry)
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	// An oras push of a directory, and an OpenTofu module package
+	registry.push(t, "acme/store", []ociDescriptor{{
+		MediaType:   "application/vnd.oci.image.layer.v1.tar+gzip",
+		Annotations: map[string]string{ociTitleAnnotation: "store.tar.gz"},
+	}}, [][]byte{tarGz(t, map[string]string{
+		"main.tf":               `resource "aws_s3_bucket" "this" {}` + "\n" + `module "queue" { source = "./modules/queue" }`,
+		"modules/queue/main.tf": `resource "aws_sqs_queue" "this" {}`,
+	})}, "v1")
+	digest := registry.push(t, "acme/store", []ociDescriptor{{MediaType: "archive/zip"}},
+		[][]byte{zipped(t, map[string]string{"dynamodb/main.tf": `resource "aws_dynamodb_table" "this" {}`})})
+
+	dir := t.TempDir()
+	root := `module "store" { source = "oci://` + host + `/acme/store:v1" }
+module "tables" { source = "oci://` + host + `/acme/store//dynamodb?digest=` + digest + `" }
+`
+	if err := os.WriteFile(filepath.Join(dir, "main.tf"), []byte(root), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dockerConfig := t.TempDir()
+	t.Setenv("DOCKER_CONFIG", dockerConfig)
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	auth := base64.StdEncoding.EncodeToString([]byte("ci:secret"))
+	if err := os.WriteFile(filepath.Join(dockerConfig, "config.json"), []byte(`{"auths":{"`+host+`":{"auth":"`+auth+`"}}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := parseTerraformFiles(dir)
+	if err != nil {
+		t.Fatalf("parseTerraformFiles: %v", err)
+	}
+	if len(result.Warnings) != 2 || !strings.Contains(result.Warnings[0], "use --fetch-oci-modules") {
+		t.Errorf("Expected a warning per module without --fetch-oci-modules, got %v", result.Warnings)
+	}
+
+	fetchOCIModulesFlag = true
+	defer func() {
+		fetchOCIModulesFlag = false
+		pulledOCIModules = make(map[string]pulledOCIModule)
+	}()
+	result, err = parseTerraformFiles(dir)
+	if err != nil {
+		t.Fatalf("parseTerraformFiles: %v", err)
+	}
+	if len(result.Warnings) != 0 {
+		t.Errorf("Unexpected warnings: %v", result.Warnings)
+	}
+	var addresses []string
+	for _, r := range result.Resources {
+		addresses = append(addresses, resourceAddress(r))
+	}
+	want := []string{"module.store.aws_s3_bucket.this", "module.store.module.queue.aws_sqs_queue.this", "module.tables.aws_dynamodb_table.this"}
+	for _, address := range want {
+		if !containsString(addresses, address) {
+			t.Errorf("Expected %s in %v", address, addresses)
+		}
+	}
+
+	// A new run finds the modules in the cache by manifest digest
+	pulledOCIModules = make(map[string]pulledOCIModule)
+	pulls := registry.blobPulls
+	if _, err := parseTerraformFiles(dir); err != nil {
+		t.Fatalf("parseTerraformFiles: %v", err)
+	}
+	if registry.blobPulls != pulls {
+		t.Errorf("Expected cached modules not to be pulled again, got %d more blob pulls", registry.blobPulls-pulls)
+	}
+
+	// Without credentials the token request is denied
+	pulledOCIModules = make(map[string]pulledOCIModule)
+	t.Setenv("DOCKER_CONFIG", t.TempDir())
+	result, _ = parseTerraformFiles(dir)
+	if len(result.Warnings) != 2 || !strings.Contains(result.Warnings[0], "401 Unauthorized") {
+		t.Errorf("Expected a warning per module that cannot be pulled, got %v", result.Warnings)
+	}
+}
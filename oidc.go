@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// CI systems whose OIDC tokens a role can trust, set with --oidc-github,
+// --oidc-gitlab (and --oidc-gitlab-url for self-managed GitLab) and
+// --oidc-circleci.
+var (
+	oidcGitHubFlag    string
+	oidcGitLabFlag    string
+	oidcGitLabURLFlag string
+	oidcCircleCIFlag  string
+)
+
+// defaultGitLabURL is the issuer of GitLab.com's ID tokens.
+const defaultGitLabURL = "https://gitlab.com"
+
+// trustPolicySuffix replaces the extension of the --output file to name the
+// trust policy written next to it.
+const trustPolicySuffix = ".trust.json"
+
+// oidcRoleName names the role of the Terraform output's OIDC role template.
+const oidcRoleName = "tf-iam-scanner-ci"
+
+// accountPlaceholder stands for the account ID in a JSON trust policy when
+// --template-vars gives no placeholder of its own.
+const accountPlaceholder = "ACCOUNT_ID"
+
+var (
+	gitHubRepoPattern    = regexp.MustCompile(`^[A-Za-z0-9-]+/[A-Za-z0-9._*-]+$`)
+	gitLabProjectPattern = regexp.MustCompile(`^[A-Za-z0-9._-]+(/[A-Za-z0-9._-]+)+$`)
+	circleCIOrgPattern   = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+)
+
+// oidcProvider is the OIDC federation setup of one CI system: the issuer
+// URL of its tokens (the IAM OIDC provider's URL), the audience they carry
+// and the pattern their subject must match.
+type oidcProvider struct {
+	Name     string // GitHub, GitLab or CircleCI; names the Sid and Terraform labels
+	URL      string
+	Audience string
+	Subject  string
+}
+
+// host is the issuer URL without its scheme, which names the IAM OIDC
+// provider and prefixes its condition keys.
+func (p oidcProvider) host() string {
+	return strings.TrimPrefix(p.URL, "https://")
+}
+
+// TrustPolicy is a role trust policy. Its statements name a principal,
+// which permission policy statements cannot.
+type TrustPolicy struct {
+	Version   string           `json:"Version"`
+	Statement []TrustStatement `json:"Statement"`
+}
+
+// TrustStatement is a statement of a TrustPolicy.
+type TrustStatement struct {
+	Sid       string                            `json:"Sid,omitempty"`
+	Effect    string                            `json:"Effect"`
+	Principal map[string]string                 `json:"Principal"`
+	Action    string                            `json:"Action"`
+	Condition map[string]map[string]interface{} `json:"Condition"`
+}
+
+// validateOIDCFlags checks the --oidc-* values and that the output they go
+// with can carry a trust policy.
+func validateOIDCFlags(format OutputFormat) error {
+	if oidcGitHubFlag != "" && !gitHubRepoPattern.MatchString(oidcGitHubFlag) {
+		return fmt.Errorf("invalid --oidc-github %q: expected owner/repo", oidcGitHubFlag)
+	}
+	if oidcGitLabFlag != "" && !gitLabProjectPattern.MatchString(oidcGitLabFlag) {
+		return fmt.Errorf("invalid --oidc-gitlab %q: expected group/project (with any subgroups)", oidcGitLabFlag)
+	}
+	if oidcGitLabURLFlag != defaultGitLabURL {
+		if oidcGitLabFlag == "" {
+			return fmt.Errorf("--oidc-gitlab-url needs --oidc-gitlab")
+		}
+		if u, err := url.Parse(oidcGitLabURLFlag); err != nil || u.Scheme != "https" || u.Host == "" {
+			return fmt.Errorf("invalid --oidc-gitlab-url %q: expected the https:// URL of the GitLab instance", oidcGitLabURLFlag)
+		}
+	}
+	if oidcCircleCIFlag != "" && !circleCIOrgPattern.MatchString(oidcCircleCIFlag) {
+		return fmt.Errorf("invalid --oidc-circleci %q: expected the organization ID (a UUID, under Organization Settings)", oidcCircleCIFlag)
+	}
+	if len(oidcProviders()) > 0 && format == FormatTerraform && attachToRoleFlag != "" {
+		return fmt.Errorf("--oidc-* cannot be combined with --attach-to-role: the existing role keeps its own trust policy")
+	}
+	return nil
+}
+
+// oidcProviders returns the CI systems given with --oidc-* flags.
+func oidcProviders() []oidcProvider {
+	var providers []oidcProvider
+	if oidcGitHubFlag != "" {
+		providers = append(providers, oidcProvider{
+			Name:     "GitHub",
+			URL:      "https://token.actions.githubusercontent.com",
+			Audience: "sts.amazonaws.com",
+			Subject:  "repo:" + oidcGitHubFlag + ":*",
+		})
+	}
+	if oidcGitLabFlag != "" {
+		issuer := strings.TrimSuffix(oidcGitLabURLFlag, "/")
+		providers = append(providers, oidcProvider{
+			Name:     "GitLab",
+			URL:      issuer,
+			Audience: issuer,
+			Subject:  "project_path:" + oidcGitLabFlag + ":*",
+		})
+	}
+	if oidcCircleCIFlag != "" {
+		providers = append(providers, oidcProvider{
+			Name:     "CircleCI",
+			URL:      "https://oidc.circleci.com/org/" + oidcCircleCIFlag,
+			Audience: oidcCircleCIFlag,
+			Subject:  "org/" + oidcCircleCIFlag + "/project/*/user/*",
+		})
+	}
+	return providers
+}
+
+// oidcConditions returns the audience and subject conditions of provider's
+// trust statement.
+func oidcConditions(provider oidcProvider) map[string]map[string]interface{} {
+	return map[string]map[string]interface{}{
+		"StringEquals": {provider.host() + ":aud": provider.Audience},
+		"StringLike":   {provider.host() + ":sub": provider.Subject},
+	}
+}
+
+// buildTrustPolicy returns the trust policy letting the CI jobs of providers
+// assume the role with their OIDC tokens, one statement per provider. The
+// IAM OIDC providers are in account.
+func buildTrustPolicy(providers []oidcProvider, account string) TrustPolicy {
+	policy := TrustPolicy{Version: defaultPolicyVersion}
+	for _, provider := range providers {
+		policy.Statement = append(policy.Statement, TrustStatement{
+			Sid:    provider.Name + "OIDC",
+			Effect: "Allow",
+			Principal: map[string]string{
+				"Federated": fmt.Sprintf("arn:%s:iam::%s:oidc-provider/%s", defaultARNContext.Partition, account, provider.host()),
+			},
+			Action:    "sts:AssumeRoleWithWebIdentity",
+			Condition: oidcConditions(provider),
+		})
+	}
+	return policy
+}
+
+// trustPolicyFile returns the path of the trust policy written next to the
+// policy output file.
+func trustPolicyFile(output string) string {
+	return strings.TrimSuffix(output, filepath.Ext(output)) + trustPolicySuffix
+}
+
+// writeTrustPolicy writes the trust policy for the --oidc-* CI systems next
+// to the policy written to output. The Terraform output carries its own
+// role template instead, and a policy printed to stdout gets none.
+func writeTrustPolicy(output string, format OutputFormat) {
+	providers := oidcProviders()
+	if len(providers) == 0 || format == FormatTerraform {
+		return
+	}
+	if output == "" {
+		fmt.Fprintf(os.Stderr, "Warning: --oidc-* writes the trust policy next to the --output file; none written for stdout\n")
+		return
+	}
+	account := defaultARNContext.Account
+	if account == "*" {
+		account = accountPlaceholder
+		fmt.Fprintf(os.Stderr, "Warning: replace %s in the trust policy with the ID of the account holding the IAM OIDC providers\n", accountPlaceholder)
+	}
+	data, err := json.MarshalIndent(buildTrustPolicy(providers, account), "", "  ")
+	path := trustPolicyFile(output)
+	if err != nil {
+		exitWithError(&OutputError{Path: path, Err: fmt.Errorf("error marshaling trust policy: %w", err)})
+	}
+	if err := writeOutputFile(path, append(data, '\n'), outputMode, forceFlag); err != nil {
+		exitWithError(&OutputError{Path: path, Err: err})
+	}
+	statusf("Trust policy written to: %s\n", path)
+}
+
+// terraformOIDCRole renders the Terraform role template for providers: a
+// data source per IAM OIDC provider, the trust policy document, and unless
+// documentOnly a role attached to the generated managed policy.
+func terraformOIDCRole(providers []oidcProvider, documentOnly bool) string {
+	var sb strings.Builder
+	for _, provider := range providers {
+		fmt.Fprintf(&sb, "\ndata \"aws_iam_openid_connect_provider\" \"%s\" {\n", strings.ToLower(provider.Name))
+		fmt.Fprintf(&sb, "  url = \"%s\"\n", provider.URL)
+		sb.WriteString("}\n")
+	}
+
+	sb.WriteString("\ndata \"aws_iam_policy_document\" \"trust\" {\n")
+	for i, provider := range providers {
+		sb.WriteString("  statement {\n")
+		fmt.Fprintf(&sb, "    sid     = \"%sOIDC\"\n", provider.Name)
+		sb.WriteString("    effect  = \"Allow\"\n")
+		sb.WriteString("    actions = [\"sts:AssumeRoleWithWebIdentity\"]\n")
+		sb.WriteString("    principals {\n")
+		sb.WriteString("      type        = \"Federated\"\n")
+		fmt.Fprintf(&sb, "      identifiers = [data.aws_iam_openid_connect_provider.%s.arn]\n", strings.ToLower(provider.Name))
+		sb.WriteString("    }\n")
+		writeTerraformConditions(&sb, oidcConditions(provider))
+		sb.WriteString("  }\n")
+		if i < len(providers)-1 {
+			sb.WriteString("\n")
+		}
+	}
+	sb.WriteString("}\n")
+	if documentOnly {
+		return sb.String()
+	}
+
+	sb.WriteString("\nresource \"aws_iam_role\" \"ci\" {\n")
+	fmt.Fprintf(&sb, "  name               = \"%s\"\n", oidcRoleName)
+	sb.WriteString("  assume_role_policy = data.aws_iam_policy_document.trust.json\n")
+	sb.WriteString("}\n")
+	sb.WriteString("\nresource \"aws_iam_role_policy_attachment\" \"ci\" {\n")
+	sb.WriteString("  role       = aws_iam_role.ci.name\n")
+	sb.WriteString("  policy_arn = aws_iam_policy.generated.arn\n")
+	sb.WriteString("}\n")
+	return sb.String()
+}
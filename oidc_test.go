@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testCircleCIOrg = "8a3e5f4c-1b2d-4e6f-9a0b-1c2d3e4f5a6b"
+
+func setOIDCFlags(t *testing.T, github, gitlab, gitlabURL, circleci string) {
+	t.Helper()
+	saved := []string{oidcGitHubFlag, oidcGitLabFlag, oidcGitLabURLFlag, oidcCircleCIFlag}
+	t.Cleanup(func() {
+		oidcGitHubFlag, oidcGitLabFlag, oidcGitLabURLFlag, oidcCircleCIFlag = saved[0], saved[1], saved[2], saved[3]
+	})
+	oidcGitHubFlag, oidcGitLabFlag, oidcGitLabURLFlag, oidcCircleCIFlag = github, gitlab, gitlabURL, circleci
+}
+
+func TestValidateOIDCFlags(t *testing.T) {
+	tests := []struct {
+		name                              string
+		github, gitlab, gitlabURL, circle string
+		wantErr                           string
+	}{
+		{name: "none", gitlabURL: defaultGitLabURL},
+		{name: "gitlab subgroup", gitlab: "platform/infra/network", gitlabURL: defaultGitLabURL},
+		{name: "self-managed gitlab", gitlab: "platform/infra", gitlabURL: "https://gitlab.example.com"},
+		{name: "circleci", circle: testCircleCIOrg, gitlabURL: defaultGitLabURL},
+		{name: "github", github: "acme/infra", gitlabURL: defaultGitLabURL},
+		{name: "gitlab without project", gitlab: "platform", gitlabURL: defaultGitLabURL, wantErr: "expected group/project"},
+		{name: "gitlab url without project", gitlabURL: "https://gitlab.example.com", wantErr: "needs --oidc-gitlab"},
+		{name: "gitlab url over http", gitlab: "platform/infra", gitlabURL: "http://gitlab.example.com", wantErr: "https:// URL"},
+		{name: "circleci slug", circle: "gh/acme", gitlabURL: defaultGitLabURL, wantErr: "organization ID"},
+		{name: "github without repo", github: "acme", gitlabURL: defaultGitLabURL, wantErr: "owner/repo"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setOIDCFlags(t, tt.github, tt.gitlab, tt.gitlabURL, tt.circle)
+			err := validateOIDCFlags(FormatJSON)
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("Expected an error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	setOIDCFlags(t, "", "platform/infra", defaultGitLabURL, "")
+	attachToRoleFlag = "deployer"
+	defer func() { attachToRoleFlag = "" }()
+	if err := validateOIDCFlags(FormatTerraform); err == nil || !strings.Contains(err.Error(), "--attach-to-role") {
+		t.Errorf("Expected --attach-to-role to be refused, got %v", err)
+	}
+}
+
+func TestBuildTrustPolicy(t *testing.T) {
+	setOIDCFlags(t, "", "platform/infra", "https://gitlab.example.com/", testCircleCIOrg)
+	policy := buildTrustPolicy(oidcProviders(), "123456789012")
+	if len(policy.Statement) != 2 {
+		t.Fatalf("Expected a statement per CI system, got %+v", policy.Statement)
+	}
+
+	gitlab := policy.Statement[0]
+	if gitlab.Sid != "GitLabOIDC" || gitlab.Action != "sts:AssumeRoleWithWebIdentity" ||
+		gitlab.Principal["Federated"] != "arn:aws:iam::123456789012:oidc-provider/gitlab.example.com" {
+		t.Errorf("Unexpected GitLab statement: %+v", gitlab)
+	}
+	if gitlab.Condition["StringEquals"]["gitlab.example.com:aud"] != "https://gitlab.example.com" ||
+		gitlab.Condition["StringLike"]["gitlab.example.com:sub"] != "project_path:platform/infra:*" {
+		t.Errorf("Unexpected GitLab conditions: %+v", gitlab.Condition)
+	}
+
+	circleci := policy.Statement[1]
+	host := "oidc.circleci.com/org/" + testCircleCIOrg
+	if circleci.Principal["Federated"] != "arn:aws:iam::123456789012:oidc-provider/"+host {
+		t.Errorf("Unexpected CircleCI principal: %+v", circleci.Principal)
+	}
+	if circleci.Condition["StringEquals"][host+":aud"] != testCircleCIOrg ||
+		circleci.Condition["StringLike"][host+":sub"] != "org/"+testCircleCIOrg+"/project/*/user/*" {
+		t.Errorf("Unexpected CircleCI conditions: %+v", circleci.Condition)
+	}
+}
+
+func TestTerraformOIDCRole(t *testing.T) {
+	setOIDCFlags(t, "", "platform/infra", defaultGitLabURL, testCircleCIOrg)
+	output := terraformOIDCRole(oidcProviders(), false)
+	for _, want := range []string{
+		"data \"aws_iam_openid_connect_provider\" \"gitlab\" {\n  url = \"https://gitlab.com\"\n}",
+		"data \"aws_iam_openid_connect_provider\" \"circleci\"",
+		"identifiers = [data.aws_iam_openid_connect_provider.gitlab.arn]",
+		"variable = \"gitlab.com:aud\"",
+		"values   = [\"project_path:platform/infra:*\"]",
+		"assume_role_policy = data.aws_iam_policy_document.trust.json",
+		"policy_arn = aws_iam_policy.generated.arn",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Expected %q in the role template:\n%s", want, output)
+		}
+	}
+
+	documentOnly := terraformOIDCRole(oidcProviders(), true)
+	if strings.Contains(documentOnly, "aws_iam_role") || !strings.Contains(documentOnly, "data \"aws_iam_policy_document\" \"trust\"") {
+		t.Errorf("Expected only the trust document with --document-only:\n%s", documentOnly)
+	}
+}
+
+func TestWriteTrustPolicy(t *testing.T) {
+	defer func() { oidcGitLabFlag = "" }()
+	output := filepath.Join(t.TempDir(), "policy.json")
+	_, stderr := runRootCommand(t, "--path", "test-fixtures/simple", "--output", output, "--oidc-gitlab", "platform/infra")
+
+	data, err := os.ReadFile(filepath.Join(filepath.Dir(output), "policy.trust.json"))
+	if err != nil {
+		t.Fatalf("Expected the trust policy next to the output: %v", err)
+	}
+	var policy TrustPolicy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		t.Fatalf("Invalid trust policy: %v", err)
+	}
+	if len(policy.Statement) != 1 || policy.Statement[0].Principal["Federated"] != "arn:aws:iam::ACCOUNT_ID:oidc-provider/gitlab.com" {
+		t.Errorf("Unexpected trust policy: %s", data)
+	}
+	if !strings.Contains(stderr, "replace ACCOUNT_ID") {
+		t.Errorf("Expected a warning about the account placeholder, got %q", stderr)
+	}
+}
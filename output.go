@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// parseFileMode parses an octal permission string such as "0600".
+func parseFileMode(mode string) (os.FileMode, error) {
+	value, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil || value > 0777 {
+		return 0, fmt.Errorf("invalid --mode %q: expected octal permissions such as 0600", mode)
+	}
+	return os.FileMode(value), nil
+}
+
+// writeOutputFile writes data to filePath atomically: the content goes to a
+// temporary file in the same directory, which is renamed over the target only
+// once it is complete. An existing file is only replaced when force is set.
+// Devices and pipes such as /dev/stdout are written to directly, and a
+// symlinked target is replaced at the path it points to.
+func writeOutputFile(filePath string, data []byte, perm os.FileMode, force bool) error {
+	info, err := os.Stat(filePath)
+	switch {
+	case err == nil && !info.Mode().IsRegular():
+		if err := os.WriteFile(filePath, data, perm); err != nil {
+			return fmt.Errorf("error writing %s: %w", filePath, err)
+		}
+		return nil
+	case err == nil && !force:
+		return fmt.Errorf("%s already exists (use --force to overwrite)", filePath)
+	case err == nil:
+		if resolved, err := filepath.EvalSymlinks(filePath); err == nil {
+			filePath = resolved
+		}
+	case !errors.Is(err, fs.ErrNotExist):
+		return fmt.Errorf("error checking %s: %w", filePath, err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(filePath), "."+filepath.Base(filePath)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("error creating temporary file: %w", err)
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath) // no-op once the rename has succeeded
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing %s: %w", tmpPath, err)
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error setting permissions on %s: %w", tmpPath, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error syncing %s: %w", tmpPath, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error closing %s: %w", tmpPath, err)
+	}
+
+	if err := os.Rename(tmpPath, filePath); err != nil {
+		return fmt.Errorf("error replacing %s: %w", filePath, err)
+	}
+	return nil
+}
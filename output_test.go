@@ -0,0 +1,85 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestWriteOutputFile(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "policy.json")
+
+	if err := writeOutputFile(target, []byte("first"), 0600, false); err != nil {
+		t.Fatalf("Error writing new file: %v", err)
+	}
+	info, err := os.Stat(target)
+	if err != nil {
+		t.Fatalf("Error stating output: %v", err)
+	}
+	// Windows only keeps the read-only bit of the mode
+	if runtime.GOOS != "windows" && info.Mode().Perm() != 0600 {
+		t.Errorf("Expected mode 0600, got %o", info.Mode().Perm())
+	}
+
+	if err := writeOutputFile(target, []byte("second"), 0600, false); err == nil {
+		t.Error("Expected an error overwriting without force")
+	}
+	if data, _ := os.ReadFile(target); string(data) != "first" {
+		t.Errorf("Expected existing file to be untouched, got %q", data)
+	}
+
+	if err := writeOutputFile(target, []byte("second"), 0644, true); err != nil {
+		t.Fatalf("Error overwriting with force: %v", err)
+	}
+	if data, _ := os.ReadFile(target); string(data) != "second" {
+		t.Errorf("Expected overwritten content, got %q", data)
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("Expected no leftover temporary files, found %d entries", len(entries))
+	}
+}
+
+func TestWriteOutputFileSpecialTargets(t *testing.T) {
+	// Devices are written in place rather than replaced
+	if err := writeOutputFile(os.DevNull, []byte("discarded"), 0644, false); err != nil {
+		t.Fatalf("Error writing to %s: %v", os.DevNull, err)
+	}
+	if info, err := os.Stat(os.DevNull); err != nil || info.Mode().IsRegular() {
+		t.Fatalf("Expected %s to remain a device", os.DevNull)
+	}
+
+	// Symlinks keep pointing at the rewritten file
+	dir := t.TempDir()
+	target := filepath.Join(dir, "policy.json")
+	link := filepath.Join(dir, "current.json")
+	if err := os.WriteFile(target, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(target, link); err != nil {
+		t.Skipf("symlinks unsupported: %v", err)
+	}
+	if err := writeOutputFile(link, []byte("new"), 0644, true); err != nil {
+		t.Fatalf("Error writing through symlink: %v", err)
+	}
+	if info, err := os.Lstat(link); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Error("Expected the symlink to be preserved")
+	}
+	if data, _ := os.ReadFile(target); string(data) != "new" {
+		t.Errorf("Expected symlink target to be rewritten, got %q", data)
+	}
+}
+
+func TestParseFileMode(t *testing.T) {
+	if mode, err := parseFileMode("0640"); err != nil || mode != 0640 {
+		t.Errorf("parseFileMode(0640) = %o, %v", mode, err)
+	}
+	for _, bad := range []string{"rw-r--r--", "0999", "1777"} {
+		if _, err := parseFileMode(bad); err == nil {
+			t.Errorf("Expected parseFileMode(%q) to fail", bad)
+		}
+	}
+}
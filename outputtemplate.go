@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// outputTemplateFlag names the policy files of a run that writes several,
+// e.g. "policies/{{.Stack}}/{{.Deployment}}{{.Ext}}".
+var outputTemplateFlag string
+
+// outputTemplate is the parsed --output-template (or output_template in the
+// config file); nil when neither is set.
+var outputTemplate *template.Template
+
+// artifactFields are the values an output template can use. Each split fills
+// the fields it splits by and leaves the others empty: several --path roots
+// and the stacks of the config file fill Stack, the deployments of a
+// Terraform Stack Stack and Deployment, and batch roles Account and Role.
+type artifactFields struct {
+	Stack      string
+	Deployment string
+	Account    string
+	Role       string
+	Format     string
+	Ext        string
+}
+
+// parseOutputTemplate parses an output template and checks it against
+// sample fields, so unknown fields are reported before anything is scanned.
+func parseOutputTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("output-template").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --output-template: %w", err)
+	}
+	sample := artifactFields{Stack: "stack", Deployment: "deployment", Account: "123456789012", Role: "role", Format: string(FormatJSON), Ext: ".json"}
+	if _, err := renderOutputTemplate(tmpl, sample); err != nil {
+		return nil, fmt.Errorf("invalid --output-template: %w (fields: .Stack, .Deployment, .Account, .Role, .Format, .Ext)", err)
+	}
+	return tmpl, nil
+}
+
+// renderOutputTemplate returns the file tmpl names for fields.
+func renderOutputTemplate(tmpl *template.Template, fields artifactFields) (string, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, fields); err != nil {
+		return "", err
+	}
+	name := strings.TrimSpace(buf.String())
+	if name == "" {
+		return "", fmt.Errorf("the template renders an empty file name")
+	}
+	return filepath.Clean(name), nil
+}
+
+// templateOutputs renders the output file of every split, in order, and
+// rejects templates that give two splits the same file.
+func templateOutputs(splits []artifactFields, format OutputFormat) ([]string, error) {
+	files := make([]string, len(splits))
+	written := make(map[string]int)
+	for i, fields := range splits {
+		fields.Format, fields.Ext = string(format), formatExtension(format)
+		file, err := renderOutputTemplate(outputTemplate, fields)
+		if err != nil {
+			return nil, fmt.Errorf("--output-template: %w", err)
+		}
+		if previous, ok := written[file]; ok {
+			return nil, fmt.Errorf("--output-template names %s for both %s and %s; use the fields that tell them apart",
+				file, describeSplit(splits[previous]), describeSplit(fields))
+		}
+		written[file] = i
+		files[i] = file
+	}
+	return files, nil
+}
+
+// describeSplit names a split in errors.
+func describeSplit(fields artifactFields) string {
+	var parts []string
+	for _, part := range []string{fields.Stack, fields.Deployment, fields.Account, fields.Role} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// ensureOutputDir creates the directory of an output file named by a
+// template, which may point into directories that do not exist yet.
+func ensureOutputDir(file string) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return fmt.Errorf("error creating the directory of %s: %w", file, err)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseOutputTemplate(t *testing.T) {
+	if _, err := parseOutputTemplate("policies/{{.Stack}}-{{.Deployment}}{{.Ext}}"); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	for _, text := range []string{"{{.Service}}.json", "{{.Stack", "{{if .Stack}}{{end}}"} {
+		if _, err := parseOutputTemplate(text); err == nil {
+			t.Errorf("Expected an error for %q", text)
+		}
+	}
+}
+
+func TestTemplateOutputs(t *testing.T) {
+	defer func() { outputTemplate = nil }()
+
+	var err error
+	outputTemplate, err = parseOutputTemplate("policies/{{.Stack}}/{{.Deployment}}-{{.Format}}{{.Ext}}")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	files, err := templateOutputs([]artifactFields{
+		{Stack: "network", Deployment: "prod"},
+		{Stack: "network", Deployment: "staging"},
+	}, FormatYAML)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := filepath.Join("policies", "network", "prod-yaml.yaml") + "," + filepath.Join("policies", "network", "staging-yaml.yaml")
+	if got := strings.Join(files, ","); got != want {
+		t.Errorf("templateOutputs() = %s, want %s", got, want)
+	}
+
+	outputTemplate, _ = parseOutputTemplate("{{.Stack}}{{.Ext}}")
+	_, err = templateOutputs([]artifactFields{{Stack: "app", Deployment: "prod"}, {Stack: "app", Deployment: "dev"}}, FormatJSON)
+	if err == nil || !strings.Contains(err.Error(), "app/prod and app/dev") {
+		t.Errorf("Expected an error for two deployments sharing a file, got %v", err)
+	}
+}
+
+func TestBatchRolesOutputTemplate(t *testing.T) {
+	defer func() { outputTemplate = nil }()
+
+	var err error
+	outputTemplate, err = parseOutputTemplate("{{.Account}}/{{.Role}}{{.Ext}}")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	manifest := BatchManifest{Stacks: []BatchStack{
+		{Account: "111111111111", RoleName: "deploy"},
+		{Account: "222222222222", RoleName: "deploy", Output: "custom.json"},
+	}}
+	roles, err := batchRoles(manifest, "out", FormatJSON)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if want := filepath.Join("out", "111111111111", "deploy.json"); roles[0].Output != want {
+		t.Errorf("Output of the first role = %s, want %s", roles[0].Output, want)
+	}
+	if roles[1].Output != "custom.json" {
+		t.Errorf("Expected the manifest output to win over the template, got %s", roles[1].Output)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+// isOverrideFile reports whether path is a Terraform override file,
+// override.tf or a name ending in _override.tf (or the .tofu and JSON
+// equivalents), which Terraform merges into the blocks of the other files of
+// its directory instead of adding its own.
+func isOverrideFile(path string) bool {
+	name := filepath.Base(path)
+	if !isConfigFile(name) {
+		return false
+	}
+	stem := configFileStem(name)
+	return stem == "override" || strings.HasSuffix(stem, "_override")
+}
+
+// applyOverrides merges the blocks of the override file at path, parsed into
+// override, into the blocks result holds for the same directory, as Terraform
+// does after loading the directory's other files:
+//   - a resource, data source or module call gets the override's arguments,
+//     and its nested blocks of a type the override sets are replaced, except
+//     lifecycle, which is merged argument by argument;
+//   - a backend or cloud block replaces the backend.
+//
+// Blocks without an original to override are reported as warnings, like the
+// error Terraform gives for them.
+func applyOverrides(result, override *ParseResult, path, modulePrefix string) {
+	dir := filepath.Dir(path)
+
+	for _, r := range override.Resources {
+		r = withModulePrefix(r, modulePrefix)
+		if !overrideInPlace(result.Resources, r, dir) {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("%s: no resource %s to override", path, resourceAddress(r)))
+		}
+	}
+	for _, ds := range override.DataSources {
+		ds = withModulePrefix(ds, modulePrefix)
+		if !overrideInPlace(result.DataSources, ds, dir) {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("%s: no data source %s to override", path, resourceAddress(ds)))
+		}
+	}
+
+	for _, call := range override.ModuleCalls {
+		address := modulePrefix + call.Address
+		found := false
+		for i := range result.ModuleCalls {
+			if result.ModuleCalls[i].Address == address && result.ModuleCalls[i].Dir == call.Dir {
+				if call.Source != "" {
+					result.ModuleCalls[i].Source = call.Source
+				}
+				result.ModuleCalls[i].References = mergeReferences(result.ModuleCalls[i].References, prefixAddresses(call.References, modulePrefix))
+				found = true
+			}
+		}
+		if !found {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("%s: no module call %s to override", path, address))
+		}
+	}
+
+	if override.Backend != nil {
+		replaceBackend(result, override.Backend)
+	}
+}
+
+// overrideInPlace merges override into the block of blocks declared in dir
+// with the same address, and reports whether there was one.
+func overrideInPlace(blocks []Resource, override Resource, dir string) bool {
+	address := resourceAddress(override)
+	for i, base := range blocks {
+		if resourceAddress(base) == address && filepath.Dir(base.File) == dir {
+			blocks[i] = overrideResource(base, override)
+			return true
+		}
+	}
+	return false
+}
+
+// overrideResource returns base with the arguments and nested blocks of
+// override merged in. The merged block keeps base's location.
+func overrideResource(base, override Resource) Resource {
+	replaced := make(map[string]bool)
+	for _, block := range override.Blocks {
+		if !strings.Contains(block, ".") && block != "lifecycle" {
+			replaced[block] = true
+		}
+	}
+	inReplaced := func(path string) bool {
+		return replaced[strings.SplitN(path, ".", 2)[0]]
+	}
+
+	merged := base
+	merged.Attributes = make(map[string]cty.Value, len(base.Attributes)+len(override.Attributes))
+	for name, value := range base.Attributes {
+		if !strings.Contains(name, ".") || !inReplaced(name) {
+			merged.Attributes[name] = value
+		}
+	}
+	for name, value := range override.Attributes {
+		merged.Attributes[name] = value
+	}
+
+	merged.Blocks = nil
+	for _, block := range base.Blocks {
+		if !inReplaced(block) {
+			merged.Blocks = append(merged.Blocks, block)
+		}
+	}
+	for _, block := range override.Blocks {
+		if !containsString(merged.Blocks, block) {
+			merged.Blocks = append(merged.Blocks, block)
+		}
+	}
+
+	if rule, ok := replicaRuleFor(base.Type); ok && replaced[strings.SplitN(rule.Setting, ".", 2)[0]] {
+		merged.ReplicaRegions = override.ReplicaRegions
+	}
+	if override.Provider != "" {
+		merged.Provider = override.Provider
+	}
+	merged.References = mergeReferences(base.References, override.References)
+	return merged
+}
+
+// mergeReferences returns the addresses of base followed by those of extra
+// it lacks.
+func mergeReferences(base, extra []string) []string {
+	merged := append([]string{}, base...)
+	for _, address := range extra {
+		if !containsString(merged, address) {
+			merged = append(merged, address)
+		}
+	}
+	return merged
+}
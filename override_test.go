@@ -0,0 +1,67 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestOverrideFiles(t *testing.T) {
+	if err := loadPermissionsDB(); err != nil {
+		t.Fatalf("Error loading permissions DB: %v", err)
+	}
+	result, err := parseTerraformFiles("test-fixtures/override")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(result.Resources) != 2 {
+		t.Fatalf("Override blocks should not add resources, got %d", len(result.Resources))
+	}
+	byAddress := make(map[string]Resource)
+	for _, resource := range result.Resources {
+		byAddress[resourceAddress(resource)] = resource
+	}
+
+	queue := byAddress["aws_sqs_queue.jobs"]
+	if !strings.HasSuffix(queue.File, "main.tf") || queue.Line != 8 {
+		t.Errorf("The merged block should keep its declaration, got %s:%d", queue.File, queue.Line)
+	}
+	if value, ok := queue.Attributes["kms_master_key_id"]; !ok || value.AsString() != "alias/jobs" {
+		t.Errorf("Expected the overridden argument, got %v", queue.Attributes)
+	}
+	if _, ok := queue.Attributes["name"]; !ok {
+		t.Errorf("Arguments the override does not set should be kept")
+	}
+	if !queue.hasSetting("lifecycle.prevent_destroy") || !queue.hasSetting("lifecycle.create_before_destroy") {
+		t.Errorf("lifecycle should be merged argument by argument, got %v", queue.Attributes)
+	}
+
+	web := byAddress["aws_instance.web"]
+	if web.hasSetting("root_block_device.encrypted") || !web.hasSetting("root_block_device.volume_size") {
+		t.Errorf("Nested blocks should be replaced by the override's, got %v", web.Attributes)
+	}
+
+	if result.Backend == nil || result.Backend.Type != backendCloud {
+		t.Errorf("The cloud block of the override should replace the s3 backend, got %+v", result.Backend)
+	}
+	found := false
+	for _, warning := range result.Warnings {
+		found = found || strings.Contains(warning, "no resource aws_sns_topic.missing to override")
+	}
+	if !found {
+		t.Errorf("Expected a warning for the override without original, got %v", result.Warnings)
+	}
+}
+
+func TestIsOverrideFile(t *testing.T) {
+	for path, want := range map[string]bool{
+		"override.tf":               true,
+		"infra/backend_override.tf": true,
+		"overrides.tf":              false,
+		"main.tf":                   false,
+	} {
+		if got := isOverrideFile(path); got != want {
+			t.Errorf("isOverrideFile(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
@@ -1,16 +1,23 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	_ "embed"
 	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/hashicorp/hcl/v2"
 	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/johnsidford/tf-iam-scanner/pkg/render"
 	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+	"github.com/zclconf/go-cty/cty/function/stdlib"
 )
 
 //go:embed permissions.json
@@ -18,13 +25,92 @@ var embeddedPermissionsDB []byte
 
 //go:generate go run cmd/generate-permissions/main.go
 
-// Resource represents a Terraform resource or data source
+// ResourceKind is the kind of block a Resource was declared with.
+type ResourceKind string
+
+const (
+	KindResource  ResourceKind = "resource"
+	KindData      ResourceKind = "data"
+	KindEphemeral ResourceKind = "ephemeral"
+)
+
+// addressPrefix returns what the addresses and permissions DB keys of the
+// kind start with: data. or ephemeral., and nothing for managed resources.
+func (k ResourceKind) addressPrefix() string {
+	switch k {
+	case KindData, KindEphemeral:
+		return string(k) + "."
+	}
+	return ""
+}
+
+// Description names the kind in messages: resource, data source or
+// ephemeral resource.
+func (k ResourceKind) Description() string {
+	switch k {
+	case KindData:
+		return "data source"
+	case KindEphemeral:
+		return "ephemeral resource"
+	}
+	return "resource"
+}
+
+// managed reports whether the kind is a managed resource, whose lifecycle
+// Terraform owns, rather than a data source or ephemeral resource it only
+// reads. The zero kind is a managed resource.
+func (k ResourceKind) managed() bool {
+	return k == KindResource || k == ""
+}
+
+// countKind returns the number of resources of kind.
+func countKind(resources []Resource, kind ResourceKind) int {
+	n := 0
+	for _, resource := range resources {
+		if resource.Kind == kind {
+			n++
+		}
+	}
+	return n
+}
+
+// Resource represents a Terraform resource, data source or ephemeral
+// resource. Data sources and ephemeral resources are kept in
+// ParseResult.DataSources, since both are read rather than managed.
 type Resource struct {
+	Kind         ResourceKind
 	Type         string
 	Name         string
 	Provider     string
+	Address      string // Terraform address, e.g. aws_s3_bucket.logs, data.aws_ami.ubuntu or ephemeral.aws_ssm_parameter.token
+	File         string // source file the block was declared in (empty for plan files)
+	Line         int    // line of the block header within File
 	Attributes   map[string]cty.Value
-	ResourceType string // The actual AWS resource type for IAM
+	Blocks       []string // nested block types present, e.g. vpc_config, or root_block_device.ebs for deeper ones
+	References   []string // addresses of the resources, data sources and modules the block refers to
+	ResourceType string   // The actual AWS resource type for IAM
+	// ReplicaRegions are the Regions a multi-Region resource keeps replicas
+	// in, read from every one of its replica blocks; see replicaRules.
+	ReplicaRegions []string
+	// Ignores are the IDs of the rules suppressed on the block by
+	// tfscan:ignore comments; see blockIgnores.
+	Ignores []string
+}
+
+// hasSetting reports whether the resource sets the named attribute to a
+// non-null value or contains a nested block of that type. Attributes and
+// blocks inside nested blocks are named by their path, e.g.
+// "ebs_block_device.kms_key_id".
+func (r Resource) hasSetting(name string) bool {
+	if value, ok := r.Attributes[name]; ok && !value.IsNull() {
+		return true
+	}
+	for _, block := range r.Blocks {
+		if block == name {
+			return true
+		}
+	}
+	return false
 }
 
 // BackendConfig represents Terraform backend configuration
@@ -37,36 +123,157 @@ type BackendConfig struct {
 type ParseResult struct {
 	Resources   []Resource
 	Backend     *BackendConfig
+	Backends    []*BackendConfig // every distinct backend found, e.g. one per environment; see addBackend
 	DataSources []Resource
-	Modules     []string // local module source paths found during parsing
-	Warnings    []string // non-fatal issues encountered during parsing
+	Modules     []string          // local module source paths found during parsing
+	ModuleCalls []ModuleCall      // module blocks, used to address module resources and follow dependencies
+	Warnings    []string          // non-fatal issues encountered during parsing
+	Diagnostics []ParseDiagnostic // HCL syntax errors; the affected files were only partially parsed
+	Findings    []SecurityFinding // credentials and IAM anti-patterns seen while parsing; see recordSecurityFindings
+
+	StateEncryption []StateEncryptionKey // OpenTofu aws_kms key providers of state encryption
+}
+
+// ModuleCall is a module block. Address is the module's Terraform address
+// (e.g. module.vpc or module.app.module.db); References lists what its input
+// expressions refer to, so dependencies of module resources can be followed.
+type ModuleCall struct {
+	Address    string   `json:"address"`
+	Source     string   `json:"source"`
+	Dir        string   `json:"-"` // directory of the calling file, which relative sources are resolved against
+	References []string `json:"references,omitempty"`
+}
+
+// ParseDiagnostic is an HCL diagnostic reported while parsing a .tf file.
+type ParseDiagnostic struct {
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+	Severity string `json:"severity"`
+	Summary  string `json:"summary"`
+	Detail   string `json:"detail,omitempty"`
+}
+
+// String formats the diagnostic like terraform does: file:line:column: summary.
+func (d ParseDiagnostic) String() string {
+	message := fmt.Sprintf("%s:%d:%d: %s", d.File, d.Line, d.Column, d.Summary)
+	if d.Detail != "" {
+		message += "; " + d.Detail
+	}
+	return message
 }
 
 // PermissionMap represents the permissions database
 type PermissionMap map[string]ResourcePermissions
 
-// ResourcePermissions defines actions and resource types for a resource
+// ResourcePermissions defines actions and resource types for a resource.
+// ARNTemplate is an optional ARN pattern such as "arn:${partition}:s3:::${bucket}"
+// whose placeholders are filled from the resource's parsed attributes. Entries
+// keyed "service.<prefix>" carry only an ARNTemplate: the service-wide default.
+// ARNTemplates lists further ARN forms the actions act on, such as the objects
+// of a bucket ("arn:${partition}:s3:::${bucket}/*") or the indexes of a table.
 type ResourcePermissions struct {
-	Actions       []string `json:"actions"`
-	ResourceTypes []string `json:"resource_types"`
+	Actions       []string               `json:"actions"`
+	ResourceTypes []string               `json:"resource_types"`
+	ARNTemplate   string                 `json:"arn_template,omitempty"`
+	ARNTemplates  []string               `json:"arn_templates,omitempty"`
+	Companions    []CompanionPermissions `json:"companions,omitempty"`
+	// Adopts names the type whose existing infrastructure an adoptive
+	// resource such as aws_default_vpc takes over; see adoptiveActions.
+	Adopts string `json:"adopts,omitempty"`
+	// ExpandsTo lists what the service of an umbrella resource, such as
+	// aws_elastic_beanstalk_environment, provisions downstream with the
+	// caller's credentials; see downstreamStatements.
+	ExpandsTo []string `json:"expands_to,omitempty"`
+	// ReadsSecretValue marks data sources and ephemeral resources that
+	// read the value of a secret or parameter; see secretValueReads.
+	ReadsSecretValue bool `json:"reads_secret_value,omitempty"`
+}
+
+// allARNTemplates returns ARNTemplate followed by ARNTemplates.
+func (p ResourcePermissions) allARNTemplates() []string {
+	if p.ARNTemplate == "" {
+		return p.ARNTemplates
+	}
+	return append([]string{p.ARNTemplate}, p.ARNTemplates...)
+}
+
+// CompanionPermissions are actions a resource needs only in some
+// configurations, such as the network interface permissions of a Lambda
+// function attached to a VPC. When names an attribute or nested block that
+// must be present for the actions to apply; an empty When always applies.
+type CompanionPermissions struct {
+	When    string   `json:"when,omitempty"`
+	Actions []string `json:"actions"`
 }
 
 var permissionsDB PermissionMap
 
+// permissionsDBMetaKey holds the database version in permissions.json. It is
+// removed from permissionsDB on load so it is never mistaken for a type.
+const permissionsDBMetaKey = "_meta"
+
+// PermissionsDBMeta identifies which revision of permissions.json is embedded.
+type PermissionsDBMeta = render.PermissionsDBMeta
+
+var permissionsDBMeta PermissionsDBMeta
+
 // loadPermissionsDB loads the permissions database from the embedded JSON
 func loadPermissionsDB() error {
-	var db PermissionMap
-	if err := json.Unmarshal(embeddedPermissionsDB, &db); err != nil {
+	var document map[string]json.RawMessage
+	if err := json.Unmarshal(embeddedPermissionsDB, &document); err != nil {
 		return fmt.Errorf("error parsing permissions.json: %w", err)
 	}
 
+	var meta PermissionsDBMeta
+	if err := json.Unmarshal(document[permissionsDBMetaKey], &meta); err != nil {
+		return fmt.Errorf("error parsing permissions.json metadata: %w", err)
+	}
+	aliases := make(map[string]string)
+	if raw, ok := document[permissionsDBAliasesKey]; ok {
+		if err := json.Unmarshal(raw, &aliases); err != nil {
+			return fmt.Errorf("error parsing permissions.json aliases: %w", err)
+		}
+	}
+	delete(document, permissionsDBMetaKey)
+	delete(document, permissionsDBAliasesKey)
+
+	db := make(PermissionMap, len(document)+len(aliases))
+	for key, raw := range document {
+		if _, ok := aliases[key]; ok {
+			return fmt.Errorf("permissions.json: %s is both an entry and an alias", key)
+		}
+		var entry ResourcePermissions
+		if err := json.Unmarshal(raw, &entry); err != nil {
+			return fmt.Errorf("error parsing permissions.json entry %s: %w", key, err)
+		}
+		db[key] = entry
+	}
+
 	permissionsDB = db
+	permissionsDBMeta = meta
+	permissionAliases = aliases
+	resolvePermissionAliases()
+
+	// Layers are merged over this database again
+	permissionPluginFiles = nil
+	permissionEntrySources = map[string]string{}
+	permissionEntryLayers = map[string]string{}
+	permissionLayers = nil
+	permissionConflicts = nil
 	return nil
 }
 
 // parseTerraformFiles scans a directory for .tf files and extracts resources.
 // It also follows local module sources recursively.
 func parseTerraformFiles(dirPath string) (*ParseResult, error) {
+	return parseTerraformFilesContext(context.Background(), dirPath)
+}
+
+// parseTerraformFilesContext is parseTerraformFiles stopping once ctx is
+// cancelled. It then returns what was parsed so far, without an error: the
+// caller checks ctx.
+func parseTerraformFilesContext(ctx context.Context, dirPath string) (*ParseResult, error) {
 	// Load permissions database
 	if permissionsDB == nil {
 		if err := loadPermissionsDB(); err != nil {
@@ -79,73 +286,205 @@ func parseTerraformFiles(dirPath string) (*ParseResult, error) {
 		DataSources: []Resource{},
 	}
 
-	// Track visited directories to avoid re-scanning modules
+	// A Terraform Stack is scanned through its components
+	if isTerraformStack(dirPath) {
+		stack, err := parseTerraformStack(dirPath)
+		if err != nil {
+			return nil, err
+		}
+		result = parseStackComponents(ctx, stack)
+		parseProgress.finish()
+		recordSecurityFindings(result)
+		return result, nil
+	}
+
+	// Track the directories on the current module path to stop module cycles
 	visited := make(map[string]bool)
-	scanDir(dirPath, result, visited)
+	scanDir(ctx, dirPath, "", result, visited)
+	parseProgress.finish()
+	recordSecurityFindings(result)
 
 	return result, nil
 }
 
-// scanDir recursively scans a directory and follows local module sources.
-func scanDir(dirPath string, result *ParseResult, visited map[string]bool) {
-	absPath, err := filepath.Abs(dirPath)
-	if err != nil {
-		result.Warnings = append(result.Warnings,
-			fmt.Sprintf("Could not resolve path %s: %v", dirPath, err))
+// scanDir recursively scans a directory and follows local module sources, and
+// oci:// sources with --fetch-oci-modules.
+// modulePrefix is the address of the module being scanned followed by a dot
+// ("" for the root module); it is prepended to every address found.
+// Directories are compared by real path, so a module reached through a
+// symlink is recognized on the module path and as a called module.
+func scanDir(ctx context.Context, dirPath, modulePrefix string, result *ParseResult, visited map[string]bool) {
+	if ctx.Err() != nil {
 		return
 	}
-
-	cleanPath := filepath.Clean(absPath)
+	cleanPath := realPath(dirPath)
 	if visited[cleanPath] {
 		return
 	}
 	visited[cleanPath] = true
+	defer delete(visited, cleanPath)
+
+	var paths, backendFiles []string
+	stopWalk := timings.track(PhaseWalk)
+	walkTerraformDir(dirPath, followSymlinksFlag, func(path string, info os.FileInfo) {
+		isTerraform := isConfigFile(info.Name()) && !inTerraformDataDir(path)
+		isState := info.Name() == "terraform.tfstate" || strings.HasSuffix(info.Name(), ".tfstate")
+		if strings.HasSuffix(info.Name(), backendConfigSuffix) {
+			backendFiles = append(backendFiles, path)
+			return
+		}
+		if !isTerraform && !isState {
+			return
+		}
+		if warning := oversizedFileWarning(path, info); warning != "" {
+			result.Warnings = append(result.Warnings, warning)
+			return
+		}
 
-	_ = filepath.Walk(dirPath, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			result.Warnings = append(result.Warnings,
-				fmt.Sprintf("Error accessing %s: %v", path, err))
-			return nil
+		// Only process configuration files (skip .terraform directory)
+		if isTerraform {
+			paths = append(paths, path)
 		}
 
-		// Only process .tf files (skip .terraform directory)
-		if strings.HasSuffix(info.Name(), ".tf") && !strings.Contains(path, "/.terraform/") {
-			fileResult, fileErr := parseTerraformFile(path)
-			if fileErr != nil {
-				result.Warnings = append(result.Warnings,
-					fmt.Sprintf("Error parsing %s: %v", path, fileErr))
-				return nil
+		// Check for terraform.tfstate files for backend detection
+		if isState {
+			backendInfo, backendErr := extractBackendFromState(path)
+			if backendErr == nil && backendInfo != nil {
+				addBackend(result, backendInfo)
+			}
+		}
+	}, func(warning string) {
+		result.Warnings = append(result.Warnings, warning)
+	})
+	stopWalk()
+	paths = withoutShadowedFiles(paths)
+
+	var files []parsedFile
+	parseProgress.addTotal(len(paths))
+	stopParse := timings.track(PhaseParse)
+	streamTerraformFiles(ctx, paths, func(file parsedFile) {
+		parseProgress.increment()
+		if file.err != nil {
+			result.Warnings = append(result.Warnings,
+				fmt.Sprintf("Error parsing %s: %v", file.path, file.err))
+			return
+		}
+		files = append(files, file)
+	})
+	stopParse()
+
+	// Files inside a called module's directory are scanned through the module
+	// call instead, so their resources get the module's address.
+	var calls []ModuleCall
+	moduleDirs := make(map[string]bool)
+	for _, file := range files {
+		for _, call := range file.result.ModuleCalls {
+			if isLocalModuleSource(call.Source) {
+				moduleDirs[realPath(filepath.Join(call.Dir, call.Source))] = true
 			}
+		}
+	}
 
-			result.Resources = append(result.Resources, fileResult.Resources...)
-			result.DataSources = append(result.DataSources, fileResult.DataSources...)
-			result.Modules = append(result.Modules, fileResult.Modules...)
+	// Override files are merged in after every other file, in lexical order
+	var overrides []parsedFile
+	for _, file := range files {
+		if insideAny(realPath(filepath.Dir(file.path)), moduleDirs) {
+			continue
+		}
+		if isOverrideFile(file.path) {
+			overrides = append(overrides, file)
+			continue
+		}
+		fileResult := file.result
 
-			if fileResult.Backend != nil && result.Backend == nil {
-				result.Backend = fileResult.Backend
-			}
+		for _, r := range fileResult.Resources {
+			result.Resources = append(result.Resources, withModulePrefix(r, modulePrefix))
+		}
+		for _, ds := range fileResult.DataSources {
+			result.DataSources = append(result.DataSources, withModulePrefix(ds, modulePrefix))
+		}
+		result.Modules = append(result.Modules, fileResult.Modules...)
+		result.Warnings = append(result.Warnings, fileResult.Warnings...)
+		result.Diagnostics = append(result.Diagnostics, fileResult.Diagnostics...)
+		result.Findings = append(result.Findings, fileResult.Findings...)
+		if modulePrefix == "" {
+			result.StateEncryption = append(result.StateEncryption, fileResult.StateEncryption...)
 		}
 
-		// Check for terraform.tfstate files for backend detection
-		if info.Name() == "terraform.tfstate" || strings.HasSuffix(info.Name(), ".tfstate") {
-			backendInfo, backendErr := extractBackendFromState(path)
-			if backendErr == nil && backendInfo != nil {
-				result.Backend = backendInfo
+		for _, call := range fileResult.ModuleCalls {
+			call.Address = modulePrefix + call.Address
+			call.References = prefixAddresses(call.References, modulePrefix)
+			result.ModuleCalls = append(result.ModuleCalls, call)
+			calls = append(calls, call)
+		}
+
+		addBackend(result, fileResult.Backend)
+	}
+	for _, file := range overrides {
+		applyOverrides(result, file.result, file.path, modulePrefix)
+		result.Warnings = append(result.Warnings, file.result.Warnings...)
+		result.Diagnostics = append(result.Diagnostics, file.result.Diagnostics...)
+		result.Findings = append(result.Findings, file.result.Findings...)
+	}
+	if modulePrefix == "" {
+		applyBackendConfigFiles(result, backendFiles)
+	}
+	if len(overrides) > 0 {
+		for i := range calls {
+			for _, call := range result.ModuleCalls {
+				if call.Address == calls[i].Address && call.Dir == calls[i].Dir {
+					calls[i] = call
+				}
 			}
 		}
+	}
 
-		return nil
-	})
+	// Follow local and oci:// module sources found in this directory
+	for _, call := range calls {
+		switch {
+		case isLocalModuleSource(call.Source):
+			scanDir(ctx, filepath.Join(call.Dir, call.Source), call.Address+".", result, visited)
+		case isOCIModuleSource(call.Source):
+			scanOCIModule(ctx, call, result, visited)
+		}
+	}
+}
 
-	// Follow local module sources found in this directory
-	for _, moduleSource := range result.Modules {
-		if isLocalModuleSource(moduleSource) {
-			modulePath := filepath.Join(dirPath, moduleSource)
-			scanDir(modulePath, result, visited)
+// insideAny reports whether dir is one of dirs or below one of them.
+func insideAny(dir string, dirs map[string]bool) bool {
+	for {
+		if dirs[dir] {
+			return true
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return false
 		}
+		dir = parent
 	}
 }
 
+// withModulePrefix returns r addressed within the module at modulePrefix.
+func withModulePrefix(r Resource, modulePrefix string) Resource {
+	if modulePrefix == "" {
+		return r
+	}
+	r.Address = modulePrefix + resourceAddress(r)
+	r.References = prefixAddresses(r.References, modulePrefix)
+	return r
+}
+
+func prefixAddresses(addresses []string, modulePrefix string) []string {
+	if modulePrefix == "" || len(addresses) == 0 {
+		return addresses
+	}
+	prefixed := make([]string, len(addresses))
+	for i, address := range addresses {
+		prefixed[i] = modulePrefix + address
+	}
+	return prefixed
+}
+
 // isLocalModuleSource returns true if the module source is a local path.
 func isLocalModuleSource(source string) bool {
 	return strings.HasPrefix(source, "./") || strings.HasPrefix(source, "../") ||
@@ -158,19 +497,79 @@ func parseTerraformFile(filePath string) (*ParseResult, error) {
 	if err != nil {
 		return nil, err
 	}
+	return parseTerraformSource(content, filePath)
+}
 
+// inTerraformDataDir reports whether path lies in a .terraform directory,
+// where terraform init keeps copies of modules, with either separator.
+func inTerraformDataDir(path string) bool {
+	for _, segment := range strings.Split(filepath.ToSlash(filepath.Dir(path)), "/") {
+		if segment == ".terraform" {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeSource strips a UTF-8 byte order mark and turns CRLF line endings
+// into LF, as editors on Windows may write them, so that a file parses the
+// same on every platform.
+func normalizeSource(content []byte) []byte {
+	content = bytes.TrimPrefix(content, []byte("\xef\xbb\xbf"))
+	if bytes.Contains(content, []byte("\r\n")) {
+		content = bytes.ReplaceAll(content, []byte("\r\n"), []byte("\n"))
+	}
+	return content
+}
+
+// parseTerraformSource parses the content of a Terraform file; filePath is
+// recorded as the location of its blocks and diagnostics.
+func parseTerraformSource(content []byte, filePath string) (*ParseResult, error) {
+	content = normalizeSource(content)
 	result := &ParseResult{
 		Resources:   []Resource{},
 		DataSources: []Resource{},
 	}
+	if isJSONConfigFile(filePath) {
+		native, lines, diag := nativeFromJSON(content, filePath)
+		if diag != nil {
+			d := newParseDiagnostic(diag, filePath)
+			result.Diagnostics = append(result.Diagnostics, d)
+			result.Warnings = append(result.Warnings, d.String())
+			return result, nil
+		}
+		defer remapJSONLines(result, filePath, lines)
+		content = native
+	}
 
-	// Parse HCL
+	// Parse HCL. On syntax errors the parser still recovers the valid blocks,
+	// so keep going and report the diagnostics instead of discarding the file.
 	file, diags := hclsyntax.ParseConfig(content, filePath, hcl.Pos{Line: 1, Column: 1})
 	if diags.HasErrors() {
-		// Try to still extract what we can
+		for _, diag := range diags {
+			d := newParseDiagnostic(diag, filePath)
+			result.Diagnostics = append(result.Diagnostics, d)
+			result.Warnings = append(result.Warnings, d.String())
+		}
+	}
+	if file == nil {
 		return extractWithSimpleParsing(content, filePath)
 	}
 
+	// Suppression comments are only looked for in files that have any
+	var lines [][]byte
+	if bytes.Contains(content, []byte("tfscan:ignore")) {
+		lines = bytes.Split(content, []byte("\n"))
+	}
+	ignores := func(block *hclsyntax.Block) []string {
+		if lines == nil {
+			return nil
+		}
+		ids, warnings := blockIgnores(block, lines)
+		result.Warnings = append(result.Warnings, warnings...)
+		return ids
+	}
+
 	// Extract blocks from syntax body
 	if syntaxBody, ok := file.Body.(*hclsyntax.Body); ok {
 		for _, block := range syntaxBody.Blocks {
@@ -178,30 +577,190 @@ func parseTerraformFile(filePath string) (*ParseResult, error) {
 			case "resource":
 				resource := extractResourceFromBlock(block)
 				if resource != nil {
+					resource.Ignores = ignores(block)
 					result.Resources = append(result.Resources, *resource)
 				}
-			case "data":
-				dataSource := extractDataSourceFromBlock(block)
+			case "data", "ephemeral":
+				dataSource := extractDataSourceFromBlock(block, ResourceKind(block.Type))
 				if dataSource != nil {
+					dataSource.Ignores = ignores(block)
 					result.DataSources = append(result.DataSources, *dataSource)
 				}
+			case "provider":
+				result.Findings = append(result.Findings, providerFindings(block)...)
 			case "terraform":
 				backend := extractBackendFromBlock(block)
 				if backend != nil {
 					result.Backend = backend
 				}
+				result.StateEncryption = append(result.StateEncryption, extractStateEncryption(block)...)
 			case "module":
 				source := extractModuleSource(block)
 				if source != "" {
 					result.Modules = append(result.Modules, source)
 				}
+				if len(block.Labels) > 0 {
+					result.ModuleCalls = append(result.ModuleCalls, ModuleCall{
+						Address:    "module." + block.Labels[0],
+						Source:     source,
+						Dir:        moduleCallDir(filePath),
+						References: blockReferences(block.Body),
+					})
+				}
 			}
 		}
 	}
 
+	if diags.HasErrors() {
+		// Blocks the HCL parser could not recover are picked up line by line
+		if simple, err := extractWithSimpleParsing(content, filePath); err == nil {
+			mergeMissingBlocks(result, simple)
+		}
+	}
+
 	return result, nil
 }
 
+// newParseDiagnostic converts an HCL diagnostic into a ParseDiagnostic.
+func newParseDiagnostic(diag *hcl.Diagnostic, filePath string) ParseDiagnostic {
+	d := ParseDiagnostic{
+		File:     filepath.ToSlash(filePath),
+		Severity: "warning",
+		Summary:  diag.Summary,
+		Detail:   diag.Detail,
+	}
+	if diag.Severity == hcl.DiagError {
+		d.Severity = "error"
+	}
+	if diag.Subject != nil {
+		d.Line = diag.Subject.Start.Line
+		d.Column = diag.Subject.Start.Column
+	}
+	return d
+}
+
+// mergeMissingBlocks adds the resources, data sources, modules and backend
+// found by the line-based parser that the partial HCL parse did not return.
+func mergeMissingBlocks(result, simple *ParseResult) {
+	seen := make(map[string]bool)
+	for _, r := range result.Resources {
+		seen[resourceAddress(r)] = true
+	}
+	for _, ds := range result.DataSources {
+		seen[resourceAddress(ds)] = true
+	}
+
+	for _, r := range simple.Resources {
+		if !seen[resourceAddress(r)] {
+			result.Resources = append(result.Resources, r)
+		}
+	}
+	for _, ds := range simple.DataSources {
+		if !seen[resourceAddress(ds)] {
+			result.DataSources = append(result.DataSources, ds)
+		}
+	}
+
+	modules := make(map[string]bool)
+	for _, module := range result.Modules {
+		modules[module] = true
+	}
+	for _, module := range simple.Modules {
+		if !modules[module] {
+			result.Modules = append(result.Modules, module)
+		}
+	}
+
+	calls := make(map[string]bool)
+	for _, call := range result.ModuleCalls {
+		calls[call.Address] = true
+	}
+	for _, call := range simple.ModuleCalls {
+		if !calls[call.Address] {
+			result.ModuleCalls = append(result.ModuleCalls, call)
+		}
+	}
+
+	if result.Backend == nil {
+		result.Backend = simple.Backend
+	}
+}
+
+// moduleCallDir returns the absolute directory of the file declaring a module
+// block; local module sources are relative to it.
+func moduleCallDir(filePath string) string {
+	dir := filepath.Dir(filePath)
+	if abs, err := filepath.Abs(dir); err == nil {
+		return abs
+	}
+	return dir
+}
+
+// blockReferences returns the sorted addresses of the resources, data sources
+// and modules that the expressions in body (including nested blocks and
+// depends_on) refer to, e.g. aws_vpc.main, data.aws_ami.ubuntu, module.vpc.
+func blockReferences(body *hclsyntax.Body) []string {
+	seen := make(map[string]bool)
+	var walk func(body *hclsyntax.Body)
+	walk = func(body *hclsyntax.Body) {
+		if body == nil {
+			return
+		}
+		for _, attr := range body.Attributes {
+			for _, traversal := range attr.Expr.Variables() {
+				if address := referenceAddress(traversal); address != "" {
+					seen[address] = true
+				}
+			}
+		}
+		for _, nested := range body.Blocks {
+			walk(nested.Body)
+		}
+	}
+	walk(body)
+
+	references := make([]string, 0, len(seen))
+	for address := range seen {
+		references = append(references, address)
+	}
+	sort.Strings(references)
+	return references
+}
+
+// referenceAddress converts a variable traversal such as aws_vpc.main.id into
+// the address it refers to, or "" for variables, locals and other symbols
+// that are not resources, data sources or modules.
+func referenceAddress(traversal hcl.Traversal) string {
+	var names []string
+	for _, step := range traversal {
+		switch s := step.(type) {
+		case hcl.TraverseRoot:
+			names = append(names, s.Name)
+		case hcl.TraverseAttr:
+			names = append(names, s.Name)
+		}
+		if len(names) == 3 {
+			break
+		}
+	}
+	if len(names) < 2 {
+		return ""
+	}
+
+	switch names[0] {
+	case "var", "local", "each", "count", "path", "terraform", "self":
+		return ""
+	case "module":
+		return "module." + names[1]
+	case "data", "ephemeral":
+		if len(names) < 3 {
+			return ""
+		}
+		return names[0] + "." + names[1] + "." + names[2]
+	}
+	return names[0] + "." + names[1]
+}
+
 // extractModuleSource extracts the source attribute from a module block.
 func extractModuleSource(block *hclsyntax.Block) string {
 	if block.Body == nil {
@@ -227,36 +786,103 @@ func extractResourceFromBlock(block *hclsyntax.Block) *Resource {
 	fullType := block.Labels[0]
 	name := block.Labels[1]
 
-	// Extract provider
-	provider := "aws"
-
-	if strings.HasPrefix(fullType, "aws_") {
-		provider = "aws"
-	} else if strings.Contains(fullType, "_") {
-		parts := strings.SplitN(fullType, "_", 2)
-		provider = parts[0]
-	}
-
-	// Extract attributes
+	// Extract attributes, the types of nested blocks and references
 	attributes := make(map[string]cty.Value)
+	var blocks []string
+	references := blockReferences(block.Body)
 	if block.Body != nil {
-		for name, attr := range block.Body.Attributes {
-			val, _ := attr.Expr.Value(nil)
-			attributes[name] = val
+		collectBodySettings(block.Body, "", attributes, &blocks)
+		if _, ok := stackRoleAttributes[fullType]; ok {
+			if body, ok := stackTemplateBody(block); ok {
+				attributes["template_body"] = body
+			}
 		}
 	}
 
 	return &Resource{
-		Type:         fullType,
-		Name:         name,
-		Provider:     provider,
-		Attributes:   attributes,
-		ResourceType: fullType,
+		Kind:           KindResource,
+		Type:           fullType,
+		Name:           name,
+		Provider:       typeProvider(fullType),
+		Address:        fullType + "." + name,
+		File:           block.DefRange().Filename,
+		Line:           block.DefRange().Start.Line,
+		Attributes:     attributes,
+		Blocks:         blocks,
+		References:     references,
+		ResourceType:   fullType,
+		ReplicaRegions: blockReplicaRegions(fullType, block.Body),
+	}
+}
+
+// literalContext evaluates attribute values built from literals with
+// jsonencode, as inline IAM policies usually are. References and other
+// functions still make a value unknown.
+var literalContext = &hcl.EvalContext{
+	Functions: map[string]function.Function{"jsonencode": stdlib.JSONEncodeFunc},
+}
+
+// collectBodySettings records the attributes and nested block types of body.
+// Those of nested blocks are recorded under their block path, e.g. the
+// attribute "root_block_device.kms_key_id" and the block
+// "server_side_encryption_configuration.rule". A dynamic block counts as the
+// block type it generates, with the attributes of its content block; values
+// that depend on the iterator are unknown.
+func collectBodySettings(body *hclsyntax.Body, prefix string, attributes map[string]cty.Value, blocks *[]string) {
+	for name, attr := range body.Attributes {
+		val, _ := attr.Expr.Value(literalContext)
+		attributes[prefix+name] = val
+	}
+	for _, nested := range body.Blocks {
+		blockType, content := nested.Type, nested.Body
+		if blockType == "dynamic" && len(nested.Labels) > 0 {
+			blockType, content = nested.Labels[0], dynamicContent(nested.Body)
+		}
+		path := prefix + blockType
+		if !containsString(*blocks, path) {
+			*blocks = append(*blocks, path)
+		}
+		if content != nil {
+			collectBodySettings(content, path+".", attributes, blocks)
+		}
 	}
 }
 
-// extractDataSourceFromBlock extracts data source information from an HCL block
-func extractDataSourceFromBlock(block *hclsyntax.Block) *Resource {
+// dynamicContent returns the content block of a dynamic block's body.
+func dynamicContent(body *hclsyntax.Body) *hclsyntax.Body {
+	if body == nil {
+		return nil
+	}
+	for _, nested := range body.Blocks {
+		if nested.Type == "content" {
+			return nested.Body
+		}
+	}
+	return nil
+}
+
+// typeProvider returns the local name of the provider of a resource type:
+// the part of the type before its first underscore, or the whole type for
+// those named after their provider, such as the http data source.
+func typeProvider(fullType string) string {
+	provider, _, _ := strings.Cut(fullType, "_")
+	return provider
+}
+
+// planProvider returns the provider of a plan resource: the type of its
+// provider address, e.g. aws for registry.terraform.io/hashicorp/aws but
+// awscc for registry.terraform.io/hashicorp/awscc, or typeProvider for plans
+// without one.
+func planProvider(providerName, resourceType string) string {
+	if providerName == "" {
+		return typeProvider(resourceType)
+	}
+	return providerName[strings.LastIndex(providerName, "/")+1:]
+}
+
+// extractDataSourceFromBlock extracts a data source or, with KindEphemeral,
+// an ephemeral resource from an HCL block.
+func extractDataSourceFromBlock(block *hclsyntax.Block, kind ResourceKind) *Resource {
 	if len(block.Labels) < 2 {
 		return nil
 	}
@@ -264,42 +890,78 @@ func extractDataSourceFromBlock(block *hclsyntax.Block) *Resource {
 	fullType := block.Labels[0]
 	name := block.Labels[1]
 
-	provider := "aws"
-
-	if strings.HasPrefix(fullType, "aws_") {
-		provider = "aws"
+	attributes := make(map[string]cty.Value)
+	if block.Body != nil {
+		for name, attr := range block.Body.Attributes {
+			val, _ := attr.Expr.Value(literalContext)
+			attributes[name] = val
+		}
 	}
 
 	return &Resource{
+		Kind:         kind,
 		Type:         fullType,
 		Name:         name,
-		Provider:     provider,
+		Provider:     typeProvider(fullType),
+		Address:      kind.addressPrefix() + fullType + "." + name,
+		Attributes:   attributes,
+		File:         block.DefRange().Filename,
+		Line:         block.DefRange().Start.Line,
+		References:   blockReferences(block.Body),
 		ResourceType: fullType,
 	}
 }
 
+// extractBackendFromBlock returns the backend of a terraform block: its
+// backend block, or a cloud block as the "cloud" backend. The attributes of a
+// nested workspaces block are recorded as workspaces.<name>.
 func extractBackendFromBlock(block *hclsyntax.Block) *BackendConfig {
 	for _, nestedBlock := range block.Body.Blocks {
-		if nestedBlock.Type == "backend" && len(nestedBlock.Labels) > 0 {
-			config := make(map[string]string)
+		var backendType string
+		switch {
+		case nestedBlock.Type == "backend" && len(nestedBlock.Labels) > 0:
+			backendType = nestedBlock.Labels[0]
+		case nestedBlock.Type == "cloud":
+			backendType = backendCloud
+		default:
+			continue
+		}
 
-			for name, attr := range nestedBlock.Body.Attributes {
-				val, _ := attr.Expr.Value(nil)
-				if val.Type() == cty.String {
-					config[name] = val.AsString()
+		config := backendAttributes(nestedBlock.Body, "")
+		for _, workspaces := range nestedBlock.Body.Blocks {
+			if workspaces.Type == "workspaces" {
+				for name, value := range backendAttributes(workspaces.Body, "workspaces.") {
+					config[name] = value
 				}
 			}
-
-			return &BackendConfig{
-				Type:   nestedBlock.Labels[0],
-				Config: config,
-			}
+		}
+		return &BackendConfig{
+			Type:   backendType,
+			Config: config,
 		}
 	}
 
 	return nil
 }
 
+// backendAttributes returns the literal string attributes of a backend body,
+// with lists of strings joined by commas, each name prefixed with prefix.
+func backendAttributes(body *hclsyntax.Body, prefix string) map[string]string {
+	config := make(map[string]string)
+	for name, attr := range body.Attributes {
+		val, _ := attr.Expr.Value(nil)
+		if !val.IsWhollyKnown() || val.IsNull() {
+			continue
+		}
+		if val.Type() == cty.String {
+			config[prefix+name] = val.AsString()
+		} else if values := stringValues(val); len(values) > 0 {
+			config[prefix+name] = strings.Join(values, ",")
+		}
+	}
+	return config
+}
+
 // extractBackendFromState attempts to extract backend info from state file
 func extractBackendFromState(filePath string) (*BackendConfig, error) {
 	content, err := os.ReadFile(filePath)
@@ -318,6 +980,10 @@ func extractBackendFromState(filePath string) (*BackendConfig, error) {
 	return nil, nil
 }
 
+// heredocStart matches the opening of a heredoc at the end of a line, e.g.
+// content = <<-EOT, and captures its delimiter.
+var heredocStart = regexp.MustCompile(`<<-?([A-Za-z_][A-Za-z0-9_]*)$`)
+
 // extractWithSimpleParsing is a fallback parser when HCL parsing fails
 func extractWithSimpleParsing(content []byte, filePath string) (*ParseResult, error) {
 	result := &ParseResult{
@@ -325,20 +991,43 @@ func extractWithSimpleParsing(content []byte, filePath string) (*ParseResult, er
 		DataSources: []Resource{},
 	}
 
-	lines := strings.Split(string(content), "\n")
+	lines := strings.Split(string(normalizeSource(content)), "\n")
 	var currentBlock string
 	var currentName string
+	var heredoc string
+	depth := 0
 
-	for _, line := range lines {
+	for i, line := range lines {
 		trimmed := strings.TrimSpace(line)
 
+		// Heredocs are strings even when they hold Terraform code, as the
+		// content of a local_file often does
+		if heredoc != "" {
+			if trimmed == heredoc {
+				heredoc = ""
+			}
+			continue
+		}
+
 		// Skip comments and empty lines
 		if strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, "//") || trimmed == "" {
 			continue
 		}
 
+		// Blocks are only declared at the top level. An unindented line
+		// starts one however deep the braces counted so far, so a missing
+		// brace does not hide the rest of the file.
+		topLevel := depth == 0 || (!strings.HasPrefix(line, " ") && !strings.HasPrefix(line, "\t"))
+		if topLevel {
+			depth = 0
+		}
+		depth = max(0, depth+strings.Count(trimmed, "{")-strings.Count(trimmed, "}"))
+		if match := heredocStart.FindStringSubmatch(trimmed); match != nil {
+			heredoc = match[1]
+		}
+
 		// Check for resource/data blocks
-		if strings.HasPrefix(trimmed, "resource \"") {
+		if topLevel && strings.HasPrefix(trimmed, "resource \"") {
 			currentBlock = "resource"
 			parts := strings.Fields(trimmed)
 			if len(parts) >= 2 {
@@ -347,40 +1036,39 @@ func extractWithSimpleParsing(content []byte, filePath string) (*ParseResult, er
 					currentName = strings.Trim(parts[2], "\"")
 				}
 
-				provider := "aws"
-				if strings.HasPrefix(resourceType, "aws_") {
-					provider = "aws"
-				}
-
 				result.Resources = append(result.Resources, Resource{
+					Kind:         KindResource,
 					Type:         resourceType,
 					Name:         currentName,
-					Provider:     provider,
+					Provider:     typeProvider(resourceType),
+					Address:      resourceType + "." + currentName,
+					File:         filePath,
+					Line:         i + 1,
 					ResourceType: resourceType,
 				})
 			}
-		} else if strings.HasPrefix(trimmed, "data \"") {
-			currentBlock = "data"
+		} else if topLevel && (strings.HasPrefix(trimmed, "data \"") || strings.HasPrefix(trimmed, "ephemeral \"")) {
 			parts := strings.Fields(trimmed)
+			currentBlock = parts[0]
 			if len(parts) >= 2 {
 				resourceType := strings.Trim(parts[1], "\"")
 				if len(parts) >= 3 {
 					currentName = strings.Trim(parts[2], "\"")
 				}
 
-				provider := "aws"
-				if strings.HasPrefix(resourceType, "aws_") {
-					provider = "aws"
-				}
-
+				kind := ResourceKind(currentBlock)
 				result.DataSources = append(result.DataSources, Resource{
+					Kind:         kind,
 					Type:         resourceType,
 					Name:         currentName,
-					Provider:     provider,
+					Provider:     typeProvider(resourceType),
+					Address:      kind.addressPrefix() + resourceType + "." + currentName,
+					File:         filePath,
+					Line:         i + 1,
 					ResourceType: resourceType,
 				})
 			}
-		} else if strings.HasPrefix(trimmed, "module \"") {
+		} else if topLevel && strings.HasPrefix(trimmed, "module \"") {
 			currentBlock = "module"
 			// Simple source extraction from module block
 			parts := strings.Fields(trimmed)
@@ -397,6 +1085,11 @@ func extractWithSimpleParsing(content []byte, filePath string) (*ParseResult, er
 				source = strings.Trim(source, "\"")
 				if isLocalModuleSource(source) {
 					result.Modules = append(result.Modules, source)
+					result.ModuleCalls = append(result.ModuleCalls, ModuleCall{
+						Address: "module." + currentName,
+						Source:  source,
+						Dir:     moduleCallDir(filePath),
+					})
 				}
 			}
 		}
@@ -413,6 +1106,13 @@ func extractWithSimpleParsing(content []byte, filePath string) (*ParseResult, er
 			}
 		}
 
+		if trimmed == "cloud {" && currentBlock == "terraform" {
+			result.Backend = &BackendConfig{
+				Type:   backendCloud,
+				Config: make(map[string]string),
+			}
+		}
+
 		// Track terraform blocks for backend detection
 		if strings.HasPrefix(trimmed, "terraform") {
 			currentBlock = "terraform"
@@ -428,6 +1128,21 @@ func extractWithSimpleParsing(content []byte, filePath string) (*ParseResult, er
 	return result, nil
 }
 
+// resourceAddress returns the Terraform address of a resource, deriving it
+// from the type and name when the parser did not record one.
+func resourceAddress(resource Resource) string {
+	if resource.Address != "" {
+		return resource.Address
+	}
+	return resource.Kind.addressPrefix() + resource.Type + "." + resource.Name
+}
+
+// permissionsKey returns the permissions DB key of resource's type:
+// data.<type> or ephemeral.<type> for the blocks that are only read.
+func (r Resource) permissionsKey() string {
+	return r.Kind.addressPrefix() + r.Type
+}
+
 // getRequiredPermissions returns the required IAM actions for a resource type
 func getRequiredPermissions(resourceType string) []string {
 	if permissionsDB == nil {
@@ -445,11 +1160,17 @@ func getRequiredPermissions(resourceType string) []string {
 
 // planFile represents the top-level structure of a terraform show -json output.
 type planFile struct {
-	FormatVersion    string           `json:"format_version"`
-	TerraformVersion string           `json:"terraform_version"`
-	PlannedValues    *planState       `json:"planned_values"`
-	ResourceChanges  []planResourceChange `json:"resource_changes"`
-	Configuration    *planConfig      `json:"configuration"`
+	FormatVersion    string                  `json:"format_version"`
+	TerraformVersion string                  `json:"terraform_version"`
+	PlannedValues    *planState              `json:"planned_values"`
+	ResourceChanges  []planResourceChange    `json:"resource_changes"`
+	Configuration    *planConfig             `json:"configuration"`
+	Variables        map[string]planVariable `json:"variables"`
+}
+
+// planVariable is the value a root module variable was planned with.
+type planVariable struct {
+	Value interface{} `json:"value"`
 }
 
 type planState struct {
@@ -457,8 +1178,8 @@ type planState struct {
 }
 
 type planModule struct {
-	Resources    []planResource      `json:"resources"`
-	ChildModules []planChildModule   `json:"child_modules"`
+	Resources    []planResource    `json:"resources"`
+	ChildModules []planChildModule `json:"child_modules"`
 }
 
 type planChildModule struct {
@@ -475,16 +1196,18 @@ type planResource struct {
 }
 
 type planResourceChange struct {
-	Address      string             `json:"address"`
-	Mode         string             `json:"mode"`
-	Type         string             `json:"type"`
-	Name         string             `json:"name"`
-	ProviderName string             `json:"provider_name"`
-	Change       planChangeDetail   `json:"change"`
+	Address      string           `json:"address"`
+	Mode         string           `json:"mode"`
+	Type         string           `json:"type"`
+	Name         string           `json:"name"`
+	ProviderName string           `json:"provider_name"`
+	Change       planChangeDetail `json:"change"`
 }
 
 type planChangeDetail struct {
-	Actions []string `json:"actions"`
+	Actions        []string               `json:"actions"`
+	After          map[string]interface{} `json:"after"`
+	AfterSensitive interface{}            `json:"after_sensitive"` // false, or an object marking sensitive attributes true
 }
 
 type planConfig struct {
@@ -492,8 +1215,13 @@ type planConfig struct {
 }
 
 type planConfigModule struct {
-	Resources   []planResource            `json:"resources"`
-	ModuleCalls map[string]planModuleCall `json:"module_calls"`
+	Resources   []planResource                `json:"resources"`
+	ModuleCalls map[string]planModuleCall     `json:"module_calls"`
+	Variables   map[string]planConfigVariable `json:"variables"`
+}
+
+type planConfigVariable struct {
+	Sensitive bool `json:"sensitive"`
 }
 
 type planModuleCall struct {
@@ -503,6 +1231,17 @@ type planModuleCall struct {
 // parsePlanFile reads a terraform show -json plan file and extracts resources,
 // data sources, and module sources.
 func parsePlanFile(filePath string) (*ParseResult, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading plan file: %w", err)
+	}
+	return parsePlanJSON(data)
+}
+
+// parsePlanJSON parses the output of terraform show -json.
+func parsePlanJSON(data []byte) (*ParseResult, error) {
+	defer timings.track(PhaseParse)()
+
 	// Load permissions database
 	if permissionsDB == nil {
 		if err := loadPermissionsDB(); err != nil {
@@ -510,11 +1249,6 @@ func parsePlanFile(filePath string) (*ParseResult, error) {
 		}
 	}
 
-	data, err := os.ReadFile(filePath)
-	if err != nil {
-		return nil, fmt.Errorf("error reading plan file: %w", err)
-	}
-
 	var plan planFile
 	if err := json.Unmarshal(data, &plan); err != nil {
 		return nil, fmt.Errorf("error parsing plan JSON: %w", err)
@@ -524,23 +1258,35 @@ func parsePlanFile(filePath string) (*ParseResult, error) {
 		Resources:   []Resource{},
 		DataSources: []Resource{},
 	}
+	sensitiveValues := planSensitiveValues(&plan)
 
 	// Extract from resource_changes — this is the authoritative list with
 	// the planned actions for each resource.
 	for _, rc := range plan.ResourceChanges {
-		if !strings.HasPrefix(rc.ProviderName, "registry.terraform.io/hashicorp/aws") &&
-			!strings.HasPrefix(rc.Type, "aws_") {
-			continue
+		kind := KindResource
+		if rc.Mode == "data" {
+			kind = KindData
 		}
-
 		resource := Resource{
+			Kind:         kind,
 			Type:         rc.Type,
 			Name:         rc.Name,
-			Provider:     "aws",
+			Provider:     planProvider(rc.ProviderName, rc.Type),
+			Address:      rc.Address,
 			ResourceType: rc.Type,
 		}
+		// Blocks of other providers are kept, without their values, for the
+		// summary; only a drop-in mapping makes them count
+		if needsAWSPermissions(resource) {
+			resource.Attributes = planValuesToAttributes(rc.Change.After)
+			resource.Blocks = planNestedBlocks(rc.Change.After)
+			resource.ReplicaRegions = planReplicaRegions(rc.Type, rc.Change.After)
+			redactPlanSensitive(resource.Attributes, rc.Change.AfterSensitive, sensitiveValues)
+		} else {
+			resource.Attributes = map[string]cty.Value{}
+		}
 
-		if rc.Mode == "data" {
+		if kind == KindData {
 			result.DataSources = append(result.DataSources, resource)
 		} else {
 			result.Resources = append(result.Resources, resource)
@@ -555,6 +1301,41 @@ func parsePlanFile(filePath string) (*ParseResult, error) {
 	return result, nil
 }
 
+// planValuesToAttributes converts the known scalar values from a plan's
+// "after" object into cty values so they can feed ARN templates the same
+// way HCL attributes do. Nested objects and lists are skipped.
+func planValuesToAttributes(values map[string]interface{}) map[string]cty.Value {
+	attributes := make(map[string]cty.Value)
+	for name, raw := range values {
+		switch v := raw.(type) {
+		case string:
+			attributes[name] = cty.StringVal(v)
+		case bool:
+			attributes[name] = cty.BoolVal(v)
+		case float64:
+			attributes[name] = cty.NumberFloatVal(v)
+		}
+	}
+	return attributes
+}
+
+// planNestedBlocks returns the names of the non-empty nested blocks in a
+// plan's "after" object. Terraform renders blocks as lists of objects.
+func planNestedBlocks(values map[string]interface{}) []string {
+	var blocks []string
+	for name, raw := range values {
+		items, ok := raw.([]interface{})
+		if !ok || len(items) == 0 {
+			continue
+		}
+		if _, isObject := items[0].(map[string]interface{}); isObject {
+			blocks = append(blocks, name)
+		}
+	}
+	sort.Strings(blocks)
+	return blocks
+}
+
 // extractPlanModules extracts module source paths from the plan configuration.
 func extractPlanModules(plan *planFile, result *ParseResult) {
 	if plan.Configuration == nil {
@@ -5,6 +5,10 @@ import (
 	"os"
 	"strings"
 	"testing"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
 )
 
 func TestParseSimpleTerraformFile(t *testing.T) {
@@ -76,6 +80,65 @@ func TestBackendDetection(t *testing.T) {
 	}
 }
 
+func TestPartialParseReportsDiagnostics(t *testing.T) {
+	result, err := parseTerraformFiles("test-fixtures/partial")
+	if err != nil {
+		t.Fatalf("Error parsing partial terraform files: %v", err)
+	}
+
+	// Blocks before and after the syntax error are still extracted
+	found := make(map[string]bool)
+	for _, resource := range result.Resources {
+		found[resource.Type] = true
+	}
+	for _, want := range []string{"aws_s3_bucket", "aws_sqs_queue", "aws_sns_topic"} {
+		if !found[want] {
+			t.Errorf("Expected to find %s despite the syntax error", want)
+		}
+	}
+
+	if len(result.Diagnostics) != 1 {
+		t.Fatalf("Expected 1 diagnostic, got %d", len(result.Diagnostics))
+	}
+	d := result.Diagnostics[0]
+	if d.Line != 7 || d.Column == 0 || d.Severity != "error" || !strings.HasSuffix(d.File, "main.tf") {
+		t.Errorf("Unexpected diagnostic: %+v", d)
+	}
+	if len(result.Warnings) != 1 || !strings.Contains(result.Warnings[0], "main.tf:7:") {
+		t.Errorf("Expected a file:line warning, got %v", result.Warnings)
+	}
+
+	report := buildRunReport(result, buildIAMPolicy(result, false, false), "test-fixtures/partial")
+	if !report.Degraded || len(report.ParseDiagnostics) != 1 {
+		t.Errorf("Expected a degraded report with the diagnostic, got %+v", report)
+	}
+}
+
+func TestCRLFSourceParsesLikeLF(t *testing.T) {
+	source := "terraform {\n  backend \"s3\" {\n    bucket = \"state\"\n  }\n}\n\nresource \"aws_sqs_queue\" \"jobs\" {\n  name = \"jobs\"\n}\n"
+	windows := "\xef\xbb\xbf" + strings.ReplaceAll(source, "\n", "\r\n")
+
+	for name, parse := range map[string]func([]byte, string) (*ParseResult, error){
+		"hcl":      parseTerraformSource,
+		"fallback": extractWithSimpleParsing,
+	} {
+		want, err := parse([]byte(source), "main.tf")
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		got, err := parse([]byte(windows), "main.tf")
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		if len(got.Diagnostics) > 0 || len(got.Resources) != 1 || got.Resources[0].Name != "jobs" || got.Resources[0].Line != want.Resources[0].Line {
+			t.Errorf("%s: CRLF source parsed differently: %+v", name, got.Resources)
+		}
+		if got.Backend == nil || got.Backend.Type != "s3" {
+			t.Errorf("%s: expected the s3 backend, got %+v", name, got.Backend)
+		}
+	}
+}
+
 func TestPermissionsDB(t *testing.T) {
 	if err := loadPermissionsDB(); err != nil {
 		t.Fatalf("Error loading permissions DB: %v", err)
@@ -213,6 +276,70 @@ func TestGenerateIAMPolicyTerraform(t *testing.T) {
 	}
 }
 
+func TestGenerateIAMPolicyPulumi(t *testing.T) {
+	if err := loadPermissionsDB(); err != nil {
+		t.Fatalf("Error loading permissions DB: %v", err)
+	}
+
+	result := &ParseResult{
+		Resources: []Resource{
+			{Type: "aws_s3_bucket", Name: "test", Provider: "aws", ResourceType: "aws_s3_bucket"},
+		},
+	}
+
+	ts, err := generateIAMPolicy(result, false, FormatPulumiTS, false)
+	if err != nil {
+		t.Fatalf("Error generating policy: %v", err)
+	}
+	if !strings.Contains(ts, "new aws.iam.Policy(") || !strings.Contains(ts, "s3:CreateBucket") {
+		t.Errorf("Expected TypeScript program creating aws.iam.Policy, got:\n%s", ts)
+	}
+
+	py, err := generateIAMPolicy(result, false, FormatPulumiPy, false)
+	if err != nil {
+		t.Fatalf("Error generating policy: %v", err)
+	}
+	if !strings.Contains(py, "aws.iam.Policy(") || !strings.Contains(py, "import pulumi_aws as aws") {
+		t.Errorf("Expected Python program creating aws.iam.Policy, got:\n%s", py)
+	}
+}
+
+func TestGenerateIAMPolicyHTML(t *testing.T) {
+	if err := loadPermissionsDB(); err != nil {
+		t.Fatalf("Error loading permissions DB: %v", err)
+	}
+
+	result := &ParseResult{
+		Resources: []Resource{
+			{Type: "aws_s3_bucket", Name: "test", Provider: "aws", ResourceType: "aws_s3_bucket"},
+			{Type: "aws_unknown_widget", Name: "w", Provider: "aws", ResourceType: "aws_unknown_widget"},
+		},
+		Warnings: []string{"Error parsing broken.tf: <bad>"},
+	}
+
+	report, err := generateIAMPolicy(result, false, FormatHTML, false)
+	if err != nil {
+		t.Fatalf("Error generating report: %v", err)
+	}
+
+	for _, want := range []string{"<!DOCTYPE html>", "aws_s3_bucket.test", "s3:CreateBucket", "No permission mapping for aws_unknown_widget"} {
+		if !strings.Contains(report, want) {
+			t.Errorf("Expected HTML report to contain %q", want)
+		}
+	}
+	if strings.Contains(report, "<bad>") {
+		t.Error("Expected warning text to be HTML-escaped")
+	}
+}
+
+func TestJSONToPythonLiteral(t *testing.T) {
+	got := jsonToPythonLiteral(`{"a": true, "b": [false, null], "c": "true null"}`)
+	want := `{"a": True, "b": [False, None], "c": "true null"}`
+	if got != want {
+		t.Errorf("jsonToPythonLiteral() = %s, want %s", got, want)
+	}
+}
+
 // --- No Wildcards Test ---
 
 func TestNoServiceWildcards(t *testing.T) {
@@ -402,6 +529,152 @@ func TestLeastPrivilegeMode(t *testing.T) {
 	}
 }
 
+func TestRenderARNTemplate(t *testing.T) {
+	resource := &Resource{
+		Type: "aws_ssm_parameter",
+		Attributes: map[string]cty.Value{
+			"name":  cty.StringVal("/app/db-password"),
+			"other": cty.DynamicVal,
+			"key":   cty.StringVal("logs//2024/app.log"),
+			"url":   cty.StringVal("https://example.com//hooks"),
+			"empty": cty.StringVal(""),
+		},
+	}
+
+	tests := []struct {
+		template string
+		want     string
+	}{
+		{"arn:${partition}:ssm:${region}:${account}:parameter/${name}", "arn:aws:ssm:*:*:parameter/app/db-password"},
+		{"arn:${partition}:iam::${account}:role${path:-/}${name}", "arn:aws:iam::*:role/app/db-password"},
+		{"arn:${partition}:s3:::${other}", "arn:aws:s3:::*"},
+		{"arn:${partition}:s3:::${missing}/*", "arn:aws:s3:::*/*"},
+		{"arn:${partition}:s3:::bucket/${key}", "arn:aws:s3:::bucket/logs//2024/app.log"},
+		{"arn:${partition}:execute-api:${region}:${account}:${url}", "arn:aws:execute-api:*:*:example.com//hooks"},
+		{"arn:${partition}:s3:::bucket/${empty}/*", "arn:aws:s3:::bucket/*"},
+		{"arn:${partition}:s3:::bucket/${missing:-}/*", "arn:aws:s3:::bucket/*"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.template, func(t *testing.T) {
+			got := renderARNTemplate(tt.template, resource, defaultARNContext)
+			if got != tt.want {
+				t.Errorf("renderARNTemplate(%q) = %q, want %q", tt.template, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLeastPrivilegeScopedARNs(t *testing.T) {
+	if err := loadPermissionsDB(); err != nil {
+		t.Fatalf("Error loading permissions DB: %v", err)
+	}
+
+	result := &ParseResult{
+		Resources: []Resource{
+			{Type: "aws_sqs_queue", Name: "a", Provider: "aws", ResourceType: "aws_sqs_queue",
+				Attributes: map[string]cty.Value{"name": cty.StringVal("orders")}},
+			{Type: "aws_sqs_queue", Name: "b", Provider: "aws", ResourceType: "aws_sqs_queue",
+				Attributes: map[string]cty.Value{"name": cty.StringVal("refunds")}},
+		},
+	}
+
+	policy, err := generateIAMPolicy(result, false, FormatJSON, true)
+	if err != nil {
+		t.Fatalf("Error generating policy: %v", err)
+	}
+
+	for _, arn := range []string{"arn:aws:sqs:*:*:orders", "arn:aws:sqs:*:*:refunds"} {
+		if !strings.Contains(policy, arn) {
+			t.Errorf("Expected scoped ARN %s in policy", arn)
+		}
+	}
+	if strings.Contains(policy, "arn:aws:sqs:*:*:*") {
+		t.Error("SQS statement should not fall back to the service-wide ARN")
+	}
+}
+
+func TestLeastPrivilegeMultipleARNForms(t *testing.T) {
+	if err := loadPermissionsDB(); err != nil {
+		t.Fatalf("Error loading permissions DB: %v", err)
+	}
+
+	tests := []struct {
+		resource Resource
+		service  string
+		want     string
+	}{
+		{
+			resource: Resource{Type: "aws_s3_bucket", Name: "logs", Provider: "aws", ResourceType: "aws_s3_bucket",
+				Attributes: map[string]cty.Value{"bucket": cty.StringVal("logs")}},
+			service: "s3",
+			want:    "arn:aws:s3:::logs,arn:aws:s3:::logs/*",
+		},
+		{
+			resource: Resource{Type: "aws_dynamodb_table", Name: "locks", Provider: "aws", ResourceType: "aws_dynamodb_table",
+				Attributes: map[string]cty.Value{"name": cty.StringVal("locks")}},
+			service: "dynamodb",
+			want:    "arn:aws:dynamodb:*:*:table/locks,arn:aws:dynamodb:*:*:table/locks/index/*,arn:aws:dynamodb:*:*:table/locks/stream/*",
+		},
+		{
+			resource: Resource{Type: "aws_iam_openid_connect_provider", Name: "github", Provider: "aws", ResourceType: "aws_iam_openid_connect_provider",
+				Attributes: map[string]cty.Value{"url": cty.StringVal("https://token.actions.githubusercontent.com")}},
+			service: "iam",
+			want:    "arn:aws:iam::*:oidc-provider/token.actions.githubusercontent.com",
+		},
+		{
+			resource: Resource{Type: "aws_iam_saml_provider", Name: "okta", Provider: "aws", ResourceType: "aws_iam_saml_provider",
+				Attributes: map[string]cty.Value{"name": cty.StringVal("okta")}},
+			service: "iam",
+			want:    "arn:aws:iam::*:saml-provider/okta",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.resource.Type, func(t *testing.T) {
+			policy := buildIAMPolicy(&ParseResult{Resources: []Resource{tt.resource}}, false, true)
+			for _, statement := range policy.Statement {
+				if strings.HasPrefix(toStringSlice(statement.Action)[0], tt.service+":") {
+					if got := strings.Join(toStringSlice(statement.Resource), ","); got != tt.want {
+						t.Errorf("Resource = %s, want %s", got, tt.want)
+					}
+					return
+				}
+			}
+			t.Errorf("No %s statement in %+v", tt.service, policy.Statement)
+		})
+	}
+}
+
+func TestLeastPrivilegeWildcardOnlyStatement(t *testing.T) {
+	if err := loadPermissionsDB(); err != nil {
+		t.Fatalf("Error loading permissions DB: %v", err)
+	}
+
+	result := &ParseResult{
+		Resources: []Resource{
+			{Type: "aws_sqs_queue", Name: "a", Provider: "aws", ResourceType: "aws_sqs_queue",
+				Attributes: map[string]cty.Value{"name": cty.StringVal("orders")}},
+		},
+	}
+	policy := buildIAMPolicy(result, false, true)
+
+	last := policy.Statement[len(policy.Statement)-1]
+	if last.Sid != wildcardOnlySid || last.Resource != "*" {
+		t.Fatalf("Expected a final %s statement on Resource \"*\", got %+v", wildcardOnlySid, last)
+	}
+	if !containsString(toStringSlice(last.Action), "sts:GetCallerIdentity") {
+		t.Errorf("Expected sts:GetCallerIdentity in the wildcard-only statement, got %v", last.Action)
+	}
+	for _, statement := range policy.Statement[:len(policy.Statement)-1] {
+		for _, action := range toStringSlice(statement.Action) {
+			if isWildcardOnlyAction(action) {
+				t.Errorf("Wildcard-only action %s scoped to %v", action, statement.Resource)
+			}
+		}
+	}
+}
+
 // --- PassRole Tests ---
 
 func TestPassRoleIncluded(t *testing.T) {
@@ -435,7 +708,7 @@ func TestDataSourcePermissions(t *testing.T) {
 
 	result := &ParseResult{
 		DataSources: []Resource{
-			{Type: "aws_caller_identity", Name: "current", Provider: "aws", ResourceType: "aws_caller_identity"},
+			{Kind: KindData, Type: "aws_caller_identity", Name: "current", Provider: "aws", ResourceType: "aws_caller_identity"},
 		},
 	}
 
@@ -449,6 +722,177 @@ func TestDataSourcePermissions(t *testing.T) {
 	}
 }
 
+func TestCompanionPermissions(t *testing.T) {
+	if err := loadPermissionsDB(); err != nil {
+		t.Fatalf("Error loading permissions DB: %v", err)
+	}
+
+	result, err := parseTerraformFiles("test-fixtures/companions")
+	if err != nil {
+		t.Fatalf("Error parsing companions fixture: %v", err)
+	}
+
+	actionsByName := make(map[string][]string)
+	for _, resource := range result.Resources {
+		actionsByName[resource.Name] = resourceActions(resource)
+	}
+
+	contains := func(actions []string, want string) bool {
+		for _, action := range actions {
+			if action == want {
+				return true
+			}
+		}
+		return false
+	}
+
+	if !contains(actionsByName["in_vpc"], "ec2:CreateNetworkInterface") {
+		t.Error("Expected ec2:CreateNetworkInterface for a Lambda function with vpc_config")
+	}
+	if contains(actionsByName["plain"], "ec2:CreateNetworkInterface") {
+		t.Error("Did not expect ec2:CreateNetworkInterface for a Lambda function without vpc_config")
+	}
+	if !contains(actionsByName["public"], "iam:CreateServiceLinkedRole") {
+		t.Error("Expected unconditional iam:CreateServiceLinkedRole for aws_lb")
+	}
+	if !contains(actionsByName["public"], "ec2:DescribeSubnets") {
+		t.Error("Expected ec2:DescribeSubnets for an aws_lb with a dynamic subnet_mapping block")
+	}
+	if !contains(actionsByName["encrypted"], "kms:CreateGrant") {
+		t.Error("Expected kms:CreateGrant for an instance with a kms_key_id in a dynamic ebs_block_device block")
+	}
+	if contains(actionsByName["unencrypted"], "kms:CreateGrant") {
+		t.Error("Did not expect kms:CreateGrant for an instance without a kms_key_id")
+	}
+
+	policy, err := generateIAMPolicy(result, false, FormatJSON, false)
+	if err != nil {
+		t.Fatalf("Error generating policy: %v", err)
+	}
+	if !strings.Contains(policy, "ec2:AssignPrivateIpAddresses") {
+		t.Error("Expected companion actions in the generated policy")
+	}
+}
+
+func TestCollectBodySettings(t *testing.T) {
+	src := `resource "aws_s3_bucket" "b" {
+  bucket = "b"
+  server_side_encryption_configuration {
+    rule {
+      apply_server_side_encryption_by_default {
+        kms_master_key_id = "key"
+      }
+    }
+  }
+  dynamic "lifecycle_rule" {
+    for_each = var.rules
+    content {
+      prefix = lifecycle_rule.value
+    }
+  }
+}
+`
+	file, diags := hclsyntax.ParseConfig([]byte(src), "main.tf", hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		t.Fatal(diags.Error())
+	}
+	attributes := make(map[string]cty.Value)
+	var blocks []string
+	collectBodySettings(file.Body.(*hclsyntax.Body).Blocks[0].Body, "", attributes, &blocks)
+
+	key := "server_side_encryption_configuration.rule.apply_server_side_encryption_by_default.kms_master_key_id"
+	if v, ok := attributes[key]; !ok || v.AsString() != "key" {
+		t.Errorf("Expected %s to be recorded, got %v", key, attributes)
+	}
+	if _, ok := attributes["lifecycle_rule.prefix"]; !ok {
+		t.Errorf("Expected the content attributes of a dynamic block, got %v", attributes)
+	}
+	for _, want := range []string{"server_side_encryption_configuration", "server_side_encryption_configuration.rule", "lifecycle_rule"} {
+		if !containsString(blocks, want) {
+			t.Errorf("Expected block %s, got %v", want, blocks)
+		}
+	}
+	if containsString(blocks, "lifecycle_rule.content") {
+		t.Errorf("The content block of a dynamic block should not be recorded: %v", blocks)
+	}
+}
+
+func TestResourceKinds(t *testing.T) {
+	if err := loadPermissionsDB(); err != nil {
+		t.Fatalf("Error loading permissions DB: %v", err)
+	}
+	source := `
+resource "aws_db_instance" "db" {
+  identifier  = "db"
+  password_wo = ephemeral.aws_secretsmanager_secret_version.db.secret_string
+}
+
+data "aws_ami" "ubuntu" {
+  most_recent = true
+}
+
+data "http" "ip" {
+  url = "https://checkip.amazonaws.com"
+}
+
+ephemeral "aws_secretsmanager_secret_version" "db" {
+  secret_id = "db-password"
+}
+
+ephemeral "aws_ami" "lookup" {
+  owners = ["self"]
+}
+`
+	result, err := parseTerraformSource([]byte(source), "main.tf")
+	if err != nil {
+		t.Fatalf("Error parsing source: %v", err)
+	}
+
+	db := result.Resources[0]
+	if db.Kind != KindResource || resourceAddress(db) != "aws_db_instance.db" {
+		t.Errorf("Unexpected resource: %s %s", db.Kind, resourceAddress(db))
+	}
+	if len(db.References) != 1 || db.References[0] != "ephemeral.aws_secretsmanager_secret_version.db" {
+		t.Errorf("Expected the reference to the ephemeral resource, got %v", db.References)
+	}
+
+	want := []struct {
+		kind     ResourceKind
+		address  string
+		key      string
+		provider string
+	}{
+		{KindData, "data.aws_ami.ubuntu", "data.aws_ami", "aws"},
+		{KindData, "data.http.ip", "data.http", "http"},
+		{KindEphemeral, "ephemeral.aws_secretsmanager_secret_version.db", "ephemeral.aws_secretsmanager_secret_version", "aws"},
+		{KindEphemeral, "ephemeral.aws_ami.lookup", "ephemeral.aws_ami", "aws"},
+	}
+	if len(result.DataSources) != len(want) {
+		t.Fatalf("Expected %d data sources and ephemeral resources, got %d", len(want), len(result.DataSources))
+	}
+	for i, w := range want {
+		ds := result.DataSources[i]
+		if ds.Kind != w.kind || resourceAddress(ds) != w.address || ds.permissionsKey() != w.key || ds.Provider != w.provider {
+			t.Errorf("Expected %s %s (%s, provider %s), got %s %s (%s, provider %s)",
+				w.kind, w.address, w.key, w.provider, ds.Kind, resourceAddress(ds), ds.permissionsKey(), ds.Provider)
+		}
+	}
+	if countKind(result.DataSources, KindEphemeral) != 2 {
+		t.Errorf("Expected 2 ephemeral resources")
+	}
+
+	// An ephemeral resource uses its own entry, then the data source's
+	if got := strings.Join(dataSourceActions(result.DataSources[2]), ","); got != "secretsmanager:DescribeSecret,secretsmanager:GetSecretValue" {
+		t.Errorf("Unexpected ephemeral actions: %s", got)
+	}
+	if got := strings.Join(dataSourceActions(result.DataSources[3]), ","); got != strings.Join(permissionsDB["data.aws_ami"].Actions, ",") {
+		t.Errorf("Expected the data source's actions as a fallback, got %s", got)
+	}
+	if unmapped := findUnmappedResources(result); len(unmapped) != 0 {
+		t.Errorf("Expected every block to be mapped or outside AWS, got %v", unmapped)
+	}
+}
+
 func TestDataSourceReadOnlyFiltering(t *testing.T) {
 	if err := loadPermissionsDB(); err != nil {
 		t.Fatalf("Error loading permissions DB: %v", err)
@@ -458,7 +902,7 @@ func TestDataSourceReadOnlyFiltering(t *testing.T) {
 	// should filter to read-only actions using isReadOnlyAction
 	result := &ParseResult{
 		DataSources: []Resource{
-			{Type: "aws_security_group", Name: "sg", Provider: "aws", ResourceType: "aws_security_group"},
+			{Kind: KindData, Type: "aws_security_group", Name: "sg", Provider: "aws", ResourceType: "aws_security_group"},
 		},
 	}
 
@@ -540,6 +984,88 @@ resource "aws_s3_bucket" "data" {
 	}
 }
 
+func TestSimpleParsingSkipsHeredocsAndNestedBlocks(t *testing.T) {
+	content := []byte(`resource "local_file" "generated" {
+  filename = "generated.tf"
+  content  = <<-EOT
+resource "aws_s3_bucket" "generated" {
+  bucket = "x"
+}
+EOT
+}
+
+resource "null_resource" "hook" {
+  provisioner "local-exec" {
+    command = "true"
+  }
+}
+
+data "archive_file" "fn" {
+  type = "zip"
+resource "aws_lambda_function" "fn" {
+  function_name = "fn"
+}
+`)
+
+	result, err := extractWithSimpleParsing(content, "test.tf")
+	if err != nil {
+		t.Fatalf("Error parsing: %v", err)
+	}
+	var got []string
+	for _, resources := range [][]Resource{result.Resources, result.DataSources} {
+		for _, resource := range resources {
+			got = append(got, resource.Address+"="+resource.Provider)
+		}
+	}
+	want := "local_file.generated=local,null_resource.hook=null,aws_lambda_function.fn=aws,data.archive_file.fn=archive"
+	if strings.Join(got, ",") != want {
+		t.Errorf("Expected the top-level blocks only, got %v", got)
+	}
+}
+
+func TestPlanProvider(t *testing.T) {
+	tests := []struct {
+		providerName, resourceType, want string
+	}{
+		{"registry.terraform.io/hashicorp/aws", "aws_s3_bucket", "aws"},
+		{"registry.terraform.io/hashicorp/awscc", "awscc_s3_bucket", "awscc"},
+		{"registry.terraform.io/hashicorp/archive", "archive_file", "archive"},
+		{"", "null_resource", "null"},
+	}
+	for _, tt := range tests {
+		if got := planProvider(tt.providerName, tt.resourceType); got != tt.want {
+			t.Errorf("planProvider(%q, %q) = %q, want %q", tt.providerName, tt.resourceType, got, tt.want)
+		}
+	}
+}
+
+func TestSkippedProviders(t *testing.T) {
+	if err := loadPermissionsDB(); err != nil {
+		t.Fatalf("Error loading permissions DB: %v", err)
+	}
+	plan := `{"resource_changes": [
+  {"address": "aws_s3_bucket.b", "mode": "managed", "type": "aws_s3_bucket", "name": "b", "provider_name": "registry.terraform.io/hashicorp/aws", "change": {"actions": ["create"], "after": {"bucket": "b"}}},
+  {"address": "awscc_s3_bucket.c", "mode": "managed", "type": "awscc_s3_bucket", "name": "c", "provider_name": "registry.terraform.io/hashicorp/awscc", "change": {"actions": ["create"], "after": {}}},
+  {"address": "null_resource.n", "mode": "managed", "type": "null_resource", "name": "n", "provider_name": "registry.terraform.io/hashicorp/null", "change": {"actions": ["create"], "after": {}}},
+  {"address": "data.archive_file.a", "mode": "data", "type": "archive_file", "name": "a", "provider_name": "registry.terraform.io/hashicorp/archive", "change": {"actions": ["read"], "after": {"output_path": "fn.zip"}}}
+]}`
+	result, err := parsePlanJSON([]byte(plan))
+	if err != nil {
+		t.Fatalf("Error parsing plan: %v", err)
+	}
+	if got := describeSkippedProviders(skippedProviders(result)); got != "archive (1), awscc (1), null (1)" {
+		t.Errorf("describeSkippedProviders() = %q", got)
+	}
+	for _, dataSource := range result.DataSources {
+		if len(dataSource.Attributes) > 0 {
+			t.Errorf("Expected no values kept for %s", dataSource.Address)
+		}
+	}
+	if unmapped := findUnmappedResources(result); len(unmapped) > 0 {
+		t.Errorf("Expected skipped providers not to count as unmapped, got %v", unmapped)
+	}
+}
+
 func TestIsLocalModuleSource(t *testing.T) {
 	tests := []struct {
 		source string
@@ -725,3 +1251,15 @@ func TestMain(m *testing.M) {
 	// Cleanup if needed
 	os.Exit(code)
 }
+
+func TestPermissionsDBMeta(t *testing.T) {
+	if err := loadPermissionsDB(); err != nil {
+		t.Fatalf("Error loading permissions DB: %v", err)
+	}
+	if _, ok := permissionsDB[permissionsDBMetaKey]; ok {
+		t.Error("Expected _meta to be removed from the permissions DB")
+	}
+	if permissionsDBMeta.Version == "" || permissionsDBMeta.Date == "" {
+		t.Errorf("Expected permissions DB version and date, got %+v", permissionsDBMeta)
+	}
+}
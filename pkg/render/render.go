@@ -0,0 +1,132 @@
+// Package render is the registry of custom tf-iam-scanner output formats.
+// Formats for in-house systems, such as an internal ticketing payload or the
+// input of a proprietary policy engine, live in packages of their own that
+// register a Renderer from init; --format then accepts the name, and
+// everything downstream of formatting (--output, batch file names) treats it
+// like a built-in format.
+package render
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Statement is an IAM policy statement. Generated statements only use
+// Effect, Action and Resource; the remaining elements are carried through
+// from baseline policies supplied with --merge. Action, Resource and their
+// Not forms hold a string or a []string.
+type Statement struct {
+	Sid         string                            `json:"Sid,omitempty" yaml:"Sid,omitempty"`
+	Effect      string                            `json:"Effect" yaml:"Effect"`
+	Action      interface{}                       `json:"Action,omitempty" yaml:"Action,omitempty"`
+	NotAction   interface{}                       `json:"NotAction,omitempty" yaml:"NotAction,omitempty"`
+	Resource    interface{}                       `json:"Resource,omitempty" yaml:"Resource,omitempty"`
+	NotResource interface{}                       `json:"NotResource,omitempty" yaml:"NotResource,omitempty"`
+	Condition   map[string]map[string]interface{} `json:"Condition,omitempty" yaml:"Condition,omitempty"`
+}
+
+// Policy is an IAM policy document.
+type Policy struct {
+	Version   string      `json:"Version" yaml:"Version"`
+	Id        string      `json:"Id,omitempty" yaml:"Id,omitempty"` // the --stamp input digest
+	Statement []Statement `json:"Statement" yaml:"Statement"`
+}
+
+// PermissionsDBMeta identifies the permissions database a policy was
+// generated with.
+type PermissionsDBMeta struct {
+	Version string `json:"version"`
+	Date    string `json:"date"`
+}
+
+// ScanMeta describes the scan a policy was generated from, for renderers
+// that record where a policy comes from.
+type ScanMeta struct {
+	ToolVersion   string            `json:"tool_version"`
+	Partition     string            `json:"partition"`
+	PermissionsDB PermissionsDBMeta `json:"permissions_db"`
+	Resources     []string          `json:"resources"`
+	DataSources   []string          `json:"data_sources"`
+	Backends      []string          `json:"backends,omitempty"`
+	InputDigest   string            `json:"input_digest,omitempty"` // with --stamp
+}
+
+// Renderer renders a generated policy in an output format the scanner does
+// not build in.
+type Renderer interface {
+	Render(policy Policy, meta ScanMeta) ([]byte, error)
+}
+
+// RendererFunc adapts a function to the Renderer interface.
+type RendererFunc func(policy Policy, meta ScanMeta) ([]byte, error)
+
+// Render calls f(policy, meta).
+func (f RendererFunc) Render(policy Policy, meta ScanMeta) ([]byte, error) {
+	return f(policy, meta)
+}
+
+// BuiltinFormats are the formats the scanner builds in, in the order of its
+// help. Their names cannot be registered.
+var BuiltinFormats = []string{"json", "yaml", "terraform", "pulumi-ts", "pulumi-python", "html", "csv", "xlsx", "spacelift", "env0", "opa"}
+
+// registered is a Renderer with the file extension of its format.
+type registered struct {
+	renderer  Renderer
+	extension string
+}
+
+var (
+	mu        sync.RWMutex
+	renderers = make(map[string]registered)
+)
+
+// Register adds the output format named format, rendered by renderer and
+// written by batch to files ending in extension (".json"). Like
+// database/sql.Register it is meant for init functions and panics when the
+// name is taken, by a built-in format or an earlier registration.
+func Register(format, extension string, renderer Renderer) {
+	if renderer == nil {
+		panic("render: Register renderer is nil")
+	}
+	for _, builtin := range BuiltinFormats {
+		if format == builtin {
+			panic(fmt.Sprintf("render: Register %q is a built-in format", format))
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := renderers[format]; ok {
+		panic(fmt.Sprintf("render: Register called twice for format %q", format))
+	}
+	renderers[format] = registered{renderer: renderer, extension: extension}
+}
+
+// Unregister removes a format added with Register. It exists for tests that
+// register formats of their own.
+func Unregister(format string) {
+	mu.Lock()
+	defer mu.Unlock()
+	delete(renderers, format)
+}
+
+// Lookup returns the renderer and file extension registered for format.
+func Lookup(format string) (Renderer, string, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	r, ok := renderers[format]
+	return r.renderer, r.extension, ok
+}
+
+// Formats returns the names of the registered formats, sorted.
+func Formats() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	names := make([]string, 0, len(renderers))
+	for format := range renderers {
+		names = append(names, format)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,36 @@
+package render
+
+import "testing"
+
+func TestRegister(t *testing.T) {
+	ticket := RendererFunc(func(policy Policy, meta ScanMeta) ([]byte, error) {
+		return []byte(policy.Version), nil
+	})
+	Register("ticket", ".json", ticket)
+	defer Unregister("ticket")
+
+	renderer, extension, ok := Lookup("ticket")
+	if !ok || extension != ".json" {
+		t.Fatalf("Lookup(ticket) = %q, %v", extension, ok)
+	}
+	if out, err := renderer.Render(Policy{Version: "2012-10-17"}, ScanMeta{}); err != nil || string(out) != "2012-10-17" {
+		t.Errorf("Unexpected rendering %q (%v)", out, err)
+	}
+	if _, _, ok := Lookup("json"); ok {
+		t.Error("Expected built-in formats not to be registered")
+	}
+	if formats := Formats(); len(formats) != 1 || formats[0] != "ticket" {
+		t.Errorf("Expected only ticket to be registered, got %v", formats)
+	}
+
+	for _, format := range []string{"ticket", "yaml"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Expected registering %s to panic", format)
+				}
+			}()
+			Register(format, ".txt", ticket)
+		}()
+	}
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	permissionsDirFlag []string
+	permissionsOrgFlag string
+)
+
+// permissionsOrgEnv names the org layer when --permissions-org is not given,
+// so a CI image or runner can set it once for every pipeline.
+const permissionsOrgEnv = "TF_IAM_SCANNER_PERMISSIONS_ORG"
+
+// Layers of the permissions DB, in the order they are applied: the embedded
+// database, central corrections maintained by a platform team, the user's
+// drop-in directory, and the repository's --permissions-dir mappings.
+const (
+	LayerBuiltIn = "built-in"
+	LayerOrg     = "org"
+	LayerUser    = "user"
+	LayerRepo    = "repo"
+)
+
+// permissionPluginDirName is the drop-in directory looked up under the user
+// config directory, e.g. ~/.config/tf-iam-scanner/permissions.d on Linux.
+const permissionPluginDirName = "permissions.d"
+
+// permissionPluginFiles lists the plugin files merged into permissionsDB, for
+// the run summary.
+var permissionPluginFiles []string
+
+// permissionEntrySources names the plugin file of each entry a plugin added
+// or replaced, so findings about an entry point at the file to fix.
+var permissionEntrySources = map[string]string{}
+
+// permissionEntryLayers names the layer of each entry in
+// permissionEntrySources.
+var permissionEntryLayers = map[string]string{}
+
+// PermissionLayer describes a layer merged over the embedded database, for
+// the summary and the run report.
+type PermissionLayer struct {
+	Layer     string   `json:"layer"`
+	Files     []string `json:"files"`
+	Entries   int      `json:"entries"`
+	Overrides int      `json:"overrides"` // entries of the embedded database replaced
+}
+
+// permissionLayers are the layers loaded, in order.
+var permissionLayers []PermissionLayer
+
+// PermissionConflict is an entry that a mapping file sets differently from
+// an earlier mapping file, in the same or an earlier layer. Replacing an
+// entry of the embedded database is what layers are for and not a conflict.
+type PermissionConflict struct {
+	Type           string   `json:"type"`
+	Layer          string   `json:"layer"`
+	File           string   `json:"file"`
+	ReplacedLayer  string   `json:"replaced_layer"`
+	ReplacedFile   string   `json:"replaced_file"`
+	AddedActions   []string `json:"added_actions,omitempty"`
+	RemovedActions []string `json:"removed_actions,omitempty"`
+}
+
+// permissionConflicts are the conflicts found loading the layers, sorted by
+// type.
+var permissionConflicts []PermissionConflict
+
+// String describes the conflict for the summary and db validate.
+func (c PermissionConflict) String() string {
+	var changes []string
+	for _, action := range c.AddedActions {
+		changes = append(changes, "+"+action)
+	}
+	for _, action := range c.RemovedActions {
+		changes = append(changes, "-"+action)
+	}
+	if len(changes) == 0 {
+		changes = []string{"same actions, other fields differ"}
+	}
+	return fmt.Sprintf("%s (%s) replaces %s (%s): %s",
+		c.Layer, c.File, c.ReplacedLayer, c.ReplacedFile, strings.Join(changes, ", "))
+}
+
+// defaultPermissionPluginDir returns the per-user drop-in directory, or ""
+// when the config directory cannot be determined.
+func defaultPermissionPluginDir() string {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(configDir, "tf-iam-scanner", permissionPluginDirName)
+}
+
+// loadPermissionPlugins merges the mapping layers into permissionsDB: the
+// org layer (--permissions-org or $TF_IAM_SCANNER_PERMISSIONS_ORG, a mapping
+// file or a directory of them, followed by the file fetched from
+// --permissions-url), the per-user drop-in directory, then the
+// repository's dirs. Each .json, .yaml or .yml file holds entries in the
+// permissions.json format keyed by Terraform type, for example corrections
+// or mappings for third-party providers that create AWS resources on the
+// user's behalf. Files are applied in layer order, then by name, and an
+// entry replaces any earlier entry for the same type; replacing an entry an
+// earlier file set differently is recorded in permissionConflicts. The
+// default directory is optional; locations given explicitly must exist.
+func loadPermissionPlugins(dirs []string) error {
+	if permissionsDB == nil {
+		if err := loadPermissionsDB(); err != nil {
+			return err
+		}
+	}
+
+	type layerFiles struct {
+		layer string
+		files []string
+	}
+	var layers []layerFiles
+	org := permissionsOrgFlag
+	if org == "" {
+		org = os.Getenv(permissionsOrgEnv)
+	}
+	if org != "" {
+		found, err := permissionLayerFilesAt(org)
+		if err != nil {
+			return fmt.Errorf("org permissions layer: %w", err)
+		}
+		layers = append(layers, layerFiles{LayerOrg, found})
+	}
+	remote := permissionsURLFlag
+	if remote == "" {
+		remote = os.Getenv(permissionsURLEnv)
+	}
+	if remote != "" {
+		file, err := fetchRemoteFile(context.Background(), remote, permissionsSHA256Flag)
+		if err != nil {
+			return fmt.Errorf("org permissions layer: %w", err)
+		}
+		if len(layers) > 0 {
+			layers[0].files = append(layers[0].files, file)
+		} else {
+			layers = append(layers, layerFiles{LayerOrg, []string{file}})
+		}
+	}
+	if dir := defaultPermissionPluginDir(); dir != "" {
+		found, err := permissionPluginFilesIn(dir)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		layers = append(layers, layerFiles{LayerUser, found})
+	}
+	var repo []string
+	for _, dir := range dirs {
+		found, err := permissionPluginFilesIn(dir)
+		if err != nil {
+			return err
+		}
+		repo = append(repo, found...)
+	}
+	layers = append(layers, layerFiles{LayerRepo, repo})
+
+	for _, layer := range layers {
+		if len(layer.files) == 0 {
+			continue
+		}
+		loaded := PermissionLayer{Layer: layer.layer, Files: layer.files}
+		types := make(map[string]bool)
+		for _, file := range layer.files {
+			entries, err := readPermissionPlugin(file)
+			if err != nil {
+				return err
+			}
+			resourceTypes := make([]string, 0, len(entries))
+			for resourceType := range entries {
+				resourceTypes = append(resourceTypes, resourceType)
+			}
+			sort.Strings(resourceTypes)
+			for _, resourceType := range resourceTypes {
+				entry := entries[resourceType]
+				previous, existed := permissionsDB[resourceType]
+				switch {
+				case permissionEntrySources[resourceType] != "":
+					if !reflect.DeepEqual(previous, entry) {
+						permissionConflicts = append(permissionConflicts,
+							newPermissionConflict(resourceType, layer.layer, file, previous, entry))
+					}
+				case existed:
+					loaded.Overrides++
+				}
+				permissionsDB[resourceType] = entry
+				permissionEntrySources[resourceType] = file
+				permissionEntryLayers[resourceType] = layer.layer
+				types[resourceType] = true
+			}
+			permissionPluginFiles = append(permissionPluginFiles, file)
+		}
+		loaded.Entries = len(types)
+		permissionLayers = append(permissionLayers, loaded)
+	}
+	sort.SliceStable(permissionConflicts, func(i, j int) bool {
+		return permissionConflicts[i].Type < permissionConflicts[j].Type
+	})
+	resolvePermissionAliases()
+	return nil
+}
+
+// newPermissionConflict describes file of layer replacing the entry previous
+// of resourceType, set by an earlier mapping file.
+func newPermissionConflict(resourceType, layer, file string, previous, entry ResourcePermissions) PermissionConflict {
+	conflict := PermissionConflict{
+		Type:          resourceType,
+		Layer:         layer,
+		File:          file,
+		ReplacedLayer: permissionEntryLayers[resourceType],
+		ReplacedFile:  permissionEntrySources[resourceType],
+	}
+	for _, action := range entry.Actions {
+		if !containsString(previous.Actions, action) {
+			conflict.AddedActions = append(conflict.AddedActions, action)
+		}
+	}
+	for _, action := range previous.Actions {
+		if !containsString(entry.Actions, action) {
+			conflict.RemovedActions = append(conflict.RemovedActions, action)
+		}
+	}
+	return conflict
+}
+
+// permissionLayerFilesAt returns the mapping file at location, or the
+// mapping files in it when it is a directory.
+func permissionLayerFilesAt(location string) ([]string, error) {
+	info, err := os.Stat(location)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return permissionPluginFilesIn(location)
+	}
+	return []string{location}, nil
+}
+
+// printPermissionLayers writes the layers merged over the embedded database
+// and their conflicts to the summary.
+func printPermissionLayers() {
+	if len(permissionLayers) == 0 {
+		return
+	}
+	parts := []string{LayerBuiltIn}
+	for _, layer := range permissionLayers {
+		parts = append(parts, fmt.Sprintf("%s (%d files, %d entries, %d replacing built-in)",
+			layer.Layer, len(layer.Files), layer.Entries, layer.Overrides))
+	}
+	fmt.Fprintf(os.Stderr, "  Permissions DB layers: %s\n", strings.Join(parts, " -> "))
+	if len(permissionConflicts) > 0 {
+		fmt.Fprintf(os.Stderr, "  Permission mapping conflicts: %d\n", len(permissionConflicts))
+		for _, conflict := range permissionConflicts {
+			fmt.Fprintf(os.Stderr, "    %s: %s\n", conflict.Type, conflict)
+		}
+	}
+}
+
+// permissionPluginFilesIn returns the mapping files in dir, sorted by name.
+func permissionPluginFilesIn(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading permissions directory: %w", err)
+	}
+
+	var files []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		switch strings.ToLower(filepath.Ext(entry.Name())) {
+		case ".json", ".yaml", ".yml":
+			files = append(files, filepath.Join(dir, entry.Name()))
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// readPermissionPlugin parses one mapping file. YAML is converted to JSON
+// first so both formats share the permissions.json field names.
+func readPermissionPlugin(file string) (PermissionMap, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading permissions file: %w", err)
+	}
+
+	if ext := strings.ToLower(filepath.Ext(file)); ext == ".yaml" || ext == ".yml" {
+		var raw interface{}
+		if err := yaml.Unmarshal(data, &raw); err != nil {
+			return nil, fmt.Errorf("error parsing %s: %w", file, err)
+		}
+		if data, err = json.Marshal(raw); err != nil {
+			return nil, fmt.Errorf("error parsing %s: %w", file, err)
+		}
+	}
+
+	var entries PermissionMap
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", file, err)
+	}
+	delete(entries, permissionsDBMetaKey)
+
+	for resourceType, entry := range entries {
+		if len(entry.Actions) == 0 && entry.ARNTemplate == "" {
+			return nil, fmt.Errorf("%s: entry %s has no actions", file, resourceType)
+		}
+	}
+	return entries, nil
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// usePermissionPlugins loads the drop-in mappings in dirs for one test and
+// restores the embedded database afterwards.
+func usePermissionPlugins(t *testing.T, dirs ...string) {
+	t.Helper()
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv(permissionsOrgEnv, "")
+	t.Setenv(permissionsURLEnv, "")
+	if err := loadPermissionsDB(); err != nil {
+		t.Fatalf("Error loading permissions DB: %v", err)
+	}
+	t.Cleanup(func() {
+		permissionPluginFiles = nil
+		_ = loadPermissionsDB()
+	})
+	if err := loadPermissionPlugins(dirs); err != nil {
+		t.Fatalf("Error loading permission plugins: %v", err)
+	}
+}
+
+func TestLoadPermissionPlugins(t *testing.T) {
+	usePermissionPlugins(t, "test-fixtures/plugins/permissions.d")
+
+	if len(permissionPluginFiles) != 2 {
+		t.Fatalf("Expected 2 mapping files, got %v", permissionPluginFiles)
+	}
+	atlas, ok := permissionsDB["mongodbatlas_privatelink_endpoint"]
+	if !ok || !containsString(atlas.Actions, "ec2:DescribeVpcEndpointServices") {
+		t.Errorf("Expected the YAML mapping to be loaded, got %+v", atlas)
+	}
+	datadog, ok := permissionsDB["datadog_integration_aws"]
+	if !ok || datadog.ARNTemplate == "" {
+		t.Errorf("Expected the JSON mapping with its ARN template, got %+v", datadog)
+	}
+	if !strings.Contains(describePermissionsDB(), "+ 2 drop-in mapping files") {
+		t.Errorf("Expected the summary to mention the mapping files: %s", describePermissionsDB())
+	}
+}
+
+func TestPermissionPluginsThirdPartyResources(t *testing.T) {
+	usePermissionPlugins(t, "test-fixtures/plugins/permissions.d")
+
+	result, err := parseTerraformFiles("test-fixtures/plugins")
+	if err != nil {
+		t.Fatalf("Error parsing fixture: %v", err)
+	}
+	policy := buildIAMPolicy(result, false, false)
+
+	actions := allowedActions(policy)
+	for _, want := range []string{"ec2:DescribeVpcEndpointServices", "iam:PassRole", "ec2:CreateVpcEndpoint"} {
+		if !containsString(actions, want) {
+			t.Errorf("Expected %s in the policy, got %v", want, actions)
+		}
+	}
+
+	// Unmapped third-party resources still contribute nothing
+	for _, contribution := range collectContributions(result) {
+		if contribution.Type == "random_id" {
+			t.Errorf("random_id should not be treated as an AWS resource")
+		}
+	}
+}
+
+func TestPermissionPluginOverridesBuiltin(t *testing.T) {
+	dir := t.TempDir()
+	mapping := `{"aws_s3_bucket": {"actions": ["s3:CreateBucket"], "resource_types": ["bucket"]}}`
+	if err := os.WriteFile(filepath.Join(dir, "s3.json"), []byte(mapping), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	usePermissionPlugins(t, dir)
+
+	if actions := permissionsDB["aws_s3_bucket"].Actions; len(actions) != 1 {
+		t.Errorf("Expected the drop-in entry to replace the built-in one, got %v", actions)
+	}
+}
+
+func TestPermissionLayers(t *testing.T) {
+	org := filepath.Join(t.TempDir(), "org-permissions.yaml")
+	corrections := `aws_s3_bucket:
+  actions: [s3:CreateBucket, s3:PutBucketTagging]
+  resource_types: [bucket]
+aws_sqs_queue:
+  actions: [sqs:CreateQueue]
+  resource_types: [queue]
+`
+	if err := os.WriteFile(org, []byte(corrections), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	repo := t.TempDir()
+	tweaks := `{
+  "aws_s3_bucket": {"actions": ["s3:CreateBucket", "s3:GetBucketTagging"], "resource_types": ["bucket"]},
+  "aws_sqs_queue": {"actions": ["sqs:CreateQueue"], "resource_types": ["queue"]}
+}`
+	if err := os.WriteFile(filepath.Join(repo, "tweaks.json"), []byte(tweaks), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The environment names the org layer unless the flag does
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv(permissionsOrgEnv, org)
+	t.Setenv(permissionsURLEnv, "")
+	if err := loadPermissionsDB(); err != nil {
+		t.Fatalf("Error loading permissions DB: %v", err)
+	}
+	t.Cleanup(func() { _ = loadPermissionsDB() })
+	if err := loadPermissionPlugins([]string{repo}); err != nil {
+		t.Fatalf("Error loading permission layers: %v", err)
+	}
+
+	if len(permissionLayers) != 2 || permissionLayers[0].Layer != LayerOrg || permissionLayers[1].Layer != LayerRepo {
+		t.Fatalf("Expected the org and repo layers, got %+v", permissionLayers)
+	}
+	if permissionLayers[0].Overrides != 2 || permissionLayers[1].Overrides != 0 {
+		t.Errorf("Expected the org layer to replace 2 built-in entries and the repo layer none, got %+v", permissionLayers)
+	}
+	if got := permissionsDB["aws_s3_bucket"].Actions; !containsString(got, "s3:GetBucketTagging") {
+		t.Errorf("Expected the repo layer to win, got %v", got)
+	}
+
+	// The identical sqs entry is not a conflict
+	if len(permissionConflicts) != 1 {
+		t.Fatalf("Expected 1 conflict, got %+v", permissionConflicts)
+	}
+	conflict := permissionConflicts[0]
+	want := "repo (" + filepath.Join(repo, "tweaks.json") + ") replaces org (" + org + "): +s3:GetBucketTagging, -s3:PutBucketTagging"
+	if conflict.Type != "aws_s3_bucket" || conflict.String() != want {
+		t.Errorf("Conflict = %s: %s, want aws_s3_bucket: %s", conflict.Type, conflict, want)
+	}
+
+	permissionsOrgFlag = filepath.Join(t.TempDir(), "missing.yaml")
+	defer func() { permissionsOrgFlag = "" }()
+	if err := loadPermissionPlugins(nil); err == nil || !strings.Contains(err.Error(), "org permissions layer") {
+		t.Errorf("Expected an error for a missing --permissions-org, got %v", err)
+	}
+}
+
+func TestPermissionPluginErrors(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		wantErr string
+	}{
+		{"invalid json", "bad.json", `{"x": `, "error parsing"},
+		{"invalid yaml", "bad.yaml", "x: [", "error parsing"},
+		{"no actions", "empty.yml", "foo_thing:\n  resource_types: [thing]\n", "has no actions"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dir, tt.file), []byte(tt.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { _ = loadPermissionsDB() })
+			err := loadPermissionPlugins([]string{dir})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	if err := loadPermissionPlugins([]string{filepath.Join(t.TempDir(), "missing")}); err == nil {
+		t.Errorf("Expected an error for a missing --permissions-dir")
+	}
+}
@@ -3,78 +3,303 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"path/filepath"
+	"regexp"
 	"sort"
 	"strings"
 
+	"github.com/johnsidford/tf-iam-scanner/pkg/render"
+	"github.com/zclconf/go-cty/cty"
 	"gopkg.in/yaml.v3"
 )
 
-// IAMStatement represents an IAM policy statement
-type IAMStatement struct {
-	Effect   string      `json:"Effect" yaml:"Effect"`
-	Action   interface{} `json:"Action" yaml:"Action"`
-	Resource interface{} `json:"Resource" yaml:"Resource"`
-}
+// IAMStatement represents an IAM policy statement. The type lives in
+// pkg/render so that renderers outside this package can take policies.
+type IAMStatement = render.Statement
 
 // IAMPolicy represents an IAM policy
-type IAMPolicy struct {
-	Version   string         `json:"Version" yaml:"Version"`
-	Statement []IAMStatement `json:"Statement" yaml:"Statement"`
-}
+type IAMPolicy = render.Policy
 
 // OutputFormat represents the output format type
 type OutputFormat string
 
 const (
-	FormatJSON   OutputFormat = "json"
-	FormatYAML   OutputFormat = "yaml"
+	FormatJSON      OutputFormat = "json"
+	FormatYAML      OutputFormat = "yaml"
 	FormatTerraform OutputFormat = "terraform"
+	FormatPulumiTS  OutputFormat = "pulumi-ts"
+	FormatPulumiPy  OutputFormat = "pulumi-python"
+	FormatHTML      OutputFormat = "html"
+	FormatCSV       OutputFormat = "csv"
+	FormatXLSX      OutputFormat = "xlsx"
+	FormatSpacelift OutputFormat = "spacelift"
+	FormatEnv0      OutputFormat = "env0"
+	FormatOPA       OutputFormat = "opa"
 )
 
 // generateIAMPolicy creates an IAM policy based on extracted resources
 func generateIAMPolicy(result *ParseResult, includeStateBackend bool, format OutputFormat, leastPrivilege bool) (string, error) {
+	policy := buildIAMPolicy(result, includeStateBackend, leastPrivilege)
+	return formatPolicy(policy, result, format)
+}
+
+// dataSourceActions returns the actions a data source or ephemeral resource
+// needs: its dedicated "data.<type>" or "ephemeral.<type>" entry if one
+// exists, for an ephemeral resource the data source of its type, otherwise
+// the read-only subset of the matching resource entry.
+func dataSourceActions(dataSource Resource) []string {
+	if perms := getRequiredPermissions(dataSource.permissionsKey()); len(perms) > 0 {
+		return perms
+	}
+	if perms := getRequiredPermissions(KindData.addressPrefix() + dataSource.Type); len(perms) > 0 {
+		return perms
+	}
+
+	var readOnly []string
+	for _, action := range getRequiredPermissions(dataSource.Type) {
+		if isReadOnlyAction(action) {
+			readOnly = append(readOnly, action)
+		}
+	}
+	return readOnly
+}
+
+// needsAWSPermissions reports whether deploying resource takes AWS
+// permissions: it belongs to the AWS provider, or a drop-in mapping covers
+// its type, as for third-party resources that create AWS resources.
+func needsAWSPermissions(resource Resource) bool {
+	if resource.Type == "" {
+		return false
+	}
+	if resource.Provider == "aws" {
+		return true
+	}
+	return isMapped(resource)
+}
+
+// skippedProviders counts the resources and data sources of result that
+// need no AWS permissions by provider, e.g. archive, local, null and random.
+func skippedProviders(result *ParseResult) map[string]int {
+	skipped := make(map[string]int)
+	for _, resources := range [][]Resource{result.Resources, result.DataSources} {
+		for _, resource := range resources {
+			if resource.Type != "" && !needsAWSPermissions(resource) {
+				skipped[resource.Provider]++
+			}
+		}
+	}
+	return skipped
+}
+
+// describeSkippedProviders lists skipped providers with their counts for the
+// summary, e.g. "archive (1), null (2)".
+func describeSkippedProviders(skipped map[string]int) string {
+	providers := make([]string, 0, len(skipped))
+	for provider := range skipped {
+		providers = append(providers, provider)
+	}
+	sort.Strings(providers)
+	described := make([]string, 0, len(providers))
+	for _, provider := range providers {
+		described = append(described, fmt.Sprintf("%s (%d)", provider, skipped[provider]))
+	}
+	return strings.Join(described, ", ")
+}
+
+// isMapped reports whether the permissions DB has an entry for resource: its
+// own, or for data sources and ephemeral resources one they fall back to
+// (see dataSourceActions).
+func isMapped(resource Resource) bool {
+	if _, ok := permissionsDB[resource.permissionsKey()]; ok {
+		return true
+	}
+	if resource.Kind.managed() {
+		return false
+	}
+	_, hasData := permissionsDB[KindData.addressPrefix()+resource.Type]
+	_, hasResource := permissionsDB[resource.Type]
+	return hasData || hasResource
+}
+
+// resourceActions returns the actions a resource needs: its permissions DB
+// actions (without the adopted type's create and delete calls for adoptive
+// types) plus any companion actions whose condition the resource meets.
+func resourceActions(resource Resource) []string {
+	actions := adoptiveActions(resource.Type, getRequiredPermissions(resource.Type))
+	companions := permissionsDB[resource.Type].Companions
+	if len(companions) == 0 {
+		return actions
+	}
+
+	actions = append([]string{}, actions...)
+	for _, companion := range companions {
+		if companion.When == "" || resource.hasSetting(companion.When) {
+			actions = append(actions, companion.Actions...)
+		}
+	}
+	return actions
+}
+
+// resourceContribution records the actions a single Terraform resource,
+// data source or ephemeral resource adds to the policy.
+type resourceContribution struct {
+	Address  string
+	Type     string
+	Kind     ResourceKind
+	Location string // file:line of the declaring block, when known
+	Actions  []string
+	Mapped   bool
+	ARN      string // rendered arn_template, when the entry has one
+}
+
+// collectContributions returns each AWS resource and data source in the
+// result with the actions it contributes, in parse order.
+func collectContributions(result *ParseResult) []resourceContribution {
+	var contributions []resourceContribution
+	inferred := inferredByAddress(inferReferencePermissions(result))
+
+	for _, resource := range result.Resources {
+		if !needsAWSPermissions(resource) {
+			continue
+		}
+		perms, mapped := permissionsDB[resource.Type]
+		contribution := resourceContribution{
+			Address:  resourceAddress(resource),
+			Type:     resource.Type,
+			Kind:     KindResource,
+			Location: resourceLocation(resource),
+			Actions:  addInferredActions(resourceActions(resource), inferred[resourceAddress(resource)]),
+			Mapped:   mapped,
+		}
+		if len(perms.ExpandsTo) > 0 {
+			contribution.Actions = append(append([]string{}, contribution.Actions...), perms.ExpandsTo...)
+		}
+		if stack := stackDownstreamActions(resource); len(stack) > 0 {
+			contribution.Actions = append(append([]string{}, contribution.Actions...), stack...)
+		}
+		if perms.ARNTemplate != "" {
+			contribution.ARN = renderARNTemplate(perms.ARNTemplate, &resource, defaultARNContext)
+		}
+		contributions = append(contributions, contribution)
+	}
+
+	for _, dataSource := range result.DataSources {
+		if !needsAWSPermissions(dataSource) {
+			continue
+		}
+		contributions = append(contributions, resourceContribution{
+			Address:  resourceAddress(dataSource),
+			Type:     dataSource.Type,
+			Kind:     dataSource.Kind,
+			Location: resourceLocation(dataSource),
+			Actions:  addInferredActions(dataSourceActions(dataSource), inferred[resourceAddress(dataSource)]),
+			Mapped:   isMapped(dataSource),
+		})
+	}
+
+	return contributions
+}
+
+// resourceLocation formats a resource's source position as file:line, with
+// forward slashes on every platform.
+func resourceLocation(resource Resource) string {
+	if resource.File == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s:%d", filepath.ToSlash(resource.File), resource.Line)
+}
+
+// buildIAMPolicy collects the actions required by the parsed result and
+// assembles them into policy statements.
+func buildIAMPolicy(result *ParseResult, includeStateBackend bool, leastPrivilege bool) IAMPolicy {
 	actions := make(map[string]bool)
+	scope := newServiceARNs()
+	// Actions without resource-level permissions are only authorized
+	// with Resource "*"; scoped to ARNs they would be silently denied
+	if leastPrivilege && actionCatalog == nil {
+		_ = loadActionCatalog()
+	}
+	inferred := inferredByAddress(inferReferencePermissions(result))
 
-	// Collect actions from resources
+	// Collect actions from resources and the resources they refer to
 	for _, resource := range result.Resources {
-		if resource.Provider == "aws" && resource.Type != "" {
-			perms := getRequiredPermissions(resource.Type)
+		if needsAWSPermissions(resource) {
+			perms := resourceActions(resource)
 			for _, action := range perms {
 				actions[action] = true
 			}
+			permissions := inferred[resourceAddress(resource)]
+			scope.addResource(resource, perms, scopedInferredActions(permissions))
+			for _, permission := range permissions {
+				for _, action := range permission.Actions {
+					actions[action] = true
+					if len(permission.ARNs) > 0 {
+						scope.addARNs(action, permission.ARNs)
+					} else {
+						scope.addUnscoped(action)
+					}
+				}
+			}
 		}
 	}
 
-	// Collect actions from data sources
+	// Collect actions from data sources, and the keys of the secret values
+	// they read
 	for _, dataSource := range result.DataSources {
-		if dataSource.Provider == "aws" && dataSource.Type != "" {
-			// First, check for data-source-specific permissions entry
-			dataSourceKey := "data." + dataSource.Type
-			perms := getRequiredPermissions(dataSourceKey)
-			if len(perms) > 0 {
-				for _, action := range perms {
+		if needsAWSPermissions(dataSource) {
+			perms := dataSourceActions(dataSource)
+			for _, action := range perms {
+				actions[action] = true
+			}
+			permissions := inferred[resourceAddress(dataSource)]
+			scope.addResource(dataSource, perms, scopedInferredActions(permissions))
+			for _, permission := range permissions {
+				for _, action := range permission.Actions {
 					actions[action] = true
-				}
-			} else {
-				// Fallback: look up the resource type and filter to read-only actions
-				perms := getRequiredPermissions(dataSource.Type)
-				for _, action := range perms {
-					if isReadOnlyAction(action) {
-						actions[action] = true
+					if len(permission.ARNs) > 0 {
+						scope.addARNs(action, permission.ARNs)
+					} else {
+						scope.addUnscoped(action)
 					}
 				}
 			}
 		}
 	}
 
-	// Add Terraform state backend permissions
+	// Add Terraform state backend permissions, scoped to the state of each
+	// backend where it is known
 	if includeStateBackend {
-		addBackendPermissions(actions, result.Backend)
+		for _, backend := range stateBackends(result) {
+			backendActions := make(map[string]bool)
+			addBackendPermissions(backendActions, backend)
+			arns := backendResourceARNs(backend)
+			for action := range backendActions {
+				actions[action] = true
+				if len(arns[action]) > 0 {
+					scope.addARNs(action, arns[action])
+				} else {
+					scope.addUnscoped(action)
+				}
+			}
+		}
+		// OpenTofu encrypts the state with its aws_kms key providers' keys
+		if len(result.StateEncryption) > 0 {
+			keyARNs := stateEncryptionARNs(result)
+			for _, action := range stateEncryptionActions {
+				actions[action] = true
+				if len(keyARNs) > 0 {
+					scope.addARNs(action, keyARNs)
+				} else {
+					scope.addUnscoped(action)
+				}
+			}
+		}
 	}
 
 	// Always include sts:GetCallerIdentity — the AWS provider requires it on init
 	if len(actions) > 0 {
 		actions["sts:GetCallerIdentity"] = true
+		scope.addUnscoped("sts:GetCallerIdentity")
 	}
 
 	// Convert to sorted list
@@ -93,11 +318,14 @@ func generateIAMPolicy(result *ParseResult, includeStateBackend bool, format Out
 	var statements []IAMStatement
 
 	if leastPrivilege {
+		var wildcardOnly []string
+		actionList, wildcardOnly = splitWildcardOnlyActions(actionList)
+
 		// Generate separate statements per service for better granularity
 		groupedByService := groupActionsByServiceWithActions(actionList)
 		for service, serviceActions := range groupedByService {
-			resource := getResourceARNForService(service)
-			
+			resource := scope.resourceFor(service)
+
 			statement := IAMStatement{
 				Effect:   "Allow",
 				Action:   serviceActions,
@@ -114,6 +342,14 @@ func generateIAMPolicy(result *ParseResult, includeStateBackend bool, format Out
 			}
 			return false
 		})
+		if len(wildcardOnly) > 0 {
+			statements = append(statements, IAMStatement{
+				Sid:      wildcardOnlySid,
+				Effect:   "Allow",
+				Action:   wildcardOnly,
+				Resource: "*",
+			})
+		}
 	} else {
 		// Single statement with all actions
 		statement := IAMStatement{
@@ -123,15 +359,26 @@ func generateIAMPolicy(result *ParseResult, includeStateBackend bool, format Out
 		}
 		statements = []IAMStatement{statement}
 	}
+	statements = append(statements, downstreamStatements(result)...)
 
-	policy := IAMPolicy{
-		Version:   "2012-10-17",
+	return IAMPolicy{
+		Version:   defaultPolicyVersion,
 		Statement: statements,
 	}
+}
 
-	// Format output based on requested format
+// formatPolicy renders a policy in the requested output format. The parse
+// result is only consulted by report-style formats such as HTML.
+func formatPolicy(policy IAMPolicy, result *ParseResult, format OutputFormat) (string, error) {
 	switch format {
 	case FormatJSON:
+		if compactFlag {
+			jsonBytes, err := json.Marshal(policy)
+			if err != nil {
+				return "", fmt.Errorf("error marshaling policy to JSON: %w", err)
+			}
+			return string(jsonBytes), nil
+		}
 		jsonBytes, err := json.MarshalIndent(policy, "", "  ")
 		if err != nil {
 			return "", fmt.Errorf("error marshaling policy to JSON: %w", err)
@@ -146,14 +393,40 @@ func generateIAMPolicy(result *ParseResult, includeStateBackend bool, format Out
 		return string(yamlBytes), nil
 
 	case FormatTerraform:
-		return generateTerraformOutput(statements), nil
+		return terraformOutput(policy, nil)
+
+	case FormatPulumiTS:
+		return generatePulumiTypeScript(policy)
+
+	case FormatPulumiPy:
+		return generatePulumiPython(policy)
+
+	case FormatHTML:
+		return generateHTMLReport(policy, result)
+
+	case FormatCSV:
+		return generateCSV(policy, result)
+
+	case FormatXLSX:
+		return generateXLSX(policy, result)
+
+	case FormatSpacelift:
+		return generateRegoPlanPolicy(policy, result, spaceliftPlanPolicy)
+
+	case FormatEnv0:
+		return generateRegoPlanPolicy(policy, result, env0PlanPolicy)
+
+	case FormatOPA:
+		return generateOPAData(policy, result)
 
 	default:
-		return "", fmt.Errorf("unsupported format: %s", format)
+		return renderRegistered(policy, result, format)
 	}
 }
 
-// groupActionsByService groups actions by AWS service without wildcarding
+// groupActionsByService groups actions by AWS service, collapsing the actions
+// of a service into service:* when there are more than its
+// wildcardThreshold.
 func groupActionsByService(actions []string) []string {
 	servicePrefixes := make(map[string][]string)
 
@@ -170,6 +443,10 @@ func groupActionsByService(actions []string) []string {
 
 	grouped := []string{}
 	for service, actionNames := range servicePrefixes {
+		if threshold := wildcardThreshold(service); threshold > 0 && len(actionNames) > threshold {
+			grouped = append(grouped, service+":*")
+			continue
+		}
 		for _, actionName := range actionNames {
 			grouped = append(grouped, service+":"+actionName)
 		}
@@ -217,9 +494,10 @@ func isReadOnlyAction(action string) bool {
 	return false
 }
 
-// getResourceARNForService returns the appropriate resource ARN for a service
-// using resource_types from the permissions database when available.
-func getResourceARNForService(service string) string {
+// getResourceARNForService returns the resource ARNs for a service's
+// statement, using resource_types from the permissions database when
+// available.
+func getResourceARNForService(service string) []string {
 	// Collect resource_types from entries belonging to this service.
 	// An entry "belongs" to a service if its first action is in that service.
 	resourceTypes := make(map[string]bool)
@@ -248,7 +526,7 @@ func getResourceARNForService(service string) string {
 		for rt := range resourceTypes {
 			pattern := constructARNPattern(service, rt)
 			if pattern != "*" {
-				return pattern
+				return []string{pattern}
 			}
 		}
 	}
@@ -257,32 +535,35 @@ func getResourceARNForService(service string) string {
 	return defaultARNForService(service)
 }
 
-// constructARNPattern builds an ARN pattern from a service and resource type name.
+// constructARNPattern builds an ARN pattern from a service and resource type
+// name in the partition, region and account of defaultARNContext.
 func constructARNPattern(service, resourceType string) string {
+	partition := defaultARNContext.Partition
 	// Services with ARN formats that omit region or account
 	switch service {
 	case "s3":
-		return fmt.Sprintf("arn:aws:s3:::%s", resourceType)
+		return fmt.Sprintf("arn:%s:s3:::%s", partition, resourceType)
 	case "iam":
-		return fmt.Sprintf("arn:aws:iam::*:%s", resourceType)
+		return fmt.Sprintf("arn:%s:iam::%s:%s", partition, defaultARNContext.Account, resourceType)
 	case "route53":
-		return "arn:aws:route53:::*"
+		return fmt.Sprintf("arn:%s:route53:::*", partition)
 	case "cloudfront":
-		return "arn:aws:cloudfront:::*"
+		return fmt.Sprintf("arn:%s:cloudfront:::*", partition)
 	case "waf":
-		return "arn:aws:waf:::*"
+		return fmt.Sprintf("arn:%s:waf:::*", partition)
 	case "shield":
-		return "arn:aws:shield:::*"
+		return fmt.Sprintf("arn:%s:shield:::*", partition)
 	}
 
-	// Standard ARN format: arn:aws:<service>:<region>:<account>:<resource_type>
+	// Standard ARN format: arn:<partition>:<service>:<region>:<account>:<resource_type>
 	// Map resource type names to their ARN path segments
 	arnPath := resourceTypeARNPath(resourceType)
+	region, account := defaultARNContext.Region, defaultARNContext.Account
 	if arnPath != "" {
-		return fmt.Sprintf("arn:aws:%s:*:*:%s", service, arnPath)
+		return fmt.Sprintf("arn:%s:%s:%s:%s:%s", partition, service, region, account, arnPath)
 	}
 
-	return fmt.Sprintf("arn:aws:%s:*:*:*", service)
+	return fmt.Sprintf("arn:%s:%s:%s:%s:*", partition, service, region, account)
 }
 
 // resourceTypeARNPath maps resource_type values to their ARN path components.
@@ -356,83 +637,203 @@ func resourceTypeARNPath(rt string) string {
 	return ""
 }
 
-// defaultARNForService provides a fallback ARN pattern for services not covered
-// by the resource_type-based construction.
-func defaultARNForService(service string) string {
-	arnMap := map[string]string{
-		"ec2":                      "arn:aws:ec2:*:*:*",
-		"s3":                       "arn:aws:s3:::*",
-		"iam":                      "arn:aws:iam::*:*",
-		"rds":                      "arn:aws:rds:*:*:*",
-		"lambda":                   "arn:aws:lambda:*:*:*",
-		"apigateway":               "arn:aws:apigateway:*::*",
-		"sns":                      "arn:aws:sns:*:*:*",
-		"sqs":                      "arn:aws:sqs:*:*:*",
-		"dynamodb":                 "arn:aws:dynamodb:*:*:*",
-		"logs":                     "arn:aws:logs:*:*:*",
-		"cloudwatch":               "arn:aws:cloudwatch:*:*:*",
-		"autoscaling":              "arn:aws:autoscaling:*:*:*",
-		"application-autoscaling":  "arn:aws:application-autoscaling:*:*:*",
-		"route53":                  "arn:aws:route53:::*",
-		"cloudfront":               "arn:aws:cloudfront:::*",
-		"elasticloadbalancing":     "arn:aws:elasticloadbalancing:*:*:*",
-		"elasticfilesystem":        "arn:aws:elasticfilesystem:*:*:*",
-		"secretsmanager":           "arn:aws:secretsmanager:*:*:*",
-		"kms":                      "arn:aws:kms:*:*:*",
-		"ecr":                      "arn:aws:ecr:*:*:repository/*",
-		"ecs":                      "arn:aws:ecs:*:*:*",
-		"eks":                      "arn:aws:eks:*:*:cluster/*",
-		"events":                   "arn:aws:events:*:*:rule/*",
-		"codepipeline":             "arn:aws:codepipeline:*:*:*",
-		"codedeploy":               "arn:aws:codedeploy:*:*:*",
-		"codebuild":                "arn:aws:codebuild:*:*:project/*",
-		"codecommit":               "arn:aws:codecommit:*:*:*",
-		"glue":                     "arn:aws:glue:*:*:*",
-		"redshift":                 "arn:aws:redshift:*:*:cluster:*",
-		"elasticache":              "arn:aws:elasticache:*:*:*",
-		"es":                       "arn:aws:es:*:*:domain/*",
-		"kinesis":                  "arn:aws:kinesis:*:*:stream/*",
-		"firehose":                 "arn:aws:firehose:*:*:deliverystream/*",
-		"athena":                   "arn:aws:athena:*:*:workgroup/*",
-		"datasync":                 "arn:aws:datasync:*:*:*",
-		"backup":                   "arn:aws:backup:*:*:*",
-		"batch":                    "arn:aws:batch:*:*:*",
-		"guardduty":                "arn:aws:guardduty:*:*:detector/*",
-		"securityhub":              "arn:aws:securityhub:*:*:hub/default",
-		"inspector":                "arn:aws:inspector:*:*:*",
-		"config":                   "arn:aws:config:*:*:*",
-		"waf":                      "arn:aws:waf:::*",
-		"waf-regional":             "arn:aws:waf-regional:*:*:*",
-		"wafv2":                    "arn:aws:wafv2:*:*:*",
-		"shield":                   "arn:aws:shield:::*",
-		"ssm":                      "arn:aws:ssm:*:*:*",
-		"transfer":                 "arn:aws:transfer:*:*:server/*",
-		"mq":                       "arn:aws:mq:*:*:broker/*",
-		"iot":                      "arn:aws:iot:*:*:*",
-		"mobiletargeting":          "arn:aws:mobiletargeting:*:*:apps/*",
-		"mediaconvert":             "arn:aws:mediaconvert:*:*:queues/*",
-		"mediastore":               "arn:aws:mediastore:*:*:container/*",
-		"storagegateway":           "arn:aws:storagegateway:*:*:gateway/*",
-		"servicediscovery":         "arn:aws:servicediscovery:*:*:*",
-		"appmesh":                  "arn:aws:appmesh:*:*:mesh/*",
-		"states":                   "arn:aws:states:*:*:stateMachine:*",
-		"network-firewall":         "arn:aws:network-firewall:*:*:*",
-		"amplify":                  "arn:aws:amplify:*:*:*",
-		"appsync":                  "arn:aws:appsync:*:*:apis/*",
-		"cognito-idp":              "arn:aws:cognito-idp:*:*:userpool/*",
-		"cognito-identity":         "arn:aws:cognito-identity:*:*:identitypool/*",
-		"fsx":                      "arn:aws:fsx:*:*:file-system/*",
-		"qldb":                     "arn:aws:qldb:*:*:*",
-		"timestream":               "arn:aws:timestream:*:*:*",
-		"memorydb":                 "arn:aws:memorydb:*:*:cluster/*",
-		"sts":                      "*",
-	}
-	if arn, exists := arnMap[service]; exists {
-		return arn
+// defaultARNForService provides fallback ARN patterns for services not covered
+// by the resource_type-based construction. The patterns live in the permissions
+// DB under "service.<prefix>" keys.
+func defaultARNForService(service string) []string {
+	perms, exists := permissionsDB["service."+service]
+	if !exists || perms.ARNTemplate == "" {
+		return []string{"*"}
+	}
+	var arns []string
+	for _, template := range perms.allARNTemplates() {
+		arns = append(arns, renderARNTemplate(template, nil, defaultARNContext))
+	}
+	return arns
+}
+
+// arnContext holds the account-level values substituted into ARN templates.
+// When Environment is set, that name is replaced with EnvironmentToken in
+// attribute values (see --template-vars).
+type arnContext struct {
+	Partition        string
+	Region           string
+	Account          string
+	Environment      string
+	EnvironmentToken string
+}
+
+// defaultARNContext leaves region and account open since neither is known
+// from the Terraform source alone. The partition is set by --partition;
+// --template-vars replaces region and account with placeholders.
+var defaultARNContext = arnContext{Partition: "aws", Region: "*", Account: "*"}
+
+// arnTemplateVar matches ${name} and ${name:-default} placeholders.
+var arnTemplateVar = regexp.MustCompile(`\$\{([A-Za-z0-9_]+)(?::-([^}]*))?\}`)
+
+// renderARNTemplate expands an ARN template for a resource. partition, region
+// and account come from ctx; every other placeholder is looked up in the
+// resource's attributes with arnAttributeValue. Values that are unset or
+// only known at apply time (references, interpolations) become "*", unless
+// the placeholder supplies a default.
+func renderARNTemplate(template string, resource *Resource, ctx arnContext) string {
+	var arn strings.Builder
+	last := 0
+	for _, loc := range arnTemplateVar.FindAllStringSubmatchIndex(template, -1) {
+		arn.WriteString(template[last:loc[0]])
+		last = loc[1]
+
+		match := template[loc[0]:loc[1]]
+		name, fallback := template[loc[2]:loc[3]], ""
+		if loc[4] >= 0 {
+			fallback = template[loc[4]:loc[5]]
+		}
+		value := arnTemplateValue(name, match, fallback, resource, ctx)
+
+		// Attribute values may carry their own separator (e.g. SSM parameter
+		// names starting with "/"), and an empty value leaves two separators
+		// side by side; either way only the separator at the value is
+		// collapsed, so "//" inside a value (S3 keys, URLs) is kept.
+		if strings.HasSuffix(arn.String(), "/") {
+			if value == "" && strings.HasPrefix(template[last:], "/") {
+				last++
+			}
+			value = strings.TrimPrefix(value, "/")
+		}
+		arn.WriteString(value)
+	}
+	arn.WriteString(template[last:])
+
+	rendered := arn.String()
+	for strings.Contains(rendered, "**") {
+		rendered = strings.ReplaceAll(rendered, "**", "*")
+	}
+	return rendered
+}
+
+// arnTemplateValue is the value of the placeholder match, named name with
+// the default fallback, in renderARNTemplate.
+func arnTemplateValue(name, match, fallback string, resource *Resource, ctx arnContext) string {
+	switch name {
+	case "partition":
+		return ctx.Partition
+	case "region":
+		return ctx.Region
+	case "account":
+		return ctx.Account
+	}
+	if resource != nil {
+		if value, ok := arnAttributeValue(resource, name); ok {
+			// OIDC provider ARNs name the issuer URL without its scheme
+			value = strings.TrimPrefix(value, "https://")
+			return replaceEnvironment(value, ctx.Environment, ctx.EnvironmentToken)
+		}
+	}
+	if strings.Contains(match, ":-") {
+		return fallback
 	}
 	return "*"
 }
 
+// knownStringAttribute returns a resource attribute as a string when its value
+// is a literal known at parse time.
+func knownStringAttribute(resource *Resource, name string) (string, bool) {
+	val, ok := resource.Attributes[name]
+	if !ok || val.IsNull() || !val.IsKnown() || val.Type() != cty.String {
+		return "", false
+	}
+	return val.AsString(), true
+}
+
+// arnTemplateService returns the service segment of an ARN template.
+func arnTemplateService(template string) string {
+	parts := strings.SplitN(template, ":", 4)
+	if len(parts) < 3 {
+		return ""
+	}
+	return parts[2]
+}
+
+// serviceARNs tracks the concrete ARNs rendered for each service in
+// least-privilege mode. A service is only scoped to those ARNs when every one
+// of its actions came from a resource whose ARN template targets that service;
+// otherwise it falls back to the service-wide default.
+type serviceARNs struct {
+	arns     map[string]map[string]bool
+	unscoped map[string]bool
+}
+
+func newServiceARNs() *serviceARNs {
+	return &serviceARNs{
+		arns:     make(map[string]map[string]bool),
+		unscoped: make(map[string]bool),
+	}
+}
+
+// addResource records the ARNs a resource contributes for each of its
+// actions: every form in its entry's arn_template and arn_templates that
+// targets the action's service (see resourceARNs for data sources). Actions
+// in scopedElsewhere, which inferred permissions already scope to the
+// resources referred to, are left to those permissions and neither add the
+// resource's ARNs nor fall back to the service-wide ARN. Wildcard-only
+// actions are granted on "*" in a statement of their own and add no ARNs
+// either.
+func (s *serviceARNs) addResource(resource Resource, actions []string, scopedElsewhere map[string]bool) {
+	rendered := resourceARNs(&resource, defaultARNContext)
+	for _, action := range actions {
+		if scopedElsewhere[action] || isWildcardOnlyAction(action) {
+			continue
+		}
+		service := strings.SplitN(action, ":", 2)[0]
+		var arns []string
+		for _, arn := range rendered {
+			if arnTemplateService(arn) == service {
+				arns = append(arns, arn)
+			}
+		}
+		if len(arns) == 0 {
+			s.unscoped[service] = true
+			continue
+		}
+		s.addARNs(action, arns)
+	}
+}
+
+// addARNs records ARNs for the action's service.
+func (s *serviceARNs) addARNs(action string, arns []string) {
+	service := strings.SplitN(action, ":", 2)[0]
+	if s.arns[service] == nil {
+		s.arns[service] = make(map[string]bool)
+	}
+	for _, arn := range arns {
+		s.arns[service][arn] = true
+	}
+}
+
+// addUnscoped marks the action's service as needing the service-wide ARN.
+func (s *serviceARNs) addUnscoped(action string) {
+	s.unscoped[strings.SplitN(action, ":", 2)[0]] = true
+}
+
+// resourceFor returns the Resource element for a service's statement: the
+// rendered ARNs when the service is fully scoped, otherwise the default. A
+// single ARN is returned as a string, several as a sorted list.
+func (s *serviceARNs) resourceFor(service string) interface{} {
+	var arns []string
+	if s.unscoped[service] || len(s.arns[service]) == 0 {
+		arns = getResourceARNForService(service)
+	} else {
+		for arn := range s.arns[service] {
+			arns = append(arns, arn)
+		}
+		sort.Strings(arns)
+	}
+	if len(arns) == 1 {
+		return arns[0]
+	}
+	return arns
+}
+
 // addBackendPermissions adds the appropriate IAM permissions for the detected state backend.
 func addBackendPermissions(actions map[string]bool, backend *BackendConfig) {
 	if backend == nil {
@@ -463,6 +864,8 @@ func addBackendPermissions(actions map[string]bool, backend *BackendConfig) {
 	case "gcs", "azurerm", "consul", "kubernetes", "oss", "pg", "http", "local":
 		// Non-AWS backends — no additional IAM permissions needed
 		// Note it but don't add anything
+	case backendCloud, backendRemote:
+		// State lives in HCP Terraform; see hcpTerraformAccess
 	default:
 		// Unknown backend type — add common S3/DynamoDB defaults conservatively
 		backendActions := []string{
@@ -475,43 +878,139 @@ func addBackendPermissions(actions map[string]bool, backend *BackendConfig) {
 	}
 }
 
+// writeTerraformList writes a policy element (string or list) as an HCL list
+// attribute. Empty elements are omitted.
+func writeTerraformList(sb *strings.Builder, name string, value interface{}) {
+	switch v := value.(type) {
+	case []string:
+		if len(v) > 0 {
+			fmt.Fprintf(sb, "    %s = [\n", name)
+			for _, item := range v {
+				fmt.Fprintf(sb, "      \"%s\",\n", item)
+			}
+			sb.WriteString("    ]\n")
+		}
+	case string:
+		fmt.Fprintf(sb, "    %s = [\"%s\"]\n", name, v)
+	}
+}
+
+// writeTerraformConditions writes IAM conditions as condition blocks, sorted
+// by operator and key for deterministic output.
+func writeTerraformConditions(sb *strings.Builder, conditions map[string]map[string]interface{}) {
+	operators := make([]string, 0, len(conditions))
+	for operator := range conditions {
+		operators = append(operators, operator)
+	}
+	sort.Strings(operators)
+
+	for _, operator := range operators {
+		keys := make([]string, 0, len(conditions[operator]))
+		for key := range conditions[operator] {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			sb.WriteString("    condition {\n")
+			fmt.Fprintf(sb, "      test     = \"%s\"\n", operator)
+			fmt.Fprintf(sb, "      variable = \"%s\"\n", key)
+			sb.WriteString("      values   = [")
+			for i, value := range conditionValues(conditions[operator][key]) {
+				if i > 0 {
+					sb.WriteString(", ")
+				}
+				fmt.Fprintf(sb, "\"%s\"", value)
+			}
+			sb.WriteString("]\n")
+			sb.WriteString("    }\n")
+		}
+	}
+}
+
+// conditionValues flattens a condition value (string, bool, number or list)
+// into strings.
+func conditionValues(value interface{}) []string {
+	switch v := value.(type) {
+	case []interface{}:
+		out := make([]string, 0, len(v))
+		for _, item := range v {
+			out = append(out, fmt.Sprint(item))
+		}
+		return out
+	case []string:
+		return v
+	default:
+		return []string{fmt.Sprint(v)}
+	}
+}
+
+// terraformOutput renders policy in the terraform format selected by the
+// flags: the policy document alone with --document-only, attached to a role
+// with --attach-to-role, or as a managed policy.
+// An OIDC role template for the --oidc-* CI systems follows the policy.
+func terraformOutput(policy IAMPolicy, comments [][]string) (string, error) {
+	var oidcRole string
+	if providers := oidcProviders(); len(providers) > 0 {
+		oidcRole = terraformOIDCRole(providers, documentOnlyFlag)
+	}
+	switch {
+	case documentOnlyFlag:
+		return terraformPolicyDocument(policy, comments) + oidcRole, nil
+	case attachToRoleFlag != "":
+		return generateRoleAttachmentOutput(policy, comments, attachToRoleFlag)
+	}
+	return generateAnnotatedTerraformOutput(policy, comments) + oidcRole, nil
+}
+
 // generateTerraformOutput generates Terraform HCL output
-func generateTerraformOutput(statements []IAMStatement) string {
+func generateTerraformOutput(policy IAMPolicy) string {
+	return generateAnnotatedTerraformOutput(policy, nil)
+}
+
+// generateAnnotatedTerraformOutput generates Terraform HCL output with
+// comments[i], when present, as comment lines above statement i.
+func generateAnnotatedTerraformOutput(policy IAMPolicy, comments [][]string) string {
 	var sb strings.Builder
+	sb.WriteString(terraformPolicyDocument(policy, comments))
+	sb.WriteString("\nresource \"aws_iam_policy\" \"generated\" {\n")
+	fmt.Fprintf(&sb, "  name   = \"%s\"\n", terraformPolicyName)
+	sb.WriteString("  policy = data.aws_iam_policy_document.generated.json\n")
+	sb.WriteString("}\n")
+	return sb.String()
+}
+
+// terraformPolicyDocument renders policy as the aws_iam_policy_document data
+// source the Terraform output's resources refer to.
+func terraformPolicyDocument(policy IAMPolicy, comments [][]string) string {
+	var sb strings.Builder
+	statements := policy.Statement
 
 	sb.WriteString("data \"aws_iam_policy_document\" \"generated\" {\n")
+	if policy.Version != "" && policy.Version != defaultPolicyVersion {
+		fmt.Fprintf(&sb, "  version = \"%s\"\n\n", policy.Version)
+	}
+	if policy.Id != "" {
+		fmt.Fprintf(&sb, "  policy_id = \"%s\"\n\n", policy.Id)
+	}
 
 	for i, statement := range statements {
-		sb.WriteString("  statement {\n")
-		fmt.Fprintf(&sb, "    effect = \"%s\"\n", statement.Effect)
-
-		// Handle Action (can be string or array)
-		switch v := statement.Action.(type) {
-		case []string:
-			if len(v) > 0 {
-				sb.WriteString("    actions = [\n")
-				for _, action := range v {
-					fmt.Fprintf(&sb, "      \"%s\",\n", action)
-				}
-				sb.WriteString("    ]\n")
+		if i < len(comments) {
+			for _, line := range comments[i] {
+				fmt.Fprintf(&sb, "  # %s\n", line)
 			}
-		case string:
-			fmt.Fprintf(&sb, "    actions = [\"%s\"]\n", v)
 		}
-
-		// Handle Resource
-		switch v := statement.Resource.(type) {
-		case []string:
-			if len(v) > 0 {
-				sb.WriteString("    resources = [\n")
-				for _, resource := range v {
-					fmt.Fprintf(&sb, "      \"%s\",\n", resource)
-				}
-				sb.WriteString("    ]\n")
-			}
-		case string:
-			fmt.Fprintf(&sb, "    resources = [\"%s\"]\n", v)
+		sb.WriteString("  statement {\n")
+		if statement.Sid != "" {
+			fmt.Fprintf(&sb, "    sid    = \"%s\"\n", statement.Sid)
 		}
+		fmt.Fprintf(&sb, "    effect = \"%s\"\n", statement.Effect)
+
+		writeTerraformList(&sb, "actions", statement.Action)
+		writeTerraformList(&sb, "not_actions", statement.NotAction)
+		writeTerraformList(&sb, "resources", statement.Resource)
+		writeTerraformList(&sb, "not_resources", statement.NotResource)
+		writeTerraformConditions(&sb, statement.Condition)
 
 		sb.WriteString("  }")
 		if i < len(statements)-1 {
@@ -520,10 +1019,5 @@ func generateTerraformOutput(statements []IAMStatement) string {
 	}
 
 	sb.WriteString("\n}\n")
-	sb.WriteString("\nresource \"aws_iam_policy\" \"generated\" {\n")
-	sb.WriteString("  name   = \"tf-iam-scanner-generated\"\n")
-	sb.WriteString("  policy = data.aws_iam_policy_document.generated.json\n")
-	sb.WriteString("}\n")
-
 	return sb.String()
 }
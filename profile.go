@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+)
+
+var profileOutFlag string
+
+// Profiles --profile-out writes to its directory, for go tool pprof.
+const (
+	cpuProfileFile  = "cpu.pprof"
+	heapProfileFile = "heap.pprof"
+)
+
+// cpuProfile is the open CPU profile of the run, nil when --profile-out is
+// not set or the profiles were written.
+var cpuProfile *os.File
+
+// startProfiling starts the CPU profile of the run in dir, creating it.
+func startProfiling(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	file, err := os.Create(filepath.Join(dir, cpuProfileFile))
+	if err != nil {
+		return err
+	}
+	if err := pprof.StartCPUProfile(file); err != nil {
+		file.Close()
+		return err
+	}
+	cpuProfile = file
+	return nil
+}
+
+// stopProfiling writes the CPU profile and a heap profile next to it. It
+// runs once, whichever way the run ends; later calls do nothing.
+func stopProfiling() {
+	if cpuProfile == nil {
+		return
+	}
+	pprof.StopCPUProfile()
+	dir := filepath.Dir(cpuProfile.Name())
+	if err := cpuProfile.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: could not write the CPU profile: %v\n", err)
+	}
+	cpuProfile = nil
+
+	heap, err := os.Create(filepath.Join(dir, heapProfileFile))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: could not write the heap profile: %v\n", err)
+		return
+	}
+	defer heap.Close()
+	// Collect garbage first so the profile shows what the run still holds
+	runtime.GC()
+	if err := pprof.WriteHeapProfile(heap); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: could not write the heap profile: %v\n", err)
+		return
+	}
+	statusf("Profiles written to: %s\n", dir)
+}
+
+// exitRun writes the --profile-out profiles and exits with code. Steps of a
+// policy-generating run exit through it rather than os.Exit, which would
+// leave the CPU profile empty.
+func exitRun(code int) {
+	stopProfiling()
+	os.Exit(code)
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestProfiling(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "profiles")
+	if err := startProfiling(dir); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	stopProfiling()
+	// Exits that follow one another must not write the profiles twice
+	stopProfiling()
+
+	for _, name := range []string{cpuProfileFile, heapProfileFile} {
+		info, err := os.Stat(filepath.Join(dir, name))
+		if err != nil || info.Size() == 0 {
+			t.Errorf("Expected %s to be written, got %v", name, err)
+		}
+	}
+}
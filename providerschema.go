@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+var providerSchemaFlag string
+
+// awsProviderSchema is the hashicorp/aws part of terraform providers schema
+// -json output. Schemas are kept raw until a caller needs their attributes.
+type awsProviderSchema struct {
+	ResourceSchemas   map[string]json.RawMessage `json:"resource_schemas"`
+	DataSourceSchemas map[string]json.RawMessage `json:"data_source_schemas"`
+}
+
+// readAWSProviderSchema reads the hashicorp/aws provider from the output of
+// terraform providers schema -json.
+func readAWSProviderSchema(filePath string) (awsProviderSchema, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return awsProviderSchema{}, fmt.Errorf("error reading provider schema: %w", err)
+	}
+
+	var schema struct {
+		ProviderSchemas map[string]awsProviderSchema `json:"provider_schemas"`
+	}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return awsProviderSchema{}, fmt.Errorf("error parsing provider schema: %w", err)
+	}
+
+	for source, provider := range schema.ProviderSchemas {
+		if strings.HasSuffix(source, "hashicorp/aws") {
+			return provider, nil
+		}
+	}
+	return awsProviderSchema{}, fmt.Errorf("%s has no schema for the hashicorp/aws provider", filePath)
+}
+
+// schemaAttribute is one top-level attribute of a resource schema.
+type schemaAttribute struct {
+	Type     json.RawMessage `json:"type"`
+	Required bool            `json:"required"`
+	Optional bool            `json:"optional"`
+	Computed bool            `json:"computed"`
+}
+
+// isString reports whether the attribute holds a single string.
+func (a schemaAttribute) isString() bool {
+	return string(a.Type) == `"string"`
+}
+
+// resourceAttributeSchemas maps resource types to their attributes, as
+// loaded by --provider-schema. It is nil when no schema was given, in which
+// case ARN templates use the attribute names they were written with.
+var resourceAttributeSchemas map[string]map[string]schemaAttribute
+
+// loadResourceAttributeSchemas reads the resource attributes of the AWS
+// provider from a terraform providers schema -json file.
+func loadResourceAttributeSchemas(filePath string) (map[string]map[string]schemaAttribute, error) {
+	provider, err := readAWSProviderSchema(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	schemas := make(map[string]map[string]schemaAttribute, len(provider.ResourceSchemas))
+	for name, raw := range provider.ResourceSchemas {
+		var resource struct {
+			Block struct {
+				Attributes map[string]schemaAttribute `json:"attributes"`
+			} `json:"block"`
+		}
+		if err := json.Unmarshal(raw, &resource); err != nil {
+			return nil, fmt.Errorf("error parsing the schema of %s: %w", name, err)
+		}
+		schemas[name] = resource.Block.Attributes
+	}
+	return schemas, nil
+}
+
+// schemaIdentifierAttribute returns the attribute the user sets to name a
+// resource of resourceType, according to the provider schema: a required
+// string attribute called "name" or ending in "_name", else one called
+// "identifier" or ending in "_identifier". It returns "" when the schema has
+// no such attribute or was not loaded.
+func schemaIdentifierAttribute(resourceType string) string {
+	attributes := resourceAttributeSchemas[resourceType]
+	var candidates []string
+	for name, attribute := range attributes {
+		if attribute.Required && attribute.isString() {
+			candidates = append(candidates, name)
+		}
+	}
+
+	for _, match := range []func(string) bool{
+		func(name string) bool { return name == "name" },
+		func(name string) bool { return strings.HasSuffix(name, "_name") },
+		func(name string) bool { return name == "identifier" },
+		func(name string) bool { return strings.HasSuffix(name, "_identifier") },
+	} {
+		var found []string
+		for _, name := range candidates {
+			if match(name) {
+				found = append(found, name)
+			}
+		}
+		// Several matches, e.g. a table_name and a database_name, are
+		// ambiguous; leave the placeholder open rather than guess.
+		if len(found) == 1 {
+			return found[0]
+		}
+		if len(found) > 1 {
+			return ""
+		}
+	}
+	return ""
+}
+
+// arnAttributeValue returns the value an ARN template placeholder takes from
+// a resource. Without a provider schema this is the attribute named by the
+// placeholder. With one, a placeholder the resource's schema does not define
+// (an attribute renamed in this provider version) takes the schema's
+// identifier attribute instead, and an unset attribute whose "_prefix"
+// variant is set renders as that prefix followed by "*".
+func arnAttributeValue(resource *Resource, name string) (string, bool) {
+	if value, ok := knownStringAttribute(resource, name); ok {
+		return value, true
+	}
+
+	attributes, ok := resourceAttributeSchemas[resource.Type]
+	if !ok {
+		return "", false
+	}
+	if _, defined := attributes[name]; !defined {
+		if identifier := schemaIdentifierAttribute(resource.Type); identifier != "" {
+			if value, ok := knownStringAttribute(resource, identifier); ok {
+				return value, true
+			}
+			name = identifier
+		}
+	}
+	if _, defined := attributes[name+"_prefix"]; defined {
+		if prefix, ok := knownStringAttribute(resource, name+"_prefix"); ok {
+			return prefix + "*", true
+		}
+	}
+	return "", false
+}
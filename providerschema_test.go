@@ -0,0 +1,85 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+const testProviderSchema = `{
+  "format_version": "1.0",
+  "provider_schemas": {
+    "registry.terraform.io/hashicorp/aws": {
+      "resource_schemas": {
+        "aws_cloudwatch_log_group": {"block": {"attributes": {
+          "arn": {"type": "string", "computed": true},
+          "name": {"type": "string", "optional": true, "computed": true},
+          "name_prefix": {"type": "string", "optional": true, "computed": true}
+        }}},
+        "aws_ecr_repository": {"block": {"attributes": {
+          "arn": {"type": "string", "computed": true},
+          "repository_name": {"type": "string", "required": true}
+        }}},
+        "aws_glue_catalog_table": {"block": {"attributes": {
+          "table_name": {"type": "string", "required": true},
+          "database_name": {"type": "string", "required": true}
+        }}}
+      }
+    }
+  }
+}`
+
+func TestARNAttributeValueWithProviderSchema(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "schema.json")
+	if err := os.WriteFile(file, []byte(testProviderSchema), 0644); err != nil {
+		t.Fatal(err)
+	}
+	schemas, err := loadResourceAttributeSchemas(file)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	t.Cleanup(func() { resourceAttributeSchemas = nil })
+
+	logGroup := &Resource{Type: "aws_cloudwatch_log_group", Attributes: map[string]cty.Value{
+		"name_prefix": cty.StringVal("/app/"),
+	}}
+	renamed := &Resource{Type: "aws_ecr_repository", Attributes: map[string]cty.Value{
+		"repository_name": cty.StringVal("web"),
+	}}
+	ambiguous := &Resource{Type: "aws_glue_catalog_table", Attributes: map[string]cty.Value{
+		"table_name":    cty.StringVal("events"),
+		"database_name": cty.StringVal("analytics"),
+	}}
+	logGroupTemplate := "arn:${partition}:logs:${region}:${account}:log-group:${name}"
+	repositoryTemplate := "arn:${partition}:ecr:${region}:${account}:repository/${name}"
+
+	if got := renderARNTemplate(repositoryTemplate, renamed, defaultARNContext); got != "arn:aws:ecr:*:*:repository/*" {
+		t.Errorf("Without a schema the placeholder should stay open, got %s", got)
+	}
+
+	resourceAttributeSchemas = schemas
+	if got := renderARNTemplate(logGroupTemplate, logGroup, defaultARNContext); got != "arn:aws:logs:*:*:log-group:/app/*" {
+		t.Errorf("Expected the name_prefix to scope the ARN, got %s", got)
+	}
+	if got := renderARNTemplate(repositoryTemplate, renamed, defaultARNContext); got != "arn:aws:ecr:*:*:repository/web" {
+		t.Errorf("Expected the schema's identifier attribute, got %s", got)
+	}
+	if got, ok := arnAttributeValue(ambiguous, "name"); ok {
+		t.Errorf("Several *_name attributes should leave the placeholder open, got %s", got)
+	}
+}
+
+func TestLoadResourceAttributeSchemasErrors(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "schema.json")
+	if err := os.WriteFile(file, []byte(`{"provider_schemas": {"registry.terraform.io/hashicorp/google": {}}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadResourceAttributeSchemas(file); err == nil {
+		t.Errorf("Expected an error for a schema without the AWS provider")
+	}
+	if _, err := loadResourceAttributeSchemas(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Errorf("Expected an error for a missing file")
+	}
+}
@@ -0,0 +1,419 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudtrail"
+	cloudtrailtypes "github.com/aws/aws-sdk-go-v2/service/cloudtrail/types"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/spf13/cobra"
+)
+
+// Classifications of an action the generated policy no longer grants.
+const (
+	PruneSafe        = "safe-to-remove"
+	PruneInvestigate = "needs-investigation"
+)
+
+// maxEventHistoryDays is how far back the CloudTrail event history goes.
+const maxEventHistoryDays = 90
+
+// maxLookupPages bounds the event history pages read per action, for actions
+// other principals call so often that the role's calls could be far back.
+const maxLookupPages = 20
+
+// globalEventRegion records the events of global services in its history.
+const globalEventRegion = "us-east-1"
+
+var (
+	pruneCurrentFlag   string
+	prunePolicyARNFlag string
+	pruneRoleARNFlag   string
+	pruneLookbackFlag  int
+	pruneJSONFlag      bool
+)
+
+var pruneCheckCmd = &cobra.Command{
+	Use:   "prune-check (--policy-arn ARN | --current current.json) generated.json",
+	Short: "Classify the actions a generated policy would remove as safe to remove or needing investigation",
+	Long: `Compare the policy attached today with a freshly generated one and list
+every action the generated policy no longer grants, read from a file or from
+stdin ("-"). The current policy is the default version of the managed policy
+--policy-arn, or the document in --current.
+
+With --role-arn, the CloudTrail event history of the last --lookback-days
+(at most 90) is searched for calls of each action by the role. Actions it
+has not called are safe to remove; actions it called, and actions the event
+history cannot show (data events such as s3:GetObject, and permissions such
+as iam:PassRole that are not API calls), need investigation. Without
+--role-arn every action needs investigation.
+
+The event history is regional: it is read in --region, and in us-east-1 for
+global services such as IAM. The caller needs cloudtrail:LookupEvents, and
+iam:GetPolicy and iam:GetPolicyVersion with --policy-arn.
+
+Example:
+  tf-iam-scanner --path ./terraform --output generated.json
+  tf-iam-scanner prune-check --policy-arn arn:aws:iam::123456789012:policy/terraform-ci \
+    --role-arn arn:aws:iam::123456789012:role/terraform-ci generated.json`,
+	Args: cobra.ExactArgs(1),
+	Run:  runPruneCheck,
+}
+
+func init() {
+	pruneCheckCmd.Flags().StringVar(&pruneCurrentFlag, "current", "", "File holding the currently attached policy")
+	pruneCheckCmd.Flags().StringVar(&prunePolicyARNFlag, "policy-arn", "", "ARN of the managed policy attached today (its default version is compared)")
+	pruneCheckCmd.Flags().StringVar(&pruneRoleARNFlag, "role-arn", "", "Search CloudTrail for calls of the removed actions by this role")
+	pruneCheckCmd.Flags().IntVar(&pruneLookbackFlag, "lookback-days", maxEventHistoryDays, "Days of CloudTrail event history to search (at most 90)")
+	pruneCheckCmd.Flags().BoolVar(&pruneJSONFlag, "json", false, "Print the classification as JSON")
+	addAWSFlags(pruneCheckCmd.Flags())
+	pruneCheckCmd.MarkFlagsMutuallyExclusive("current", "policy-arn")
+	pruneCheckCmd.MarkFlagsOneRequired("current", "policy-arn")
+	rootCmd.AddCommand(pruneCheckCmd)
+}
+
+// cloudTrailLookupAPI is the part of the CloudTrail client used by
+// prune-check.
+type cloudTrailLookupAPI interface {
+	LookupEvents(ctx context.Context, params *cloudtrail.LookupEventsInput, optFns ...func(*cloudtrail.Options)) (*cloudtrail.LookupEventsOutput, error)
+}
+
+// cloudTrailHiddenActions are actions whose use the CloudTrail event history
+// cannot show: data events, which are only recorded by trails with data
+// event selectors, and permissions checked without an API call of their own.
+var cloudTrailHiddenActions = map[string]string{
+	"s3:GetObject*":                      "a data event, not in the event history",
+	"s3:PutObject*":                      "a data event, not in the event history",
+	"s3:DeleteObject*":                   "a data event, not in the event history",
+	"s3:ListBucket*":                     "a data event, not in the event history",
+	"s3:AbortMultipartUpload":            "a data event, not in the event history",
+	"s3:ListMultipartUploadParts":        "a data event, not in the event history",
+	"s3:RestoreObject":                   "a data event, not in the event history",
+	"lambda:InvokeFunction":              "a data event, not in the event history",
+	"dynamodb:*Item":                     "a data event, not in the event history",
+	"dynamodb:Query":                     "a data event, not in the event history",
+	"dynamodb:Scan":                      "a data event, not in the event history",
+	"sqs:SendMessage":                    "a data event, not in the event history",
+	"sqs:ReceiveMessage":                 "a data event, not in the event history",
+	"sqs:DeleteMessage":                  "a data event, not in the event history",
+	"sns:Publish":                        "a data event, not in the event history",
+	"kinesis:PutRecord*":                 "a data event, not in the event history",
+	"kinesis:GetRecords":                 "a data event, not in the event history",
+	"iam:PassRole":                       "a permission checked by other calls, not an API call",
+	"ec2:CreateTags":                     "also checked when resources are tagged on creation, without a call of its own",
+	"kms:GenerateDataKey*":               "often called by other services on the role's behalf",
+	"kms:Decrypt":                        "often called by other services on the role's behalf",
+	"secretsmanager:GetSecretValue":      "often called by other services on the role's behalf",
+	"ssm:GetParameter*":                  "often called by other services on the role's behalf",
+	"elasticfilesystem:ClientMount":      "a permission checked by the file system, not an API call",
+	"elasticfilesystem:ClientWrite":      "a permission checked by the file system, not an API call",
+	"elasticfilesystem:ClientRootAccess": "a permission checked by the file system, not an API call",
+}
+
+// globalEventServices are the services whose events are recorded in the
+// event history of globalEventRegion.
+var globalEventServices = map[string]bool{
+	"iam": true, "cloudfront": true, "route53": true, "organizations": true, "waf": true,
+}
+
+// eventSources maps the service prefixes whose events carry a different
+// source than "<prefix>.amazonaws.com".
+var eventSources = map[string]string{
+	"cloudwatch": "monitoring.amazonaws.com",
+	"es":         "es.amazonaws.com",
+	"tag":        "tagging.amazonaws.com",
+}
+
+// PruneFinding is the classification of one action the generated policy no
+// longer grants. LastUsed is the role's most recent call found.
+type PruneFinding struct {
+	Action         string     `json:"action"`
+	Classification string     `json:"classification"`
+	Reason         string     `json:"reason"`
+	LastUsed       *time.Time `json:"last_used,omitempty"`
+}
+
+// PruneReport is the result of prune-check.
+type PruneReport struct {
+	RoleARN      string         `json:"role_arn,omitempty"`
+	LookbackDays int            `json:"lookback_days,omitempty"`
+	Removed      []PruneFinding `json:"removed"`
+}
+
+func runPruneCheck(cmd *cobra.Command, args []string) {
+	if pruneLookbackFlag < 1 || pruneLookbackFlag > maxEventHistoryDays {
+		fmt.Fprintf(os.Stderr, "Error: --lookback-days must be between 1 and %d, the retention of the CloudTrail event history\n", maxEventHistoryDays)
+		os.Exit(1)
+	}
+	if err := validateAWSFlags(awsFlags); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := loadActionCatalog(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	generated, err := readPolicyDocument(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	ctx := cmd.Context()
+	var cfg aws.Config
+	if prunePolicyARNFlag != "" || pruneRoleARNFlag != "" {
+		cfg, err = loadAWSConfig(ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	var current IAMPolicy
+	if prunePolicyARNFlag != "" {
+		current, _, err = readDefaultPolicyVersion(ctx, iam.NewFromConfig(cfg), prunePolicyARNFlag)
+	} else {
+		current, err = readPolicyDocument(pruneCurrentFlag)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	report := PruneReport{Removed: []PruneFinding{}}
+	removed := removedActions(current, generated)
+	if pruneRoleARNFlag != "" {
+		report.RoleARN = pruneRoleARNFlag
+		report.LookbackDays = pruneLookbackFlag
+		clients := map[string]cloudTrailLookupAPI{
+			cfg.Region:        cloudtrail.NewFromConfig(cfg),
+			globalEventRegion: cloudtrail.NewFromConfig(cfg, func(o *cloudtrail.Options) { o.Region = globalEventRegion }),
+		}
+		since := time.Now().AddDate(0, 0, -pruneLookbackFlag)
+		report.Removed, err = classifyRemovedActions(ctx, removed, func(action string) cloudTrailLookupAPI {
+			service, _, _ := strings.Cut(action, ":")
+			if globalEventServices[service] {
+				return clients[globalEventRegion]
+			}
+			return clients[cfg.Region]
+		}, pruneRoleARNFlag, since)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	} else {
+		for _, action := range removed {
+			report.Removed = append(report.Removed, PruneFinding{Action: action, Classification: PruneInvestigate, Reason: "usage not checked (no --role-arn)"})
+		}
+	}
+
+	if pruneJSONFlag {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(data))
+		return
+	}
+	printPruneReport(report)
+}
+
+// readPolicyDocument reads a policy document from path, or from stdin for
+// "-".
+func readPolicyDocument(path string) (IAMPolicy, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return IAMPolicy{}, fmt.Errorf("error reading policy: %w", err)
+	}
+	policy, _, err := lintPolicy(data)
+	if err != nil {
+		return IAMPolicy{}, fmt.Errorf("error parsing %s: %w", path, err)
+	}
+	return policy, nil
+}
+
+// removedActions returns the actions current allows and generated does not,
+// sorted. Wildcards in current are expanded through the catalog, and
+// resources and conditions are not compared: an action counts as kept when
+// any Allow statement of generated grants it.
+func removedActions(current, generated IAMPolicy) []string {
+	var granted []string
+	for _, statement := range generated.Statement {
+		if statement.Effect == "Allow" && statement.NotAction == nil {
+			granted = append(granted, toStringSlice(statement.Action)...)
+		}
+	}
+
+	removed := make(map[string]bool)
+	for _, statement := range current.Statement {
+		if statement.Effect != "Allow" || statement.NotAction != nil {
+			continue
+		}
+		for _, action := range toStringSlice(statement.Action) {
+			actions := []string{action}
+			if strings.ContainsAny(action, "*?") {
+				if expanded := expandActionPattern(action); len(expanded) > 0 {
+					actions = expanded
+				}
+			} else if canonical, _, ok := lookupAction(action); ok {
+				actions = []string{canonical}
+			}
+			for _, a := range actions {
+				if !matchesAny(granted, a, true) {
+					removed[a] = true
+				}
+			}
+		}
+	}
+	return sortedSet(removed)
+}
+
+// classifyRemovedActions searches the event history of the client returned
+// by lookup for each action's calls by roleARN since the given time.
+func classifyRemovedActions(ctx context.Context, actions []string, lookup func(action string) cloudTrailLookupAPI, roleARN string, since time.Time) ([]PruneFinding, error) {
+	var findings []PruneFinding
+	for _, action := range actions {
+		finding := PruneFinding{Action: action, Classification: PruneInvestigate}
+		if reason := hiddenActionReason(action); reason != "" {
+			finding.Reason = reason
+			findings = append(findings, finding)
+			continue
+		}
+		if strings.ContainsAny(action, "*?") {
+			finding.Reason = "a wildcard the action catalog cannot expand"
+			findings = append(findings, finding)
+			continue
+		}
+
+		lastUsed, complete, err := lastCallByRole(ctx, lookup(action), action, roleARN, since)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case lastUsed != nil:
+			finding.LastUsed = lastUsed
+			finding.Reason = "called by the role on " + lastUsed.Format("2006-01-02")
+		case !complete:
+			finding.Reason = fmt.Sprintf("not found in the first %d pages of events by other principals", maxLookupPages)
+		default:
+			finding.Classification = PruneSafe
+			finding.Reason = "not called by the role in the lookback window"
+		}
+		findings = append(findings, finding)
+	}
+	return findings, nil
+}
+
+// hiddenActionReason explains why the event history cannot show calls of
+// action, or returns "".
+func hiddenActionReason(action string) string {
+	patterns := make([]string, 0, len(cloudTrailHiddenActions))
+	for pattern := range cloudTrailHiddenActions {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+	for _, pattern := range patterns {
+		if iamWildcardMatch(pattern, action, true) {
+			return cloudTrailHiddenActions[pattern]
+		}
+	}
+	return ""
+}
+
+// lastCallByRole returns the time of the most recent event of action made
+// by roleARN since the given time, or nil. complete is false when the search
+// stopped at maxLookupPages without a match.
+func lastCallByRole(ctx context.Context, client cloudTrailLookupAPI, action, roleARN string, since time.Time) (*time.Time, bool, error) {
+	service, name, _ := strings.Cut(action, ":")
+	source := service + ".amazonaws.com"
+	if s, ok := eventSources[service]; ok {
+		source = s
+	}
+
+	input := &cloudtrail.LookupEventsInput{
+		LookupAttributes: []cloudtrailtypes.LookupAttribute{{
+			AttributeKey:   cloudtrailtypes.LookupAttributeKeyEventName,
+			AttributeValue: aws.String(name),
+		}},
+		StartTime: aws.Time(since),
+	}
+	for page := 0; page < maxLookupPages; page++ {
+		output, err := client.LookupEvents(ctx, input)
+		if err != nil {
+			return nil, false, fmt.Errorf("error looking up %s events: %w", action, err)
+		}
+		// The history is returned newest first
+		for _, event := range output.Events {
+			if aws.ToString(event.EventSource) == source && eventByRole(aws.ToString(event.CloudTrailEvent), roleARN) {
+				return event.EventTime, true, nil
+			}
+		}
+		if output.NextToken == nil {
+			return nil, true, nil
+		}
+		input.NextToken = output.NextToken
+	}
+	return nil, false, nil
+}
+
+// eventByRole reports whether the CloudTrail event record was made by
+// roleARN itself or by one of its sessions.
+func eventByRole(record, roleARN string) bool {
+	var event struct {
+		UserIdentity struct {
+			ARN            string `json:"arn"`
+			SessionContext struct {
+				SessionIssuer struct {
+					ARN string `json:"arn"`
+				} `json:"sessionIssuer"`
+			} `json:"sessionContext"`
+		} `json:"userIdentity"`
+	}
+	if err := json.Unmarshal([]byte(record), &event); err != nil {
+		return false
+	}
+	return event.UserIdentity.ARN == roleARN || event.UserIdentity.SessionContext.SessionIssuer.ARN == roleARN
+}
+
+func printPruneReport(report PruneReport) {
+	if len(report.Removed) == 0 {
+		fmt.Fprintf(os.Stderr, "The generated policy removes no actions\n")
+		return
+	}
+	for _, classification := range []string{PruneSafe, PruneInvestigate} {
+		var findings []PruneFinding
+		for _, finding := range report.Removed {
+			if finding.Classification == classification {
+				findings = append(findings, finding)
+			}
+		}
+		if len(findings) == 0 {
+			continue
+		}
+		fmt.Printf("%s (%d):\n", classification, len(findings))
+		for _, finding := range findings {
+			fmt.Printf("  %-45s %s\n", finding.Action, finding.Reason)
+		}
+	}
+	if report.RoleARN != "" {
+		fmt.Fprintf(os.Stderr, "%d action(s) removed; CloudTrail searched for calls by %s in the last %d days\n",
+			len(report.Removed), report.RoleARN, report.LookbackDays)
+	} else {
+		fmt.Fprintf(os.Stderr, "%d action(s) removed; pass --role-arn to check their recent use in CloudTrail\n", len(report.Removed))
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudtrail"
+	cloudtrailtypes "github.com/aws/aws-sdk-go-v2/service/cloudtrail/types"
+)
+
+const testRoleARN = "arn:aws:iam::123456789012:role/terraform-ci"
+
+// fakeEventHistory serves events by name, a page per call.
+type fakeEventHistory struct {
+	events map[string][][]cloudtrailtypes.Event
+	calls  int
+}
+
+func (f *fakeEventHistory) LookupEvents(ctx context.Context, params *cloudtrail.LookupEventsInput, optFns ...func(*cloudtrail.Options)) (*cloudtrail.LookupEventsOutput, error) {
+	f.calls++
+	name := aws.ToString(params.LookupAttributes[0].AttributeValue)
+	if name == "Broken" {
+		return nil, errors.New("ThrottlingException")
+	}
+	pages := f.events[name]
+	page := 0
+	if params.NextToken != nil {
+		fmt.Sscan(aws.ToString(params.NextToken), &page)
+	}
+	output := &cloudtrail.LookupEventsOutput{}
+	if page < len(pages) {
+		output.Events = pages[page]
+	}
+	if page+1 < len(pages) {
+		output.NextToken = aws.String(fmt.Sprint(page + 1))
+	}
+	return output, nil
+}
+
+func cloudTrailEvent(source, name, identity string, at time.Time) cloudtrailtypes.Event {
+	return cloudtrailtypes.Event{
+		EventName:       aws.String(name),
+		EventSource:     aws.String(source),
+		EventTime:       aws.Time(at),
+		CloudTrailEvent: aws.String(identity),
+	}
+}
+
+func TestRemovedActions(t *testing.T) {
+	if err := loadActionCatalog(); err != nil {
+		t.Fatalf("Error loading catalog: %v", err)
+	}
+	current := IAMPolicy{Statement: []IAMStatement{
+		{Effect: "Allow", Action: []string{"ec2:DescribeImages", "ec2:describeinstances", "sqs:*"}, Resource: "*"},
+		{Effect: "Deny", Action: "iam:*", Resource: "*"},
+	}}
+	generated := IAMPolicy{Statement: []IAMStatement{
+		{Effect: "Allow", Action: []string{"ec2:DescribeInstances", "sqs:Get*", "sqs:CreateQueue"}, Resource: "arn:aws:sqs:*:*:jobs"},
+	}}
+	removed := removedActions(current, generated)
+	if !containsString(removed, "ec2:DescribeImages") || !containsString(removed, "sqs:DeleteQueue") {
+		t.Errorf("Expected the dropped and the expanded actions, got %v", removed)
+	}
+	for _, action := range removed {
+		if action == "ec2:DescribeInstances" || strings.HasPrefix(action, "sqs:Get") || action == "sqs:CreateQueue" || strings.HasPrefix(action, "iam:") {
+			t.Errorf("Expected %s not to be removed, got %v", action, removed)
+		}
+	}
+}
+
+func TestClassifyRemovedActions(t *testing.T) {
+	now := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	byRole := `{"userIdentity":{"type":"AssumedRole","arn":"arn:aws:sts::123456789012:assumed-role/terraform-ci/ci","sessionContext":{"sessionIssuer":{"arn":"` + testRoleARN + `"}}}}`
+	byOther := `{"userIdentity":{"type":"AssumedRole","sessionContext":{"sessionIssuer":{"arn":"arn:aws:iam::123456789012:role/other"}}}}`
+
+	manyPages := make([][]cloudtrailtypes.Event, maxLookupPages+1)
+	for i := range manyPages {
+		manyPages[i] = []cloudtrailtypes.Event{cloudTrailEvent("ec2.amazonaws.com", "DescribeVpcs", byOther, now)}
+	}
+	history := &fakeEventHistory{events: map[string][][]cloudtrailtypes.Event{
+		"DescribeImages": {
+			{cloudTrailEvent("ec2.amazonaws.com", "DescribeImages", byOther, now)},
+			{cloudTrailEvent("ec2.amazonaws.com", "DescribeImages", byRole, now.AddDate(0, 0, -3))},
+		},
+		// Same event name, other service
+		"TagResource":  {{cloudTrailEvent("sqs.amazonaws.com", "TagResource", byRole, now)}},
+		"DescribeVpcs": manyPages,
+	}}
+	lookup := func(string) cloudTrailLookupAPI { return history }
+
+	actions := []string{"ec2:DescribeImages", "ec2:DescribeVpcs", "iam:PassRole", "lambda:TagResource", "s3:GetObjectVersion"}
+	findings, err := classifyRemovedActions(context.Background(), actions, lookup, testRoleARN, now.AddDate(0, 0, -90))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := map[string]string{
+		"ec2:DescribeImages":  PruneInvestigate,
+		"ec2:DescribeVpcs":    PruneInvestigate,
+		"iam:PassRole":        PruneInvestigate,
+		"lambda:TagResource":  PruneSafe,
+		"s3:GetObjectVersion": PruneInvestigate,
+	}
+	for _, finding := range findings {
+		if finding.Classification != want[finding.Action] {
+			t.Errorf("Expected %s to be %s, got %+v", finding.Action, want[finding.Action], finding)
+		}
+	}
+	if findings[0].LastUsed == nil || !findings[0].LastUsed.Equal(now.AddDate(0, 0, -3)) {
+		t.Errorf("Expected the role's call to be reported, got %+v", findings[0])
+	}
+	if !strings.Contains(findings[1].Reason, "first 20 pages") {
+		t.Errorf("Expected the search limit as the reason, got %q", findings[1].Reason)
+	}
+	if !strings.Contains(findings[4].Reason, "data event") {
+		t.Errorf("Expected data events to need investigation, got %q", findings[4].Reason)
+	}
+
+	if _, err := classifyRemovedActions(context.Background(), []string{"ec2:Broken"}, lookup, testRoleARN, now); err == nil || !strings.Contains(err.Error(), "ThrottlingException") {
+		t.Errorf("Expected lookup errors to be returned, got %v", err)
+	}
+}
+
+func TestEventByRole(t *testing.T) {
+	for record, want := range map[string]bool{
+		`{"userIdentity":{"type":"AssumedRole","sessionContext":{"sessionIssuer":{"arn":"` + testRoleARN + `"}}}}`: true,
+		`{"userIdentity":{"type":"Role","arn":"` + testRoleARN + `"}}`:                                             true,
+		`{"userIdentity":{"type":"IAMUser","arn":"arn:aws:iam::123456789012:user/terraform-ci"}}`:                  false,
+		`not json`: false,
+	} {
+		if got := eventByRole(record, testRoleARN); got != want {
+			t.Errorf("eventByRole(%s) = %v, want %v", record, got, want)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// pulumiResourceName is the logical name used for the generated policy in
+// Pulumi programs, matching the Terraform output's policy name.
+const pulumiResourceName = "tf-iam-scanner-generated"
+
+// generatePulumiTypeScript emits a Pulumi TypeScript program that creates an
+// aws.iam.Policy holding the generated document.
+func generatePulumiTypeScript(policy IAMPolicy) (string, error) {
+	document, err := json.MarshalIndent(policy, "    ", "    ")
+	if err != nil {
+		return "", fmt.Errorf("error marshaling policy for Pulumi: %w", err)
+	}
+
+	var sb strings.Builder
+	sb.WriteString("import * as aws from \"@pulumi/aws\";\n\n")
+	fmt.Fprintf(&sb, "const generatedPolicy = new aws.iam.Policy(\"%s\", {\n", pulumiResourceName)
+	fmt.Fprintf(&sb, "    name: \"%s\",\n", pulumiResourceName)
+	fmt.Fprintf(&sb, "    policy: JSON.stringify(%s),\n", document)
+	sb.WriteString("});\n\n")
+	sb.WriteString("export const generatedPolicyArn = generatedPolicy.arn;\n")
+	return sb.String(), nil
+}
+
+// generatePulumiPython emits a Pulumi Python program that creates an
+// aws.iam.Policy holding the generated document.
+func generatePulumiPython(policy IAMPolicy) (string, error) {
+	document, err := json.MarshalIndent(policy, "        ", "    ")
+	if err != nil {
+		return "", fmt.Errorf("error marshaling policy for Pulumi: %w", err)
+	}
+
+	var sb strings.Builder
+	sb.WriteString("import json\n\n")
+	sb.WriteString("import pulumi\n")
+	sb.WriteString("import pulumi_aws as aws\n\n")
+	sb.WriteString("generated_policy = aws.iam.Policy(\n")
+	fmt.Fprintf(&sb, "    \"%s\",\n", pulumiResourceName)
+	fmt.Fprintf(&sb, "    name=\"%s\",\n", pulumiResourceName)
+	sb.WriteString("    policy=json.dumps(\n")
+	fmt.Fprintf(&sb, "        %s\n", jsonToPythonLiteral(string(document)))
+	sb.WriteString("    ),\n")
+	sb.WriteString(")\n\n")
+	sb.WriteString("pulumi.export(\"generated_policy_arn\", generated_policy.arn)\n")
+	return sb.String(), nil
+}
+
+// jsonToPythonLiteral rewrites the JSON literals true, false and null outside
+// of strings into their Python spellings. Everything else in a JSON document
+// is already a valid Python expression.
+func jsonToPythonLiteral(document string) string {
+	replacements := map[string]string{"true": "True", "false": "False", "null": "None"}
+
+	var sb strings.Builder
+	inString := false
+	for i := 0; i < len(document); i++ {
+		c := document[i]
+		if inString {
+			sb.WriteByte(c)
+			if c == '\\' && i+1 < len(document) {
+				i++
+				sb.WriteByte(document[i])
+			} else if c == '"' {
+				inString = false
+			}
+			continue
+		}
+		if c == '"' {
+			inString = true
+			sb.WriteByte(c)
+			continue
+		}
+
+		replaced := false
+		for literal, python := range replacements {
+			if strings.HasPrefix(document[i:], literal) {
+				sb.WriteString(python)
+				i += len(literal) - 1
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String()
+}
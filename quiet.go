@@ -0,0 +1,21 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// quietFlag leaves only the artifact and what went wrong: the run summary,
+// progress and "written to" messages are dropped, while errors, warnings and
+// failed checks still go to stderr.
+var quietFlag bool
+
+// statusf prints a status message to stderr unless --quiet is set. Whatever
+// it prints, stdout carries only the artifact, so the policy can be piped
+// into another command.
+func statusf(format string, args ...interface{}) {
+	if quietFlag {
+		return
+	}
+	fmt.Fprintf(os.Stderr, format, args...)
+}
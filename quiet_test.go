@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// captureOutput runs fn with stdout and stderr redirected and returns what
+// was written to each.
+func captureOutput(t *testing.T, fn func()) (string, string) {
+	t.Helper()
+	capture := func(target **os.File) (func() string, error) {
+		r, w, err := os.Pipe()
+		if err != nil {
+			return nil, err
+		}
+		saved := *target
+		*target = w
+		var buf bytes.Buffer
+		done := make(chan struct{})
+		go func() {
+			_, _ = io.Copy(&buf, r)
+			close(done)
+		}()
+		return func() string {
+			w.Close()
+			<-done
+			*target = saved
+			return buf.String()
+		}, nil
+	}
+	stdout, err := capture(&os.Stdout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stderr, err := capture(&os.Stderr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fn()
+	return stdout(), stderr()
+}
+
+// runRootCommand runs the scanner with args and returns its stdout and stderr.
+func runRootCommand(t *testing.T, args ...string) (string, string) {
+	t.Helper()
+	defer func() {
+		rootCmd.SetArgs(nil)
+		quietFlag, outputFlag, pathFlag = false, "", nil
+	}()
+	return captureOutput(t, func() {
+		rootCmd.SetArgs(args)
+		if err := rootCmd.Execute(); err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+	})
+}
+
+func TestStdoutCarriesOnlyThePolicy(t *testing.T) {
+	stdout, stderr := runRootCommand(t, "--path", "test-fixtures/simple")
+	var policy IAMPolicy
+	if err := json.Unmarshal([]byte(stdout), &policy); err != nil {
+		t.Fatalf("Expected stdout to be exactly the policy, got %v:\n%s", err, stdout)
+	}
+	if len(policy.Statement) == 0 {
+		t.Errorf("Expected policy statements on stdout")
+	}
+	if !strings.Contains(stderr, "Summary:") {
+		t.Errorf("Expected the summary on stderr, got %q", stderr)
+	}
+
+	output := filepath.Join(t.TempDir(), "policy.json")
+	stdout, stderr = runRootCommand(t, "--path", "test-fixtures/simple", "--output", output)
+	if stdout != "" {
+		t.Errorf("Expected nothing on stdout when writing to a file, got %q", stdout)
+	}
+	if !strings.Contains(stderr, "IAM policy written to: "+output) {
+		t.Errorf("Expected the output file on stderr, got %q", stderr)
+	}
+}
+
+func TestQuiet(t *testing.T) {
+	stdout, stderr := runRootCommand(t, "--path", "test-fixtures/simple", "--quiet")
+	if !json.Valid([]byte(stdout)) {
+		t.Errorf("Expected the policy on stdout, got %q", stdout)
+	}
+	if stderr != "" {
+		t.Errorf("Expected nothing on stderr, got %q", stderr)
+	}
+
+	output := filepath.Join(t.TempDir(), "policy.json")
+	stdout, stderr = runRootCommand(t, "--path", "test-fixtures/simple", "--output", output, "--quiet")
+	if stdout != "" || stderr != "" {
+		t.Errorf("Expected no messages, got stdout %q and stderr %q", stdout, stderr)
+	}
+	if data, err := os.ReadFile(output); err != nil || !json.Valid(data) {
+		t.Errorf("Expected the policy in %s: %v", output, err)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+var splitReadWriteFlag bool
+
+// splitReadWrite splits each least-privilege service statement into a read
+// statement and a write statement, the layout security reviews usually ask
+// for. Read actions (List and Read access in the catalog, or read-only by
+// name when the catalog does not know them) are granted on the service-wide
+// ARN, since refreshing state reads more than the resources Terraform
+// manages; write actions keep the statement's scoped ARNs. Statements with a
+// Sid or a Condition are left alone.
+func splitReadWrite(policy IAMPolicy) IAMPolicy {
+	if actionCatalog == nil {
+		_ = loadActionCatalog()
+	}
+
+	var statements []IAMStatement
+	for _, statement := range policy.Statement {
+		actions := toStringSlice(statement.Action)
+		if statement.Effect != "Allow" || statement.Sid != "" || len(statement.Condition) > 0 || len(actions) == 0 {
+			statements = append(statements, statement)
+			continue
+		}
+
+		var reads, writes []string
+		for _, action := range actions {
+			if isReadAccessAction(action) {
+				reads = append(reads, action)
+			} else {
+				writes = append(writes, action)
+			}
+		}
+
+		service := strings.SplitN(actions[0], ":", 2)[0]
+		if len(reads) > 0 {
+			arns := getResourceARNForService(service)
+			var resource interface{} = arns
+			if len(arns) == 1 {
+				resource = arns[0]
+			}
+			statements = append(statements, IAMStatement{
+				Sid:      statementSid(service, "Read"),
+				Effect:   "Allow",
+				Action:   reads,
+				Resource: resource,
+			})
+		}
+		if len(writes) > 0 {
+			statements = append(statements, IAMStatement{
+				Sid:      statementSid(service, "Write"),
+				Effect:   "Allow",
+				Action:   writes,
+				Resource: statement.Resource,
+			})
+		}
+	}
+
+	policy.Statement = statements
+	return policy
+}
+
+// isReadAccessAction reports whether action only reads: its catalog access
+// level is List or Read, or, for actions the catalog does not know, its name
+// starts with a read-only verb.
+func isReadAccessAction(action string) bool {
+	if _, info, ok := lookupAction(action); ok {
+		return info.Access == AccessList || info.Access == AccessRead
+	}
+	return isReadOnlyAction(action)
+}
+
+// statementSid builds an alphanumeric Sid such as "AcmPcaRead" from a
+// service prefix and a suffix.
+func statementSid(service, suffix string) string {
+	var sb strings.Builder
+	upper := true
+	for _, r := range service {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String() + suffix
+}
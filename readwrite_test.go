@@ -0,0 +1,64 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSplitReadWrite(t *testing.T) {
+	if err := loadPermissionsDB(); err != nil {
+		t.Fatalf("Error loading permissions DB: %v", err)
+	}
+
+	policy := IAMPolicy{
+		Version: "2012-10-17",
+		Statement: []IAMStatement{
+			{Effect: "Allow", Action: []string{"sqs:CreateQueue", "sqs:GetQueueAttributes", "sqs:SetQueueAttributes"}, Resource: "arn:aws:sqs:*:*:orders"},
+			{Effect: "Allow", Action: []string{"acm-pca:DescribeCertificateAuthority"}, Resource: "arn:aws:acm-pca:*:*:certificate-authority/x"},
+			{Sid: wildcardOnlySid, Effect: "Allow", Action: []string{"sts:GetCallerIdentity"}, Resource: "*"},
+		},
+	}
+
+	split := splitReadWrite(policy)
+	if len(split.Statement) != 4 {
+		t.Fatalf("Expected 4 statements, got %+v", split.Statement)
+	}
+
+	read, write := split.Statement[0], split.Statement[1]
+	if read.Sid != "SqsRead" || strings.Join(toStringSlice(read.Action), ",") != "sqs:GetQueueAttributes" {
+		t.Errorf("Unexpected read statement: %+v", read)
+	}
+	if read.Resource != "arn:aws:sqs:*:*:*" {
+		t.Errorf("Reads should use the service-wide ARN, got %v", read.Resource)
+	}
+	if write.Sid != "SqsWrite" || write.Resource != "arn:aws:sqs:*:*:orders" ||
+		strings.Join(toStringSlice(write.Action), ",") != "sqs:CreateQueue,sqs:SetQueueAttributes" {
+		t.Errorf("Unexpected write statement: %+v", write)
+	}
+
+	if split.Statement[2].Sid != "AcmPcaRead" {
+		t.Errorf("A read-only service should only get a read statement, got %+v", split.Statement[2])
+	}
+	if split.Statement[3].Sid != wildcardOnlySid {
+		t.Errorf("Statements with a Sid should be kept, got %+v", split.Statement[3])
+	}
+}
+
+func TestIsReadAccessAction(t *testing.T) {
+	if err := loadActionCatalog(); err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]bool{
+		"s3:GetObject":          true,
+		"ec2:DescribeInstances": true,
+		"s3:PutObject":          false,
+		"s3:PutBucketTagging":   false,
+		"madeup:GetThing":       true,
+		"madeup:CreateThing":    false,
+	}
+	for action, want := range tests {
+		if got := isReadAccessAction(action); got != want {
+			t.Errorf("isReadAccessAction(%q) = %t, want %t", action, got, want)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"regexp"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+// redactedValue replaces backend settings that are redacted. Backend values
+// are only checked for presence, so the key is kept.
+const redactedValue = "REDACTED"
+
+var redactValuesFlag bool
+
+// secretAttributePattern matches the names of attributes and backend
+// settings that hold credentials, e.g. master_password or secret_key.
+var secretAttributePattern = regexp.MustCompile(`(?i)(password|passwd|passphrase|secret|token|private_key|access_key|api_key|credential)`)
+
+// secretValuePatterns match values that look like credentials whatever the
+// attribute is called.
+var secretValuePatterns = []*regexp.Regexp{
+	regexp.MustCompile(`\b(AKIA|ASIA)[0-9A-Z]{16}\b`),             // AWS access key ID
+	regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----`),      // PEM private key
+	regexp.MustCompile(`\b(ghp|gho|ghu|ghs|ghr)_[A-Za-z0-9]{36}`), // GitHub token
+	regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}`),          // Slack token
+}
+
+// isSecretValue reports whether a string looks like a credential.
+func isSecretValue(value string) bool {
+	for _, pattern := range secretValuePatterns {
+		if pattern.MatchString(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactAttributes replaces the captured attribute values that must not
+// leave the scanner with unknown values: those whose name or value looks
+// like a credential, and every value when full is set. Unknown values render
+// as "*" in ARNs and are left out of --export-scan files, so the redacted
+// values reach neither the policy nor any report.
+func redactAttributes(attributes map[string]cty.Value, full bool) {
+	for name, value := range attributes {
+		if !value.IsWhollyKnown() || value.IsNull() {
+			continue
+		}
+		secret := full || secretAttributePattern.MatchString(name)
+		if !secret && value.Type() == cty.String {
+			secret = isSecretValue(value.AsString())
+		}
+		if secret {
+			attributes[name] = cty.UnknownVal(value.Type())
+		}
+	}
+}
+
+// redactParseResult applies redactAttributes to every resource and data
+// source of result and redacts credential settings of its backend, or every
+// backend setting when full is set.
+func redactParseResult(result *ParseResult, full bool) {
+	for _, resources := range [][]Resource{result.Resources, result.DataSources} {
+		for i := range resources {
+			redactAttributes(resources[i].Attributes, full)
+			if full {
+				resources[i].ReplicaRegions = nil
+			}
+		}
+	}
+	for _, backend := range foundBackends(result) {
+		for key, value := range backend.Config {
+			if full || secretAttributePattern.MatchString(key) || isSecretValue(value) {
+				backend.Config[key] = redactedValue
+			}
+		}
+	}
+}
+
+// redactPlanSensitive drops the attributes a plan marks as sensitive in
+// after_sensitive, and those holding the value of a variable declared
+// sensitive, from attributes captured from the plan's after object.
+func redactPlanSensitive(attributes map[string]cty.Value, afterSensitive interface{}, sensitiveValues map[string]bool) {
+	marked, _ := afterSensitive.(map[string]interface{})
+	for name, value := range attributes {
+		if sensitive, ok := marked[name].(bool); ok && sensitive {
+			attributes[name] = cty.UnknownVal(value.Type())
+			continue
+		}
+		if value.Type() == cty.String && sensitiveValues[value.AsString()] {
+			attributes[name] = cty.UnknownVal(value.Type())
+		}
+	}
+}
+
+// planSensitiveValues returns the string values of the plan's root module
+// variables that are declared sensitive.
+func planSensitiveValues(plan *planFile) map[string]bool {
+	values := make(map[string]bool)
+	if plan.Configuration == nil {
+		return values
+	}
+	for name, variable := range plan.Configuration.RootModule.Variables {
+		if !variable.Sensitive {
+			continue
+		}
+		if value, ok := plan.Variables[name].Value.(string); ok && value != "" {
+			values[value] = true
+		}
+	}
+	return values
+}
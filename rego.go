@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// regoPlanPolicy describes where a TACOS platform passes the Terraform plan to
+// its Rego policies.
+type regoPlanPolicy struct {
+	Platform  string // name used in the header comment
+	Package   string // Rego package the platform evaluates
+	PlanInput string // path of the terraform show -json document in input
+	Docs      string // where the policy is attached
+}
+
+var (
+	spaceliftPlanPolicy = regoPlanPolicy{
+		Platform:  "Spacelift",
+		Package:   "spacelift",
+		PlanInput: "input.terraform",
+		Docs:      "Attach it to the stack as a plan policy.",
+	}
+	env0PlanPolicy = regoPlanPolicy{
+		Platform:  "env0",
+		Package:   "env0",
+		PlanInput: "input.plan",
+		Docs:      "Add it to the environment as an approval policy.",
+	}
+)
+
+// generateRegoPlanPolicy emits a Rego plan policy that denies runs whose plan
+// creates, updates or deletes AWS resource types the generated policy does
+// not cover, so a deployment role built from the scan cannot be asked to do
+// more than it was granted. The generated actions are included as data for
+// policies that want to inspect them.
+func generateRegoPlanPolicy(policy IAMPolicy, result *ParseResult, target regoPlanPolicy) (string, error) {
+	if result == nil {
+		return "", fmt.Errorf("%s output needs the scan result", strings.ToLower(target.Platform))
+	}
+
+	types := make(map[string]bool)
+	for _, resource := range result.Resources {
+		if !needsAWSPermissions(resource) {
+			continue
+		}
+		if _, mapped := permissionsDB[resource.Type]; mapped {
+			types[resource.Type] = true
+		}
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# %s plan policy generated by tf-iam-scanner.\n", target.Platform)
+	fmt.Fprintf(&sb, "# %s\n", target.Docs)
+	sb.WriteString("#\n")
+	sb.WriteString("# The deployment role's IAM policy was generated for the resource types in\n")
+	sb.WriteString("# covered_types. A run that changes any other AWS resource type needs\n")
+	sb.WriteString("# permissions the role does not have, so it is denied.\n")
+	fmt.Fprintf(&sb, "package %s\n\n", target.Package)
+	sb.WriteString("import rego.v1\n\n")
+	writeRegoSet(&sb, "covered_types", sortedSet(types))
+	sb.WriteString("\n")
+	writeRegoSet(&sb, "required_actions", allowedActions(policy))
+	sb.WriteString("\n")
+	sb.WriteString("deny contains msg if {\n")
+	fmt.Fprintf(&sb, "\tsome change in %s.resource_changes\n", target.PlanInput)
+	sb.WriteString("\tchange.mode == \"managed\"\n")
+	sb.WriteString("\tstartswith(change.type, \"aws_\")\n")
+	sb.WriteString("\tsome action in change.change.actions\n")
+	sb.WriteString("\taction in {\"create\", \"update\", \"delete\"}\n")
+	sb.WriteString("\tnot change.type in covered_types\n")
+	sb.WriteString("\tmsg := sprintf(\"%s: %s is not covered by the generated IAM policy\", [change.address, change.type])\n")
+	sb.WriteString("}\n")
+	return sb.String(), nil
+}
+
+// allowedActions returns the sorted, distinct actions of policy's Allow
+// statements.
+func allowedActions(policy IAMPolicy) []string {
+	actions := make(map[string]bool)
+	for _, statement := range policy.Statement {
+		if statement.Effect != "Allow" {
+			continue
+		}
+		for _, action := range toStringSlice(statement.Action) {
+			actions[action] = true
+		}
+	}
+	return sortedSet(actions)
+}
+
+// writeRegoSet writes a Rego set literal assigned to name, one member per line.
+func writeRegoSet(sb *strings.Builder, name string, members []string) {
+	sort.Strings(members)
+	if len(members) == 0 {
+		fmt.Fprintf(sb, "%s := set()\n", name)
+		return
+	}
+	fmt.Fprintf(sb, "%s := {\n", name)
+	for _, member := range members {
+		fmt.Fprintf(sb, "\t%q,\n", member)
+	}
+	sb.WriteString("}\n")
+}
+
+// opaDocument is the --format opa data document: the scan result and the
+// generated policy in a shape that is easy to query from Rego, e.g.
+//
+//	deny contains msg if {
+//		some action in input.actions
+//		startswith(action, "iam:")
+//		msg := sprintf("stack requires %s", [action])
+//	}
+type opaDocument struct {
+	Resources  []opaResource  `json:"resources"`
+	Actions    []string       `json:"actions"`
+	Statements []IAMStatement `json:"statements"`
+	Stats      PolicyStats    `json:"stats"`
+}
+
+// opaResource is one AWS resource or data source with the actions it adds to
+// the policy.
+type opaResource struct {
+	Address  string   `json:"address"`
+	Type     string   `json:"type"`
+	Kind     string   `json:"kind"`
+	Data     bool     `json:"data"`
+	Location string   `json:"location,omitempty"`
+	Mapped   bool     `json:"mapped"`
+	Actions  []string `json:"actions"`
+	ARN      string   `json:"arn,omitempty"`
+}
+
+// generateOPAData renders policy and the resources behind it as a JSON
+// document for Conftest/OPA, either as input or loaded as data.
+func generateOPAData(policy IAMPolicy, result *ParseResult) (string, error) {
+	doc := opaDocument{
+		Resources:  []opaResource{},
+		Actions:    []string{},
+		Statements: policy.Statement,
+		Stats:      computePolicyStats(policy),
+	}
+
+	if result != nil {
+		for _, contribution := range collectContributions(result) {
+			actions := contribution.Actions
+			if actions == nil {
+				actions = []string{}
+			}
+			doc.Resources = append(doc.Resources, opaResource{
+				Address:  contribution.Address,
+				Type:     contribution.Type,
+				Kind:     string(contribution.Kind),
+				Data:     contribution.Kind == KindData,
+				Location: contribution.Location,
+				Mapped:   contribution.Mapped,
+				Actions:  actions,
+				ARN:      contribution.ARN,
+			})
+		}
+	}
+
+	doc.Actions = append(doc.Actions, allowedActions(policy)...)
+
+	jsonBytes, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("error marshaling OPA data to JSON: %w", err)
+	}
+	return string(jsonBytes), nil
+}
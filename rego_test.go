@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestGenerateRegoPlanPolicy(t *testing.T) {
+	if err := loadPermissionsDB(); err != nil {
+		t.Fatalf("Error loading permissions DB: %v", err)
+	}
+
+	result := &ParseResult{
+		Resources: []Resource{
+			{Type: "aws_s3_bucket", Name: "logs", Provider: "aws", ResourceType: "aws_s3_bucket"},
+			{Type: "aws_made_up_thing", Name: "x", Provider: "aws", ResourceType: "aws_made_up_thing"},
+			{Type: "random_id", Name: "suffix", Provider: "random", ResourceType: "random_id"},
+		},
+	}
+
+	tests := []struct {
+		format  OutputFormat
+		pkg     string
+		planRef string
+	}{
+		{FormatSpacelift, "package spacelift", "input.terraform.resource_changes"},
+		{FormatEnv0, "package env0", "input.plan.resource_changes"},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.format), func(t *testing.T) {
+			out, err := generateIAMPolicy(result, false, tt.format, false)
+			if err != nil {
+				t.Fatalf("Error generating %s policy: %v", tt.format, err)
+			}
+			for _, want := range []string{tt.pkg, tt.planRef, "import rego.v1", "deny contains msg if {", `"aws_s3_bucket",`, `"s3:CreateBucket",`} {
+				if !strings.Contains(out, want) {
+					t.Errorf("Expected output to contain %q:\n%s", want, out)
+				}
+			}
+			// Unmapped types get no permissions, so they must not count as covered
+			for _, unwanted := range []string{`"aws_made_up_thing"`, `"random_id"`} {
+				if strings.Contains(out, unwanted) {
+					t.Errorf("Expected output not to contain %s:\n%s", unwanted, out)
+				}
+			}
+		})
+	}
+}
+
+func TestWriteRegoSetEmpty(t *testing.T) {
+	var sb strings.Builder
+	writeRegoSet(&sb, "covered_types", nil)
+	if sb.String() != "covered_types := set()\n" {
+		t.Errorf("Unexpected empty set: %q", sb.String())
+	}
+}
+
+func TestGenerateOPAData(t *testing.T) {
+	if err := loadPermissionsDB(); err != nil {
+		t.Fatalf("Error loading permissions DB: %v", err)
+	}
+
+	result := &ParseResult{
+		Resources: []Resource{
+			{Type: "aws_s3_bucket", Name: "logs", Provider: "aws", ResourceType: "aws_s3_bucket",
+				File: "main.tf", Line: 3, Attributes: map[string]cty.Value{"bucket": cty.StringVal("my-logs")}},
+		},
+		DataSources: []Resource{
+			{Kind: KindData, Type: "aws_caller_identity", Name: "current", Provider: "aws", ResourceType: "aws_caller_identity"},
+		},
+	}
+
+	out, err := generateIAMPolicy(result, false, FormatOPA, true)
+	if err != nil {
+		t.Fatalf("Error generating OPA data: %v", err)
+	}
+
+	var doc opaDocument
+	if err := json.Unmarshal([]byte(out), &doc); err != nil {
+		t.Fatalf("Error parsing OPA data: %v", err)
+	}
+	if len(doc.Resources) != 2 {
+		t.Fatalf("Expected 2 resources, got %d", len(doc.Resources))
+	}
+
+	bucket := doc.Resources[0]
+	if bucket.Address != "aws_s3_bucket.logs" || bucket.Location != "main.tf:3" || !bucket.Mapped {
+		t.Errorf("Unexpected bucket entry: %+v", bucket)
+	}
+	if bucket.ARN != "arn:aws:s3:::my-logs" {
+		t.Errorf("Expected the bucket's rendered ARN, got %q", bucket.ARN)
+	}
+	if !containsString(bucket.Actions, "s3:CreateBucket") || !containsString(doc.Actions, "s3:CreateBucket") {
+		t.Errorf("Expected s3:CreateBucket in the bucket and policy actions")
+	}
+	if !doc.Resources[1].Data {
+		t.Errorf("Expected the caller identity to be marked as a data source")
+	}
+	if len(doc.Statements) == 0 || doc.Stats.ActionsPerService["s3"] == 0 {
+		t.Errorf("Expected statements and stats in the document")
+	}
+}
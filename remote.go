@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Remote org-level files, fetched over HTTPS so pipelines pick up the
+// centrally maintained mappings and configuration without baking them into
+// images.
+var (
+	permissionsURLFlag    string
+	permissionsSHA256Flag string
+	configURLFlag         string
+	configSHA256Flag      string
+)
+
+// permissionsURLEnv names the remote org layer when --permissions-url is not
+// given.
+const permissionsURLEnv = "TF_IAM_SCANNER_PERMISSIONS_URL"
+
+// maxRemoteFileSize bounds a fetched permissions DB or configuration file.
+const maxRemoteFileSize = 32 << 20
+
+var remoteHTTPClient = &http.Client{Timeout: 60 * time.Second}
+
+// remoteCacheDir holds fetched files, one directory per URL.
+func remoteCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "tf-iam-scanner", "remote")
+}
+
+// remoteCacheMeta is stored next to a cached file to revalidate it.
+type remoteCacheMeta struct {
+	URL       string    `json:"url"`
+	ETag      string    `json:"etag,omitempty"`
+	SHA256    string    `json:"sha256"`
+	FetchedAt time.Time `json:"fetched_at"`
+}
+
+// parseSHA256Pin returns the hex digest of a --permissions-sha256 or
+// --config-sha256 value, with or without the sha256: prefix.
+func parseSHA256Pin(pin string) (string, error) {
+	pin = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(pin), "sha256:"))
+	if pin == "" {
+		return "", nil
+	}
+	if _, err := hex.DecodeString(pin); err != nil || len(pin) != sha256.Size*2 {
+		return "", fmt.Errorf("invalid SHA256 %q: expected 64 hex digits", pin)
+	}
+	return pin, nil
+}
+
+// fetchRemoteFile returns the path of a local copy of the file at rawURL.
+// The copy is cached by URL and revalidated with If-None-Match, so an
+// unchanged file is not downloaded again. When pin is set the content must
+// have that SHA256 and a cached copy matching it is used without a request.
+// If the server cannot be reached or fails, a cached copy is used with a
+// warning.
+func fetchRemoteFile(ctx context.Context, rawURL, pin string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return "", fmt.Errorf("invalid URL %q", rawURL)
+	}
+	if u.Scheme != "https" && (u.Scheme != "http" || !loopbackHost(u.Hostname())) {
+		return "", fmt.Errorf("%s: only https:// URLs are supported", rawURL)
+	}
+	if pin, err = parseSHA256Pin(pin); err != nil {
+		return "", err
+	}
+
+	key := sha256.Sum256([]byte(rawURL))
+	dir := filepath.Join(remoteCacheDir(), hex.EncodeToString(key[:16]))
+	// The extension tells readPermissionPlugin how to parse the file
+	file := filepath.Join(dir, "content"+strings.ToLower(path.Ext(u.Path)))
+	metaFile := filepath.Join(dir, "meta.json")
+
+	var meta remoteCacheMeta
+	cached := false
+	if data, err := os.ReadFile(metaFile); err == nil && json.Unmarshal(data, &meta) == nil && meta.URL == rawURL {
+		if _, err := os.Stat(file); err == nil {
+			cached = true
+		}
+	}
+	useCached := func() (string, error) {
+		if err := verifyRemoteFile(rawURL, file, pin); err != nil {
+			return "", err
+		}
+		return file, nil
+	}
+	if cached && pin != "" && meta.SHA256 == pin {
+		return useCached()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return "", err
+	}
+	if cached && meta.ETag != "" {
+		req.Header.Set("If-None-Match", meta.ETag)
+	}
+	resp, err := remoteHTTPClient.Do(req)
+	if err != nil {
+		if cached && ctx.Err() == nil {
+			fmt.Fprintf(os.Stderr, "Warning: fetching %s: %v; using the copy cached %s\n", rawURL, err, meta.FetchedAt.Format(time.RFC3339))
+			return useCached()
+		}
+		return "", fmt.Errorf("fetching %s: %w", rawURL, err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && cached:
+		return useCached()
+	case resp.StatusCode >= 500 && cached:
+		fmt.Fprintf(os.Stderr, "Warning: fetching %s: %s; using the copy cached %s\n", rawURL, resp.Status, meta.FetchedAt.Format(time.RFC3339))
+		return useCached()
+	case resp.StatusCode != http.StatusOK:
+		return "", fmt.Errorf("fetching %s: %s", rawURL, resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxRemoteFileSize+1))
+	if err != nil {
+		return "", fmt.Errorf("fetching %s: %w", rawURL, err)
+	}
+	if len(body) > maxRemoteFileSize {
+		return "", fmt.Errorf("fetching %s: larger than %d bytes", rawURL, maxRemoteFileSize)
+	}
+	sum := sha256.Sum256(body)
+	digest := hex.EncodeToString(sum[:])
+	if pin != "" && digest != pin {
+		return "", fmt.Errorf("%s: checksum mismatch: got sha256:%s, want sha256:%s", rawURL, digest, pin)
+	}
+
+	meta = remoteCacheMeta{URL: rawURL, ETag: resp.Header.Get("ETag"), SHA256: digest, FetchedAt: time.Now().UTC()}
+	if err := writeRemoteCache(dir, file, body, meta); err != nil {
+		return "", fmt.Errorf("caching %s: %w", rawURL, err)
+	}
+	return file, nil
+}
+
+// verifyRemoteFile checks a cached copy of rawURL against pin, so a cache
+// edited or corrupted on disk is not trusted.
+func verifyRemoteFile(rawURL, file, pin string) error {
+	if pin == "" {
+		return nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(data)
+	if digest := hex.EncodeToString(sum[:]); digest != pin {
+		return fmt.Errorf("%s: checksum mismatch of the cached copy: got sha256:%s, want sha256:%s", rawURL, digest, pin)
+	}
+	return nil
+}
+
+// writeRemoteCache replaces the cached copy and its metadata. The content is
+// renamed into place so concurrent runs never read a partial file.
+func writeRemoteCache(dir, file string, body []byte, meta remoteCacheMeta) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, ".content-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(body); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), file); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, "meta.json"), data, 0o644)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeFileServer serves one file with an ETag, and counts full downloads and
+// requests revalidated with If-None-Match.
+type fakeFileServer struct {
+	mu          sync.Mutex
+	body        string
+	downloads   int
+	revalidated int
+}
+
+func (f *fakeFileServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	sum := sha256.Sum256([]byte(f.body))
+	etag := `"` + hex.EncodeToString(sum[:8]) + `"`
+	if r.Header.Get("If-None-Match") == etag {
+		f.revalidated++
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	f.downloads++
+	w.Header().Set("ETag", etag)
+	w.Write([]byte(f.body))
+}
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestFetchRemoteFile(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	files := &fakeFileServer{body: `{"aws_sqs_queue": {"actions": ["sqs:CreateQueue"]}}`}
+	server := httptest.NewServer(files)
+	url := server.URL + "/permissions.json"
+	ctx := context.Background()
+
+	file, err := fetchRemoteFile(ctx, url, "")
+	if err != nil {
+		t.Fatalf("fetchRemoteFile: %v", err)
+	}
+	if data, _ := os.ReadFile(file); string(data) != files.body || !strings.HasSuffix(file, ".json") {
+		t.Errorf("Cached copy %s = %q", file, data)
+	}
+
+	// An unchanged file is revalidated, not downloaded again
+	if _, err := fetchRemoteFile(ctx, url, ""); err != nil {
+		t.Fatalf("fetchRemoteFile: %v", err)
+	}
+	if files.downloads != 1 || files.revalidated != 1 {
+		t.Errorf("Expected 1 download and 1 revalidation, got %d and %d", files.downloads, files.revalidated)
+	}
+
+	// A changed file is downloaded and must match the pin
+	files.body = `{"aws_sqs_queue": {"actions": ["sqs:CreateQueue", "sqs:TagQueue"]}}`
+	if _, err := fetchRemoteFile(ctx, url, "sha256:"+sha256Hex("tampered")); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("Expected a checksum mismatch, got %v", err)
+	}
+	pin := sha256Hex(files.body)
+	if _, err := fetchRemoteFile(ctx, url, pin); err != nil {
+		t.Fatalf("fetchRemoteFile: %v", err)
+	}
+
+	// A cached copy matching the pin needs no request, and an unreachable
+	// server falls back to the cache
+	server.Close()
+	if _, err := fetchRemoteFile(ctx, url, pin); err != nil {
+		t.Errorf("Expected the pinned copy from the cache, got %v", err)
+	}
+	if file, err = fetchRemoteFile(ctx, url, ""); err != nil {
+		t.Errorf("Expected the cached copy when the server is down, got %v", err)
+	}
+	if err := os.WriteFile(file, []byte("{}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fetchRemoteFile(ctx, url, pin); err == nil || !strings.Contains(err.Error(), "cached copy") {
+		t.Errorf("Expected an edited cache to fail the pin, got %v", err)
+	}
+
+	for _, bad := range []string{"http://example.com/permissions.json", "file:///etc/passwd", "permissions.json"} {
+		if _, err := fetchRemoteFile(ctx, bad, ""); err == nil {
+			t.Errorf("fetchRemoteFile(%q): expected an error", bad)
+		}
+	}
+	if _, err := fetchRemoteFile(ctx, url, "abc"); err == nil || !strings.Contains(err.Error(), "64 hex digits") {
+		t.Errorf("Expected an invalid pin error, got %v", err)
+	}
+}
+
+func TestRemotePermissionsAndConfig(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	mux := http.NewServeMux()
+	mux.Handle("/org/permissions.yaml", &fakeFileServer{body: "aws_sqs_queue:\n  actions: [sqs:CreateQueue]\n  resource_types: [queue]\n"})
+	mux.Handle("/org/tf-iam-scanner.yaml", &fakeFileServer{body: "least_privilege: true\nstacks:\n  - path: network\n"})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	usePermissionPlugins(t)
+	permissionsURLFlag = server.URL + "/org/permissions.yaml"
+	defer func() { permissionsURLFlag = "" }()
+	if err := loadPermissionsDB(); err != nil {
+		t.Fatalf("Error loading permissions DB: %v", err)
+	}
+	if err := loadPermissionPlugins(nil); err != nil {
+		t.Fatalf("Error loading permission layers: %v", err)
+	}
+	if len(permissionLayers) != 1 || permissionLayers[0].Layer != LayerOrg || permissionLayers[0].Overrides != 1 {
+		t.Errorf("Expected the fetched file as the org layer, got %+v", permissionLayers)
+	}
+	if got := permissionsDB["aws_sqs_queue"].Actions; len(got) != 1 || got[0] != "sqs:CreateQueue" {
+		t.Errorf("Expected the org mapping, got %v", got)
+	}
+
+	config, err := loadRemoteConfig(server.URL+"/org/tf-iam-scanner.yaml", "")
+	if err != nil {
+		t.Fatalf("loadRemoteConfig: %v", err)
+	}
+	if config.LeastPrivilege == nil || !*config.LeastPrivilege || len(config.Stacks) != 1 || config.Stacks[0].Path != "network" {
+		t.Errorf("loadRemoteConfig() = %+v", config)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/johnsidford/tf-iam-scanner/pkg/render"
+)
+
+// ScanMeta describes the scan a policy was generated from; renderers
+// registered with pkg/render receive it with the policy.
+type ScanMeta = render.ScanMeta
+
+// validFormat reports whether format is built in or registered.
+func validFormat(format OutputFormat) bool {
+	if _, ok := formatExtensions[format]; ok {
+		return true
+	}
+	_, _, ok := render.Lookup(string(format))
+	return ok
+}
+
+// formatNames returns the built-in formats followed by the registered ones,
+// sorted.
+func formatNames() []string {
+	return append(append([]string{}, render.BuiltinFormats...), render.Formats()...)
+}
+
+// formatExtension returns the file extension of a built-in or registered
+// format.
+func formatExtension(format OutputFormat) string {
+	if extension, ok := formatExtensions[format]; ok {
+		return extension
+	}
+	_, extension, _ := render.Lookup(string(format))
+	return extension
+}
+
+// newScanMeta describes the scan that produced result.
+func newScanMeta(result *ParseResult) ScanMeta {
+	meta := ScanMeta{
+		ToolVersion:   version,
+		Partition:     defaultARNContext.Partition,
+		PermissionsDB: permissionsDBMeta,
+		Resources:     []string{},
+		DataSources:   []string{},
+		InputDigest:   runInputDigest,
+	}
+	if result == nil {
+		return meta
+	}
+	for _, resource := range result.Resources {
+		meta.Resources = append(meta.Resources, resourceAddress(resource))
+	}
+	for _, dataSource := range result.DataSources {
+		meta.DataSources = append(meta.DataSources, resourceAddress(dataSource))
+	}
+	for _, backend := range foundBackends(result) {
+		meta.Backends = append(meta.Backends, describeBackend(backend))
+	}
+	return meta
+}
+
+// renderRegistered renders policy with the renderer registered for format.
+func renderRegistered(policy IAMPolicy, result *ParseResult, format OutputFormat) (string, error) {
+	renderer, _, ok := render.Lookup(string(format))
+	if !ok {
+		return "", fmt.Errorf("unsupported format: %s", format)
+	}
+	data, err := renderer.Render(policy, newScanMeta(result))
+	if err != nil {
+		return "", fmt.Errorf("error rendering %s output: %w", format, err)
+	}
+	return string(data), nil
+}
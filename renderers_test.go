@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/johnsidford/tf-iam-scanner/pkg/render"
+)
+
+// registerTestRenderer registers format for the duration of the test.
+func registerTestRenderer(t *testing.T, format string, renderer render.Renderer) {
+	t.Helper()
+	render.Register(format, ".txt", renderer)
+	t.Cleanup(func() { render.Unregister(format) })
+}
+
+func TestRegisteredFormats(t *testing.T) {
+	ticket := render.RendererFunc(func(policy IAMPolicy, meta ScanMeta) ([]byte, error) {
+		return []byte(fmt.Sprintf("%d statements for %s", len(policy.Statement), strings.Join(meta.Resources, ","))), nil
+	})
+	registerTestRenderer(t, "ticket", ticket)
+
+	if !validFormat("ticket") || !validFormat(FormatJSON) || validFormat("ticket2") {
+		t.Errorf("Expected registered and built-in formats to be valid")
+	}
+	if names := formatNames(); names[len(names)-1] != "ticket" || names[0] != "json" {
+		t.Errorf("Expected the registered format after the built-in ones, got %v", names)
+	}
+	if formatExtension("ticket") != ".txt" || formatExtension(FormatTerraform) != ".tf" {
+		t.Errorf("Unexpected extensions %q and %q", formatExtension("ticket"), formatExtension(FormatTerraform))
+	}
+
+	result := &ParseResult{Resources: []Resource{{Type: "aws_sqs_queue", Name: "jobs", Provider: "aws"}}}
+	out, err := formatPolicy(IAMPolicy{Statement: []IAMStatement{{Effect: "Allow", Action: "sqs:CreateQueue", Resource: "*"}}}, result, "ticket")
+	if err != nil || out != "1 statements for aws_sqs_queue.jobs" {
+		t.Errorf("Unexpected rendering %q (%v)", out, err)
+	}
+}
+
+func TestBuiltinFormatsHaveExtensions(t *testing.T) {
+	if len(render.BuiltinFormats) != len(formatExtensions) {
+		t.Errorf("render.BuiltinFormats lists %d formats, formatExtensions %d", len(render.BuiltinFormats), len(formatExtensions))
+	}
+	for _, format := range render.BuiltinFormats {
+		if _, ok := formatExtensions[OutputFormat(format)]; !ok {
+			t.Errorf("Built-in format %s has no extension", format)
+		}
+	}
+}
+
+func TestRendererErrors(t *testing.T) {
+	registerTestRenderer(t, "broken", render.RendererFunc(func(IAMPolicy, ScanMeta) ([]byte, error) {
+		return nil, errors.New("engine unavailable")
+	}))
+	if _, err := formatPolicy(IAMPolicy{}, &ParseResult{}, "broken"); err == nil || !strings.Contains(err.Error(), "error rendering broken output: engine unavailable") {
+		t.Errorf("Expected the renderer's error, got %v", err)
+	}
+	if _, err := formatPolicy(IAMPolicy{}, &ParseResult{}, "missing"); err == nil || !strings.Contains(err.Error(), "unsupported format") {
+		t.Errorf("Expected unknown formats to be refused, got %v", err)
+	}
+}
+
+func TestRegisteredFormatFromCommandLine(t *testing.T) {
+	registerTestRenderer(t, "summary", render.RendererFunc(func(policy IAMPolicy, meta ScanMeta) ([]byte, error) {
+		return []byte(fmt.Sprintf("resources=%d partition=%s", len(meta.Resources), meta.Partition)), nil
+	}))
+	defer func() { formatFlag = string(FormatJSON) }()
+
+	stdout, _ := runRootCommand(t, "--path", filepath.Join("test-fixtures", "simple"), "--format", "summary")
+	if !strings.HasPrefix(stdout, "resources=") || !strings.Contains(stdout, "partition=aws") {
+		t.Errorf("Expected the registered renderer's output, got %q", stdout)
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// replicaRule expands the permissions of a resource that keeps copies of
+// itself in other Regions, named by a setting of its nested blocks, to the
+// resource's ARNs in each of those Regions.
+type replicaRule struct {
+	Type string
+	// Setting is the path of the Region attribute in the replica blocks,
+	// e.g. replica.region_name.
+	Setting string
+	// Actions are the actions made on the resource in every replica Region.
+	Actions []string
+	Reason  string
+}
+
+// replicaRules are the multi-Region resources recognized.
+var replicaRules = []replicaRule{
+	{
+		Type:    "aws_dynamodb_table",
+		Setting: "replica.region_name",
+		Actions: []string{
+			"dynamodb:BatchWriteItem", "dynamodb:CreateTable", "dynamodb:CreateTableReplica", "dynamodb:DeleteItem",
+			"dynamodb:DeleteTable", "dynamodb:DeleteTableReplica", "dynamodb:DescribeContinuousBackups",
+			"dynamodb:DescribeTable", "dynamodb:DescribeTimeToLive", "dynamodb:GetItem", "dynamodb:ListTagsOfResource",
+			"dynamodb:PutItem", "dynamodb:Query", "dynamodb:Scan", "dynamodb:TagResource", "dynamodb:UntagResource",
+			"dynamodb:UpdateContinuousBackups", "dynamodb:UpdateItem", "dynamodb:UpdateTable", "dynamodb:UpdateTimeToLive",
+		},
+		Reason: "creates and updates the table's replicas",
+	},
+}
+
+// replicaRuleFor returns the replica rule of resourceType.
+func replicaRuleFor(resourceType string) (replicaRule, bool) {
+	for _, rule := range replicaRules {
+		if rule.Type == resourceType {
+			return rule, true
+		}
+	}
+	return replicaRule{}, false
+}
+
+// blockReplicaRegions returns the known Regions named by the replica blocks
+// of a resource block, in order. Every block of a repeated type is read, not
+// only the last one recorded in Resource.Attributes.
+func blockReplicaRegions(resourceType string, body *hclsyntax.Body) []string {
+	rule, ok := replicaRuleFor(resourceType)
+	if !ok || body == nil {
+		return nil
+	}
+	var regions []string
+	for _, value := range bodySettingValues(body, strings.Split(rule.Setting, ".")) {
+		if isLiteralString(value) && !containsString(regions, value.AsString()) {
+			regions = append(regions, value.AsString())
+		}
+	}
+	return regions
+}
+
+// bodySettingValues returns the values of the attribute at path in every
+// nested block on the way to it. Dynamic blocks are not expanded.
+func bodySettingValues(body *hclsyntax.Body, path []string) []cty.Value {
+	if len(path) == 1 {
+		if attr, ok := body.Attributes[path[0]]; ok {
+			value, _ := attr.Expr.Value(literalContext)
+			return []cty.Value{value}
+		}
+		return nil
+	}
+	var values []cty.Value
+	for _, nested := range body.Blocks {
+		if nested.Type == path[0] && nested.Body != nil {
+			values = append(values, bodySettingValues(nested.Body, path[1:])...)
+		}
+	}
+	return values
+}
+
+// planReplicaRegions returns the Regions named by the replica blocks in a
+// plan's after object, in order.
+func planReplicaRegions(resourceType string, after map[string]interface{}) []string {
+	rule, ok := replicaRuleFor(resourceType)
+	if !ok {
+		return nil
+	}
+	var regions []string
+	for _, value := range planSettingValues(after, strings.Split(rule.Setting, ".")) {
+		if region, ok := value.(string); ok && region != "" && !containsString(regions, region) {
+			regions = append(regions, region)
+		}
+	}
+	return regions
+}
+
+// planSettingValues returns the values at path in a plan's after object,
+// where nested blocks are lists of objects.
+func planSettingValues(values map[string]interface{}, path []string) []interface{} {
+	value, ok := values[path[0]]
+	if !ok {
+		return nil
+	}
+	if len(path) == 1 {
+		return []interface{}{value}
+	}
+	var found []interface{}
+	blocks, _ := value.([]interface{})
+	for _, block := range blocks {
+		if object, ok := block.(map[string]interface{}); ok {
+			found = append(found, planSettingValues(object, path[1:])...)
+		}
+	}
+	return found
+}
+
+// replicaPermission returns the permission a multi-Region resource needs in
+// its replica Regions: the rule's actions on the resource's ARNs in its own
+// Region and in each replica Region. Without a Region in the ARN context the
+// own ARNs already match every Region, and only those are kept.
+func replicaPermission(resource Resource, address string) (inferredPermission, bool) {
+	rule, ok := replicaRuleFor(resource.Type)
+	if !ok || len(resource.ReplicaRegions) == 0 {
+		return inferredPermission{}, false
+	}
+	permission := inferredPermission{
+		Address: address,
+		Target:  "replicas in " + strings.Join(resource.ReplicaRegions, ", "),
+		Actions: rule.Actions,
+		Reason:  rule.Reason,
+	}
+	templates := permissionsDB[resource.Type].allARNTemplates()
+	for _, template := range templates {
+		permission.ARNs = append(permission.ARNs, renderARNTemplate(template, &resource, defaultARNContext))
+	}
+	if defaultARNContext.Region != "*" {
+		for _, region := range resource.ReplicaRegions {
+			context := defaultARNContext
+			context.Region = region
+			for _, template := range templates {
+				permission.ARNs = append(permission.ARNs, renderARNTemplate(template, &resource, context))
+			}
+		}
+	}
+	return permission, true
+}
+
+// describeReplicaRegions returns the summary line of the multi-Region
+// resources in result, or "" when there are none.
+func describeReplicaRegions(result *ParseResult) string {
+	var described []string
+	for _, resource := range result.Resources {
+		if len(resource.ReplicaRegions) > 0 {
+			described = append(described, fmt.Sprintf("%s (%s)", resourceAddress(resource), strings.Join(resource.ReplicaRegions, ", ")))
+		}
+	}
+	return strings.Join(described, ", ")
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const replicatedTableSource = `resource "aws_dynamodb_table" "orders" {
+  name     = "orders"
+  hash_key = "id"
+
+  replica {
+    region_name = "us-west-2"
+  }
+  replica {
+    region_name = "eu-west-1"
+  }
+}
+
+resource "aws_kms_key" "primary" {
+  multi_region = true
+}
+
+resource "aws_kms_replica_key" "west" {
+  primary_key_arn = aws_kms_key.primary.arn
+}
+`
+
+func TestReplicaRegions(t *testing.T) {
+	result, err := parseTerraformSource([]byte(replicatedTableSource), "main.tf")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := strings.Join(result.Resources[0].ReplicaRegions, ","); got != "us-west-2,eu-west-1" {
+		t.Errorf("Expected every replica block's Region, got %q", got)
+	}
+
+	after := map[string]interface{}{
+		"replica": []interface{}{
+			map[string]interface{}{"region_name": "ap-south-1"},
+			map[string]interface{}{"region_name": "ap-south-1"},
+		},
+	}
+	if got := planReplicaRegions("aws_dynamodb_table", after); len(got) != 1 || got[0] != "ap-south-1" {
+		t.Errorf("Unexpected plan Regions %v", got)
+	}
+	if got := planReplicaRegions("aws_sqs_queue", after); got != nil {
+		t.Errorf("Only multi-Region types have replica Regions, got %v", got)
+	}
+}
+
+func TestReplicaPermissions(t *testing.T) {
+	if err := loadPermissionsDB(); err != nil {
+		t.Fatalf("Error loading permissions DB: %v", err)
+	}
+	saved := defaultARNContext
+	t.Cleanup(func() { defaultARNContext = saved })
+	defaultARNContext = arnContext{Partition: "aws", Region: "us-east-1", Account: "123456789012"}
+
+	result, err := parseTerraformSource([]byte(replicatedTableSource), "main.tf")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	grouped := inferredByAddress(inferReferencePermissions(result))
+
+	table := grouped["aws_dynamodb_table.orders"]
+	if len(table) != 1 {
+		t.Fatalf("Expected one replica permission, got %+v", table)
+	}
+	for _, region := range []string{"us-east-1", "us-west-2", "eu-west-1"} {
+		if !containsString(table[0].ARNs, "arn:aws:dynamodb:"+region+":123456789012:table/orders") {
+			t.Errorf("Expected the table's ARN in %s, got %v", region, table[0].ARNs)
+		}
+	}
+
+	key := grouped["aws_kms_replica_key.west"]
+	if len(key) != 1 || !containsString(key[0].Actions, "kms:ReplicateKey") {
+		t.Fatalf("Expected kms:ReplicateKey on the primary key, got %+v", key)
+	}
+	if !containsString(key[0].ARNs, "arn:aws:kms:*:123456789012:key/*") {
+		t.Errorf("The primary key is in another Region, got %v", key[0].ARNs)
+	}
+
+	defaultARNContext.Region = "*"
+	table = inferredByAddress(inferReferencePermissions(result))["aws_dynamodb_table.orders"]
+	if len(table) != 1 || len(table[0].ARNs) != 3 {
+		t.Errorf("Without a Region the own ARNs already match the replicas, got %v", table)
+	}
+}
+
+func TestOverrideReplaceReplicaRegions(t *testing.T) {
+	base, _ := parseTerraformSource([]byte(replicatedTableSource), "main.tf")
+	override, _ := parseTerraformSource([]byte(`resource "aws_dynamodb_table" "orders" {
+  replica {
+    region_name = "sa-east-1"
+  }
+}
+`), "override.tf")
+	merged := overrideResource(base.Resources[0], override.Resources[0])
+	if got := strings.Join(merged.ReplicaRegions, ","); got != "sa-east-1" {
+		t.Errorf("Expected the override's replica blocks to replace the original ones, got %q", got)
+	}
+}
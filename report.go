@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// RunReport is the machine-readable summary written with --report. It
+// records what was scanned, which services the policy covers, the policy
+// statistics and any problems that degraded the input.
+type RunReport struct {
+	Source                    string               `json:"source"`
+	InputDigest               string               `json:"input_digest,omitempty"` // with --stamp
+	PermissionsDB             PermissionsDBMeta    `json:"permissions_db"`
+	PermissionLayers          []PermissionLayer    `json:"permission_layers,omitempty"`
+	PermissionConflicts       []PermissionConflict `json:"permission_conflicts,omitempty"`
+	Resources                 int                  `json:"resources"`
+	DataSources               int                  `json:"data_sources"`
+	Ephemerals                int                  `json:"ephemeral_resources,omitempty"`
+	Backend                   string               `json:"backend,omitempty"`
+	Backends                  []string             `json:"backends,omitempty"`
+	StateEncryption           []StateEncryptionKey `json:"state_encryption,omitempty"`
+	Statements                int                  `json:"statements"`
+	Actions                   int                  `json:"actions"`
+	Services                  []string             `json:"services"`
+	Stats                     PolicyStats          `json:"stats"`
+	ServiceWeights            []ServiceWeight      `json:"service_weights"`
+	Unmapped                  []string             `json:"unmapped"`
+	SkippedProviders          map[string]int       `json:"skipped_providers,omitempty"`
+	ExcludedActions           []string             `json:"excluded_actions"`
+	DestroyActions            []DestroyAction      `json:"destroy_actions,omitempty"`
+	DestroyPermissionsOmitted bool                 `json:"destroy_permissions_omitted,omitempty"`
+	SecretValueReads          []SecretValueRead    `json:"secret_value_reads,omitempty"`
+	Degraded                  bool                 `json:"degraded"`
+	Warnings                  []string             `json:"warnings"`
+	ParseDiagnostics          []ParseDiagnostic    `json:"parse_diagnostics"`
+	ChangedSince              *changeDelta         `json:"changed_since,omitempty"`
+	Compression               []policyCompression  `json:"compression,omitempty"`
+	HCPTerraform              *HCPTerraformAccess  `json:"hcp_terraform,omitempty"`
+	SecurityFindings          []SecurityFinding    `json:"security_findings"`
+	PolicyFindings            []SecurityFinding    `json:"policy_findings,omitempty"`
+	Suppressed                []SecurityFinding    `json:"suppressed_findings,omitempty"`
+	Workloads                 []WorkloadDetection  `json:"workloads,omitempty"`
+	Simulation                *SimulationReport    `json:"simulation,omitempty"`
+	Interrupted               string               `json:"interrupted,omitempty"` // why a partial scan was cut short
+}
+
+// buildRunReport summarizes a scan and the policy generated from it.
+func buildRunReport(result *ParseResult, policy IAMPolicy, source string) RunReport {
+	services, actionCount := servicesFromPolicy(policy)
+
+	report := RunReport{
+		Source:              source,
+		InputDigest:         runInputDigest,
+		PermissionsDB:       permissionsDBMeta,
+		PermissionLayers:    permissionLayers,
+		PermissionConflicts: permissionConflicts,
+		StateEncryption:     result.StateEncryption,
+		Resources:           len(result.Resources),
+		DataSources:         countKind(result.DataSources, KindData),
+		Ephemerals:          countKind(result.DataSources, KindEphemeral),
+		Statements:          len(policy.Statement),
+		Actions:             actionCount,
+		Services:            make([]string, 0, len(services)),
+		Stats:               computePolicyStats(policy),
+		ServiceWeights:      computeServiceWeights(policy, collectContributions(result)),
+		Unmapped:            findUnmappedResources(result),
+		SkippedProviders:    skippedProviders(result),
+		ExcludedActions:     []string{},
+		SecretValueReads:    secretValueReads(result),
+		Degraded:            len(result.Diagnostics) > 0,
+		Warnings:            result.Warnings,
+		ParseDiagnostics:    result.Diagnostics,
+	}
+	if result.Backend != nil {
+		report.Backend = result.Backend.Type
+		report.HCPTerraform = hcpTerraformAccess(result.Backend)
+	}
+	if backends := foundBackends(result); len(backends) > 1 {
+		for _, backend := range backends {
+			report.Backends = append(report.Backends, describeBackend(backend))
+		}
+	}
+	for _, service := range services {
+		report.Services = append(report.Services, service.Name)
+	}
+
+	// Emit empty lists rather than null so consumers need no special cases
+	if report.Warnings == nil {
+		report.Warnings = []string{}
+	}
+	if report.ParseDiagnostics == nil {
+		report.ParseDiagnostics = []ParseDiagnostic{}
+	}
+	report.SecurityFindings = append([]SecurityFinding{}, result.Findings...)
+	return report
+}
+
+// writeRunReport writes the JSON run report to filePath.
+func writeRunReport(report RunReport, filePath string, perm os.FileMode, force bool) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling report: %w", err)
+	}
+	return writeOutputFile(filePath, append(data, '\n'), perm, force)
+}
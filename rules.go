@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+// FindingLow is the severity of findings that are expected in some
+// policies, such as Resource "*" without --least-privilege.
+const FindingLow = "low"
+
+// Rules of the findings about the generated policy. All but
+// unscoped-passrole are also --fail-on gates.
+const (
+	RuleUnmappedResource = GateUnmappedResource
+	RuleWildcardAction   = GateWildcardAction
+	RuleWildcardResource = GateWildcardResource
+	RuleSizeLimit        = GateSizeLimit
+	RuleUnscopedPassRole = "unscoped-passrole"
+	RuleUnknownAction    = GateUnknownAction
+)
+
+// scanRule gives a class of finding a stable ID, in the style of tfsec,
+// trivy and checkov, so teams can disable it (--disable-rule, disable_rules)
+// or suppress it on a block with a "#tfscan:ignore:<ID>" comment.
+type scanRule struct {
+	ID       string
+	Name     string
+	Severity string
+	Summary  string
+}
+
+// scanRules are every rule, in ID order. IDs are never reused or renumbered;
+// policy rules are TFIAM00x, rules about the Terraform source TFIAM01x.
+var scanRules = []scanRule{
+	{"TFIAM001", RuleUnmappedResource, FindingMedium, "AWS resource or data source type without a permission mapping"},
+	{"TFIAM002", RuleWildcardAction, FindingMedium, "wildcard action in the policy"},
+	{"TFIAM003", RuleWildcardResource, FindingLow, "statement on Resource \"*\" without a condition"},
+	{"TFIAM004", RuleSizeLimit, FindingHigh, "policy larger than the size limit of its policy type"},
+	{"TFIAM005", RuleUnscopedPassRole, FindingHigh, "iam:PassRole on any role"},
+	{"TFIAM006", RuleUnknownAction, FindingMedium, "action that is not in the AWS action catalog"},
+	{"TFIAM010", RuleHardcodedCredential, FindingHigh, "credential written into the code"},
+	{"TFIAM011", RuleAdminPolicy, FindingHigh, "IAM policy allowing Action \"*\" on Resource \"*\""},
+	{"TFIAM012", RuleAdminPolicyAttachment, FindingMedium, "AdministratorAccess attached"},
+	{"TFIAM013", RulePublicTrustPolicy, FindingHigh, "role any principal can assume"},
+	{"TFIAM014", RuleSecretWithoutPGP, FindingMedium, "generated secret stored unencrypted in the state"},
+}
+
+var (
+	disableRuleFlag []string
+	enableRuleFlag  []string
+)
+
+// disabledRules are the IDs of the rules turned off for the run.
+var disabledRules = map[string]bool{}
+
+// ignoreComment matches the rules of a suppression comment, e.g.
+// "#tfscan:ignore:TFIAM012" or "// tfscan:ignore:TFIAM002,TFIAM005".
+var ignoreComment = regexp.MustCompile(`(?:#|//)\s*tfscan:ignore:([A-Za-z0-9,-]+)`)
+
+// lookupRule finds a rule by ID, in any case, or by name.
+func lookupRule(value string) (scanRule, bool) {
+	for _, rule := range scanRules {
+		if strings.EqualFold(value, rule.ID) || value == rule.Name {
+			return rule, true
+		}
+	}
+	return scanRule{}, false
+}
+
+// ruleID returns the ID of the rule named name.
+func ruleID(name string) string {
+	rule, _ := lookupRule(name)
+	return rule.ID
+}
+
+// resolveDisabledRules returns the IDs of the disabled rules, those of
+// disable_rules and --disable-rule that --enable-rule does not turn back on.
+func resolveDisabledRules(disable, enable []string) (map[string]bool, error) {
+	disabled := make(map[string]bool)
+	for _, list := range []struct {
+		values []string
+		on     bool
+	}{{disable, false}, {enable, true}} {
+		for _, value := range list.values {
+			rule, ok := lookupRule(value)
+			if !ok {
+				return nil, fmt.Errorf("unknown rule %q; see the Rules section of the README for the rule IDs", value)
+			}
+			disabled[rule.ID] = !list.on
+		}
+	}
+	for id, off := range disabled {
+		if !off {
+			delete(disabled, id)
+		}
+	}
+	return disabled, nil
+}
+
+// blockIgnores returns the rule IDs suppressed on block: by comments on the
+// lines directly above its header, or on any of its lines. lines is the
+// source of the block's file. Unknown rules are returned as warnings.
+func blockIgnores(block *hclsyntax.Block, lines [][]byte) ([]string, []string) {
+	start, end := block.Range().Start.Line, block.Range().End.Line
+	for start > 1 && isCommentLine(lines[start-2]) {
+		start--
+	}
+	var ids, warnings []string
+	for line := start; line <= end && line <= len(lines); line++ {
+		for _, match := range ignoreComment.FindAllSubmatch(lines[line-1], -1) {
+			for _, value := range strings.Split(string(match[1]), ",") {
+				rule, ok := lookupRule(value)
+				if !ok {
+					warnings = append(warnings, fmt.Sprintf("%s:%d: unknown rule %q in tfscan:ignore", block.Range().Filename, line, value))
+					continue
+				}
+				if !containsString(ids, rule.ID) {
+					ids = append(ids, rule.ID)
+				}
+			}
+		}
+	}
+	return ids, warnings
+}
+
+// isCommentLine reports whether line holds nothing but a comment.
+func isCommentLine(line []byte) bool {
+	line = bytes.TrimSpace(line)
+	return bytes.HasPrefix(line, []byte("#")) || bytes.HasPrefix(line, []byte("//"))
+}
+
+// policyFindings returns the findings about the generated policy. Findings
+// caused by a resource name it, so they can be suppressed on its block;
+// findings about the policy as a whole have no address.
+func policyFindings(policy IAMPolicy, result *ParseResult) []SecurityFinding {
+	var findings []SecurityFinding
+	for _, resources := range [][]Resource{result.Resources, result.DataSources} {
+		for _, resource := range resources {
+			if isUnmappedResource(resource) {
+				findings = append(findings, resourceFinding(resource, RuleUnmappedResource, FindingMedium,
+					fmt.Sprintf("no permission mapping for %s; the policy has none of its permissions", resource.permissionsKey())))
+			}
+		}
+	}
+
+	contributions := collectContributions(result)
+	contributors := func(action string) []resourceContribution {
+		var found []resourceContribution
+		for _, contribution := range contributions {
+			if containsString(contribution.Actions, action) {
+				found = append(found, contribution)
+			}
+		}
+		return found
+	}
+	add := func(rule, severity, message string, from []resourceContribution) {
+		if len(from) == 0 {
+			findings = append(findings, SecurityFinding{ID: ruleID(rule), Rule: rule, Severity: severity, Message: message})
+		}
+		for _, contribution := range from {
+			findings = append(findings, SecurityFinding{ID: ruleID(rule), Rule: rule, Severity: severity,
+				Address: contribution.Address, Location: contribution.Location, Message: message})
+		}
+	}
+
+	for _, action := range wildcardActions(policy) {
+		add(RuleWildcardAction, FindingMedium, fmt.Sprintf("the policy grants %s", action), contributors(action))
+	}
+	for i, statement := range policy.Statement {
+		if isWildcardResourceStatement(statement) {
+			add(RuleWildcardResource, FindingLow, fmt.Sprintf("%s grants access to Resource \"*\"", statementName(statement, i)), nil)
+		}
+		if isUnscopedPassRole(statement) {
+			add(RuleUnscopedPassRole, FindingHigh, fmt.Sprintf("%s allows iam:PassRole on any role; scope it to the roles passed", statementName(statement, i)),
+				contributors("iam:PassRole"))
+		}
+	}
+	for _, problem := range unknownActions(policy) {
+		severity := FindingMedium
+		if problem.Severity != SeverityError {
+			severity = FindingLow
+		}
+		from := contributors(problem.Action)
+		message := problem.Message
+		if sources := actionSources(from); sources != "" {
+			message += "; mapped by " + sources
+		}
+		add(RuleUnknownAction, severity, message, from)
+	}
+	if size, limit := policySize(policy), policySizeLimit(); size > limit {
+		add(RuleSizeLimit, FindingHigh, fmt.Sprintf("the policy is %d characters, exceeding the %d character %s policy limit", size, limit, policyTypeFlag), nil)
+	}
+	return findings
+}
+
+// actionSources names the permissions DB entries an action came from, with
+// the --permissions-dir file of entries a plugin supplied, e.g.
+// "aws_foo (custom/foo.yaml)".
+func actionSources(from []resourceContribution) string {
+	seen := make(map[string]bool)
+	for _, contribution := range from {
+		key := contribution.Kind.addressPrefix() + contribution.Type
+		if file := permissionEntrySources[key]; file != "" {
+			key += " (" + file + ")"
+		}
+		seen[key] = true
+	}
+	return strings.Join(sortedSet(seen), ", ")
+}
+
+// statementName names a statement in findings, by Sid or by position.
+func statementName(statement IAMStatement, index int) string {
+	if statement.Sid != "" {
+		return "statement " + statement.Sid
+	}
+	return fmt.Sprintf("statement %d", index+1)
+}
+
+// isUnscopedPassRole reports whether statement allows iam:PassRole on every
+// role without a condition such as iam:PassedToService.
+func isUnscopedPassRole(statement IAMStatement) bool {
+	if statement.Effect != "Allow" || len(statement.Condition) > 0 || !containsString(toStringSlice(statement.Action), "iam:PassRole") {
+		return false
+	}
+	for _, resource := range toStringSlice(statement.Resource) {
+		if resource == "*" || strings.HasSuffix(resource, ":role/*") {
+			return true
+		}
+	}
+	return false
+}
+
+// applyRules drops the findings of disabled rules and splits the others
+// into active findings and those suppressed by a tfscan:ignore comment on
+// the block they are about.
+func applyRules(findings []SecurityFinding, result *ParseResult) (active, suppressed []SecurityFinding) {
+	ignores := make(map[string][]string)
+	for _, resources := range [][]Resource{result.Resources, result.DataSources} {
+		for _, resource := range resources {
+			if len(resource.Ignores) > 0 {
+				ignores[resourceAddress(resource)] = resource.Ignores
+			}
+		}
+	}
+	for _, finding := range findings {
+		switch {
+		case disabledRules[finding.ID]:
+		case containsString(ignores[finding.Address], finding.ID):
+			suppressed = append(suppressed, finding)
+		default:
+			active = append(active, finding)
+		}
+	}
+	return active, suppressed
+}
+
+// suppressGates drops the --fail-on violations of disabled rules, and of
+// rules whose findings are all suppressed inline, so exceptions managed
+// through rules do not fail the run.
+func suppressGates(violations []GateViolation, findings, active []SecurityFinding) []GateViolation {
+	var kept []GateViolation
+	for _, violation := range violations {
+		id := ruleID(violation.Gate)
+		if disabledRules[id] {
+			continue
+		}
+		found, open := false, false
+		for _, finding := range findings {
+			found = found || finding.ID == id
+		}
+		for _, finding := range active {
+			open = open || finding.ID == id
+		}
+		if found && !open {
+			continue
+		}
+		kept = append(kept, violation)
+	}
+	return kept
+}
+
+// printPolicyFindings lists the policy findings in the run summary, and how
+// many findings comments suppressed.
+func printPolicyFindings(findings, suppressed []SecurityFinding) {
+	if len(findings) > 0 {
+		fmt.Fprintf(os.Stderr, "  Policy findings: %d\n", len(findings))
+		printFindingLines(findings)
+	}
+	if len(suppressed) > 0 {
+		fmt.Fprintf(os.Stderr, "  Findings suppressed by tfscan:ignore: %d\n", len(suppressed))
+	}
+}
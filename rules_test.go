@@ -0,0 +1,141 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestResolveDisabledRules(t *testing.T) {
+	disabled, err := resolveDisabledRules([]string{"tfiam003", "unmapped-resource", "TFIAM010"}, []string{"hardcoded-credential"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := strings.Join(sortedSet(disabled), ","); got != "TFIAM001,TFIAM003" {
+		t.Errorf("resolveDisabledRules() = %s, want TFIAM001,TFIAM003", got)
+	}
+	if _, err := resolveDisabledRules([]string{"TFIAM999"}, nil); err == nil {
+		t.Errorf("Expected an error for an unknown rule")
+	}
+}
+
+func TestRuleIDsAreUnique(t *testing.T) {
+	seen := make(map[string]bool)
+	for _, rule := range scanRules {
+		if seen[rule.ID] || seen[rule.Name] {
+			t.Errorf("Rule %s (%s) is listed twice", rule.ID, rule.Name)
+		}
+		seen[rule.ID], seen[rule.Name] = true, true
+	}
+}
+
+func TestIgnoreComments(t *testing.T) {
+	source := `# Approved for the break-glass role
+#tfscan:ignore:TFIAM012
+resource "aws_iam_role_policy_attachment" "admin" {
+  role       = "ci"
+  policy_arn = "arn:aws:iam::aws:policy/AdministratorAccess"
+}
+
+resource "aws_db_instance" "db" {
+  password = "hunter2hunter2" // tfscan:ignore:hardcoded-credential,TFIAM999
+}
+
+#tfscan:ignore:TFIAM010
+
+resource "aws_db_instance" "other" {
+  password = "hunter2hunter2"
+}
+`
+	result, err := parseTerraformSource([]byte(source), "main.tf")
+	if err != nil {
+		t.Fatalf("Error parsing source: %v", err)
+	}
+	want := map[string]string{
+		"aws_iam_role_policy_attachment.admin": "TFIAM012",
+		"aws_db_instance.db":                   "TFIAM010",
+		"aws_db_instance.other":                "",
+	}
+	for _, resource := range result.Resources {
+		if got := strings.Join(resource.Ignores, ","); got != want[resource.Address] {
+			t.Errorf("Ignores of %s = %q, want %q", resource.Address, got, want[resource.Address])
+		}
+	}
+	if len(result.Warnings) != 1 || !strings.Contains(result.Warnings[0], `main.tf:9: unknown rule "TFIAM999"`) {
+		t.Errorf("Expected a warning for the unknown rule, got %v", result.Warnings)
+	}
+
+	recordSecurityFindings(result)
+	active, suppressed := applyRules(result.Findings, result)
+	if len(active) != 1 || active[0].Address != "aws_db_instance.other" || active[0].ID != "TFIAM010" {
+		t.Errorf("Expected only the credential of the block without a comment, got %+v", active)
+	}
+	if len(suppressed) != 2 {
+		t.Errorf("Expected two suppressed findings, got %+v", suppressed)
+	}
+}
+
+func TestPolicyFindings(t *testing.T) {
+	if err := loadPermissionsDB(); err != nil {
+		t.Fatalf("Error loading permissions DB: %v", err)
+	}
+	defer func() { disabledRules = map[string]bool{} }()
+
+	result := &ParseResult{
+		Resources: []Resource{
+			{Type: "aws_lambda_function", Name: "fn", Provider: "aws", Ignores: []string{"TFIAM005"}},
+			{Type: "aws_not_a_thing", Name: "x", Provider: "aws"},
+		},
+	}
+	policy := IAMPolicy{Version: defaultPolicyVersion, Statement: []IAMStatement{
+		{Sid: "Lambda", Effect: "Allow", Action: []string{"iam:PassRole", "lambda:CreateFunction"}, Resource: "*"},
+		{Effect: "Allow", Action: []string{"s3:*"}, Resource: "arn:aws:s3:::logs"},
+	}}
+
+	findings := policyFindings(policy, result)
+	var got []string
+	for _, finding := range findings {
+		got = append(got, finding.ID+" "+finding.Address)
+	}
+	want := "TFIAM001 aws_not_a_thing.x,TFIAM002 ,TFIAM003 ,TFIAM005 aws_lambda_function.fn"
+	if strings.Join(got, ",") != want {
+		t.Errorf("policyFindings() = %v, want %s", got, want)
+	}
+
+	active, suppressed := applyRules(findings, result)
+	if len(active) != 3 || len(suppressed) != 1 || suppressed[0].ID != "TFIAM005" {
+		t.Errorf("Expected the PassRole finding suppressed on the function, got %+v and %+v", active, suppressed)
+	}
+
+	violations := []GateViolation{
+		{Gate: GateUnmappedResource, ExitCode: exitUnmappedResource},
+		{Gate: GateWildcardAction, ExitCode: exitWildcardAction},
+	}
+	if kept := suppressGates(violations, findings, active); len(kept) != 2 {
+		t.Errorf("Expected both gates to trip, got %+v", kept)
+	}
+	disabledRules = map[string]bool{"TFIAM001": true}
+	active, _ = applyRules(findings, result)
+	if kept := suppressGates(violations, findings, active); len(kept) != 1 || kept[0].Gate != GateWildcardAction {
+		t.Errorf("Expected the gate of the disabled rule to be dropped, got %+v", kept)
+	}
+	result.Resources[1].Ignores = []string{"TFIAM001"}
+	disabledRules = map[string]bool{}
+	active, _ = applyRules(findings, result)
+	if kept := suppressGates(violations, findings, active); len(kept) != 1 || kept[0].Gate != GateWildcardAction {
+		t.Errorf("Expected the gate whose findings are all suppressed to be dropped, got %+v", kept)
+	}
+}
+
+func TestActionSources(t *testing.T) {
+	defer func() { permissionEntrySources = map[string]string{} }()
+	permissionEntrySources = map[string]string{"data.aws_sqs_queue": "custom/sqs.yaml"}
+
+	from := []resourceContribution{
+		{Type: "aws_sqs_queue", Kind: KindResource},
+		{Type: "aws_sqs_queue", Kind: KindData},
+		{Type: "aws_sqs_queue", Kind: KindResource},
+	}
+	if got, want := actionSources(from), "aws_sqs_queue, data.aws_sqs_queue (custom/sqs.yaml)"; got != want {
+		t.Errorf("actionSources() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// timeoutFlag bounds every command of a run (--timeout); zero means no
+// limit.
+var timeoutFlag time.Duration
+
+// Exit codes of runs cut short, following timeout(1) and the shell.
+const (
+	exitTimedOut    = 124
+	exitInterrupted = 130
+)
+
+// interruptContext returns a context cancelled on the first SIGINT or
+// SIGTERM. The signals are released once it is, so a second Ctrl-C stops a
+// run that is slow to wind down.
+func interruptContext() (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	return ctx, stop
+}
+
+// applyTimeout bounds the context of cmd by --timeout. It runs before every
+// command as the root's PersistentPreRun.
+func applyTimeout(cmd *cobra.Command, _ []string) {
+	if timeoutFlag < 0 {
+		fmt.Fprintf(os.Stderr, "Error: --timeout must not be negative\n")
+		os.Exit(1)
+	}
+	if timeoutFlag == 0 {
+		return
+	}
+	var ctx context.Context
+	ctx, stopTimeout = context.WithTimeout(cmd.Context(), timeoutFlag)
+	cmd.SetContext(ctx)
+}
+
+// stopTimeout releases the --timeout timer once the command returns.
+var stopTimeout context.CancelFunc = func() {}
+
+// cancelReason describes why ctx was cancelled, and the exit code for it.
+func cancelReason(ctx context.Context) (string, int) {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Sprintf("timed out after %s", timeoutFlag), exitTimedOut
+	}
+	return "interrupted", exitInterrupted
+}
+
+// exitIfCancelled ends the run when ctx was cancelled, after writing what was
+// scanned so far to --report when result is not nil. Commands call it after
+// each step that waits on the file system or the network, so a cancelled
+// step's error is not reported as a failure of its own.
+func exitIfCancelled(ctx context.Context, result *ParseResult, source string) {
+	if ctx.Err() == nil {
+		return
+	}
+	reason, code := cancelReason(ctx)
+	fmt.Fprintf(os.Stderr, "\nScan %s\n", reason)
+	if result != nil && reportFlag != "" {
+		report := buildRunReport(result, IAMPolicy{Version: defaultPolicyVersion}, source)
+		report.Interrupted = reason
+		if err := writeRunReport(report, reportFlag, outputMode, forceFlag); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing report: %v\n", err)
+		} else {
+			fmt.Fprintf(os.Stderr, "Partial report written to: %s\n", reportFlag)
+		}
+	}
+	exitRun(code)
+}
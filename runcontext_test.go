@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+func TestCancelReason(t *testing.T) {
+	defer func() { timeoutFlag = 0 }()
+	timeoutFlag = time.Millisecond
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	<-ctx.Done()
+	if reason, code := cancelReason(ctx); reason != "timed out after 1ms" || code != exitTimedOut {
+		t.Errorf("cancelReason() = %q, %d for a deadline", reason, code)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if reason, code := cancelReason(ctx); reason != "interrupted" || code != exitInterrupted {
+		t.Errorf("cancelReason() = %q, %d for an interrupt", reason, code)
+	}
+}
+
+func TestApplyTimeout(t *testing.T) {
+	defer func() { timeoutFlag = 0 }()
+
+	cmd := &cobra.Command{}
+	cmd.SetContext(context.Background())
+	applyTimeout(cmd, nil)
+	if _, ok := cmd.Context().Deadline(); ok {
+		t.Errorf("Expected no deadline without --timeout")
+	}
+
+	timeoutFlag = time.Minute
+	applyTimeout(cmd, nil)
+	defer stopTimeout()
+	deadline, ok := cmd.Context().Deadline()
+	if !ok || time.Until(deadline) > time.Minute {
+		t.Errorf("Expected a deadline within --timeout, got %v, %v", deadline, ok)
+	}
+}
+
+func TestParseCancelled(t *testing.T) {
+	if err := loadPermissionsDB(); err != nil {
+		t.Fatalf("Error loading permissions DB: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	result, err := parseTerraformFilesContext(ctx, "test-fixtures/modules")
+	if err != nil {
+		t.Fatalf("Expected a cancelled parse to return without an error, got %v", err)
+	}
+	if len(result.Resources) != 0 {
+		t.Errorf("Expected nothing parsed after cancellation, got %d resources", len(result.Resources))
+	}
+
+	var read []string
+	streamTerraformFiles(ctx, []string{"test-fixtures/simple/main.tf"}, func(file parsedFile) {
+		read = append(read, file.path)
+	})
+	if len(read) != 0 {
+		t.Errorf("Expected no file read after cancellation, got %s", strings.Join(read, ", "))
+	}
+}
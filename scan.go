@@ -0,0 +1,260 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// scanFileVersion is bumped whenever the exported scan layout changes in a
+// way older readers cannot handle.
+const scanFileVersion = 1
+
+var (
+	exportScanFlag string
+	scanFromFlag   []string
+)
+
+var scanCmd = &cobra.Command{
+	Use:   "scan --from scan1.json [scan2.json ...]",
+	Short: "Generate one policy from scan results exported with --export-scan",
+	Long: `Merge the parse results of several independently scanned repositories
+(exported with --export-scan) and generate a single consolidated policy, for
+example for a deployment role shared by multiple projects.
+
+Example:
+  tf-iam-scanner --path ./network --export-scan network.json
+  tf-iam-scanner --path ./app --export-scan app.json
+  tf-iam-scanner scan --from network.json app.json --least-privilege`,
+	Run: runScanFrom,
+}
+
+func init() {
+	rootCmd.Flags().StringVar(&exportScanFlag, "export-scan", "", "Write the parsed scan result to a JSON file for later use with 'scan --from'")
+	scanCmd.Flags().StringSliceVar(&scanFromFlag, "from", nil, "Scan result files exported with --export-scan (remaining arguments are also read)")
+	addPolicyOutputFlags(scanCmd)
+	rootCmd.AddCommand(scanCmd)
+}
+
+// scanFile is the on-disk form of a ParseResult.
+type scanFile struct {
+	Version     int               `json:"version"`
+	Source      string            `json:"source"`
+	Resources   []scanResource    `json:"resources"`
+	DataSources []scanResource    `json:"data_sources"`
+	Backend     *BackendConfig    `json:"backend,omitempty"`
+	Backends    []*BackendConfig  `json:"backends,omitempty"`
+	Modules     []string          `json:"modules,omitempty"`
+	ModuleCalls []ModuleCall      `json:"module_calls,omitempty"`
+	Warnings    []string          `json:"warnings,omitempty"`
+	Diagnostics []ParseDiagnostic `json:"diagnostics,omitempty"`
+
+	StateEncryption []StateEncryptionKey `json:"state_encryption,omitempty"`
+}
+
+// scanResource is the on-disk form of a Resource. Attribute values are stored
+// as plain JSON; values that are not known until apply are dropped.
+type scanResource struct {
+	Kind           ResourceKind                       `json:"kind,omitempty"`
+	Type           string                             `json:"type"`
+	Name           string                             `json:"name"`
+	Provider       string                             `json:"provider"`
+	Address        string                             `json:"address,omitempty"`
+	File           string                             `json:"file,omitempty"`
+	Line           int                                `json:"line,omitempty"`
+	ResourceType   string                             `json:"resource_type,omitempty"`
+	Attributes     map[string]ctyjson.SimpleJSONValue `json:"attributes,omitempty"`
+	Blocks         []string                           `json:"blocks,omitempty"`
+	References     []string                           `json:"references,omitempty"`
+	ReplicaRegions []string                           `json:"replica_regions,omitempty"`
+	Ignores        []string                           `json:"ignores,omitempty"`
+}
+
+// exportScan writes result to filePath so it can be merged later with
+// 'scan --from'. source records where the result came from; perm and force
+// behave as for the policy output file.
+func exportScan(result *ParseResult, source, filePath string, perm os.FileMode, force bool) error {
+	out := scanFile{
+		Version:     scanFileVersion,
+		Source:      source,
+		Resources:   toScanResources(result.Resources),
+		DataSources: toScanResources(result.DataSources),
+		Backend:     result.Backend,
+		Backends:    result.Backends,
+		Modules:     result.Modules,
+		ModuleCalls: result.ModuleCalls,
+		Warnings:    result.Warnings,
+		Diagnostics: result.Diagnostics,
+
+		StateEncryption: result.StateEncryption,
+	}
+
+	data, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling scan result: %w", err)
+	}
+	return writeOutputFile(filePath, append(data, '\n'), perm, force)
+}
+
+func toScanResources(resources []Resource) []scanResource {
+	out := make([]scanResource, 0, len(resources))
+	for _, r := range resources {
+		sr := scanResource{
+			Kind:           r.Kind,
+			Type:           r.Type,
+			Name:           r.Name,
+			Provider:       r.Provider,
+			Address:        r.Address,
+			File:           r.File,
+			Line:           r.Line,
+			ResourceType:   r.ResourceType,
+			Blocks:         r.Blocks,
+			References:     r.References,
+			ReplicaRegions: r.ReplicaRegions,
+			Ignores:        r.Ignores,
+		}
+		for name, value := range r.Attributes {
+			if !value.IsWhollyKnown() {
+				continue
+			}
+			if sr.Attributes == nil {
+				sr.Attributes = make(map[string]ctyjson.SimpleJSONValue)
+			}
+			sr.Attributes[name] = ctyjson.SimpleJSONValue{Value: value}
+		}
+		out = append(out, sr)
+	}
+	return out
+}
+
+// fromScanResources converts scan resources back, giving those of scan
+// files written before kinds were recorded the kind of their list.
+func fromScanResources(resources []scanResource, kind ResourceKind) []Resource {
+	out := make([]Resource, 0, len(resources))
+	for _, sr := range resources {
+		if sr.Kind == "" {
+			sr.Kind = kind
+		}
+		r := Resource{
+			Kind:           sr.Kind,
+			Type:           sr.Type,
+			Name:           sr.Name,
+			Provider:       sr.Provider,
+			Address:        sr.Address,
+			File:           sr.File,
+			Line:           sr.Line,
+			ResourceType:   sr.ResourceType,
+			Attributes:     make(map[string]cty.Value, len(sr.Attributes)),
+			Blocks:         sr.Blocks,
+			References:     sr.References,
+			ReplicaRegions: sr.ReplicaRegions,
+			Ignores:        sr.Ignores,
+		}
+		for name, value := range sr.Attributes {
+			r.Attributes[name] = value.Value
+		}
+		out = append(out, r)
+	}
+	return out
+}
+
+// loadScanFile reads a scan result written by exportScan.
+func loadScanFile(filePath string) (*scanFile, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading scan file: %w", err)
+	}
+
+	var scan scanFile
+	if err := json.Unmarshal(data, &scan); err != nil {
+		return nil, fmt.Errorf("error parsing scan file %s: %w", filePath, err)
+	}
+	if scan.Version != scanFileVersion {
+		return nil, fmt.Errorf("scan file %s has version %d, expected %d", filePath, scan.Version, scanFileVersion)
+	}
+	return &scan, nil
+}
+
+// mergeScanResults combines several exported scans into one ParseResult.
+func mergeScanResults(scans []*scanFile) *ParseResult {
+	results := make([]*ParseResult, len(scans))
+	sources := make([]string, len(scans))
+	for i, scan := range scans {
+		results[i] = &ParseResult{
+			Resources:   fromScanResources(scan.Resources, KindResource),
+			DataSources: fromScanResources(scan.DataSources, KindData),
+			Backend:     scan.Backend,
+			Backends:    scan.Backends,
+			Modules:     scan.Modules,
+			ModuleCalls: scan.ModuleCalls,
+			Warnings:    scan.Warnings,
+			Diagnostics: scan.Diagnostics,
+
+			StateEncryption: scan.StateEncryption,
+		}
+		sources[i] = scan.Source
+	}
+	return mergeParseResults(results, sources)
+}
+
+// mergeParseResults combines the results scanned from sources into one.
+// Resources and data sources are concatenated; the policy generator already
+// deduplicates actions. Every distinct backend is kept; the first one found
+// is the merged result's Backend.
+func mergeParseResults(results []*ParseResult, sources []string) *ParseResult {
+	merged := &ParseResult{}
+	seenModules := make(map[string]bool)
+
+	for _, result := range results {
+		merged.Resources = append(merged.Resources, result.Resources...)
+		merged.DataSources = append(merged.DataSources, result.DataSources...)
+		merged.Warnings = append(merged.Warnings, result.Warnings...)
+		merged.Diagnostics = append(merged.Diagnostics, result.Diagnostics...)
+		merged.Findings = append(merged.Findings, result.Findings...)
+		merged.StateEncryption = append(merged.StateEncryption, result.StateEncryption...)
+		merged.ModuleCalls = append(merged.ModuleCalls, result.ModuleCalls...)
+
+		for _, module := range result.Modules {
+			if !seenModules[module] {
+				seenModules[module] = true
+				merged.Modules = append(merged.Modules, module)
+			}
+		}
+
+		for _, backend := range foundBackends(result) {
+			addBackend(merged, backend)
+		}
+	}
+
+	return merged
+}
+
+func runScanFrom(cmd *cobra.Command, args []string) {
+	files := append(append([]string{}, scanFromFlag...), args...)
+	if len(files) == 0 {
+		exitWithError(validationErrorf("at least one scan file is required (use --from)"))
+	}
+
+	format, err := validateOutputFlags(cmd)
+	if err != nil {
+		exitWithError(err)
+	}
+
+	scans := make([]*scanFile, 0, len(files))
+	for _, file := range files {
+		scan, err := loadScanFile(file)
+		if err != nil {
+			exitWithError(&ParseError{Source: file, Err: err})
+		}
+		scans = append(scans, scan)
+	}
+
+	result := mergeScanResults(scans)
+	statusf("Merged %d scan(s)\n", len(scans))
+
+	generateAndWrite(cmd.Context(), result, format, fmt.Sprintf("%d scan file(s)", len(scans)))
+}
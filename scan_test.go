@@ -0,0 +1,116 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestExportAndMergeScans(t *testing.T) {
+	if err := loadPermissionsDB(); err != nil {
+		t.Fatalf("Error loading permissions DB: %v", err)
+	}
+
+	dir := t.TempDir()
+	first := &ParseResult{
+		Resources: []Resource{
+			{Type: "aws_s3_bucket", Name: "logs", Provider: "aws", ResourceType: "aws_s3_bucket",
+				Address: "aws_s3_bucket.logs", File: "main.tf", Line: 1,
+				Attributes: map[string]cty.Value{
+					"bucket": cty.StringVal("my-logs"),
+					"arn":    cty.UnknownVal(cty.String),
+				}},
+		},
+		Backend: &BackendConfig{Type: "s3", Config: map[string]string{"bucket": "state"}},
+	}
+	second := &ParseResult{
+		Resources: []Resource{
+			{Type: "aws_sqs_queue", Name: "jobs", Provider: "aws", ResourceType: "aws_sqs_queue"},
+		},
+		Backend: &BackendConfig{Type: "gcs"},
+	}
+
+	firstPath := filepath.Join(dir, "first.json")
+	secondPath := filepath.Join(dir, "second.json")
+	if err := exportScan(first, "./first", firstPath, 0644, false); err != nil {
+		t.Fatalf("Error exporting scan: %v", err)
+	}
+	if err := exportScan(second, "./second", secondPath, 0644, false); err != nil {
+		t.Fatalf("Error exporting scan: %v", err)
+	}
+
+	var scans []*scanFile
+	for _, path := range []string{firstPath, secondPath} {
+		scan, err := loadScanFile(path)
+		if err != nil {
+			t.Fatalf("Error loading scan: %v", err)
+		}
+		scans = append(scans, scan)
+	}
+
+	merged := mergeScanResults(scans)
+	if len(merged.Resources) != 2 {
+		t.Fatalf("Expected 2 merged resources, got %d", len(merged.Resources))
+	}
+	logs := merged.Resources[0]
+	if logs.File != "main.tf" || logs.Line != 1 || logs.Address != "aws_s3_bucket.logs" {
+		t.Errorf("Resource location not preserved: %+v", logs)
+	}
+	if bucket := logs.Attributes["bucket"]; bucket.AsString() != "my-logs" {
+		t.Errorf("Expected bucket attribute my-logs, got %#v", bucket)
+	}
+	if _, ok := logs.Attributes["arn"]; ok {
+		t.Error("Expected unknown attribute to be dropped")
+	}
+	if merged.Backend == nil || merged.Backend.Type != "s3" || merged.Backend.Config["bucket"] != "state" {
+		t.Errorf("Expected first backend to be kept, got %+v", merged.Backend)
+	}
+	if len(merged.Backends) != 2 {
+		t.Errorf("Expected both scans' backends, got %+v", merged.Backends)
+	}
+
+	policy := buildIAMPolicy(merged, false, true)
+	if !hasAction(policy, "s3:CreateBucket") || !hasAction(policy, "sqs:CreateQueue") {
+		t.Error("Expected merged policy to cover resources from both scans")
+	}
+}
+
+func TestScanResourceKinds(t *testing.T) {
+	resources := []Resource{
+		{Kind: KindData, Type: "aws_ami", Name: "ubuntu", Provider: "aws"},
+		{Kind: KindEphemeral, Type: "aws_ssm_parameter", Name: "token", Provider: "aws"},
+	}
+	back := fromScanResources(toScanResources(resources), KindData)
+	if back[0].Kind != KindData || back[1].Kind != KindEphemeral {
+		t.Errorf("Expected the kinds to be kept, got %s and %s", back[0].Kind, back[1].Kind)
+	}
+
+	// Scan files written before kinds were recorded take the kind of their list
+	old := []scanResource{{Type: "aws_ami", Name: "ubuntu", Provider: "aws"}}
+	if got := fromScanResources(old, KindData); got[0].Kind != KindData || resourceAddress(got[0]) != "data.aws_ami.ubuntu" {
+		t.Errorf("Expected a data source, got %s %s", got[0].Kind, resourceAddress(got[0]))
+	}
+}
+
+func TestLoadScanFileVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scan.json")
+	if err := os.WriteFile(path, []byte(`{"version": 99}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadScanFile(path); err == nil {
+		t.Error("Expected an error for an unsupported scan file version")
+	}
+}
+
+func hasAction(policy IAMPolicy, want string) bool {
+	for _, statement := range policy.Statement {
+		for _, action := range toStringSlice(statement.Action) {
+			if action == want {
+				return true
+			}
+		}
+	}
+	return false
+}
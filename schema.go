@@ -0,0 +1,73 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// embeddedSchemas holds the JSON Schemas of the machine-readable outputs.
+// Tests validate real outputs against them, so they stay in step with the
+// code.
+//
+//go:embed schemas/*.schema.json
+var embeddedSchemas embed.FS
+
+var schemaCmd = &cobra.Command{
+	Use:   "schema [name]",
+	Short: "Print the JSON Schema of a machine-readable output",
+	Long: `Print the JSON Schema (draft 2020-12) of one of the machine-readable
+outputs, or list the available schemas when no name is given:
+
+  batch    cross-account report written by 'batch'
+  policy   IAM policy written by --format json
+  report   run report written with --report
+  scan     scan export written with --export-scan`,
+	Args:      cobra.MaximumNArgs(1),
+	ValidArgs: []string{"batch", "policy", "report", "scan"},
+	Run:       runSchema,
+}
+
+func init() {
+	rootCmd.AddCommand(schemaCmd)
+}
+
+func runSchema(cmd *cobra.Command, args []string) {
+	if len(args) == 0 {
+		for _, name := range schemaNames() {
+			fmt.Println(name)
+		}
+		return
+	}
+
+	data, err := outputSchema(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Print(string(data))
+}
+
+// schemaNames returns the names of the embedded schemas, sorted.
+func schemaNames() []string {
+	entries, _ := embeddedSchemas.ReadDir("schemas")
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, strings.TrimSuffix(entry.Name(), ".schema.json"))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// outputSchema returns the embedded schema called name.
+func outputSchema(name string) ([]byte, error) {
+	data, err := embeddedSchemas.ReadFile("schemas/" + name + ".schema.json")
+	if err != nil {
+		return nil, fmt.Errorf("unknown schema %q. Available schemas: %s", name, strings.Join(schemaNames(), ", "))
+	}
+	return data, nil
+}
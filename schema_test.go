@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+)
+
+// compileOutputSchema compiles the embedded schema called name.
+func compileOutputSchema(t *testing.T, name string) *jsonschema.Schema {
+	t.Helper()
+	data, err := outputSchema(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Error parsing %s schema: %v", name, err)
+	}
+
+	compiler := jsonschema.NewCompiler()
+	url := name + ".schema.json"
+	if err := compiler.AddResource(url, doc); err != nil {
+		t.Fatalf("Error adding %s schema: %v", name, err)
+	}
+	schema, err := compiler.Compile(url)
+	if err != nil {
+		t.Fatalf("Error compiling %s schema: %v", name, err)
+	}
+	return schema
+}
+
+// validateOutput checks that the JSON document data matches schema.
+func validateOutput(t *testing.T, schema *jsonschema.Schema, label string, data []byte) {
+	t.Helper()
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("%s is not valid JSON: %v", label, err)
+	}
+	if err := schema.Validate(doc); err != nil {
+		t.Errorf("%s does not match its schema: %v", label, err)
+	}
+}
+
+func TestSchemaNames(t *testing.T) {
+	names := schemaNames()
+	if len(names) != 4 || names[0] != "batch" || names[1] != "policy" || names[2] != "report" || names[3] != "scan" {
+		t.Errorf("Unexpected schema names: %v", names)
+	}
+	if _, err := outputSchema("nope"); err == nil {
+		t.Errorf("Expected an error for an unknown schema")
+	}
+}
+
+func TestPolicyOutputMatchesSchema(t *testing.T) {
+	schema := compileOutputSchema(t, "policy")
+
+	result, err := parseTerraformFiles("test-fixtures/companions")
+	if err != nil {
+		t.Fatalf("Error parsing fixture: %v", err)
+	}
+
+	for _, leastPrivilege := range []bool{false, true} {
+		out, err := generateIAMPolicy(result, true, FormatJSON, leastPrivilege)
+		if err != nil {
+			t.Fatalf("Error generating policy: %v", err)
+		}
+		validateOutput(t, schema, "policy", []byte(out))
+	}
+
+	scoped := scopePolicyByTags(buildIAMPolicy(result, false, true), []tagScope{{Key: "Team", Value: "platform"}})
+	out, err := formatPolicy(scoped, result, FormatJSON)
+	if err != nil {
+		t.Fatalf("Error formatting policy: %v", err)
+	}
+	validateOutput(t, schema, "tag-scoped policy", []byte(out))
+
+	validateInvalid := func(label, doc string) {
+		value, err := jsonschema.UnmarshalJSON(bytes.NewReader([]byte(doc)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if schema.Validate(value) == nil {
+			t.Errorf("Expected %s to be rejected", label)
+		}
+	}
+	validateInvalid("a bad Effect", `{"Version": "2012-10-17", "Statement": [{"Effect": "Maybe", "Action": "s3:GetObject"}]}`)
+	validateInvalid("an unknown element", `{"Version": "2012-10-17", "Statement": [{"Effect": "Allow", "Actions": ["s3:GetObject"]}]}`)
+}
+
+func TestReportMatchesSchema(t *testing.T) {
+	schema := compileOutputSchema(t, "report")
+
+	for _, dir := range []string{"test-fixtures", "test-fixtures/partial"} {
+		result, err := parseTerraformFiles(dir)
+		if err != nil {
+			t.Fatalf("Error parsing %s: %v", dir, err)
+		}
+		report := buildRunReport(result, buildIAMPolicy(result, true, true), dir)
+
+		path := filepath.Join(t.TempDir(), "report.json")
+		if err := writeRunReport(report, path, 0644, false); err != nil {
+			t.Fatalf("Error writing report: %v", err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		validateOutput(t, schema, "report for "+dir, data)
+	}
+}
+
+func TestScanExportMatchesSchema(t *testing.T) {
+	schema := compileOutputSchema(t, "scan")
+
+	for _, dir := range []string{"test-fixtures", "test-fixtures/modules", "test-fixtures/partial"} {
+		result, err := parseTerraformFiles(dir)
+		if err != nil {
+			t.Fatalf("Error parsing %s: %v", dir, err)
+		}
+
+		path := filepath.Join(t.TempDir(), "scan.json")
+		if err := exportScan(result, dir, path, 0644, false); err != nil {
+			t.Fatalf("Error exporting scan: %v", err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		validateOutput(t, schema, "scan export of "+dir, data)
+	}
+}
+
+func TestSchemasAreValidJSON(t *testing.T) {
+	for _, name := range schemaNames() {
+		data, _ := outputSchema(name)
+		var doc map[string]interface{}
+		if err := json.Unmarshal(data, &doc); err != nil {
+			t.Errorf("%s schema is not valid JSON: %v", name, err)
+		}
+		if doc["$id"] == nil || doc["title"] == nil {
+			t.Errorf("%s schema is missing $id or title", name)
+		}
+	}
+}
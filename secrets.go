@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+// SecretValueRead is a data source or ephemeral resource that reads the
+// value of a Secrets Manager secret or SSM parameter, as opposed to the
+// resources that manage them. Data sources read the value at plan time and
+// store it in the state; ephemeral resources do not store it. A value
+// encrypted with a customer managed key also takes kms:Decrypt on the key.
+type SecretValueRead struct {
+	Address string `json:"address"`
+	InState bool   `json:"in_state"`
+	// Secret is the managed secret or parameter read, "" when it is not
+	// managed in the scanned configuration and its key is not known.
+	Secret string `json:"secret,omitempty"`
+	// Key is the customer managed key the value is decrypted with: its
+	// address, or its ID, ARN or alias. "" for the AWS managed key.
+	Key     string   `json:"key,omitempty"`
+	keyARNs []string // ARNs kms:Decrypt is scoped to, nil when not known
+}
+
+// secretKeyArguments are the managed types whose values are read, with the
+// argument naming the customer managed key they are encrypted with.
+var secretKeyArguments = map[string]string{
+	"aws_secretsmanager_secret": "kms_key_id",
+	"aws_ssm_parameter":         "key_id",
+}
+
+// secretValueReads returns the reads of secret values in result: the data
+// sources and ephemeral resources whose permissions DB entry sets
+// reads_secret_value, with the secret or parameter they read and its key
+// when the reference graph leads to them.
+func secretValueReads(result *ParseResult) []SecretValueRead {
+	return findSecretValueReads(result, buildReferenceGraph(result))
+}
+
+func findSecretValueReads(result *ParseResult, graph referenceGraph) []SecretValueRead {
+	var reads []SecretValueRead
+	for _, dataSource := range result.DataSources {
+		if !needsAWSPermissions(dataSource) || !readsSecretValue(dataSource) {
+			continue
+		}
+		read := SecretValueRead{Address: resourceAddress(dataSource), InState: dataSource.Kind == KindData}
+		for _, reference := range dataSource.References {
+			secret, ok := graph[reference]
+			if !ok {
+				continue
+			}
+			// A version is read through the secret it belongs to
+			if secret.Type == "aws_secretsmanager_secret_version" {
+				for _, parent := range secret.References {
+					if graph[parent].Type == "aws_secretsmanager_secret" {
+						secret = graph[parent]
+					}
+				}
+			}
+			if _, ok := secretKeyArguments[secret.Type]; !ok || secret.Kind != KindResource {
+				continue
+			}
+			read.Secret = resourceAddress(secret)
+			if decrypts(dataSource) {
+				read.Key, read.keyARNs = secretKey(secret, graph)
+			}
+			break
+		}
+		reads = append(reads, read)
+	}
+	return reads
+}
+
+// readsSecretValue reports whether the permissions DB entry of a data source
+// or ephemeral resource, or the data source entry it falls back to, sets
+// reads_secret_value.
+func readsSecretValue(dataSource Resource) bool {
+	if perms, ok := permissionsDB[dataSource.permissionsKey()]; ok {
+		return perms.ReadsSecretValue
+	}
+	return permissionsDB[KindData.addressPrefix()+dataSource.Type].ReadsSecretValue
+}
+
+// decrypts reports whether a read returns the decrypted value; the SSM
+// parameter reads do unless with_decryption is false.
+func decrypts(dataSource Resource) bool {
+	value, ok := dataSource.Attributes["with_decryption"]
+	return !ok || !value.IsKnown() || value.IsNull() || value.Type() != cty.Bool || value.True()
+}
+
+// secretKey returns the customer managed key a managed secret or SecureString
+// parameter is encrypted with, and the key ARNs when they are known: the
+// aws_kms_key it refers to, or a literal key ID or ARN. Secrets without a key
+// argument, parameters of other types and AWS managed key aliases return "".
+func secretKey(secret Resource, graph referenceGraph) (string, []string) {
+	if secret.Type == "aws_ssm_parameter" {
+		if kind, ok := stringAttribute(secret, "type"); ok && kind != "SecureString" {
+			return "", nil
+		}
+	}
+	argument := secretKeyArguments[secret.Type]
+	if !secret.hasSetting(argument) {
+		return "", nil
+	}
+	for _, reference := range secret.References {
+		if key := graph[reference]; key.Type == "aws_kms_key" || key.Type == "aws_kms_replica_key" {
+			return reference, resourceARNs(&key, defaultARNContext)
+		}
+	}
+	id, ok := stringAttribute(secret, argument)
+	if !ok {
+		return argument + " of " + resourceAddress(secret), nil
+	}
+	if strings.HasPrefix(id, "alias/aws/") {
+		return "", nil
+	}
+	region, _ := stringAttribute(secret, "region")
+	if arn := kmsKeyARN(id, region); arn != "" {
+		return id, []string{arn}
+	}
+	return id, nil
+}
+
+// kmsKeyARN returns the ARN of a KMS key given by ARN or key ID, or "" for
+// aliases, which KMS resolves and authorizes on the key they point to.
+func kmsKeyARN(id, region string) string {
+	switch {
+	case strings.HasPrefix(id, "arn:") && strings.Contains(id, ":key/"):
+		return id
+	case id != "" && !strings.HasPrefix(id, "arn:") && !strings.HasPrefix(id, "alias/"):
+		if region == "" {
+			region = defaultARNContext.Region
+		}
+		return fmt.Sprintf("arn:%s:kms:%s:%s:key/%s", defaultARNContext.Partition, region, defaultARNContext.Account, id)
+	}
+	return ""
+}
+
+// secretKeyPermissions returns the kms:Decrypt each read of a value
+// encrypted with a customer managed key needs, scoped to the key when its
+// ARN is known.
+func secretKeyPermissions(reads []SecretValueRead) []inferredPermission {
+	var inferred []inferredPermission
+	for _, read := range reads {
+		if read.Key == "" {
+			continue
+		}
+		inferred = append(inferred, inferredPermission{
+			Address: read.Address,
+			Target:  read.Key,
+			Actions: []string{"kms:Decrypt"},
+			ARNs:    read.keyARNs,
+			Reason:  "decrypts the value of " + read.Secret,
+		})
+	}
+	return inferred
+}
+
+// printSecretValueReads lists the reads of secret values in the run summary.
+func printSecretValueReads(reads []SecretValueRead) {
+	if len(reads) == 0 {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "  Secret values read: %d\n", len(reads))
+	for _, read := range reads {
+		where := "at plan time, stored in the state"
+		if !read.InState {
+			where = "ephemeral, not stored"
+		}
+		var key string
+		switch {
+		case read.Secret == "":
+			key = "key not known: grant kms:Decrypt on it if it is a customer managed key"
+		case read.Key == "":
+			key = read.Secret + ", no customer managed key"
+		default:
+			key = read.Secret + ", kms:Decrypt on " + read.Key
+		}
+		fmt.Fprintf(os.Stderr, "    - %s (%s; %s)\n", read.Address, where, key)
+	}
+}
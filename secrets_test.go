@@ -0,0 +1,115 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestSecretValueReads(t *testing.T) {
+	if err := loadPermissionsDB(); err != nil {
+		t.Fatalf("Error loading permissions DB: %v", err)
+	}
+	result, err := parseTerraformFiles("test-fixtures/secrets")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	byAddress := make(map[string]SecretValueRead)
+	for _, read := range secretValueReads(result) {
+		byAddress[read.Address] = read
+	}
+	tests := []struct {
+		address, secret, key string
+		inState              bool
+	}{
+		// The version is followed to the secret and its key
+		{"data.aws_secretsmanager_secret_version.db", "aws_secretsmanager_secret.db", "aws_kms_key.secrets", true},
+		{"ephemeral.aws_secretsmanager_secret_version.db", "aws_secretsmanager_secret.db", "aws_kms_key.secrets", false},
+		{"data.aws_ssm_parameter.token", "aws_ssm_parameter.token", "1234abcd-12ab-34cd-56ef-1234567890ab", true},
+		// A String parameter is not encrypted
+		{"data.aws_ssm_parameter.endpoint", "aws_ssm_parameter.endpoint", "", true},
+		{"data.aws_ssm_parameter.shared", "", "", true},
+	}
+	if len(byAddress) != len(tests) {
+		t.Errorf("Expected %d reads, got %+v", len(tests), byAddress)
+	}
+	for _, tt := range tests {
+		read, ok := byAddress[tt.address]
+		if !ok {
+			t.Errorf("Expected a read by %s", tt.address)
+			continue
+		}
+		if read.Secret != tt.secret || read.Key != tt.key || read.InState != tt.inState {
+			t.Errorf("%s: got %+v, want secret %q key %q in state %v", tt.address, read, tt.secret, tt.key, tt.inState)
+		}
+	}
+}
+
+func TestSecretValueReadPermissions(t *testing.T) {
+	if err := loadPermissionsDB(); err != nil {
+		t.Fatalf("Error loading permissions DB: %v", err)
+	}
+	result, err := parseTerraformFiles("test-fixtures/secrets")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Managing a secret does not read its value; reading it does
+	if containsString(getRequiredPermissions("aws_secretsmanager_secret"), "secretsmanager:GetSecretValue") {
+		t.Errorf("aws_secretsmanager_secret should not read the secret value")
+	}
+	contributions := make(map[string][]string)
+	for _, contribution := range collectContributions(result) {
+		contributions[contribution.Address] = contribution.Actions
+	}
+	for address, want := range map[string]string{
+		"data.aws_secretsmanager_secret_version.db": "secretsmanager:GetSecretValue",
+		"data.aws_ssm_parameter.token":              "ssm:GetParameter",
+	} {
+		if !containsString(contributions[address], want) || !containsString(contributions[address], "kms:Decrypt") {
+			t.Errorf("Expected %s and kms:Decrypt for %s, got %v", want, address, contributions[address])
+		}
+	}
+	if containsString(contributions["data.aws_ssm_parameter.endpoint"], "kms:Decrypt") {
+		t.Errorf("A String parameter needs no kms:Decrypt")
+	}
+
+	tokenKey := "arn:aws:kms:*:*:key/1234abcd-12ab-34cd-56ef-1234567890ab"
+	var scoped bool
+	for _, statement := range buildResourcePolicy(result, false).Statement {
+		if containsString(toStringSlice(statement.Action), "kms:Decrypt") && containsString(toStringSlice(statement.Resource), tokenKey) {
+			scoped = true
+		}
+	}
+	if !scoped {
+		t.Errorf("Expected kms:Decrypt scoped to %s", tokenKey)
+	}
+
+	// Without decryption the value is read encrypted
+	for i := range result.DataSources {
+		if resourceAddress(result.DataSources[i]) == "data.aws_ssm_parameter.token" {
+			result.DataSources[i].Attributes["with_decryption"] = cty.False
+		}
+	}
+	for _, read := range secretValueReads(result) {
+		if read.Address == "data.aws_ssm_parameter.token" && read.Key != "" {
+			t.Errorf("Expected no key with with_decryption = false, got %s", read.Key)
+		}
+	}
+}
+
+func TestKMSKeyARN(t *testing.T) {
+	tests := map[string]string{
+		"arn:aws:kms:eu-west-1:111122223333:key/abcd": "arn:aws:kms:eu-west-1:111122223333:key/abcd",
+		"abcd":      "arn:aws:kms:*:*:key/abcd",
+		"alias/app": "",
+		"arn:aws:kms:eu-west-1:111122223333:alias/app": "",
+		"": "",
+	}
+	for id, want := range tests {
+		if got := kmsKeyARN(id, ""); got != want {
+			t.Errorf("kmsKeyARN(%q) = %q, want %q", id, got, want)
+		}
+	}
+}
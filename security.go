@@ -0,0 +1,293 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Severities of security findings.
+const (
+	FindingHigh   = "high"
+	FindingMedium = "medium"
+)
+
+// Rules of security findings.
+const (
+	RuleHardcodedCredential   = "hardcoded-credential"
+	RuleAdminPolicy           = "admin-policy"
+	RuleAdminPolicyAttachment = "admin-policy-attachment"
+	RulePublicTrustPolicy     = "public-trust-policy"
+	RuleSecretWithoutPGP      = "secret-without-pgp"
+)
+
+// SecurityFinding is an anti-pattern seen in the Terraform source while
+// scanning it: a credential written into the code, or IAM configuration that
+// grants or exposes more than intended. Findings never quote the values they
+// are about.
+type SecurityFinding struct {
+	ID       string `json:"id"`
+	Rule     string `json:"rule"`
+	Severity string `json:"severity"`
+	Address  string `json:"address,omitempty"`
+	Location string `json:"location,omitempty"`
+	Message  string `json:"message"`
+}
+
+// credentialAttributes are the attribute names whose literal string value is
+// a credential written into the code.
+var credentialAttributes = map[string]bool{
+	"access_key":        true,
+	"secret_key":        true,
+	"secret_access_key": true,
+	"token":             true,
+	"password":          true,
+	"master_password":   true,
+}
+
+// adminPolicyARNSuffix ends the ARN of the AWS managed policy granting every
+// action on every resource.
+const adminPolicyARNSuffix = ":policy/AdministratorAccess"
+
+// providerFindings returns the findings of a provider block, which is not
+// kept after parsing: credentials given as literals instead of coming from
+// the environment, a profile or an assumed role.
+func providerFindings(block *hclsyntax.Block) []SecurityFinding {
+	if len(block.Labels) == 0 || block.Labels[0] != "aws" || block.Body == nil {
+		return nil
+	}
+	var findings []SecurityFinding
+	location := fmt.Sprintf("%s:%d", filepath.ToSlash(block.DefRange().Filename), block.DefRange().Start.Line)
+	for _, name := range []string{"access_key", "secret_key", "token"} {
+		attr, ok := block.Body.Attributes[name]
+		if !ok {
+			continue
+		}
+		if value, diags := attr.Expr.Value(nil); !diags.HasErrors() && isLiteralString(value) {
+			findings = append(findings, SecurityFinding{
+				ID:       ruleID(RuleHardcodedCredential),
+				Rule:     RuleHardcodedCredential,
+				Severity: FindingHigh,
+				Address:  "provider.aws",
+				Location: location,
+				Message:  fmt.Sprintf("%s is a literal; take credentials from the environment, a profile or assume_role", name),
+			})
+		}
+	}
+	return findings
+}
+
+// recordSecurityFindings adds the findings of the resources and data sources
+// of result to those of its provider blocks. It runs once a directory is
+// parsed, overrides and module addresses included, and before
+// redactParseResult drops the values it checks.
+func recordSecurityFindings(result *ParseResult) {
+	for _, ds := range result.DataSources {
+		result.Findings = append(result.Findings, credentialFindings(ds)...)
+	}
+	for _, r := range result.Resources {
+		result.Findings = append(result.Findings, credentialFindings(r)...)
+		result.Findings = append(result.Findings, iamFindings(r)...)
+	}
+}
+
+// credentialFindings reports the literal credentials among the attributes of
+// a resource or data source: values that look like a credential whatever
+// their attribute, and literal values of credentialAttributes.
+func credentialFindings(resource Resource) []SecurityFinding {
+	var findings []SecurityFinding
+	for _, name := range sortedAttributeNames(resource.Attributes) {
+		value := resource.Attributes[name]
+		if !isLiteralString(value) {
+			continue
+		}
+		setting := name[strings.LastIndex(name, ".")+1:]
+		var message string
+		switch {
+		case isSecretValue(value.AsString()):
+			message = fmt.Sprintf("%s holds what looks like a credential", name)
+		case credentialAttributes[setting] && !strings.HasPrefix(value.AsString(), "arn:"):
+			message = fmt.Sprintf("%s is a literal; pass it in from a sensitive variable or a secrets manager", name)
+		default:
+			continue
+		}
+		findings = append(findings, resourceFinding(resource, RuleHardcodedCredential, FindingHigh, message))
+	}
+	return findings
+}
+
+// iamFindings reports IAM resources that grant administrator access, trust
+// any principal, or keep a secret unencrypted in the state.
+func iamFindings(resource Resource) []SecurityFinding {
+	var findings []SecurityFinding
+	add := func(rule, severity, format string, args ...interface{}) {
+		findings = append(findings, resourceFinding(resource, rule, severity, fmt.Sprintf(format, args...)))
+	}
+
+	switch resource.Type {
+	case "aws_iam_policy", "aws_iam_role_policy", "aws_iam_user_policy", "aws_iam_group_policy", "aws_iam_role":
+		for _, name := range []string{"policy", "inline_policy.policy"} {
+			if document, ok := literalAttribute(resource, name); ok && grantsEverything(document) {
+				add(RuleAdminPolicy, FindingHigh, "%s allows Action \"*\" on Resource \"*\"", name)
+			}
+		}
+	case "aws_iam_user_login_profile":
+		if !resource.hasSetting("pgp_key") {
+			add(RuleSecretWithoutPGP, FindingMedium, "no pgp_key: the generated password is stored unencrypted in the state")
+		}
+	case "aws_iam_access_key":
+		if !resource.hasSetting("pgp_key") {
+			add(RuleSecretWithoutPGP, FindingMedium, "no pgp_key: the secret access key is stored unencrypted in the state")
+		}
+	}
+
+	if document, ok := literalAttribute(resource, "assume_role_policy"); ok && trustsAnyone(document) {
+		add(RulePublicTrustPolicy, FindingHigh, "assume_role_policy lets any principal assume the role without a condition")
+	}
+
+	var attached []string
+	if value, ok := resource.Attributes["policy_arn"]; ok && isLiteralString(value) {
+		attached = append(attached, value.AsString())
+	}
+	if value, ok := resource.Attributes["managed_policy_arns"]; ok && value.IsKnown() {
+		attached = append(attached, stringValues(value)...)
+	}
+	for _, arn := range attached {
+		if strings.HasSuffix(arn, adminPolicyARNSuffix) {
+			add(RuleAdminPolicyAttachment, FindingMedium, "attaches AdministratorAccess")
+		}
+	}
+	return findings
+}
+
+// resourceFinding returns a finding about resource.
+func resourceFinding(resource Resource, rule, severity, message string) SecurityFinding {
+	return SecurityFinding{
+		ID:       ruleID(rule),
+		Rule:     rule,
+		Severity: severity,
+		Address:  resourceAddress(resource),
+		Location: resourceLocation(resource),
+		Message:  message,
+	}
+}
+
+// isLiteralString reports whether value is a known, non-empty string.
+func isLiteralString(value cty.Value) bool {
+	return value.IsWhollyKnown() && !value.IsNull() && value.Type() == cty.String && value.AsString() != ""
+}
+
+// literalAttribute returns the literal string value of the named attribute.
+func literalAttribute(resource Resource, name string) (string, bool) {
+	value, ok := resource.Attributes[name]
+	if !ok || !isLiteralString(value) {
+		return "", false
+	}
+	return value.AsString(), true
+}
+
+// sortedAttributeNames returns the names of attributes in order, so findings
+// are reported in the same order every run.
+func sortedAttributeNames(attributes map[string]cty.Value) []string {
+	names := make(map[string]bool, len(attributes))
+	for name := range attributes {
+		names[name] = true
+	}
+	return sortedSet(names)
+}
+
+// grantsEverything reports whether the policy document has an Allow
+// statement for every action on every resource.
+func grantsEverything(document string) bool {
+	policy, _, err := lintPolicy([]byte(document))
+	if err != nil {
+		return false
+	}
+	for _, statement := range policy.Statement {
+		if statement.Effect != "Allow" {
+			continue
+		}
+		actions, resources := toStringSlice(statement.Action), toStringSlice(statement.Resource)
+		if (containsString(actions, "*") || containsString(actions, "*:*")) && containsString(resources, "*") {
+			return true
+		}
+	}
+	return false
+}
+
+// trustStatement is a statement of a role trust policy.
+type trustStatement struct {
+	Effect    string                 `json:"Effect"`
+	Principal interface{}            `json:"Principal"`
+	Condition map[string]interface{} `json:"Condition"`
+}
+
+// trustStatements decodes the statements of a trust policy document, whose
+// Statement may be a single object, and reports whether it could.
+func trustStatements(document string) ([]trustStatement, bool) {
+	var policy struct {
+		Statement json.RawMessage `json:"Statement"`
+	}
+	if err := json.Unmarshal([]byte(document), &policy); err != nil {
+		return nil, false
+	}
+	var statements []trustStatement
+	if err := json.Unmarshal(policy.Statement, &statements); err != nil {
+		var statement trustStatement
+		if json.Unmarshal(policy.Statement, &statement) != nil {
+			return nil, false
+		}
+		statements = []trustStatement{statement}
+	}
+	return statements, true
+}
+
+// trustsAnyone reports whether the trust policy document has an Allow
+// statement whose principal is "*" and that has no condition.
+func trustsAnyone(document string) bool {
+	statements, _ := trustStatements(document)
+	for _, statement := range statements {
+		if statement.Effect != "Allow" || len(statement.Condition) > 0 {
+			continue
+		}
+		switch principal := statement.Principal.(type) {
+		case string:
+			if principal == "*" {
+				return true
+			}
+		case map[string]interface{}:
+			if containsString(toStringSlice(principal["AWS"]), "*") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// printSecurityFindings lists the security findings in the run summary.
+func printSecurityFindings(findings []SecurityFinding) {
+	if len(findings) == 0 {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "  Security findings: %d\n", len(findings))
+	printFindingLines(findings)
+}
+
+// printFindingLines prints a summary line per finding.
+func printFindingLines(findings []SecurityFinding) {
+	for _, finding := range findings {
+		where := finding.Address
+		if finding.Location != "" {
+			where += " (" + finding.Location + ")"
+		}
+		if where != "" {
+			where += ": "
+		}
+		fmt.Fprintf(os.Stderr, "    - [%s] %s %s: %s%s\n", finding.Severity, finding.ID, finding.Rule, where, finding.Message)
+	}
+}
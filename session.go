@@ -0,0 +1,347 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Policy types accepted by --policy-type.
+const (
+	PolicyTypeManaged = "managed"
+	PolicyTypeSession = "session"
+)
+
+// sessionPolicySizeLimit is the maximum size of an STS session policy passed
+// to AssumeRole or GetFederationToken, counted like policySize.
+const sessionPolicySizeLimit = 2048
+
+var policyTypeFlag = PolicyTypeManaged
+
+// validatePolicyType checks the --policy-type value.
+func validatePolicyType(policyType string) error {
+	switch policyType {
+	case PolicyTypeManaged, PolicyTypeSession:
+		return nil
+	}
+	return fmt.Errorf("invalid --policy-type %q. Valid values: %s, %s", policyType, PolicyTypeManaged, PolicyTypeSession)
+}
+
+// policySizeLimit returns the size limit of the selected policy type.
+func policySizeLimit() int {
+	if policyTypeFlag == PolicyTypeSession {
+		return sessionPolicySizeLimit
+	}
+	return managedPolicySizeLimit
+}
+
+// Granularity levels given up by compressPolicy, from least to most access,
+// and by compressActions.
+const (
+	CompressionSafePrefix = "safe-prefix-wildcard"
+	CompressionPrefix     = "prefix-wildcard"
+	CompressionService    = "service-wildcard"
+	CompressionResource   = "resource-wildcard"
+)
+
+// policyCompression records one loss of granularity made to fit a policy in
+// its size limit: the actions of a service replaced by wildcards, or the
+// resource scoping of the statements dropped. Adds lists, for the wildcards
+// of a safe-prefix-wildcard step, the actions each grants beyond the ones it
+// replaced.
+type policyCompression struct {
+	Level   string              `json:"level"`
+	Service string              `json:"service,omitempty"`
+	Before  int                 `json:"before"`
+	After   []string            `json:"after,omitempty"`
+	Adds    map[string][]string `json:"adds,omitempty"`
+}
+
+// compressPolicy shrinks policy until it fits in limit characters. Statements
+// on the same resources are merged first, which grants nothing new. Then, in
+// order and only as far as needed, the actions of a service sharing a verb
+// are collapsed into a prefix wildcard (ec2:Describe*), the statements are
+// merged onto Resource "*", and whole services are collapsed into a service
+// wildcard (ec2:*). Wildcards go to the services saving the most first. It
+// returns the compressed policy and what was given up; the policy may still
+// exceed limit when even the last step is not enough.
+func compressPolicy(policy IAMPolicy, limit int) (IAMPolicy, []policyCompression) {
+	if policySize(policy) <= limit {
+		return policy, nil
+	}
+
+	compressed, steps := collapseServices(mergeStatementsByResource(policy), limit, CompressionPrefix, prefixWildcards)
+	if policySize(compressed) > limit {
+		var merged int
+		compressed, merged = mergeOntoWildcardResource(compressed)
+		if merged > 1 {
+			steps = append(steps, policyCompression{Level: CompressionResource, Before: merged})
+		}
+	}
+	if policySize(compressed) > limit {
+		var serviceSteps []policyCompression
+		compressed, serviceSteps = collapseServices(compressed, limit, CompressionService, serviceWildcard)
+		steps = append(steps, serviceSteps...)
+	}
+
+	return compressed, steps
+}
+
+// collapseServices rewrites the actions of one service at a time with
+// rewrite, the services saving the most first, until policy fits in limit
+// characters. It returns the rewritten policy and a step of level per
+// service rewritten.
+func collapseServices(policy IAMPolicy, limit int, level string, rewrite func(service string, actions []string) []string) (IAMPolicy, []policyCompression) {
+	type candidate struct {
+		service string
+		saving  int
+	}
+	size := policySize(policy)
+	var candidates []candidate
+	for _, service := range policyServices(policy) {
+		if saving := size - policySize(rewriteServiceActions(policy, service, rewrite)); saving > 0 {
+			candidates = append(candidates, candidate{service, saving})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].saving > candidates[j].saving })
+
+	var steps []policyCompression
+	for _, c := range candidates {
+		if policySize(policy) <= limit {
+			break
+		}
+		before := serviceActions(policy, c.service)
+		policy = rewriteServiceActions(policy, c.service, rewrite)
+		steps = append(steps, policyCompression{
+			Level:   level,
+			Service: c.service,
+			Before:  len(before),
+			After:   serviceActions(policy, c.service),
+		})
+	}
+	return policy, steps
+}
+
+// compressible reports whether compressPolicy may rewrite statement. Deny
+// statements and conditioned statements, such as those of --scope-by-tag,
+// are kept as they are.
+func compressible(statement IAMStatement) bool {
+	return statement.Effect == "Allow" && len(statement.Condition) == 0 && statement.Action != nil
+}
+
+// mergeStatementsByResource merges the compressible statements granting the
+// same resources into one statement.
+func mergeStatementsByResource(policy IAMPolicy) IAMPolicy {
+	merged := IAMPolicy{Version: policy.Version, Id: policy.Id}
+	byResource := make(map[string]int)
+	for _, statement := range policy.Statement {
+		if !compressible(statement) {
+			merged.Statement = append(merged.Statement, statement)
+			continue
+		}
+		key, _ := json.Marshal(statement.Resource)
+		if i, ok := byResource[string(key)]; ok {
+			actions := append(toStringSlice(merged.Statement[i].Action), toStringSlice(statement.Action)...)
+			merged.Statement[i].Action = dedupeActions(actions)
+			continue
+		}
+		byResource[string(key)] = len(merged.Statement)
+		statement.Action = dedupeActions(toStringSlice(statement.Action))
+		merged.Statement = append(merged.Statement, statement)
+	}
+	return merged
+}
+
+// mergeOntoWildcardResource replaces the compressible statements with a
+// single statement on Resource "*" and returns how many were merged.
+func mergeOntoWildcardResource(policy IAMPolicy) (IAMPolicy, int) {
+	merged := IAMPolicy{Version: policy.Version, Id: policy.Id}
+	var actions []string
+	count := 0
+	for _, statement := range policy.Statement {
+		if !compressible(statement) {
+			merged.Statement = append(merged.Statement, statement)
+			continue
+		}
+		actions = append(actions, toStringSlice(statement.Action)...)
+		count++
+	}
+	if count == 0 {
+		return policy, 0
+	}
+
+	byService := make(map[string][]string)
+	for _, action := range dedupeActions(actions) {
+		service, _, _ := strings.Cut(action, ":")
+		byService[service] = append(byService[service], action)
+	}
+	var combined []string
+	for service, serviceActions := range byService {
+		if containsString(serviceActions, service+":*") {
+			serviceActions = []string{service + ":*"}
+		}
+		combined = append(combined, serviceActions...)
+	}
+	sort.Strings(combined)
+
+	merged.Statement = append([]IAMStatement{{Effect: "Allow", Action: combined, Resource: "*"}}, merged.Statement...)
+	return merged, count
+}
+
+// rewriteServiceActions returns a copy of policy in which the actions of
+// service in every compressible statement are replaced by rewrite(actions).
+func rewriteServiceActions(policy IAMPolicy, service string, rewrite func(service string, actions []string) []string) IAMPolicy {
+	rewritten := IAMPolicy{Version: policy.Version, Id: policy.Id}
+	for _, statement := range policy.Statement {
+		if !compressible(statement) {
+			rewritten.Statement = append(rewritten.Statement, statement)
+			continue
+		}
+		var own, others []string
+		for _, action := range toStringSlice(statement.Action) {
+			if actionService, _, _ := strings.Cut(action, ":"); actionService == service {
+				own = append(own, action)
+			} else {
+				others = append(others, action)
+			}
+		}
+		if len(own) > 0 {
+			actions := append(others, rewrite(service, own)...)
+			sort.Strings(actions)
+			statement.Action = actions
+		}
+		rewritten.Statement = append(rewritten.Statement, statement)
+	}
+	return rewritten
+}
+
+// prefixWildcards collapses the actions sharing a leading verb, such as
+// DescribeInstances and DescribeVpcs, into a wildcard (ec2:Describe*). Verbs
+// with a single action are left alone.
+func prefixWildcards(service string, actions []string) []string {
+	byVerb := make(map[string][]string)
+	var out []string
+	for _, action := range actions {
+		_, name, _ := strings.Cut(action, ":")
+		verb := actionVerb(name)
+		if verb == "" {
+			out = append(out, action)
+			continue
+		}
+		byVerb[verb] = append(byVerb[verb], action)
+	}
+	for verb, verbActions := range byVerb {
+		if len(verbActions) > 1 {
+			out = append(out, service+":"+verb+"*")
+		} else {
+			out = append(out, verbActions...)
+		}
+	}
+	return dedupeActions(out)
+}
+
+// serviceWildcard replaces all actions of service with service:*.
+func serviceWildcard(service string, actions []string) []string {
+	return []string{service + ":*"}
+}
+
+// actionVerb returns the leading verb of an action name, e.g. "Describe" for
+// DescribeInstances, or "" when the name is a wildcard or has no verb.
+func actionVerb(name string) string {
+	if name == "" || strings.ContainsAny(name, "*?") || name[0] < 'A' || name[0] > 'Z' {
+		return ""
+	}
+	end := 1
+	for end < len(name) && name[end] >= 'a' && name[end] <= 'z' {
+		end++
+	}
+	if end == len(name) {
+		return ""
+	}
+	return name[:end]
+}
+
+// policyServices returns the services of the actions in the compressible
+// statements, sorted.
+func policyServices(policy IAMPolicy) []string {
+	seen := make(map[string]bool)
+	for _, statement := range policy.Statement {
+		if !compressible(statement) {
+			continue
+		}
+		for _, action := range toStringSlice(statement.Action) {
+			if service, _, ok := strings.Cut(action, ":"); ok {
+				seen[service] = true
+			}
+		}
+	}
+	return sortedSet(seen)
+}
+
+// serviceActions returns the distinct actions of service in the compressible
+// statements, sorted.
+func serviceActions(policy IAMPolicy, service string) []string {
+	seen := make(map[string]bool)
+	for _, statement := range policy.Statement {
+		if !compressible(statement) {
+			continue
+		}
+		for _, action := range toStringSlice(statement.Action) {
+			if actionService, _, _ := strings.Cut(action, ":"); actionService == service {
+				seen[action] = true
+			}
+		}
+	}
+	return sortedSet(seen)
+}
+
+// wildcardsIn returns the actions containing a wildcard.
+func wildcardsIn(actions []string) []string {
+	var wildcards []string
+	for _, action := range actions {
+		if strings.ContainsAny(action, "*?") {
+			wildcards = append(wildcards, action)
+		}
+	}
+	return wildcards
+}
+
+// dedupeActions returns actions without duplicates, sorted.
+func dedupeActions(actions []string) []string {
+	seen := make(map[string]bool, len(actions))
+	for _, action := range actions {
+		seen[action] = true
+	}
+	return sortedSet(seen)
+}
+
+// printPolicyCompression reports on stderr the granularity compressPolicy
+// gave up to fit the policy in limit characters.
+func printPolicyCompression(steps []policyCompression, size, limit int) {
+	if len(steps) > 0 {
+		fmt.Fprintf(os.Stderr, "  Compressed to fit the %d character %s policy limit:\n", limit, policyTypeFlag)
+		for _, step := range steps {
+			switch step.Level {
+			case CompressionResource:
+				fmt.Fprintf(os.Stderr, "    - %d statements merged onto Resource \"*\"\n", step.Before)
+			default:
+				fmt.Fprintf(os.Stderr, "    - %s: %d actions -> %s\n", step.Service, step.Before, strings.Join(wildcardsIn(step.After), ", "))
+			}
+			for _, wildcard := range wildcardsIn(step.After) {
+				adds, ok := step.Adds[wildcard]
+				switch {
+				case !ok:
+				case len(adds) == 0:
+					fmt.Fprintf(os.Stderr, "        %s grants nothing more\n", wildcard)
+				default:
+					fmt.Fprintf(os.Stderr, "        %s also grants %s\n", wildcard, strings.Join(adds, ", "))
+				}
+			}
+		}
+	}
+	if size > limit {
+		fmt.Fprintf(os.Stderr, "  Warning: policy is %d characters and still exceeds the %d character %s policy limit\n", size, limit, policyTypeFlag)
+	}
+}
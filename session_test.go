@@ -0,0 +1,122 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidatePolicyType(t *testing.T) {
+	for _, policyType := range []string{PolicyTypeManaged, PolicyTypeSession} {
+		if err := validatePolicyType(policyType); err != nil {
+			t.Errorf("Unexpected error for %s: %v", policyType, err)
+		}
+	}
+	if err := validatePolicyType("inline"); err == nil {
+		t.Errorf("Expected an error for an unknown policy type")
+	}
+}
+
+func TestActionVerb(t *testing.T) {
+	cases := map[string]string{
+		"DescribeInstances": "Describe",
+		"GetObject":         "Get",
+		"Scan":              "",
+		"*":                 "",
+		"Get*":              "",
+		"createFunction":    "",
+	}
+	for name, want := range cases {
+		if got := actionVerb(name); got != want {
+			t.Errorf("actionVerb(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestCompressPolicyFits(t *testing.T) {
+	policy := IAMPolicy{
+		Version: "2012-10-17",
+		Statement: []IAMStatement{
+			{Effect: "Allow", Action: []string{"s3:GetObject"}, Resource: "*"},
+		},
+	}
+	compressed, steps := compressPolicy(policy, sessionPolicySizeLimit)
+	if len(steps) != 0 || len(compressed.Statement) != 1 {
+		t.Errorf("A policy within the limit should be left alone, got %+v", steps)
+	}
+}
+
+func TestCompressPolicy(t *testing.T) {
+	var ec2Actions, s3Actions []string
+	for _, name := range []string{"Instances", "Vpcs", "Subnets", "SecurityGroups", "RouteTables", "Volumes"} {
+		ec2Actions = append(ec2Actions, "ec2:Describe"+name, "ec2:Create"+strings.TrimSuffix(name, "s"))
+	}
+	for _, name := range []string{"Object", "ObjectAcl", "ObjectTagging", "BucketPolicy", "BucketTagging"} {
+		s3Actions = append(s3Actions, "s3:Get"+name, "s3:Put"+name)
+	}
+	policy := IAMPolicy{
+		Version: "2012-10-17",
+		Statement: []IAMStatement{
+			{Effect: "Allow", Action: ec2Actions, Resource: "*"},
+			{Effect: "Allow", Action: s3Actions, Resource: "arn:aws:s3:::my-bucket/*"},
+			{Effect: "Allow", Action: []string{"sts:GetCallerIdentity"}, Resource: "*"},
+			{Effect: "Deny", Action: []string{"s3:DeleteBucket"}, Resource: "*"},
+		},
+	}
+
+	// Merging the two statements on "*" is not enough; prefix wildcards on
+	// the service saving the most are.
+	limit := policySize(policy) - 200
+	compressed, steps := compressPolicy(policy, limit)
+	if size := policySize(compressed); size > limit {
+		t.Fatalf("Policy is %d characters, over the %d limit", size, limit)
+	}
+	if len(steps) != 1 || steps[0].Level != CompressionPrefix || steps[0].Service != "ec2" {
+		t.Fatalf("Expected only ec2 prefix wildcards, got %+v", steps)
+	}
+	if !containsString(steps[0].After, "ec2:Describe*") || !containsString(steps[0].After, "ec2:Create*") {
+		t.Errorf("Unexpected ec2 actions: %v", steps[0].After)
+	}
+	if len(compressed.Statement) != 3 {
+		t.Errorf("Expected the statements on \"*\" to be merged, got %d statements", len(compressed.Statement))
+	}
+	if last := compressed.Statement[len(compressed.Statement)-1]; last.Effect != "Deny" {
+		t.Errorf("Deny statements must be kept, got %+v", last)
+	}
+
+	// A tight limit drops the resource scoping, then wildcards whole services.
+	compressed, steps = compressPolicy(policy, 150)
+	levels := make(map[string]bool)
+	for _, step := range steps {
+		levels[step.Level] = true
+	}
+	if !levels[CompressionPrefix] || !levels[CompressionResource] || !levels[CompressionService] {
+		t.Errorf("Expected every compression level, got %+v", steps)
+	}
+	actions := toStringSlice(compressed.Statement[0].Action)
+	if !containsString(actions, "ec2:*") || compressed.Statement[0].Resource != "*" {
+		t.Errorf("Unexpected compressed statement: %+v", compressed.Statement[0])
+	}
+	if !containsString(toStringSlice(compressed.Statement[1].Action), "s3:DeleteBucket") {
+		t.Errorf("Deny statements must be kept, got %+v", compressed.Statement[1])
+	}
+}
+
+func TestSizeLimitGateFollowsPolicyType(t *testing.T) {
+	defer func() { policyTypeFlag = PolicyTypeManaged }()
+
+	var actions []string
+	for i := 0; i < 150; i++ {
+		actions = append(actions, "s3:GetObject"+strings.Repeat("x", i%10))
+	}
+	policy := IAMPolicy{Version: "2012-10-17", Statement: []IAMStatement{{Effect: "Allow", Action: actions, Resource: "*"}}}
+	result := &ParseResult{}
+
+	if violations := evaluateGates([]string{GateSizeLimit}, policy, result); len(violations) != 0 {
+		t.Errorf("Policy fits a managed policy, got %+v", violations)
+	}
+	policyTypeFlag = PolicyTypeSession
+	violations := evaluateGates([]string{GateSizeLimit}, policy, result)
+	if len(violations) != 1 || !strings.Contains(violations[0].Message, "2048 character session policy limit") {
+		t.Errorf("Expected a session size-limit violation, got %+v", violations)
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamtypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/spf13/pflag"
+)
+
+var (
+	simulateRoleFlag      string
+	simulateBatchSizeFlag int
+	simulateParallelFlag  int
+)
+
+// exitSimulationDenied is returned by --simulate-role when the principal is
+// denied at least one action of the generated policy.
+const exitSimulationDenied = 16
+
+// Defaults of the simulation batching. IAM evaluates every action of a
+// SimulatePrincipalPolicy call against every resource, so large calls are
+// slow and page their results; a few concurrent calls of moderate size keep
+// a policy of hundreds of actions to seconds without tripping throttling.
+const (
+	defaultSimulateBatchSize = 50
+	maxSimulateBatchSize     = 1000
+	defaultSimulateParallel  = 4
+)
+
+func init() {
+	for _, flags := range []*pflag.FlagSet{rootCmd.Flags(), scanCmd.Flags()} {
+		flags.StringVar(&simulateRoleFlag, "simulate-role", "", "Simulate every action of the generated policy as this IAM role or user ARN with iam:SimulatePrincipalPolicy and report the denied actions by service")
+		flags.IntVar(&simulateBatchSizeFlag, "simulate-batch-size", defaultSimulateBatchSize, "With --simulate-role, actions per SimulatePrincipalPolicy call")
+		flags.IntVar(&simulateParallelFlag, "simulate-parallel", defaultSimulateParallel, "With --simulate-role, SimulatePrincipalPolicy calls in flight at once")
+	}
+}
+
+// validateSimulateFlags checks the flags --simulate-role depends on.
+func validateSimulateFlags() error {
+	if simulateRoleFlag == "" {
+		return nil
+	}
+	if !strings.HasPrefix(simulateRoleFlag, "arn:") || !strings.Contains(simulateRoleFlag, ":iam::") {
+		return fmt.Errorf("--simulate-role %q is not an IAM role or user ARN", simulateRoleFlag)
+	}
+	if simulateBatchSizeFlag < 1 || simulateBatchSizeFlag > maxSimulateBatchSize {
+		return fmt.Errorf("--simulate-batch-size must be between 1 and %d", maxSimulateBatchSize)
+	}
+	if simulateParallelFlag < 1 {
+		return fmt.Errorf("--simulate-parallel must be at least 1")
+	}
+	if templateVarsFlag != "" {
+		return fmt.Errorf("--simulate-role cannot be used with --template-vars: the placeholders are not valid resource ARNs")
+	}
+	return nil
+}
+
+// simulationBatch is one SimulatePrincipalPolicy call: actions of one
+// statement evaluated against its resources ("*" when nil).
+type simulationBatch struct {
+	Actions   []string
+	Resources []string
+}
+
+// SimulationReport is the outcome of --simulate-role, in the run report.
+type SimulationReport struct {
+	Principal string              `json:"principal"`
+	Actions   int                 `json:"actions"`
+	Calls     int                 `json:"calls"`
+	Denied    map[string][]string `json:"denied"` // denied actions by service prefix
+	Errors    []string            `json:"errors,omitempty"`
+}
+
+// deniedCount is the number of denied actions.
+func (r *SimulationReport) deniedCount() int {
+	count := 0
+	for _, actions := range r.Denied {
+		count += len(actions)
+	}
+	return count
+}
+
+// simulationBatches splits the Allow statements of policy into calls of at
+// most size actions. Wildcard actions are expanded through the action
+// catalog, since the simulator only takes action names. Resources with
+// wildcards, which the simulator would compare literally, are simulated as
+// "*". Conditions are not simulated.
+func simulationBatches(policy IAMPolicy, size int) []simulationBatch {
+	var batches []simulationBatch
+	for _, statement := range policy.Statement {
+		if statement.Effect != "Allow" {
+			continue
+		}
+		var actions []string
+		for _, action := range toStringSlice(statement.Action) {
+			if strings.Contains(action, "*") {
+				actions = append(actions, expandActionPattern(action)...)
+			} else {
+				actions = append(actions, action)
+			}
+		}
+		actions = dedupeActions(actions)
+		sort.Strings(actions)
+
+		var resources []string
+		for _, resource := range toStringSlice(statement.Resource) {
+			if strings.Contains(resource, "*") {
+				resources = nil
+				break
+			}
+			resources = append(resources, resource)
+		}
+
+		for start := 0; start < len(actions); start += size {
+			end := min(start+size, len(actions))
+			batches = append(batches, simulationBatch{Actions: actions[start:end], Resources: resources})
+		}
+	}
+	return batches
+}
+
+// simulatePolicy runs batches against principal, at most parallel calls at a
+// time, and collects the actions that are not allowed. The client's adaptive
+// retryer backs off on throttling. A batch that fails is reported in Errors
+// rather than failing the others.
+func simulatePolicy(ctx context.Context, client iam.SimulatePrincipalPolicyAPIClient, principal string, batches []simulationBatch, parallel int) *SimulationReport {
+	report := &SimulationReport{Principal: principal, Denied: make(map[string][]string), Calls: len(batches)}
+	denied := make(map[string]bool) // every action simulated, true when any evaluation denied it
+	var mu sync.Mutex
+
+	sem := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+	for _, batch := range batches {
+		wg.Add(1)
+		go func(batch simulationBatch) {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			defer func() { <-sem }()
+
+			input := &iam.SimulatePrincipalPolicyInput{PolicySourceArn: aws.String(principal), ActionNames: batch.Actions, ResourceArns: batch.Resources}
+			paginator := iam.NewSimulatePrincipalPolicyPaginator(client, input)
+			for paginator.HasMorePages() {
+				page, err := paginator.NextPage(ctx)
+				mu.Lock()
+				if err != nil {
+					report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", strings.Join(batch.Actions, ", "), err))
+					mu.Unlock()
+					return
+				}
+				for _, result := range page.EvaluationResults {
+					action := aws.ToString(result.EvalActionName)
+					denied[action] = denied[action] || result.EvalDecision != iamtypes.PolicyEvaluationDecisionTypeAllowed
+				}
+				mu.Unlock()
+			}
+		}(batch)
+	}
+	wg.Wait()
+
+	for action, isDenied := range denied {
+		if !isDenied {
+			continue
+		}
+		service, _, _ := strings.Cut(action, ":")
+		report.Denied[service] = append(report.Denied[service], action)
+	}
+	for service := range report.Denied {
+		sort.Strings(report.Denied[service])
+	}
+	sort.Strings(report.Errors)
+	report.Actions = len(denied)
+	return report
+}
+
+// runSimulation simulates the generated policy's actions as --simulate-role
+// and prints the denied actions by service to stderr.
+func runSimulation(ctx context.Context, policy IAMPolicy) *SimulationReport {
+	cfg, err := loadAWSConfig(ctx)
+	if err != nil {
+		exitWithError(err)
+	}
+	batches := simulationBatches(policy, simulateBatchSizeFlag)
+	report := simulatePolicy(ctx, iam.NewFromConfig(cfg), simulateRoleFlag, batches, simulateParallelFlag)
+	printSimulation(report)
+	return report
+}
+
+// printSimulation writes the simulation outcome to stderr.
+func printSimulation(report *SimulationReport) {
+	fmt.Fprintf(os.Stderr, "\nSimulation as %s (%d actions in %d calls): %d denied\n",
+		report.Principal, report.Actions, report.Calls, report.deniedCount())
+	services := make([]string, 0, len(report.Denied))
+	for service := range report.Denied {
+		services = append(services, service)
+	}
+	sort.Strings(services)
+	for _, service := range services {
+		fmt.Fprintf(os.Stderr, "  %s (%d): %s\n", service, len(report.Denied[service]), strings.Join(report.Denied[service], ", "))
+	}
+	for _, message := range report.Errors {
+		fmt.Fprintf(os.Stderr, "  error: %s\n", message)
+	}
+}
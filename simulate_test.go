@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamtypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+)
+
+// fakeSimulator allows the actions in allowed, returns one result per page to
+// exercise pagination, and records how many calls were in flight at once.
+type fakeSimulator struct {
+	allowed  map[string]bool
+	fail     string // an action whose batches fail
+	mu       sync.Mutex
+	inFlight int
+	peak     int
+}
+
+func (f *fakeSimulator) SimulatePrincipalPolicy(ctx context.Context, params *iam.SimulatePrincipalPolicyInput, optFns ...func(*iam.Options)) (*iam.SimulatePrincipalPolicyOutput, error) {
+	f.mu.Lock()
+	f.inFlight++
+	f.peak = max(f.peak, f.inFlight)
+	f.mu.Unlock()
+	time.Sleep(5 * time.Millisecond)
+	defer func() {
+		f.mu.Lock()
+		f.inFlight--
+		f.mu.Unlock()
+	}()
+
+	if containsString(params.ActionNames, f.fail) {
+		return nil, errors.New("AccessDenied: not authorized to perform iam:SimulatePrincipalPolicy")
+	}
+	index := 0
+	if params.Marker != nil {
+		index = int(aws.ToString(params.Marker)[0] - '0')
+	}
+	action := params.ActionNames[index]
+	decision := iamtypes.PolicyEvaluationDecisionTypeImplicitDeny
+	if f.allowed[action] {
+		decision = iamtypes.PolicyEvaluationDecisionTypeAllowed
+	}
+	output := &iam.SimulatePrincipalPolicyOutput{
+		EvaluationResults: []iamtypes.EvaluationResult{{EvalActionName: aws.String(action), EvalDecision: decision}},
+	}
+	if index+1 < len(params.ActionNames) {
+		output.IsTruncated = true
+		output.Marker = aws.String(string(rune('0' + index + 1)))
+	}
+	return output, nil
+}
+
+func TestSimulationBatches(t *testing.T) {
+	if err := loadActionCatalog(); err != nil {
+		t.Fatalf("Error loading action catalog: %v", err)
+	}
+	policy := IAMPolicy{Statement: []IAMStatement{
+		{Effect: "Allow", Action: []string{"sqs:CreateQueue", "sqs:DeleteQueue", "sqs:GetQueueAttributes"}, Resource: "arn:aws:sqs:us-east-1:123456789012:orders"},
+		{Effect: "Allow", Action: []string{"s3:GetBucketPolicy*"}, Resource: []string{"arn:aws:s3:::logs", "arn:aws:s3:::*"}},
+		{Effect: "Deny", Action: "iam:*", Resource: "*"},
+	}}
+
+	batches := simulationBatches(policy, 2)
+	var got []string
+	for _, batch := range batches {
+		got = append(got, strings.Join(batch.Actions, "+")+" on "+strings.Join(batch.Resources, "+"))
+	}
+	want := []string{
+		"sqs:CreateQueue+sqs:DeleteQueue on arn:aws:sqs:us-east-1:123456789012:orders",
+		"sqs:GetQueueAttributes on arn:aws:sqs:us-east-1:123456789012:orders",
+		"s3:GetBucketPolicy+s3:GetBucketPolicyStatus on ",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("simulationBatches() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestSimulatePolicy(t *testing.T) {
+	client := &fakeSimulator{allowed: map[string]bool{"s3:GetObject": true, "sqs:CreateQueue": true}}
+	batches := []simulationBatch{
+		{Actions: []string{"s3:GetObject", "s3:PutObject"}},
+		{Actions: []string{"sqs:CreateQueue", "sqs:DeleteQueue"}},
+		{Actions: []string{"kms:Decrypt"}},
+		{Actions: []string{"s3:GetObject"}},
+	}
+	report := simulatePolicy(context.Background(), client, "arn:aws:iam::123456789012:role/deploy", batches, 2)
+
+	if report.Actions != 5 || report.Calls != 4 {
+		t.Errorf("Expected 5 actions in 4 calls, got %d in %d", report.Actions, report.Calls)
+	}
+	want := map[string]string{"s3": "s3:PutObject", "sqs": "sqs:DeleteQueue", "kms": "kms:Decrypt"}
+	if len(report.Denied) != len(want) {
+		t.Errorf("Denied = %v, want %v", report.Denied, want)
+	}
+	for service, action := range want {
+		if got := strings.Join(report.Denied[service], ","); got != action {
+			t.Errorf("Denied[%s] = %s, want %s", service, got, action)
+		}
+	}
+	if client.peak > 2 {
+		t.Errorf("Expected at most 2 calls in flight, got %d", client.peak)
+	}
+
+	client.fail = "kms:Decrypt"
+	report = simulatePolicy(context.Background(), client, "arn:aws:iam::123456789012:role/deploy", batches, 4)
+	if len(report.Errors) != 1 || !strings.HasPrefix(report.Errors[0], "kms:Decrypt: ") {
+		t.Errorf("Expected the failed batch in Errors, got %v", report.Errors)
+	}
+	if len(report.Denied["s3"]) != 1 {
+		t.Errorf("Expected the other batches to be simulated, got %v", report.Denied)
+	}
+}
+
+func TestValidateSimulateFlags(t *testing.T) {
+	defer func() {
+		simulateRoleFlag, simulateBatchSizeFlag, simulateParallelFlag = "", defaultSimulateBatchSize, defaultSimulateParallel
+	}()
+
+	simulateRoleFlag = "arn:aws:iam::123456789012:role/deploy"
+	if err := validateSimulateFlags(); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	simulateBatchSizeFlag = 0
+	if err := validateSimulateFlags(); err == nil {
+		t.Errorf("Expected an error for --simulate-batch-size 0")
+	}
+	simulateBatchSizeFlag, simulateRoleFlag = defaultSimulateBatchSize, "deploy"
+	if err := validateSimulateFlags(); err == nil {
+		t.Errorf("Expected an error for a role name instead of an ARN")
+	}
+}
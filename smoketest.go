@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/spf13/pflag"
+)
+
+var smokeTestFlag bool
+
+// exitSmokeTestDenied is returned by --smoke-test when the generated policy
+// denied at least one plan-phase read.
+const exitSmokeTestDenied = 15
+
+func init() {
+	for _, flags := range []*pflag.FlagSet{rootCmd.Flags(), scanCmd.Flags()} {
+		flags.BoolVar(&smokeTestFlag, "smoke-test", false, "Assume --assume-role-arn with the generated policy as session policy and make the plan-phase reads, to check that the policy allows them")
+	}
+}
+
+// resourceReadChecks maps managed resource types to the read Terraform makes
+// when refreshing them during plan. They share the call of the matching data
+// source, whose arguments have the same names. A resource that does not exist
+// yet still exercises the read: AWS authorizes it before looking it up.
+var resourceReadChecks = map[string]dataSourceCheck{
+	"aws_ecr_repository":        dataSourceChecks["aws_ecr_repository"],
+	"aws_iam_role":              dataSourceChecks["aws_iam_role"],
+	"aws_s3_bucket":             dataSourceChecks["aws_s3_bucket"],
+	"aws_secretsmanager_secret": dataSourceChecks["aws_secretsmanager_secret"],
+	"aws_security_group":        dataSourceChecks["aws_security_group"],
+	"aws_ssm_parameter":         dataSourceChecks["aws_ssm_parameter"],
+	"aws_subnet":                dataSourceChecks["aws_subnet"],
+	"aws_vpc":                   dataSourceChecks["aws_vpc"],
+}
+
+// validateSmokeTestFlags checks the flags --smoke-test depends on.
+func validateSmokeTestFlags() error {
+	if !smokeTestFlag {
+		return nil
+	}
+	if awsFlags.AssumeRoleARN == "" {
+		return fmt.Errorf("--smoke-test needs --assume-role-arn: session policies only apply to assumed roles")
+	}
+	if templateVarsFlag != "" {
+		return fmt.Errorf("--smoke-test cannot be used with --template-vars: the placeholders are not valid in a session policy")
+	}
+	return nil
+}
+
+// smokeTestPolicy returns the JSON session policy used for the smoke test.
+// A policy over the session policy size limit is compressed into it, which
+// only widens it, so the test can then miss a missing permission but never
+// reports a read as denied that the policy allows. compressed reports
+// whether that happened.
+func smokeTestPolicy(policy IAMPolicy) (document string, compressed bool, err error) {
+	if policySize(policy) > sessionPolicySizeLimit {
+		policy, _ = compressPolicy(policy, sessionPolicySizeLimit)
+		compressed = true
+	}
+	data, err := json.Marshal(policy)
+	if err != nil {
+		return "", false, err
+	}
+	return string(data), compressed, nil
+}
+
+// smokeTestReads makes the plan-phase reads of result: the read of every
+// data source as in --verify-data-sources, the refresh read of every
+// resource in resourceReadChecks, and the state read of an S3 backend when
+// its permissions are included. Resources without a known read call are
+// left out.
+func smokeTestReads(ctx context.Context, clients *awsClients, result *ParseResult, includeBackend bool) []DataSourceVerification {
+	verifications := verifyDataSources(ctx, clients, result)
+
+	var resources []DataSourceVerification
+	for _, resource := range result.Resources {
+		check, ok := resourceReadChecks[resource.Type]
+		if !ok || resource.Provider != "aws" {
+			continue
+		}
+		verification := DataSourceVerification{Address: resourceAddress(resource), Action: check.Action}
+		verification.Status, verification.Message = classifyVerifyError(check.Call(ctx, clients, resource))
+		resources = append(resources, verification)
+	}
+	sort.SliceStable(resources, func(i, j int) bool {
+		return resources[i].Address < resources[j].Address
+	})
+	verifications = append(verifications, resources...)
+
+	backends := foundBackends(result)
+	for _, backend := range backends {
+		if !includeBackend || backend.Type != "s3" {
+			continue
+		}
+		verification := DataSourceVerification{Address: "backend.s3", Action: "s3:GetObject"}
+		if len(backends) > 1 {
+			verification.Address = "backend." + describeBackend(backend)
+		}
+		bucket, key := backend.Config["bucket"], backend.Config["key"]
+		if bucket == "" || key == "" {
+			verification.Status, verification.Message = VerifySkipped, "bucket or key not set in the backend block"
+		} else {
+			_, err := clients.s3.HeadObject(ctx, &s3.HeadObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+			verification.Status, verification.Message = classifyVerifyError(err)
+		}
+		verifications = append(verifications, verification)
+	}
+	return verifications
+}
+
+// runSmokeTest assumes --assume-role-arn limited by the generated policy and
+// makes the plan-phase reads of result with it, printing the outcome to
+// stderr. The session's permissions are the intersection of the role's and
+// the policy's, so the role must allow at least the reads. It returns
+// whether any read was denied.
+func runSmokeTest(ctx context.Context, policy IAMPolicy, result *ParseResult) bool {
+	document, compressed, err := smokeTestPolicy(policy)
+	if err != nil {
+		exitWithError(err)
+	}
+
+	options := awsFlags
+	options.SessionPolicy = document
+	cfg, err := loadAWSConfigWith(ctx, options)
+	if err != nil {
+		exitWithError(err)
+	}
+	if _, err := cfg.Credentials.Retrieve(ctx); err != nil {
+		exitWithError(fmt.Errorf("--smoke-test could not assume %s with the generated policy: %w", options.AssumeRoleARN, err))
+	}
+
+	verifications := smokeTestReads(ctx, newAWSClients(cfg), result, includeStateBackendFlag)
+
+	fmt.Fprintln(os.Stderr)
+	if compressed {
+		fmt.Fprintf(os.Stderr, "Note: the policy was compressed into the %d character session policy limit for the smoke test, which widens it\n", sessionPolicySizeLimit)
+	}
+	header := fmt.Sprintf("Smoke test as %s under the generated policy (%d reads, %d AWS API calls)", options.AssumeRoleARN, len(verifications), awsCallBudget.used.Load())
+	return printVerifications(header, verifications)
+}
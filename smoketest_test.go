@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// recordingHTTPClient answers every request with a body-less status and
+// records the requested URLs.
+type recordingHTTPClient struct {
+	stubHTTPClient
+	urls []string
+}
+
+func (c *recordingHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	c.urls = append(c.urls, req.URL.String())
+	return c.stubHTTPClient.Do(req)
+}
+
+func TestSmokeTestReads(t *testing.T) {
+	stub := &recordingHTTPClient{stubHTTPClient: stubHTTPClient{status: http.StatusForbidden}}
+	clients := newAWSClients(aws.Config{
+		Region:      "us-east-1",
+		Credentials: credentials.NewStaticCredentialsProvider("AKIAEXAMPLE", "secret", ""),
+		HTTPClient:  stub,
+		Retryer:     func() aws.Retryer { return aws.NopRetryer{} },
+	})
+
+	result := &ParseResult{
+		Resources: []Resource{
+			{Type: "aws_s3_bucket", Name: "logs", Provider: "aws", Attributes: map[string]cty.Value{"bucket": cty.StringVal("example-logs")}},
+			{Type: "aws_iam_role", Name: "app", Provider: "aws", Attributes: map[string]cty.Value{"name": cty.UnknownVal(cty.String)}},
+			{Type: "aws_kms_key", Name: "main", Provider: "aws", Attributes: map[string]cty.Value{}},
+		},
+		DataSources: []Resource{
+			{Kind: KindData, Type: "aws_region", Name: "current", Provider: "aws", Attributes: map[string]cty.Value{}},
+		},
+		Backend: &BackendConfig{Type: "s3", Config: map[string]string{"bucket": "example-state", "key": "app/terraform.tfstate"}},
+	}
+
+	verifications := smokeTestReads(context.Background(), clients, result, true)
+	got := make(map[string]string)
+	for _, v := range verifications {
+		got[v.Address] = v.Status
+	}
+	want := map[string]string{
+		"data.aws_region.current": VerifyLocal,
+		"aws_iam_role.app":        VerifySkipped,
+		"aws_s3_bucket.logs":      VerifyDenied,
+		"backend.s3":              VerifyDenied,
+	}
+	if len(got) != len(want) {
+		t.Errorf("Expected %d reads, got %v", len(want), got)
+	}
+	for address, status := range want {
+		if got[address] != status {
+			t.Errorf("%s: expected %s, got %q", address, status, got[address])
+		}
+	}
+	if len(stub.urls) != 2 || !strings.Contains(stub.urls[1], "app/terraform.tfstate") {
+		t.Errorf("Expected the bucket and state reads, got %v", stub.urls)
+	}
+
+	if verifications := smokeTestReads(context.Background(), clients, result, false); len(verifications) != 3 {
+		t.Errorf("Expected the backend read to be left out without its permissions, got %d reads", len(verifications))
+	}
+}
+
+func TestSmokeTestPolicy(t *testing.T) {
+	small := IAMPolicy{Version: "2012-10-17", Statement: []IAMStatement{{Effect: "Allow", Action: []string{"ec2:DescribeVpcs"}, Resource: "*"}}}
+	document, compressed, err := smokeTestPolicy(small)
+	if err != nil || compressed {
+		t.Fatalf("Unexpected compression or error: %v", err)
+	}
+	var decoded IAMPolicy
+	if err := json.Unmarshal([]byte(document), &decoded); err != nil || len(decoded.Statement) != 1 {
+		t.Errorf("Session policy is not the policy: %s (%v)", document, err)
+	}
+
+	var actions []string
+	for _, service := range []string{"ec2", "iam", "s3", "rds", "lambda", "logs"} {
+		for _, verb := range []string{"Describe", "Get", "List", "Create", "Delete", "Update", "Put", "Tag", "Untag"} {
+			for _, noun := range []string{"Widget", "Gadget", "Gizmo", "Doohickey", "Thingamajig"} {
+				actions = append(actions, service+":"+verb+noun)
+			}
+		}
+	}
+	large := IAMPolicy{Version: "2012-10-17", Statement: []IAMStatement{{Effect: "Allow", Action: actions, Resource: "*"}}}
+	document, compressed, err = smokeTestPolicy(large)
+	if err != nil || !compressed {
+		t.Fatalf("Expected the policy to be compressed: %v", err)
+	}
+	if len(document) > sessionPolicySizeLimit {
+		t.Errorf("Session policy of %d characters is over the limit", len(document))
+	}
+}
+
+func TestValidateSmokeTestFlags(t *testing.T) {
+	defer func(enabled bool, options awsOptions, templateVars string) {
+		smokeTestFlag, awsFlags, templateVarsFlag = enabled, options, templateVars
+	}(smokeTestFlag, awsFlags, templateVarsFlag)
+
+	smokeTestFlag, awsFlags, templateVarsFlag = true, awsOptions{}, ""
+	if err := validateSmokeTestFlags(); err == nil {
+		t.Error("Expected an error without --assume-role-arn")
+	}
+	awsFlags.AssumeRoleARN = "arn:aws:iam::123456789012:role/pipeline"
+	if err := validateSmokeTestFlags(); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	templateVarsFlag = "terraform"
+	if err := validateSmokeTestFlags(); err == nil {
+		t.Error("Expected an error with --template-vars")
+	}
+
+	if err := validateAWSFlags(awsOptions{SessionPolicy: "{}"}); err == nil {
+		t.Error("Expected an error for a session policy without a role")
+	}
+}
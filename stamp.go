@@ -0,0 +1,163 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var (
+	stampFlag bool
+
+	// runInputDigest is the input digest of the policy being generated with
+	// --stamp, recorded in the report, scan metadata and provenance.
+	runInputDigest string
+)
+
+// stampVersion is the first line of the manifest an input digest hashes;
+// it changes whenever the manifest does.
+const stampVersion = "tf-iam-scanner input v1"
+
+// stampNeutralFlags do not change the generated policy: where and how it is
+// written, what is checked after it is generated, and how the run talks to
+// AWS. They are left out of the input digest so that reproducing a stamp
+// needs only the options that matter.
+var stampNeutralFlags = map[string]bool{
+	"assume-role-arn":     true,
+	"attest":              true,
+	"config":              true,
+	"config-sha256":       true,
+	"config-url":          true,
+	"export-scan":         true,
+	"external-id":         true,
+	"fail-on":             true,
+	"force":               true,
+	"max-api-calls":       true,
+	"mode":                true,
+	"no-progress":         true,
+	"output":              true,
+	"output-template":     true,
+	"permissions-sha256":  true,
+	"profile":             true,
+	"quiet":               true,
+	"report":              true,
+	"service-weights":     true,
+	"sign":                true,
+	"simulate-batch-size": true,
+	"simulate-parallel":   true,
+	"simulate-role":       true,
+	"profile-out":         true,
+	"smoke-test":          true,
+	"stamp":               true,
+	"strict":              true,
+	"timeout":             true,
+	"timing":              true,
+	"verify-data-sources": true,
+}
+
+// stampInputs returns the files a scan of source read, keyed by the path
+// recorded in the manifest: the configuration and .tfbackend files below each
+// scanned directory and the local modules it calls, or the scanned file itself (a
+// plan or an exported scan), and the --merge and --provider-schema files. Paths are relative to the working directory
+// when they are inside it, so a checkout anywhere on disk gives the same
+// digest.
+func stampInputs(result *ParseResult, source string) map[string]string {
+	inputs := make(map[string]string)
+	seen := make(map[string]bool)
+	add := func(root string) {
+		if seen[realPath(root)] {
+			return
+		}
+		seen[realPath(root)] = true
+		walkTerraformDir(root, followSymlinksFlag, func(path string, info os.FileInfo) {
+			name := info.Name()
+			terraform := isConfigFile(name) && !inTerraformDataDir(path)
+			if path != root && !terraform && !strings.HasSuffix(name, backendConfigSuffix) {
+				return
+			}
+			inputs[stampPath(path)] = path
+		}, func(string) {})
+	}
+	for _, input := range strings.Split(source, ", ") {
+		add(input)
+	}
+	for _, call := range result.ModuleCalls {
+		if isLocalModuleSource(call.Source) {
+			add(filepath.Join(call.Dir, call.Source))
+		}
+	}
+	// The baseline and provider schema shape the policy as much as the code
+	for _, file := range []string{mergeFlag, providerSchemaFlag} {
+		if file != "" {
+			inputs[stampPath(file)] = file
+		}
+	}
+	return inputs
+}
+
+// stampPath is the manifest path of a scanned file.
+func stampPath(path string) string {
+	if wd, err := os.Getwd(); err == nil {
+		if abs, err := filepath.Abs(path); err == nil {
+			if rel, err := filepath.Rel(wd, abs); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				return filepath.ToSlash(rel)
+			}
+		}
+	}
+	return filepath.ToSlash(path)
+}
+
+// inputDigest is the --stamp digest of a scan: the SHA-256 of a manifest
+// listing the content digest of every scanned file, the permissions DB
+// version and the content of each mapping layer file, and the options that
+// shape the policy. Anyone can recompute it from a checkout of the same
+// commit with the same options.
+func inputDigest(result *ParseResult, source string, options map[string]string) (string, error) {
+	lines := []string{stampVersion}
+
+	var files []string
+	for path, file := range stampInputs(result, source) {
+		digest, err := sha256File(file)
+		if err != nil {
+			return "", fmt.Errorf("error hashing %s: %w", file, err)
+		}
+		files = append(files, fmt.Sprintf("file %s %s", path, digest))
+	}
+	sort.Strings(files)
+	lines = append(lines, files...)
+
+	lines = append(lines, "permissions-db "+valueOrUnknown(permissionsDBMeta.Version))
+	for _, layer := range permissionLayers {
+		for _, file := range layer.Files {
+			digest, err := sha256File(file)
+			if err != nil {
+				return "", fmt.Errorf("error hashing %s: %w", file, err)
+			}
+			lines = append(lines, fmt.Sprintf("mapping %s/%s %s", layer.Layer, filepath.Base(file), digest))
+		}
+	}
+
+	var names []string
+	for name := range options {
+		if !stampNeutralFlags[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		lines = append(lines, fmt.Sprintf("option %s=%s", name, options[name]))
+	}
+
+	sum := sha256.Sum256([]byte(strings.Join(lines, "\n") + "\n"))
+	return "sha256:" + hex.EncodeToString(sum[:]), nil
+}
+
+// stampPolicyID is the policy Id element carrying an input digest. IAM
+// accepts any string there and keeps it with the policy document.
+func stampPolicyID(digest string) string {
+	return "tf-iam-scanner-" + strings.Replace(digest, ":", "-", 1)
+}
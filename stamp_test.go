@@ -0,0 +1,125 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeStampCheckout writes a root module calling a local module outside
+// its directory, as a checkout would have it.
+func writeStampCheckout(t *testing.T, bucket string) string {
+	t.Helper()
+	dir := t.TempDir()
+	files := map[string]string{
+		"stack/main.tf":           `module "queue" { source = "../modules/queue" }` + "\n" + `resource "aws_s3_bucket" "this" { bucket = "` + bucket + `" }`,
+		"stack/prod.tfbackend":    `bucket = "state"`,
+		"stack/README.md":         "not an input",
+		"modules/queue/main.tf":   `resource "aws_sqs_queue" "this" {}`,
+		"modules/queue/README.md": "not an input",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// stampCheckout returns the input digest of a scan of stack in checkout,
+// run from the checkout's root like CI would.
+func stampCheckout(t *testing.T, checkout string, options map[string]string) string {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(checkout); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	result, err := parseTerraformFiles("stack")
+	if err != nil {
+		t.Fatalf("parseTerraformFiles: %v", err)
+	}
+	digest, err := inputDigest(result, "stack", options)
+	if err != nil {
+		t.Fatalf("inputDigest: %v", err)
+	}
+	return digest
+}
+
+func TestInputDigest(t *testing.T) {
+	if err := loadPermissionsDB(); err != nil {
+		t.Fatalf("Error loading permissions DB: %v", err)
+	}
+	options := map[string]string{"path": "stack", "least-privilege": "true"}
+
+	digest := stampCheckout(t, writeStampCheckout(t, "data"), options)
+	if !strings.HasPrefix(digest, "sha256:") || len(digest) != len("sha256:")+64 {
+		t.Fatalf("Unexpected digest %q", digest)
+	}
+
+	// Another checkout of the same code, written elsewhere, matches
+	if other := stampCheckout(t, writeStampCheckout(t, "data"), options); other != digest {
+		t.Errorf("Expected checkouts of the same code to have the same digest, got %s and %s", digest, other)
+	}
+
+	// Output flags do not change the digest; options and code do
+	withOutput := map[string]string{"path": "stack", "least-privilege": "true", "output": "policy.json", "force": "true", "report": "report.json"}
+	if got := stampCheckout(t, writeStampCheckout(t, "data"), withOutput); got != digest {
+		t.Errorf("Expected output flags to leave the digest unchanged, got %s", got)
+	}
+	if got := stampCheckout(t, writeStampCheckout(t, "data"), map[string]string{"path": "stack"}); got == digest {
+		t.Errorf("Expected --least-privilege to change the digest")
+	}
+	if got := stampCheckout(t, writeStampCheckout(t, "logs"), options); got == digest {
+		t.Errorf("Expected a code change to change the digest")
+	}
+}
+
+func TestStampInputs(t *testing.T) {
+	checkout := writeStampCheckout(t, "data")
+	result, err := parseTerraformFiles(filepath.Join(checkout, "stack"))
+	if err != nil {
+		t.Fatalf("parseTerraformFiles: %v", err)
+	}
+	var names []string
+	for _, file := range stampInputs(result, filepath.Join(checkout, "stack")) {
+		rel, _ := filepath.Rel(checkout, file)
+		names = append(names, filepath.ToSlash(rel))
+	}
+	for _, want := range []string{"stack/main.tf", "stack/prod.tfbackend", "modules/queue/main.tf"} {
+		if !containsString(names, want) {
+			t.Errorf("Expected %s among the inputs, got %v", want, names)
+		}
+	}
+	if len(names) != 3 {
+		t.Errorf("Expected only Terraform files, got %v", names)
+	}
+}
+
+func TestStampedPolicyID(t *testing.T) {
+	policy := IAMPolicy{Version: "2012-10-17", Id: stampPolicyID("sha256:" + strings.Repeat("0", 64))}
+	policy.Statement = []IAMStatement{{Effect: "Allow", Action: []string{"s3:GetObject"}, Resource: "*"}}
+
+	formatted, err := formatPolicy(policy, &ParseResult{}, FormatJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(formatted, `"Id": "tf-iam-scanner-sha256-0000`) {
+		t.Errorf("Expected the Id in the JSON policy:\n%s", formatted)
+	}
+	if errs := policyGrammarErrors(policy, "aws"); len(errs) > 0 {
+		t.Errorf("Stamped policy is not valid grammar: %v", errs)
+	}
+	if !strings.Contains(terraformPolicyDocument(policy, nil), `policy_id = "tf-iam-scanner-sha256-0000`) {
+		t.Errorf("Expected policy_id in the Terraform document")
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Risk score weights. The score is a rough signal for reviewers, not a
+// security assessment: it grows with the parts of a policy that usually
+// deserve a second look.
+const (
+	riskWeightWildcardAction        = 10 // e.g. s3:* or ec2:Describe*
+	riskWeightWildcardResource      = 5  // an Allow statement with Resource "*"
+	riskWeightPermissionsMgmtAction = 3  // e.g. iam:PutRolePolicy, s3:PutBucketPolicy
+
+	riskMediumThreshold = 20
+	riskHighThreshold   = 50
+)
+
+// PolicyStats summarizes a generated policy for the run summary and the
+// --report JSON.
+type PolicyStats struct {
+	ActionsPerService          map[string]int `json:"actions_per_service"`
+	WildcardActions            int            `json:"wildcard_actions"`
+	WildcardResourceStatements int            `json:"wildcard_resource_statements"`
+	PermissionsManagement      int            `json:"permissions_management_actions"`
+	RiskScore                  int            `json:"risk_score"`
+	RiskLevel                  string         `json:"risk_level"`
+}
+
+// computePolicyStats counts the Allow actions of policy per service, its
+// wildcard actions, its statements granting Resource "*" and its permissions
+// management actions (per the action catalog), and derives the risk score.
+func computePolicyStats(policy IAMPolicy) PolicyStats {
+	if actionCatalog == nil {
+		// The catalog is embedded; without it the score skips access levels
+		_ = loadActionCatalog()
+	}
+
+	stats := PolicyStats{ActionsPerService: make(map[string]int)}
+
+	services, _ := servicesFromPolicy(policy)
+	for _, service := range services {
+		stats.ActionsPerService[service.Name] = len(service.Actions)
+		for _, action := range service.Actions {
+			if strings.Contains(action, "*") {
+				stats.WildcardActions++
+				continue
+			}
+			if _, info, ok := lookupAction(action); ok && info.Access == AccessPermissionsManagement {
+				stats.PermissionsManagement++
+			}
+		}
+	}
+
+	stats.WildcardResourceStatements = wildcardResourceStatements(policy)
+
+	stats.RiskScore = stats.WildcardActions*riskWeightWildcardAction +
+		stats.WildcardResourceStatements*riskWeightWildcardResource +
+		stats.PermissionsManagement*riskWeightPermissionsMgmtAction
+	switch {
+	case stats.RiskScore >= riskHighThreshold:
+		stats.RiskLevel = "high"
+	case stats.RiskScore >= riskMediumThreshold:
+		stats.RiskLevel = "medium"
+	default:
+		stats.RiskLevel = "low"
+	}
+	return stats
+}
+
+// printPolicyStats writes the statistics part of the run summary to stderr.
+func printPolicyStats(stats PolicyStats) {
+	services := make([]string, 0, len(stats.ActionsPerService))
+	for service := range stats.ActionsPerService {
+		services = append(services, service)
+	}
+	sort.Strings(services)
+
+	counts := make([]string, 0, len(services))
+	for _, service := range services {
+		counts = append(counts, fmt.Sprintf("%s (%d)", service, stats.ActionsPerService[service]))
+	}
+
+	fmt.Fprintf(os.Stderr, "  Services: %d", len(services))
+	if len(counts) > 0 {
+		fmt.Fprintf(os.Stderr, ": %s", strings.Join(counts, ", "))
+	}
+	fmt.Fprintf(os.Stderr, "\n")
+	fmt.Fprintf(os.Stderr, "  Wildcard actions: %d\n", stats.WildcardActions)
+	fmt.Fprintf(os.Stderr, "  Statements with Resource \"*\": %d\n", stats.WildcardResourceStatements)
+	fmt.Fprintf(os.Stderr, "  Permissions management actions: %d\n", stats.PermissionsManagement)
+	fmt.Fprintf(os.Stderr, "  Risk score: %d (%s)\n", stats.RiskScore, stats.RiskLevel)
+}
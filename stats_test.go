@@ -0,0 +1,66 @@
+package main
+
+import "testing"
+
+func TestComputePolicyStats(t *testing.T) {
+	policy := IAMPolicy{
+		Version: "2012-10-17",
+		Statement: []IAMStatement{
+			{
+				Effect:   "Allow",
+				Action:   []string{"s3:CreateBucket", "s3:PutBucketPolicy", "s3:Get*"},
+				Resource: "*",
+			},
+			{
+				Effect:   "Allow",
+				Action:   []string{"sqs:CreateQueue"},
+				Resource: []string{"arn:aws:sqs:us-east-1:123456789012:jobs"},
+			},
+			{
+				Effect:   "Deny",
+				Action:   []string{"iam:*"},
+				Resource: "*",
+			},
+		},
+	}
+
+	stats := computePolicyStats(policy)
+
+	if stats.ActionsPerService["s3"] != 3 || stats.ActionsPerService["sqs"] != 1 {
+		t.Errorf("ActionsPerService = %v, want s3:3 sqs:1", stats.ActionsPerService)
+	}
+	if _, ok := stats.ActionsPerService["iam"]; ok {
+		t.Error("Deny statements should not be counted")
+	}
+	if stats.WildcardActions != 1 {
+		t.Errorf("WildcardActions = %d, want 1", stats.WildcardActions)
+	}
+	if stats.WildcardResourceStatements != 1 {
+		t.Errorf("WildcardResourceStatements = %d, want 1", stats.WildcardResourceStatements)
+	}
+	if stats.PermissionsManagement != 1 {
+		t.Errorf("PermissionsManagement = %d, want 1 (s3:PutBucketPolicy)", stats.PermissionsManagement)
+	}
+
+	wantScore := riskWeightWildcardAction + riskWeightWildcardResource + riskWeightPermissionsMgmtAction
+	if stats.RiskScore != wantScore || stats.RiskLevel != "low" {
+		t.Errorf("Risk = %d (%s), want %d (low)", stats.RiskScore, stats.RiskLevel, wantScore)
+	}
+}
+
+func TestRiskLevels(t *testing.T) {
+	wildcards := func(n int) IAMPolicy {
+		actions := make([]string, n)
+		for i := range actions {
+			actions[i] = "s3:Get" + string(rune('A'+i)) + "*"
+		}
+		return IAMPolicy{Statement: []IAMStatement{{Effect: "Allow", Action: actions, Resource: []string{"arn:aws:s3:::b"}}}}
+	}
+
+	if level := computePolicyStats(wildcards(2)).RiskLevel; level != "medium" {
+		t.Errorf("Two wildcard actions: level %s, want medium", level)
+	}
+	if level := computePolicyStats(wildcards(5)).RiskLevel; level != "high" {
+		t.Errorf("Five wildcard actions: level %s, want high", level)
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+// defaultMaxFileSize is the size above which .tf and state files are skipped
+// unless --max-file-size says otherwise.
+const defaultMaxFileSize = 10 << 20
+
+// maxFileSizeFlag is --max-file-size as given; maxFileSize is its value in
+// bytes, 0 for no limit.
+var (
+	maxFileSizeFlag string
+	maxFileSize     int64 = defaultMaxFileSize
+)
+
+// parseWorkers is the number of files parsed at once.
+var parseWorkers = runtime.GOMAXPROCS(0)
+
+var byteSizeUnits = []struct {
+	suffix string
+	size   int64
+}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}}
+
+// parseByteSize parses a size such as 512KB, 10MB or 1GB (binary units) or a
+// plain number of bytes. 0 means no limit.
+func parseByteSize(value string) (int64, error) {
+	text := strings.ToUpper(strings.TrimSpace(value))
+	unit := int64(1)
+	for _, u := range byteSizeUnits {
+		if strings.HasSuffix(text, u.suffix) {
+			text, unit = strings.TrimSpace(strings.TrimSuffix(text, u.suffix)), u.size
+			break
+		}
+	}
+	n, err := strconv.ParseInt(text, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid --max-file-size %q: expected a size such as 512KB, 10MB or 1GB, or 0 for no limit", value)
+	}
+	return n * unit, nil
+}
+
+// formatByteSize formats n bytes in the largest unit it has at least one of.
+func formatByteSize(n int64) string {
+	for _, u := range byteSizeUnits {
+		if n >= u.size && u.size > 1 {
+			return strconv.FormatFloat(float64(n)/float64(u.size), 'f', 1, 64) + u.suffix
+		}
+	}
+	return strconv.FormatInt(n, 10) + "B"
+}
+
+// oversizedFileWarning returns the warning for a file larger than
+// maxFileSize, or "" when it is not.
+func oversizedFileWarning(path string, info os.FileInfo) string {
+	if maxFileSize == 0 || info.Size() <= maxFileSize {
+		return ""
+	}
+	return fmt.Sprintf("Skipped %s: %s is larger than --max-file-size %s", path, formatByteSize(info.Size()), formatByteSize(maxFileSize))
+}
+
+// parsedFile is the result of parsing one file of a directory.
+type parsedFile struct {
+	path   string
+	result *ParseResult
+	err    error
+}
+
+// streamTerraformFiles parses paths on parseWorkers goroutines, compacts each
+// result (see compactParseResult) and hands it to aggregate in the order of
+// paths. Only about parseWorkers files are read or waiting for aggregate at
+// any time, but aggregate keeps every result until the policy is built, with
+// all the attributes of AWS resources. Once ctx is cancelled no further file
+// is read.
+func streamTerraformFiles(ctx context.Context, paths []string, aggregate func(parsedFile)) {
+	pending := make(chan chan parsedFile, parseWorkers)
+	go func() {
+		defer close(pending)
+		for _, path := range paths {
+			if ctx.Err() != nil {
+				return
+			}
+			done := make(chan parsedFile, 1)
+			select {
+			case pending <- done:
+			case <-ctx.Done():
+				return
+			}
+			go func(path string) {
+				result, err := parseTerraformFile(path)
+				if err == nil {
+					compactParseResult(result)
+				}
+				done <- parsedFile{path, result, err}
+			}(path)
+		}
+	}()
+	for done := range pending {
+		aggregate(<-done)
+	}
+}
+
+// attributeReaderTypes are the types outside the AWS provider whose
+// attributes are read after parsing; see detectWorkloads.
+var attributeReaderTypes = map[string]bool{
+	"helm_release":                  true,
+	"kubernetes_service_account":    true,
+	"kubernetes_service_account_v1": true,
+}
+
+// retainsAttributes reports whether the attribute values of resources of
+// resourceType are kept after parsing.
+func retainsAttributes(resourceType string) bool {
+	if strings.HasPrefix(resourceType, "aws_") || attributeReaderTypes[resourceType] {
+		return true
+	}
+	_, ok := permissionsDB[resourceType]
+	return ok
+}
+
+// compactParseResult drops the attribute values nothing reads from the
+// resources and data sources of types other providers manage, which in large
+// repositories hold most of the parsed values: only their literal strings
+// are kept, for the credential checks of recordSecurityFindings. Their
+// nested block types and references are kept too.
+func compactParseResult(result *ParseResult) {
+	for _, resources := range [][]Resource{result.Resources, result.DataSources} {
+		for i := range resources {
+			if retainsAttributes(resources[i].Type) {
+				continue
+			}
+			kept := make(map[string]cty.Value)
+			for name, value := range resources[i].Attributes {
+				if isLiteralString(value) {
+					kept[name] = value
+				}
+			}
+			resources[i].Attributes = kept
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+var (
+	scopeByTagFlag []string
+	tagScopes      []tagScope // parsed from scopeByTagFlag by validateOutputFlags
+)
+
+// tagScope is one --scope-by-tag Key=Value pair.
+type tagScope struct {
+	Key   string
+	Value string
+}
+
+// tagAuthorizedServices are the services whose actions can be authorized by
+// the aws:ResourceTag and aws:RequestTag condition keys (ABAC). IAM is left
+// out on purpose: role and user tags are commonly writable by the same
+// principals the condition is meant to restrict.
+var tagAuthorizedServices = map[string]bool{
+	"acm": true, "apigateway": true, "athena": true, "autoscaling": true,
+	"backup": true, "batch": true, "cloudformation": true, "cloudwatch": true,
+	"codebuild": true, "codepipeline": true, "cognito-idp": true, "dynamodb": true,
+	"ec2": true, "ecr": true, "ecs": true, "eks": true, "elasticache": true,
+	"elasticfilesystem": true, "elasticloadbalancing": true, "es": true,
+	"events": true, "firehose": true, "glue": true, "kinesis": true, "kms": true,
+	"lambda": true, "logs": true, "rds": true, "sagemaker": true,
+	"secretsmanager": true, "sns": true, "sqs": true, "ssm": true, "states": true,
+}
+
+// tagCreateVerbs prefix the actions that create resources. A resource being
+// created has no tags yet, so these are authorized by the tags in the request.
+var tagCreateVerbs = []string{"Create", "Run", "Allocate", "Import", "Register", "Request"}
+
+// parseTagScopes parses the --scope-by-tag values, each Key=Value.
+func parseTagScopes(values []string) ([]tagScope, error) {
+	var scopes []tagScope
+	seen := make(map[string]bool)
+	for _, value := range values {
+		key, tagValue, ok := strings.Cut(value, "=")
+		if !ok || key == "" || tagValue == "" {
+			return nil, fmt.Errorf("invalid --scope-by-tag %q: expected Key=Value, e.g. Team=platform", value)
+		}
+		if seen[key] {
+			return nil, fmt.Errorf("invalid --scope-by-tag %q: tag %s is given more than once", value, key)
+		}
+		seen[key] = true
+		scopes = append(scopes, tagScope{Key: key, Value: tagValue})
+	}
+	return scopes, nil
+}
+
+// scopePolicyByTags moves the actions of tag-authorized services out of each
+// unconditional Allow statement into statements on Resource "*" that require
+// the given tags: aws:RequestTag for actions creating resources and
+// aws:ResourceTag for actions on existing ones. Create actions are granted
+// in both, since some of them add to an existing, tagged parent resource
+// (e.g. ec2:CreateRoute on a route table). List actions, actions without
+// resource-level permissions and wildcards stay in the original statement.
+func scopePolicyByTags(policy IAMPolicy, scopes []tagScope) IAMPolicy {
+	if len(scopes) == 0 {
+		return policy
+	}
+	if actionCatalog == nil {
+		_ = loadActionCatalog()
+	}
+
+	requestTags := make(map[string]interface{})
+	resourceTags := make(map[string]interface{})
+	for _, scope := range scopes {
+		requestTags["aws:RequestTag/"+scope.Key] = scope.Value
+		resourceTags["aws:ResourceTag/"+scope.Key] = scope.Value
+	}
+
+	scoped := IAMPolicy{Version: policy.Version}
+	for _, statement := range policy.Statement {
+		if statement.Effect != "Allow" || len(statement.Condition) > 0 || statement.Action == nil {
+			scoped.Statement = append(scoped.Statement, statement)
+			continue
+		}
+
+		var kept, onCreate, onResource []string
+		for _, action := range toStringSlice(statement.Action) {
+			switch {
+			case !tagAuthorizable(action):
+				kept = append(kept, action)
+			case isCreateAction(action):
+				onCreate = append(onCreate, action)
+				onResource = append(onResource, action)
+			default:
+				onResource = append(onResource, action)
+			}
+		}
+
+		if len(kept) > 0 {
+			statement.Action = kept
+			scoped.Statement = append(scoped.Statement, statement)
+		}
+		if len(onCreate) > 0 {
+			scoped.Statement = append(scoped.Statement, IAMStatement{
+				Effect:    "Allow",
+				Action:    onCreate,
+				Resource:  "*",
+				Condition: map[string]map[string]interface{}{"StringEquals": requestTags},
+			})
+		}
+		if len(onResource) > 0 {
+			scoped.Statement = append(scoped.Statement, IAMStatement{
+				Effect:    "Allow",
+				Action:    onResource,
+				Resource:  "*",
+				Condition: map[string]map[string]interface{}{"StringEquals": resourceTags},
+			})
+		}
+	}
+	return scoped
+}
+
+// tagAuthorizable reports whether action can be scoped by resource tags: its
+// service supports tag-based authorization and it acts on a resource. List
+// actions, wildcard-only actions and actions missing from the catalog are
+// not, so scoping never removes access to them.
+func tagAuthorizable(action string) bool {
+	service, _, ok := strings.Cut(action, ":")
+	if !ok || strings.ContainsAny(action, "*?") || !tagAuthorizedServices[strings.ToLower(service)] {
+		return false
+	}
+	_, info, found := lookupAction(action)
+	return found && !info.WildcardOnly && info.Access != AccessList
+}
+
+func isCreateAction(action string) bool {
+	_, name, _ := strings.Cut(action, ":")
+	for _, verb := range tagCreateVerbs {
+		if strings.HasPrefix(name, verb) {
+			return true
+		}
+	}
+	return false
+}
+
+// describeTagScopes formats scopes for the run summary, e.g. "Team=platform".
+func describeTagScopes(scopes []tagScope) string {
+	pairs := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		pairs = append(pairs, scope.Key+"="+scope.Value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ", ")
+}
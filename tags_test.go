@@ -0,0 +1,96 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseTagScopes(t *testing.T) {
+	scopes, err := parseTagScopes([]string{"Team=platform", "Env=prod=blue"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(scopes) != 2 || scopes[1].Key != "Env" || scopes[1].Value != "prod=blue" {
+		t.Errorf("Unexpected scopes: %+v", scopes)
+	}
+	if describeTagScopes(scopes) != "Env=prod=blue, Team=platform" {
+		t.Errorf("Unexpected description: %s", describeTagScopes(scopes))
+	}
+
+	for _, value := range []string{"Team", "=platform", "Team=", ""} {
+		if _, err := parseTagScopes([]string{value}); err == nil {
+			t.Errorf("Expected an error for %q", value)
+		}
+	}
+	if _, err := parseTagScopes([]string{"Team=a", "Team=b"}); err == nil {
+		t.Errorf("Expected an error for a repeated tag key")
+	}
+}
+
+func TestScopePolicyByTags(t *testing.T) {
+	if err := loadActionCatalog(); err != nil {
+		t.Fatalf("Error loading action catalog: %v", err)
+	}
+
+	policy := IAMPolicy{
+		Version: "2012-10-17",
+		Statement: []IAMStatement{
+			{
+				Effect: "Allow",
+				Action: []string{
+					"iam:PassRole",
+					"lambda:CreateFunction",
+					"lambda:DeleteFunction",
+					"lambda:ListFunctions",
+					"s3:CreateBucket",
+					"sqs:*",
+				},
+				Resource: "*",
+			},
+			{
+				Effect:    "Allow",
+				Action:    []string{"lambda:InvokeFunction"},
+				Resource:  "*",
+				Condition: map[string]map[string]interface{}{"StringEquals": {"aws:SourceAccount": "123456789012"}},
+			},
+		},
+	}
+
+	scoped := scopePolicyByTags(policy, []tagScope{{Key: "Team", Value: "platform"}})
+	if len(scoped.Statement) != 4 {
+		t.Fatalf("Expected 4 statements, got %d: %+v", len(scoped.Statement), scoped.Statement)
+	}
+
+	kept := strings.Join(toStringSlice(scoped.Statement[0].Action), ",")
+	if kept != "iam:PassRole,lambda:ListFunctions,s3:CreateBucket,sqs:*" || scoped.Statement[0].Condition != nil {
+		t.Errorf("Expected untaggable actions to stay unconditioned, got %s", kept)
+	}
+
+	onCreate := scoped.Statement[1]
+	if strings.Join(toStringSlice(onCreate.Action), ",") != "lambda:CreateFunction" ||
+		onCreate.Condition["StringEquals"]["aws:RequestTag/Team"] != "platform" {
+		t.Errorf("Unexpected create statement: %+v", onCreate)
+	}
+
+	onResource := scoped.Statement[2]
+	if strings.Join(toStringSlice(onResource.Action), ",") != "lambda:CreateFunction,lambda:DeleteFunction" ||
+		onResource.Condition["StringEquals"]["aws:ResourceTag/Team"] != "platform" {
+		t.Errorf("Unexpected resource statement: %+v", onResource)
+	}
+
+	if scoped.Statement[3].Condition["StringEquals"]["aws:SourceAccount"] != "123456789012" {
+		t.Errorf("Expected the conditional statement to be left alone")
+	}
+
+	// Tag-scoped statements do not count as unscoped Resource "*" grants
+	if wildcardResourceStatements(scoped) != 1 {
+		t.Errorf("Expected only the unconditioned statement to count, got %d", wildcardResourceStatements(scoped))
+	}
+}
+
+func TestScopePolicyByTagsNoScopes(t *testing.T) {
+	policy := IAMPolicy{Version: "2012-10-17", Statement: []IAMStatement{{Effect: "Allow", Action: []string{"lambda:DeleteFunction"}, Resource: "*"}}}
+	if scoped := scopePolicyByTags(policy, nil); len(scoped.Statement) != 1 || scoped.Statement[0].Condition != nil {
+		t.Errorf("Expected the policy unchanged without scopes, got %+v", scoped)
+	}
+}
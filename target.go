@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+var targetFlag []string
+
+// targetAddressPattern matches the resource addresses accepted by terraform
+// -target: an optional module path followed by a module, a resource or a data
+// source, each optionally with an instance key.
+var targetAddressPattern = regexp.MustCompile(
+	`^(module\.[A-Za-z_][\w-]*(\[[^\]]+\])?\.)*` +
+		`(module\.[A-Za-z_][\w-]*(\[[^\]]+\])?|(data\.)?[A-Za-z_][\w-]*\.[A-Za-z_][\w-]*(\[[^\]]+\])?)$`)
+
+// instanceKeyPattern matches an instance key such as [0] or ["blue"].
+var instanceKeyPattern = regexp.MustCompile(`\[[^\]]+\]`)
+
+// validateTargets checks that every --target value is a resource address.
+func validateTargets(targets []string) error {
+	for _, target := range targets {
+		// "data.aws_ami" would otherwise pass as a resource of type "data"
+		segments := strings.Split(instanceKeyPattern.ReplaceAllString(target, ""), ".")
+		incompleteData := len(segments) >= 2 && segments[len(segments)-2] == "data"
+		if !targetAddressPattern.MatchString(target) || incompleteData {
+			return fmt.Errorf("invalid --target %q: expected a resource address such as aws_s3_bucket.logs or module.vpc", target)
+		}
+	}
+	return nil
+}
+
+// addressMatches reports whether address is target or lies within it, as
+// terraform -target does: module.vpc matches everything in that module and
+// aws_instance.web matches all of its instances. Addresses parsed from .tf
+// files carry no instance keys, so a target naming one instance matches the
+// whole resource.
+func addressMatches(target, address string) bool {
+	if withinAddress(target, address) {
+		return true
+	}
+	if !strings.Contains(address, "[") {
+		return withinAddress(instanceKeyPattern.ReplaceAllString(target, ""), address)
+	}
+	return false
+}
+
+func withinAddress(target, address string) bool {
+	if !strings.HasPrefix(address, target) {
+		return false
+	}
+	rest := address[len(target):]
+	return rest == "" || rest[0] == '.' || rest[0] == '['
+}
+
+// filterTargets returns the part of result that a terraform apply with the
+// given -target addresses would touch: the targeted resources and data
+// sources plus everything they depend on, following references and the
+// inputs of the modules they live in. Targets that match nothing are
+// reported as warnings.
+func filterTargets(result *ParseResult, targets []string) *ParseResult {
+	type node struct {
+		resource Resource
+		address  string
+	}
+	var nodes []node
+	for _, r := range result.Resources {
+		nodes = append(nodes, node{r, resourceAddress(r)})
+	}
+	for _, ds := range result.DataSources {
+		nodes = append(nodes, node{ds, resourceAddress(ds)})
+	}
+
+	included := make(map[int]bool)
+	var queue []string
+	seen := make(map[string]bool)
+	enqueue := func(address string) {
+		if !seen[address] {
+			seen[address] = true
+			queue = append(queue, address)
+		}
+	}
+
+	filtered := &ParseResult{
+		Resources:   []Resource{},
+		DataSources: []Resource{},
+		Backend:     result.Backend,
+		Backends:    result.Backends,
+		Modules:     result.Modules,
+		ModuleCalls: result.ModuleCalls,
+		Warnings:    result.Warnings,
+		Diagnostics: result.Diagnostics,
+		Findings:    result.Findings,
+	}
+
+	for _, target := range targets {
+		matched := false
+		for _, n := range nodes {
+			if addressMatches(target, n.address) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			filtered.Warnings = append(filtered.Warnings, fmt.Sprintf("Target %s matched no resources", target))
+			continue
+		}
+		enqueue(target)
+	}
+
+	for len(queue) > 0 {
+		address := queue[0]
+		queue = queue[1:]
+
+		for i, n := range nodes {
+			if included[i] || !addressMatches(address, n.address) {
+				continue
+			}
+			included[i] = true
+			for _, reference := range n.resource.References {
+				enqueue(reference)
+			}
+			// A module resource also depends on whatever the module's
+			// input expressions refer to.
+			for _, call := range result.ModuleCalls {
+				if withinAddress(call.Address, n.address) {
+					for _, reference := range call.References {
+						enqueue(reference)
+					}
+				}
+			}
+		}
+	}
+
+	for i, n := range nodes {
+		if !included[i] {
+			continue
+		}
+		if !n.resource.Kind.managed() {
+			filtered.DataSources = append(filtered.DataSources, n.resource)
+		} else {
+			filtered.Resources = append(filtered.Resources, n.resource)
+		}
+	}
+	return filtered
+}
+
+var (
+	includeTypesFlag []string
+	excludeTypesFlag []string
+)
+
+// validateTypePatterns checks that every --include-types/--exclude-types
+// value is a valid glob.
+func validateTypePatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid type pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// filterTypes keeps the resources and data sources whose type matches one of
+// the include globs (all types when include is empty) and none of the
+// exclude globs, e.g. include "aws_s3_*" or exclude "aws_iam_*".
+func filterTypes(result *ParseResult, include, exclude []string) *ParseResult {
+	keep := func(resourceType string) bool {
+		if len(include) > 0 && !matchesAnyType(include, resourceType) {
+			return false
+		}
+		return !matchesAnyType(exclude, resourceType)
+	}
+
+	filtered := *result
+	filtered.Resources = []Resource{}
+	filtered.DataSources = []Resource{}
+	for _, r := range result.Resources {
+		if keep(r.Type) {
+			filtered.Resources = append(filtered.Resources, r)
+		}
+	}
+	for _, ds := range result.DataSources {
+		if keep(ds.Type) {
+			filtered.DataSources = append(filtered.DataSources, ds)
+		}
+	}
+	return &filtered
+}
+
+func matchesAnyType(patterns []string, resourceType string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, resourceType); matched {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestModuleResourceAddresses(t *testing.T) {
+	result, err := parseTerraformFiles("test-fixtures/modules")
+	if err != nil {
+		t.Fatalf("Error parsing modules fixture: %v", err)
+	}
+
+	var addresses []string
+	for _, r := range result.Resources {
+		addresses = append(addresses, resourceAddress(r))
+	}
+	sort.Strings(addresses)
+
+	want := []string{
+		"aws_lambda_function.worker",
+		"aws_s3_bucket.logs",
+		"aws_sqs_queue.jobs",
+		"module.network.aws_flow_log.this",
+		"module.network.aws_vpc.this",
+	}
+	if strings.Join(addresses, ",") != strings.Join(want, ",") {
+		t.Errorf("Resource addresses = %v, want %v", addresses, want)
+	}
+}
+
+func TestFilterTargets(t *testing.T) {
+	result, err := parseTerraformFiles("test-fixtures/modules")
+	if err != nil {
+		t.Fatalf("Error parsing modules fixture: %v", err)
+	}
+
+	addressesOf := func(result *ParseResult) []string {
+		var addresses []string
+		for _, r := range result.Resources {
+			addresses = append(addresses, resourceAddress(r))
+		}
+		for _, ds := range result.DataSources {
+			addresses = append(addresses, resourceAddress(ds))
+		}
+		sort.Strings(addresses)
+		return addresses
+	}
+
+	tests := []struct {
+		name    string
+		targets []string
+		want    []string
+	}{
+		{
+			name:    "single resource",
+			targets: []string{"aws_s3_bucket.logs"},
+			want:    []string{"aws_s3_bucket.logs"},
+		},
+		{
+			name:    "instance key matches the whole resource",
+			targets: []string{"aws_s3_bucket.logs[0]"},
+			want:    []string{"aws_s3_bucket.logs"},
+		},
+		{
+			name:    "dependencies through data sources",
+			targets: []string{"aws_lambda_function.worker"},
+			want:    []string{"aws_lambda_function.worker", "aws_sqs_queue.jobs", "data.aws_iam_policy_document.lambda"},
+		},
+		{
+			name:    "module and its inputs",
+			targets: []string{"module.network"},
+			want:    []string{"aws_s3_bucket.logs", "module.network.aws_flow_log.this", "module.network.aws_vpc.this"},
+		},
+		{
+			name:    "resource inside a module",
+			targets: []string{"module.network.aws_vpc.this"},
+			want:    []string{"aws_s3_bucket.logs", "module.network.aws_vpc.this"},
+		},
+		{
+			name:    "prefix of another name does not match",
+			targets: []string{"aws_sqs_queue.job"},
+			want:    nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := addressesOf(filterTargets(result, tt.targets))
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("filterTargets(%v) = %v, want %v", tt.targets, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterTargetsWarnsOnNoMatch(t *testing.T) {
+	result := &ParseResult{
+		Resources: []Resource{{Type: "aws_s3_bucket", Name: "logs", Provider: "aws"}},
+	}
+	filtered := filterTargets(result, []string{"aws_s3_bucket.missing"})
+	if len(filtered.Warnings) != 1 || !strings.Contains(filtered.Warnings[0], "aws_s3_bucket.missing") {
+		t.Errorf("Expected a warning for the unmatched target, got %v", filtered.Warnings)
+	}
+}
+
+func TestValidateTargets(t *testing.T) {
+	valid := []string{
+		"aws_s3_bucket.logs",
+		"aws_instance.web[0]",
+		`aws_instance.web["blue"]`,
+		"data.aws_ami.ubuntu",
+		"module.vpc",
+		"module.app[0].module.db.aws_db_instance.main",
+	}
+	if err := validateTargets(valid); err != nil {
+		t.Errorf("validateTargets(%v) returned %v", valid, err)
+	}
+
+	for _, target := range []string{"", "aws_s3_bucket", "module.", "data.aws_ami", "aws_s3_bucket.logs.id"} {
+		if err := validateTargets([]string{target}); err == nil {
+			t.Errorf("validateTargets(%q) should fail", target)
+		}
+	}
+}
+
+func TestFilterTypes(t *testing.T) {
+	result := &ParseResult{
+		Resources: []Resource{
+			{Type: "aws_s3_bucket", Name: "logs", Provider: "aws"},
+			{Type: "aws_s3_bucket_policy", Name: "logs", Provider: "aws"},
+			{Type: "aws_iam_role", Name: "app", Provider: "aws"},
+			{Type: "aws_sqs_queue", Name: "jobs", Provider: "aws"},
+		},
+		DataSources: []Resource{
+			{Kind: KindData, Type: "aws_iam_policy_document", Name: "app", Provider: "aws"},
+			{Kind: KindData, Type: "aws_caller_identity", Name: "current", Provider: "aws"},
+		},
+	}
+
+	typesOf := func(result *ParseResult) string {
+		var types []string
+		for _, r := range result.Resources {
+			types = append(types, r.Type)
+		}
+		for _, ds := range result.DataSources {
+			types = append(types, "data."+ds.Type)
+		}
+		return strings.Join(types, ",")
+	}
+
+	tests := []struct {
+		name    string
+		include []string
+		exclude []string
+		want    string
+	}{
+		{"include", []string{"aws_s3_*"}, nil, "aws_s3_bucket,aws_s3_bucket_policy"},
+		{"exclude", nil, []string{"aws_iam_*"}, "aws_s3_bucket,aws_s3_bucket_policy,aws_sqs_queue,data.aws_caller_identity"},
+		{"both", []string{"aws_s3_*", "aws_iam_*"}, []string{"*_policy"}, "aws_s3_bucket,aws_iam_role,data.aws_iam_policy_document"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := typesOf(filterTypes(result, tt.include, tt.exclude)); got != tt.want {
+				t.Errorf("filterTypes(%v, %v) = %s, want %s", tt.include, tt.exclude, got, tt.want)
+			}
+		})
+	}
+
+	if len(result.Resources) != 4 {
+		t.Error("filterTypes should not modify its input")
+	}
+	if err := validateTypePatterns([]string{"aws_[s3"}); err == nil {
+		t.Error("Expected an error for a malformed glob")
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// templateSyntax holds the placeholder tokens --template-vars writes into
+// ARNs for one templating tool.
+type templateSyntax struct {
+	Account     string
+	Region      string
+	Environment string
+}
+
+// templateSyntaxes are the syntaxes accepted by --template-vars.
+var templateSyntaxes = map[string]templateSyntax{
+	// templatefile() and other ${...} interpolation
+	"terraform": {Account: "${account_id}", Region: "${region}", Environment: "${environment}"},
+	"jinja":     {Account: "{{ account_id }}", Region: "{{ region }}", Environment: "{{ environment }}"},
+	// text/template with a struct or map holding the three fields
+	"go-template": {Account: "{{ .AccountID }}", Region: "{{ .Region }}", Environment: "{{ .Environment }}"},
+	// CloudFormation Fn::Sub with an Environment parameter
+	"cfn-sub": {Account: "${AWS::AccountId}", Region: "${AWS::Region}", Environment: "${Environment}"},
+}
+
+// templateSampleValues replace the placeholders when the policy is checked
+// against the IAM grammar, so it is validated as it will look once rendered.
+var templateSampleValues = templateSyntax{Account: "123456789012", Region: "us-east-1", Environment: "env"}
+
+var (
+	templateVarsFlag        string
+	templateEnvironmentFlag string
+)
+
+// validateTemplateVars checks the --template-vars value.
+func validateTemplateVars(syntax string) error {
+	if _, ok := templateSyntaxes[syntax]; ok || syntax == "" {
+		return nil
+	}
+	names := make([]string, 0, len(templateSyntaxes))
+	for name := range templateSyntaxes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return fmt.Errorf("invalid --template-vars %q. Valid values: %s", syntax, strings.Join(names, ", "))
+}
+
+// applyTemplateVars makes generated ARNs carry the placeholders of syntax
+// instead of "*" for the account and region, and for the environment name
+// where it appears in resource names.
+func applyTemplateVars(syntax, environment string) {
+	tokens := templateSyntaxes[syntax]
+	defaultARNContext.Account = tokens.Account
+	defaultARNContext.Region = tokens.Region
+	defaultARNContext.Environment = environment
+	defaultARNContext.EnvironmentToken = tokens.Environment
+}
+
+// replaceEnvironment replaces the environment name in a resource name with
+// token where it stands as a whole segment between separators (-, _, ., /,
+// :), so "prod" is replaced in "app-prod-logs" but not in "production".
+func replaceEnvironment(value, environment, token string) string {
+	if environment == "" || token == "" {
+		return value
+	}
+	segment := regexp.MustCompile(`(^|[-_./:])` + regexp.QuoteMeta(environment) + `($|[-_./:])`)
+	replacement := "${1}" + strings.ReplaceAll(token, "$", "$$") + "${2}"
+	// A match consumes the separator after it, so a second pass catches
+	// adjacent segments such as "prod-prod"
+	for i := 0; i < 2; i++ {
+		value = segment.ReplaceAllString(value, replacement)
+	}
+	return value
+}
+
+// renderTemplateSamples returns the policy with the placeholders of syntax
+// in its Resource elements replaced by templateSampleValues.
+func renderTemplateSamples(policy IAMPolicy, syntax string) IAMPolicy {
+	tokens, ok := templateSyntaxes[syntax]
+	if !ok {
+		return policy
+	}
+	replacer := strings.NewReplacer(
+		tokens.Account, templateSampleValues.Account,
+		tokens.Region, templateSampleValues.Region,
+		tokens.Environment, templateSampleValues.Environment,
+	)
+	render := func(value interface{}) interface{} {
+		if value == nil {
+			return nil
+		}
+		var out []string
+		for _, v := range toStringSlice(value) {
+			out = append(out, replacer.Replace(v))
+		}
+		return out
+	}
+
+	rendered := IAMPolicy{Version: policy.Version, Statement: make([]IAMStatement, len(policy.Statement))}
+	for i, statement := range policy.Statement {
+		statement.Resource = render(statement.Resource)
+		statement.NotResource = render(statement.NotResource)
+		rendered.Statement[i] = statement
+	}
+	return rendered
+}
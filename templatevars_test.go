@@ -0,0 +1,70 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestReplaceEnvironment(t *testing.T) {
+	tests := []struct {
+		value, want string
+	}{
+		{"app-prod-logs", "app-{{ env }}-logs"},
+		{"prod", "{{ env }}"},
+		{"/prod/db/password", "/{{ env }}/db/password"},
+		{"prod-prod", "{{ env }}-{{ env }}"},
+		{"production-logs", "production-logs"},
+	}
+	for _, tt := range tests {
+		if got := replaceEnvironment(tt.value, "prod", "{{ env }}"); got != tt.want {
+			t.Errorf("replaceEnvironment(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+	if got := replaceEnvironment("app-prod", "prod", "${Environment}"); got != "app-${Environment}" {
+		t.Errorf("Tokens with $ should be inserted literally, got %q", got)
+	}
+}
+
+func TestTemplateVarsARNs(t *testing.T) {
+	if err := loadPermissionsDB(); err != nil {
+		t.Fatalf("Error loading permissions DB: %v", err)
+	}
+	saved := defaultARNContext
+	t.Cleanup(func() { defaultARNContext = saved })
+	applyTemplateVars("go-template", "prod")
+
+	result := &ParseResult{Resources: []Resource{{
+		Type: "aws_sqs_queue", Name: "orders", Provider: "aws", ResourceType: "aws_sqs_queue",
+		Attributes: map[string]cty.Value{"name": cty.StringVal("prod-orders")},
+	}}}
+	policy := buildIAMPolicy(result, false, true)
+
+	var resources []string
+	for _, statement := range policy.Statement {
+		resources = append(resources, toStringSlice(statement.Resource)...)
+	}
+	want := "arn:aws:sqs:{{ .Region }}:{{ .AccountID }}:{{ .Environment }}-orders"
+	if !containsString(resources, want) {
+		t.Errorf("Expected %s, got %v", want, resources)
+	}
+
+	if errs := policyGrammarErrors(renderTemplateSamples(policy, "go-template"), "aws"); len(errs) != 0 {
+		t.Errorf("The rendered policy should be valid, got %v", errs)
+	}
+	if errs := policyGrammarErrors(policy, "aws"); len(errs) == 0 {
+		t.Error("Expected the unrendered placeholders to fail the account check")
+	}
+}
+
+func TestValidateTemplateVars(t *testing.T) {
+	for _, syntax := range []string{"", "terraform", "jinja", "go-template", "cfn-sub"} {
+		if err := validateTemplateVars(syntax); err != nil {
+			t.Errorf("Unexpected error for %q: %v", syntax, err)
+		}
+	}
+	if err := validateTemplateVars("mustache"); err == nil || !strings.Contains(err.Error(), "cfn-sub") {
+		t.Errorf("Expected an error listing the syntaxes, got %v", err)
+	}
+}
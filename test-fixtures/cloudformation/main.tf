@@ -0,0 +1,10 @@
+resource "aws_cloudformation_stack" "network" {
+  name          = "network"
+  template_body = file("${path.module}/network.yaml")
+}
+
+resource "aws_cloudformation_stack" "service_role" {
+  name          = "service-role"
+  iam_role_arn  = "arn:aws:iam::123456789012:role/cloudformation"
+  template_body = file("network.yaml")
+}
@@ -0,0 +1,51 @@
+resource "aws_lambda_function" "in_vpc" {
+  function_name = "in-vpc"
+  role          = "arn:aws:iam::123456789012:role/lambda"
+  handler       = "index.handler"
+  runtime       = "nodejs20.x"
+
+  vpc_config {
+    subnet_ids         = ["subnet-12345678"]
+    security_group_ids = ["sg-12345678"]
+  }
+}
+
+resource "aws_lambda_function" "plain" {
+  function_name = "plain"
+  role          = "arn:aws:iam::123456789012:role/lambda"
+  handler       = "index.handler"
+  runtime       = "nodejs20.x"
+}
+
+resource "aws_lb" "public" {
+  name = "public"
+
+  dynamic "subnet_mapping" {
+    for_each = ["subnet-12345678"]
+    content {
+      subnet_id = subnet_mapping.value
+    }
+  }
+}
+
+resource "aws_instance" "encrypted" {
+  ami           = "ami-12345678"
+  instance_type = "t3.micro"
+
+  dynamic "ebs_block_device" {
+    for_each = var.volumes
+    content {
+      device_name = ebs_block_device.key
+      kms_key_id  = "arn:aws:kms:us-east-1:123456789012:key/data"
+    }
+  }
+}
+
+resource "aws_instance" "unencrypted" {
+  ami           = "ami-12345678"
+  instance_type = "t3.micro"
+
+  root_block_device {
+    volume_size = 20
+  }
+}
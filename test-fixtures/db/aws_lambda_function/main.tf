@@ -0,0 +1,7 @@
+# Test fixture of the aws_lambda_function permissions DB entry, written by
+# tf-iam-scanner db test-fixture. Values are placeholders.
+
+resource "aws_lambda_function" "example" {
+  function_name = "example"
+  role          = "arn:aws:iam::123456789012:role/example"
+}
@@ -0,0 +1,6 @@
+# Test fixture of the aws_sqs_queue permissions DB entry, written by
+# tf-iam-scanner db test-fixture. Values are placeholders.
+
+resource "aws_sqs_queue" "example" {
+  name = "example"
+}
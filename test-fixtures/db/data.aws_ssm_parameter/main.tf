@@ -0,0 +1,6 @@
+# Test fixture of the data.aws_ssm_parameter permissions DB entry, written by
+# tf-iam-scanner db test-fixture. Values are placeholders.
+
+data "aws_ssm_parameter" "example" {
+  name = "example"
+}
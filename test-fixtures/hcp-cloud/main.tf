@@ -0,0 +1,14 @@
+terraform {
+  cloud {
+    organization = "acme"
+
+    workspaces {
+      tags    = ["networking", "prod"]
+      project = "platform"
+    }
+  }
+}
+
+resource "aws_sqs_queue" "jobs" {
+  name = "jobs"
+}
@@ -0,0 +1,32 @@
+resource "aws_s3_bucket" "logs" {
+  bucket = "app-logs"
+}
+
+resource "aws_sqs_queue" "jobs" {
+  name = "jobs"
+}
+
+data "aws_iam_policy_document" "lambda" {
+  statement {
+    actions   = ["sqs:SendMessage"]
+    resources = [aws_sqs_queue.jobs.arn]
+  }
+}
+
+resource "aws_lambda_function" "worker" {
+  function_name = "worker"
+  role          = "arn:aws:iam::123456789012:role/worker"
+  handler       = "index.handler"
+  runtime       = "nodejs20.x"
+
+  environment {
+    variables = {
+      POLICY = data.aws_iam_policy_document.lambda.json
+    }
+  }
+}
+
+module "network" {
+  source     = "./modules/network"
+  log_bucket = aws_s3_bucket.logs.id
+}
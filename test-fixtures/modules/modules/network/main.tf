@@ -0,0 +1,13 @@
+variable "log_bucket" {
+  type = string
+}
+
+resource "aws_vpc" "this" {
+  cidr_block = "10.0.0.0/16"
+}
+
+resource "aws_flow_log" "this" {
+  vpc_id               = aws_vpc.this.id
+  log_destination_type = "s3"
+  log_destination      = "arn:aws:s3:::${var.log_bucket}"
+}
@@ -0,0 +1,4 @@
+# Terraform reads this file; OpenTofu reads main.tofu instead
+resource "aws_sqs_queue" "jobs" {
+  name = "jobs"
+}
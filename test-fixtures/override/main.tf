@@ -0,0 +1,23 @@
+terraform {
+  backend "s3" {
+    bucket = "state"
+    key    = "app.tfstate"
+  }
+}
+
+resource "aws_sqs_queue" "jobs" {
+  name = "jobs"
+
+  lifecycle {
+    prevent_destroy = true
+  }
+}
+
+resource "aws_instance" "web" {
+  ami           = "ami-123"
+  instance_type = "t3.micro"
+
+  root_block_device {
+    encrypted = false
+  }
+}
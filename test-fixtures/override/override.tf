@@ -0,0 +1,17 @@
+resource "aws_sqs_queue" "jobs" {
+  kms_master_key_id = "alias/jobs"
+
+  lifecycle {
+    create_before_destroy = true
+  }
+}
+
+resource "aws_instance" "web" {
+  root_block_device {
+    volume_size = 50
+  }
+}
+
+resource "aws_sns_topic" "missing" {
+  name = "missing"
+}
@@ -0,0 +1,12 @@
+resource "aws_s3_bucket" "ok" {
+  bucket = "fine"
+}
+
+resource "aws_sqs_queue" "bad" {
+  name = "q"
+  tags = { a = }
+}
+
+resource "aws_sns_topic" "after" {
+  name = "t"
+}
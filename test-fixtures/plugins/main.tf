@@ -0,0 +1,20 @@
+resource "mongodbatlas_privatelink_endpoint" "atlas" {
+  project_id    = var.atlas_project_id
+  provider_name = "AWS"
+  region        = "us-east-1"
+}
+
+resource "aws_vpc_endpoint" "atlas" {
+  vpc_id            = var.vpc_id
+  service_name      = mongodbatlas_privatelink_endpoint.atlas.endpoint_service_name
+  vpc_endpoint_type = "Interface"
+}
+
+resource "datadog_integration_aws" "main" {
+  account_id = var.account_id
+  role_name  = "DatadogIntegrationRole"
+}
+
+resource "random_id" "suffix" {
+  byte_length = 4
+}
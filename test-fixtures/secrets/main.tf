@@ -0,0 +1,48 @@
+resource "aws_kms_key" "secrets" {
+  description = "Application secrets"
+}
+
+resource "aws_secretsmanager_secret" "db" {
+  name       = "db"
+  kms_key_id = aws_kms_key.secrets.arn
+}
+
+resource "aws_secretsmanager_secret_version" "db" {
+  secret_id     = aws_secretsmanager_secret.db.id
+  secret_string = "change-me"
+}
+
+resource "aws_ssm_parameter" "token" {
+  name   = "/app/token"
+  type   = "SecureString"
+  key_id = "1234abcd-12ab-34cd-56ef-1234567890ab"
+  value  = "change-me"
+}
+
+resource "aws_ssm_parameter" "endpoint" {
+  name  = "/app/endpoint"
+  type  = "String"
+  value = "https://example.com"
+}
+
+# Read at plan time and stored in the state
+data "aws_secretsmanager_secret_version" "db" {
+  secret_id = aws_secretsmanager_secret_version.db.secret_id
+}
+
+data "aws_ssm_parameter" "token" {
+  name = aws_ssm_parameter.token.name
+}
+
+data "aws_ssm_parameter" "endpoint" {
+  name = aws_ssm_parameter.endpoint.name
+}
+
+# Managed elsewhere: the key is not known
+data "aws_ssm_parameter" "shared" {
+  name = "/shared/api-key"
+}
+
+ephemeral "aws_secretsmanager_secret_version" "db" {
+  secret_id = aws_secretsmanager_secret.db.id
+}
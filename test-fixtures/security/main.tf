@@ -0,0 +1,15 @@
+resource "aws_iam_user" "ci" {
+  name = "ci"
+}
+
+resource "aws_iam_access_key" "ci" {
+  user = aws_iam_user.ci.name
+}
+
+resource "aws_db_instance" "app" {
+  identifier     = "app"
+  engine         = "postgres"
+  instance_class = "db.t4g.micro"
+  username       = "app"
+  password       = "not-a-real-password"
+}
@@ -0,0 +1,57 @@
+required_providers {
+  aws = {
+    source  = "hashicorp/aws"
+    version = "~> 5.0"
+  }
+}
+
+variable "region" {
+  type = string
+}
+
+variable "role_arn" {
+  type = string
+}
+
+variable "identity_token" {
+  type      = string
+  ephemeral = true
+}
+
+provider "aws" "this" {
+  config {
+    region = var.region
+    assume_role_with_web_identity {
+      role_arn           = var.role_arn
+      web_identity_token = var.identity_token
+    }
+  }
+}
+
+component "network" {
+  source = "./modules/network"
+  inputs = {
+    cidr_block = "10.0.0.0/16"
+  }
+  providers = {
+    aws = provider.aws.this
+  }
+}
+
+component "app" {
+  source = "./modules/app"
+  inputs = {
+    vpc_id = component.network.vpc_id
+  }
+  providers = {
+    aws = provider.aws.this
+  }
+}
+
+component "dns" {
+  source  = "app.terraform.io/example/dns/aws"
+  version = "1.0.0"
+  providers = {
+    aws = provider.aws.this
+  }
+}
@@ -0,0 +1,23 @@
+identity_token "aws" {
+  audience = ["aws.workload.identity"]
+}
+
+locals {
+  production_role = "arn:aws:iam::222222222222:role/stacks-deploy"
+}
+
+deployment "staging" {
+  inputs = {
+    region         = "eu-west-1"
+    role_arn       = "arn:aws:iam::111111111111:role/stacks-deploy"
+    identity_token = identity_token.aws.jwt
+  }
+}
+
+deployment "production" {
+  inputs = {
+    region         = "us-east-1"
+    role_arn       = local.production_role
+    identity_token = identity_token.aws.jwt
+  }
+}
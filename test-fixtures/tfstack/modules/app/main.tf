@@ -0,0 +1,12 @@
+variable "vpc_id" {
+  type = string
+}
+
+resource "aws_sqs_queue" "jobs" {
+  name = "jobs"
+}
+
+resource "aws_security_group" "app" {
+  name   = "app"
+  vpc_id = var.vpc_id
+}
@@ -0,0 +1,392 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// Sources accepted by tfc --source.
+const (
+	tfcSourcePlan          = "plan"
+	tfcSourceConfiguration = "configuration"
+)
+
+var (
+	tfcOrganizationFlag string
+	tfcWorkspaceFlag    string
+	tfcHostnameFlag     string
+	tfcSourceFlag       string
+	tfcCommentFlag      bool
+	tfcVariableFlag     string
+)
+
+var tfcCmd = &cobra.Command{
+	Use:   "tfc --organization ORG --workspace NAME",
+	Short: "Generate the policy for a Terraform Cloud / HCP Terraform workspace",
+	Long: `Download the latest plan JSON (default) or configuration version of a
+Terraform Cloud / HCP Terraform workspace and generate the policy for it.
+
+The API token is read from TFE_TOKEN, or from TF_TOKEN_<hostname> as used by
+the Terraform CLI (dots replaced by underscores, e.g. TF_TOKEN_app_terraform_io).
+The plan JSON needs a token that may read the workspace's runs and state.
+
+With --comment the policy is posted as a comment on the workspace's current
+run; with --variable it is stored in a workspace Terraform variable.
+
+Example:
+  TFE_TOKEN=... tf-iam-scanner tfc --organization acme --workspace network-prod --least-privilege`,
+	Run: runTFC,
+}
+
+func init() {
+	tfcCmd.Flags().StringVar(&tfcOrganizationFlag, "organization", "", "Terraform Cloud organization name")
+	tfcCmd.Flags().StringVar(&tfcWorkspaceFlag, "workspace", "", "Workspace name")
+	tfcCmd.Flags().StringVar(&tfcHostnameFlag, "hostname", "app.terraform.io", "Terraform Cloud or Terraform Enterprise hostname")
+	tfcCmd.Flags().StringVar(&tfcSourceFlag, "source", tfcSourcePlan, "What to scan: plan (JSON of the current run's plan) or configuration (latest configuration version)")
+	tfcCmd.Flags().BoolVar(&tfcCommentFlag, "comment", false, "Post the generated policy as a comment on the workspace's current run")
+	tfcCmd.Flags().StringVar(&tfcVariableFlag, "variable", "", "Store the generated policy in this workspace Terraform variable (created if missing)")
+	_ = tfcCmd.MarkFlagRequired("organization")
+	_ = tfcCmd.MarkFlagRequired("workspace")
+	_ = tfcCmd.RegisterFlagCompletionFunc("source", cobra.FixedCompletions(
+		[]string{tfcSourcePlan, tfcSourceConfiguration}, cobra.ShellCompDirectiveNoFileComp))
+	addPolicyOutputFlags(tfcCmd)
+	rootCmd.AddCommand(tfcCmd)
+}
+
+// tfcClient is a minimal client for the Terraform Cloud v2 API.
+type tfcClient struct {
+	baseURL string
+	token   string
+	http    *http.Client
+}
+
+func newTFCClient(hostname, token string) *tfcClient {
+	return &tfcClient{
+		baseURL: "https://" + hostname + "/api/v2",
+		token:   token,
+		http:    &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+// tfcToken returns the API token for hostname from the environment.
+func tfcToken(hostname string) string {
+	if token := os.Getenv("TFE_TOKEN"); token != "" {
+		return token
+	}
+	name := "TF_TOKEN_" + strings.NewReplacer(".", "_", "-", "__").Replace(hostname)
+	return os.Getenv(name)
+}
+
+// tfcResource is a JSON:API resource object as returned by the API.
+type tfcResource struct {
+	ID            string                     `json:"id"`
+	Type          string                     `json:"type"`
+	Attributes    map[string]json.RawMessage `json:"attributes,omitempty"`
+	Relationships map[string]struct {
+		Data *struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	} `json:"relationships,omitempty"`
+}
+
+// relationshipID returns the ID of a to-one relationship, or "" when unset.
+func (r tfcResource) relationshipID(name string) string {
+	if rel, ok := r.Relationships[name]; ok && rel.Data != nil {
+		return rel.Data.ID
+	}
+	return ""
+}
+
+// tfcWorkspace is the part of a workspace the scanner needs.
+type tfcWorkspace struct {
+	ID           string
+	CurrentRunID string
+}
+
+// do sends a request to the API and returns the response body. body, when
+// not nil, is sent as a JSON:API document.
+func (c *tfcClient) do(ctx context.Context, method, path string, body interface{}) ([]byte, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/vnd.api+json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("%s %s: %s", method, path, tfcErrorMessage(resp.StatusCode, data))
+	}
+	return data, nil
+}
+
+// tfcErrorMessage extracts the first JSON:API error from a failed response.
+func tfcErrorMessage(status int, data []byte) string {
+	var doc struct {
+		Errors []struct {
+			Title  string `json:"title"`
+			Detail string `json:"detail"`
+		} `json:"errors"`
+	}
+	if json.Unmarshal(data, &doc) == nil && len(doc.Errors) > 0 {
+		if doc.Errors[0].Detail != "" {
+			return fmt.Sprintf("%d %s: %s", status, doc.Errors[0].Title, doc.Errors[0].Detail)
+		}
+		return fmt.Sprintf("%d %s", status, doc.Errors[0].Title)
+	}
+	return fmt.Sprintf("%d %s", status, http.StatusText(status))
+}
+
+// workspace looks up a workspace by organization and name.
+func (c *tfcClient) workspace(ctx context.Context, organization, name string) (tfcWorkspace, error) {
+	data, err := c.do(ctx, http.MethodGet, "/organizations/"+url.PathEscape(organization)+"/workspaces/"+url.PathEscape(name), nil)
+	if err != nil {
+		return tfcWorkspace{}, fmt.Errorf("error reading workspace: %w", err)
+	}
+	var doc struct {
+		Data tfcResource `json:"data"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return tfcWorkspace{}, fmt.Errorf("error parsing workspace: %w", err)
+	}
+	return tfcWorkspace{ID: doc.Data.ID, CurrentRunID: doc.Data.relationshipID("current-run")}, nil
+}
+
+// planJSON downloads the JSON plan of a run.
+func (c *tfcClient) planJSON(ctx context.Context, runID string) ([]byte, error) {
+	data, err := c.do(ctx, http.MethodGet, "/runs/"+url.PathEscape(runID)+"/plan/json-output", nil)
+	if err != nil {
+		return nil, fmt.Errorf("error downloading plan JSON: %w", err)
+	}
+	return data, nil
+}
+
+// latestConfiguration downloads the newest configuration version of a
+// workspace as a .tar.gz archive.
+func (c *tfcClient) latestConfiguration(ctx context.Context, workspaceID string) ([]byte, error) {
+	data, err := c.do(ctx, http.MethodGet, "/workspaces/"+url.PathEscape(workspaceID)+"/configuration-versions?page%5Bsize%5D=1", nil)
+	if err != nil {
+		return nil, fmt.Errorf("error listing configuration versions: %w", err)
+	}
+	var doc struct {
+		Data []tfcResource `json:"data"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("error parsing configuration versions: %w", err)
+	}
+	if len(doc.Data) == 0 {
+		return nil, errors.New("workspace has no configuration versions")
+	}
+
+	archive, err := c.do(ctx, http.MethodGet, "/configuration-versions/"+url.PathEscape(doc.Data[0].ID)+"/download", nil)
+	if err != nil {
+		return nil, fmt.Errorf("error downloading configuration version: %w", err)
+	}
+	return archive, nil
+}
+
+// postRunComment adds a comment to a run.
+func (c *tfcClient) postRunComment(ctx context.Context, runID, body string) error {
+	doc := map[string]interface{}{
+		"data": map[string]interface{}{
+			"type":       "comments",
+			"attributes": map[string]string{"body": body},
+		},
+	}
+	if _, err := c.do(ctx, http.MethodPost, "/runs/"+url.PathEscape(runID)+"/comments", doc); err != nil {
+		return fmt.Errorf("error posting run comment: %w", err)
+	}
+	return nil
+}
+
+// setWorkspaceVariable creates or updates a Terraform variable on a
+// workspace.
+func (c *tfcClient) setWorkspaceVariable(ctx context.Context, workspaceID, key, value string) error {
+	path := "/workspaces/" + url.PathEscape(workspaceID) + "/vars"
+	data, err := c.do(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return fmt.Errorf("error listing workspace variables: %w", err)
+	}
+	var doc struct {
+		Data []tfcResource `json:"data"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("error parsing workspace variables: %w", err)
+	}
+
+	attributes := map[string]interface{}{
+		"key":         key,
+		"value":       value,
+		"category":    "terraform",
+		"hcl":         false,
+		"sensitive":   false,
+		"description": "IAM policy generated by tf-iam-scanner",
+	}
+	for _, variable := range doc.Data {
+		var existingKey, category string
+		_ = json.Unmarshal(variable.Attributes["key"], &existingKey)
+		_ = json.Unmarshal(variable.Attributes["category"], &category)
+		if existingKey != key || category != "terraform" {
+			continue
+		}
+		update := map[string]interface{}{
+			"data": map[string]interface{}{"id": variable.ID, "type": "vars", "attributes": attributes},
+		}
+		if _, err := c.do(ctx, http.MethodPatch, path+"/"+url.PathEscape(variable.ID), update); err != nil {
+			return fmt.Errorf("error updating workspace variable: %w", err)
+		}
+		return nil
+	}
+
+	create := map[string]interface{}{
+		"data": map[string]interface{}{"type": "vars", "attributes": attributes},
+	}
+	if _, err := c.do(ctx, http.MethodPost, path, create); err != nil {
+		return fmt.Errorf("error creating workspace variable: %w", err)
+	}
+	return nil
+}
+
+// extractTarGz unpacks a configuration version archive into dir. Entries that
+// would land outside dir are rejected.
+func extractTarGz(archive []byte, dir string) error {
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		return fmt.Errorf("error reading configuration archive: %w", err)
+	}
+	defer gz.Close()
+
+	budget := int64(maxUnpackedSize)
+	if err := extractTar(gz, dir, &budget); err != nil {
+		return fmt.Errorf("error reading configuration archive: %w", err)
+	}
+	return nil
+}
+
+// tfcCommentBody formats the policy as a Markdown run comment.
+func tfcCommentBody(policy string, format OutputFormat) string {
+	fence := string(format)
+	if format == FormatTerraform {
+		fence = "hcl"
+	}
+	return fmt.Sprintf("IAM policy generated by tf-iam-scanner:\n\n```%s\n%s\n```\n", fence, strings.TrimSpace(policy))
+}
+
+func runTFC(cmd *cobra.Command, args []string) {
+	format, err := validateOutputFlags(cmd)
+	if err != nil {
+		exitWithError(err)
+	}
+
+	if tfcSourceFlag != tfcSourcePlan && tfcSourceFlag != tfcSourceConfiguration {
+		exitWithError(validationErrorf("invalid --source %s. Valid values: %s, %s", tfcSourceFlag, tfcSourcePlan, tfcSourceConfiguration))
+	}
+	if (tfcCommentFlag || tfcVariableFlag != "") && format == FormatXLSX {
+		exitWithError(validationErrorf("xlsx output cannot be posted to Terraform Cloud"))
+	}
+
+	token := tfcToken(tfcHostnameFlag)
+	if token == "" {
+		exitWithError(validationErrorf("no API token; set TFE_TOKEN or TF_TOKEN_%s",
+			strings.NewReplacer(".", "_", "-", "__").Replace(tfcHostnameFlag)))
+	}
+	client := newTFCClient(tfcHostnameFlag, token)
+	ctx := cmd.Context()
+
+	workspace, err := client.workspace(ctx, tfcOrganizationFlag, tfcWorkspaceFlag)
+	if err != nil {
+		exitWithError(err)
+	}
+	if (tfcSourceFlag == tfcSourcePlan || tfcCommentFlag) && workspace.CurrentRunID == "" {
+		exitWithError(fmt.Errorf("workspace %s has no runs", tfcWorkspaceFlag))
+	}
+
+	source := fmt.Sprintf("%s/%s/%s", tfcHostnameFlag, tfcOrganizationFlag, tfcWorkspaceFlag)
+	result, err := fetchTFCResult(ctx, client, workspace)
+	exitIfCancelled(ctx, result, source)
+	if err != nil {
+		exitWithError(err)
+	}
+
+	policy := generateAndWrite(ctx, result, format, source)
+
+	if tfcCommentFlag {
+		if err := client.postRunComment(ctx, workspace.CurrentRunID, tfcCommentBody(policy, format)); err != nil {
+			exitWithError(err)
+		}
+		statusf("  Comment posted to run: %s\n", workspace.CurrentRunID)
+	}
+	if tfcVariableFlag != "" {
+		if err := client.setWorkspaceVariable(ctx, workspace.ID, tfcVariableFlag, policy); err != nil {
+			exitWithError(err)
+		}
+		statusf("  Workspace variable set: %s\n", tfcVariableFlag)
+	}
+}
+
+// fetchTFCResult downloads and parses the workspace input selected by
+// --source. Input that cannot be parsed is reported as a ParseError.
+func fetchTFCResult(ctx context.Context, client *tfcClient, workspace tfcWorkspace) (*ParseResult, error) {
+	if tfcSourceFlag == tfcSourcePlan {
+		data, err := client.planJSON(ctx, workspace.CurrentRunID)
+		if err != nil {
+			return nil, err
+		}
+		result, err := parsePlanJSON(data)
+		if err != nil {
+			return nil, &ParseError{Source: "the plan of run " + workspace.CurrentRunID, Err: err}
+		}
+		return result, nil
+	}
+
+	archive, err := client.latestConfiguration(ctx, workspace.ID)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := os.MkdirTemp("", "tf-iam-scanner-tfc-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	if err := extractTarGz(archive, dir); err != nil {
+		return nil, &ParseError{Source: "the configuration of workspace " + tfcWorkspaceFlag, Err: err}
+	}
+	result, err := parseTerraformFilesContext(ctx, dir)
+	if err != nil {
+		return nil, &ParseError{Source: "the configuration of workspace " + tfcWorkspaceFlag, Err: err}
+	}
+	return result, nil
+}
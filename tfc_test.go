@@ -0,0 +1,199 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeTFC serves the subset of the Terraform Cloud API used by the tfc
+// command and records the documents written to it.
+type fakeTFC struct {
+	planJSON      []byte
+	configArchive []byte
+	variables     []tfcResource
+	comments      []string
+	writes        []string
+}
+
+func (f *fakeTFC) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer test-token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"errors":[{"status":"401","title":"unauthorized"}]}`))
+		return
+	}
+
+	body, _ := io.ReadAll(r.Body)
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v2/organizations/acme/workspaces/network":
+		_, _ = w.Write([]byte(`{"data":{"id":"ws-1","type":"workspaces","relationships":{"current-run":{"data":{"id":"run-1","type":"runs"}}}}}`))
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v2/runs/run-1/plan/json-output":
+		_, _ = w.Write(f.planJSON)
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v2/workspaces/ws-1/configuration-versions":
+		_, _ = w.Write([]byte(`{"data":[{"id":"cv-2","type":"configuration-versions"}]}`))
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v2/configuration-versions/cv-2/download":
+		_, _ = w.Write(f.configArchive)
+	case r.Method == http.MethodPost && r.URL.Path == "/api/v2/runs/run-1/comments":
+		var doc struct {
+			Data struct {
+				Attributes struct {
+					Body string `json:"body"`
+				} `json:"attributes"`
+			} `json:"data"`
+		}
+		_ = json.Unmarshal(body, &doc)
+		f.comments = append(f.comments, doc.Data.Attributes.Body)
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v2/workspaces/ws-1/vars":
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": f.variables})
+	case r.URL.Path == "/api/v2/workspaces/ws-1/vars" || strings.HasPrefix(r.URL.Path, "/api/v2/workspaces/ws-1/vars/"):
+		f.writes = append(f.writes, r.Method+" "+r.URL.Path)
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"errors":[{"status":"404","title":"not found"}]}`))
+	}
+}
+
+func newFakeTFCClient(t *testing.T, fake *fakeTFC) *tfcClient {
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	client := newTFCClient("unused", "test-token")
+	client.baseURL = server.URL + "/api/v2"
+	return client
+}
+
+func TestTFCPlanSource(t *testing.T) {
+	plan, err := os.ReadFile("test-fixtures/plan/tfplan.json")
+	if err != nil {
+		t.Fatalf("Error reading plan fixture: %v", err)
+	}
+	client := newFakeTFCClient(t, &fakeTFC{planJSON: plan})
+
+	workspace, err := client.workspace(context.Background(), "acme", "network")
+	if err != nil {
+		t.Fatalf("Error reading workspace: %v", err)
+	}
+	if workspace.ID != "ws-1" || workspace.CurrentRunID != "run-1" {
+		t.Fatalf("Workspace = %+v, want ws-1 with run-1", workspace)
+	}
+
+	tfcSourceFlag = tfcSourcePlan
+	result, err := fetchTFCResult(context.Background(), client, workspace)
+	if err != nil {
+		t.Fatalf("Error fetching plan: %v", err)
+	}
+	if len(result.Resources) == 0 {
+		t.Error("Expected resources from the plan JSON")
+	}
+
+	client = newFakeTFCClient(t, &fakeTFC{planJSON: []byte("not json")})
+	if _, err := fetchTFCResult(context.Background(), client, workspace); exitCode(err) != exitParseError {
+		t.Errorf("Expected a parse error for an unreadable plan, got %v", err)
+	}
+}
+
+func TestTFCConfigurationSource(t *testing.T) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	content := []byte(`resource "aws_sqs_queue" "jobs" {
+  name = "jobs"
+}
+`)
+	_ = tw.WriteHeader(&tar.Header{Name: "main.tf", Mode: 0o644, Size: int64(len(content)), Typeflag: tar.TypeReg})
+	_, _ = tw.Write(content)
+	_ = tw.Close()
+	_ = gz.Close()
+
+	client := newFakeTFCClient(t, &fakeTFC{configArchive: buf.Bytes()})
+
+	tfcSourceFlag = tfcSourceConfiguration
+	defer func() { tfcSourceFlag = tfcSourcePlan }()
+	result, err := fetchTFCResult(context.Background(), client, tfcWorkspace{ID: "ws-1"})
+	if err != nil {
+		t.Fatalf("Error fetching configuration: %v", err)
+	}
+	if len(result.Resources) != 1 || result.Resources[0].Type != "aws_sqs_queue" {
+		t.Errorf("Expected the aws_sqs_queue from the archive, got %+v", result.Resources)
+	}
+}
+
+func TestTFCPostBack(t *testing.T) {
+	fake := &fakeTFC{}
+	client := newFakeTFCClient(t, fake)
+
+	if err := client.postRunComment(context.Background(), "run-1", tfcCommentBody(`{"Version": "2012-10-17"}`, FormatJSON)); err != nil {
+		t.Fatalf("Error posting comment: %v", err)
+	}
+	if len(fake.comments) != 1 || !strings.Contains(fake.comments[0], "```json") {
+		t.Errorf("Unexpected comments: %q", fake.comments)
+	}
+
+	if err := client.setWorkspaceVariable(context.Background(), "ws-1", "deploy_policy", "{}"); err != nil {
+		t.Fatalf("Error creating variable: %v", err)
+	}
+	fake.variables = []tfcResource{{
+		ID:   "var-9",
+		Type: "vars",
+		Attributes: map[string]json.RawMessage{
+			"key":      json.RawMessage(`"deploy_policy"`),
+			"category": json.RawMessage(`"terraform"`),
+		},
+	}}
+	if err := client.setWorkspaceVariable(context.Background(), "ws-1", "deploy_policy", "{}"); err != nil {
+		t.Fatalf("Error updating variable: %v", err)
+	}
+
+	want := []string{"POST /api/v2/workspaces/ws-1/vars", "PATCH /api/v2/workspaces/ws-1/vars/var-9"}
+	if strings.Join(fake.writes, ",") != strings.Join(want, ",") {
+		t.Errorf("Variable writes = %v, want %v", fake.writes, want)
+	}
+}
+
+func TestTFCErrors(t *testing.T) {
+	client := newFakeTFCClient(t, &fakeTFC{})
+	client.token = "wrong"
+	if _, err := client.workspace(context.Background(), "acme", "network"); err == nil || !strings.Contains(err.Error(), "401 unauthorized") {
+		t.Errorf("Expected a 401 error, got %v", err)
+	}
+}
+
+func TestExtractTarGzRejectsEscapes(t *testing.T) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	_ = tw.WriteHeader(&tar.Header{Name: "../evil.tf", Mode: 0o644, Size: 1, Typeflag: tar.TypeReg})
+	_, _ = tw.Write([]byte("x"))
+	_ = tw.Close()
+	_ = gz.Close()
+
+	dir := t.TempDir()
+	if err := extractTarGz(buf.Bytes(), dir); err == nil {
+		t.Error("Expected an error for an entry outside the extraction directory")
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(dir), "evil.tf")); err == nil {
+		t.Error("Entry outside the extraction directory was written")
+	}
+}
+
+func TestTFCToken(t *testing.T) {
+	t.Setenv("TFE_TOKEN", "")
+	t.Setenv("TF_TOKEN_tfe_example_com", "host-token")
+	if got := tfcToken("tfe.example.com"); got != "host-token" {
+		t.Errorf("tfcToken = %q, want host-token", got)
+	}
+	t.Setenv("TFE_TOKEN", "global-token")
+	if got := tfcToken("tfe.example.com"); got != "global-token" {
+		t.Errorf("tfcToken = %q, want global-token", got)
+	}
+}
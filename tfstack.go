@@ -0,0 +1,312 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// File suffixes of a Terraform Stack: components and providers are declared
+// in .tfstack.hcl files, deployments in .tfdeploy.hcl files.
+const (
+	tfstackSuffix  = ".tfstack.hcl"
+	tfdeploySuffix = ".tfdeploy.hcl"
+)
+
+// stackComponent is a component block: an instance of a module.
+type stackComponent struct {
+	Name   string
+	Source string
+	File   string
+	Line   int
+}
+
+// stackDeployment is a deployment block. Inputs holds the inputs whose value
+// is known from the deployment file; the others are left out.
+type stackDeployment struct {
+	Name   string
+	Inputs map[string]cty.Value
+	File   string
+	Line   int
+}
+
+// terraformStack is the configuration of a Terraform Stack found in Dir.
+type terraformStack struct {
+	Dir         string
+	Components  []stackComponent
+	Deployments []stackDeployment
+	Diagnostics []ParseDiagnostic
+}
+
+// isTerraformStack reports whether dir holds a Terraform Stack
+// configuration.
+func isTerraformStack(dir string) bool {
+	matches, _ := filepath.Glob(filepath.Join(dir, "*"+tfstackSuffix))
+	return len(matches) > 0
+}
+
+// parseTerraformStack reads the component and deployment blocks of the
+// Stack in dir. Other blocks (providers, variables, outputs, stores,
+// orchestration rules) do not affect the permissions and are ignored.
+func parseTerraformStack(dir string) (*terraformStack, error) {
+	stack := &terraformStack{Dir: dir}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !(strings.HasSuffix(name, tfstackSuffix) || strings.HasSuffix(name, tfdeploySuffix)) {
+			continue
+		}
+		filePath := filepath.Join(dir, name)
+		content, err := os.ReadFile(filePath)
+		if err != nil {
+			return nil, err
+		}
+		file, diags := hclsyntax.ParseConfig(normalizeSource(content), filePath, hcl.Pos{Line: 1, Column: 1})
+		for _, diag := range diags {
+			stack.Diagnostics = append(stack.Diagnostics, newParseDiagnostic(diag, filePath))
+		}
+		if file == nil {
+			continue
+		}
+		body, ok := file.Body.(*hclsyntax.Body)
+		if !ok {
+			continue
+		}
+
+		locals := stackLocals(body)
+		for _, block := range body.Blocks {
+			if len(block.Labels) == 0 {
+				continue
+			}
+			switch block.Type {
+			case "component":
+				stack.Components = append(stack.Components, stackComponent{
+					Name:   block.Labels[0],
+					Source: extractModuleSource(block),
+					File:   filePath,
+					Line:   block.DefRange().Start.Line,
+				})
+			case "deployment":
+				stack.Deployments = append(stack.Deployments, stackDeployment{
+					Name:   block.Labels[0],
+					Inputs: deploymentInputs(block, locals),
+					File:   filePath,
+					Line:   block.DefRange().Start.Line,
+				})
+			}
+		}
+	}
+	sort.SliceStable(stack.Components, func(i, j int) bool { return stack.Components[i].Name < stack.Components[j].Name })
+	sort.SliceStable(stack.Deployments, func(i, j int) bool { return stack.Deployments[i].Name < stack.Deployments[j].Name })
+	return stack, nil
+}
+
+// stackLocals evaluates the locals of a deployment file that are literal
+// values, so inputs may refer to them.
+func stackLocals(body *hclsyntax.Body) *hcl.EvalContext {
+	locals := make(map[string]cty.Value)
+	for _, block := range body.Blocks {
+		if block.Type != "locals" {
+			continue
+		}
+		for name, attr := range block.Body.Attributes {
+			if value, diags := attr.Expr.Value(nil); !diags.HasErrors() && value.IsWhollyKnown() {
+				locals[name] = value
+			}
+		}
+	}
+	return &hcl.EvalContext{Variables: map[string]cty.Value{"local": cty.ObjectVal(locals)}}
+}
+
+// deploymentInputs returns the inputs of a deployment block that evaluate to
+// known values. Inputs read from stores, identity tokens or other blocks are
+// only known to HCP Terraform and are left out.
+func deploymentInputs(block *hclsyntax.Block, ctx *hcl.EvalContext) map[string]cty.Value {
+	inputs := make(map[string]cty.Value)
+	attr, ok := block.Body.Attributes["inputs"]
+	if !ok {
+		return inputs
+	}
+	object, ok := attr.Expr.(*hclsyntax.ObjectConsExpr)
+	if !ok {
+		return inputs
+	}
+	for _, item := range object.Items {
+		key, diags := item.KeyExpr.Value(nil)
+		if diags.HasErrors() || key.Type() != cty.String {
+			continue
+		}
+		if value, diags := item.ValueExpr.Value(ctx); !diags.HasErrors() && value.IsWhollyKnown() {
+			inputs[key.AsString()] = value
+		}
+	}
+	return inputs
+}
+
+// parseStackComponents scans the module of every component of stack, with
+// the resources addressed within the component, e.g.
+// component.network.aws_vpc.main. Components with a remote source cannot be
+// scanned and are reported as warnings.
+func parseStackComponents(ctx context.Context, stack *terraformStack) *ParseResult {
+	result := &ParseResult{
+		Resources:   []Resource{},
+		DataSources: []Resource{},
+	}
+	for _, diag := range stack.Diagnostics {
+		result.Diagnostics = append(result.Diagnostics, diag)
+		result.Warnings = append(result.Warnings, diag.String())
+	}
+	if len(stack.Components) == 0 {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("%s: the Stack declares no components", stack.Dir))
+	}
+
+	visited := make(map[string]bool)
+	for _, component := range stack.Components {
+		address := "component." + component.Name
+		if !isLocalModuleSource(component.Source) {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("%s:%d: %s: source %q is not a local path; its resources are not scanned",
+				component.File, component.Line, address, component.Source))
+			continue
+		}
+		result.Modules = append(result.Modules, component.Source)
+		result.ModuleCalls = append(result.ModuleCalls, ModuleCall{
+			Address: address,
+			Source:  component.Source,
+			Dir:     stack.Dir,
+		})
+		scanDir(ctx, filepath.Join(stack.Dir, component.Source), address+".", result, visited)
+	}
+	return result
+}
+
+// deploymentARNContext returns the ARN context of a deployment: base with
+// the account and region taken from the deployment's inputs. The account is
+// that of a role ARN input (role_arn or *_role_arn) or an account_id input;
+// the region is that of a region input, or of a regions input listing one
+// region. Anything else keeps base's value.
+func deploymentARNContext(base arnContext, inputs map[string]cty.Value) arnContext {
+	deploymentContext := base
+	names := make([]string, 0, len(inputs))
+	for name := range inputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		value := inputs[name]
+		switch {
+		case name == "role_arn" || strings.HasSuffix(name, "_role_arn"):
+			if value.Type() != cty.String {
+				continue
+			}
+			if parts := strings.SplitN(value.AsString(), ":", 6); len(parts) == 6 && accountIDPattern.MatchString(parts[4]) {
+				deploymentContext.Account = parts[4]
+			}
+		case name == "account_id" || name == "aws_account_id":
+			if value.Type() == cty.String && accountIDPattern.MatchString(value.AsString()) {
+				deploymentContext.Account = value.AsString()
+			}
+		case name == "region" || name == "aws_region":
+			if value.Type() == cty.String {
+				deploymentContext.Region = value.AsString()
+			}
+		case name == "regions":
+			if regions := stringValues(value); len(regions) == 1 {
+				deploymentContext.Region = regions[0]
+			}
+		}
+	}
+	return deploymentContext
+}
+
+// stringValues returns the strings of a known list, set or tuple value.
+func stringValues(value cty.Value) []string {
+	if value.IsNull() || !value.CanIterateElements() {
+		return nil
+	}
+	var out []string
+	for it := value.ElementIterator(); it.Next(); {
+		_, element := it.Element()
+		if element.Type() == cty.String {
+			out = append(out, element.AsString())
+		}
+	}
+	return out
+}
+
+// runTerraformStack writes one policy per deployment of the Stack in dir,
+// naming the --output, --report, --export-scan and --attest files after the
+// deployment like those of several --path roots, or the policy by
+// --output-template. Every deployment runs the same components, so they
+// share the scan; least-privilege ARNs get the account and region of each
+// deployment's inputs unless --template-vars is given. A Stack without
+// deployments gets one policy.
+func runTerraformStack(ctx context.Context, dir string, format OutputFormat) error {
+	if permissionsDB == nil {
+		if err := loadPermissionsDB(); err != nil {
+			return &DBError{Source: "the permissions DB", Err: err}
+		}
+	}
+	stack, err := parseTerraformStack(dir)
+	if err != nil {
+		return &ParseError{Source: dir, Err: err}
+	}
+	result := parseStackComponents(ctx, stack)
+	parseProgress.finish()
+	exitIfCancelled(ctx, result, dir)
+	statusf("Terraform Stack: %d component(s), %d deployment(s)\n", len(stack.Components), len(stack.Deployments))
+
+	if len(stack.Deployments) == 0 {
+		exitIfDenied(scanResult(ctx, result, dir, format))
+		return nil
+	}
+
+	var templated []string
+	if outputTemplate != nil {
+		splits := make([]artifactFields, len(stack.Deployments))
+		for i, deployment := range stack.Deployments {
+			splits[i] = artifactFields{Stack: rootArtifactName(dir), Deployment: deployment.Name}
+		}
+		if templated, err = templateOutputs(splits, format); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+
+	denied := false
+	base := defaultARNContext
+	output, report, export, attest, workloads := outputFlag, reportFlag, exportScanFlag, attestFlag, workloadPoliciesFlag
+	for i, deployment := range stack.Deployments {
+		statusf("==> deployment.%s\n", deployment.Name)
+		outputFlag = rootArtifactFile(output, deployment.Name)
+		if templated != nil {
+			outputFlag = templated[i]
+			if err := ensureOutputDir(outputFlag); err != nil {
+				return &OutputError{Path: outputFlag, Err: err}
+			}
+		}
+		reportFlag = rootArtifactFile(report, deployment.Name)
+		exportScanFlag = rootArtifactFile(export, deployment.Name)
+		attestFlag = rootArtifactFile(attest, deployment.Name)
+		workloadPoliciesFlag = rootArtifactFile(workloads, deployment.Name)
+		if templateVarsFlag == "" {
+			defaultARNContext = deploymentARNContext(base, deployment.Inputs)
+		}
+		if scanResult(ctx, result, dir+" (deployment "+deployment.Name+")", format) {
+			denied = true
+		}
+		statusf("\n")
+	}
+	defaultARNContext = base
+	exitIfDenied(denied)
+	return nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestParseTerraformStack(t *testing.T) {
+	dir := "test-fixtures/tfstack"
+	if !isTerraformStack(dir) || isTerraformStack("test-fixtures/simple") {
+		t.Fatalf("isTerraformStack misdetects the fixtures")
+	}
+
+	stack, err := parseTerraformStack(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(stack.Components) != 3 || stack.Components[0].Name != "app" || stack.Components[1].Source != "app.terraform.io/example/dns/aws" {
+		t.Errorf("Unexpected components: %+v", stack.Components)
+	}
+	if len(stack.Deployments) != 2 || stack.Deployments[0].Name != "production" {
+		t.Fatalf("Unexpected deployments: %+v", stack.Deployments)
+	}
+	production := stack.Deployments[0].Inputs
+	if role, ok := production["role_arn"]; !ok || role.AsString() != "arn:aws:iam::222222222222:role/stacks-deploy" {
+		t.Errorf("Expected role_arn resolved through the local, got %v", production)
+	}
+	if _, ok := production["identity_token"]; ok {
+		t.Errorf("Inputs only known to HCP Terraform should be left out: %v", production)
+	}
+}
+
+func TestParseStackComponents(t *testing.T) {
+	if err := loadPermissionsDB(); err != nil {
+		t.Fatalf("Error loading permissions DB: %v", err)
+	}
+	result, err := parseTerraformFiles("test-fixtures/tfstack")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var addresses []string
+	for _, resource := range result.Resources {
+		addresses = append(addresses, resource.Address)
+	}
+	want := []string{"component.app.aws_security_group.app", "component.app.aws_sqs_queue.jobs", "component.network.aws_vpc.main"}
+	sort.Strings(addresses)
+	if strings.Join(addresses, ",") != strings.Join(want, ",") {
+		t.Errorf("Expected %v, got %v", want, addresses)
+	}
+	if len(result.Warnings) != 1 || !strings.Contains(result.Warnings[0], "component.dns") {
+		t.Errorf("Expected a warning for the remote component, got %v", result.Warnings)
+	}
+}
+
+func TestDeploymentARNContext(t *testing.T) {
+	base := arnContext{Partition: "aws", Region: "*", Account: "*"}
+
+	got := deploymentARNContext(base, map[string]cty.Value{
+		"deploy_role_arn": cty.StringVal("arn:aws:iam::123456789012:role/deploy"),
+		"regions":         cty.ListVal([]cty.Value{cty.StringVal("eu-central-1")}),
+	})
+	if got.Account != "123456789012" || got.Region != "eu-central-1" {
+		t.Errorf("Unexpected context: %+v", got)
+	}
+
+	got = deploymentARNContext(base, map[string]cty.Value{
+		"account_id": cty.StringVal("210987654321"),
+		"regions":    cty.ListVal([]cty.Value{cty.StringVal("us-east-1"), cty.StringVal("us-west-2")}),
+		"role_arn":   cty.StringVal("not-an-arn"),
+	})
+	if got.Account != "210987654321" || got.Region != "*" {
+		t.Errorf("Several regions or an invalid ARN should not narrow the context: %+v", got)
+	}
+}
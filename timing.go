@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	timingFlag     bool
+	noProgressFlag bool
+)
+
+// Phases reported by --timing, in the order they run.
+const (
+	PhaseWalk   = "walk"
+	PhaseParse  = "parse"
+	PhaseLookup = "db lookups"
+	PhaseFormat = "format"
+)
+
+var timingPhases = []string{PhaseWalk, PhaseParse, PhaseLookup, PhaseFormat}
+
+// phaseTimings accumulates the time spent in each phase of a run. Phases may
+// be entered several times, e.g. once per scanned module directory, and from
+// several goroutines when --path roots are scanned concurrently, in which
+// case their durations add up.
+type phaseTimings struct {
+	mu        sync.Mutex
+	start     time.Time
+	durations map[string]time.Duration
+}
+
+var timings = newPhaseTimings()
+
+func newPhaseTimings() *phaseTimings {
+	return &phaseTimings{start: time.Now(), durations: make(map[string]time.Duration)}
+}
+
+// track starts timing phase and returns the function that stops it:
+//
+//	defer timings.track(PhaseParse)()
+func (t *phaseTimings) track(phase string) func() {
+	start := time.Now()
+	return func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		t.durations[phase] += time.Since(start)
+	}
+}
+
+// print writes the time spent in each phase and in the whole run.
+func (t *phaseTimings) print(w io.Writer) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	total := time.Since(t.start)
+	fmt.Fprintf(w, "\nTiming:\n")
+	for _, phase := range timingPhases {
+		d := t.durations[phase]
+		percent := 0.0
+		if total > 0 {
+			percent = float64(d) / float64(total) * 100
+		}
+		fmt.Fprintf(w, "  %-11s %10s %5.1f%%\n", phase+":", d.Round(time.Microsecond), percent)
+	}
+	fmt.Fprintf(w, "  %-11s %10s\n", "total:", total.Round(time.Microsecond))
+}
+
+// progressMinFiles is the number of files a scan must reach before the
+// progress bar is drawn; small scans finish before it would be useful.
+const progressMinFiles = 50
+
+// progressBar draws "files parsed / total" on a single, rewritten line.
+// The total grows as local modules are discovered.
+type progressBar struct {
+	mu       sync.Mutex
+	out      io.Writer
+	enabled  bool
+	total    int
+	done     int
+	drawn    bool
+	lastDraw time.Time
+}
+
+var parseProgress = &progressBar{out: os.Stderr}
+
+// enableProgress turns the parse progress bar on when stderr is a terminal
+// and neither --no-progress nor --quiet was given.
+func enableProgress() {
+	parseProgress.enabled = !noProgressFlag && !quietFlag && isTerminal(os.Stderr)
+}
+
+// isTerminal reports whether f is a character device such as a terminal.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func (p *progressBar) addTotal(n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.total += n
+	p.draw(false)
+}
+
+func (p *progressBar) increment() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done++
+	p.draw(p.done == p.total)
+}
+
+// draw redraws the bar at most every 100ms unless force is set. The caller
+// holds p.mu.
+func (p *progressBar) draw(force bool) {
+	if !p.enabled || p.total < progressMinFiles {
+		return
+	}
+	if !force && time.Since(p.lastDraw) < 100*time.Millisecond {
+		return
+	}
+	p.lastDraw = time.Now()
+	p.drawn = true
+
+	const width = 30
+	filled := width * p.done / p.total
+	fmt.Fprintf(p.out, "\rParsing [%s%s] %d/%d files",
+		strings.Repeat("=", filled), strings.Repeat(" ", width-filled), p.done, p.total)
+}
+
+// finish clears the bar so the summary starts on a clean line.
+func (p *progressBar) finish() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.drawn {
+		fmt.Fprintf(p.out, "\r%s\r", strings.Repeat(" ", 60))
+		p.drawn = false
+	}
+}
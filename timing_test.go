@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPhaseTimings(t *testing.T) {
+	timer := newPhaseTimings()
+	stop := timer.track(PhaseParse)
+	time.Sleep(2 * time.Millisecond)
+	stop()
+	timer.track(PhaseParse)()
+
+	if timer.durations[PhaseParse] < 2*time.Millisecond {
+		t.Errorf("Expected parse time to accumulate, got %s", timer.durations[PhaseParse])
+	}
+
+	var out bytes.Buffer
+	timer.print(&out)
+	for _, want := range []string{"Timing:", "walk:", "parse:", "db lookups:", "format:", "total:"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected %q in timing output:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestProgressBar(t *testing.T) {
+	var out bytes.Buffer
+	bar := &progressBar{out: &out, enabled: true}
+
+	bar.addTotal(10)
+	for i := 0; i < 10; i++ {
+		bar.increment()
+	}
+	if out.Len() != 0 {
+		t.Errorf("Small scans should not draw a progress bar, got %q", out.String())
+	}
+
+	bar.addTotal(progressMinFiles)
+	for bar.done < bar.total {
+		bar.increment()
+	}
+	if !strings.Contains(out.String(), "Parsing [") || !strings.Contains(out.String(), "60/60 files") {
+		t.Errorf("Expected a completed progress bar, got %q", out.String())
+	}
+
+	out.Reset()
+	bar.finish()
+	if !strings.HasPrefix(out.String(), "\r") || strings.TrimSpace(out.String()) != "" {
+		t.Errorf("Expected finish to clear the line, got %q", out.String())
+	}
+
+	out.Reset()
+	disabled := &progressBar{out: &out}
+	disabled.addTotal(100)
+	disabled.increment()
+	disabled.finish()
+	if out.Len() != 0 {
+		t.Errorf("A disabled progress bar should not draw, got %q", out.String())
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+// configFileSuffixes are the configuration files of a module: Terraform's,
+// and OpenTofu's .tofu files, each in native and JSON syntax.
+var configFileSuffixes = []string{".tf", ".tf.json", ".tofu", ".tofu.json"}
+
+// isConfigFile reports whether name is a Terraform or OpenTofu
+// configuration file.
+func isConfigFile(name string) bool {
+	for _, suffix := range configFileSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// isJSONConfigFile reports whether name is a configuration file in JSON
+// syntax.
+func isJSONConfigFile(name string) bool {
+	return strings.HasSuffix(name, ".tf.json") || strings.HasSuffix(name, ".tofu.json")
+}
+
+// configFileStem is name without its configuration file suffix, e.g. main
+// for main.tofu.json.
+func configFileStem(name string) string {
+	for _, suffix := range []string{".tf.json", ".tofu.json", ".tf", ".tofu"} {
+		if strings.HasSuffix(name, suffix) {
+			return strings.TrimSuffix(name, suffix)
+		}
+	}
+	return name
+}
+
+// withoutShadowedFiles drops the .tf and .tf.json files of paths that
+// OpenTofu ignores because a .tofu or .tofu.json file of the same name sits
+// in the same directory, so a module can carry OpenTofu-only variants of
+// its files next to the Terraform ones.
+func withoutShadowedFiles(paths []string) []string {
+	tofu := make(map[string]bool)
+	for _, path := range paths {
+		if strings.HasSuffix(path, ".tofu") {
+			tofu[strings.TrimSuffix(path, ".tofu")+".tf"] = true
+		} else if strings.HasSuffix(path, ".tofu.json") {
+			tofu[strings.TrimSuffix(path, ".tofu.json")+".tf.json"] = true
+		}
+	}
+	if len(tofu) == 0 {
+		return paths
+	}
+	kept := make([]string, 0, len(paths))
+	for _, path := range paths {
+		if !tofu[path] {
+			kept = append(kept, path)
+		}
+	}
+	return kept
+}
+
+// StateEncryptionKey is an aws_kms key provider of OpenTofu state and plan
+// encryption: reading and writing encrypted state calls KMS with the key.
+type StateEncryptionKey struct {
+	Name     string `json:"name"`
+	KMSKeyID string `json:"kms_key_id,omitempty"` // "" when not a literal
+	Region   string `json:"region,omitempty"`
+}
+
+// extractStateEncryption returns the aws_kms key providers of the
+// encryption block of a terraform block.
+func extractStateEncryption(block *hclsyntax.Block) []StateEncryptionKey {
+	var keys []StateEncryptionKey
+	for _, encryption := range block.Body.Blocks {
+		if encryption.Type != "encryption" {
+			continue
+		}
+		for _, provider := range encryption.Body.Blocks {
+			if provider.Type != "key_provider" || len(provider.Labels) != 2 || provider.Labels[0] != "aws_kms" {
+				continue
+			}
+			settings := backendAttributes(provider.Body, "")
+			keys = append(keys, StateEncryptionKey{
+				Name:     provider.Labels[1],
+				KMSKeyID: settings["kms_key_id"],
+				Region:   settings["region"],
+			})
+		}
+	}
+	return keys
+}
+
+// stateEncryptionActions are the KMS calls of the aws_kms key provider:
+// GenerateDataKey when state is written and Decrypt when it is read.
+var stateEncryptionActions = []string{"kms:Decrypt", "kms:GenerateDataKey"}
+
+// stateEncryptionARNs returns the ARNs of the state encryption keys of
+// result, or nil when one of them is not known by ARN or key ID. Aliases are
+// resolved by KMS and authorized on the key, so they cannot be scoped.
+func stateEncryptionARNs(result *ParseResult) []string {
+	var arns []string
+	for _, key := range result.StateEncryption {
+		arn := kmsKeyARN(key.KMSKeyID, key.Region)
+		if arn == "" {
+			return nil
+		}
+		arns = append(arns, arn)
+	}
+	return arns
+}
+
+// describeStateEncryption names the key providers in the run summary.
+func describeStateEncryption(keys []StateEncryptionKey) string {
+	names := make([]string, 0, len(keys))
+	for _, key := range keys {
+		name := "aws_kms." + key.Name
+		if key.KMSKeyID != "" {
+			name += " (" + key.KMSKeyID + ")"
+		}
+		names = append(names, name)
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestIsConfigFile(t *testing.T) {
+	tests := map[string]bool{
+		"main.tf":          true,
+		"main.tofu":        true,
+		"main.tf.json":     true,
+		"main.tofu.json":   true,
+		"prod.tfbackend":   false,
+		"terraform.tfvars": false,
+		"package.json":     false,
+		"main.tofu.bak":    false,
+	}
+	for name, want := range tests {
+		if got := isConfigFile(name); got != want {
+			t.Errorf("isConfigFile(%s) = %v, want %v", name, got, want)
+		}
+	}
+	for name, want := range map[string]bool{"override.tofu": true, "web_override.tf.json": true, "overrides.tf": false} {
+		if got := isOverrideFile("stack/" + name); got != want {
+			t.Errorf("isOverrideFile(%s) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestWithoutShadowedFiles(t *testing.T) {
+	paths := []string{"a/main.tf", "a/main.tofu", "a/vars.tf.json", "a/vars.tofu.json", "a/net.tf", "b/main.tf"}
+	got := withoutShadowedFiles(paths)
+	want := []string{"a/main.tofu", "a/vars.tofu.json", "a/net.tf", "b/main.tf"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("withoutShadowedFiles = %v, want %v", got, want)
+	}
+}
+
+func TestOpenTofuFixture(t *testing.T) {
+	if err := loadPermissionsDB(); err != nil {
+		t.Fatalf("Error loading permissions DB: %v", err)
+	}
+	result, err := parseTerraformFiles("test-fixtures/opentofu")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(result.Warnings) > 0 {
+		t.Errorf("Expected provider for_each and encryption to parse cleanly, got %v", result.Warnings)
+	}
+
+	var addresses []string
+	for _, resource := range result.Resources {
+		addresses = append(addresses, resourceAddress(resource))
+	}
+	if containsString(addresses, "aws_sqs_queue.jobs") {
+		t.Errorf("main.tofu should shadow main.tf, got %v", addresses)
+	}
+	for _, want := range []string{"aws_sns_topic.jobs", "aws_s3_bucket.logs", "aws_dynamodb_table.users"} {
+		if !containsString(addresses, want) {
+			t.Errorf("Expected %s, got %v", want, addresses)
+		}
+	}
+
+	if len(result.StateEncryption) != 1 || result.StateEncryption[0].Name != "main" || result.StateEncryption[0].Region != "eu-west-1" {
+		t.Fatalf("Expected the aws_kms key provider, got %+v", result.StateEncryption)
+	}
+	want := "arn:aws:kms:eu-west-1:*:key/1234abcd-12ab-34cd-56ef-1234567890ab"
+	if arns := stateEncryptionARNs(result); len(arns) != 1 || arns[0] != want {
+		t.Errorf("stateEncryptionARNs = %v, want %s", arns, want)
+	}
+
+	// Without resources of their own using KMS, the state key actions are
+	// scoped to the key
+	state := &ParseResult{Backend: result.Backend, StateEncryption: result.StateEncryption}
+	var found bool
+	for _, statement := range buildIAMPolicy(state, true, true).Statement {
+		if containsString(statement.Action.([]string), "kms:GenerateDataKey") {
+			found = true
+			if statement.Resource != want || !containsString(statement.Action.([]string), "kms:Decrypt") {
+				t.Errorf("Expected kms:Decrypt and kms:GenerateDataKey on %s, got %+v", want, statement)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("Expected the state key actions with --include-state-backend")
+	}
+	if actions := allowedActions(buildIAMPolicy(state, false, true)); containsString(actions, "kms:GenerateDataKey") {
+		t.Errorf("Expected no state key actions without --include-state-backend, got %v", actions)
+	}
+}
+
+func TestStateEncryptionARNs(t *testing.T) {
+	tests := []struct {
+		keys []StateEncryptionKey
+		want []string
+	}{
+		{[]StateEncryptionKey{{KMSKeyID: "arn:aws:kms:us-east-1:111122223333:key/abcd"}}, []string{"arn:aws:kms:us-east-1:111122223333:key/abcd"}},
+		{[]StateEncryptionKey{{KMSKeyID: "abcd"}}, []string{"arn:aws:kms:*:*:key/abcd"}},
+		// Aliases and unknown keys cannot be scoped
+		{[]StateEncryptionKey{{KMSKeyID: "alias/state"}}, nil},
+		{[]StateEncryptionKey{{KMSKeyID: "abcd", Region: "eu-west-1"}, {}}, nil},
+	}
+	for _, tt := range tests {
+		got := stateEncryptionARNs(&ParseResult{StateEncryption: tt.keys})
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("stateEncryptionARNs(%+v) = %v, want %v", tt.keys, got, tt.want)
+		}
+	}
+}
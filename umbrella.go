@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// downstreamSidSuffix ends the Sid of the statement granting what an
+// umbrella resource's service provisions on the caller's behalf.
+const downstreamSidSuffix = "Downstream"
+
+// Umbrella resources, such as an Elastic Beanstalk environment, have their
+// service create further infrastructure (instances, load balancers, stacks)
+// with the credentials of the caller. Their entries list those actions in
+// expands_to; they are granted in a statement of their own per type, named
+// after it (AwsElasticBeanstalkEnvironmentDownstream), on "*" since the
+// service names what it creates.
+
+// umbrellaTypes returns the types of the resources in result whose entries
+// expand to downstream actions, sorted, with the addresses of their
+// resources.
+func umbrellaTypes(result *ParseResult) ([]string, map[string][]string) {
+	addresses := make(map[string][]string)
+	for _, resource := range result.Resources {
+		if needsAWSPermissions(resource) && len(permissionsDB[resource.Type].ExpandsTo) > 0 {
+			addresses[resource.Type] = append(addresses[resource.Type], resourceAddress(resource))
+		}
+	}
+	types := make([]string, 0, len(addresses))
+	for resourceType := range addresses {
+		types = append(types, resourceType)
+	}
+	sort.Strings(types)
+	return types, addresses
+}
+
+// downstreamStatements returns a statement per umbrella type in result
+// granting the actions its entry expands to, followed by those of the
+// CloudFormation stacks (see stackDownstreamStatements).
+func downstreamStatements(result *ParseResult) []IAMStatement {
+	types, _ := umbrellaTypes(result)
+	var statements []IAMStatement
+	for _, resourceType := range types {
+		actions := append([]string{}, permissionsDB[resourceType].ExpandsTo...)
+		sort.Strings(actions)
+		statements = append(statements, IAMStatement{
+			Sid:      statementSid(resourceType, downstreamSidSuffix),
+			Effect:   "Allow",
+			Action:   actions,
+			Resource: "*",
+		})
+	}
+	return append(statements, stackDownstreamStatements(result)...)
+}
+
+// printUmbrellaResources lists the umbrella resources in the run summary, so
+// reviewers know where the downstream statements come from.
+func printUmbrellaResources(result *ParseResult) {
+	types, addresses := umbrellaTypes(result)
+	if len(types) == 0 {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "  Umbrella resources (downstream permissions in *%s statements):\n", downstreamSidSuffix)
+	for _, resourceType := range types {
+		fmt.Fprintf(os.Stderr, "    %s: %d downstream actions for %s\n", resourceType,
+			len(permissionsDB[resourceType].ExpandsTo), strings.Join(addresses[resourceType], ", "))
+	}
+}
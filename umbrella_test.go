@@ -0,0 +1,83 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDownstreamStatements(t *testing.T) {
+	if err := loadPermissionsDB(); err != nil {
+		t.Fatalf("Error loading permissions DB: %v", err)
+	}
+	source := `resource "aws_elastic_beanstalk_environment" "web" {
+  name        = "web"
+  application = "app"
+}
+
+resource "aws_elastic_beanstalk_environment" "worker" {
+  name        = "worker"
+  application = "app"
+}
+
+resource "aws_sqs_queue" "jobs" {
+  name = "jobs"
+}
+`
+	result, err := parseTerraformSource([]byte(source), "main.tf")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for _, leastPrivilege := range []bool{false, true} {
+		policy := buildIAMPolicy(result, false, leastPrivilege)
+		var downstream []IAMStatement
+		for _, statement := range policy.Statement {
+			if strings.HasSuffix(statement.Sid, downstreamSidSuffix) {
+				downstream = append(downstream, statement)
+			}
+		}
+		if len(downstream) != 1 || downstream[0].Sid != "AwsElasticBeanstalkEnvironmentDownstream" || downstream[0].Resource != "*" {
+			t.Fatalf("Expected one downstream statement for the environment type (least privilege %v), got %+v", leastPrivilege, downstream)
+		}
+		actions := toStringSlice(downstream[0].Action)
+		for _, action := range []string{"autoscaling:CreateAutoScalingGroup", "ec2:RunInstances", "elasticloadbalancing:CreateLoadBalancer", "cloudformation:CreateStack"} {
+			if !containsString(actions, action) {
+				t.Errorf("Expected %s downstream, got %v", action, actions)
+			}
+		}
+		if containsString(actions, "sqs:CreateQueue") {
+			t.Errorf("Expected only the environment's downstream actions, got %v", actions)
+		}
+	}
+
+	resourcePolicy := buildResourcePolicy(result, false)
+	found := false
+	for _, statement := range resourcePolicy.Statement {
+		found = found || statement.Sid == "AwsElasticBeanstalkEnvironmentDownstream"
+	}
+	if !found {
+		t.Errorf("Expected the downstream statement with --group-by resource, got %+v", resourcePolicy.Statement)
+	}
+
+	defer func(include bool) { includeStateBackendFlag = include }(includeStateBackendFlag)
+	includeStateBackendFlag = false
+	annotations := annotateStatements(IAMPolicy{Statement: downstreamStatements(result)}, result)
+	if len(annotations) != 1 || len(annotations[0].RequiredBy) != 2 || !strings.HasPrefix(annotations[0].RequiredBy[0], "aws_elastic_beanstalk_environment.web") {
+		t.Errorf("Expected the downstream statement to be annotated with both environments, got %+v", annotations)
+	}
+}
+
+func TestUmbrellaEntries(t *testing.T) {
+	if err := loadPermissionsDB(); err != nil {
+		t.Fatalf("Error loading permissions DB: %v", err)
+	}
+	for _, resourceType := range []string{"aws_elastic_beanstalk_environment", "aws_amplify_app", "aws_serverlessapplicationrepository_cloudformation_stack"} {
+		entry, ok := permissionsDB[resourceType]
+		if !ok || len(entry.ExpandsTo) == 0 {
+			t.Errorf("Expected %s to expand to downstream actions, got %+v", resourceType, entry)
+		}
+	}
+	if len(permissionsDB["aws_sqs_queue"].ExpandsTo) != 0 {
+		t.Error("Expected aws_sqs_queue not to be an umbrella resource")
+	}
+}
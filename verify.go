@@ -0,0 +1,402 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/acm"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/ecr"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/smithy-go"
+	"github.com/zclconf/go-cty/cty"
+)
+
+var verifyDataSourcesFlag bool
+
+func init() {
+	rootCmd.Flags().BoolVar(&verifyDataSourcesFlag, "verify-data-sources", false, "Call AWS with the current credentials to check that every data source can be read")
+}
+
+// exitDataSourceDenied is returned by --verify-data-sources when at least one
+// data source read was denied.
+const exitDataSourceDenied = 14
+
+// Outcomes of a data source verification.
+const (
+	VerifyAllowed     = "allowed"
+	VerifyDenied      = "denied"
+	VerifyNotFound    = "not-found"
+	VerifySkipped     = "skipped"
+	VerifyLocal       = "local"
+	VerifyUnsupported = "unsupported"
+	VerifyError       = "error"
+)
+
+// DataSourceVerification is the outcome of the read call made for one data
+// source.
+type DataSourceVerification struct {
+	Address string
+	Action  string
+	Status  string
+	Message string
+}
+
+// awsClients holds the service clients used to exercise data source reads.
+type awsClients struct {
+	acm            *acm.Client
+	ec2            *ec2.Client
+	ecr            *ecr.Client
+	iam            *iam.Client
+	kms            *kms.Client
+	route53        *route53.Client
+	s3             *s3.Client
+	secretsmanager *secretsmanager.Client
+	ssm            *ssm.Client
+	sts            *sts.Client
+}
+
+func newAWSClients(cfg aws.Config) *awsClients {
+	return &awsClients{
+		acm:            acm.NewFromConfig(cfg),
+		ec2:            ec2.NewFromConfig(cfg),
+		ecr:            ecr.NewFromConfig(cfg),
+		iam:            iam.NewFromConfig(cfg),
+		kms:            kms.NewFromConfig(cfg),
+		route53:        route53.NewFromConfig(cfg),
+		s3:             s3.NewFromConfig(cfg),
+		secretsmanager: secretsmanager.NewFromConfig(cfg),
+		ssm:            ssm.NewFromConfig(cfg),
+		sts:            sts.NewFromConfig(cfg),
+	}
+}
+
+// errUnknownArgument is returned by a check when a required argument is not
+// known until apply time.
+var errUnknownArgument = errors.New("argument not known until apply")
+
+// dataSourceCheck performs the read a data source makes during plan. Action
+// is the IAM action exercised, recorded for the report.
+type dataSourceCheck struct {
+	Action string
+	Call   func(ctx context.Context, clients *awsClients, ds Resource) error
+}
+
+// localDataSources are computed by the provider without calling AWS.
+var localDataSources = map[string]bool{
+	"aws_arn":                 true,
+	"aws_default_tags":        true,
+	"aws_iam_policy_document": true,
+	"aws_partition":           true,
+	"aws_region":              true,
+	"aws_service_principal":   true,
+}
+
+// dataSourceChecks maps data source types to the call made to verify them.
+// Filters given as nested blocks are not applied; EC2 Describe actions do not
+// support resource-level permissions, so the unfiltered call is authorized
+// exactly when the filtered one is.
+var dataSourceChecks = map[string]dataSourceCheck{
+	"aws_caller_identity": {"sts:GetCallerIdentity", func(ctx context.Context, c *awsClients, ds Resource) error {
+		_, err := c.sts.GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+		return err
+	}},
+	"aws_availability_zones": {"ec2:DescribeAvailabilityZones", func(ctx context.Context, c *awsClients, ds Resource) error {
+		_, err := c.ec2.DescribeAvailabilityZones(ctx, &ec2.DescribeAvailabilityZonesInput{})
+		return err
+	}},
+	"aws_vpc":  {"ec2:DescribeVpcs", describeVpcs},
+	"aws_vpcs": {"ec2:DescribeVpcs", describeVpcs},
+	"aws_subnet": {"ec2:DescribeSubnets", func(ctx context.Context, c *awsClients, ds Resource) error {
+		input := &ec2.DescribeSubnetsInput{}
+		if id, ok := stringAttribute(ds, "id"); ok {
+			input.SubnetIds = []string{id}
+		} else {
+			input.MaxResults = aws.Int32(5)
+		}
+		_, err := c.ec2.DescribeSubnets(ctx, input)
+		return err
+	}},
+	"aws_subnets": {"ec2:DescribeSubnets", func(ctx context.Context, c *awsClients, ds Resource) error {
+		_, err := c.ec2.DescribeSubnets(ctx, &ec2.DescribeSubnetsInput{MaxResults: aws.Int32(5)})
+		return err
+	}},
+	"aws_security_group": {"ec2:DescribeSecurityGroups", func(ctx context.Context, c *awsClients, ds Resource) error {
+		input := &ec2.DescribeSecurityGroupsInput{}
+		if id, ok := stringAttribute(ds, "id"); ok {
+			input.GroupIds = []string{id}
+		} else if name, ok := stringAttribute(ds, "name"); ok {
+			input.Filters = []ec2types.Filter{{Name: aws.String("group-name"), Values: []string{name}}}
+		} else {
+			input.MaxResults = aws.Int32(5)
+		}
+		_, err := c.ec2.DescribeSecurityGroups(ctx, input)
+		return err
+	}},
+	"aws_ami": {"ec2:DescribeImages", func(ctx context.Context, c *awsClients, ds Resource) error {
+		owners := stringListAttribute(ds, "owners")
+		if len(owners) == 0 {
+			owners = []string{"self"}
+		}
+		_, err := c.ec2.DescribeImages(ctx, &ec2.DescribeImagesInput{Owners: owners, MaxResults: aws.Int32(5)})
+		return err
+	}},
+	"aws_ssm_parameter": {"ssm:GetParameter", func(ctx context.Context, c *awsClients, ds Resource) error {
+		name, err := requiredString(ds, "name")
+		if err != nil {
+			return err
+		}
+		decrypt := true
+		if value, ok := ds.Attributes["with_decryption"]; ok && value.IsKnown() && !value.IsNull() && value.Type() == cty.Bool {
+			decrypt = value.True()
+		}
+		_, err = c.ssm.GetParameter(ctx, &ssm.GetParameterInput{Name: aws.String(name), WithDecryption: aws.Bool(decrypt)})
+		return err
+	}},
+	"aws_iam_role": {"iam:GetRole", func(ctx context.Context, c *awsClients, ds Resource) error {
+		name, err := requiredString(ds, "name")
+		if err != nil {
+			return err
+		}
+		_, err = c.iam.GetRole(ctx, &iam.GetRoleInput{RoleName: aws.String(name)})
+		return err
+	}},
+	"aws_iam_user": {"iam:GetUser", func(ctx context.Context, c *awsClients, ds Resource) error {
+		name, err := requiredString(ds, "user_name")
+		if err != nil {
+			return err
+		}
+		_, err = c.iam.GetUser(ctx, &iam.GetUserInput{UserName: aws.String(name)})
+		return err
+	}},
+	"aws_iam_policy": {"iam:GetPolicy", func(ctx context.Context, c *awsClients, ds Resource) error {
+		arn, err := requiredString(ds, "arn")
+		if err != nil {
+			return err
+		}
+		_, err = c.iam.GetPolicy(ctx, &iam.GetPolicyInput{PolicyArn: aws.String(arn)})
+		return err
+	}},
+	"aws_s3_bucket": {"s3:ListBucket", func(ctx context.Context, c *awsClients, ds Resource) error {
+		bucket, err := requiredString(ds, "bucket")
+		if err != nil {
+			return err
+		}
+		_, err = c.s3.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String(bucket)})
+		return err
+	}},
+	"aws_kms_key": {"kms:DescribeKey", func(ctx context.Context, c *awsClients, ds Resource) error {
+		keyID, err := requiredString(ds, "key_id")
+		if err != nil {
+			return err
+		}
+		_, err = c.kms.DescribeKey(ctx, &kms.DescribeKeyInput{KeyId: aws.String(keyID)})
+		return err
+	}},
+	"aws_kms_alias": {"kms:ListAliases", func(ctx context.Context, c *awsClients, ds Resource) error {
+		_, err := c.kms.ListAliases(ctx, &kms.ListAliasesInput{Limit: aws.Int32(1)})
+		return err
+	}},
+	"aws_secretsmanager_secret": {"secretsmanager:DescribeSecret", func(ctx context.Context, c *awsClients, ds Resource) error {
+		id, ok := stringAttribute(ds, "arn")
+		if !ok {
+			var err error
+			if id, err = requiredString(ds, "name"); err != nil {
+				return err
+			}
+		}
+		_, err := c.secretsmanager.DescribeSecret(ctx, &secretsmanager.DescribeSecretInput{SecretId: aws.String(id)})
+		return err
+	}},
+	"aws_secretsmanager_secret_version": {"secretsmanager:GetSecretValue", func(ctx context.Context, c *awsClients, ds Resource) error {
+		id, err := requiredString(ds, "secret_id")
+		if err != nil {
+			return err
+		}
+		_, err = c.secretsmanager.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{SecretId: aws.String(id)})
+		return err
+	}},
+	"aws_route53_zone": {"route53:GetHostedZone", func(ctx context.Context, c *awsClients, ds Resource) error {
+		if zoneID, ok := stringAttribute(ds, "zone_id"); ok {
+			_, err := c.route53.GetHostedZone(ctx, &route53.GetHostedZoneInput{Id: aws.String(zoneID)})
+			return err
+		}
+		name, err := requiredString(ds, "name")
+		if err != nil {
+			return err
+		}
+		_, err = c.route53.ListHostedZonesByName(ctx, &route53.ListHostedZonesByNameInput{DNSName: aws.String(name), MaxItems: aws.Int32(1)})
+		return err
+	}},
+	"aws_ecr_repository": {"ecr:DescribeRepositories", func(ctx context.Context, c *awsClients, ds Resource) error {
+		name, err := requiredString(ds, "name")
+		if err != nil {
+			return err
+		}
+		_, err = c.ecr.DescribeRepositories(ctx, &ecr.DescribeRepositoriesInput{RepositoryNames: []string{name}})
+		return err
+	}},
+	"aws_acm_certificate": {"acm:ListCertificates", func(ctx context.Context, c *awsClients, ds Resource) error {
+		_, err := c.acm.ListCertificates(ctx, &acm.ListCertificatesInput{MaxItems: aws.Int32(1)})
+		return err
+	}},
+}
+
+func describeVpcs(ctx context.Context, c *awsClients, ds Resource) error {
+	input := &ec2.DescribeVpcsInput{}
+	if id, ok := stringAttribute(ds, "id"); ok {
+		input.VpcIds = []string{id}
+	} else {
+		input.MaxResults = aws.Int32(5)
+	}
+	_, err := c.ec2.DescribeVpcs(ctx, input)
+	return err
+}
+
+// stringAttribute returns a known, non-null string attribute.
+func stringAttribute(ds Resource, name string) (string, bool) {
+	value, ok := ds.Attributes[name]
+	if !ok || !value.IsKnown() || value.IsNull() || value.Type() != cty.String {
+		return "", false
+	}
+	return value.AsString(), true
+}
+
+// requiredString returns a string attribute or errUnknownArgument when the
+// value is missing or computed.
+func requiredString(ds Resource, name string) (string, error) {
+	if value, ok := stringAttribute(ds, name); ok {
+		return value, nil
+	}
+	return "", fmt.Errorf("%w: %s", errUnknownArgument, name)
+}
+
+// stringListAttribute returns the known strings of a list attribute.
+func stringListAttribute(ds Resource, name string) []string {
+	value, ok := ds.Attributes[name]
+	if !ok || !value.IsWhollyKnown() || value.IsNull() || !value.CanIterateElements() {
+		return nil
+	}
+	var out []string
+	for it := value.ElementIterator(); it.Next(); {
+		_, element := it.Element()
+		if element.Type() == cty.String {
+			out = append(out, element.AsString())
+		}
+	}
+	return out
+}
+
+// verifyDataSources makes the read call of every AWS data source in result
+// with the current credentials and reports which ones would fail.
+func verifyDataSources(ctx context.Context, clients *awsClients, result *ParseResult) []DataSourceVerification {
+	var verifications []DataSourceVerification
+	for _, ds := range result.DataSources {
+		if ds.Provider != "aws" || ds.Type == "" {
+			continue
+		}
+		verification := DataSourceVerification{Address: resourceAddress(ds)}
+
+		if localDataSources[ds.Type] {
+			verification.Status = VerifyLocal
+			verification.Message = "computed by the provider without calling AWS"
+			verifications = append(verifications, verification)
+			continue
+		}
+
+		check, ok := dataSourceChecks[ds.Type]
+		if !ok {
+			verification.Status = VerifyUnsupported
+			verification.Message = "no verification call is known for this data source"
+			verifications = append(verifications, verification)
+			continue
+		}
+		verification.Action = check.Action
+		verification.Status, verification.Message = classifyVerifyError(check.Call(ctx, clients, ds))
+		verifications = append(verifications, verification)
+	}
+
+	sort.SliceStable(verifications, func(i, j int) bool {
+		return verifications[i].Address < verifications[j].Address
+	})
+	return verifications
+}
+
+// classifyVerifyError maps the error of a verification call to a status.
+// AWS checks authorization before existence, so a not-found error means the
+// read itself was allowed.
+func classifyVerifyError(err error) (string, string) {
+	if err == nil {
+		return VerifyAllowed, ""
+	}
+	if errors.Is(err, errUnknownArgument) {
+		return VerifySkipped, err.Error()
+	}
+
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return VerifyError, err.Error()
+	}
+	code := apiErr.ErrorCode()
+	switch {
+	case code == "AccessDenied" || code == "AccessDeniedException" || code == "Forbidden" ||
+		strings.HasPrefix(code, "UnauthorizedOperation") || code == "AuthorizationError":
+		return VerifyDenied, apiErr.ErrorMessage()
+	case strings.Contains(code, "NotFound") || code == "NoSuchEntity" || code == "NoSuchBucket" ||
+		code == "RepositoryNotFoundException" || code == "NoSuchHostedZone":
+		return VerifyNotFound, apiErr.ErrorMessage()
+	}
+	return VerifyError, fmt.Sprintf("%s: %s", code, apiErr.ErrorMessage())
+}
+
+// runDataSourceVerification verifies the data sources in result and prints
+// the outcome to stderr. It returns whether any read was denied.
+func runDataSourceVerification(ctx context.Context, result *ParseResult) bool {
+	cfg, err := loadAWSConfig(ctx)
+	if err != nil {
+		exitWithError(err)
+	}
+
+	if _, err := cfg.Credentials.Retrieve(ctx); err != nil {
+		exitWithError(fmt.Errorf("--verify-data-sources needs AWS credentials: %w", err))
+	}
+
+	verifications := verifyDataSources(ctx, newAWSClients(cfg), result)
+
+	header := fmt.Sprintf("Data source verification (%d data sources, %d AWS API calls)", len(verifications), awsCallBudget.used.Load())
+	return printVerifications(header, verifications)
+}
+
+// printVerifications prints the outcome of read calls under a header to
+// stderr and returns whether any read was denied.
+func printVerifications(header string, verifications []DataSourceVerification) bool {
+	fmt.Fprintf(os.Stderr, "%s:\n", header)
+	denied := false
+	for _, v := range verifications {
+		line := fmt.Sprintf("  %-11s %s", v.Status, v.Address)
+		if v.Action != "" {
+			line += " (" + v.Action + ")"
+		}
+		if v.Message != "" {
+			line += ": " + v.Message
+		}
+		fmt.Fprintln(os.Stderr, line)
+		if v.Status == VerifyDenied {
+			denied = true
+		}
+	}
+	fmt.Fprintln(os.Stderr)
+	return denied
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/aws/smithy-go"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestClassifyVerifyError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"success", nil, VerifyAllowed},
+		{"iam denied", &smithy.GenericAPIError{Code: "AccessDenied", Message: "not authorized"}, VerifyDenied},
+		{"ssm denied", &smithy.GenericAPIError{Code: "AccessDeniedException"}, VerifyDenied},
+		{"ec2 denied", &smithy.GenericAPIError{Code: "UnauthorizedOperation"}, VerifyDenied},
+		{"s3 head denied", &smithy.GenericAPIError{Code: "Forbidden"}, VerifyDenied},
+		{"ssm missing", &smithy.GenericAPIError{Code: "ParameterNotFound"}, VerifyNotFound},
+		{"ec2 missing", &smithy.GenericAPIError{Code: "InvalidVpcID.NotFound"}, VerifyNotFound},
+		{"iam missing", &smithy.GenericAPIError{Code: "NoSuchEntity"}, VerifyNotFound},
+		{"throttled", &smithy.GenericAPIError{Code: "Throttling"}, VerifyError},
+		{"unknown argument", fmt.Errorf("%w: name", errUnknownArgument), VerifySkipped},
+		{"network", errors.New("dial tcp: timeout"), VerifyError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, _ := classifyVerifyError(tt.err); got != tt.want {
+				t.Errorf("classifyVerifyError(%v) = %s, want %s", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyDataSourcesWithoutCalls(t *testing.T) {
+	result := &ParseResult{
+		DataSources: []Resource{
+			{Kind: KindData, Type: "aws_iam_role", Name: "computed", Provider: "aws",
+				Attributes: map[string]cty.Value{"name": cty.UnknownVal(cty.String)}},
+			{Kind: KindData, Type: "aws_lakeformation_permissions", Name: "lf", Provider: "aws"},
+			{Kind: KindData, Type: "aws_iam_policy_document", Name: "doc", Provider: "aws"},
+			{Kind: KindData, Type: "google_project", Name: "other", Provider: "google"},
+		},
+	}
+
+	// None of these data sources reaches AWS, so no clients are needed
+	verifications := verifyDataSources(context.Background(), nil, result)
+	if len(verifications) != 3 {
+		t.Fatalf("Expected 3 verifications, got %d: %+v", len(verifications), verifications)
+	}
+
+	byAddress := make(map[string]DataSourceVerification)
+	for _, v := range verifications {
+		byAddress[v.Address] = v
+	}
+	if v := byAddress["data.aws_iam_role.computed"]; v.Status != VerifySkipped || v.Action != "iam:GetRole" {
+		t.Errorf("Computed role name: got %+v, want skipped iam:GetRole", v)
+	}
+	if v := byAddress["data.aws_iam_policy_document.doc"]; v.Status != VerifyLocal {
+		t.Errorf("Policy document: got %+v, want local", v)
+	}
+	if v := byAddress["data.aws_lakeformation_permissions.lf"]; v.Status != VerifyUnsupported {
+		t.Errorf("Unknown data source: got %+v, want unsupported", v)
+	}
+}
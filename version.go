@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/spf13/cobra"
+)
+
+// Build information, set at link time:
+//
+//	go build -ldflags "-X main.version=v1.2.0 -X main.commit=$(git rev-parse HEAD) -X main.buildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// When unset, commit and build date fall back to the VCS stamp recorded by
+// the Go toolchain.
+var (
+	version   = "dev"
+	commit    = ""
+	buildDate = ""
+)
+
+var versionCmd = &cobra.Command{
+	Use:   "version",
+	Short: "Print the binary version and the embedded permissions database version",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := loadPermissionsDB(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		info := currentBuildInfo()
+		fmt.Printf("tf-iam-scanner %s\n", info.Version)
+		fmt.Printf("  commit:         %s\n", valueOrUnknown(info.Commit))
+		fmt.Printf("  built:          %s\n", valueOrUnknown(info.Date))
+		fmt.Printf("  go:             %s\n", info.GoVersion)
+		fmt.Printf("  permissions DB: %s\n", describePermissionsDB())
+	},
+}
+
+func init() {
+	rootCmd.Version = version
+	rootCmd.AddCommand(versionCmd)
+}
+
+// buildInfo describes the running binary.
+type buildInfo struct {
+	Version   string
+	Commit    string
+	Date      string
+	GoVersion string
+}
+
+// currentBuildInfo combines the link-time variables with the VCS settings
+// embedded by the Go toolchain.
+func currentBuildInfo() buildInfo {
+	info := buildInfo{
+		Version:   version,
+		Commit:    commit,
+		Date:      buildDate,
+		GoVersion: runtime.Version(),
+	}
+
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		modified := false
+		for _, setting := range bi.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = setting.Value
+				}
+			case "vcs.time":
+				if info.Date == "" {
+					info.Date = setting.Value
+				}
+			case "vcs.modified":
+				modified = setting.Value == "true"
+			}
+		}
+		if modified && commit == "" && info.Commit != "" {
+			info.Commit += "-dirty"
+		}
+	}
+
+	return info
+}
+
+// describePermissionsDB summarizes the loaded permissions database, e.g.
+// "2026.10.17 (2026-10-17, 1421 entries)".
+func describePermissionsDB() string {
+	description := fmt.Sprintf("%s (%s, %d entries)",
+		valueOrUnknown(permissionsDBMeta.Version), valueOrUnknown(permissionsDBMeta.Date), permissionEntryCount())
+	if len(permissionPluginFiles) > 0 {
+		description += fmt.Sprintf(" + %d drop-in mapping files", len(permissionPluginFiles))
+	}
+	return description
+}
+
+func valueOrUnknown(s string) string {
+	if s == "" {
+		return "unknown"
+	}
+	return s
+}
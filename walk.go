@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+var followSymlinksFlag bool
+
+// walkTerraformDir calls fn for every file below root, in lexical order like
+// filepath.Walk. root itself is followed when it is a symlink, since --path
+// and module sources name it explicitly. Symlinked directories below it are
+// followed only when follow is set; a directory whose real path is already
+// being walked is skipped with a warning, which breaks symlink cycles. A file
+// reached through several symlinks is visited once. Symlinked files are
+// always visited.
+func walkTerraformDir(root string, follow bool, fn func(path string, info os.FileInfo), warn func(string)) {
+	info, err := os.Stat(root)
+	if err != nil {
+		warn(fmt.Sprintf("Error accessing %s: %v", root, err))
+		return
+	}
+	if !info.IsDir() {
+		fn(root, info)
+		return
+	}
+
+	w := &dirWalker{
+		follow:    follow,
+		fn:        fn,
+		warn:      warn,
+		ancestors: make(map[string]bool),
+		files:     make(map[string]bool),
+	}
+	w.walk(root)
+}
+
+type dirWalker struct {
+	follow    bool
+	fn        func(path string, info os.FileInfo)
+	warn      func(string)
+	ancestors map[string]bool // real paths of the directories being walked
+	files     map[string]bool // real paths of the files visited
+}
+
+func (w *dirWalker) walk(dir string) {
+	real := realPath(dir)
+	if w.ancestors[real] {
+		w.warn(fmt.Sprintf("Skipping %s: symlink cycle back to %s", dir, real))
+		return
+	}
+	w.ancestors[real] = true
+	defer delete(w.ancestors, real)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		w.warn(fmt.Sprintf("Error accessing %s: %v", dir, err))
+		return
+	}
+
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+
+		info, err := entry.Info()
+		if err != nil {
+			w.warn(fmt.Sprintf("Error accessing %s: %v", path, err))
+			continue
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			target, err := os.Stat(path)
+			if err != nil {
+				w.warn(fmt.Sprintf("Error accessing %s: %v", path, err))
+				continue
+			}
+			if target.IsDir() && !w.follow {
+				continue
+			}
+			info = target
+		}
+
+		if info.IsDir() {
+			w.walk(path)
+			continue
+		}
+
+		real := realPath(path)
+		if w.files[real] {
+			continue
+		}
+		w.files[real] = true
+		w.fn(path, info)
+	}
+}
+
+// realPath returns the absolute path of path with symlinks resolved, or its
+// absolute path when they cannot be.
+func realPath(path string) string {
+	if real, err := filepath.EvalSymlinks(path); err == nil {
+		path = real
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		return filepath.Clean(abs)
+	}
+	return filepath.Clean(path)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWalkTerraformDirSymlinks(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "root")
+	writeTestFile(t, filepath.Join(root, "main.tf"), "")
+	writeTestFile(t, filepath.Join(dir, "outside", "shared.tf"), "")
+	if err := os.Symlink(filepath.Join(dir, "outside"), filepath.Join(root, "link")); err != nil {
+		t.Skipf("Symlinks not supported: %v", err)
+	}
+	if err := os.Symlink(root, filepath.Join(root, "loop")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(root, "main.tf"), filepath.Join(root, "alias.tf")); err != nil {
+		t.Fatal(err)
+	}
+
+	walk := func(follow bool) ([]string, []string) {
+		var files, warnings []string
+		walkTerraformDir(root, follow, func(path string, info os.FileInfo) {
+			rel, _ := filepath.Rel(root, path)
+			files = append(files, rel)
+		}, func(warning string) {
+			warnings = append(warnings, warning)
+		})
+		return files, warnings
+	}
+
+	files, warnings := walk(false)
+	if strings.Join(files, ",") != "alias.tf" || len(warnings) != 0 {
+		t.Errorf("Without following, expected only the symlinked file once, got %v (warnings %v)", files, warnings)
+	}
+
+	files, warnings = walk(true)
+	if strings.Join(files, ",") != "alias.tf,"+filepath.Join("link", "shared.tf") {
+		t.Errorf("Unexpected files when following symlinks: %v", files)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "symlink cycle") {
+		t.Errorf("Expected a symlink cycle warning, got %v", warnings)
+	}
+}
+
+func TestScanSymlinkedVendoredModule(t *testing.T) {
+	defer func() { followSymlinksFlag = false }()
+
+	root := t.TempDir()
+	writeTestFile(t, filepath.Join(root, "main.tf"), `
+module "queue" {
+  source = "./modules/queue"
+}
+`)
+	writeTestFile(t, filepath.Join(root, "vendor", "queue", "main.tf"), `
+resource "aws_sqs_queue" "this" {
+  name = "jobs"
+}
+`)
+	if err := os.MkdirAll(filepath.Join(root, "modules"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join("..", "vendor", "queue"), filepath.Join(root, "modules", "queue")); err != nil {
+		t.Skipf("Symlinks not supported: %v", err)
+	}
+
+	for _, follow := range []bool{false, true} {
+		followSymlinksFlag = follow
+		result, err := parseTerraformFiles(root)
+		if err != nil {
+			t.Fatalf("Error parsing: %v", err)
+		}
+
+		var addresses []string
+		for _, resource := range result.Resources {
+			addresses = append(addresses, resourceAddress(resource))
+		}
+		if strings.Join(addresses, ",") != "module.queue.aws_sqs_queue.this" {
+			t.Errorf("follow=%v: expected the vendored module once through its symlink, got %v", follow, addresses)
+		}
+	}
+}
+
+func TestInTerraformDataDir(t *testing.T) {
+	tests := map[string]bool{
+		filepath.Join(".terraform", "modules", "vpc", "main.tf"):           true,
+		filepath.Join("stacks", "app", ".terraform", "modules", "main.tf"): true,
+		filepath.Join("stacks", "app", "main.tf"):                          false,
+		filepath.Join("terraform", "main.tf"):                              false,
+		".terraform.lock.hcl":                                              false,
+	}
+	for path, want := range tests {
+		if got := inTerraformDataDir(path); got != want {
+			t.Errorf("inTerraformDataDir(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
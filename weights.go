@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// serviceWeightsFlag prints the per-service permission weight table in the
+// run summary (--service-weights).
+var serviceWeightsFlag bool
+
+// Permission weight of a service. Like the risk score it is a review aid:
+// it ranks services by how much of the account their grants can change,
+// using the risk score's weights for wildcards and permissions management.
+const (
+	weightWriteAction    = 2 // Write and Tagging actions, after expanding wildcards
+	weightResource       = 1 // each Terraform resource the service's actions come from
+	weightWildcardGrants = riskWeightWildcardResource
+)
+
+// ServiceWeight is the permission weight of one service in a policy: how
+// many write and permissions management actions it grants (wildcards
+// expanded through the catalog), how many Terraform resources need them,
+// and its wildcard actions and actions granted on Resource "*".
+type ServiceWeight struct {
+	Service               string `json:"service"`
+	Actions               int    `json:"actions"`
+	WriteActions          int    `json:"write_actions"`
+	PermissionsManagement int    `json:"permissions_management_actions"`
+	Resources             int    `json:"resources"`
+	WildcardActions       int    `json:"wildcard_actions"`
+	WildcardResource      int    `json:"wildcard_resource_actions"`
+	Weight                int    `json:"weight"`
+}
+
+// computeServiceWeights returns the weight of every service policy allows,
+// heaviest first (ties by name). Resources are counted from contributions.
+func computeServiceWeights(policy IAMPolicy, contributions []resourceContribution) []ServiceWeight {
+	if actionCatalog == nil {
+		_ = loadActionCatalog()
+	}
+
+	resources := make(map[string]map[string]bool)
+	for _, contribution := range contributions {
+		for _, action := range contribution.Actions {
+			service, _, _ := strings.Cut(action, ":")
+			if resources[service] == nil {
+				resources[service] = make(map[string]bool)
+			}
+			resources[service][contribution.Address] = true
+		}
+	}
+
+	// Actions granted on "*" without conditions, leaving out those that
+	// only support "*"
+	onWildcard := make(map[string]bool)
+	for _, statement := range policy.Statement {
+		if statement.Effect != "Allow" || len(statement.Condition) > 0 || !containsString(toStringSlice(statement.Resource), "*") {
+			continue
+		}
+		resourceLevel, _ := splitWildcardOnlyActions(toStringSlice(statement.Action))
+		for _, action := range resourceLevel {
+			onWildcard[action] = true
+		}
+	}
+
+	services, _ := servicesFromPolicy(policy)
+	weights := make([]ServiceWeight, 0, len(services))
+	for _, service := range services {
+		weight := ServiceWeight{
+			Service:   service.Name,
+			Actions:   len(service.Actions),
+			Resources: len(resources[service.Name]),
+		}
+		granted := make(map[string]bool)
+		for _, action := range service.Actions {
+			if onWildcard[action] {
+				weight.WildcardResource++
+			}
+			if !strings.ContainsAny(action, "*?") {
+				granted[action] = true
+				continue
+			}
+			weight.WildcardActions++
+			for _, expanded := range expandActionPattern(action) {
+				granted[expanded] = true
+			}
+		}
+		for action := range granted {
+			_, info, ok := lookupAction(action)
+			if !ok {
+				continue
+			}
+			switch info.Access {
+			case AccessWrite, AccessTagging:
+				weight.WriteActions++
+			case AccessPermissionsManagement:
+				weight.PermissionsManagement++
+			}
+		}
+		weight.Weight = weight.WriteActions*weightWriteAction +
+			weight.PermissionsManagement*riskWeightPermissionsMgmtAction +
+			weight.Resources*weightResource +
+			weight.WildcardActions*riskWeightWildcardAction +
+			weight.WildcardResource*weightWildcardGrants
+		weights = append(weights, weight)
+	}
+	sort.SliceStable(weights, func(i, j int) bool {
+		return weights[i].Weight > weights[j].Weight
+	})
+	return weights
+}
+
+// printServiceWeights writes the weights as a table, heaviest first.
+func printServiceWeights(w io.Writer, weights []ServiceWeight) {
+	if len(weights) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "  Permission weight by service (heaviest first):\n")
+	fmt.Fprintf(w, "    %-22s %6s %6s %6s %9s %9s %8s %6s\n", "SERVICE", "WEIGHT", "WRITE", "PERMS", "RESOURCES", "WILDCARDS", "ON \"*\"", "TOTAL")
+	for _, weight := range weights {
+		fmt.Fprintf(w, "    %-22s %6d %6d %6d %9d %9d %8d %6d\n", weight.Service, weight.Weight, weight.WriteActions,
+			weight.PermissionsManagement, weight.Resources, weight.WildcardActions, weight.WildcardResource, weight.Actions)
+	}
+}
+
+// htmlWeightRow is a row of the HTML report's heatmap: the weight and each
+// count with its heat level from 0 (none) to 4 (the column's maximum).
+type htmlWeightRow struct {
+	Service string
+	Cells   []htmlHeatCell
+}
+
+// htmlHeatCell is one cell of the heatmap.
+type htmlHeatCell struct {
+	Value int
+	Heat  int
+}
+
+// heatmapRows turns weights into heatmap rows, shading each column
+// relative to its maximum.
+func heatmapRows(weights []ServiceWeight) []htmlWeightRow {
+	columns := func(weight ServiceWeight) []int {
+		return []int{weight.Weight, weight.WriteActions, weight.PermissionsManagement, weight.Resources, weight.WildcardActions, weight.WildcardResource}
+	}
+	var maxima []int
+	for _, weight := range weights {
+		for i, value := range columns(weight) {
+			if i == len(maxima) {
+				maxima = append(maxima, 0)
+			}
+			maxima[i] = max(maxima[i], value)
+		}
+	}
+
+	rows := make([]htmlWeightRow, 0, len(weights))
+	for _, weight := range weights {
+		row := htmlWeightRow{Service: weight.Service}
+		for i, value := range columns(weight) {
+			heat := 0
+			if value > 0 {
+				heat = 1 + 3*value/maxima[i]
+				heat = min(heat, 4)
+			}
+			row.Cells = append(row.Cells, htmlHeatCell{Value: value, Heat: heat})
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestComputeServiceWeights(t *testing.T) {
+	policy := IAMPolicy{Statement: []IAMStatement{
+		{Effect: "Allow", Action: []string{"sqs:CreateQueue", "sqs:GetQueueAttributes", "sqs:TagQueue"}, Resource: "arn:aws:sqs:*:*:jobs"},
+		{Effect: "Allow", Action: []string{"iam:PutRolePolicy", "iam:GetRole"}, Resource: "*"},
+		{Effect: "Allow", Action: "ec2:Describe*", Resource: "*"},
+		{Effect: "Deny", Action: "s3:DeleteBucket", Resource: "*"},
+	}}
+	contributions := []resourceContribution{
+		{Address: "aws_sqs_queue.jobs", Actions: []string{"sqs:CreateQueue", "sqs:TagQueue"}},
+		{Address: "aws_sqs_queue.dead", Actions: []string{"sqs:CreateQueue"}},
+		{Address: "aws_iam_role.app", Actions: []string{"iam:PutRolePolicy"}},
+	}
+	weights := computeServiceWeights(policy, contributions)
+	byService := make(map[string]ServiceWeight)
+	for _, weight := range weights {
+		byService[weight.Service] = weight
+	}
+	if _, ok := byService["s3"]; ok || len(weights) != 3 {
+		t.Fatalf("Expected only the allowed services, got %+v", weights)
+	}
+
+	sqs := byService["sqs"]
+	if sqs.WriteActions != 2 || sqs.Resources != 2 || sqs.WildcardResource != 0 || sqs.Weight != 2*weightWriteAction+2*weightResource {
+		t.Errorf("Unexpected sqs weight: %+v", sqs)
+	}
+	iam := byService["iam"]
+	if iam.PermissionsManagement != 1 || iam.WildcardResource != 2 || iam.Resources != 1 {
+		t.Errorf("Unexpected iam weight: %+v", iam)
+	}
+	ec2 := byService["ec2"]
+	if ec2.WildcardActions != 1 || ec2.WriteActions != 0 || ec2.Weight < riskWeightWildcardAction {
+		t.Errorf("Unexpected ec2 weight: %+v", ec2)
+	}
+	for i := 1; i < len(weights); i++ {
+		if weights[i-1].Weight < weights[i].Weight {
+			t.Errorf("Expected the heaviest services first, got %+v", weights)
+		}
+	}
+
+	var out bytes.Buffer
+	printServiceWeights(&out, weights)
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 5 || !strings.Contains(lines[2], weights[0].Service) {
+		t.Errorf("Expected a header and a row per service, heaviest first:\n%s", out.String())
+	}
+}
+
+func TestHeatmapRows(t *testing.T) {
+	rows := heatmapRows([]ServiceWeight{
+		{Service: "iam", Weight: 40, WriteActions: 8},
+		{Service: "sqs", Weight: 10, WriteActions: 2},
+		{Service: "sts", Weight: 0},
+	})
+	if rows[0].Cells[0].Heat != 4 || rows[1].Cells[0].Heat != 1 || rows[2].Cells[0].Heat != 0 {
+		t.Errorf("Expected heat relative to the column maximum, got %+v", rows)
+	}
+	if rows[0].Cells[2].Heat != 0 {
+		t.Errorf("Expected empty columns to stay unshaded, got %+v", rows[0].Cells)
+	}
+
+	html, err := generateHTMLReport(IAMPolicy{Statement: []IAMStatement{{Effect: "Allow", Action: "iam:PutRolePolicy", Resource: "*"}}}, &ParseResult{})
+	if err != nil || !strings.Contains(html, "<h2>Permission weight</h2>") || !strings.Contains(html, `class="num heat4"`) {
+		t.Errorf("Expected the heatmap in the HTML report (%v)", err)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+// wildcardThresholdFlag collapses the actions of a service into service:*
+// when the policy needs more than this many of them; 0 keeps every action.
+var wildcardThresholdFlag int
+
+var servicePrefixPattern = regexp.MustCompile(`^[a-z0-9-]+$`)
+
+// validateWildcardConfig checks the wildcard threshold and the per-service
+// settings of config.
+func validateWildcardConfig(threshold int, config Config) error {
+	if threshold < 0 {
+		return fmt.Errorf("invalid --wildcard-threshold %d: expected 0 (never) or more", threshold)
+	}
+	for _, service := range config.NeverWildcard {
+		if !servicePrefixPattern.MatchString(service) {
+			return fmt.Errorf("invalid never_wildcard service %q: expected a service prefix such as iam", service)
+		}
+	}
+	services := make([]string, 0, len(config.WildcardThresholds))
+	for service := range config.WildcardThresholds {
+		services = append(services, service)
+	}
+	sort.Strings(services)
+	for _, service := range services {
+		if !servicePrefixPattern.MatchString(service) {
+			return fmt.Errorf("invalid wildcard_thresholds service %q: expected a service prefix such as logs", service)
+		}
+		if config.WildcardThresholds[service] < 0 {
+			return fmt.Errorf("invalid wildcard_thresholds for %s: %d", service, config.WildcardThresholds[service])
+		}
+		if containsString(config.NeverWildcard, service) {
+			return fmt.Errorf("%s is in both never_wildcard and wildcard_thresholds", service)
+		}
+	}
+	return nil
+}
+
+// wildcardThreshold returns the number of actions of service above which
+// they collapse into service:*, or 0 when they never do: services listed in
+// never_wildcard never do, those in wildcard_thresholds use their own
+// threshold and the others --wildcard-threshold.
+func wildcardThreshold(service string) int {
+	if containsString(scannerConfig.NeverWildcard, service) {
+		return 0
+	}
+	if threshold, ok := scannerConfig.WildcardThresholds[service]; ok {
+		return threshold
+	}
+	return wildcardThresholdFlag
+}
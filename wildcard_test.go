@@ -0,0 +1,59 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGroupActionsByServiceWildcardThreshold(t *testing.T) {
+	defer func() { wildcardThresholdFlag, scannerConfig = 0, Config{} }()
+	actions := []string{
+		"iam:CreateRole", "iam:DeleteRole", "iam:GetRole",
+		"logs:CreateLogGroup", "logs:DeleteLogGroup", "logs:DescribeLogGroups",
+		"s3:CreateBucket", "s3:DeleteBucket", "s3:GetBucketPolicy",
+		"sts:GetCallerIdentity",
+	}
+
+	if got := groupActionsByService(actions); len(got) != len(actions) {
+		t.Errorf("Expected no wildcards by default, got %v", got)
+	}
+
+	wildcardThresholdFlag = 2
+	got := strings.Join(groupActionsByService(actions), ",")
+	if got != "iam:*,logs:*,s3:*,sts:GetCallerIdentity" {
+		t.Errorf("Unexpected grouping with a threshold of 2: %s", got)
+	}
+
+	scannerConfig = Config{NeverWildcard: []string{"iam"}, WildcardThresholds: map[string]int{"s3": 5}}
+	got = strings.Join(groupActionsByService(actions), ",")
+	if got != "iam:CreateRole,iam:DeleteRole,iam:GetRole,logs:*,s3:CreateBucket,s3:DeleteBucket,s3:GetBucketPolicy,sts:GetCallerIdentity" {
+		t.Errorf("Unexpected grouping with per-service settings: %s", got)
+	}
+
+	wildcardThresholdFlag = 0
+	scannerConfig = Config{WildcardThresholds: map[string]int{"logs": 1}}
+	got = strings.Join(groupActionsByService(actions), ",")
+	if !strings.Contains(got, "logs:*") || strings.Contains(got, "s3:*") || strings.Contains(got, "iam:*") {
+		t.Errorf("Expected only logs to be wildcarded, got %s", got)
+	}
+}
+
+func TestValidateWildcardConfig(t *testing.T) {
+	if err := validateWildcardConfig(5, Config{NeverWildcard: []string{"iam", "kms", "sts"}, WildcardThresholds: map[string]int{"logs": 3}}); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	for name, tc := range map[string]struct {
+		threshold int
+		config    Config
+	}{
+		"negative threshold":     {-1, Config{}},
+		"invalid service":        {0, Config{NeverWildcard: []string{"iam:*"}}},
+		"negative service":       {0, Config{WildcardThresholds: map[string]int{"logs": -2}}},
+		"never and a threshold":  {0, Config{NeverWildcard: []string{"logs"}, WildcardThresholds: map[string]int{"logs": 3}}},
+		"uppercase service name": {0, Config{WildcardThresholds: map[string]int{"Logs": 3}}},
+	} {
+		if err := validateWildcardConfig(tc.threshold, tc.config); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
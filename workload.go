@@ -0,0 +1,233 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+//go:embed workload-policies.json
+var embeddedWorkloadPolicies []byte
+
+// workloadPoliciesFlag is the directory the policies of the Kubernetes
+// workloads found in the scan are written to.
+var workloadPoliciesFlag string
+
+// irsaRoleAnnotation is the service account annotation naming the IAM role
+// its pods assume (IAM roles for service accounts).
+const irsaRoleAnnotation = "eks.amazonaws.com/role-arn"
+
+// workloadPolicy is the documented IAM policy of a Kubernetes controller
+// that calls AWS with a role of its own, through IRSA or EKS Pod Identity,
+// and how to recognize it in a configuration: its Helm chart, its service
+// account name or its EKS add-on. Controllers AWS publishes a managed policy
+// for name it instead of a policy document.
+type workloadPolicy struct {
+	Description     string     `json:"description"`
+	Documentation   string     `json:"documentation"`
+	Charts          []string   `json:"charts"`
+	ServiceAccounts []string   `json:"service_accounts"`
+	Addons          []string   `json:"addons,omitempty"`
+	ManagedPolicy   string     `json:"managed_policy,omitempty"`
+	Policy          *IAMPolicy `json:"policy,omitempty"`
+}
+
+var workloadPolicies map[string]workloadPolicy
+
+func loadWorkloadPolicies() error {
+	var policies map[string]workloadPolicy
+	if err := json.Unmarshal(embeddedWorkloadPolicies, &policies); err != nil {
+		return fmt.Errorf("error parsing workload-policies.json: %w", err)
+	}
+	workloadPolicies = policies
+	return nil
+}
+
+// WorkloadDetection is a Kubernetes workload found in the scan whose role
+// needs a policy of its own, separate from the policy of the Terraform run.
+type WorkloadDetection struct {
+	Workload      string `json:"workload"`
+	Address       string `json:"address"`
+	Location      string `json:"location,omitempty"`
+	Via           string `json:"via"`
+	ManagedPolicy string `json:"managed_policy,omitempty"`
+	PolicyFile    string `json:"policy_file,omitempty"`
+}
+
+// Ways a workload is recognized.
+const (
+	viaHelmChart      = "helm chart"
+	viaServiceAccount = "service account annotation"
+	viaPodIdentity    = "pod identity association"
+	viaEKSAddon       = "EKS add-on"
+)
+
+// detectWorkloads returns the known workloads result deploys or grants a
+// role to: Helm releases of their chart, Kubernetes service accounts of
+// their name annotated with an IRSA role, EKS Pod Identity associations for
+// their service account and EKS add-ons. Values must be literals.
+func detectWorkloads(result *ParseResult) []WorkloadDetection {
+	if workloadPolicies == nil {
+		if err := loadWorkloadPolicies(); err != nil {
+			return nil
+		}
+	}
+
+	var detections []WorkloadDetection
+	for _, resource := range result.Resources {
+		var via, value string
+		var matches func(workloadPolicy) []string
+		switch resource.Type {
+		case "helm_release":
+			chart, ok := literalAttribute(resource, "chart")
+			if !ok {
+				continue
+			}
+			via, value = viaHelmChart, path.Base(chart)
+			matches = func(w workloadPolicy) []string { return w.Charts }
+		case "kubernetes_service_account", "kubernetes_service_account_v1":
+			name, ok := literalAttribute(resource, "metadata.name")
+			if !ok || !hasAnnotation(resource.Attributes["metadata.annotations"], irsaRoleAnnotation) {
+				continue
+			}
+			via, value = viaServiceAccount, name
+			matches = func(w workloadPolicy) []string { return w.ServiceAccounts }
+		case "aws_eks_pod_identity_association":
+			name, ok := literalAttribute(resource, "service_account")
+			if !ok {
+				continue
+			}
+			via, value = viaPodIdentity, name
+			matches = func(w workloadPolicy) []string { return w.ServiceAccounts }
+		case "aws_eks_addon":
+			name, ok := literalAttribute(resource, "addon_name")
+			if !ok {
+				continue
+			}
+			via, value = viaEKSAddon, name
+			matches = func(w workloadPolicy) []string { return w.Addons }
+		default:
+			continue
+		}
+
+		for _, workload := range sortedWorkloadNames() {
+			policy := workloadPolicies[workload]
+			if !containsString(matches(policy), value) {
+				continue
+			}
+			detection := WorkloadDetection{
+				Workload: workload,
+				Address:  resourceAddress(resource),
+				Location: resourceLocation(resource),
+				Via:      via,
+			}
+			if policy.ManagedPolicy != "" {
+				detection.ManagedPolicy = renderARNTemplate(policy.ManagedPolicy, nil, defaultARNContext)
+			}
+			detections = append(detections, detection)
+		}
+	}
+	return detections
+}
+
+// hasAnnotation reports whether an annotations map or object has key,
+// whatever its value.
+func hasAnnotation(annotations cty.Value, key string) bool {
+	if annotations == cty.NilVal || annotations.IsNull() || !annotations.IsKnown() {
+		return false
+	}
+	switch {
+	case annotations.Type().IsObjectType():
+		return annotations.Type().HasAttribute(key)
+	case annotations.Type().IsMapType():
+		return annotations.HasIndex(cty.StringVal(key)).True()
+	}
+	return false
+}
+
+func sortedWorkloadNames() []string {
+	names := make([]string, 0, len(workloadPolicies))
+	for name := range workloadPolicies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// renderWorkloadPolicy returns the documented policy of workload with the
+// partition of ctx in its ARNs.
+func renderWorkloadPolicy(workload string, ctx arnContext) IAMPolicy {
+	documented := workloadPolicies[workload].Policy
+	policy := IAMPolicy{Version: documented.Version}
+	for _, statement := range documented.Statement {
+		resources := toStringSlice(statement.Resource)
+		for i, resource := range resources {
+			resources[i] = renderARNTemplate(resource, nil, ctx)
+		}
+		if len(resources) == 1 {
+			statement.Resource = resources[0]
+		} else {
+			statement.Resource = resources
+		}
+		statement.Action = toStringSlice(statement.Action)
+		policy.Statement = append(policy.Statement, statement)
+	}
+	return policy
+}
+
+// writeWorkloadPolicies writes the documented policy of each detected
+// workload that has one to <dir>/<workload>.json, once per workload, and
+// records the file in its detections.
+func writeWorkloadPolicies(detections []WorkloadDetection, dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("error creating %s: %w", dir, err)
+	}
+	written := make(map[string]string)
+	for i, detection := range detections {
+		if workloadPolicies[detection.Workload].Policy == nil {
+			continue
+		}
+		file, ok := written[detection.Workload]
+		if !ok {
+			file = filepath.Join(dir, detection.Workload+".json")
+			data, err := json.MarshalIndent(renderWorkloadPolicy(detection.Workload, defaultARNContext), "", "  ")
+			if err != nil {
+				return err
+			}
+			if err := writeOutputFile(file, append(data, '\n'), outputMode, forceFlag); err != nil {
+				return err
+			}
+			written[detection.Workload] = file
+		}
+		detections[i].PolicyFile = file
+	}
+	return nil
+}
+
+// printWorkloads lists the detected workloads in the run summary with where
+// their policy is.
+func printWorkloads(detections []WorkloadDetection) {
+	if len(detections) == 0 {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "  Workload policies (for the workload's own role, not this run):\n")
+	for _, detection := range detections {
+		policy := workloadPolicies[detection.Workload]
+		var where string
+		switch {
+		case detection.ManagedPolicy != "":
+			where = "attach the AWS managed policy " + detection.ManagedPolicy
+		case detection.PolicyFile != "":
+			where = "written to " + detection.PolicyFile
+		default:
+			where = "use --workload-policies to write it"
+		}
+		fmt.Fprintf(os.Stderr, "    - %s (%s, %s %s): %s\n", policy.Description, detection.Workload, detection.Via, detection.Address, where)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestDetectWorkloads(t *testing.T) {
+	if err := loadPermissionsDB(); err != nil {
+		t.Fatalf("Error loading permissions DB: %v", err)
+	}
+	source := `
+resource "helm_release" "lbc" {
+  name  = "aws-load-balancer-controller"
+  chart = "eks/aws-load-balancer-controller"
+}
+
+resource "kubernetes_service_account_v1" "dns" {
+  metadata {
+    name = "external-dns"
+    annotations = {
+      "eks.amazonaws.com/role-arn" = aws_iam_role.dns.arn
+    }
+  }
+}
+
+resource "kubernetes_service_account" "plain" {
+  metadata {
+    name = "cluster-autoscaler"
+  }
+}
+
+resource "aws_eks_addon" "ebs" {
+  cluster_name = "main"
+  addon_name   = "aws-ebs-csi-driver"
+}
+
+resource "helm_release" "other" {
+  name  = "nginx"
+  chart = "ingress-nginx"
+}
+`
+	result, err := parseTerraformSource([]byte(source), "main.tf")
+	if err != nil {
+		t.Fatalf("Error parsing source: %v", err)
+	}
+
+	detections := detectWorkloads(result)
+	got := make(map[string]WorkloadDetection)
+	for _, detection := range detections {
+		got[detection.Workload] = detection
+	}
+	if len(detections) != 3 {
+		t.Fatalf("Expected 3 workloads, got %+v", detections)
+	}
+	if got["aws-load-balancer-controller"].Via != viaHelmChart {
+		t.Errorf("Expected the load balancer controller from its chart, got %+v", got["aws-load-balancer-controller"])
+	}
+	if got["external-dns"].Via != viaServiceAccount {
+		t.Errorf("Expected ExternalDNS from its annotated service account, got %+v", got["external-dns"])
+	}
+	if _, ok := got["cluster-autoscaler"]; ok {
+		t.Errorf("Expected a service account without the IRSA annotation to be ignored")
+	}
+	ebs := got["aws-ebs-csi-driver"]
+	if ebs.Via != viaEKSAddon || ebs.ManagedPolicy != "arn:aws:iam::aws:policy/service-role/AmazonEBSCSIDriverPolicy" {
+		t.Errorf("Expected the EBS CSI driver add-on with its managed policy, got %+v", ebs)
+	}
+}
+
+func TestWriteWorkloadPolicies(t *testing.T) {
+	if err := loadWorkloadPolicies(); err != nil {
+		t.Fatalf("Error loading workload policies: %v", err)
+	}
+	dir := filepath.Join(t.TempDir(), "workloads")
+	detections := []WorkloadDetection{
+		{Workload: "external-dns", Address: "helm_release.dns", Via: viaHelmChart},
+		{Workload: "external-dns", Address: "kubernetes_service_account.dns", Via: viaServiceAccount},
+		{Workload: "aws-ebs-csi-driver", Address: "aws_eks_addon.ebs", Via: viaEKSAddon},
+	}
+	if err := writeWorkloadPolicies(detections, dir); err != nil {
+		t.Fatalf("Error writing workload policies: %v", err)
+	}
+
+	file := filepath.Join(dir, "external-dns.json")
+	if detections[0].PolicyFile != file || detections[1].PolicyFile != file {
+		t.Errorf("Expected both detections to point at %s, got %+v", file, detections)
+	}
+	if detections[2].PolicyFile != "" {
+		t.Errorf("Expected no file for a workload with a managed policy, got %s", detections[2].PolicyFile)
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("Error reading %s: %v", file, err)
+	}
+	var policy IAMPolicy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		t.Fatalf("Expected a JSON policy, got %v", err)
+	}
+	if strings.Contains(string(data), "${partition}") || !strings.Contains(string(data), "arn:aws:route53:::hostedzone/*") {
+		t.Errorf("Expected the partition to be rendered, got %s", data)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("Expected one policy file, got %d", len(entries))
+	}
+}
+
+func TestHasAnnotation(t *testing.T) {
+	object := cty.ObjectVal(map[string]cty.Value{irsaRoleAnnotation: cty.UnknownVal(cty.String)})
+	if !hasAnnotation(object, irsaRoleAnnotation) {
+		t.Errorf("Expected an object with the key to have the annotation")
+	}
+	labels := cty.MapVal(map[string]cty.Value{"app": cty.StringVal("dns")})
+	if hasAnnotation(labels, irsaRoleAnnotation) {
+		t.Errorf("Expected a map without the key not to have the annotation")
+	}
+	if hasAnnotation(cty.NilVal, irsaRoleAnnotation) || hasAnnotation(cty.NullVal(cty.Map(cty.String)), irsaRoleAnnotation) {
+		t.Errorf("Expected missing annotations not to have the key")
+	}
+}